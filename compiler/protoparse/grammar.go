@@ -0,0 +1,948 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protoparse
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"google.golang.org/protobuf/internal/genid"
+	"google.golang.org/protobuf/internal/strs"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	maxFieldNumber = 536870911
+
+	// maxRangeSentinel is the end of an extension or reserved range ending
+	// in "max" until it is known whether the message uses the message set
+	// wire format, which permits larger field numbers.
+	maxRangeSentinel = -1
+)
+
+var scalarTypes = map[string]descriptorpb.FieldDescriptorProto_Type{
+	"double":   descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+	"float":    descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+	"int64":    descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	"uint64":   descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+	"int32":    descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	"fixed64":  descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+	"fixed32":  descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
+	"bool":     descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	"string":   descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	"bytes":    descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+	"uint32":   descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	"sfixed32": descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
+	"sfixed64": descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+	"sint32":   descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+	"sint64":   descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+}
+
+// bailout is the panic value used to abandon parsing on the first error.
+type bailout struct{ err error }
+
+// parser parses a single .proto source file into a FileDescriptorProto.
+// Type names are left as written in the source, to be resolved once the
+// imported files are available.
+type parser struct {
+	lex  *lexer
+	toks []token // lookahead; toks[0] is the current token
+	prev token   // the last consumed token
+
+	fd     *descriptorpb.FileDescriptorProto
+	proto3 bool
+
+	// options are the options that name extensions, which can only be
+	// interpreted once the file is resolved.
+	options []*option
+
+	locs      []*descriptorpb.SourceCodeInfo_Location
+	positions map[string]position // start of each declaration by path
+}
+
+// option is an option assignment in the source.
+type option struct {
+	name  []optionNamePart
+	value constant
+	pos   position
+
+	scope protoreflect.FullName // scope in which extension names resolve
+	msg   func() protoreflect.Message
+}
+
+type optionNamePart struct {
+	name string
+	ext  bool // whether the part is a parenthesized extension name
+}
+
+func (o *option) String() string {
+	var b bytes.Buffer
+	for i, n := range o.name {
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		if n.ext {
+			fmt.Fprintf(&b, "(%s)", n.name)
+		} else {
+			b.WriteString(n.name)
+		}
+	}
+	return b.String()
+}
+
+// constant is the value of an option or default.
+type constant struct {
+	kind tokenKind // tokenIdent, tokenInt, tokenFloat, tokenString, or tokenSymbol for an aggregate
+	neg  bool
+	text string // identifier or number; the text format of an aggregate
+	str  string // decoded string
+	pos  position
+}
+
+func parse(path, src string) (p *parser, err error) {
+	p = &parser{
+		lex:       newLexer(path, src),
+		fd:        &descriptorpb.FileDescriptorProto{Name: proto.String(path)},
+		positions: map[string]position{},
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			b, ok := r.(bailout)
+			if !ok {
+				panic(r)
+			}
+			p, err = nil, b.err
+		}
+	}()
+	p.parseFile()
+	return p, nil
+}
+
+func (p *parser) peek(n int) token {
+	for len(p.toks) <= n {
+		t, err := p.lex.next()
+		if err != nil {
+			panic(bailout{err})
+		}
+		p.toks = append(p.toks, t)
+	}
+	return p.toks[n]
+}
+
+func (p *parser) cur() token {
+	return p.peek(0)
+}
+
+func (p *parser) next() token {
+	p.prev = p.cur()
+	p.toks = p.toks[1:]
+	return p.prev
+}
+
+func (p *parser) errorf(pos position, f string, x ...interface{}) {
+	panic(bailout{p.lex.errorf(pos, f, x...)})
+}
+
+func (p *parser) expect(s string) token {
+	if t := p.cur(); !t.is(s) {
+		p.errorf(t.pos, "expected %q, found %v", s, t)
+	}
+	return p.next()
+}
+
+func (p *parser) expectIdent() string {
+	if t := p.cur(); t.kind != tokenIdent {
+		p.errorf(t.pos, "expected identifier, found %v", t)
+	}
+	return p.next().text
+}
+
+// expectFullIdent parses a dot-separated name, with a leading dot if
+// leadingDot is set.
+func (p *parser) expectFullIdent(leadingDot bool) string {
+	var s string
+	if leadingDot && p.cur().is(".") {
+		s = p.next().text
+	}
+	s += p.expectIdent()
+	for p.cur().is(".") {
+		s += p.next().text + p.expectIdent()
+	}
+	return s
+}
+
+func (p *parser) expectString() string {
+	t := p.cur()
+	if t.kind != tokenString {
+		p.errorf(t.pos, "expected string, found %v", t)
+	}
+	s := p.next().str
+	for p.cur().kind == tokenString {
+		s += p.next().str
+	}
+	return s
+}
+
+func (p *parser) expectInt(min, max int64) int32 {
+	c := p.parseConstant()
+	v, ok := c.int(min, max)
+	if !ok {
+		p.errorf(c.pos, "expected integer between %d and %d", min, max)
+	}
+	return int32(v)
+}
+
+// isDecl reports whether the current token starts a declaration with the
+// given keyword, as opposed to a field whose type has the same name.
+func (p *parser) isDecl(keyword string) bool {
+	return p.cur().is(keyword) && p.peek(1).kind == tokenIdent && p.peek(2).is("{")
+}
+
+// startLoc records the start of the declaration at path, which begins with
+// the token start, and returns its location to be finished with endLoc.
+func (p *parser) startLoc(path []int32, start token) *descriptorpb.SourceCodeInfo_Location {
+	path = append([]int32(nil), path...)
+	p.positions[pathKey(path)] = start.pos
+	loc := &descriptorpb.SourceCodeInfo_Location{Path: path}
+	if start.leading != "" {
+		loc.LeadingComments = proto.String(start.leading)
+	}
+	loc.LeadingDetachedComments = start.detached
+	loc.Span = []int32{int32(start.pos.line), int32(start.pos.col)}
+	p.locs = append(p.locs, loc)
+	return loc
+}
+
+// endLoc finishes a location at the last consumed token.
+func (p *parser) endLoc(loc *descriptorpb.SourceCodeInfo_Location) {
+	end := p.prev.end
+	if int32(end.line) != loc.Span[0] {
+		loc.Span = append(loc.Span, int32(end.line))
+	}
+	loc.Span = append(loc.Span, int32(end.col))
+	if t := p.cur().trailing; t != "" {
+		loc.TrailingComments = proto.String(t)
+	}
+}
+
+func pathKey(path []int32) string {
+	return fmt.Sprint(path)
+}
+
+func appendPath(p []int32, e ...int32) []int32 {
+	return append(append([]int32(nil), p...), e...)
+}
+
+func (p *parser) parseFile() {
+	fd := p.fd
+	if p.cur().is("syntax") {
+		loc := p.startLoc([]int32{int32(genid.FileDescriptorProto_Syntax_field_number)}, p.next())
+		p.expect("=")
+		t := p.cur()
+		switch s := p.expectString(); s {
+		case "proto2":
+		case "proto3":
+			fd.Syntax = proto.String(s)
+			p.proto3 = true
+		default:
+			p.errorf(t.pos, "unknown syntax %q", s)
+		}
+		p.expect(";")
+		p.endLoc(loc)
+	}
+	scope := func() protoreflect.FullName { return protoreflect.FullName(fd.GetPackage()) }
+	for t := p.cur(); t.kind != tokenEOF; t = p.cur() {
+		switch {
+		case t.is("import"):
+			path := []int32{int32(genid.FileDescriptorProto_Dependency_field_number), int32(len(fd.Dependency))}
+			loc := p.startLoc(path, p.next())
+			switch {
+			case p.cur().is("public"):
+				p.next()
+				fd.PublicDependency = append(fd.PublicDependency, int32(len(fd.Dependency)))
+			case p.cur().is("weak"):
+				p.next()
+				fd.WeakDependency = append(fd.WeakDependency, int32(len(fd.Dependency)))
+			}
+			fd.Dependency = append(fd.Dependency, p.expectString())
+			p.expect(";")
+			p.endLoc(loc)
+		case t.is("package"):
+			if fd.Package != nil {
+				p.errorf(t.pos, "multiple package declarations")
+			}
+			loc := p.startLoc([]int32{int32(genid.FileDescriptorProto_Package_field_number)}, p.next())
+			fd.Package = proto.String(p.expectFullIdent(false))
+			p.expect(";")
+			p.endLoc(loc)
+		case t.is("option"):
+			p.parseOptionStatement([]int32{int32(genid.FileDescriptorProto_Options_field_number)}, scope(), func() protoreflect.Message {
+				if fd.Options == nil {
+					fd.Options = &descriptorpb.FileOptions{}
+				}
+				return fd.Options.ProtoReflect()
+			})
+		case t.is("message"):
+			path := []int32{int32(genid.FileDescriptorProto_MessageType_field_number), int32(len(fd.MessageType))}
+			fd.MessageType = append(fd.MessageType, p.parseMessage(path, scope()))
+		case t.is("enum"):
+			path := []int32{int32(genid.FileDescriptorProto_EnumType_field_number), int32(len(fd.EnumType))}
+			fd.EnumType = append(fd.EnumType, p.parseEnum(path, scope()))
+		case t.is("service"):
+			path := []int32{int32(genid.FileDescriptorProto_Service_field_number), int32(len(fd.Service))}
+			fd.Service = append(fd.Service, p.parseService(path, scope()))
+		case t.is("extend"):
+			p.parseExtend(&fd.Extension, &fd.MessageType,
+				[]int32{int32(genid.FileDescriptorProto_Extension_field_number)},
+				[]int32{int32(genid.FileDescriptorProto_MessageType_field_number)},
+				scope())
+		case t.is(";"):
+			p.next()
+		default:
+			p.errorf(t.pos, "expected top-level statement, found %v", t)
+		}
+	}
+}
+
+// parseOptionStatement parses "option name = value;" for the options message
+// returned by msg. The path is that of the options field of the declaration.
+func (p *parser) parseOptionStatement(path []int32, scope protoreflect.FullName, msg func() protoreflect.Message) {
+	start := p.next()
+	o := p.parseOption(scope, msg)
+	p.expect(";")
+	p.addOption(o, path, &start)
+}
+
+// parseOptionList parses a bracketed list of options, if present.
+func (p *parser) parseOptionList(scope protoreflect.FullName, msg func() protoreflect.Message) []*option {
+	if !p.cur().is("[") {
+		return nil
+	}
+	p.next()
+	var opts []*option
+	for {
+		opts = append(opts, p.parseOption(scope, msg))
+		if !p.cur().is(",") {
+			break
+		}
+		p.next()
+	}
+	p.expect("]")
+	return opts
+}
+
+func (p *parser) parseOption(scope protoreflect.FullName, msg func() protoreflect.Message) *option {
+	o := &option{pos: p.cur().pos, scope: scope, msg: msg}
+	for {
+		if p.cur().is("(") {
+			p.next()
+			o.name = append(o.name, optionNamePart{name: p.expectFullIdent(true), ext: true})
+			p.expect(")")
+		} else {
+			o.name = append(o.name, optionNamePart{name: p.expectIdent()})
+		}
+		if !p.cur().is(".") {
+			break
+		}
+		p.next()
+	}
+	p.expect("=")
+	o.value = p.parseConstant()
+	return o
+}
+
+// addOption interprets an option of a standard options message right away,
+// since it may affect the validity of the file, and defers the rest.
+// If start is non-nil, it records the location of the option statement,
+// which begins with start, under the options field at path.
+func (p *parser) addOption(o *option, path []int32, start *token) {
+	for _, n := range o.name {
+		if n.ext {
+			p.options = append(p.options, o)
+			return
+		}
+	}
+	fd, err := setOption(o, nil)
+	if err != nil {
+		p.errorf(o.pos, "%v", err)
+	}
+	if start != nil {
+		p.endLoc(p.startLoc(appendPath(path, int32(fd.Number())), *start))
+	}
+}
+
+func (p *parser) parseConstant() constant {
+	t := p.cur()
+	c := constant{pos: t.pos}
+	if t.is("-") || t.is("+") {
+		c.neg = t.is("-")
+		p.next()
+		t = p.cur()
+		if t.kind != tokenInt && t.kind != tokenFloat && t.kind != tokenIdent {
+			p.errorf(t.pos, "expected number, found %v", t)
+		}
+	}
+	switch t.kind {
+	case tokenIdent, tokenInt, tokenFloat:
+		c.kind, c.text = t.kind, p.next().text
+	case tokenString:
+		c.kind, c.str = tokenString, p.expectString()
+	default:
+		if !t.is("{") {
+			p.errorf(t.pos, "expected constant, found %v", t)
+		}
+		open := p.next()
+		for depth := 1; depth > 0; {
+			switch t := p.next(); {
+			case t.kind == tokenEOF:
+				p.errorf(open.pos, "unterminated aggregate value")
+			case t.is("{"), t.is("<"):
+				depth++
+			case t.is("}"), t.is(">"):
+				depth--
+			}
+		}
+		c.kind, c.text = tokenSymbol, p.lex.src[open.off+1:p.prev.off]
+	}
+	return c
+}
+
+func (p *parser) parseMessage(path []int32, scope protoreflect.FullName) *descriptorpb.DescriptorProto {
+	loc := p.startLoc(path, p.next())
+	md := &descriptorpb.DescriptorProto{Name: proto.String(p.expectIdent())}
+	p.expect("{")
+	p.parseMessageBody(md, path, scope.Append(protoreflect.Name(md.GetName())))
+	p.endLoc(loc)
+	return md
+}
+
+// parseMessageBody parses the declarations of a message or group through
+// the closing brace.
+func (p *parser) parseMessageBody(md *descriptorpb.DescriptorProto, path []int32, scope protoreflect.FullName) {
+	fieldPath := func() []int32 {
+		return appendPath(path, int32(genid.DescriptorProto_Field_field_number), int32(len(md.Field)))
+	}
+	nestedPath := appendPath(path, int32(genid.DescriptorProto_NestedType_field_number))
+	opts := func() protoreflect.Message {
+		if md.Options == nil {
+			md.Options = &descriptorpb.MessageOptions{}
+		}
+		return md.Options.ProtoReflect()
+	}
+	for t := p.cur(); !t.is("}"); t = p.cur() {
+		switch {
+		case t.kind == tokenEOF:
+			p.errorf(t.pos, "expected \"}\", found %v", t)
+		case p.isDecl("message"):
+			md.NestedType = append(md.NestedType, p.parseMessage(appendPath(nestedPath, int32(len(md.NestedType))), scope))
+		case p.isDecl("enum"):
+			path := appendPath(path, int32(genid.DescriptorProto_EnumType_field_number), int32(len(md.EnumType)))
+			md.EnumType = append(md.EnumType, p.parseEnum(path, scope))
+		case p.isDecl("oneof"):
+			p.parseOneof(md, path, scope)
+		case t.is("extend") && (p.peek(1).kind == tokenIdent || p.peek(1).is(".")):
+			p.parseExtend(&md.Extension, &md.NestedType, appendPath(path, int32(genid.DescriptorProto_Extension_field_number)), nestedPath, scope)
+		case t.is("option"):
+			p.parseOptionStatement(appendPath(path, int32(genid.DescriptorProto_Options_field_number)), scope, opts)
+		case t.is("extensions") && p.peek(1).kind == tokenInt:
+			p.parseExtensionRanges(md, path, scope)
+		case t.is("reserved") && (p.peek(1).kind == tokenInt || p.peek(1).kind == tokenString):
+			p.parseReserved(md, path)
+		case t.is(";"):
+			p.next()
+		default:
+			md.Field = append(md.Field, p.parseField(fieldPath(), &md.NestedType, nestedPath, scope, fieldContext{}))
+		}
+	}
+	p.next()
+
+	// Resolve the end of ranges ending in "max".
+	max := int32(maxFieldNumber + 1)
+	if md.GetOptions().GetMessageSetWireFormat() {
+		max = math.MaxInt32
+	}
+	for _, r := range md.ExtensionRange {
+		if r.GetEnd() == maxRangeSentinel {
+			r.End = proto.Int32(max)
+		}
+	}
+	for _, r := range md.ReservedRange {
+		if r.GetEnd() == maxRangeSentinel {
+			r.End = proto.Int32(max)
+		}
+	}
+
+	// Add a synthetic oneof for each proto3 optional field,
+	// after all the oneofs declared in the source.
+	names := map[string]bool{}
+	for _, f := range md.Field {
+		names[f.GetName()] = true
+	}
+	for _, o := range md.OneofDecl {
+		names[o.GetName()] = true
+	}
+	for _, f := range md.Field {
+		if !f.GetProto3Optional() {
+			continue
+		}
+		name := "_" + f.GetName()
+		for names[name] {
+			name = "X" + name
+		}
+		names[name] = true
+		f.OneofIndex = proto.Int32(int32(len(md.OneofDecl)))
+		md.OneofDecl = append(md.OneofDecl, &descriptorpb.OneofDescriptorProto{Name: proto.String(name)})
+	}
+}
+
+// fieldContext describes where a field is declared.
+type fieldContext struct {
+	extendee string // name of the extended message, for an extension
+	oneof    *int32 // index of the containing oneof
+}
+
+// parseField parses a field, adding any message it implicitly declares
+// (a group or map entry) to nested, whose path is nestedPath.
+func (p *parser) parseField(path []int32, nested *[]*descriptorpb.DescriptorProto, nestedPath []int32, scope protoreflect.FullName, ctx fieldContext) *descriptorpb.FieldDescriptorProto {
+	start := p.cur()
+	loc := p.startLoc(path, start)
+	f := &descriptorpb.FieldDescriptorProto{OneofIndex: ctx.oneof}
+	if ctx.extendee != "" {
+		f.Extendee = proto.String(ctx.extendee)
+	}
+
+	// Parse the label.
+	var label string
+	if t := p.cur(); (t.is("optional") || t.is("required") || t.is("repeated")) && (p.peek(1).kind == tokenIdent || p.peek(1).is(".")) {
+		label = p.next().text
+	}
+	switch {
+	case ctx.oneof != nil && label != "":
+		p.errorf(start.pos, "fields in oneofs must not have labels")
+	case label == "required" && p.proto3:
+		p.errorf(start.pos, "required fields are not allowed in proto3")
+	case label == "" && ctx.oneof == nil && !p.proto3 && !(p.cur().is("map") && p.peek(1).is("<")):
+		p.errorf(start.pos, "expected \"required\", \"optional\", or \"repeated\"")
+	}
+	switch label {
+	case "required":
+		f.Label = descriptorpb.FieldDescriptorProto_LABEL_REQUIRED.Enum()
+	case "repeated":
+		f.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	default:
+		f.Label = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+		if label == "optional" && p.proto3 {
+			f.Proto3Optional = proto.Bool(true)
+		}
+	}
+
+	// Parse the type.
+	var msg *descriptorpb.DescriptorProto // implicitly declared message
+	switch t := p.cur(); {
+	case t.is("group") && p.peek(1).kind == tokenIdent:
+		if p.proto3 {
+			p.errorf(t.pos, "groups are not allowed in proto3")
+		}
+		p.next()
+		name := p.expectIdent()
+		if r := rune(name[0]); !unicode.IsUpper(r) {
+			p.errorf(p.prev.pos, "group name %q must start with a capital letter", name)
+		}
+		msg = &descriptorpb.DescriptorProto{Name: proto.String(name)}
+		f.Name = proto.String(strings.ToLower(name))
+		f.Type = descriptorpb.FieldDescriptorProto_TYPE_GROUP.Enum()
+		f.TypeName = proto.String(name)
+	case t.is("map") && p.peek(1).is("<"):
+		switch {
+		case label != "":
+			p.errorf(t.pos, "map fields must not have labels")
+		case ctx.oneof != nil:
+			p.errorf(t.pos, "map fields are not allowed in oneofs")
+		case ctx.extendee != "":
+			p.errorf(t.pos, "map fields are not allowed in extensions")
+		}
+		p.next()
+		p.next()
+		key := p.parseFieldType()
+		p.expect(",")
+		val := p.parseFieldType()
+		p.expect(">")
+		f.Name = proto.String(p.expectIdent())
+		f.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		msg = &descriptorpb.DescriptorProto{
+			Name: proto.String(strs.MapEntryName(f.GetName())),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				key, val,
+			},
+			Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+		}
+		key.Name, key.Number = proto.String(string(genid.MapEntry_Key_field_name)), proto.Int32(int32(genid.MapEntry_Key_field_number))
+		val.Name, val.Number = proto.String(string(genid.MapEntry_Value_field_name)), proto.Int32(int32(genid.MapEntry_Value_field_number))
+		f.TypeName = msg.Name
+	default:
+		ft := p.parseFieldType()
+		f.Type, f.TypeName = ft.Type, ft.TypeName
+		f.Name = proto.String(p.expectIdent())
+	}
+	p.expect("=")
+	f.Number = proto.Int32(p.expectInt(1, math.MaxInt32))
+
+	// Parse the options.
+	opts := func() protoreflect.Message {
+		if f.Options == nil {
+			f.Options = &descriptorpb.FieldOptions{}
+		}
+		return f.Options.ProtoReflect()
+	}
+	for _, o := range p.parseOptionList(scope, opts) {
+		switch {
+		case len(o.name) == 1 && o.name[0].name == "default" && !o.name[0].ext:
+			if f.DefaultValue != nil {
+				p.errorf(o.pos, "default value already set")
+			}
+			s, err := defaultValue(f, o.value)
+			if err != nil {
+				p.errorf(o.value.pos, "%v", err)
+			}
+			f.DefaultValue = proto.String(s)
+		case len(o.name) == 1 && o.name[0].name == "json_name" && !o.name[0].ext:
+			if o.value.kind != tokenString {
+				p.errorf(o.value.pos, "json_name must be a string")
+			}
+			f.JsonName = proto.String(o.value.str)
+		default:
+			p.addOption(o, nil, nil)
+		}
+	}
+
+	if msg != nil && f.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+		path := appendPath(nestedPath, int32(len(*nested)))
+		mloc := p.startLoc(path, start)
+		p.expect("{")
+		p.parseMessageBody(msg, path, scope.Append(protoreflect.Name(msg.GetName())))
+		p.endLoc(mloc)
+	} else {
+		p.expect(";")
+	}
+	if msg != nil {
+		*nested = append(*nested, msg)
+	}
+	p.endLoc(loc)
+	return f
+}
+
+// parseFieldType parses a scalar type or a reference to a message or enum.
+func (p *parser) parseFieldType() *descriptorpb.FieldDescriptorProto {
+	f := &descriptorpb.FieldDescriptorProto{Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()}
+	if t, ok := scalarTypes[p.cur().text]; ok && p.cur().kind == tokenIdent && !p.peek(1).is(".") {
+		p.next()
+		f.Type = t.Enum()
+		return f
+	}
+	f.TypeName = proto.String(p.expectFullIdent(true))
+	return f
+}
+
+func (p *parser) parseOneof(md *descriptorpb.DescriptorProto, msgPath []int32, scope protoreflect.FullName) {
+	index := int32(len(md.OneofDecl))
+	path := appendPath(msgPath, int32(genid.DescriptorProto_OneofDecl_field_number), index)
+	loc := p.startLoc(path, p.next())
+	od := &descriptorpb.OneofDescriptorProto{Name: proto.String(p.expectIdent())}
+	md.OneofDecl = append(md.OneofDecl, od)
+	opts := func() protoreflect.Message {
+		if od.Options == nil {
+			od.Options = &descriptorpb.OneofOptions{}
+		}
+		return od.Options.ProtoReflect()
+	}
+	p.expect("{")
+	for t := p.cur(); !t.is("}"); t = p.cur() {
+		switch {
+		case t.kind == tokenEOF:
+			p.errorf(t.pos, "expected \"}\", found %v", t)
+		case t.is("option"):
+			p.parseOptionStatement(appendPath(path, int32(genid.OneofDescriptorProto_Options_field_number)), scope, opts)
+		case t.is(";"):
+			p.next()
+		default:
+			fieldPath := appendPath(msgPath, int32(genid.DescriptorProto_Field_field_number), int32(len(md.Field)))
+			nestedPath := appendPath(msgPath, int32(genid.DescriptorProto_NestedType_field_number))
+			md.Field = append(md.Field, p.parseField(fieldPath, &md.NestedType, nestedPath, scope, fieldContext{oneof: proto.Int32(index)}))
+		}
+	}
+	p.next()
+	p.endLoc(loc)
+}
+
+// parseExtend parses an extend block, adding its fields to fields and any
+// groups to nested. The path of the block is that of the fields.
+func (p *parser) parseExtend(fields *[]*descriptorpb.FieldDescriptorProto, nested *[]*descriptorpb.DescriptorProto, path, nestedPath []int32, scope protoreflect.FullName) {
+	loc := p.startLoc(path, p.next())
+	extendee := p.expectFullIdent(true)
+	p.expect("{")
+	for t := p.cur(); !t.is("}"); t = p.cur() {
+		switch {
+		case t.kind == tokenEOF:
+			p.errorf(t.pos, "expected \"}\", found %v", t)
+		case t.is(";"):
+			p.next()
+		default:
+			fieldPath := appendPath(path, int32(len(*fields)))
+			*fields = append(*fields, p.parseField(fieldPath, nested, nestedPath, scope, fieldContext{extendee: extendee}))
+		}
+	}
+	p.next()
+	p.endLoc(loc)
+}
+
+func (p *parser) parseExtensionRanges(md *descriptorpb.DescriptorProto, msgPath []int32, scope protoreflect.FullName) {
+	path := appendPath(msgPath, int32(genid.DescriptorProto_ExtensionRange_field_number))
+	loc := p.startLoc(path, p.next())
+	var rs []*descriptorpb.DescriptorProto_ExtensionRange
+	for {
+		start := p.expectInt(1, math.MaxInt32-1)
+		end := start + 1
+		if p.cur().is("to") {
+			p.next()
+			if p.cur().is("max") {
+				p.next()
+				end = maxRangeSentinel
+			} else {
+				end = p.expectInt(1, math.MaxInt32-1) + 1
+			}
+		}
+		rs = append(rs, &descriptorpb.DescriptorProto_ExtensionRange{Start: proto.Int32(start), End: proto.Int32(end)})
+		if !p.cur().is(",") {
+			break
+		}
+		p.next()
+	}
+	// The options apply to every range in the statement.
+	opts := p.parseOptionList(scope, nil)
+	for _, r := range rs {
+		r := r
+		msg := func() protoreflect.Message {
+			if r.Options == nil {
+				r.Options = &descriptorpb.ExtensionRangeOptions{}
+			}
+			return r.Options.ProtoReflect()
+		}
+		for _, o := range opts {
+			o := *o
+			o.msg = msg
+			p.addOption(&o, nil, nil)
+		}
+	}
+	p.expect(";")
+	p.endLoc(loc)
+	md.ExtensionRange = append(md.ExtensionRange, rs...)
+}
+
+func (p *parser) parseReserved(md *descriptorpb.DescriptorProto, msgPath []int32) {
+	start := p.next()
+	if p.cur().kind == tokenString {
+		loc := p.startLoc(appendPath(msgPath, int32(genid.DescriptorProto_ReservedName_field_number)), start)
+		md.ReservedName = append(md.ReservedName, p.parseReservedNames()...)
+		p.endLoc(loc)
+		return
+	}
+	loc := p.startLoc(appendPath(msgPath, int32(genid.DescriptorProto_ReservedRange_field_number)), start)
+	for {
+		start := p.expectInt(1, math.MaxInt32-1)
+		end := start + 1
+		if p.cur().is("to") {
+			p.next()
+			if p.cur().is("max") {
+				p.next()
+				end = maxRangeSentinel
+			} else {
+				end = p.expectInt(1, math.MaxInt32-1) + 1
+			}
+		}
+		md.ReservedRange = append(md.ReservedRange, &descriptorpb.DescriptorProto_ReservedRange{Start: proto.Int32(start), End: proto.Int32(end)})
+		if !p.cur().is(",") {
+			break
+		}
+		p.next()
+	}
+	p.expect(";")
+	p.endLoc(loc)
+}
+
+func (p *parser) parseReservedNames() []string {
+	var names []string
+	for {
+		names = append(names, p.expectString())
+		if !p.cur().is(",") {
+			break
+		}
+		p.next()
+	}
+	p.expect(";")
+	return names
+}
+
+func (p *parser) parseEnum(path []int32, scope protoreflect.FullName) *descriptorpb.EnumDescriptorProto {
+	loc := p.startLoc(path, p.next())
+	ed := &descriptorpb.EnumDescriptorProto{Name: proto.String(p.expectIdent())}
+	opts := func() protoreflect.Message {
+		if ed.Options == nil {
+			ed.Options = &descriptorpb.EnumOptions{}
+		}
+		return ed.Options.ProtoReflect()
+	}
+	p.expect("{")
+	for t := p.cur(); !t.is("}"); t = p.cur() {
+		switch {
+		case t.kind == tokenEOF:
+			p.errorf(t.pos, "expected \"}\", found %v", t)
+		case t.is("option") && !p.peek(1).is("="):
+			p.parseOptionStatement(appendPath(path, int32(genid.EnumDescriptorProto_Options_field_number)), scope, opts)
+		case t.is("reserved") && !p.peek(1).is("="):
+			p.parseEnumReserved(ed, path)
+		case t.is(";"):
+			p.next()
+		default:
+			vpath := appendPath(path, int32(genid.EnumDescriptorProto_Value_field_number), int32(len(ed.Value)))
+			vloc := p.startLoc(vpath, t)
+			vd := &descriptorpb.EnumValueDescriptorProto{Name: proto.String(p.expectIdent())}
+			p.expect("=")
+			vd.Number = proto.Int32(p.expectInt(math.MinInt32, math.MaxInt32))
+			for _, o := range p.parseOptionList(scope, func() protoreflect.Message {
+				if vd.Options == nil {
+					vd.Options = &descriptorpb.EnumValueOptions{}
+				}
+				return vd.Options.ProtoReflect()
+			}) {
+				p.addOption(o, nil, nil)
+			}
+			p.expect(";")
+			p.endLoc(vloc)
+			ed.Value = append(ed.Value, vd)
+		}
+	}
+	p.next()
+	p.endLoc(loc)
+	return ed
+}
+
+func (p *parser) parseEnumReserved(ed *descriptorpb.EnumDescriptorProto, enumPath []int32) {
+	start := p.next()
+	if p.cur().kind == tokenString {
+		loc := p.startLoc(appendPath(enumPath, int32(genid.EnumDescriptorProto_ReservedName_field_number)), start)
+		ed.ReservedName = append(ed.ReservedName, p.parseReservedNames()...)
+		p.endLoc(loc)
+		return
+	}
+	loc := p.startLoc(appendPath(enumPath, int32(genid.EnumDescriptorProto_ReservedRange_field_number)), start)
+	for {
+		start := p.expectInt(math.MinInt32, math.MaxInt32)
+		end := start
+		if p.cur().is("to") {
+			p.next()
+			if p.cur().is("max") {
+				p.next()
+				end = math.MaxInt32
+			} else {
+				end = p.expectInt(math.MinInt32, math.MaxInt32)
+			}
+		}
+		ed.ReservedRange = append(ed.ReservedRange, &descriptorpb.EnumDescriptorProto_EnumReservedRange{Start: proto.Int32(start), End: proto.Int32(end)})
+		if !p.cur().is(",") {
+			break
+		}
+		p.next()
+	}
+	p.expect(";")
+	p.endLoc(loc)
+}
+
+func (p *parser) parseService(path []int32, scope protoreflect.FullName) *descriptorpb.ServiceDescriptorProto {
+	loc := p.startLoc(path, p.next())
+	sd := &descriptorpb.ServiceDescriptorProto{Name: proto.String(p.expectIdent())}
+	scope = scope.Append(protoreflect.Name(sd.GetName()))
+	opts := func() protoreflect.Message {
+		if sd.Options == nil {
+			sd.Options = &descriptorpb.ServiceOptions{}
+		}
+		return sd.Options.ProtoReflect()
+	}
+	p.expect("{")
+	for t := p.cur(); !t.is("}"); t = p.cur() {
+		switch {
+		case t.kind == tokenEOF:
+			p.errorf(t.pos, "expected \"}\", found %v", t)
+		case t.is("option"):
+			p.parseOptionStatement(appendPath(path, int32(genid.ServiceDescriptorProto_Options_field_number)), scope, opts)
+		case t.is("rpc"):
+			mpath := appendPath(path, int32(genid.ServiceDescriptorProto_Method_field_number), int32(len(sd.Method)))
+			sd.Method = append(sd.Method, p.parseMethod(mpath, scope))
+		case t.is(";"):
+			p.next()
+		default:
+			p.errorf(t.pos, "expected \"rpc\" or \"option\", found %v", t)
+		}
+	}
+	p.next()
+	p.endLoc(loc)
+	return sd
+}
+
+func (p *parser) parseMethod(path []int32, scope protoreflect.FullName) *descriptorpb.MethodDescriptorProto {
+	loc := p.startLoc(path, p.next())
+	md := &descriptorpb.MethodDescriptorProto{Name: proto.String(p.expectIdent())}
+	parseType := func() (string, bool) {
+		p.expect("(")
+		stream := p.cur().is("stream") && (p.peek(1).kind == tokenIdent || p.peek(1).is("."))
+		if stream {
+			p.next()
+		}
+		name := p.expectFullIdent(true)
+		p.expect(")")
+		return name, stream
+	}
+	in, cs := parseType()
+	p.expect("returns")
+	out, ss := parseType()
+	md.InputType, md.OutputType = proto.String(in), proto.String(out)
+	if cs {
+		md.ClientStreaming = proto.Bool(true)
+	}
+	if ss {
+		md.ServerStreaming = proto.Bool(true)
+	}
+	if p.cur().is("{") {
+		opts := func() protoreflect.Message {
+			if md.Options == nil {
+				md.Options = &descriptorpb.MethodOptions{}
+			}
+			return md.Options.ProtoReflect()
+		}
+		p.next()
+		for t := p.cur(); !t.is("}"); t = p.cur() {
+			switch {
+			case t.kind == tokenEOF:
+				p.errorf(t.pos, "expected \"}\", found %v", t)
+			case t.is("option"):
+				p.parseOptionStatement(appendPath(path, int32(genid.MethodDescriptorProto_Options_field_number)), scope, opts)
+			case t.is(";"):
+				p.next()
+			default:
+				p.errorf(t.pos, "expected \"option\", found %v", t)
+			}
+		}
+		p.next()
+	} else {
+		p.expect(";")
+	}
+	p.endLoc(loc)
+	return md
+}
@@ -0,0 +1,358 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protoparse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/internal/errors"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenInt
+	tokenFloat
+	tokenString
+	tokenSymbol
+)
+
+// position is a zero-based line and column in a source file.
+// The column counts bytes, as in google.protobuf.SourceCodeInfo.
+type position struct {
+	line, col int
+}
+
+// token is a lexical token of a .proto source file.
+type token struct {
+	kind tokenKind
+	text string // source text of the token
+	str  string // decoded value of a string token
+	pos  position
+	end  position // position just past the last byte of the token
+	off  int      // offset of the token in the source
+
+	// Comments that precede the token, attached in the same manner as protoc.
+	// The trailing comment belongs to the previous token.
+	leading  string
+	trailing string
+	detached []string
+}
+
+func (t token) is(s string) bool {
+	return (t.kind == tokenSymbol || t.kind == tokenIdent) && t.text == s
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of input"
+	}
+	return strconv.Quote(t.text)
+}
+
+// comment is a line comment group or block comment.
+type comment struct {
+	text       string
+	start, end position
+	line       bool // whether this is a "//" comment
+}
+
+// lastLine returns the last line containing the comment.
+func (c comment) lastLine() int {
+	if c.line {
+		return c.end.line - 1 // the comment includes its newline
+	}
+	return c.end.line
+}
+
+type lexer struct {
+	file string
+	src  string
+	off  int
+	pos  position
+	prev position // end of the previous token
+	seen bool     // whether any token has been read
+}
+
+func newLexer(file, src string) *lexer {
+	return &lexer{file: file, src: src}
+}
+
+// next returns the next token of the input.
+func (l *lexer) next() (token, error) {
+	cs, err := l.skipSpace()
+	if err != nil {
+		return token{}, err
+	}
+	t := token{pos: l.pos, off: l.off}
+	if l.off >= len(l.src) {
+		t.kind = tokenEOF
+	} else {
+		c := l.src[l.off]
+		switch {
+		case isLetter(c):
+			n := 1
+			for n < len(l.src[l.off:]) && (isLetter(l.src[l.off+n]) || isDigit(l.src[l.off+n])) {
+				n++
+			}
+			t.kind, t.text = tokenIdent, l.src[l.off:l.off+n]
+		case isDigit(c) || (c == '.' && l.off+1 < len(l.src) && isDigit(l.src[l.off+1])):
+			t.kind, t.text = l.scanNumber()
+		case c == '"' || c == '\'':
+			s, n, err := l.scanString()
+			if err != nil {
+				return token{}, err
+			}
+			t.kind, t.text, t.str = tokenString, l.src[l.off:l.off+n], s
+		default:
+			r, n := utf8.DecodeRuneInString(l.src[l.off:])
+			if r == utf8.RuneError || !strings.ContainsRune("{}[]()<>;:,.=-+/", r) {
+				return token{}, l.errorf(l.pos, "invalid character %q", r)
+			}
+			t.kind, t.text = tokenSymbol, l.src[l.off:l.off+n]
+		}
+		l.advance(len(t.text))
+	}
+	t.end = l.pos
+	l.attachComments(&t, cs)
+	l.prev, l.seen = t.end, true
+	return t, nil
+}
+
+// attachComments assigns the comments preceding t following the rules of
+// protoc: a comment on the same line as the previous token trails it, and
+// the last comment block directly above t leads it. Others are detached.
+func (l *lexer) attachComments(t *token, cs []comment) {
+	if len(cs) > 0 && l.seen && cs[0].start.line == l.prev.line {
+		// A trailing comment may not be followed by another token on its line.
+		if len(cs) > 1 || cs[0].lastLine() < t.pos.line || t.kind == tokenEOF {
+			t.trailing = cs[0].text
+			cs = cs[1:]
+		}
+	}
+	if n := len(cs); n > 0 && t.kind != tokenEOF {
+		if cs[n-1].lastLine() >= t.pos.line-1 {
+			t.leading = cs[n-1].text
+			cs = cs[:n-1]
+		}
+	}
+	for _, c := range cs {
+		t.detached = append(t.detached, c.text)
+	}
+}
+
+// skipSpace skips whitespace and comments, returning the comments grouped
+// into blocks. Consecutive line comments form a single block.
+func (l *lexer) skipSpace() ([]comment, error) {
+	var cs []comment
+	lastLine := -1 // line of the previous line comment
+	for l.off < len(l.src) {
+		switch c := l.src[l.off]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\v' || c == '\f' || c == '\n':
+			l.advance(1)
+		case strings.HasPrefix(l.src[l.off:], "//"):
+			start := l.pos
+			n := strings.IndexByte(l.src[l.off:], '\n')
+			if n < 0 {
+				n = len(l.src) - l.off
+			} else {
+				n++
+			}
+			text := l.src[l.off+2 : l.off+n]
+			if !strings.HasSuffix(text, "\n") {
+				text += "\n"
+			}
+			l.advance(n)
+			if k := len(cs) - 1; k >= 0 && cs[k].line && lastLine == start.line-1 {
+				cs[k].text += text
+				cs[k].end = l.pos
+			} else {
+				cs = append(cs, comment{text: text, start: start, end: l.pos, line: true})
+			}
+			lastLine = start.line
+		case strings.HasPrefix(l.src[l.off:], "/*"):
+			start := l.pos
+			n := strings.Index(l.src[l.off+2:], "*/")
+			if n < 0 {
+				return nil, l.errorf(start, "unterminated block comment")
+			}
+			text := l.src[l.off+2 : l.off+2+n]
+			l.advance(n + 4)
+			cs = append(cs, comment{text: stripBlockComment(text), start: start, end: l.pos})
+		default:
+			return cs, nil
+		}
+	}
+	return cs, nil
+}
+
+// stripBlockComment removes the leading asterisks that conventionally
+// begin each continuation line of a block comment.
+func stripBlockComment(s string) string {
+	lines := strings.Split(s, "\n")
+	for i := 1; i < len(lines); i++ {
+		t := strings.TrimLeft(lines[i], " \t")
+		if strings.HasPrefix(t, "*") {
+			lines[i] = t[1:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (l *lexer) scanNumber() (tokenKind, string) {
+	s := l.src[l.off:]
+	n := 0
+	kind := tokenInt
+	if len(s) > 1 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		n = 2
+		for n < len(s) && isHexDigit(s[n]) {
+			n++
+		}
+		return kind, s[:n]
+	}
+	for n < len(s) && isDigit(s[n]) {
+		n++
+	}
+	if n < len(s) && s[n] == '.' {
+		kind = tokenFloat
+		n++
+		for n < len(s) && isDigit(s[n]) {
+			n++
+		}
+	}
+	if n < len(s) && (s[n] == 'e' || s[n] == 'E') {
+		m := n + 1
+		if m < len(s) && (s[m] == '+' || s[m] == '-') {
+			m++
+		}
+		if m < len(s) && isDigit(s[m]) {
+			kind = tokenFloat
+			n = m
+			for n < len(s) && isDigit(s[n]) {
+				n++
+			}
+		}
+	}
+	return kind, s[:n]
+}
+
+// scanString scans a quoted string, returning its decoded value and the
+// length of its source text.
+func (l *lexer) scanString() (string, int, error) {
+	s := l.src[l.off:]
+	quote := s[0]
+	var b []byte
+	for n := 1; n < len(s); {
+		c := s[n]
+		switch {
+		case c == quote:
+			return string(b), n + 1, nil
+		case c == '\n':
+			return "", 0, l.errorf(l.pos, "unterminated string literal")
+		case c != '\\':
+			b = append(b, c)
+			n++
+			continue
+		}
+		n++
+		if n >= len(s) {
+			break
+		}
+		c = s[n]
+		n++
+		switch c {
+		case 'a':
+			b = append(b, '\a')
+		case 'b':
+			b = append(b, '\b')
+		case 'f':
+			b = append(b, '\f')
+		case 'n':
+			b = append(b, '\n')
+		case 'r':
+			b = append(b, '\r')
+		case 't':
+			b = append(b, '\t')
+		case 'v':
+			b = append(b, '\v')
+		case '\\', '\'', '"', '?':
+			b = append(b, c)
+		case 'x', 'X':
+			m := n
+			for m < len(s) && m < n+2 && isHexDigit(s[m]) {
+				m++
+			}
+			if m == n {
+				return "", 0, l.errorf(l.pos, "invalid escape sequence in string literal")
+			}
+			v, _ := strconv.ParseUint(s[n:m], 16, 8)
+			b, n = append(b, byte(v)), m
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			m := n
+			for m < len(s) && m < n+2 && s[m] >= '0' && s[m] <= '7' {
+				m++
+			}
+			v, _ := strconv.ParseUint(s[n-1:m], 8, 16)
+			if v > 0xff {
+				return "", 0, l.errorf(l.pos, "octal escape out of range in string literal")
+			}
+			b, n = append(b, byte(v)), m
+		case 'u', 'U':
+			size := 4
+			if c == 'U' {
+				size = 8
+			}
+			if n+size > len(s) {
+				return "", 0, l.errorf(l.pos, "invalid escape sequence in string literal")
+			}
+			v, err := strconv.ParseUint(s[n:n+size], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(v)) {
+				return "", 0, l.errorf(l.pos, "invalid escape sequence in string literal")
+			}
+			b, n = append(b, string(rune(v))...), n+size
+		default:
+			return "", 0, l.errorf(l.pos, "invalid escape sequence in string literal")
+		}
+	}
+	return "", 0, l.errorf(l.pos, "unterminated string literal")
+}
+
+func (l *lexer) advance(n int) {
+	for _, c := range []byte(l.src[l.off : l.off+n]) {
+		if c == '\n' {
+			l.pos.line++
+			l.pos.col = 0
+		} else {
+			l.pos.col++
+		}
+	}
+	l.off += n
+}
+
+func (l *lexer) errorf(pos position, f string, x ...interface{}) error {
+	return errors.New("%v: "+f, append([]interface{}{l.position(pos)}, x...)...)
+}
+
+// position formats pos in the form "file:line:column".
+func (l *lexer) position(pos position) string {
+	return fmt.Sprintf("%v:%d:%d", l.file, pos.line+1, pos.col+1)
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
@@ -0,0 +1,250 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protoparse
+
+import (
+	"math"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/internal/encoding/defval"
+	"google.golang.org/protobuf/internal/errors"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// int returns the constant as an integer in the range [min, max].
+func (c constant) int(min, max int64) (int64, bool) {
+	if c.kind != tokenInt {
+		return 0, false
+	}
+	u, err := strconv.ParseUint(c.text, 0, 64)
+	if err != nil {
+		return 0, false
+	}
+	if c.neg {
+		if u > uint64(-min) {
+			return 0, false
+		}
+		return -int64(u), true
+	}
+	if u > uint64(max) {
+		return 0, false
+	}
+	return int64(u), true
+}
+
+// uint returns the constant as an unsigned integer no greater than max.
+func (c constant) uint(max uint64) (uint64, bool) {
+	if c.kind != tokenInt || c.neg {
+		return 0, false
+	}
+	u, err := strconv.ParseUint(c.text, 0, 64)
+	if err != nil || u > max {
+		return 0, false
+	}
+	return u, true
+}
+
+// float returns the constant as a floating-point number.
+func (c constant) float() (float64, bool) {
+	var f float64
+	switch c.kind {
+	case tokenInt:
+		u, err := strconv.ParseUint(c.text, 0, 64)
+		if err != nil {
+			return 0, false
+		}
+		f = float64(u)
+	case tokenFloat:
+		var err error
+		if f, err = strconv.ParseFloat(c.text, 64); err != nil && f == 0 {
+			return 0, false
+		}
+	case tokenIdent:
+		switch c.text {
+		case "inf", "infinity":
+			f = math.Inf(1)
+		case "nan":
+			f = math.NaN()
+		default:
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	if c.neg {
+		f = -f
+	}
+	return f, true
+}
+
+// scalarValue converts the constant to a value of a scalar kind.
+func scalarValue(k protoreflect.Kind, c constant) (protoreflect.Value, error) {
+	switch k {
+	case protoreflect.BoolKind:
+		if c.kind == tokenIdent && !c.neg {
+			switch c.text {
+			case "true":
+				return protoreflect.ValueOfBool(true), nil
+			case "false":
+				return protoreflect.ValueOfBool(false), nil
+			}
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if v, ok := c.int(math.MinInt32, math.MaxInt32); ok {
+			return protoreflect.ValueOfInt32(int32(v)), nil
+		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if v, ok := c.int(math.MinInt64, math.MaxInt64); ok {
+			return protoreflect.ValueOfInt64(v), nil
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if v, ok := c.uint(math.MaxUint32); ok {
+			return protoreflect.ValueOfUint32(uint32(v)), nil
+		}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if v, ok := c.uint(math.MaxUint64); ok {
+			return protoreflect.ValueOfUint64(v), nil
+		}
+	case protoreflect.FloatKind:
+		if v, ok := c.float(); ok {
+			return protoreflect.ValueOfFloat32(float32(v)), nil
+		}
+	case protoreflect.DoubleKind:
+		if v, ok := c.float(); ok {
+			return protoreflect.ValueOfFloat64(v), nil
+		}
+	case protoreflect.StringKind:
+		if c.kind == tokenString {
+			return protoreflect.ValueOfString(c.str), nil
+		}
+	case protoreflect.BytesKind:
+		if c.kind == tokenString {
+			return protoreflect.ValueOfBytes([]byte(c.str)), nil
+		}
+	}
+	return protoreflect.Value{}, errors.New("invalid value for %v: %v", k, c)
+}
+
+func (c constant) String() string {
+	switch c.kind {
+	case tokenString:
+		return strconv.Quote(c.str)
+	case tokenSymbol:
+		return "{" + c.text + "}"
+	}
+	if c.neg {
+		return "-" + c.text
+	}
+	return c.text
+}
+
+// defaultValue returns the default_value of the field f given as c.
+// The default of an enum field is the name of the value, which is checked
+// when the field is resolved.
+func defaultValue(f *descriptorpb.FieldDescriptorProto, c constant) (string, error) {
+	if f.Type == nil || f.GetType() == descriptorpb.FieldDescriptorProto_TYPE_ENUM {
+		if c.kind != tokenIdent || c.neg {
+			return "", errors.New("invalid default value for an enum field: %v", c)
+		}
+		return c.text, nil
+	}
+	k := protoreflect.Kind(f.GetType())
+	switch k {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return "", errors.New("messages cannot have default values")
+	case protoreflect.StringKind:
+		if c.kind != tokenString {
+			break
+		}
+		return c.str, nil
+	}
+	v, err := scalarValue(k, c)
+	if err != nil {
+		return "", err
+	}
+	return defval.Marshal(v, nil, k, defval.Descriptor)
+}
+
+// setOption interprets the option o, resolving extension names with
+// findExtension. It returns the field of the options message that was set.
+func setOption(o *option, findExtension func(o *option, name string) (protoreflect.ExtensionType, error)) (protoreflect.FieldDescriptor, error) {
+	m := o.msg()
+	var first protoreflect.FieldDescriptor
+	for i, n := range o.name {
+		var fd protoreflect.FieldDescriptor
+		if n.ext {
+			if findExtension == nil {
+				return nil, errors.New("option %v cannot be interpreted yet", o)
+			}
+			xt, err := findExtension(o, n.name)
+			if err != nil {
+				return nil, err
+			}
+			fd = xt.TypeDescriptor()
+			if fd.ContainingMessage().FullName() != m.Descriptor().FullName() {
+				return nil, errors.New("option %v: %v extends %v, not %v", o, fd.FullName(), fd.ContainingMessage().FullName(), m.Descriptor().FullName())
+			}
+		} else {
+			fd = m.Descriptor().Fields().ByName(protoreflect.Name(n.name))
+			if fd == nil {
+				return nil, errors.New("option %v: unknown field %q of %v", o, n.name, m.Descriptor().FullName())
+			}
+		}
+		if first == nil {
+			first = fd
+		}
+		if i < len(o.name)-1 {
+			if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+				return nil, errors.New("option %v: %v is not a singular message field", o, fd.FullName())
+			}
+			m = m.Mutable(fd).Message()
+			continue
+		}
+		if fd.IsMap() {
+			return nil, errors.New("option %v: map fields are not supported", o)
+		}
+		if !fd.IsList() && m.Has(fd) {
+			return nil, errors.New("option %v was already set", o)
+		}
+		var v protoreflect.Value
+		switch fd.Kind() {
+		case protoreflect.MessageKind, protoreflect.GroupKind:
+			if o.value.kind != tokenSymbol {
+				return nil, errors.New("option %v: expected an aggregate value, found %v", o, o.value)
+			}
+			if fd.IsList() {
+				v = m.Mutable(fd).List().NewElement()
+			} else {
+				v = m.NewField(fd)
+			}
+			if err := prototext.Unmarshal([]byte(o.value.text), v.Message().Interface()); err != nil {
+				return nil, errors.Wrap(err, "option %v", o)
+			}
+		case protoreflect.EnumKind:
+			var ev protoreflect.EnumValueDescriptor
+			if o.value.kind == tokenIdent && !o.value.neg {
+				ev = fd.Enum().Values().ByName(protoreflect.Name(o.value.text))
+			}
+			if ev == nil {
+				return nil, errors.New("option %v: invalid value for enum %v: %v", o, fd.Enum().FullName(), o.value)
+			}
+			v = protoreflect.ValueOfEnum(ev.Number())
+		default:
+			var err error
+			if v, err = scalarValue(fd.Kind(), o.value); err != nil {
+				return nil, errors.Wrap(err, "option %v", o)
+			}
+		}
+		if fd.IsList() {
+			m.Mutable(fd).List().Append(v)
+		} else {
+			m.Set(fd, v)
+		}
+	}
+	return first, nil
+}
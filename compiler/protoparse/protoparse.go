@@ -0,0 +1,297 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package protoparse compiles .proto source files into
+// google.protobuf.FileDescriptorProto messages without invoking protoc.
+//
+// The result is equivalent to the descriptors protoc produces: type names
+// are fully qualified, the type and JSON name of every field are populated,
+// and options, including custom options, are interpreted.
+package protoparse
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/internal/errors"
+	"google.golang.org/protobuf/internal/genid"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Opener opens .proto source files by the path used to import them.
+type Opener interface {
+	Open(path string) (io.ReadCloser, error)
+}
+
+// OpenerFunc is an Opener implemented as a function.
+type OpenerFunc func(path string) (io.ReadCloser, error)
+
+// Open calls f(path).
+func (f OpenerFunc) Open(path string) (io.ReadCloser, error) {
+	return f(path)
+}
+
+// ImportPaths returns an Opener that searches for source files in the
+// given directories in order, like the -I flag of protoc.
+func ImportPaths(dirs ...string) Opener {
+	return OpenerFunc(func(path string) (io.ReadCloser, error) {
+		var firstErr error
+		for _, dir := range dirs {
+			f, err := os.Open(filepath.Join(dir, filepath.FromSlash(path)))
+			if err == nil {
+				return f, nil
+			}
+			if firstErr == nil || !os.IsNotExist(err) {
+				firstErr = err
+			}
+		}
+		if firstErr == nil {
+			firstErr = &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+		}
+		return nil, firstErr
+	})
+}
+
+// Parser compiles .proto source files.
+type Parser struct {
+	// Opener opens the source of the files to compile and the files
+	// they import.
+	Opener Opener
+
+	// Files resolves the imports that Opener cannot open, such as
+	// "google/protobuf/descriptor.proto". If nil, it uses
+	// protoregistry.GlobalFiles.
+	Files *protoregistry.Files
+
+	// IncludeSourceCodeInfo configures Parse to populate the
+	// source_code_info field of each file with the location and
+	// comments of each declaration in it.
+	IncludeSourceCodeInfo bool
+}
+
+// Parse compiles the source files with the given import paths, together
+// with all the files they import, and returns the descriptors of the
+// named files in the same order.
+//
+// Errors in a source file are reported along with their position
+// in the form "file:line:column: message".
+func (p Parser) Parse(paths ...string) ([]*descriptorpb.FileDescriptorProto, error) {
+	c := &compiler{
+		Parser:   p,
+		files:    &protoregistry.Files{},
+		compiled: map[string]*descriptorpb.FileDescriptorProto{},
+		pending:  map[string]bool{},
+	}
+	if c.Files == nil {
+		c.Files = protoregistry.GlobalFiles
+	}
+	var fds []*descriptorpb.FileDescriptorProto
+	for _, path := range paths {
+		if err := c.compile(path, ""); err != nil {
+			return nil, err
+		}
+		fd, ok := c.compiled[path]
+		if !ok {
+			return nil, errors.New("%v: not a source file", path)
+		}
+		fds = append(fds, fd)
+	}
+	return fds, nil
+}
+
+type compiler struct {
+	Parser
+	files    *protoregistry.Files // files compiled so far
+	compiled map[string]*descriptorpb.FileDescriptorProto
+	pending  map[string]bool // files being compiled, to detect import cycles
+	stack    []string
+}
+
+// compile compiles the file at path and the files it imports. If the file
+// is imported, from is the position of the import statement.
+func (c *compiler) compile(path, from string) error {
+	if c.pending[path] {
+		return errors.New("%vimport cycle: %v -> %v", from, strings.Join(c.stack, " -> "), path)
+	}
+	if _, err := c.files.FindFileByPath(path); err == nil {
+		return nil
+	}
+
+	// Open the source, or else use the file from the registry.
+	var src []byte
+	var err error = protoregistry.NotFound
+	if c.Opener != nil {
+		var r io.ReadCloser
+		if r, err = c.Opener.Open(path); err == nil {
+			src, err = ioutil.ReadAll(r)
+			r.Close()
+			if err != nil {
+				return errors.Wrap(err, "%v", path)
+			}
+		}
+	}
+	if err != nil {
+		if fd, ferr := c.Files.FindFileByPath(path); ferr == nil {
+			return c.register(fd)
+		}
+		return errors.Wrap(err, "%vcannot open %v", from, path)
+	}
+
+	p, err := parse(path, string(src))
+	if err != nil {
+		return err
+	}
+	fd := p.fd
+	c.pending[path] = true
+	c.stack = append(c.stack, path)
+	for i, dep := range fd.Dependency {
+		pos := p.positions[pathKey([]int32{int32(genid.FileDescriptorProto_Dependency_field_number), int32(i)})]
+		if err := c.compile(dep, p.lex.position(pos)+": "); err != nil {
+			return err
+		}
+	}
+	c.stack = c.stack[:len(c.stack)-1]
+	delete(c.pending, path)
+
+	f, err := protodesc.FileOptions{ReportAllErrors: true}.New(fd, c.files)
+	if err != nil {
+		return c.positionError(p, err)
+	}
+	if err := c.files.RegisterFile(f); err != nil {
+		return errors.Wrap(err, "%v", path)
+	}
+	resolveMessages(fd.MessageType, f.Messages())
+	resolveFields(fd.Extension, f.Extensions().Get)
+	for i, sd := range fd.Service {
+		for j, md := range sd.Method {
+			m := f.Services().Get(i).Methods().Get(j)
+			md.InputType = proto.String("." + string(m.Input().FullName()))
+			md.OutputType = proto.String("." + string(m.Output().FullName()))
+		}
+	}
+
+	for _, o := range p.options {
+		if _, err := setOption(o, c.findExtension); err != nil {
+			return p.lex.errorf(o.pos, "%v", err)
+		}
+	}
+	if c.IncludeSourceCodeInfo {
+		end := p.cur().end
+		file := &descriptorpb.SourceCodeInfo_Location{Path: []int32{}, Span: []int32{0, 0, int32(end.line), int32(end.col)}}
+		fd.SourceCodeInfo = &descriptorpb.SourceCodeInfo{Location: append([]*descriptorpb.SourceCodeInfo_Location{file}, p.locs...)}
+	}
+	c.compiled[path] = fd
+	return nil
+}
+
+// register adds a file that is not compiled from source, along with the
+// files it imports, to the files compiled so far.
+func (c *compiler) register(fd protoreflect.FileDescriptor) error {
+	if _, err := c.files.FindFileByPath(fd.Path()); err == nil {
+		return nil
+	}
+	for i := 0; i < fd.Imports().Len(); i++ {
+		if err := c.register(fd.Imports().Get(i).FileDescriptor); err != nil {
+			return err
+		}
+	}
+	return c.files.RegisterFile(fd)
+}
+
+// positionError annotates the problems reported by protodesc with the
+// position of the declaration that has each of them.
+func (c *compiler) positionError(p *parser, err error) error {
+	errs, ok := err.(protodesc.ValidationErrors)
+	if !ok {
+		return errors.Wrap(err, "%v", p.fd.GetName())
+	}
+	// Report the problems in source order.
+	type problem struct {
+		pos position
+		err error
+	}
+	var problems []problem
+	for _, e := range errs {
+		var pos position
+		for n := len(e.Path); n >= 0; n-- {
+			if q, ok := p.positions[pathKey(e.Path[:n])]; ok {
+				pos = q
+				break
+			}
+		}
+		problems = append(problems, problem{pos, e.Err})
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i].pos, problems[j].pos
+		return a.line < b.line || (a.line == b.line && a.col < b.col)
+	})
+	e := problems[0]
+	if n := len(problems) - 1; n > 0 {
+		return p.lex.errorf(e.pos, "%v (and %d other errors)", e.err, n)
+	}
+	return p.lex.errorf(e.pos, "%v", e.err)
+}
+
+// findExtension resolves the name of an extension used in the option o
+// relative to the scope of the option.
+func (c *compiler) findExtension(o *option, name string) (protoreflect.ExtensionType, error) {
+	scope := o.scope
+	if strings.HasPrefix(name, ".") {
+		scope, name = "", name[1:]
+	}
+	for {
+		full := protoreflect.FullName(name)
+		if scope != "" {
+			full = scope + "." + full
+		}
+		if d, err := c.files.FindDescriptorByName(full); err == nil {
+			if xd, ok := d.(protoreflect.ExtensionDescriptor); ok {
+				return dynamicpb.NewExtensionType(xd), nil
+			}
+			return nil, errors.New("option %v: %v is not an extension", o, full)
+		}
+		if scope == "" {
+			return nil, errors.New("option %v: unknown extension %v", o, name)
+		}
+		scope = scope.Parent()
+	}
+}
+
+// resolveMessages replaces the type names in the messages mds as written in
+// the source with those of the resolved messages ms.
+func resolveMessages(mds []*descriptorpb.DescriptorProto, ms protoreflect.MessageDescriptors) {
+	for i, md := range mds {
+		m := ms.Get(i)
+		resolveFields(md.Field, m.Fields().Get)
+		resolveFields(md.Extension, m.Extensions().Get)
+		resolveMessages(md.NestedType, m.Messages())
+	}
+}
+
+func resolveFields(fds []*descriptorpb.FieldDescriptorProto, get func(int) protoreflect.FieldDescriptor) {
+	for i, fd := range fds {
+		f := get(i)
+		fd.Type = descriptorpb.FieldDescriptorProto_Type(f.Kind()).Enum()
+		switch {
+		case f.Message() != nil:
+			fd.TypeName = proto.String("." + string(f.Message().FullName()))
+		case f.Enum() != nil:
+			fd.TypeName = proto.String("." + string(f.Enum().FullName()))
+		}
+		if f.IsExtension() {
+			fd.Extendee = proto.String("." + string(f.ContainingMessage().FullName()))
+		}
+		fd.JsonName = proto.String(f.JSONName())
+	}
+}
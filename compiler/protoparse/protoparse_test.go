@@ -0,0 +1,387 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protoparse_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"google.golang.org/protobuf/compiler/protoparse"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	_ "google.golang.org/protobuf/internal/testprotos/order"
+	_ "google.golang.org/protobuf/internal/testprotos/required"
+	_ "google.golang.org/protobuf/internal/testprotos/test3"
+	_ "google.golang.org/protobuf/internal/testprotos/textpb3"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// sources returns an Opener for the given source files.
+func sources(files map[string]string) protoparse.Opener {
+	return protoparse.OpenerFunc(func(path string) (io.ReadCloser, error) {
+		src, ok := files[path]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return ioutil.NopCloser(strings.NewReader(src)), nil
+	})
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string // FileDescriptorProto of "test.proto" in text format
+	}{{
+		name: "proto3",
+		files: map[string]string{
+			"test.proto": `
+				syntax = "proto3";
+				package a.b;
+				import "dep.proto";
+				option go_package = "example.com/a/b";
+
+				message M {
+					int32 i = 1;
+					repeated string s = 2 [json_name = "ss"];
+					optional dep.D d = 3;
+					map<string, N> m = 4;
+					oneof o {
+						bytes x = 5;
+						E e = 6;
+					}
+					message N {}
+					enum E { ZERO = 0; }
+					reserved 10 to 12, 100 to max;
+					reserved "foo";
+				}
+				service S {
+					rpc Call(M) returns (stream .a.b.M.N) {
+						option deprecated = true;
+					}
+				}`,
+			"dep.proto": `
+				syntax = "proto3";
+				package dep;
+				message D {}`,
+		},
+		want: `
+			name: "test.proto"
+			package: "a.b"
+			dependency: "dep.proto"
+			message_type: {
+				name: "M"
+				field: {name:"i" number:1 label:LABEL_OPTIONAL type:TYPE_INT32 json_name:"i"}
+				field: {name:"s" number:2 label:LABEL_REPEATED type:TYPE_STRING json_name:"ss"}
+				field: {name:"d" number:3 label:LABEL_OPTIONAL type:TYPE_MESSAGE type_name:".dep.D" json_name:"d" oneof_index:1 proto3_optional:true}
+				field: {name:"m" number:4 label:LABEL_REPEATED type:TYPE_MESSAGE type_name:".a.b.M.MEntry" json_name:"m"}
+				field: {name:"x" number:5 label:LABEL_OPTIONAL type:TYPE_BYTES json_name:"x" oneof_index:0}
+				field: {name:"e" number:6 label:LABEL_OPTIONAL type:TYPE_ENUM type_name:".a.b.M.E" json_name:"e" oneof_index:0}
+				nested_type: {
+					name: "MEntry"
+					field: {name:"key" number:1 label:LABEL_OPTIONAL type:TYPE_STRING json_name:"key"}
+					field: {name:"value" number:2 label:LABEL_OPTIONAL type:TYPE_MESSAGE type_name:".a.b.M.N" json_name:"value"}
+					options: {map_entry:true}
+				}
+				nested_type: {name: "N"}
+				enum_type: {name:"E" value:{name:"ZERO" number:0}}
+				oneof_decl: {name:"o"}
+				oneof_decl: {name:"_d"}
+				reserved_range: {start:10 end:13}
+				reserved_range: {start:100 end:536870912}
+				reserved_name: "foo"
+			}
+			service: {
+				name: "S"
+				method: {name:"Call" input_type:".a.b.M" output_type:".a.b.M.N" options:{deprecated:true} server_streaming:true}
+			}
+			options: {go_package: "example.com/a/b"}
+			syntax: "proto3"`,
+	}, {
+		name: "proto2",
+		files: map[string]string{
+			"test.proto": `
+				package p;
+				import "google/protobuf/descriptor.proto";
+
+				extend google.protobuf.MessageOptions {
+					optional string label = 50000;
+					optional Inner inner = 50001;
+				}
+				message Inner {
+					optional int32 x = 1;
+					repeated int32 y = 2;
+				}
+				message M {
+					option (label) = "hi";
+					option (inner).x = 5;
+					option (p.inner).y = 1;
+					option (.p.inner).y = 2;
+					required sint64 a = 1 [default = -0x10];
+					optional double b = 2 [default = -inf, deprecated = true];
+					optional bytes c = 3 [default = "\001\x02z"];
+					optional E d = 4 [default = TWO];
+					repeated group G = 5 {
+						optional float f = 1 [default = 1.5];
+					}
+					extensions 100 to 199, 300 to max;
+					enum E { ONE = 1; TWO = 2; }
+				}
+				enum Neg {
+					option allow_alias = true;
+					A = -1;
+					B = -1;
+					reserved -10 to -2;
+				}`,
+		},
+		want: `
+			name: "test.proto"
+			package: "p"
+			dependency: "google/protobuf/descriptor.proto"
+			message_type: {
+				name: "Inner"
+				field: {name:"x" number:1 label:LABEL_OPTIONAL type:TYPE_INT32 json_name:"x"}
+				field: {name:"y" number:2 label:LABEL_REPEATED type:TYPE_INT32 json_name:"y"}
+			}
+			message_type: {
+				name: "M"
+				field: {name:"a" number:1 label:LABEL_REQUIRED type:TYPE_SINT64 json_name:"a" default_value:"-16"}
+				field: {name:"b" number:2 label:LABEL_OPTIONAL type:TYPE_DOUBLE json_name:"b" default_value:"-inf" options:{deprecated:true}}
+				field: {name:"c" number:3 label:LABEL_OPTIONAL type:TYPE_BYTES json_name:"c" default_value:"\\001\\002z"}
+				field: {name:"d" number:4 label:LABEL_OPTIONAL type:TYPE_ENUM type_name:".p.M.E" json_name:"d" default_value:"TWO"}
+				field: {name:"g" number:5 label:LABEL_REPEATED type:TYPE_GROUP type_name:".p.M.G" json_name:"g"}
+				nested_type: {
+					name: "G"
+					field: {name:"f" number:1 label:LABEL_OPTIONAL type:TYPE_FLOAT json_name:"f" default_value:"1.5"}
+				}
+				enum_type: {name:"E" value:{name:"ONE" number:1} value:{name:"TWO" number:2}}
+				extension_range: {start:100 end:200}
+				extension_range: {start:300 end:536870912}
+				options: {
+					[p.label]: "hi"
+					[p.inner]: {x:5 y:[1, 2]}
+				}
+			}
+			enum_type: {
+				name: "Neg"
+				value: {name:"A" number:-1}
+				value: {name:"B" number:-1}
+				options: {allow_alias:true}
+				reserved_range: {start:-10 end:-2}
+			}
+			extension: {name:"label" number:50000 label:LABEL_OPTIONAL type:TYPE_STRING json_name:"label" extendee:".google.protobuf.MessageOptions"}
+			extension: {name:"inner" number:50001 label:LABEL_OPTIONAL type:TYPE_MESSAGE type_name:".p.Inner" json_name:"inner" extendee:".google.protobuf.MessageOptions"}`,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			for path := range tt.files {
+				paths = append(paths, path)
+			}
+			fds, err := protoparse.Parser{Opener: sources(tt.files)}.Parse(paths...)
+			if err != nil {
+				t.Fatalf("Parse() error: %v", err)
+			}
+			var got *descriptorpb.FileDescriptorProto
+			for _, fd := range fds {
+				if fd.GetName() == "test.proto" {
+					got = fd
+				}
+			}
+
+			// Resolve the custom options in the expected result using the
+			// extensions in the parsed files.
+			fds = append(fds, protodesc.ToFileDescriptorProto(descriptorpb.File_google_protobuf_descriptor_proto))
+			files, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: fds})
+			if err != nil {
+				t.Fatalf("NewFiles() error: %v", err)
+			}
+			want := &descriptorpb.FileDescriptorProto{}
+			if err := (prototext.UnmarshalOptions{Resolver: dynamicTypes(t, files)}).Unmarshal([]byte(tt.want), want); err != nil {
+				t.Fatalf("invalid expected result: %v", err)
+			}
+			if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("Parse() mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+// dynamicTypes returns a resolver for the extensions in the files.
+func dynamicTypes(t *testing.T, files *protoregistry.Files) *protoregistry.Types {
+	types := &protoregistry.Types{}
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		for i := 0; i < fd.Extensions().Len(); i++ {
+			if err := types.RegisterExtension(dynamicpb.NewExtensionType(fd.Extensions().Get(i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return true
+	})
+	return types
+}
+
+// TestParseTestProtos compiles the test protos in this repository and checks
+// that the result matches the descriptors generated by protoc.
+func TestParseTestProtos(t *testing.T) {
+	for _, path := range []string{
+		"internal/testprotos/order/order.proto",
+		"internal/testprotos/required/required.proto",
+		"internal/testprotos/test3/test.proto",
+		"internal/testprotos/test3/test_extension.proto",
+		"internal/testprotos/test3/test_import.proto",
+		"internal/testprotos/textpb3/test.proto",
+	} {
+		t.Run(path, func(t *testing.T) {
+			fds, err := protoparse.Parser{Opener: protoparse.ImportPaths("../..")}.Parse(path)
+			if err != nil {
+				t.Fatalf("Parse() error: %v", err)
+			}
+			fd, err := protoregistry.GlobalFiles.FindFileByPath(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := protodesc.ToFileDescriptorProto(fd)
+			if diff := cmp.Diff(want, fds[0], protocmp.Transform()); diff != "" {
+				t.Errorf("Parse() mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{{
+		name:  "syntax error",
+		files: map[string]string{"test.proto": "syntax = \"proto3\";\nmessage M {\n  int32 x = 1\n}"},
+		want:  `test.proto:4:1: expected ";", found "}"`,
+	}, {
+		name:  "unknown syntax",
+		files: map[string]string{"test.proto": `syntax = "proto4";`},
+		want:  `test.proto:1:10: unknown syntax "proto4"`,
+	}, {
+		name:  "missing label",
+		files: map[string]string{"test.proto": "message M {\n  int32 x = 1;\n}"},
+		want:  `test.proto:2:3: expected "required", "optional", or "repeated"`,
+	}, {
+		name:  "unresolved type",
+		files: map[string]string{"test.proto": "syntax = \"proto3\";\nmessage M {\n  Missing x = 1;\n}"},
+		want:  `test.proto:3:3: message field "M.x" cannot resolve type: "*.Missing" not found`,
+	}, {
+		name:  "duplicate field number",
+		files: map[string]string{"test.proto": "syntax = \"proto3\";\nmessage M {\n  int32 x = 1;\n  int32 y = 1;\n}"},
+		want:  `test.proto:2:1: message "M" has conflicting fields: "y" with "x"`,
+	}, {
+		name:  "missing import",
+		files: map[string]string{"test.proto": "syntax = \"proto3\";\nimport \"missing.proto\";"},
+		want:  `test.proto:2:1: cannot open missing.proto`,
+	}, {
+		name: "import cycle",
+		files: map[string]string{
+			"test.proto": `import "a.proto";`,
+			"a.proto":    `import "test.proto";`,
+		},
+		want: `a.proto:1:1: import cycle: test.proto -> a.proto -> test.proto`,
+	}, {
+		name:  "unknown option",
+		files: map[string]string{"test.proto": "option foo = 1;"},
+		want:  `test.proto:1:8: option foo: unknown field "foo" of google.protobuf.FileOptions`,
+	}, {
+		name:  "unknown extension",
+		files: map[string]string{"test.proto": "option (foo) = 1;"},
+		want:  `test.proto:1:8: option (foo): unknown extension foo`,
+	}, {
+		name:  "invalid option value",
+		files: map[string]string{"test.proto": "option java_multiple_files = 1;"},
+		want:  `test.proto:1:8: option java_multiple_files: invalid value for bool: 1`,
+	}, {
+		name:  "invalid escape",
+		files: map[string]string{"test.proto": `option go_package = "\q";`},
+		want:  `test.proto:1:21: invalid escape sequence in string literal`,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := protoparse.Parser{Opener: sources(tt.files)}.Parse("test.proto")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse() error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSourceCodeInfo(t *testing.T) {
+	src := `syntax = "proto3";
+
+// Detached.
+
+// Leading.
+message M {
+  int32 x = 1; // Trailing.
+}
+`
+	fds, err := protoparse.Parser{
+		Opener:                sources(map[string]string{"test.proto": src}),
+		IncludeSourceCodeInfo: true,
+	}.Parse("test.proto")
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	fd, err := protodesc.NewFile(fds[0], nil)
+	if err != nil {
+		t.Fatalf("NewFile() error: %v", err)
+	}
+	md := fd.Messages().Get(0)
+	loc := fd.SourceLocations().ByDescriptor(md)
+	if loc.LeadingComments != " Leading.\n" {
+		t.Errorf("leading comments = %q, want %q", loc.LeadingComments, " Leading.\n")
+	}
+	if want := []string{" Detached.\n"}; !cmp.Equal(loc.LeadingDetachedComments, want) {
+		t.Errorf("leading detached comments = %q, want %q", loc.LeadingDetachedComments, want)
+	}
+	if loc.StartLine != 5 || loc.StartColumn != 0 || loc.EndLine != 7 || loc.EndColumn != 1 {
+		t.Errorf("span = %d:%d-%d:%d, want 5:0-7:1", loc.StartLine, loc.StartColumn, loc.EndLine, loc.EndColumn)
+	}
+	loc = fd.SourceLocations().ByDescriptor(md.Fields().Get(0))
+	if loc.TrailingComments != " Trailing.\n" {
+		t.Errorf("trailing comments = %q, want %q", loc.TrailingComments, " Trailing.\n")
+	}
+}
+
+func TestImportPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "protoparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "a"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "a", "b.proto"), []byte(`syntax = "proto3"; message B {}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	fds, err := protoparse.Parser{Opener: protoparse.ImportPaths(dir+"/missing", dir)}.Parse("a/b.proto")
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if got := fds[0].GetMessageType()[0].GetName(); got != "B" {
+		t.Errorf("message name = %q, want %q", got, "B")
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protojson
+
+import (
+	"sync"
+
+	"google.golang.org/protobuf/internal/encoding/json"
+	"google.golang.org/protobuf/internal/errors"
+	"google.golang.org/protobuf/proto"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/runtime/protoimpl"
+)
+
+// JSONMarshaler is implemented by messages that provide their own JSON
+// representation in place of the one derived from their fields,
+// similar to the JSONPBMarshaler interface of the legacy jsonpb package.
+//
+// The representation is used wherever a message of the type is marshaled,
+// including within a google.protobuf.Any, where it is emitted as the
+// "value" member in the same way as for well-known types.
+type JSONMarshaler interface {
+	// MarshalProtoJSON returns the JSON encoding of the message, which must
+	// be a single JSON value. It must not call Marshal on the message itself.
+	MarshalProtoJSON(MarshalOptions) ([]byte, error)
+}
+
+// JSONUnmarshaler is implemented by messages that parse their own JSON
+// representation, similar to the JSONPBUnmarshaler interface of the legacy
+// jsonpb package. It is the counterpart of JSONMarshaler.
+type JSONUnmarshaler interface {
+	// UnmarshalProtoJSON parses the JSON value b into the message,
+	// which has already been reset.
+	UnmarshalProtoJSON(UnmarshalOptions, []byte) error
+}
+
+// CustomFormatter provides the JSON representation of messages of a
+// particular type, as JSONMarshaler and JSONUnmarshaler do, for message types
+// whose Go implementation cannot be given those methods.
+type CustomFormatter interface {
+	// Marshal returns the JSON encoding of m, which must be a single
+	// JSON value.
+	Marshal(MarshalOptions, proto.Message) ([]byte, error)
+
+	// Unmarshal parses the JSON value b into m, which has already been reset.
+	Unmarshal(UnmarshalOptions, []byte, proto.Message) error
+}
+
+// Formatters is a set of custom formatters keyed by the full name of the
+// message type they format. It is used by MarshalOptions.Formatters and
+// UnmarshalOptions.Formatters to override the representation of message
+// types for a particular set of options; the same set is typically given
+// to both so that the output can be parsed again.
+type Formatters map[pref.FullName]CustomFormatter
+
+var customFormatters struct {
+	sync.RWMutex
+	m map[pref.FullName]CustomFormatter
+}
+
+// RegisterCustomFormatter registers f as the formatter for all messages
+// with the given full name. A registered formatter takes precedence over
+// the JSONMarshaler and JSONUnmarshaler methods of a message and over the
+// built-in representation of the well-known types, but not over a formatter
+// in the Formatters of the options in use.
+//
+// It panics if a formatter is already registered for the name.
+// It is intended to be called from an init function.
+func RegisterCustomFormatter(name pref.FullName, f CustomFormatter) {
+	customFormatters.Lock()
+	defer customFormatters.Unlock()
+	if _, ok := customFormatters.m[name]; ok {
+		panic("protojson: custom formatter for " + string(name) + " is already registered")
+	}
+	if customFormatters.m == nil {
+		customFormatters.m = make(map[pref.FullName]CustomFormatter)
+	}
+	customFormatters.m[name] = f
+}
+
+// lookupCustomFormatter returns the formatter for the given name in fs,
+// or else the one registered by RegisterCustomFormatter, if any.
+func lookupCustomFormatter(fs Formatters, name pref.FullName) CustomFormatter {
+	if f := fs[name]; f != nil {
+		return f
+	}
+	customFormatters.RLock()
+	defer customFormatters.RUnlock()
+	return customFormatters.m[name]
+}
+
+// messageMarshaler returns a marshal function if the message has a custom or
+// well-known type JSON representation. It returns nil otherwise.
+func (e encoder) messageMarshaler(m pref.Message) marshalFunc {
+	if f := lookupCustomFormatter(e.opts.Formatters, m.Descriptor().FullName()); f != nil {
+		return func(e encoder, m pref.Message) error {
+			return e.marshalCustom(m, func(o MarshalOptions) ([]byte, error) {
+				return f.Marshal(o, m.Interface())
+			})
+		}
+	}
+	if jm, ok := legacyUnwrap(m).(JSONMarshaler); ok {
+		return func(e encoder, m pref.Message) error {
+			return e.marshalCustom(m, jm.MarshalProtoJSON)
+		}
+	}
+	return wellKnownTypeMarshaler(m.Descriptor().FullName())
+}
+
+// messageUnmarshaler returns an unmarshal function if the message has a custom
+// or well-known type JSON representation. It returns nil otherwise.
+func (d decoder) messageUnmarshaler(m pref.Message) unmarshalFunc {
+	if f := lookupCustomFormatter(d.opts.Formatters, m.Descriptor().FullName()); f != nil {
+		return func(d decoder, m pref.Message) error {
+			return d.unmarshalCustom(func(o UnmarshalOptions, b []byte) error {
+				return f.Unmarshal(o, b, m.Interface())
+			})
+		}
+	}
+	if ju, ok := legacyUnwrap(m).(JSONUnmarshaler); ok {
+		return func(d decoder, m pref.Message) error {
+			return d.unmarshalCustom(ju.UnmarshalProtoJSON)
+		}
+	}
+	return wellKnownTypeUnmarshaler(m.Descriptor().FullName())
+}
+
+// legacyUnwrap returns the Go value of m, which is the original legacy message
+// for a message that does not implement the protoreflect API itself.
+func legacyUnwrap(m pref.Message) interface{} {
+	return protoimpl.X.ProtoMessageV1Of(m.Interface())
+}
+
+// marshalCustom writes the JSON value returned by marshal, which is
+// re-encoded to validate it and to apply the formatting of e.
+func (e encoder) marshalCustom(m pref.Message, marshal func(MarshalOptions) ([]byte, error)) error {
+	b, err := marshal(e.opts)
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(b)
+	err = copyJSONValue(e.Encoder, d)
+	if err == nil {
+		var tok json.Token
+		if tok, err = d.Read(); err == nil && tok.Kind() != json.EOF {
+			err = errors.New("unexpected token %s", tok.RawString())
+		}
+	}
+	if err != nil {
+		return errors.New("%v: invalid custom JSON: %v", m.Descriptor().FullName(), err)
+	}
+	return nil
+}
+
+// unmarshalCustom reads the next JSON value and passes it to unmarshal.
+func (d decoder) unmarshalCustom(unmarshal func(UnmarshalOptions, []byte) error) error {
+	start, err := d.Peek()
+	if err != nil {
+		return err
+	}
+	e, _ := json.NewEncoder("")
+	if err := copyJSONValue(e, d.Decoder); err != nil {
+		return err
+	}
+	if err := unmarshal(d.opts, e.Bytes()); err != nil {
+		return d.newError(start.Pos(), "%v", err)
+	}
+	return nil
+}
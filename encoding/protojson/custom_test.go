@@ -0,0 +1,233 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protojson_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	pb3 "google.golang.org/protobuf/internal/testprotos/textpb3"
+	"google.golang.org/protobuf/proto"
+	preg "google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/runtime/protoimpl"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// decimal is a legacy message type with its own JSON representation,
+// which is a JSON string rather than an object.
+type decimal struct {
+	Digits string `protobuf:"bytes,1,opt,name=digits"`
+}
+
+func (m *decimal) Reset()         { *m = decimal{} }
+func (m *decimal) String() string { return m.Digits }
+func (*decimal) ProtoMessage()    {}
+
+func (m *decimal) MarshalProtoJSON(protojson.MarshalOptions) ([]byte, error) {
+	return json.Marshal(m.Digits)
+}
+
+func (m *decimal) UnmarshalProtoJSON(_ protojson.UnmarshalOptions, b []byte) error {
+	if err := json.Unmarshal(b, &m.Digits); err != nil {
+		return err
+	}
+	if strings.Trim(m.Digits, "0123456789.") != "" {
+		return errors.New("invalid decimal " + m.Digits)
+	}
+	return nil
+}
+
+type price struct {
+	Amount *decimal   `protobuf:"bytes,1,opt,name=amount"`
+	Fees   []*decimal `protobuf:"bytes,2,rep,name=fees"`
+	Rate   *rate      `protobuf:"bytes,3,opt,name=rate"`
+}
+
+func (m *price) Reset()         { *m = price{} }
+func (m *price) String() string { return "price" }
+func (*price) ProtoMessage()    {}
+
+// rate is a legacy message type whose JSON representation is provided by
+// a registered CustomFormatter.
+type rate struct {
+	Percent int32 `protobuf:"varint,1,opt,name=percent"`
+}
+
+func (m *rate) Reset()         { *m = rate{} }
+func (m *rate) String() string { return "rate" }
+func (*rate) ProtoMessage()    {}
+
+type rateFormatter struct{}
+
+func (rateFormatter) Marshal(_ protojson.MarshalOptions, m proto.Message) ([]byte, error) {
+	r := protoimpl.X.ProtoMessageV1Of(m).(*rate)
+	return json.Marshal(map[string]int32{"pct": r.Percent})
+}
+
+func (rateFormatter) Unmarshal(_ protojson.UnmarshalOptions, b []byte, m proto.Message) error {
+	var v map[string]int32
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	protoimpl.X.ProtoMessageV1Of(m).(*rate).Percent = v["pct"]
+	return nil
+}
+
+func init() {
+	protojson.RegisterCustomFormatter(protoimpl.X.MessageDescriptorOf(&rate{}).FullName(), rateFormatter{})
+}
+
+func TestCustomFormatter(t *testing.T) {
+	m := &price{
+		Amount: &decimal{Digits: "12.50"},
+		Fees:   []*decimal{{Digits: "1"}, {Digits: "0.25"}},
+		Rate:   &rate{Percent: 7},
+	}
+	want := `{"amount":"12.50","fees":["1","0.25"],"rate":{"pct":7}}`
+	b, err := protojson.Marshal(protoimpl.X.ProtoMessageV2Of(m))
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+	if got := string(b); got != want {
+		t.Errorf("Marshal():\ngot:  %s\nwant: %s", got, want)
+	}
+
+	got := &price{}
+	if err := protojson.Unmarshal([]byte(want), protoimpl.X.ProtoMessageV2Of(got)); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+	if !proto.Equal(protoimpl.X.ProtoMessageV2Of(got), protoimpl.X.ProtoMessageV2Of(m)) {
+		t.Errorf("Unmarshal() = %v, want %v", got, m)
+	}
+}
+
+func TestCustomFormatterAny(t *testing.T) {
+	resolver := new(preg.Types)
+	if err := resolver.RegisterMessage(protoimpl.X.MessageTypeOf(&decimal{})); err != nil {
+		t.Fatal(err)
+	}
+	value, err := proto.Marshal(protoimpl.X.ProtoMessageV2Of(&decimal{Digits: "3.14"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	typeURL := "type.googleapis.com/" + string(protoimpl.X.MessageDescriptorOf(&decimal{}).FullName())
+	m := &anypb.Any{TypeUrl: typeURL, Value: value}
+	want := `{"@type":"` + typeURL + `","value":"3.14"}`
+
+	b, err := protojson.MarshalOptions{Resolver: resolver}.Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+	if got := string(b); got != want {
+		t.Errorf("Marshal():\ngot:  %s\nwant: %s", got, want)
+	}
+
+	got := &anypb.Any{}
+	if err := (protojson.UnmarshalOptions{Resolver: resolver}).Unmarshal([]byte(want), got); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+	if !proto.Equal(got, m) {
+		t.Errorf("Unmarshal() = %v, want %v", got, m)
+	}
+}
+
+func TestCustomFormatterErrors(t *testing.T) {
+	err := protojson.Unmarshal([]byte(`{"amount": "1x"}`), protoimpl.X.ProtoMessageV2Of(&price{}))
+	if err == nil || !strings.Contains(err.Error(), "(line 1:12): invalid decimal 1x (path /amount)") {
+		t.Errorf("Unmarshal() error = %v, want invalid decimal error", err)
+	}
+
+	err = protojson.Unmarshal([]byte(`{"amount": 1}`), protoimpl.X.ProtoMessageV2Of(&price{}))
+	if err == nil || !strings.Contains(err.Error(), "(path /amount)") {
+		t.Errorf("Unmarshal() error = %v, want error for /amount", err)
+	}
+}
+
+// nestedFormatter formats pb3.Nested as the JSON string of its s_string field.
+type nestedFormatter struct{}
+
+func (nestedFormatter) Marshal(_ protojson.MarshalOptions, m proto.Message) ([]byte, error) {
+	return json.Marshal(m.(*pb3.Nested).SString + " USD")
+}
+
+func (nestedFormatter) Unmarshal(_ protojson.UnmarshalOptions, b []byte, m proto.Message) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(s, " USD") {
+		return errors.New("missing currency")
+	}
+	m.(*pb3.Nested).SString = strings.TrimSuffix(s, " USD")
+	return nil
+}
+
+func TestFormatters(t *testing.T) {
+	fs := protojson.Formatters{
+		"pb3.Nested": nestedFormatter{},
+		protoimpl.X.MessageDescriptorOf(&rate{}).FullName(): nestedFormatter{},
+	}
+	m := &pb3.Nests{SNested: &pb3.Nested{SString: "12.34"}}
+	want := `{"sNested":"12.34 USD"}`
+
+	b, err := protojson.MarshalOptions{Formatters: fs}.Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+	if got := string(b); got != want {
+		t.Errorf("Marshal():\ngot:  %s\nwant: %s", got, want)
+	}
+	got := &pb3.Nests{}
+	if err := (protojson.UnmarshalOptions{Formatters: fs}).Unmarshal(b, got); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+	if !proto.Equal(got, m) {
+		t.Errorf("Unmarshal() = %v, want %v", got, m)
+	}
+	if err := (protojson.UnmarshalOptions{Formatters: fs}).Unmarshal([]byte(`{"sNested":"12.34"}`), got); err == nil {
+		t.Errorf("Unmarshal() without currency = nil error, want error")
+	}
+
+	// The formatters are not used by other options.
+	b, err = protojson.Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+	if got, want := string(b), `{"sNested":{"sString":"12.34"}}`; got != want {
+		t.Errorf("Marshal() without Formatters:\ngot:  %s\nwant: %s", got, want)
+	}
+
+	// A formatter in the options overrides a registered formatter.
+	fs = protojson.Formatters{
+		protoimpl.X.MessageDescriptorOf(&rate{}).FullName(): percentFormatter{},
+	}
+	b, err = protojson.MarshalOptions{Formatters: fs}.Marshal(protoimpl.X.ProtoMessageV2Of(&price{Rate: &rate{Percent: 7}}))
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+	if got, want := string(b), `{"rate":"7%"}`; got != want {
+		t.Errorf("Marshal() with overriding Formatters:\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+// percentFormatter formats a rate as a JSON string with a percent sign.
+type percentFormatter struct{}
+
+func (percentFormatter) Marshal(_ protojson.MarshalOptions, m proto.Message) ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%d%%", protoimpl.X.ProtoMessageV1Of(m).(*rate).Percent))
+}
+
+func (percentFormatter) Unmarshal(_ protojson.UnmarshalOptions, b []byte, m proto.Message) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	_, err := fmt.Sscanf(s, "%d%%", &protoimpl.X.ProtoMessageV1Of(m).(*rate).Percent)
+	return err
+}
@@ -5,6 +5,7 @@
 package protojson
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"math"
@@ -39,6 +40,60 @@ type UnmarshalOptions struct {
 	// If DiscardUnknown is set, unknown fields are ignored.
 	DiscardUnknown bool
 
+	// If Strict is set, a JSON object member name must not appear more than
+	// once in an object, even where the members are otherwise ignored, such
+	// as unknown fields discarded due to DiscardUnknown or values skipped
+	// within them. Duplicate fields of a message are rejected regardless.
+	// Trailing data after the top-level value and unpaired UTF-16 surrogate
+	// escapes in strings are also always rejected.
+	Strict bool
+
+	// MaxDepth is the maximum nesting depth of JSON objects and arrays in
+	// the input, which bounds the recursion needed to unmarshal it.
+	// If zero, a default of 10000 is used. If negative, it is not limited.
+	MaxDepth int
+
+	// MaxInputSize is the maximum size in bytes of the input.
+	// If zero or negative, it is not limited.
+	MaxInputSize int
+
+	// MaxValues is the maximum number of JSON values in the input, counting
+	// each object, array, and scalar, including those that are skipped.
+	// It bounds the number of fields, list elements, and map entries that
+	// are unmarshaled, and is checked as the input is read, before the
+	// memory for the values is allocated. It defends against input such as
+	// a large array of empty objects, which is small but expands into many
+	// messages. If zero or negative, it is not limited.
+	MaxValues int
+
+	// FieldNameFunc, if non-nil, returns an additional JSON name that is
+	// accepted for a field, such as the name emitted by a marshaler with
+	// MarshalOptions.FieldNameFunc. The name is checked before the
+	// lowerCamelCase and proto field names, which remain accepted.
+	FieldNameFunc func(pref.FieldDescriptor) string
+
+	// If PreserveUnknown is set, unknown fields are stored in the unknown
+	// fields of the message so that Marshal with MarshalOptions.PreserveUnknown
+	// emits them again, allowing JSON to be round-tripped through a message
+	// type that lacks those fields.
+	// Each unknown JSON object member is stored as a length-delimited field
+	// with number 19999, which is within the range of field numbers reserved
+	// for the protobuf implementation. The fields are retained by the binary
+	// format like any other unknown field.
+	// It takes precedence over DiscardUnknown.
+	// It has no effect on unknown fields of well-known types, which are
+	// always rejected.
+	PreserveUnknown bool
+
+	// UnknownEnums specifies how enum value names that are not defined
+	// by the enum are unmarshaled. Unknown enum numbers are always accepted.
+	UnknownEnums UnknownEnumHandling
+
+	// UnknownEnumHandler, if non-nil, is called with the field and the name
+	// of each unknown enum value that is tolerated due to UnknownEnums,
+	// for example to collect warnings about them.
+	UnknownEnumHandler func(fd pref.FieldDescriptor, name string)
+
 	// Resolver is used for looking up types when unmarshaling
 	// google.protobuf.Any messages or extension fields.
 	// If nil, this defaults to using protoregistry.GlobalTypes.
@@ -46,8 +101,49 @@ type UnmarshalOptions struct {
 		protoregistry.MessageTypeResolver
 		protoregistry.ExtensionTypeResolver
 	}
+
+	// Fetcher, if non-nil, is used for looking up the types of
+	// google.protobuf.Any messages that are not found by the Resolver.
+	Fetcher MessageTypeFetcher
+
+	// Formatters, if non-nil, provides the JSON representation of the
+	// message types it contains, overriding any other representation of
+	// those types. See CustomFormatter.
+	Formatters Formatters
+
+	// Int64StructNumbers specifies that JSON integers unmarshaled into a
+	// google.protobuf.Value whose magnitude exceeds 2^53, so that they cannot
+	// be represented exactly by its number_value field, are instead stored
+	// in its struct_value field in a tagged representation: a Struct with a
+	// single "@int64" member, or "@uint64" member for values beyond the range
+	// of int64, whose string_value is the decimal integer. Integers outside
+	// of the ranges of int64 and uint64 are stored in number_value regardless.
+	// MarshalOptions.Int64StructNumbers emits the tagged representation as
+	// a JSON number again.
+	Int64StructNumbers bool
+
+	// WarningHandler, if non-nil, is called with each non-fatal Warning.
+	WarningHandler func(Warning)
+
+	ctx context.Context // set by UnmarshalContext
 }
 
+// UnknownEnumHandling specifies how an unknown enum value name is unmarshaled.
+type UnknownEnumHandling uint8
+
+const (
+	// UnknownEnumReject reports an error for an unknown enum value name.
+	UnknownEnumReject UnknownEnumHandling = iota
+
+	// UnknownEnumZero unmarshals an unknown enum value name as the default
+	// value of the enum, which is its first defined value.
+	UnknownEnumZero
+
+	// UnknownEnumSkip ignores an unknown enum value name, as if the field,
+	// list element, or map entry it is the value of were not present.
+	UnknownEnumSkip
+)
+
 // Unmarshal reads the given []byte and populates the given proto.Message using
 // options in UnmarshalOptions object. It will clear the message first before
 // setting the fields. If it returns an error, the given message may be
@@ -56,6 +152,15 @@ func (o UnmarshalOptions) Unmarshal(b []byte, m proto.Message) error {
 	return o.unmarshal(b, m)
 }
 
+// UnmarshalContext is like Unmarshal, but passes ctx to the Fetcher.
+func (o UnmarshalOptions) UnmarshalContext(ctx context.Context, b []byte, m proto.Message) error {
+	o.ctx = ctx
+	return o.unmarshal(b, m)
+}
+
+// defaultMaxDepth is the maximum nesting depth used when MaxDepth is zero.
+const defaultMaxDepth = 10000
+
 // unmarshal is a centralized function that all unmarshal operations go through.
 // For profiling purposes, avoid changing the name of this function or
 // introducing other code paths for unmarshal that do not go through this.
@@ -66,15 +171,26 @@ func (o UnmarshalOptions) unmarshal(b []byte, m proto.Message) error {
 		o.Resolver = protoregistry.GlobalTypes
 	}
 
+	if o.MaxInputSize > 0 && len(b) > o.MaxInputSize {
+		return wrapPath(errors.New("input size of %d bytes exceeds the maximum of %d", len(b), o.MaxInputSize), "")
+	}
+
 	dec := decoder{json.NewDecoder(b), o}
+	switch {
+	case o.MaxDepth == 0:
+		dec.SetMaxDepth(defaultMaxDepth)
+	case o.MaxDepth > 0:
+		dec.SetMaxDepth(o.MaxDepth)
+	}
+	dec.SetMaxValues(o.MaxValues)
 	if err := dec.unmarshalMessage(m.ProtoReflect(), false); err != nil {
-		return err
+		return wrapPath(err, "")
 	}
 
 	// Check for EOF.
 	tok, err := dec.Read()
 	if err != nil {
-		return err
+		return wrapPath(err, "")
 	}
 	if tok.Kind() != json.EOF {
 		return dec.unexpectedTokenError(tok)
@@ -86,6 +202,60 @@ func (o UnmarshalOptions) unmarshal(b []byte, m proto.Message) error {
 	return proto.CheckInitialized(m)
 }
 
+// UnmarshalError is the error returned by Unmarshal for malformed or
+// invalid input. Errors for missing required fields, which are detected
+// after the input has been parsed, are not of this type.
+type UnmarshalError struct {
+	// Path is a JSON Pointer (RFC 6901) to the innermost value containing
+	// the error, relative to the top-level value, such as
+	// "/config/replicas/3/name". It is empty if the error is not within
+	// any member or element of the top-level value.
+	Path string
+
+	// Line and Column are the 1-based position within the input at which
+	// the error was detected, or zero if it is unknown.
+	Line, Column int
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *UnmarshalError) Error() string {
+	if e.Path == "" {
+		return e.Err.Error()
+	}
+	return errors.New("%v (path %s)", e.Err, e.Path).Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *UnmarshalError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the proto.Error sentinel.
+func (e *UnmarshalError) Is(target error) bool {
+	return target == proto.Error
+}
+
+// wrapPath returns err as an *UnmarshalError whose path is prefixed by the
+// JSON Pointer reference token for the object member name or array index seg.
+// If seg is empty, the path is left unchanged.
+func wrapPath(err error, seg string) error {
+	e, ok := err.(*UnmarshalError)
+	if !ok {
+		e = &UnmarshalError{Err: err}
+		if se, ok := err.(*json.SyntaxError); ok {
+			e.Line, e.Column, e.Err = se.Line, se.Column, se.Err
+		}
+	}
+	if seg != "" {
+		seg = strings.Replace(seg, "~", "~0", -1)
+		seg = strings.Replace(seg, "/", "~1", -1)
+		e.Path = "/" + seg + e.Path
+	}
+	return e
+}
+
 type decoder struct {
 	*json.Decoder
 	opts UnmarshalOptions
@@ -95,7 +265,27 @@ type decoder struct {
 func (d decoder) newError(pos int, f string, x ...interface{}) error {
 	line, column := d.Position(pos)
 	head := fmt.Sprintf("(line %d:%d): ", line, column)
-	return errors.New(head+f, x...)
+	return &UnmarshalError{Line: line, Column: column, Err: errors.New(head+f, x...)}
+}
+
+// nameSet is a set of JSON object member names.
+type nameSet map[string]struct{}
+
+// checkDuplicateName returns an error if Strict is set and the name of
+// the given json.Name token has already been added to the set.
+func (d decoder) checkDuplicateName(seen *nameSet, tok json.Token) error {
+	if !d.opts.Strict {
+		return nil
+	}
+	name := tok.Name()
+	if _, ok := (*seen)[name]; ok {
+		return d.newError(tok.Pos(), "duplicate field %v", tok.RawString())
+	}
+	if *seen == nil {
+		*seen = make(nameSet)
+	}
+	(*seen)[name] = struct{}{}
+	return nil
 }
 
 // unexpectedTokenError returns a syntax error for the given unexpected token.
@@ -107,12 +297,12 @@ func (d decoder) unexpectedTokenError(tok json.Token) error {
 func (d decoder) syntaxError(pos int, f string, x ...interface{}) error {
 	line, column := d.Position(pos)
 	head := fmt.Sprintf("syntax error (line %d:%d): ", line, column)
-	return errors.New(head+f, x...)
+	return &UnmarshalError{Line: line, Column: column, Err: errors.New(head+f, x...)}
 }
 
 // unmarshalMessage unmarshals a message into the given protoreflect.Message.
 func (d decoder) unmarshalMessage(m pref.Message, skipTypeURL bool) error {
-	if unmarshal := wellKnownTypeUnmarshaler(m.Descriptor().FullName()); unmarshal != nil {
+	if unmarshal := d.messageUnmarshaler(m); unmarshal != nil {
 		return unmarshal(d, m)
 	}
 
@@ -140,6 +330,8 @@ func (d decoder) unmarshalFields(m pref.Message, skipTypeURL bool) error {
 
 	var seenNums set.Ints
 	var seenOneofs set.Ints
+	var seenUnknown nameSet
+	var customNames map[string]pref.FieldDescriptor
 	fieldDescs := messageDesc.Fields()
 	for {
 		// Read field name.
@@ -172,17 +364,30 @@ func (d decoder) unmarshalFields(m pref.Message, skipTypeURL bool) error {
 			extName := pref.FullName(name[1 : len(name)-1])
 			extType, err := d.findExtension(extName)
 			if err != nil && err != protoregistry.NotFound {
-				return d.newError(tok.Pos(), "unable to resolve %s: %v", tok.RawString(), err)
+				return wrapPath(d.newError(tok.Pos(), "unable to resolve %s: %v", tok.RawString(), err), name)
 			}
 			if extType != nil {
 				fd = extType.TypeDescriptor()
 				if !messageDesc.ExtensionRanges().Has(fd.Number()) || fd.ContainingMessage().FullName() != messageDesc.FullName() {
-					return d.newError(tok.Pos(), "message %v cannot be extended by %v", messageDesc.FullName(), fd.FullName())
+					return wrapPath(d.newError(tok.Pos(), "message %v cannot be extended by %v", messageDesc.FullName(), fd.FullName()), name)
 				}
 			}
 		} else {
-			// The name can either be the JSON name or the proto field name.
-			fd = fieldDescs.ByJSONName(name)
+			// The name can either be the custom name, the JSON name,
+			// or the proto field name.
+			if d.opts.FieldNameFunc != nil {
+				if customNames == nil {
+					customNames = make(map[string]pref.FieldDescriptor, fieldDescs.Len())
+					for i := 0; i < fieldDescs.Len(); i++ {
+						fd := fieldDescs.Get(i)
+						customNames[d.opts.FieldNameFunc(fd)] = fd
+					}
+				}
+				fd = customNames[name]
+			}
+			if fd == nil {
+				fd = fieldDescs.ByJSONName(name)
+			}
 			if fd == nil {
 				fd = fieldDescs.ByName(pref.Name(name))
 				if fd == nil {
@@ -205,19 +410,29 @@ func (d decoder) unmarshalFields(m pref.Message, skipTypeURL bool) error {
 
 		if fd == nil {
 			// Field is unknown.
+			if err := d.checkDuplicateName(&seenUnknown, tok); err != nil {
+				return wrapPath(err, name)
+			}
+			if d.opts.PreserveUnknown {
+				if err := d.preserveUnknownMember(m, tok); err != nil {
+					return wrapPath(err, name)
+				}
+				continue
+			}
 			if d.opts.DiscardUnknown {
+				d.warn(tok.Pos(), nil, "discarded unknown field %v", tok.RawString())
 				if err := d.skipJSONValue(); err != nil {
-					return err
+					return wrapPath(err, name)
 				}
 				continue
 			}
-			return d.newError(tok.Pos(), "unknown field %v", tok.RawString())
+			return wrapPath(d.newError(tok.Pos(), "unknown field %v", tok.RawString()), name)
 		}
 
 		// Do not allow duplicate fields.
 		num := uint64(fd.Number())
 		if seenNums.Has(num) {
-			return d.newError(tok.Pos(), "duplicate field %v", tok.RawString())
+			return wrapPath(d.newError(tok.Pos(), "duplicate field %v", tok.RawString()), name)
 		}
 		seenNums.Set(num)
 
@@ -232,26 +447,26 @@ func (d decoder) unmarshalFields(m pref.Message, skipTypeURL bool) error {
 		case fd.IsList():
 			list := m.Mutable(fd).List()
 			if err := d.unmarshalList(list, fd); err != nil {
-				return err
+				return wrapPath(err, name)
 			}
 		case fd.IsMap():
 			mmap := m.Mutable(fd).Map()
 			if err := d.unmarshalMap(mmap, fd); err != nil {
-				return err
+				return wrapPath(err, name)
 			}
 		default:
 			// If field is a oneof, check if it has already been set.
 			if od := fd.ContainingOneof(); od != nil {
 				idx := uint64(od.Index())
 				if seenOneofs.Has(idx) {
-					return d.newError(tok.Pos(), "error parsing %s, oneof %v is already set", tok.RawString(), od.FullName())
+					return wrapPath(d.newError(tok.Pos(), "error parsing %s, oneof %v is already set", tok.RawString(), od.FullName()), name)
 				}
 				seenOneofs.Set(idx)
 			}
 
 			// Required or optional fields.
 			if err := d.unmarshalSingular(m, fd); err != nil {
-				return err
+				return wrapPath(err, name)
 			}
 		}
 	}
@@ -289,6 +504,9 @@ func (d decoder) unmarshalSingular(m pref.Message, fd pref.FieldDescriptor) erro
 		val, err = d.unmarshalScalar(fd)
 	}
 
+	if err == errSkipValue {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -296,6 +514,10 @@ func (d decoder) unmarshalSingular(m pref.Message, fd pref.FieldDescriptor) erro
 	return nil
 }
 
+// errSkipValue is returned by unmarshalScalar for a value that is ignored
+// due to UnmarshalOptions.UnknownEnums. It is never returned to the user.
+var errSkipValue = errors.New("skipped value")
+
 // unmarshalScalar unmarshals to a scalar/enum protoreflect.Value specified by
 // the given FieldDescriptor.
 func (d decoder) unmarshalScalar(fd pref.FieldDescriptor) (pref.Value, error) {
@@ -358,6 +580,17 @@ func (d decoder) unmarshalScalar(fd pref.FieldDescriptor) (pref.Value, error) {
 		if v, ok := unmarshalEnum(tok, fd); ok {
 			return v, nil
 		}
+		if tok.Kind() == json.String && d.opts.UnknownEnums != UnknownEnumReject {
+			if d.opts.UnknownEnumHandler != nil {
+				d.opts.UnknownEnumHandler(fd, tok.ParsedString())
+			}
+			if d.opts.UnknownEnums == UnknownEnumSkip {
+				d.warn(tok.Pos(), fd, "skipped unknown %v value %v", fd.Enum().FullName(), tok.RawString())
+				return pref.Value{}, errSkipValue
+			}
+			d.warn(tok.Pos(), fd, "replaced unknown %v value %v with the default", fd.Enum().FullName(), tok.RawString())
+			return pref.ValueOfEnum(fd.Enum().Values().Get(0).Number()), nil
+		}
 
 	default:
 		panic(fmt.Sprintf("unmarshalScalar: invalid scalar kind %v", kind))
@@ -535,10 +768,10 @@ func (d decoder) unmarshalList(list pref.List, fd pref.FieldDescriptor) error {
 
 	switch fd.Kind() {
 	case pref.MessageKind, pref.GroupKind:
-		for {
+		for i := 0; ; i++ {
 			tok, err := d.Peek()
 			if err != nil {
-				return err
+				return wrapPath(err, strconv.Itoa(i))
 			}
 
 			if tok.Kind() == json.ArrayClose {
@@ -548,15 +781,15 @@ func (d decoder) unmarshalList(list pref.List, fd pref.FieldDescriptor) error {
 
 			val := list.NewElement()
 			if err := d.unmarshalMessage(val.Message(), false); err != nil {
-				return err
+				return wrapPath(err, strconv.Itoa(i))
 			}
 			list.Append(val)
 		}
 	default:
-		for {
+		for i := 0; ; i++ {
 			tok, err := d.Peek()
 			if err != nil {
-				return err
+				return wrapPath(err, strconv.Itoa(i))
 			}
 
 			if tok.Kind() == json.ArrayClose {
@@ -565,8 +798,11 @@ func (d decoder) unmarshalList(list pref.List, fd pref.FieldDescriptor) error {
 			}
 
 			val, err := d.unmarshalScalar(fd)
+			if err == errSkipValue {
+				continue
+			}
 			if err != nil {
-				return err
+				return wrapPath(err, strconv.Itoa(i))
 			}
 			list.Append(val)
 		}
@@ -622,18 +858,21 @@ Loop:
 		// Unmarshal field name.
 		pkey, err := d.unmarshalMapKey(tok, fd.MapKey())
 		if err != nil {
-			return err
+			return wrapPath(err, tok.Name())
 		}
 
 		// Check for duplicate field name.
 		if mmap.Has(pkey) {
-			return d.newError(tok.Pos(), "duplicate map key %v", tok.RawString())
+			return wrapPath(d.newError(tok.Pos(), "duplicate map key %v", tok.RawString()), tok.Name())
 		}
 
 		// Read and unmarshal field value.
 		pval, err := unmarshalMapValue()
+		if err == errSkipValue {
+			continue
+		}
 		if err != nil {
-			return err
+			return wrapPath(err, tok.Name())
 		}
 
 		mmap.Set(pkey, pval)
@@ -5,14 +5,18 @@
 package protojson_test
 
 import (
+	"context"
+	"fmt"
 	"math"
 	"strings"
 	"testing"
 
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/internal/errors"
 	"google.golang.org/protobuf/internal/flags"
 	"google.golang.org/protobuf/proto"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
 	preg "google.golang.org/protobuf/reflect/protoregistry"
 
 	testpb "google.golang.org/protobuf/internal/testprotos/test"
@@ -134,6 +138,19 @@ func TestUnmarshal(t *testing.T) {
 			OptEnum:    pb3.Enum_ZERO.Enum(),
 			OptMessage: &pb3.Nested{},
 		},
+	}, {
+		desc:         "proto3 optional set to null",
+		inputMessage: &pb3.Proto3Optional{},
+		inputText: `{
+  "optBool": null,
+  "optInt32": 1,
+  "optString": null,
+  "optEnum": null,
+  "optMessage": null
+}`,
+		wantMessage: &pb3.Proto3Optional{
+			OptInt32: proto.Int32(1),
+		},
 	}, {
 		desc:         "proto2 optional scalars set to null",
 		inputMessage: &pb2.Scalars{},
@@ -412,6 +429,20 @@ func TestUnmarshal(t *testing.T) {
 		wantMessage: &pb3.Scalars{
 			SBytes: []byte("hello world"),
 		},
+	}, {
+		desc:         "bytes URL-safe",
+		inputMessage: &pb3.Scalars{},
+		inputText:    `{"sBytes": "-_8="}`,
+		wantMessage: &pb3.Scalars{
+			SBytes: []byte{0xfb, 0xff},
+		},
+	}, {
+		desc:         "bytes URL-safe unpadded",
+		inputMessage: &pb3.Scalars{},
+		inputText:    `{"sBytes": "-_8"}`,
+		wantMessage: &pb3.Scalars{
+			SBytes: []byte{0xfb, 0xff},
+		},
 	}, {
 		desc:         "not bytes",
 		inputMessage: &pb3.Scalars{},
@@ -475,6 +506,55 @@ func TestUnmarshal(t *testing.T) {
   "sEnum": "UNNAMED"
 }`,
 		wantErr: `invalid value for enum type: "UNNAMED"`,
+	}, {
+		desc:         "unknown proto3 enum name with UnknownEnumZero",
+		umo:          protojson.UnmarshalOptions{UnknownEnums: protojson.UnknownEnumZero},
+		inputMessage: &pb3.Proto3Optional{},
+		inputText: `{
+  "optEnum": "UNNAMED"
+}`,
+		wantMessage: &pb3.Proto3Optional{OptEnum: pb3.Enum_ZERO.Enum()},
+	}, {
+		desc:         "unknown proto2 enum names with UnknownEnumZero",
+		umo:          protojson.UnmarshalOptions{UnknownEnums: protojson.UnknownEnumZero},
+		inputMessage: &pb2.Enums{},
+		inputText: `{
+  "optEnum": "UNNAMED",
+  "rptEnum": ["TEN", "UNNAMED"]
+}`,
+		wantMessage: &pb2.Enums{
+			OptEnum: pb2.Enum_ONE.Enum(),
+			RptEnum: []pb2.Enum{pb2.Enum_TEN, pb2.Enum_ONE},
+		},
+	}, {
+		desc:         "unknown enum names with UnknownEnumSkip",
+		umo:          protojson.UnmarshalOptions{UnknownEnums: protojson.UnknownEnumSkip},
+		inputMessage: &pb2.Enums{},
+		inputText: `{
+  "optEnum": "UNNAMED",
+  "rptEnum": ["TEN", "UNNAMED", "TWO"]
+}`,
+		wantMessage: &pb2.Enums{
+			RptEnum: []pb2.Enum{pb2.Enum_TEN, pb2.Enum_TWO},
+		},
+	}, {
+		desc:         "unknown enum map value with UnknownEnumSkip",
+		umo:          protojson.UnmarshalOptions{UnknownEnums: protojson.UnknownEnumSkip},
+		inputMessage: &pb3.Maps{},
+		inputText: `{
+  "uint64ToEnum": {"1": "UNNAMED", "2": "TWO"}
+}`,
+		wantMessage: &pb3.Maps{
+			Uint64ToEnum: map[uint64]pb3.Enum{2: pb3.Enum_TWO},
+		},
+	}, {
+		desc:         "enum set to not enum with UnknownEnumSkip",
+		umo:          protojson.UnmarshalOptions{UnknownEnums: protojson.UnknownEnumSkip},
+		inputMessage: &pb3.Enums{},
+		inputText: `{
+  "sEnum": true
+}`,
+		wantErr: `invalid value for enum type: true`,
 	}, {
 		desc:         "enum set to not enum",
 		inputMessage: &pb3.Enums{},
@@ -518,6 +598,32 @@ func TestUnmarshal(t *testing.T) {
 		wantMessage: &pb3.JSONNames{
 			SString: "json_name used",
 		},
+	}, {
+		desc: "FieldNameFunc",
+		umo: protojson.UnmarshalOptions{FieldNameFunc: func(fd pref.FieldDescriptor) string {
+			return strings.ToUpper(string(fd.Name()))
+		}},
+		inputMessage: &pb3.Nests{},
+		inputText: `{
+  "S_NESTED": {"S_STRING": "custom name used", "sNested": {}}
+}`,
+		wantMessage: &pb3.Nests{
+			SNested: &pb3.Nested{
+				SString: "custom name used",
+				SNested: &pb3.Nested{},
+			},
+		},
+	}, {
+		desc: "FieldNameFunc and json_name",
+		umo: protojson.UnmarshalOptions{FieldNameFunc: func(fd pref.FieldDescriptor) string {
+			return strings.ToUpper(string(fd.Name()))
+		}},
+		inputMessage: &pb3.JSONNames{},
+		inputText: `{
+  "S_STRING": "custom name used",
+  "foo_bar": "json_name used"
+}`,
+		wantErr: `(line 3:3): duplicate field "foo_bar"`,
 	}, {
 		desc:         "camelCase name",
 		inputMessage: &pb3.JSONNames{},
@@ -1577,6 +1683,40 @@ func TestUnmarshal(t *testing.T) {
 		wantMessage: &pb2.KnownTypes{
 			OptValue: &structpb.Value{Kind: &structpb.Value_NumberValue{1.02}},
 		},
+	}, {
+		desc:         "Value large integer",
+		inputMessage: &structpb.Value{},
+		inputText:    `9007199254740993`,
+		wantMessage:  &structpb.Value{Kind: &structpb.Value_NumberValue{9007199254740992}},
+	}, {
+		desc:         "Value large integer with Int64StructNumbers",
+		umo:          protojson.UnmarshalOptions{Int64StructNumbers: true},
+		inputMessage: &pb2.KnownTypes{},
+		inputText: `{
+  "optValue": [9007199254740992, -9007199254740993, 18446744073709551615, 1e19, 1e20, 1.5]
+}`,
+		wantMessage: &pb2.KnownTypes{
+			OptValue: &structpb.Value{
+				Kind: &structpb.Value_ListValue{
+					&structpb.ListValue{
+						Values: []*structpb.Value{
+							{Kind: &structpb.Value_NumberValue{9007199254740992}},
+							{Kind: &structpb.Value_StructValue{&structpb.Struct{Fields: map[string]*structpb.Value{
+								"@int64": {Kind: &structpb.Value_StringValue{"-9007199254740993"}},
+							}}}},
+							{Kind: &structpb.Value_StructValue{&structpb.Struct{Fields: map[string]*structpb.Value{
+								"@uint64": {Kind: &structpb.Value_StringValue{"18446744073709551615"}},
+							}}}},
+							{Kind: &structpb.Value_StructValue{&structpb.Struct{Fields: map[string]*structpb.Value{
+								"@uint64": {Kind: &structpb.Value_StringValue{"10000000000000000000"}},
+							}}}},
+							{Kind: &structpb.Value_NumberValue{1e20}},
+							{Kind: &structpb.Value_NumberValue{1.5}},
+						},
+					},
+				},
+			},
+		},
 	}, {
 		desc:         "Value string",
 		inputMessage: &structpb.Value{},
@@ -2416,6 +2556,138 @@ func TestUnmarshal(t *testing.T) {
 		wantMessage: &anypb.Any{
 			TypeUrl: "type.googleapis.com/google.protobuf.Empty",
 		},
+	}, {
+		desc:         "DiscardUnknown: duplicate unknown fields",
+		umo:          protojson.UnmarshalOptions{DiscardUnknown: true},
+		inputMessage: &pb3.Nests{},
+		inputText:    `{"unknown": 1, "unknown": {"a": 1, "a": 2}}`,
+		wantMessage:  &pb3.Nests{},
+	}, {
+		desc:         "Strict",
+		umo:          protojson.UnmarshalOptions{Strict: true, DiscardUnknown: true},
+		inputMessage: &pb3.Nests{},
+		inputText:    `{"sNested": {"sString": "hello"}, "unknown": {"a": [{"b": 1}, {"b": 2}]}}`,
+		wantMessage:  &pb3.Nests{SNested: &pb3.Nested{SString: "hello"}},
+	}, {
+		desc:         "Strict: duplicate unknown fields",
+		umo:          protojson.UnmarshalOptions{Strict: true, DiscardUnknown: true},
+		inputMessage: &pb3.Nests{},
+		inputText:    `{"unknown": 1, "sNested": {}, "unknown": 2}`,
+		wantErr:      `(line 1:31): duplicate field "unknown"`,
+	}, {
+		desc:         "Strict: duplicate escaped unknown fields",
+		umo:          protojson.UnmarshalOptions{Strict: true, DiscardUnknown: true},
+		inputMessage: &pb3.Nests{},
+		inputText:    `{"unknown": 1, "unknow\u006e": 2}`,
+		wantErr:      `duplicate field "unknow\u006e"`,
+	}, {
+		desc:         "Strict: duplicate names within unknown field",
+		umo:          protojson.UnmarshalOptions{Strict: true, DiscardUnknown: true},
+		inputMessage: &pb3.Nests{},
+		inputText:    `{"unknown": [{"a": 1, "a": 2}]}`,
+		wantErr:      `duplicate field "a" (path /unknown)`,
+	}, {
+		desc:         "Strict: duplicate unknown fields with PreserveUnknown",
+		umo:          protojson.UnmarshalOptions{Strict: true, PreserveUnknown: true},
+		inputMessage: &pb3.Nests{},
+		inputText:    `{"unknown": 1, "unknown": 2}`,
+		wantErr:      `duplicate field "unknown"`,
+	}, {
+		desc:         "Strict: duplicate unknown fields in Empty",
+		umo:          protojson.UnmarshalOptions{Strict: true, DiscardUnknown: true},
+		inputMessage: &emptypb.Empty{},
+		inputText:    `{"unknown": 1, "unknown": 2}`,
+		wantErr:      `duplicate field "unknown"`,
+	}, {
+		desc:         "Strict: duplicate unknown fields in Any",
+		umo:          protojson.UnmarshalOptions{Strict: true, DiscardUnknown: true},
+		inputMessage: &anypb.Any{},
+		inputText: `{
+  "@type": "type.googleapis.com/google.protobuf.Empty",
+  "value": {},
+  "unknown": 1,
+  "unknown": 2
+}`,
+		wantErr: `duplicate field "unknown"`,
+	}, {
+		desc:         "Strict: unpaired surrogate",
+		umo:          protojson.UnmarshalOptions{Strict: true},
+		inputMessage: &pb3.Scalars{},
+		inputText:    `{"sString": "\ud800x"}`,
+		wantErr:      `(path /sString)`,
+	}, {
+		desc:         "Strict: trailing data",
+		umo:          protojson.UnmarshalOptions{Strict: true},
+		inputMessage: &pb3.Scalars{},
+		inputText:    `{} {}`,
+		wantErr:      `unexpected token {`,
+	}, {
+		desc:         "MaxDepth",
+		umo:          protojson.UnmarshalOptions{MaxDepth: 3},
+		inputMessage: &pb3.Nests{},
+		inputText:    `{"sNested": {"sNested": {}}}`,
+		wantMessage:  &pb3.Nests{SNested: &pb3.Nested{SNested: &pb3.Nested{}}},
+	}, {
+		desc:         "MaxDepth exceeded",
+		umo:          protojson.UnmarshalOptions{MaxDepth: 3},
+		inputMessage: &pb3.Nests{},
+		inputText:    `{"sNested": {"sNested": {"sNested": {}}}}`,
+		wantErr:      `(line 1:37): exceeded maximum nesting depth of 3 (path /sNested/sNested/sNested)`,
+	}, {
+		desc:         "MaxDepth exceeded by discarded value",
+		umo:          protojson.UnmarshalOptions{MaxDepth: 2, DiscardUnknown: true},
+		inputMessage: &pb3.Nests{},
+		inputText:    `{"unknown": [[]]}`,
+		wantErr:      `exceeded maximum nesting depth of 2 (path /unknown)`,
+	}, {
+		desc:         "MaxDepth default exceeded",
+		inputMessage: &structpb.ListValue{},
+		inputText:    strings.Repeat("[", 10001) + strings.Repeat("]", 10001),
+		wantErr:      `exceeded maximum nesting depth of 10000`,
+	}, {
+		desc:         "MaxDepth unlimited",
+		umo:          protojson.UnmarshalOptions{MaxDepth: -1},
+		inputMessage: &structpb.Value{},
+		inputText:    strings.Repeat(`{"a":`, 10001) + "1" + strings.Repeat("}", 10001),
+		wantMessage: func() proto.Message {
+			v := &structpb.Value{Kind: &structpb.Value_NumberValue{1}}
+			for i := 0; i < 10001; i++ {
+				v = &structpb.Value{Kind: &structpb.Value_StructValue{
+					&structpb.Struct{Fields: map[string]*structpb.Value{"a": v}},
+				}}
+			}
+			return v
+		}(),
+	}, {
+		desc:         "MaxInputSize",
+		umo:          protojson.UnmarshalOptions{MaxInputSize: 17},
+		inputMessage: &pb3.Scalars{},
+		inputText:    `{"sString": "abc"}`,
+		wantErr:      `input size of 18 bytes exceeds the maximum of 17`,
+	}, {
+		desc:         "MaxInputSize not exceeded",
+		umo:          protojson.UnmarshalOptions{MaxInputSize: 18},
+		inputMessage: &pb3.Scalars{},
+		inputText:    `{"sString": "abc"}`,
+		wantMessage:  &pb3.Scalars{SString: "abc"},
+	}, {
+		desc:         "MaxValues",
+		umo:          protojson.UnmarshalOptions{MaxValues: 5},
+		inputMessage: &pb3.Repeats{},
+		inputText:    `{"rptString": ["a", "b", "c"]}`,
+		wantMessage:  &pb3.Repeats{RptString: []string{"a", "b", "c"}},
+	}, {
+		desc:         "MaxValues exceeded",
+		umo:          protojson.UnmarshalOptions{MaxValues: 4},
+		inputMessage: &structpb.ListValue{},
+		inputText:    `[{}, {}, {}, {}]`,
+		wantErr:      `(line 1:14): exceeded maximum of 4 values (path /3)`,
+	}, {
+		desc:         "MaxValues exceeded by skipped value",
+		umo:          protojson.UnmarshalOptions{MaxValues: 2, DiscardUnknown: true},
+		inputMessage: &pb3.Nests{},
+		inputText:    `{"unknown": [1, 2]}`,
+		wantErr:      `exceeded maximum of 2 values`,
 	}, {
 		desc:         "weak fields",
 		inputMessage: &testpb.TestWeak{},
@@ -2458,3 +2730,312 @@ func TestUnmarshal(t *testing.T) {
 		})
 	}
 }
+
+func TestPreserveUnknown(t *testing.T) {
+	const input = `{
+  "sNested": {"sString": "inner", "newNested": [1, -2.5e3, {"a": null, "b": "é"}]},
+  "newString": "hello",
+  "[pb3.unknown_extension]": true
+}`
+	const want = `{"sNested":{"sString":"inner","newNested":[1,-2.5e3,{"a":null,"b":"é"}]},"newString":"hello","[pb3.unknown_extension]":true}`
+
+	if err := protojson.Unmarshal([]byte(input), &pb3.Nests{}); err == nil {
+		t.Fatalf("Unmarshal without PreserveUnknown: got nil error, want error")
+	}
+	m := &pb3.Nests{}
+	umo := protojson.UnmarshalOptions{PreserveUnknown: true, DiscardUnknown: true}
+	if err := umo.Unmarshal([]byte(input), m); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if got := m.GetSNested().GetSString(); got != "inner" {
+		t.Errorf("Unmarshal: sNested.sString = %q, want %q", got, "inner")
+	}
+	mo := protojson.MarshalOptions{PreserveUnknown: true}
+	got, err := mo.Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("Marshal:\ngot:  %s\nwant: %s", got, want)
+	}
+	got, err = protojson.Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal without PreserveUnknown error: %v", err)
+	}
+	if want := `{"sNested":{"sString":"inner"}}`; string(got) != want {
+		t.Errorf("Marshal without PreserveUnknown:\ngot:  %s\nwant: %s", got, want)
+	}
+
+	// The preserved fields survive a round-trip through the binary format.
+	b, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatalf("proto.Marshal error: %v", err)
+	}
+	m2 := &pb3.Nests{}
+	if err := proto.Unmarshal(b, m2); err != nil {
+		t.Fatalf("proto.Unmarshal error: %v", err)
+	}
+	if got, _ := mo.Marshal(m2); string(got) != want {
+		t.Errorf("Marshal after binary round-trip:\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestPreserveUnknownKnownName(t *testing.T) {
+	// A preserved member with the name of a known field, as if the
+	// message had been unmarshaled with an older schema, is not emitted.
+	preserved := func(member string) []byte {
+		b := protowire.AppendTag(nil, 19999, protowire.BytesType)
+		return protowire.AppendBytes(b, []byte(member))
+	}
+	mo := protojson.MarshalOptions{PreserveUnknown: true}
+	m := &pb3.Nested{SString: "known"}
+	m.ProtoReflect().SetUnknown(append(preserved(`{"sString":"old"}`), preserved(`{"extra":1}`)...))
+	got, err := mo.Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	if want := `{"sString":"known","extra":1}`; string(got) != want {
+		t.Errorf("Marshal:\ngot:  %s\nwant: %s", got, want)
+	}
+
+	// So is a member with the name emitted by FieldNameFunc.
+	mo.FieldNameFunc = func(fd pref.FieldDescriptor) string { return "custom_" + string(fd.Name()) }
+	m.ProtoReflect().SetUnknown(append(preserved(`{"custom_s_string":"old"}`), preserved(`{"extra":1}`)...))
+	got, err = mo.Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal with FieldNameFunc error: %v", err)
+	}
+	if want := `{"custom_s_string":"known","extra":1}`; string(got) != want {
+		t.Errorf("Marshal with FieldNameFunc:\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestPreserveUnknownInvalid(t *testing.T) {
+	// Unknown fields which are not valid preserved members are skipped.
+	preserved := func(member string) []byte {
+		b := protowire.AppendTag(nil, 19999, protowire.BytesType)
+		return protowire.AppendBytes(b, []byte(member))
+	}
+	varint := protowire.AppendVarint(protowire.AppendTag(nil, 19999, protowire.VarintType), 1)
+	for _, tt := range []struct {
+		desc    string
+		unknown []byte
+	}{
+		{"malformed", []byte{0x82}},
+		{"truncated", preserved(`{"extra":1}`)[:5]},
+		{"invalid JSON", preserved(`{"bad"`)},
+		{"not an object", preserved(`[1]`)},
+		{"several members", preserved(`{"a":1,"b":2}`)},
+		{"trailing data", preserved(`{"a":1} 2`)},
+		{"not JSON", preserved("\x08\x01")},
+		{"wrong wire type", varint},
+	} {
+		for _, mo := range []protojson.MarshalOptions{{}, {PreserveUnknown: true}} {
+			m := &pb3.Nested{SString: "known"}
+			m.ProtoReflect().SetUnknown(tt.unknown)
+			got, err := mo.Marshal(m)
+			if err != nil {
+				t.Errorf("%s: Marshal with %+v error: %v", tt.desc, mo, err)
+				continue
+			}
+			if want := `{"sString":"known"}`; string(got) != want {
+				t.Errorf("%s: Marshal with %+v:\ngot:  %s\nwant: %s", tt.desc, mo, got, want)
+			}
+		}
+	}
+
+	// Valid members are emitted even if they follow an invalid one.
+	m := &pb3.Nested{}
+	m.ProtoReflect().SetUnknown(append(preserved(`{"bad"`), preserved(`{"extra":1}`)...))
+	got, err := protojson.MarshalOptions{PreserveUnknown: true}.Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	if want := `{"extra":1}`; string(got) != want {
+		t.Errorf("Marshal:\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestUnmarshalErrorPath(t *testing.T) {
+	tests := []struct {
+		desc         string
+		input        string
+		m            proto.Message
+		path         string
+		line, column int
+	}{{
+		desc:   "nested message field",
+		input:  "{\n  \"sNested\": {\"sNested\": {\"sString\": 1}}\n}",
+		m:      &pb3.Nests{},
+		path:   "/sNested/sNested/sString",
+		line:   2,
+		column: 38,
+	}, {
+		desc:   "list element",
+		input:  `{"rptInt32": [1, 2, "three"]}`,
+		m:      &pb3.Repeats{},
+		path:   "/rptInt32/2",
+		line:   1,
+		column: 21,
+	}, {
+		desc:   "map value with escaped key",
+		input:  `{"strToNested": {"a/b~c": {"sString": true}}}`,
+		m:      &pb3.Maps{},
+		path:   "/strToNested/a~1b~0c/sString",
+		line:   1,
+		column: 39,
+	}, {
+		desc:   "unknown field",
+		input:  `{"sNested": {"unknown": 1}}`,
+		m:      &pb3.Nests{},
+		path:   "/sNested/unknown",
+		line:   1,
+		column: 14,
+	}, {
+		desc:   "syntax error",
+		input:  "{\"sNested\": {\"sString\": \"a\",}}",
+		m:      &pb3.Nests{},
+		path:   "/sNested",
+		line:   1,
+		column: 29,
+	}, {
+		desc:   "Any value",
+		input:  `{"@type": "google.protobuf.Int64Value", "value": "x"}`,
+		m:      &anypb.Any{},
+		path:   "/value",
+		line:   1,
+		column: 50,
+	}, {
+		desc:   "top-level",
+		input:  `[]`,
+		m:      &pb3.Nests{},
+		line:   1,
+		column: 1,
+	}}
+
+	for _, tt := range tests {
+		err := protojson.Unmarshal([]byte(tt.input), tt.m)
+		e, ok := err.(*protojson.UnmarshalError)
+		if !ok {
+			t.Errorf("%s: Unmarshal error = %v (%T), want *UnmarshalError", tt.desc, err, err)
+			continue
+		}
+		if e.Path != tt.path || e.Line != tt.line || e.Column != tt.column {
+			t.Errorf("%s: Unmarshal error at %q (line %d:%d), want %q (line %d:%d)", tt.desc, e.Path, e.Line, e.Column, tt.path, tt.line, tt.column)
+		}
+		if tt.path != "" && !strings.Contains(err.Error(), "(path "+tt.path+")") {
+			t.Errorf("%s: Unmarshal error %q does not contain the path", tt.desc, err)
+		}
+		if !e.Is(proto.Error) {
+			t.Errorf("%s: Unmarshal error %v does not match proto.Error", tt.desc, err)
+		}
+	}
+}
+
+func TestUnknownEnumHandler(t *testing.T) {
+	var warnings []string
+	umo := protojson.UnmarshalOptions{
+		UnknownEnums: protojson.UnknownEnumSkip,
+		UnknownEnumHandler: func(fd pref.FieldDescriptor, name string) {
+			warnings = append(warnings, fmt.Sprintf("%v: %v", fd.FullName(), name))
+		},
+	}
+	m := &pb2.Enums{}
+	if err := umo.Unmarshal([]byte(`{"optEnum": "FOO", "rptNestedEnum": ["UNO", "BAR"]}`), m); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	want := []string{"pb2.Enums.opt_enum: FOO", "pb2.Enums.rpt_nested_enum: BAR"}
+	if len(warnings) != len(want) || warnings[0] != want[0] || warnings[1] != want[1] {
+		t.Errorf("UnknownEnumHandler calls = %q, want %q", warnings, want)
+	}
+	if m.OptEnum != nil || len(m.RptNestedEnum) != 1 {
+		t.Errorf("Unmarshal = %v, want only one rpt_nested_enum value", m)
+	}
+
+	warnings = nil
+	if err := (protojson.UnmarshalOptions{UnknownEnumHandler: umo.UnknownEnumHandler}).Unmarshal([]byte(`{"optEnum": "FOO"}`), m); err == nil {
+		t.Errorf("Unmarshal with UnknownEnumReject: got nil error, want error")
+	}
+	if len(warnings) != 0 {
+		t.Errorf("UnknownEnumHandler called with UnknownEnumReject: %q", warnings)
+	}
+}
+
+type ctxKey struct{}
+
+// testFetcher fetches the types in types, recording the type URLs and
+// the context values it was called with.
+type testFetcher struct {
+	types *preg.Types
+	calls []string
+}
+
+func (f *testFetcher) FetchMessageByURL(ctx context.Context, url string) (pref.MessageType, error) {
+	f.calls = append(f.calls, fmt.Sprintf("%v %v", ctx.Value(ctxKey{}), url))
+	return f.types.FindMessageByURL(url)
+}
+
+func TestAnyFetcher(t *testing.T) {
+	types := new(preg.Types)
+	if err := types.RegisterMessage((&pb2.Nested{}).ProtoReflect().Type()); err != nil {
+		t.Fatal(err)
+	}
+	b, err := proto.Marshal(&pb2.Nested{OptString: proto.String("fetched")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &anypb.Any{TypeUrl: "example.com/pb2.Nested", Value: b}
+	const want = `{"@type":"example.com/pb2.Nested","optString":"fetched"}`
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	f := &testFetcher{types: types}
+	mo := protojson.MarshalOptions{Resolver: new(preg.Types), Fetcher: f}
+	got, err := mo.MarshalContext(ctx, m)
+	if err != nil {
+		t.Fatalf("MarshalContext error: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("MarshalContext:\ngot:  %s\nwant: %s", got, want)
+	}
+
+	m2 := &anypb.Any{}
+	umo := protojson.UnmarshalOptions{Resolver: new(preg.Types), Fetcher: f}
+	if err := umo.UnmarshalContext(ctx, got, m2); err != nil {
+		t.Fatalf("UnmarshalContext error: %v", err)
+	}
+	if !proto.Equal(m, m2) {
+		t.Errorf("UnmarshalContext:\ngot:  %v\nwant: %v", m2, m)
+	}
+	if err := umo.Unmarshal(got, m2); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+
+	wantCalls := []string{
+		"value example.com/pb2.Nested",
+		"value example.com/pb2.Nested",
+		"<nil> example.com/pb2.Nested",
+	}
+	if len(f.calls) != len(wantCalls) {
+		t.Fatalf("Fetcher calls = %q, want %q", f.calls, wantCalls)
+	}
+	for i := range f.calls {
+		if f.calls[i] != wantCalls[i] {
+			t.Errorf("Fetcher call %d = %q, want %q", i, f.calls[i], wantCalls[i])
+		}
+	}
+
+	// A type in the Resolver is used without calling the Fetcher.
+	f.calls = nil
+	if _, err := (protojson.MarshalOptions{Resolver: types, Fetcher: f}).Marshal(m); err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	if len(f.calls) != 0 {
+		t.Errorf("Fetcher called for a type in the Resolver: %q", f.calls)
+	}
+
+	// Errors from the Fetcher are reported.
+	f.types = new(preg.Types)
+	if err := umo.Unmarshal(got, m2); err == nil {
+		t.Errorf("Unmarshal with a failing Fetcher: got nil error, want error")
+	}
+}
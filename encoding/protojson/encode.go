@@ -5,9 +5,11 @@
 package protojson
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"sort"
+	"sync"
 
 	"google.golang.org/protobuf/internal/encoding/json"
 	"google.golang.org/protobuf/internal/encoding/messageset"
@@ -18,6 +20,7 @@ import (
 	"google.golang.org/protobuf/proto"
 	pref "google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 const defaultIndent = "  "
@@ -52,6 +55,34 @@ type MarshalOptions struct {
 	// Indent can only be composed of space or tab characters.
 	Indent string
 
+	// Canonical specifies that the output is stable, so that it is
+	// suitable for hashing and for comparison against golden files.
+	// The output then only depends on the message and the other options:
+	// fields are emitted in the order they are declared in the message,
+	// followed by extension fields sorted by full name; map entries are
+	// sorted by key; numbers are formatted like encoding/json; and the
+	// whitespace is fixed, with no space after commas and colons unless
+	// Multiline is set.
+	// Without Canonical, the output is deliberately made unstable.
+	Canonical bool
+
+	// NameSeparator specifies the separator between each JSON object member
+	// name and its value. It must be a colon, optionally surrounded by space
+	// or tab characters. If empty, it is ": " for multiline output and ":"
+	// otherwise.
+	NameSeparator string
+
+	// CompactArrays specifies that, in multiline output, arrays that contain
+	// no objects or arrays are written on a single line, with their elements
+	// separated by ", ".
+	CompactArrays bool
+
+	// SortKeys specifies that the members of every JSON object are emitted
+	// sorted by name in byte order, rather than in field declaration order
+	// followed by extensions. This also applies to map entries, whose keys
+	// are then sorted as strings, and to google.protobuf.Struct values.
+	SortKeys bool
+
 	// AllowPartial allows messages that have missing required fields to marshal
 	// without returning an error. If AllowPartial is false (the default),
 	// Marshal will return error if there are any missing required fields.
@@ -61,9 +92,39 @@ type MarshalOptions struct {
 	// field names.
 	UseProtoNames bool
 
-	// UseEnumNumbers emits enum values as numbers.
+	// FieldNameFunc, if non-nil, returns the JSON name to emit for a field,
+	// taking precedence over UseProtoNames. It is not used for extension
+	// fields, which are always emitted as their full name in brackets.
+	// UnmarshalOptions.FieldNameFunc provides the inverse mapping.
+	FieldNameFunc func(pref.FieldDescriptor) string
+
+	// UseEnumNumbers emits enum values as numbers instead of names.
+	// Enum values without a name are always emitted as numbers, and
+	// google.protobuf.NullValue is always emitted as null.
+	// Unmarshal accepts either form regardless of this option.
 	UseEnumNumbers bool
 
+	// UseBase64URLEncoding emits bytes fields using the URL-safe base64
+	// alphabet of RFC 4648 instead of the standard alphabet.
+	// OmitBase64Padding omits the trailing padding characters.
+	// Unmarshal accepts every combination regardless of these options.
+	UseBase64URLEncoding bool
+	OmitBase64Padding    bool
+
+	// UseInt64Numbers emits 64-bit integer fields as JSON numbers instead of
+	// strings, for consumers that require numeric types. Many JSON parsers,
+	// including those of JavaScript, decode numbers as IEEE 754 doubles and
+	// silently lose precision for values beyond 2^53, which is why the
+	// default is to emit strings. Map keys are always emitted as strings.
+	// Unmarshal accepts either form regardless of this option.
+	UseInt64Numbers bool
+
+	// Int64StructNumbers emits a google.protobuf.Value that holds an integer
+	// in the tagged representation produced by
+	// UnmarshalOptions.Int64StructNumbers as a JSON number, rather than as
+	// a JSON object.
+	Int64StructNumbers bool
+
 	// EmitUnpopulated specifies whether to emit unpopulated fields. It does not
 	// emit unpopulated oneof fields or unpopulated extension fields.
 	// The JSON value emitted for unpopulated fields are as follows:
@@ -80,12 +141,66 @@ type MarshalOptions struct {
 	//  ╚═══════╧════════════════════════════╝
 	EmitUnpopulated bool
 
+	// EmitUnpopulatedFunc, if non-nil, reports whether to emit the given
+	// unpopulated field, in place of EmitUnpopulated. This allows emitting
+	// unpopulated fields selectively, for example only singular scalar fields
+	// or only the fields of particular message types. The fields that are
+	// emitted have the values listed for EmitUnpopulated. It is not called
+	// for oneof fields or extension fields.
+	EmitUnpopulatedFunc func(pref.FieldDescriptor) bool
+
+	// EmitUnpopulatedOptional specifies whether to emit unpopulated proto3
+	// optional fields as JSON null, for consumers that distinguish between an
+	// absent member and a null one. Unmarshal treats null for any field other
+	// than a google.protobuf.Value or NullValue field as an unpopulated field.
+	EmitUnpopulatedOptional bool
+
+	// PreserveUnknown emits the unknown JSON object members stored in the
+	// unknown fields of a message by UnmarshalOptions.PreserveUnknown,
+	// after the known fields and extensions of the message. Other unknown
+	// fields, members which cannot be parsed, and members with the name of
+	// a known field are skipped.
+	PreserveUnknown bool
+
+	// Fields, if it has any paths, restricts the output to the fields
+	// covered by the field mask. Each path is a sequence of proto field names
+	// separated by dots, where every name except the last must refer to
+	// a singular message field. A path that ends at a message field covers
+	// that field and all of its sub-fields. Paths into a well-known type
+	// cover the well-known type field in its entirety.
+	// Marshal reports an error for a path that does not name a field.
+	// Extension fields and preserved unknown fields are not emitted
+	// for messages that are only partially covered by the mask.
+	Fields *fieldmaskpb.FieldMask
+
 	// Resolver is used for looking up types when expanding google.protobuf.Any
 	// messages. If nil, this defaults to using protoregistry.GlobalTypes.
 	Resolver interface {
 		protoregistry.ExtensionTypeResolver
 		protoregistry.MessageTypeResolver
 	}
+
+	// Fetcher, if non-nil, is used for looking up the types of
+	// google.protobuf.Any messages that are not found by the Resolver.
+	Fetcher MessageTypeFetcher
+
+	// Formatters, if non-nil, provides the JSON representation of the
+	// message types it contains, overriding any other representation of
+	// those types. See CustomFormatter.
+	Formatters Formatters
+
+	// WarningHandler, if non-nil, is called with each non-fatal Warning.
+	WarningHandler func(Warning)
+
+	// Concurrency, if greater than one, is the maximum number of goroutines
+	// used to marshal the elements of a repeated message field with at least
+	// 1024 elements, which speeds up marshaling messages whose bulk is such
+	// a field. The output is the same as without it. The Fetcher, the
+	// Formatters, and the WarningHandler may then be called concurrently,
+	// and warnings may be reported out of order.
+	Concurrency int
+
+	ctx context.Context // set by MarshalContext
 }
 
 // Format formats the message as a string.
@@ -102,12 +217,18 @@ func (o MarshalOptions) Format(m proto.Message) string {
 }
 
 // Marshal marshals the given proto.Message in the JSON format using options in
-// MarshalOptions. Do not depend on the output being stable. It may change over
-// time across different versions of the program.
+// MarshalOptions. Do not depend on the output being stable unless Canonical
+// is set. It may change over time across different versions of the program.
 func (o MarshalOptions) Marshal(m proto.Message) ([]byte, error) {
 	return o.marshal(m)
 }
 
+// MarshalContext is like Marshal, but passes ctx to the Fetcher.
+func (o MarshalOptions) MarshalContext(ctx context.Context, m proto.Message) ([]byte, error) {
+	o.ctx = ctx
+	return o.marshal(m)
+}
+
 // marshal is a centralized function that all marshal operations go through.
 // For profiling purposes, avoid changing the name of this function or
 // introducing other code paths for marshal that do not go through this.
@@ -123,6 +244,9 @@ func (o MarshalOptions) marshal(m proto.Message) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := o.setFormat(internalEnc); err != nil {
+		return nil, err
+	}
 
 	// Treat nil message interface as an empty message,
 	// in which case the output in an empty JSON object.
@@ -130,7 +254,11 @@ func (o MarshalOptions) marshal(m proto.Message) ([]byte, error) {
 		return []byte("{}"), nil
 	}
 
-	enc := encoder{internalEnc, o}
+	mask, err := o.newFieldMask(m.ProtoReflect().Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	enc := encoder{internalEnc, o, mask}
 	if err := enc.marshalMessage(m.ProtoReflect()); err != nil {
 		return nil, err
 	}
@@ -140,14 +268,35 @@ func (o MarshalOptions) marshal(m proto.Message) ([]byte, error) {
 	return enc.Bytes(), proto.CheckInitialized(m)
 }
 
+// setFormat configures e according to the formatting options.
+func (o MarshalOptions) setFormat(e *json.Encoder) error {
+	if o.Canonical {
+		e.SetStable()
+	}
+	if o.NameSeparator != "" {
+		if err := e.SetNameSeparator(o.NameSeparator); err != nil {
+			return err
+		}
+	}
+	if o.CompactArrays {
+		e.SetCompactArrays()
+	}
+	if o.SortKeys {
+		e.SetSortNames()
+	}
+	return nil
+}
+
 type encoder struct {
 	*json.Encoder
 	opts MarshalOptions
+	mask fieldMask // fields of the current message to marshal
 }
 
 // marshalMessage marshals the given protoreflect.Message.
 func (e encoder) marshalMessage(m pref.Message) error {
-	if marshal := wellKnownTypeMarshaler(m.Descriptor().FullName()); marshal != nil {
+	if marshal := e.messageMarshaler(m); marshal != nil {
+		e.mask = nil
 		return marshal(e, m)
 	}
 
@@ -175,20 +324,37 @@ func (e encoder) marshalFields(m pref.Message) error {
 			fd = m.WhichOneof(od)
 			i += od.Fields().Len()
 			if fd == nil {
-				continue // unpopulated oneofs are not affected by EmitUnpopulated
+				if !od.IsSynthetic() || !e.opts.EmitUnpopulatedOptional {
+					continue // unpopulated oneofs are not affected by EmitUnpopulated
+				}
+				fd = od.Fields().Get(0)
 			}
 		} else {
 			i++
 		}
 
+		fe := e
+		if e.mask != nil {
+			var ok bool
+			if fe.mask, ok = e.mask[fd.Name()]; !ok {
+				continue
+			}
+		}
+
 		val := m.Get(fd)
 		if !m.Has(fd) {
-			if !e.opts.EmitUnpopulated {
+			// Only proto3 optional fields are unpopulated oneof members here.
+			isProto3Optional := fd.ContainingOneof() != nil
+			emit := e.opts.EmitUnpopulated
+			if e.opts.EmitUnpopulatedFunc != nil && !isProto3Optional {
+				emit = e.opts.EmitUnpopulatedFunc(fd)
+			}
+			if !emit && !isProto3Optional {
 				continue
 			}
 			isProto2Scalar := fd.Syntax() == pref.Proto2 && fd.Default().IsValid()
 			isSingularMessage := fd.Cardinality() != pref.Repeated && fd.Message() != nil
-			if isProto2Scalar || isSingularMessage {
+			if isProto2Scalar || isSingularMessage || isProto3Optional {
 				// Use invalid value to emit null.
 				val = pref.Value{}
 			}
@@ -202,18 +368,33 @@ func (e encoder) marshalFields(m pref.Message) error {
 				name = string(fd.Message().Name())
 			}
 		}
+		if e.opts.FieldNameFunc != nil {
+			name = e.opts.FieldNameFunc(fd)
+		}
 		if err := e.WriteName(name); err != nil {
 			return err
 		}
-		if err := e.marshalValue(val, fd); err != nil {
+		if err := fe.marshalValue(val, fd); err != nil {
 			return err
 		}
 	}
 
+	// Extensions and unknown fields cannot be named by a field mask.
+	if e.mask != nil {
+		return nil
+	}
+
 	// Marshal out extensions.
 	if err := e.marshalExtensions(m); err != nil {
 		return err
 	}
+
+	// Marshal out unknown fields preserved by UnmarshalOptions.PreserveUnknown.
+	if e.opts.PreserveUnknown {
+		if err := e.marshalPreservedUnknown(m); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -252,10 +433,26 @@ func (e encoder) marshalSingular(val pref.Value, fd pref.FieldDescriptor) error
 	case pref.Uint32Kind, pref.Fixed32Kind:
 		e.WriteUint(val.Uint())
 
-	case pref.Int64Kind, pref.Sint64Kind, pref.Uint64Kind,
-		pref.Sfixed64Kind, pref.Fixed64Kind:
-		// 64-bit integers are written out as JSON string.
-		e.WriteString(val.String())
+	case pref.Int64Kind, pref.Sint64Kind, pref.Sfixed64Kind:
+		// 64-bit integers are written out as JSON string by default.
+		if e.opts.UseInt64Numbers {
+			if v := val.Int(); v > maxExactInt || v < -maxExactInt {
+				e.warn(fd, "%v value %d is not exactly representable as a double", fd.FullName(), v)
+			}
+			e.WriteInt(val.Int())
+		} else {
+			e.WriteString(val.String())
+		}
+
+	case pref.Uint64Kind, pref.Fixed64Kind:
+		if e.opts.UseInt64Numbers {
+			if v := val.Uint(); v > maxExactInt {
+				e.warn(fd, "%v value %d is not exactly representable as a double", fd.FullName(), v)
+			}
+			e.WriteUint(val.Uint())
+		} else {
+			e.WriteString(val.String())
+		}
 
 	case pref.FloatKind:
 		// Encoder.WriteFloat handles the special numbers NaN and infinites.
@@ -266,7 +463,14 @@ func (e encoder) marshalSingular(val pref.Value, fd pref.FieldDescriptor) error
 		e.WriteFloat(val.Float(), 64)
 
 	case pref.BytesKind:
-		e.WriteString(base64.StdEncoding.EncodeToString(val.Bytes()))
+		enc := base64.StdEncoding
+		if e.opts.UseBase64URLEncoding {
+			enc = base64.URLEncoding
+		}
+		if e.opts.OmitBase64Padding {
+			enc = enc.WithPadding(base64.NoPadding)
+		}
+		e.WriteString(enc.EncodeToString(val.Bytes()))
 
 	case pref.EnumKind:
 		if fd.Enum().FullName() == genid.NullValue_enum_fullname {
@@ -296,6 +500,9 @@ func (e encoder) marshalList(list pref.List, fd pref.FieldDescriptor) error {
 	e.StartArray()
 	defer e.EndArray()
 
+	if e.opts.Concurrency > 1 && fd.Message() != nil && list.Len() >= minConcurrentListLen {
+		return e.marshalListConcurrently(list, fd)
+	}
 	for i := 0; i < list.Len(); i++ {
 		item := list.Get(i)
 		if err := e.marshalSingular(item, fd); err != nil {
@@ -305,6 +512,51 @@ func (e encoder) marshalList(list pref.List, fd pref.FieldDescriptor) error {
 	return nil
 }
 
+// minConcurrentListLen is the minimum number of elements of a repeated
+// message field for MarshalOptions.Concurrency to apply.
+const minConcurrentListLen = 1024
+
+// marshalListConcurrently marshals the message elements of list in
+// contiguous chunks, one for each of up to e.opts.Concurrency goroutines,
+// and then writes out the results in order.
+func (e encoder) marshalListConcurrently(list pref.List, fd pref.FieldDescriptor) error {
+	n := list.Len()
+	forks := make([]*json.Encoder, n)
+	errs := make([]error, n)
+	size := (n + e.opts.Concurrency - 1) / e.opts.Concurrency
+	var wg sync.WaitGroup
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				fe := e
+				fe.Encoder = e.Fork()
+				fe.opts.Concurrency = 0 // the goroutines are not nested
+				if errs[i] = fe.marshalSingular(list.Get(i), fd); errs[i] != nil {
+					return
+				}
+				forks[i] = fe.Encoder
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	// Report the error of the first element that failed, as if marshaled
+	// sequentially. A chunk stops at its first failed element.
+	for i, f := range forks {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		e.WriteForked(f)
+	}
+	return nil
+}
+
 type mapEntry struct {
 	key   pref.MapKey
 	value pref.Value
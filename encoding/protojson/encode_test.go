@@ -7,6 +7,8 @@ package protojson_test
 import (
 	"bytes"
 	"math"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -15,6 +17,7 @@ import (
 	"google.golang.org/protobuf/internal/detrand"
 	"google.golang.org/protobuf/internal/flags"
 	"google.golang.org/protobuf/proto"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
 	preg "google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/testing/protopack"
 
@@ -52,6 +55,39 @@ func TestMarshal(t *testing.T) {
 		desc:  "proto3 optional not set",
 		input: &pb3.Proto3Optional{},
 		want:  "{}",
+	}, {
+		desc: "EmitUnpopulatedOptional",
+		mo:   protojson.MarshalOptions{EmitUnpopulatedOptional: true},
+		input: &pb3.Proto3Optional{
+			OptInt32: proto.Int32(0),
+		},
+		want: `{
+  "optBool": null,
+  "optInt32": 0,
+  "optInt64": null,
+  "optUint32": null,
+  "optUint64": null,
+  "optFloat": null,
+  "optDouble": null,
+  "optString": null,
+  "optBytes": null,
+  "optEnum": null,
+  "optMessage": null
+}`,
+	}, {
+		desc:  "EmitUnpopulatedOptional does not affect other fields",
+		mo:    protojson.MarshalOptions{EmitUnpopulatedOptional: true},
+		input: &pb3.Nests{},
+		want:  "{}",
+	}, {
+		desc: "EmitUnpopulated without EmitUnpopulatedOptional",
+		mo:   protojson.MarshalOptions{EmitUnpopulated: true},
+		input: &pb3.Proto3Optional{
+			OptInt32: proto.Int32(0),
+		},
+		want: `{
+  "optInt32": 0
+}`,
 	}, {
 		desc: "proto2 optional scalars set to zero values",
 		input: &pb2.Scalars{
@@ -1203,6 +1239,41 @@ func TestMarshal(t *testing.T) {
 		desc:  "Value contains StringValue",
 		input: &structpb.Value{Kind: &structpb.Value_StringValue{"hello"}},
 		want:  `"hello"`,
+	}, {
+		desc: "Value contains tagged integer with Int64StructNumbers",
+		mo:   protojson.MarshalOptions{Int64StructNumbers: true},
+		input: &structpb.ListValue{Values: []*structpb.Value{
+			{Kind: &structpb.Value_StructValue{&structpb.Struct{Fields: map[string]*structpb.Value{
+				"@int64": {Kind: &structpb.Value_StringValue{"-9007199254740993"}},
+			}}}},
+			{Kind: &structpb.Value_StructValue{&structpb.Struct{Fields: map[string]*structpb.Value{
+				"@uint64": {Kind: &structpb.Value_StringValue{"18446744073709551615"}},
+			}}}},
+			{Kind: &structpb.Value_StructValue{&structpb.Struct{Fields: map[string]*structpb.Value{
+				"@int64": {Kind: &structpb.Value_StringValue{"18446744073709551615"}},
+			}}}},
+			{Kind: &structpb.Value_StructValue{&structpb.Struct{Fields: map[string]*structpb.Value{
+				"@int64": {Kind: &structpb.Value_NumberValue{1}},
+			}}}},
+		}},
+		want: `[
+  -9007199254740993,
+  18446744073709551615,
+  {
+    "@int64": "18446744073709551615"
+  },
+  {
+    "@int64": 1
+  }
+]`,
+	}, {
+		desc: "Value contains tagged integer",
+		input: &structpb.Value{Kind: &structpb.Value_StructValue{&structpb.Struct{Fields: map[string]*structpb.Value{
+			"@int64": {Kind: &structpb.Value_StringValue{"-9007199254740993"}},
+		}}}},
+		want: `{
+  "@int64": "-9007199254740993"
+}`,
 	}, {
 		desc:    "Value contains StringValue with invalid UTF8",
 		input:   &structpb.Value{Kind: &structpb.Value_StringValue{"\xff"}},
@@ -2105,6 +2176,141 @@ func TestMarshal(t *testing.T) {
       "optNested": null
     }
   ]
+}`,
+	}, {
+		desc: "EmitUnpopulatedFunc: selected scalars",
+		mo: protojson.MarshalOptions{EmitUnpopulatedFunc: func(fd pref.FieldDescriptor) bool {
+			return fd.Kind() == pref.BoolKind || fd.Kind() == pref.StringKind
+		}},
+		input: &pb3.Scalars{
+			SInt32: 1,
+		},
+		want: `{
+  "sBool": false,
+  "sInt32": 1,
+  "sString": ""
+}`,
+	}, {
+		desc: "EmitUnpopulatedFunc: omit repeated fields",
+		mo: protojson.MarshalOptions{EmitUnpopulatedFunc: func(fd pref.FieldDescriptor) bool {
+			return !fd.IsList() && !fd.IsMap()
+		}},
+		input: &pb3.Repeats{},
+		want:  `{}`,
+	}, {
+		desc: "EmitUnpopulatedFunc: per message type",
+		mo: protojson.MarshalOptions{EmitUnpopulatedFunc: func(fd pref.FieldDescriptor) bool {
+			return fd.ContainingMessage().FullName() == "pb2.Nested"
+		}},
+		input: &pb2.Nests{
+			RptNested: []*pb2.Nested{{}},
+		},
+		want: `{
+  "rptNested": [
+    {
+      "optString": null,
+      "optNested": null
+    }
+  ]
+}`,
+	}, {
+		desc: "EmitUnpopulatedFunc: overrides EmitUnpopulated",
+		mo: protojson.MarshalOptions{
+			EmitUnpopulated:     true,
+			EmitUnpopulatedFunc: func(pref.FieldDescriptor) bool { return false },
+		},
+		input: &pb3.Scalars{},
+		want:  `{}`,
+	}, {
+		desc: "EmitUnpopulatedFunc: oneof fields",
+		mo: protojson.MarshalOptions{
+			EmitUnpopulatedOptional: true,
+			EmitUnpopulatedFunc:     func(pref.FieldDescriptor) bool { return false },
+		},
+		input: &pb3.Proto3Optional{},
+		want: `{
+  "optBool": null,
+  "optInt32": null,
+  "optInt64": null,
+  "optUint32": null,
+  "optUint64": null,
+  "optFloat": null,
+  "optDouble": null,
+  "optString": null,
+  "optBytes": null,
+  "optEnum": null,
+  "optMessage": null
+}`,
+	}, {
+		desc: "UseInt64Numbers",
+		mo:   protojson.MarshalOptions{UseInt64Numbers: true},
+		input: &pb3.Scalars{
+			SInt64:    math.MinInt64,
+			SUint64:   math.MaxUint64,
+			SSint64:   -1,
+			SFixed64:  1 << 53,
+			SSfixed64: math.MaxInt64,
+		},
+		want: `{
+  "sInt64": -9223372036854775808,
+  "sUint64": 18446744073709551615,
+  "sSint64": -1,
+  "sFixed64": 9007199254740992,
+  "sSfixed64": 9223372036854775807
+}`,
+	}, {
+		desc: "UseInt64Numbers in map key",
+		mo:   protojson.MarshalOptions{UseInt64Numbers: true},
+		input: &pb3.Maps{
+			Uint64ToEnum: map[uint64]pb3.Enum{
+				1 << 60: pb3.Enum_ONE,
+			},
+		},
+		want: `{
+  "uint64ToEnum": {
+    "1152921504606846976": "ONE"
+  }
+}`,
+	}, {
+		desc:  "UseInt64Numbers in Int64Value",
+		mo:    protojson.MarshalOptions{UseInt64Numbers: true},
+		input: &wrapperspb.Int64Value{Value: -42},
+		want:  `-42`,
+	}, {
+		desc: "bytes with standard base64",
+		mo:   protojson.MarshalOptions{},
+		input: &pb3.Scalars{
+			SBytes: []byte{0xfb, 0xff},
+		},
+		want: `{
+  "sBytes": "+/8="
+}`,
+	}, {
+		desc: "bytes with unpadded base64",
+		mo:   protojson.MarshalOptions{OmitBase64Padding: true},
+		input: &pb3.Scalars{
+			SBytes: []byte{0xfb, 0xff},
+		},
+		want: `{
+  "sBytes": "+/8"
+}`,
+	}, {
+		desc: "bytes with URL-safe base64",
+		mo:   protojson.MarshalOptions{UseBase64URLEncoding: true},
+		input: &pb3.Scalars{
+			SBytes: []byte{0xfb, 0xff},
+		},
+		want: `{
+  "sBytes": "-_8="
+}`,
+	}, {
+		desc: "bytes with unpadded URL-safe base64",
+		mo:   protojson.MarshalOptions{UseBase64URLEncoding: true, OmitBase64Padding: true},
+		input: &pb3.Scalars{
+			SBytes: []byte{0xfb, 0xff},
+		},
+		want: `{
+  "sBytes": "-_8"
 }`,
 	}, {
 		desc: "UseEnumNumbers in singular field",
@@ -2195,6 +2401,108 @@ func TestMarshal(t *testing.T) {
       ]
     }
   ]
+}`,
+	}, {
+		desc: "Fields",
+		mo: protojson.MarshalOptions{Fields: &fieldmaskpb.FieldMask{
+			Paths: []string{"s_nested.s_string", "s_nested.s_nested.s_nested"},
+		}},
+		input: &pb3.Nests{
+			SNested: &pb3.Nested{
+				SString: "covered",
+				SNested: &pb3.Nested{
+					SString: "not covered",
+					SNested: &pb3.Nested{
+						SString: "covered",
+					},
+				},
+			},
+		},
+		want: `{
+  "sNested": {
+    "sString": "covered",
+    "sNested": {
+      "sNested": {
+        "sString": "covered"
+      }
+    }
+  }
+}`,
+	}, {
+		desc: "Fields with well-known types and EmitUnpopulated",
+		mo: protojson.MarshalOptions{
+			EmitUnpopulated: true,
+			Fields: &fieldmaskpb.FieldMask{
+				Paths: []string{"opt_duration.seconds", "opt_int32", "opt_bool"},
+			},
+		},
+		input: &pb2.KnownTypes{
+			OptBool:      &wrapperspb.BoolValue{Value: true},
+			OptString:    &wrapperspb.StringValue{Value: "not covered"},
+			OptDuration:  &durationpb.Duration{Seconds: 1, Nanos: 500000000},
+			OptTimestamp: &timestamppb.Timestamp{Seconds: 1},
+		},
+		want: `{
+  "optBool": true,
+  "optInt32": null,
+  "optDuration": "1.500s"
+}`,
+	}, {
+		desc: "Fields with extensions",
+		mo: protojson.MarshalOptions{Fields: &fieldmaskpb.FieldMask{
+			Paths: []string{"opt_string"},
+		}},
+		input: func() proto.Message {
+			m := &pb2.Extensions{
+				OptString: proto.String("non-extension field"),
+				OptBool:   proto.Bool(true),
+			}
+			proto.SetExtension(m, pb2.E_OptExtBool, true)
+			return m
+		}(),
+		want: `{
+  "optString": "non-extension field"
+}`,
+	}, {
+		desc: "Fields with empty mask",
+		mo:   protojson.MarshalOptions{Fields: &fieldmaskpb.FieldMask{}},
+		input: &pb3.Nests{
+			SNested: &pb3.Nested{},
+		},
+		want: `{
+  "sNested": {}
+}`,
+	}, {
+		desc: "Fields with unknown field",
+		mo: protojson.MarshalOptions{Fields: &fieldmaskpb.FieldMask{
+			Paths: []string{"s_nested.unknown"},
+		}},
+		input:   &pb3.Nests{},
+		wantErr: true,
+	}, {
+		desc: "Fields with repeated field in path",
+		mo: protojson.MarshalOptions{Fields: &fieldmaskpb.FieldMask{
+			Paths: []string{"rpt_nested.opt_string"},
+		}},
+		input:   &pb2.Nests{},
+		wantErr: true,
+	}, {
+		desc: "FieldNameFunc",
+		mo: protojson.MarshalOptions{
+			UseProtoNames: true,
+			FieldNameFunc: func(fd pref.FieldDescriptor) string {
+				return strings.ToUpper(string(fd.Name()))
+			},
+		},
+		input: &pb3.Nests{
+			SNested: &pb3.Nested{
+				SString: "screaming",
+			},
+		},
+		want: `{
+  "S_NESTED": {
+    "S_STRING": "screaming"
+  }
 }`,
 	}}
 
@@ -2223,3 +2531,129 @@ func TestMarshal(t *testing.T) {
 		})
 	}
 }
+
+func TestMarshalCanonical(t *testing.T) {
+	m := &pb3.Maps{
+		Int32ToStr: map[int32]string{
+			10: "ten",
+			-1: "minus one",
+			2:  "two",
+		},
+		BoolToUint32: map[bool]uint32{
+			true:  1,
+			false: 0,
+		},
+		StrToNested: map[string]*pb3.Nested{
+			"b": {SString: "b"},
+			"a": {SNested: &pb3.Nested{}},
+		},
+	}
+	tests := []struct {
+		mo   protojson.MarshalOptions
+		want string
+	}{{
+		mo:   protojson.MarshalOptions{Canonical: true},
+		want: `{"int32ToStr":{"-1":"minus one","2":"two","10":"ten"},"boolToUint32":{"false":0,"true":1},"strToNested":{"a":{"sNested":{}},"b":{"sString":"b"}}}`,
+	}, {
+		mo: protojson.MarshalOptions{Canonical: true, Indent: "\t"},
+		want: "{\n\t\"int32ToStr\": {\n\t\t\"-1\": \"minus one\",\n\t\t\"2\": \"two\",\n\t\t\"10\": \"ten\"\n\t},\n" +
+			"\t\"boolToUint32\": {\n\t\t\"false\": 0,\n\t\t\"true\": 1\n\t},\n" +
+			"\t\"strToNested\": {\n\t\t\"a\": {\n\t\t\t\"sNested\": {}\n\t\t},\n\t\t\"b\": {\n\t\t\t\"sString\": \"b\"\n\t\t}\n\t}\n}",
+	}}
+	for _, tt := range tests {
+		for i := 0; i < 3; i++ {
+			b, err := tt.mo.Marshal(m)
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("Marshal with %+v:\ngot:  %s\nwant: %s", tt.mo, b, tt.want)
+			}
+		}
+	}
+}
+
+func TestMarshalFormat(t *testing.T) {
+	m := &pb3.Repeats{
+		RptBool:   []bool{true, false},
+		RptString: []string{"a"},
+		RptBytes:  [][]byte{{1}},
+	}
+	tests := []struct {
+		mo   protojson.MarshalOptions
+		want string
+	}{{
+		mo:   protojson.MarshalOptions{Canonical: true, NameSeparator: ": "},
+		want: `{"rptBool": [true,false],"rptString": ["a"],"rptBytes": ["AQ=="]}`,
+	}, {
+		mo:   protojson.MarshalOptions{Canonical: true, SortKeys: true},
+		want: `{"rptBool":[true,false],"rptBytes":["AQ=="],"rptString":["a"]}`,
+	}, {
+		mo:   protojson.MarshalOptions{Canonical: true, Multiline: true, CompactArrays: true, SortKeys: true},
+		want: "{\n  \"rptBool\": [true, false],\n  \"rptBytes\": [\"AQ==\"],\n  \"rptString\": [\"a\"]\n}",
+	}, {
+		mo:   protojson.MarshalOptions{Canonical: true, Indent: "\t", CompactArrays: true, NameSeparator: ":"},
+		want: "{\n\t\"rptBool\":[true, false],\n\t\"rptString\":[\"a\"],\n\t\"rptBytes\":[\"AQ==\"]\n}",
+	}}
+	for _, tt := range tests {
+		b, err := tt.mo.Marshal(m)
+		if err != nil {
+			t.Fatalf("Marshal error: %v", err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("Marshal with %+v:\ngot:  %s\nwant: %s", tt.mo, b, tt.want)
+		}
+	}
+
+	m2 := &pb3.Maps{Int32ToStr: map[int32]string{10: "ten", 2: "two"}}
+	b, err := protojson.MarshalOptions{Canonical: true, SortKeys: true}.Marshal(m2)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	if got, want := string(b), `{"int32ToStr":{"10":"ten","2":"two"}}`; got != want {
+		t.Errorf("Marshal with SortKeys:\ngot:  %s\nwant: %s", got, want)
+	}
+
+	if _, err := (protojson.MarshalOptions{NameSeparator: "="}).Marshal(m); err == nil {
+		t.Errorf("Marshal with invalid NameSeparator: got nil error, want error")
+	}
+}
+
+func TestMarshalConcurrency(t *testing.T) {
+	m := &pb2.Nests{}
+	for i := 0; i < 3000; i++ {
+		m.RptNested = append(m.RptNested, &pb2.Nested{
+			OptString: proto.String(strconv.Itoa(i)),
+			OptNested: &pb2.Nested{},
+		})
+	}
+	for _, mo := range []protojson.MarshalOptions{
+		{},
+		{Multiline: true},
+		{Indent: "\t", Canonical: true, SortKeys: true, CompactArrays: true},
+	} {
+		want, err := mo.Marshal(m)
+		if err != nil {
+			t.Fatalf("Marshal() error: %v", err)
+		}
+		for _, n := range []int{2, 7, 5000} {
+			mo := mo
+			mo.Concurrency = n
+			got, err := mo.Marshal(m)
+			if err != nil {
+				t.Fatalf("Marshal() with Concurrency %d error: %v", n, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Marshal() with Concurrency %d differs from sequential output", n)
+			}
+		}
+	}
+
+	// The error of the first invalid element is reported.
+	m.RptNested[2500].OptNested.OptString = proto.String("\xff")
+	m.RptNested[1500].OptString = proto.String("\xff")
+	_, err := protojson.MarshalOptions{Concurrency: 4}.Marshal(m)
+	if err == nil || !strings.Contains(err.Error(), "invalid UTF-8") {
+		t.Errorf("Marshal() with Concurrency error: %v, want invalid UTF-8", err)
+	}
+}
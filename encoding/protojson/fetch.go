@@ -0,0 +1,40 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protojson
+
+import (
+	"context"
+
+	pref "google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// MessageTypeFetcher fetches message types that are not known to the
+// Resolver of MarshalOptions or UnmarshalOptions, such as from a schema
+// registry service. It is used to resolve the types of google.protobuf.Any
+// messages.
+//
+// Fetched types are not cached by this package; an implementation that
+// makes remote calls should cache the types it returns.
+type MessageTypeFetcher interface {
+	// FetchMessageByURL returns the message type for the type URL of an Any.
+	// It returns protoregistry.NotFound if the type does not exist.
+	// The context is the one given to MarshalContext or UnmarshalContext,
+	// or context.Background if none was given.
+	FetchMessageByURL(ctx context.Context, url string) (pref.MessageType, error)
+}
+
+// findMessageByURL looks up the message type for url in r,
+// falling back to f if it is non-nil and r does not have the type.
+func findMessageByURL(ctx context.Context, r protoregistry.MessageTypeResolver, f MessageTypeFetcher, url string) (pref.MessageType, error) {
+	mt, err := r.FindMessageByURL(url)
+	if err != protoregistry.NotFound || f == nil {
+		return mt, err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return f.FetchMessageByURL(ctx, url)
+}
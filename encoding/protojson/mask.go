@@ -0,0 +1,65 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protojson
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/internal/errors"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// fieldMask is a tree of the field names covered by MarshalOptions.Fields
+// for a single message. A nil fieldMask covers every field of the message
+// and all of their sub-fields.
+type fieldMask map[pref.Name]fieldMask
+
+// newFieldMask returns the fieldMask for the paths in o.Fields relative to
+// the message descriptor md, or nil if o.Fields has no paths.
+func (o MarshalOptions) newFieldMask(md pref.MessageDescriptor) (fieldMask, error) {
+	paths := o.Fields.GetPaths()
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	root := fieldMask{}
+	for _, path := range paths {
+		if err := root.insert(md, path); err != nil {
+			return nil, err
+		}
+	}
+	return root, nil
+}
+
+func (fm fieldMask) insert(md pref.MessageDescriptor, path string) error {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		if md == nil || wellKnownTypeMarshaler(md.FullName()) != nil {
+			// Well-known types are always marshaled in their entirety.
+			return nil
+		}
+		fd := md.Fields().ByName(pref.Name(name))
+		if fd == nil {
+			return errors.New("invalid field mask path %q: %v has no field named %q", path, md.FullName(), name)
+		}
+		last := i == len(names)-1
+		if !last && (fd.IsList() || fd.IsMap() || fd.Message() == nil) {
+			return errors.New("invalid field mask path %q: %v is not a singular message field", path, fd.FullName())
+		}
+		child, ok := fm[fd.Name()]
+		switch {
+		case ok && child == nil:
+			// A shorter path already covers this field entirely.
+			return nil
+		case last:
+			fm[fd.Name()] = nil
+			return nil
+		case !ok:
+			child = fieldMask{}
+			fm[fd.Name()] = child
+		}
+		fm, md = child, fd.Message()
+	}
+	return nil
+}
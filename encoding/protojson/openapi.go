@@ -0,0 +1,384 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protojson
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/internal/errors"
+	"google.golang.org/protobuf/proto"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// openAPISchemaPrefix refers to a schema in an OpenAPI Components Object.
+const openAPISchemaPrefix = "#/components/schemas/"
+
+// OpenAPIComponents returns an OpenAPI 3.1 Components Object whose "schemas"
+// describe the JSON representation of messages of the given types and of the
+// message and enum types they reference. The schemas are keyed by full name
+// and are the same as the "$defs" of the documents returned by JSONSchema.
+func (o SchemaOptions) OpenAPIComponents(mds ...pref.MessageDescriptor) ([]byte, error) {
+	g, err := o.newSchemaGen(openAPISchemaPrefix)
+	if err != nil {
+		return nil, err
+	}
+	g.StartObject()
+	g.WriteName("schemas")
+	if err := g.writeDefs(schemaDefs(mds...)); err != nil {
+		return nil, err
+	}
+	g.EndObject()
+	return g.Bytes(), nil
+}
+
+// OpenAPIPaths returns an OpenAPI 3.1 Paths Object with an operation for
+// each HTTP binding of the methods of the given services, as declared by
+// google.api.http method options. Methods without the option are omitted.
+//
+// The request body and the response of each operation, and the path
+// parameters, refer to the schemas returned by OpenAPIComponents for the
+// input and output types of the methods. Fields of the input that are not
+// bound to the path or body, and which may be given as query parameters,
+// are not described.
+func (o SchemaOptions) OpenAPIPaths(sds ...pref.ServiceDescriptor) ([]byte, error) {
+	type operation struct {
+		md   pref.MethodDescriptor
+		rule httpRule
+	}
+	paths := make(map[string]map[string]operation)
+	for _, sd := range sds {
+		methods := sd.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			md := methods.Get(i)
+			rules, err := methodHTTPRules(md)
+			if err != nil {
+				return nil, err
+			}
+			for _, rule := range rules {
+				path := openAPIPath(rule.path)
+				if paths[path] == nil {
+					paths[path] = make(map[string]operation)
+				}
+				if _, ok := paths[path][rule.method]; ok {
+					return nil, errors.New("%v: duplicate HTTP binding %v %v", md.FullName(), strings.ToUpper(rule.method), rule.path)
+				}
+				paths[path][rule.method] = operation{md, rule}
+			}
+		}
+	}
+	var keys []string
+	for path := range paths {
+		keys = append(keys, path)
+	}
+	sort.Strings(keys)
+
+	g, err := o.newSchemaGen(openAPISchemaPrefix)
+	if err != nil {
+		return nil, err
+	}
+	g.StartObject()
+	for _, path := range keys {
+		if err := g.WriteName(path); err != nil {
+			return nil, err
+		}
+		g.StartObject()
+		for _, method := range operationMethods {
+			op, ok := paths[path][method]
+			if !ok {
+				continue
+			}
+			g.WriteName(method)
+			if err := g.writeOperation(op.md, op.rule); err != nil {
+				return nil, err
+			}
+		}
+		g.EndObject()
+	}
+	g.EndObject()
+	return g.Bytes(), nil
+}
+
+// httpMethods are the HTTP methods of the google.api.HttpRule patterns,
+// in field number order.
+var httpMethods = []string{"get", "put", "post", "delete", "patch"}
+
+// operationMethods are the HTTP methods that an OpenAPI Path Item Object
+// may have operations for, in the order in which they are written.
+// Bindings with custom methods not in this list are omitted.
+var operationMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// writeOperation writes an Operation Object for the method md bound to rule.
+func (g *schemaGen) writeOperation(md pref.MethodDescriptor, rule httpRule) error {
+	in, out := md.Input(), md.Output()
+	g.StartObject()
+	g.WriteName("operationId")
+	g.WriteString(strings.Replace(string(md.FullName()), ".", "_", -1))
+	if err := g.writeDescription(md); err != nil {
+		return err
+	}
+
+	if params := pathParams(rule.path); len(params) > 0 {
+		g.WriteName("parameters")
+		g.StartArray()
+		for _, name := range params {
+			fd := fieldByPath(in, name)
+			if fd == nil || fd.IsList() || fd.IsMap() || fd.Message() != nil {
+				return errors.New("%v: path parameter %q is not a singular scalar field of %v", md.FullName(), name, in.FullName())
+			}
+			g.StartObject()
+			g.WriteName("name")
+			g.WriteString(name)
+			g.WriteName("in")
+			g.WriteString("path")
+			g.WriteName("required")
+			g.WriteBool(true)
+			g.WriteName("schema")
+			g.StartObject()
+			g.writeSingular(fd)
+			g.EndObject()
+			g.EndObject()
+		}
+		g.EndArray()
+	}
+
+	if rule.body != "" {
+		g.WriteName("requestBody")
+		g.StartObject()
+		g.WriteName("required")
+		g.WriteBool(true)
+		g.WriteName("content")
+		g.StartObject()
+		g.WriteName("application/json")
+		g.StartObject()
+		g.WriteName("schema")
+		g.StartObject()
+		if rule.body == "*" {
+			g.WriteName("$ref")
+			g.WriteString(g.refPrefix + string(in.FullName()))
+		} else {
+			fd := fieldByPath(in, rule.body)
+			if fd == nil {
+				return errors.New("%v: body field %q is not a field of %v", md.FullName(), rule.body, in.FullName())
+			}
+			g.writeField(fd)
+		}
+		g.EndObject()
+		g.EndObject()
+		g.EndObject()
+		g.EndObject()
+	}
+
+	g.WriteName("responses")
+	g.StartObject()
+	g.WriteName("200")
+	g.StartObject()
+	g.WriteName("description")
+	g.WriteString("OK")
+	g.WriteName("content")
+	g.StartObject()
+	g.WriteName("application/json")
+	g.StartObject()
+	g.WriteName("schema")
+	g.StartObject()
+	g.WriteName("$ref")
+	g.WriteString(g.refPrefix + string(out.FullName()))
+	g.EndObject()
+	g.EndObject()
+	g.EndObject()
+	g.EndObject()
+	g.EndObject()
+
+	g.EndObject()
+	return nil
+}
+
+// openAPIPath converts a google.api.http path template into an OpenAPI path,
+// removing the segment patterns of the variables.
+// For example, "/v1/{name=shelves/*}:get" becomes "/v1/{name}:get".
+func openAPIPath(template string) string {
+	var b bytes.Buffer
+	for {
+		i := strings.IndexByte(template, '{')
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(template[i:], '}')
+		if j < 0 {
+			break
+		}
+		v := template[i+1 : i+j]
+		if k := strings.IndexByte(v, '='); k >= 0 {
+			v = v[:k]
+		}
+		b.WriteString(template[:i])
+		b.WriteString("{" + v + "}")
+		template = template[i+j+1:]
+	}
+	b.WriteString(template)
+	return b.String()
+}
+
+// pathParams returns the names of the variables of a path template.
+func pathParams(template string) []string {
+	var names []string
+	for {
+		i := strings.IndexByte(template, '{')
+		if i < 0 {
+			return names
+		}
+		j := strings.IndexByte(template[i:], '}')
+		if j < 0 {
+			return names
+		}
+		v := template[i+1 : i+j]
+		if k := strings.IndexByte(v, '='); k >= 0 {
+			v = v[:k]
+		}
+		names = append(names, v)
+		template = template[i+j+1:]
+	}
+}
+
+// fieldByPath returns the field named by a dot-separated path of proto field
+// names relative to md, or nil if there is no such field.
+func fieldByPath(md pref.MessageDescriptor, path string) pref.FieldDescriptor {
+	var fd pref.FieldDescriptor
+	for _, name := range strings.Split(path, ".") {
+		if md == nil {
+			return nil
+		}
+		if fd = md.Fields().ByName(pref.Name(name)); fd == nil {
+			return nil
+		}
+		md = fd.Message()
+	}
+	return fd
+}
+
+// httpRule is an HTTP binding declared by a google.api.HttpRule.
+type httpRule struct {
+	method string // lowercase HTTP method
+	path   string // path template
+	body   string // field bound to the request body, "*", or empty
+}
+
+// Field numbers of the google.api.http method option and of the
+// google.api.HttpRule message, which is parsed from the wire format since
+// its Go type is not part of this module.
+const (
+	httpOptionNumber protowire.Number = 72295728
+
+	httpRuleGetNumber                protowire.Number = 2
+	httpRulePutNumber                protowire.Number = 3
+	httpRulePostNumber               protowire.Number = 4
+	httpRuleDeleteNumber             protowire.Number = 5
+	httpRulePatchNumber              protowire.Number = 6
+	httpRuleBodyNumber               protowire.Number = 7
+	httpRuleCustomNumber             protowire.Number = 8
+	httpRuleAdditionalBindingsNumber protowire.Number = 11
+
+	customHTTPPatternKindNumber protowire.Number = 1
+	customHTTPPatternPathNumber protowire.Number = 2
+)
+
+// methodHTTPRules returns the HTTP bindings of md declared by its
+// google.api.http option, including any additional bindings.
+func methodHTTPRules(md pref.MethodDescriptor) ([]httpRule, error) {
+	opts := md.Options()
+	if opts == nil || !opts.ProtoReflect().IsValid() {
+		return nil, nil
+	}
+	b, err := proto.MarshalOptions{AllowPartial: true}.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	var rules []httpRule
+	err = rangeBytesFields(b, func(num protowire.Number, v []byte) error {
+		if num != httpOptionNumber {
+			return nil
+		}
+		var err error
+		rules, err = appendHTTPRules(rules, v)
+		return err
+	})
+	if err != nil {
+		return nil, errors.New("%v: invalid google.api.http option: %v", md.FullName(), err)
+	}
+	return rules, nil
+}
+
+// appendHTTPRules appends the binding of the google.api.HttpRule b and of
+// its additional bindings to rules.
+func appendHTTPRules(rules []httpRule, b []byte) ([]httpRule, error) {
+	var rule httpRule
+	var additional [][]byte
+	err := rangeBytesFields(b, func(num protowire.Number, v []byte) error {
+		switch num {
+		case httpRuleGetNumber, httpRulePutNumber, httpRulePostNumber, httpRuleDeleteNumber, httpRulePatchNumber:
+			rule.method = httpMethods[num-httpRuleGetNumber]
+			rule.path = string(v)
+		case httpRuleCustomNumber:
+			rule.method, rule.path = "", ""
+			return rangeBytesFields(v, func(num protowire.Number, v []byte) error {
+				switch num {
+				case customHTTPPatternKindNumber:
+					rule.method = strings.ToLower(string(v))
+				case customHTTPPatternPathNumber:
+					rule.path = string(v)
+				}
+				return nil
+			})
+		case httpRuleBodyNumber:
+			rule.body = string(v)
+		case httpRuleAdditionalBindingsNumber:
+			additional = append(additional, v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rule.path != "" {
+		rules = append(rules, rule)
+	}
+	for _, v := range additional {
+		if rules, err = appendHTTPRules(rules, v); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// rangeBytesFields calls f for each length-delimited field in the wire-format
+// message b, skipping fields of other wire types.
+func rangeBytesFields(b []byte, f func(protowire.Number, []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := f(num, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protojson_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/reflect/protodesc"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
+	preg "google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/testing/protopack"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// openAPITestFile returns a file descriptor with a service whose methods
+// have google.api.http options.
+func openAPITestFile(t *testing.T) pref.FileDescriptor {
+	fdp := new(descriptorpb.FileDescriptorProto)
+	err := prototext.Unmarshal([]byte(`
+		name: "openapi_test.proto"
+		package: "test"
+		syntax: "proto3"
+		message_type: [{
+			name: "Shelf"
+			field: [
+				{name:"name" number:1 label:LABEL_OPTIONAL type:TYPE_STRING json_name:"name"},
+				{name:"theme" number:2 label:LABEL_OPTIONAL type:TYPE_STRING json_name:"theme"}
+			]
+		}, {
+			name: "GetShelfRequest"
+			field: [{name:"name" number:1 label:LABEL_OPTIONAL type:TYPE_STRING json_name:"name"}]
+		}, {
+			name: "UpdateShelfRequest"
+			field: [{name:"shelf" number:1 label:LABEL_OPTIONAL type:TYPE_MESSAGE type_name:".test.Shelf" json_name:"shelf"}]
+		}, {
+			name: "Empty"
+		}]
+		service: [{
+			name: "Library"
+			method: [
+				{name:"GetShelf" input_type:".test.GetShelfRequest" output_type:".test.Shelf" options:{}},
+				{name:"UpdateShelf" input_type:".test.UpdateShelfRequest" output_type:".test.Shelf" options:{}},
+				{name:"Ping" input_type:".test.Empty" output_type:".test.Empty"}
+			]
+		}]
+		source_code_info: {location: [
+			{path: [6, 0, 2, 0] span: [0, 0, 0] leading_comments: " Gets a shelf.\n"}
+		]}
+	`), fdp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	methods := fdp.GetService()[0].GetMethod()
+	methods[0].GetOptions().ProtoReflect().SetUnknown(protopack.Message{
+		protopack.Tag{Number: 72295728, Type: protopack.BytesType}, protopack.LengthPrefix{protopack.Message{
+			protopack.Tag{Number: 2, Type: protopack.BytesType}, protopack.String("/v1/{name=shelves/*}"),
+			protopack.Tag{Number: 11, Type: protopack.BytesType}, protopack.LengthPrefix{protopack.Message{
+				protopack.Tag{Number: 8, Type: protopack.BytesType}, protopack.LengthPrefix{protopack.Message{
+					protopack.Tag{Number: 1, Type: protopack.BytesType}, protopack.String("HEAD"),
+					protopack.Tag{Number: 2, Type: protopack.BytesType}, protopack.String("/v1/{name=shelves/*}"),
+				}},
+			}},
+		}},
+	}.Marshal())
+	methods[1].GetOptions().ProtoReflect().SetUnknown(protopack.Message{
+		protopack.Tag{Number: 72295728, Type: protopack.BytesType}, protopack.LengthPrefix{protopack.Message{
+			protopack.Tag{Number: 6, Type: protopack.BytesType}, protopack.String("/v1/{shelf.name=shelves/*}"),
+			protopack.Tag{Number: 7, Type: protopack.BytesType}, protopack.String("shelf"),
+		}},
+	}.Marshal())
+	fd, err := protodesc.NewFile(fdp, preg.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd
+}
+
+func TestOpenAPIComponents(t *testing.T) {
+	fd := openAPITestFile(t)
+	b, err := protojson.SchemaOptions{}.OpenAPIComponents(
+		fd.Messages().ByName("GetShelfRequest"),
+		fd.Messages().ByName("UpdateShelfRequest"),
+	)
+	if err != nil {
+		t.Fatalf("OpenAPIComponents() error: %v", err)
+	}
+	compareJSON(t, "OpenAPIComponents()", b, `{
+		"schemas": {
+			"test.GetShelfRequest": {"type": "object", "properties": {"name": {"type": "string"}}},
+			"test.Shelf": {
+				"type": "object",
+				"properties": {"name": {"type": "string"}, "theme": {"type": "string"}}
+			},
+			"test.UpdateShelfRequest": {
+				"type": "object",
+				"properties": {"shelf": {"$ref": "#/components/schemas/test.Shelf"}}
+			}
+		}
+	}`)
+}
+
+func TestOpenAPIPaths(t *testing.T) {
+	fd := openAPITestFile(t)
+	b, err := protojson.SchemaOptions{}.OpenAPIPaths(fd.Services().ByName("Library"))
+	if err != nil {
+		t.Fatalf("OpenAPIPaths() error: %v", err)
+	}
+	compareJSON(t, "OpenAPIPaths()", b, `{
+		"/v1/{name}": {
+			"get": {
+				"operationId": "test_Library_GetShelf",
+				"description": "Gets a shelf.",
+				"parameters": [{"name": "name", "in": "path", "required": true, "schema": {"type": "string"}}],
+				"responses": {"200": {
+					"description": "OK",
+					"content": {"application/json": {"schema": {"$ref": "#/components/schemas/test.Shelf"}}}
+				}}
+			},
+			"head": {
+				"operationId": "test_Library_GetShelf",
+				"description": "Gets a shelf.",
+				"parameters": [{"name": "name", "in": "path", "required": true, "schema": {"type": "string"}}],
+				"responses": {"200": {
+					"description": "OK",
+					"content": {"application/json": {"schema": {"$ref": "#/components/schemas/test.Shelf"}}}
+				}}
+			}
+		},
+		"/v1/{shelf.name}": {
+			"patch": {
+				"operationId": "test_Library_UpdateShelf",
+				"parameters": [{"name": "shelf.name", "in": "path", "required": true, "schema": {"type": "string"}}],
+				"requestBody": {
+					"required": true,
+					"content": {"application/json": {"schema": {"$ref": "#/components/schemas/test.Shelf"}}}
+				},
+				"responses": {"200": {
+					"description": "OK",
+					"content": {"application/json": {"schema": {"$ref": "#/components/schemas/test.Shelf"}}}
+				}}
+			}
+		}
+	}`)
+}
+
+// compareJSON reports whether got and want are equivalent JSON values.
+func compareJSON(t *testing.T, name string, got []byte, want string) {
+	t.Helper()
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("%v returned invalid JSON: %v\n%s", name, err, got)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(wantValue, gotValue); diff != "" {
+		t.Errorf("%v mismatch (-want +got):\n%v", name, diff)
+	}
+}
@@ -0,0 +1,414 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protojson
+
+import (
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/internal/encoding/json"
+	"google.golang.org/protobuf/internal/genid"
+	"google.golang.org/protobuf/internal/pragma"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// JSONSchema returns a JSON Schema document describing the JSON
+// representation of messages of type md, using default options.
+func JSONSchema(md pref.MessageDescriptor) ([]byte, error) {
+	return SchemaOptions{}.JSONSchema(md)
+}
+
+// SchemaOptions configures the generation of schemas that describe the JSON
+// representation of messages.
+//
+// A schema describes the output of Marshal with the MarshalOptions of the
+// same names as the fields of SchemaOptions. Each message and enum type is
+// described by a separate named schema. The following are not described:
+// that at most one field of a oneof may be present, the alternative forms
+// accepted by Unmarshal (such as proto field names and numbers in strings),
+// extension fields, and the null values emitted due to EmitUnpopulated.
+type SchemaOptions struct {
+	pragma.NoUnkeyedLiterals
+
+	// Multiline and Indent format the output as for MarshalOptions.
+	Multiline bool
+	Indent    string
+
+	// UseProtoNames describes fields with their proto field names.
+	UseProtoNames bool
+
+	// UseEnumNumbers describes enum values as numbers.
+	UseEnumNumbers bool
+
+	// UseInt64Numbers describes 64-bit integer fields as JSON numbers.
+	UseInt64Numbers bool
+}
+
+// JSONSchema returns a JSON Schema (draft 2020-12) document describing the
+// JSON representation of messages of type md. The schemas of md and of the
+// message and enum types it references are in the "$defs" of the document,
+// which are keyed by full name; the document itself refers to the schema of
+// md. The leading comments of declarations in the source information of
+// their files, if any, are used as the descriptions of the schemas.
+func (o SchemaOptions) JSONSchema(md pref.MessageDescriptor) ([]byte, error) {
+	g, err := o.newSchemaGen("#/$defs/")
+	if err != nil {
+		return nil, err
+	}
+	g.StartObject()
+	g.WriteName("$schema")
+	g.WriteString("https://json-schema.org/draft/2020-12/schema")
+	g.WriteName("$ref")
+	g.WriteString(g.refPrefix + string(md.FullName()))
+	g.WriteName("$defs")
+	if err := g.writeDefs(schemaDefs(md)); err != nil {
+		return nil, err
+	}
+	g.EndObject()
+	return g.Bytes(), nil
+}
+
+// schemaGen writes schemas describing the JSON representation of messages.
+type schemaGen struct {
+	*json.Encoder
+	opts SchemaOptions
+
+	// refPrefix is prepended to a full name to refer to its named schema.
+	refPrefix string
+}
+
+func (o SchemaOptions) newSchemaGen(refPrefix string) (*schemaGen, error) {
+	if o.Multiline && o.Indent == "" {
+		o.Indent = defaultIndent
+	}
+	e, err := json.NewEncoder(o.Indent)
+	if err != nil {
+		return nil, err
+	}
+	e.SetStable()
+	return &schemaGen{
+		Encoder:   e,
+		opts:      o,
+		refPrefix: refPrefix,
+	}, nil
+}
+
+// schemaDefs returns the message and enum types that schemas for mds
+// refer to, including mds, sorted by full name.
+func schemaDefs(mds ...pref.MessageDescriptor) []pref.Descriptor {
+	seen := make(map[pref.FullName]bool)
+	var defs []pref.Descriptor
+	var walk func(d pref.Descriptor)
+	walk = func(d pref.Descriptor) {
+		if d == nil || seen[d.FullName()] {
+			return
+		}
+		if ed, ok := d.(pref.EnumDescriptor); ok && ed.FullName() == genid.NullValue_enum_fullname {
+			return // described as null where it is used
+		}
+		seen[d.FullName()] = true
+		defs = append(defs, d)
+		md, ok := d.(pref.MessageDescriptor)
+		if !ok || wellKnownTypeMarshaler(md.FullName()) != nil {
+			return
+		}
+		fds := md.Fields()
+		for i := 0; i < fds.Len(); i++ {
+			fd := fds.Get(i)
+			if fd.IsMap() {
+				fd = fd.MapValue()
+			}
+			if fd.Message() != nil {
+				walk(fd.Message())
+			} else if fd.Enum() != nil {
+				walk(fd.Enum())
+			}
+		}
+	}
+	for _, md := range mds {
+		walk(md)
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].FullName() < defs[j].FullName()
+	})
+	return defs
+}
+
+// writeDefs writes an object containing the named schemas of defs.
+func (g *schemaGen) writeDefs(defs []pref.Descriptor) error {
+	g.StartObject()
+	for _, d := range defs {
+		g.WriteName(string(d.FullName()))
+		g.StartObject()
+		if err := g.writeDescription(d); err != nil {
+			return err
+		}
+		if err := g.writeDef(d); err != nil {
+			return err
+		}
+		g.EndObject()
+	}
+	g.EndObject()
+	return nil
+}
+
+// writeDef writes the members of the named schema of a message or enum.
+func (g *schemaGen) writeDef(d pref.Descriptor) error {
+	if ed, ok := d.(pref.EnumDescriptor); ok {
+		vals := ed.Values()
+		g.WriteName("type")
+		if g.opts.UseEnumNumbers {
+			g.WriteString("integer")
+		} else {
+			g.WriteString("string")
+		}
+		g.WriteName("enum")
+		g.StartArray()
+		for i := 0; i < vals.Len(); i++ {
+			if g.opts.UseEnumNumbers {
+				g.WriteInt(int64(vals.Get(i).Number()))
+			} else {
+				g.WriteString(string(vals.Get(i).Name()))
+			}
+		}
+		g.EndArray()
+		return nil
+	}
+
+	md := d.(pref.MessageDescriptor)
+	if wellKnownTypeMarshaler(md.FullName()) != nil {
+		return g.writeWellKnownDef(md)
+	}
+	g.WriteName("type")
+	g.WriteString("object")
+	g.WriteName("properties")
+	g.StartObject()
+	var required []string
+	fds := md.Fields()
+	for i := 0; i < fds.Len(); i++ {
+		fd := fds.Get(i)
+		name := g.fieldName(fd)
+		if fd.Cardinality() == pref.Required {
+			required = append(required, name)
+		}
+		g.WriteName(name)
+		g.StartObject()
+		if err := g.writeDescription(fd); err != nil {
+			return err
+		}
+		g.writeField(fd)
+		g.EndObject()
+	}
+	g.EndObject()
+	if len(required) > 0 {
+		g.WriteName("required")
+		g.StartArray()
+		for _, name := range required {
+			g.WriteString(name)
+		}
+		g.EndArray()
+	}
+	return nil
+}
+
+// writeWellKnownDef writes the members of the named schema of a well-known
+// type with a specialized JSON representation.
+func (g *schemaGen) writeWellKnownDef(md pref.MessageDescriptor) error {
+	switch md.Name() {
+	case genid.Any_message_name:
+		g.WriteName("type")
+		g.WriteString("object")
+		g.WriteName("properties")
+		g.StartObject()
+		g.WriteName("@type")
+		g.StartObject()
+		g.WriteName("type")
+		g.WriteString("string")
+		g.EndObject()
+		g.EndObject()
+		g.WriteName("required")
+		g.StartArray()
+		g.WriteString("@type")
+		g.EndArray()
+	case genid.Timestamp_message_name:
+		g.WriteName("type")
+		g.WriteString("string")
+		g.WriteName("format")
+		g.WriteString("date-time")
+	case genid.Duration_message_name:
+		g.WriteName("type")
+		g.WriteString("string")
+		g.WriteName("pattern")
+		g.WriteString(`^-?[0-9]+(\.[0-9]{1,9})?s$`)
+	case genid.Struct_message_name:
+		g.WriteName("type")
+		g.WriteString("object")
+	case genid.ListValue_message_name:
+		g.WriteName("type")
+		g.WriteString("array")
+	case genid.Value_message_name:
+		// Any JSON value is valid.
+	case genid.FieldMask_message_name:
+		g.WriteName("type")
+		g.WriteString("string")
+	case genid.Empty_message_name:
+		g.WriteName("type")
+		g.WriteString("object")
+		g.WriteName("maxProperties")
+		g.WriteInt(0)
+	default:
+		// Wrapper types are represented by their value field.
+		g.writeSingular(md.Fields().ByNumber(genid.WrapperValue_Value_field_number))
+	}
+	return nil
+}
+
+// fieldName returns the name of fd in the JSON representation.
+func (g *schemaGen) fieldName(fd pref.FieldDescriptor) string {
+	if !g.opts.UseProtoNames {
+		return fd.JSONName()
+	}
+	if fd.Kind() == pref.GroupKind {
+		return string(fd.Message().Name())
+	}
+	return string(fd.Name())
+}
+
+// writeField writes the members of the schema for the value of fd.
+func (g *schemaGen) writeField(fd pref.FieldDescriptor) {
+	switch {
+	case fd.IsMap():
+		g.WriteName("type")
+		g.WriteString("object")
+		g.WriteName("additionalProperties")
+		g.StartObject()
+		g.writeSingular(fd.MapValue())
+		g.EndObject()
+	case fd.IsList():
+		g.WriteName("type")
+		g.WriteString("array")
+		g.WriteName("items")
+		g.StartObject()
+		g.writeSingular(fd)
+		g.EndObject()
+	default:
+		g.writeSingular(fd)
+	}
+}
+
+// writeSingular writes the members of the schema for a singular value of fd.
+func (g *schemaGen) writeSingular(fd pref.FieldDescriptor) {
+	switch fd.Kind() {
+	case pref.BoolKind:
+		g.WriteName("type")
+		g.WriteString("boolean")
+	case pref.Int32Kind, pref.Sint32Kind, pref.Sfixed32Kind:
+		g.writeInteger(-1<<31, 1<<31-1)
+	case pref.Uint32Kind, pref.Fixed32Kind:
+		g.writeInteger(0, 1<<32-1)
+	case pref.Int64Kind, pref.Sint64Kind, pref.Sfixed64Kind:
+		if g.opts.UseInt64Numbers {
+			g.WriteName("type")
+			g.WriteString("integer")
+			break
+		}
+		g.WriteName("type")
+		g.WriteString("string")
+		g.WriteName("pattern")
+		g.WriteString("^-?[0-9]+$")
+	case pref.Uint64Kind, pref.Fixed64Kind:
+		if g.opts.UseInt64Numbers {
+			g.writeInteger(0, -1)
+			break
+		}
+		g.WriteName("type")
+		g.WriteString("string")
+		g.WriteName("pattern")
+		g.WriteString("^[0-9]+$")
+	case pref.FloatKind, pref.DoubleKind:
+		// Floating-point numbers may also be the special values as strings.
+		g.WriteName("anyOf")
+		g.StartArray()
+		g.StartObject()
+		g.WriteName("type")
+		g.WriteString("number")
+		g.EndObject()
+		g.StartObject()
+		g.WriteName("type")
+		g.WriteString("string")
+		g.WriteName("enum")
+		g.StartArray()
+		g.WriteString("NaN")
+		g.WriteString("Infinity")
+		g.WriteString("-Infinity")
+		g.EndArray()
+		g.EndObject()
+		g.EndArray()
+	case pref.StringKind:
+		g.WriteName("type")
+		g.WriteString("string")
+	case pref.BytesKind:
+		g.WriteName("type")
+		g.WriteString("string")
+		g.WriteName("contentEncoding")
+		g.WriteString("base64")
+	case pref.EnumKind:
+		if fd.Enum().FullName() == genid.NullValue_enum_fullname {
+			g.WriteName("type")
+			g.WriteString("null")
+			break
+		}
+		g.WriteName("$ref")
+		g.WriteString(g.refPrefix + string(fd.Enum().FullName()))
+	case pref.MessageKind, pref.GroupKind:
+		g.WriteName("$ref")
+		g.WriteString(g.refPrefix + string(fd.Message().FullName()))
+	}
+}
+
+// writeInteger writes the members of the schema for an integer in the range
+// [min, max], where a max of -1 means that there is no maximum.
+func (g *schemaGen) writeInteger(min, max int64) {
+	g.WriteName("type")
+	g.WriteString("integer")
+	g.WriteName("minimum")
+	g.WriteInt(min)
+	if max >= 0 {
+		g.WriteName("maximum")
+		g.WriteInt(max)
+	}
+}
+
+// writeDescription writes a "description" member with the leading comments
+// of the declaration of d, if any.
+func (g *schemaGen) writeDescription(d pref.Descriptor) error {
+	s := g.leadingComments(d)
+	if s == "" {
+		return nil
+	}
+	g.WriteName("description")
+	return g.WriteString(s)
+}
+
+// leadingComments returns the leading comments of the declaration of a
+// message, enum, or non-extension field d in the source information of its
+// file, with the comment formatting removed.
+func (g *schemaGen) leadingComments(d pref.Descriptor) string {
+	switch d := d.(type) {
+	case pref.MessageDescriptor, pref.EnumDescriptor, pref.ServiceDescriptor, pref.MethodDescriptor:
+	case pref.FieldDescriptor:
+		if d.IsExtension() {
+			return ""
+		}
+	default:
+		return ""
+	}
+	loc := d.ParentFile().SourceLocations().ByDescriptor(d)
+	lines := strings.Split(strings.TrimSuffix(loc.LeadingComments, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, " ")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
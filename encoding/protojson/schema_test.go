@@ -0,0 +1,201 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protojson_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	pb3 "google.golang.org/protobuf/internal/testprotos/textpb3"
+	"google.golang.org/protobuf/reflect/protodesc"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
+	preg "google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// schemaTestFile returns a file descriptor with source information.
+func schemaTestFile(t *testing.T) pref.FileDescriptor {
+	fdp := new(descriptorpb.FileDescriptorProto)
+	err := prototext.Unmarshal([]byte(`
+		name: "schema_test.proto"
+		package: "test"
+		syntax: "proto2"
+		message_type: [{
+			name: "Order"
+			field: [
+				{name:"order_id" number:1 label:LABEL_REQUIRED type:TYPE_INT64 json_name:"orderId"},
+				{name:"status" number:2 label:LABEL_OPTIONAL type:TYPE_ENUM type_name:".test.Order.Status" json_name:"status"},
+				{name:"items" number:3 label:LABEL_REPEATED type:TYPE_MESSAGE type_name:".test.Item" json_name:"items"},
+				{name:"prices" number:4 label:LABEL_REPEATED type:TYPE_MESSAGE type_name:".test.Order.PricesEntry" json_name:"prices"},
+				{name:"created" number:5 label:LABEL_OPTIONAL type:TYPE_MESSAGE type_name:".google.protobuf.Timestamp" json_name:"created"}
+			]
+			nested_type: [{
+				name: "PricesEntry"
+				field: [
+					{name:"key" number:1 label:LABEL_OPTIONAL type:TYPE_STRING json_name:"key"},
+					{name:"value" number:2 label:LABEL_OPTIONAL type:TYPE_DOUBLE json_name:"value"}
+				]
+				options: {map_entry: true}
+			}]
+			enum_type: [{
+				name: "Status"
+				value: [{name:"NEW" number:0}, {name:"DONE" number:1}]
+			}]
+		}, {
+			name: "Item"
+			field: [
+				{name:"sku" number:1 label:LABEL_OPTIONAL type:TYPE_STRING json_name:"sku"},
+				{name:"data" number:2 label:LABEL_OPTIONAL type:TYPE_BYTES json_name:"data"}
+			]
+		}]
+		dependency: "google/protobuf/timestamp.proto"
+		source_code_info: {location: [
+			{path: [4, 0] span: [0, 0, 0] leading_comments: " An order.\n Second line.\n"},
+			{path: [4, 0, 2, 0] span: [0, 0, 0] leading_comments: " The order ID.\n"},
+			{path: [4, 0, 4, 0] span: [0, 0, 0] leading_comments: " The order status.\n"},
+			{path: [4, 1, 2, 1] span: [0, 0, 0] trailing_comments: " Not a leading comment.\n"}
+		]}
+	`), fdp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := protodesc.NewFile(fdp, preg.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd
+}
+
+func TestJSONSchema(t *testing.T) {
+	md := schemaTestFile(t).Messages().ByName("Order")
+	tests := []struct {
+		desc string
+		so   protojson.SchemaOptions
+		want string
+	}{{
+		desc: "default",
+		want: `{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"$ref": "#/$defs/test.Order",
+			"$defs": {
+				"google.protobuf.Timestamp": {"type": "string", "format": "date-time"},
+				"test.Item": {
+					"type": "object",
+					"properties": {
+						"sku": {"type": "string"},
+						"data": {"type": "string", "contentEncoding": "base64"}
+					}
+				},
+				"test.Order": {
+					"description": "An order.\nSecond line.",
+					"type": "object",
+					"properties": {
+						"orderId": {"description": "The order ID.", "type": "string", "pattern": "^-?[0-9]+$"},
+						"status": {"$ref": "#/$defs/test.Order.Status"},
+						"items": {"type": "array", "items": {"$ref": "#/$defs/test.Item"}},
+						"prices": {
+							"type": "object",
+							"additionalProperties": {
+								"anyOf": [
+									{"type": "number"},
+									{"type": "string", "enum": ["NaN", "Infinity", "-Infinity"]}
+								]
+							}
+						},
+						"created": {"$ref": "#/$defs/google.protobuf.Timestamp"}
+					},
+					"required": ["orderId"]
+				},
+				"test.Order.Status": {"description": "The order status.", "type": "string", "enum": ["NEW", "DONE"]}
+			}
+		}`,
+	}, {
+		desc: "UseProtoNames, UseEnumNumbers, UseInt64Numbers",
+		so:   protojson.SchemaOptions{UseProtoNames: true, UseEnumNumbers: true, UseInt64Numbers: true},
+		want: `{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"$ref": "#/$defs/test.Order",
+			"$defs": {
+				"google.protobuf.Timestamp": {"type": "string", "format": "date-time"},
+				"test.Item": {
+					"type": "object",
+					"properties": {
+						"sku": {"type": "string"},
+						"data": {"type": "string", "contentEncoding": "base64"}
+					}
+				},
+				"test.Order": {
+					"description": "An order.\nSecond line.",
+					"type": "object",
+					"properties": {
+						"order_id": {"description": "The order ID.", "type": "integer"},
+						"status": {"$ref": "#/$defs/test.Order.Status"},
+						"items": {"type": "array", "items": {"$ref": "#/$defs/test.Item"}},
+						"prices": {
+							"type": "object",
+							"additionalProperties": {
+								"anyOf": [
+									{"type": "number"},
+									{"type": "string", "enum": ["NaN", "Infinity", "-Infinity"]}
+								]
+							}
+						},
+						"created": {"$ref": "#/$defs/google.protobuf.Timestamp"}
+					},
+					"required": ["order_id"]
+				},
+				"test.Order.Status": {"description": "The order status.", "type": "integer", "enum": [0, 1]}
+			}
+		}`,
+	}}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.desc, func(t *testing.T) {
+			b, err := tt.so.JSONSchema(md)
+			if err != nil {
+				t.Fatalf("JSONSchema() error: %v", err)
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatalf("JSONSchema() returned invalid JSON: %v\n%s", err, b)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("JSONSchema() mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestJSONSchemaFormat(t *testing.T) {
+	md := (&pb3.Nests{}).ProtoReflect().Descriptor()
+	want := `{"$schema":"https://json-schema.org/draft/2020-12/schema","$ref":"#/$defs/pb3.Nests","$defs":{` +
+		`"pb3.Nested":{"type":"object","properties":{"sString":{"type":"string"},"sNested":{"$ref":"#/$defs/pb3.Nested"}}},` +
+		`"pb3.Nests":{"type":"object","properties":{"sNested":{"$ref":"#/$defs/pb3.Nested"}}}}}`
+	for i := 0; i < 3; i++ {
+		b, err := protojson.JSONSchema(md)
+		if err != nil {
+			t.Fatalf("JSONSchema() error: %v", err)
+		}
+		if got := string(b); got != want {
+			t.Fatalf("JSONSchema():\ngot:  %s\nwant: %s", got, want)
+		}
+	}
+
+	b, err := protojson.SchemaOptions{Indent: "\t"}.JSONSchema(md)
+	if err != nil {
+		t.Fatalf("JSONSchema() error: %v", err)
+	}
+	if got, want := string(b[:4]), "{\n\t\""; got != want {
+		t.Errorf("JSONSchema() with Indent starts with %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,380 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protojson
+
+import (
+	"io"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/internal/encoding/json"
+	"google.golang.org/protobuf/internal/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Encoder writes messages in the JSON format to an output stream.
+//
+// The output of a message is written to the stream as it is produced,
+// so that a large message need not be held in memory in its entirety.
+// If an error occurs while marshaling a message, the output written for it
+// so far is left in the stream and the stream is no longer valid JSON,
+// so that error is also returned by all subsequent calls.
+type Encoder struct {
+	w    io.Writer
+	opts MarshalOptions
+
+	inArray bool
+	n       int // number of messages written in the current array
+	err     error
+}
+
+// NewEncoder returns an Encoder that writes to w using the options in o.
+func NewEncoder(w io.Writer, o MarshalOptions) *Encoder {
+	if o.Multiline && o.Indent == "" {
+		o.Indent = defaultIndent
+	}
+	if o.Resolver == nil {
+		o.Resolver = protoregistry.GlobalTypes
+	}
+	return &Encoder{w: w, opts: o}
+}
+
+// Encode writes the JSON encoding of m to the stream.
+// Outside of an array, each message is followed by a newline.
+// Within an array started by StartArray, each message is written as
+// an element of the array on its own line.
+//
+// A nil message is written as an empty JSON object.
+// Required fields, unless AllowPartial is set, and the paths of the
+// Fields mask are checked before any output for m is written.
+func (e *Encoder) Encode(m proto.Message) error {
+	if e.err != nil {
+		return e.err
+	}
+	var mask fieldMask
+	if m != nil {
+		if !e.opts.AllowPartial {
+			if err := proto.CheckInitialized(m); err != nil {
+				return err
+			}
+		}
+		var err error
+		if mask, err = e.opts.newFieldMask(m.ProtoReflect().Descriptor()); err != nil {
+			return err
+		}
+	}
+	var internalEnc *json.Encoder
+	if m != nil {
+		var err error
+		if internalEnc, err = json.NewStreamEncoder(e.w, e.opts.Indent); err != nil {
+			return err
+		}
+		if err := e.opts.setFormat(internalEnc); err != nil {
+			return err
+		}
+	}
+	if e.inArray {
+		if e.n > 0 {
+			e.write(",\n")
+		}
+		e.n++
+	}
+
+	if m == nil {
+		e.write("{}")
+	} else if e.err == nil {
+		enc := encoder{internalEnc, e.opts, mask}
+		if e.err = enc.marshalMessage(m.ProtoReflect()); e.err != nil {
+			internalEnc.Flush()
+			return e.err
+		}
+		if e.err = internalEnc.Flush(); e.err != nil {
+			return e.err
+		}
+	}
+
+	if !e.inArray {
+		e.write("\n")
+	}
+	return e.err
+}
+
+// StartArray writes the start of a JSON array to the stream,
+// so that subsequent messages written by Encode are elements of the array.
+// The array must be terminated by calling EndArray. Arrays cannot be nested.
+func (e *Encoder) StartArray() error {
+	if e.err != nil {
+		return e.err
+	}
+	if e.inArray {
+		return errors.New("cannot start a nested array")
+	}
+	e.inArray, e.n = true, 0
+	e.write("[\n")
+	return e.err
+}
+
+// EndArray writes the end of the JSON array started by StartArray to the
+// stream, followed by a newline.
+func (e *Encoder) EndArray() error {
+	if e.err != nil {
+		return e.err
+	}
+	if !e.inArray {
+		return errors.New("no array to end")
+	}
+	if e.n > 0 {
+		e.write("\n")
+	}
+	e.inArray = false
+	e.write("]\n")
+	return e.err
+}
+
+func (e *Encoder) write(s string) {
+	if e.err == nil {
+		_, e.err = io.WriteString(e.w, s)
+	}
+}
+
+// Decoder reads messages in the JSON format from an input stream.
+//
+// The input may be a single JSON value, a JSON array whose elements are
+// each decoded as a message, or a sequence of JSON values separated by
+// whitespace, such as newline-delimited JSON. The format is determined by
+// the first non-whitespace character of the input: if it is '[', the input
+// is treated as an array of messages.
+//
+// Only the JSON value for the message being decoded is held in memory.
+// The MaxDepth and MaxInputSize options apply to each message, and are
+// checked as the input is read. A stream of untrusted input should be read
+// with MaxInputSize set, since it is not limited by default.
+type Decoder struct {
+	// Options are the options used to unmarshal each message.
+	Options UnmarshalOptions
+
+	r    io.Reader
+	buf  []byte
+	off  int   // offset of the unconsumed input within buf
+	rerr error // error returned by the last read from r
+
+	state decoderState
+	n     int   // number of messages read in the current array
+	err   error // sticky error for malformed input
+}
+
+type decoderState uint8
+
+const (
+	decoderStart decoderState = iota
+	decoderSequence
+	decoderArray
+	decoderDone
+)
+
+// NewDecoder returns a Decoder that reads from r.
+// The Decoder buffers its input and may read data from r beyond the
+// JSON values requested.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Decode reads the next JSON value from the stream and unmarshals it into m.
+// It returns io.EOF when there are no more messages in the stream.
+//
+// If the value is well-formed but cannot be unmarshaled into m, the error is
+// returned and subsequent calls continue with the next value. Errors in the
+// structure of the stream itself are returned by every subsequent call.
+func (d *Decoder) Decode(m proto.Message) error {
+	if d.err != nil {
+		return d.err
+	}
+	if err := d.next(); err != nil {
+		if err != io.EOF {
+			d.err = err
+		}
+		return err
+	}
+	n, err := d.scanValue()
+	if err != nil {
+		d.err = err
+		return err
+	}
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	d.n++
+	return d.Options.Unmarshal(b, m)
+}
+
+// next advances the input to the start of the next value,
+// consuming any array delimiters before it.
+// It returns io.EOF if the stream has no more values.
+func (d *Decoder) next() error {
+	c, err := d.peek()
+	switch d.state {
+	case decoderStart:
+		if err != nil {
+			return err
+		}
+		if c != '[' {
+			d.state = decoderSequence
+			return nil
+		}
+		d.off++
+		d.state = decoderArray
+		return d.next()
+	case decoderSequence:
+		return err
+	case decoderArray:
+		if err == io.EOF {
+			return json.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		if c == ']' {
+			d.off++
+			d.state = decoderDone
+			if _, err := d.peek(); err == nil {
+				return errors.New("syntax error: unexpected data after the end of the array")
+			} else if err != io.EOF {
+				return err
+			}
+			return io.EOF
+		}
+		if d.n > 0 {
+			if c != ',' {
+				return errors.New("syntax error: unexpected character %q, missing \",\" between array elements", c)
+			}
+			d.off++
+			if c, err = d.peek(); err == io.EOF {
+				return json.ErrUnexpectedEOF
+			} else if err != nil {
+				return err
+			}
+			if c == ']' {
+				return errors.New("syntax error: unexpected character %q after \",\"", c)
+			}
+		}
+		return nil
+	default:
+		return io.EOF
+	}
+}
+
+// peek skips whitespace and returns the next byte of input without
+// consuming it. It returns io.EOF if the input is exhausted.
+func (d *Decoder) peek() (byte, error) {
+	for {
+		for ; d.off < len(d.buf); d.off++ {
+			switch c := d.buf[d.off]; c {
+			case ' ', '\n', '\r', '\t':
+			default:
+				return c, nil
+			}
+		}
+		if !d.fill() {
+			return 0, d.rerr
+		}
+	}
+}
+
+// scanValue returns the length of the JSON value at the start of the
+// unconsumed input, reading more input as necessary. The value itself is
+// validated by Unmarshal; only enough of its structure is examined here to
+// find where it ends and to enforce the limits of the Decoder.
+func (d *Decoder) scanValue() (int, error) {
+	maxDepth, maxSize := d.Options.MaxDepth, d.Options.MaxInputSize
+	if maxDepth == 0 {
+		maxDepth = defaultMaxDepth
+	}
+
+	var depth int
+	var inString, escaped bool
+	scalar := true
+	for i := 0; ; i++ {
+		if maxSize > 0 && i >= maxSize {
+			return 0, errors.New("JSON value exceeds the maximum size of %d bytes", maxSize)
+		}
+		if d.off+i == len(d.buf) && !d.fill() {
+			if d.rerr != io.EOF {
+				return 0, d.rerr
+			}
+			if scalar && !inString && i > 0 {
+				return i, nil
+			}
+			return 0, json.ErrUnexpectedEOF
+		}
+		c := d.buf[d.off+i]
+		switch {
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+				if depth == 0 {
+					return i + 1, nil
+				}
+			}
+		case c == '"':
+			inString = true
+			if i == 0 {
+				scalar = false
+			}
+		case c == '{' || c == '[':
+			if i == 0 {
+				scalar = false
+			}
+			if scalar {
+				return i, nil
+			}
+			if depth++; maxDepth > 0 && depth > maxDepth {
+				return 0, errors.New("JSON value exceeds the maximum nesting depth of %d", maxDepth)
+			}
+		case c == '}' || c == ']' || c == ',' || c == ' ' || c == '\n' || c == '\r' || c == '\t':
+			if scalar {
+				if i == 0 {
+					r, _ := utf8.DecodeRune(d.buf[d.off:])
+					return 0, errors.New("syntax error: unexpected character %q", r)
+				}
+				return i, nil
+			}
+			if c == '}' || c == ']' {
+				if depth--; depth == 0 {
+					return i + 1, nil
+				}
+			}
+		}
+	}
+}
+
+// fill reads more input into the buffer, discarding consumed input.
+// It reports whether any data was read.
+func (d *Decoder) fill() bool {
+	if d.rerr != nil {
+		return false
+	}
+	if d.off > 0 {
+		n := copy(d.buf, d.buf[d.off:])
+		d.buf = d.buf[:n]
+		d.off = 0
+	}
+	if len(d.buf) == cap(d.buf) {
+		d.buf = append(d.buf, make([]byte, 4096)...)[:len(d.buf)]
+	}
+	for {
+		n, err := d.r.Read(d.buf[len(d.buf):cap(d.buf)])
+		d.buf = d.buf[:len(d.buf)+n]
+		if err != nil {
+			d.rerr = err
+		}
+		if n > 0 || err != nil {
+			return n > 0
+		}
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protojson_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	pb2 "google.golang.org/protobuf/internal/testprotos/textpb2"
+	pb3 "google.golang.org/protobuf/internal/testprotos/textpb3"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// countingWriter records the number of calls to Write.
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(b)
+}
+
+func TestEncoder(t *testing.T) {
+	large := &pb3.Repeats{}
+	for i := 0; i < 1000; i++ {
+		large.RptString = append(large.RptString, strings.Repeat("x", 100))
+	}
+	ms := []proto.Message{
+		&pb3.Scalars{SString: "hello"},
+		nil,
+		large,
+	}
+
+	for _, opts := range []protojson.MarshalOptions{{}, {Multiline: true}} {
+		var want bytes.Buffer
+		for _, m := range ms {
+			b, err := opts.Marshal(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want.Write(b)
+			want.WriteByte('\n')
+		}
+
+		var got countingWriter
+		enc := protojson.NewEncoder(&got, opts)
+		for _, m := range ms {
+			if err := enc.Encode(m); err != nil {
+				t.Fatalf("Encode error: %v", err)
+			}
+		}
+		if got.String() != want.String() {
+			t.Errorf("Encode with %+v:\ngot:  %s\nwant: %s", opts, got.String(), want.String())
+		}
+		if got.writes < 10 {
+			t.Errorf("Encode with %+v wrote output in %d calls, want it to be streamed", opts, got.writes)
+		}
+	}
+}
+
+func TestEncoderArray(t *testing.T) {
+	var b bytes.Buffer
+	enc := protojson.NewEncoder(&b, protojson.MarshalOptions{Multiline: true})
+	if err := enc.StartArray(); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"one", "two", "three"} {
+		if err := enc.Encode(&pb3.Scalars{SString: s}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.StartArray(); err == nil {
+		t.Errorf("StartArray within an array: got nil error, want error")
+	}
+	if err := enc.EndArray(); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.EndArray(); err == nil {
+		t.Errorf("EndArray without an array: got nil error, want error")
+	}
+
+	var got []struct{ SString string }
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("output is not a valid JSON array: %v\n%s", err, b.String())
+	}
+	if len(got) != 3 || got[0].SString != "one" || got[2].SString != "three" {
+		t.Errorf("decoded array = %+v, want three messages", got)
+	}
+
+	b.Reset()
+	enc.StartArray()
+	enc.EndArray()
+	if got, want := b.String(), "[\n]\n"; got != want {
+		t.Errorf("empty array = %q, want %q", got, want)
+	}
+}
+
+type errorWriter struct{}
+
+var errWrite = errors.New("write error")
+
+func (errorWriter) Write([]byte) (int, error) { return 0, errWrite }
+
+func TestEncoderErrors(t *testing.T) {
+	enc := protojson.NewEncoder(errorWriter{}, protojson.MarshalOptions{})
+	if err := enc.Encode(&pb3.Scalars{SString: "hello"}); err != errWrite {
+		t.Errorf("Encode to failing writer: got %v, want %v", err, errWrite)
+	}
+
+	var b bytes.Buffer
+	enc = protojson.NewEncoder(&b, protojson.MarshalOptions{})
+	if err := enc.Encode(&pb2.Requireds{}); err == nil {
+		t.Errorf("Encode with missing required fields: got nil error, want error")
+	}
+	if b.Len() != 0 {
+		t.Errorf("Encode with missing required fields wrote %q, want nothing", b.String())
+	}
+
+	// An error partway through a message leaves the stream invalid,
+	// so the Encoder must not write anything more.
+	b.Reset()
+	enc = protojson.NewEncoder(&b, protojson.MarshalOptions{})
+	enc.StartArray()
+	if err := enc.Encode(&pb3.Scalars{SString: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	err := enc.Encode(&pb3.Scalars{SString: "abc\xff"})
+	if err == nil {
+		t.Fatalf("Encode with invalid UTF-8: got nil error, want error")
+	}
+	n := b.Len()
+	if err2 := enc.Encode(&pb3.Scalars{SString: "world"}); err2 != err {
+		t.Errorf("Encode after failure: got %v, want %v", err2, err)
+	}
+	if err2 := enc.EndArray(); err2 != err {
+		t.Errorf("EndArray after failure: got %v, want %v", err2, err)
+	}
+	if b.Len() != n {
+		t.Errorf("Encoder wrote %q after a failure", b.String()[n:])
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+		want  []string
+	}{{
+		desc:  "empty input",
+		input: " \n",
+	}, {
+		desc:  "single object",
+		input: `{"sString": "one"}`,
+		want:  []string{"one"},
+	}, {
+		desc:  "newline-delimited",
+		input: "{\"sString\": \"one\"}\n{\"sString\": \"two\"}\n\n{}\n",
+		want:  []string{"one", "two", ""},
+	}, {
+		desc:  "concatenated",
+		input: `{"sString":"}{"}{"sString":"\"]"}`,
+		want:  []string{"}{", `"]`},
+	}, {
+		desc:  "array",
+		input: "[\n  {\"sString\": \"one\"},\n  {\"sString\": \"[two]\"}\n]\n",
+		want:  []string{"one", "[two]"},
+	}, {
+		desc:  "empty array",
+		input: "[ ]",
+	}, {
+		desc:  "large value",
+		input: `{"sString": "` + strings.Repeat("x", 10000) + `"}`,
+		want:  []string{strings.Repeat("x", 10000)},
+	}}
+
+	for _, tt := range tests {
+		for _, r := range []func(string) io.Reader{
+			func(s string) io.Reader { return strings.NewReader(s) },
+			func(s string) io.Reader { return iotest.OneByteReader(strings.NewReader(s)) },
+		} {
+			dec := protojson.NewDecoder(r(tt.input))
+			var got []string
+			for {
+				m := &pb3.Scalars{}
+				err := dec.Decode(m)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("%s: Decode error: %v", tt.desc, err)
+				}
+				got = append(got, m.GetSString())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("%s: decoded %d messages, want %d", tt.desc, len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("%s: message %d = %q, want %q", tt.desc, i, got[i], tt.want[i])
+				}
+			}
+			if err := dec.Decode(&pb3.Scalars{}); err != io.EOF {
+				t.Errorf("%s: Decode after end = %v, want io.EOF", tt.desc, err)
+			}
+		}
+	}
+}
+
+func TestDecoderScalars(t *testing.T) {
+	dec := protojson.NewDecoder(strings.NewReader(`[1, "2",3]`))
+	for _, want := range []int64{1, 2, 3} {
+		m := &wrapperspb.Int64Value{}
+		if err := dec.Decode(m); err != nil {
+			t.Fatalf("Decode error: %v", err)
+		}
+		if m.GetValue() != want {
+			t.Errorf("Decode = %v, want %v", m.GetValue(), want)
+		}
+	}
+	if err := dec.Decode(&wrapperspb.Int64Value{}); err != io.EOF {
+		t.Errorf("Decode after end = %v, want io.EOF", err)
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	tests := []struct {
+		desc    string
+		input   string
+		opts    protojson.UnmarshalOptions
+		decoded int // number of messages decoded before the error
+		wantErr string
+	}{{
+		desc:    "missing comma",
+		input:   `[{} {}]`,
+		decoded: 1,
+		wantErr: "missing \",\"",
+	}, {
+		desc:    "trailing comma",
+		input:   `[{},]`,
+		decoded: 1,
+		wantErr: "after \",\"",
+	}, {
+		desc:    "unterminated array",
+		input:   `[{}`,
+		decoded: 1,
+		wantErr: "unexpected EOF",
+	}, {
+		desc:    "data after array",
+		input:   `[{}] {}`,
+		decoded: 1,
+		wantErr: "after the end of the array",
+	}, {
+		desc:    "unterminated object",
+		input:   `{} {"sString": "one"`,
+		decoded: 1,
+		wantErr: "unexpected EOF",
+	}, {
+		desc:    "unexpected character",
+		input:   `{}, {}`,
+		decoded: 1,
+		wantErr: "unexpected character ','",
+	}, {
+		desc:    "max depth",
+		input:   `{"sString": [[[[]]]]}`,
+		opts:    protojson.UnmarshalOptions{MaxDepth: 4},
+		wantErr: "maximum nesting depth of 4",
+	}, {
+		desc:    "default max depth",
+		input:   `{"sString": ` + strings.Repeat("[", 10000),
+		wantErr: "maximum nesting depth of 10000",
+	}, {
+		desc:    "max input size",
+		input:   `{} {"sString": "0123456789"}`,
+		opts:    protojson.UnmarshalOptions{MaxInputSize: 10},
+		decoded: 1,
+		wantErr: "maximum size of 10 bytes",
+	}}
+
+	for _, tt := range tests {
+		dec := protojson.NewDecoder(strings.NewReader(tt.input))
+		dec.Options = tt.opts
+		for i := 0; i < tt.decoded; i++ {
+			if err := dec.Decode(&pb3.Scalars{}); err != nil {
+				t.Fatalf("%s: Decode %d error: %v", tt.desc, i, err)
+			}
+		}
+		err := dec.Decode(&pb3.Scalars{})
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: Decode error = %v, want error containing %q", tt.desc, err, tt.wantErr)
+		}
+		if err2 := dec.Decode(&pb3.Scalars{}); err2 == nil || err2.Error() != err.Error() {
+			t.Errorf("%s: Decode after error = %v, want %v", tt.desc, err2, err)
+		}
+	}
+}
+
+func TestDecoderInvalidMessage(t *testing.T) {
+	dec := protojson.NewDecoder(strings.NewReader("{\"sString\": 1}\n{\"sString\": \"two\"}\n"))
+	dec.Options = protojson.UnmarshalOptions{DiscardUnknown: true}
+	if err := dec.Decode(&pb3.Scalars{}); err == nil {
+		t.Errorf("Decode of invalid message: got nil error, want error")
+	}
+	m := &pb3.Scalars{}
+	if err := dec.Decode(m); err != nil {
+		t.Fatalf("Decode after invalid message: %v", err)
+	}
+	if m.GetSString() != "two" {
+		t.Errorf("Decode after invalid message = %q, want %q", m.GetSString(), "two")
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protojson
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/internal/encoding/json"
+	"google.golang.org/protobuf/internal/errors"
+	"google.golang.org/protobuf/internal/genid"
+	"google.golang.org/protobuf/proto"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// The custom formatters below provide alternative representations of
+// google.protobuf.Timestamp and google.protobuf.Duration for interoperating
+// with JSON APIs that do not use the standard ones. They are used by adding
+// them to the Formatters of the options, for example:
+//
+//	fs := protojson.Formatters{
+//		"google.protobuf.Timestamp": protojson.Milliseconds,
+//		"google.protobuf.Duration":  protojson.GoDuration,
+//	}
+//	b, err := protojson.MarshalOptions{Formatters: fs}.Marshal(m)
+//
+// Unmarshal accepts the standard representation in addition to the custom one.
+
+// TimestampLayout is a CustomFormatter for google.protobuf.Timestamp that
+// represents a timestamp as a JSON string formatted in UTC with the layout,
+// as defined by the time package, such as time.RFC1123.
+type TimestampLayout string
+
+// Marshal implements CustomFormatter.
+func (l TimestampLayout) Marshal(o MarshalOptions, m proto.Message) ([]byte, error) {
+	secs, nanos, err := timeFields(m.ProtoReflect(), genid.Timestamp_message_fullname)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := marshalStandard(m.ProtoReflect()); err != nil {
+		return nil, err
+	}
+	e, _ := json.NewEncoder("")
+	if err := e.WriteString(time.Unix(secs, int64(nanos)).UTC().Format(string(l))); err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+// Unmarshal implements CustomFormatter.
+func (l TimestampLayout) Unmarshal(o UnmarshalOptions, b []byte, m proto.Message) error {
+	if _, _, err := timeFields(m.ProtoReflect(), genid.Timestamp_message_fullname); err != nil {
+		return err
+	}
+	tok, err := json.NewDecoder(b).Read()
+	if err != nil {
+		return err
+	}
+	if tok.Kind() != json.String {
+		return errors.New("invalid %v value %v", genid.Timestamp_message_fullname, tok.RawString())
+	}
+	t, err := time.Parse(string(l), tok.ParsedString())
+	if err != nil {
+		return unmarshalStandard(o, b, m.ProtoReflect())
+	}
+	secs := t.Unix()
+	if secs < minTimestampSeconds || secs > maxTimestampSeconds {
+		return errors.New("%v value out of range: %v", genid.Timestamp_message_fullname, tok.RawString())
+	}
+	setTimeFields(m.ProtoReflect(), secs, int32(t.Nanosecond()))
+	return nil
+}
+
+// Milliseconds is a CustomFormatter for google.protobuf.Timestamp and
+// google.protobuf.Duration that represents a timestamp as the number of
+// milliseconds since the Unix epoch, and a duration as a number of
+// milliseconds. The number is a JSON number with up to six fractional digits
+// for sub-millisecond precision, such as 1500 or 0.25.
+var Milliseconds CustomFormatter = millisecondsFormatter{}
+
+type millisecondsFormatter struct{}
+
+func (millisecondsFormatter) Marshal(o MarshalOptions, m proto.Message) ([]byte, error) {
+	secs, nanos, err := timeFields(m.ProtoReflect(), "")
+	if err != nil {
+		return nil, err
+	}
+	// Validate the fields as for the standard representation, so that they
+	// are within range and the signs of a Duration match.
+	if _, err := marshalStandard(m.ProtoReflect()); err != nil {
+		return nil, err
+	}
+	neg := secs < 0 || (secs == 0 && nanos < 0)
+	if neg {
+		if nanos > 0 {
+			secs, nanos = secs+1, nanos-1e9
+		}
+		secs, nanos = -secs, -nanos
+	}
+	ms := strconv.FormatInt(secs*1000+int64(nanos/1e6), 10)
+	if frac := nanos % 1e6; frac != 0 {
+		ms += strings.TrimRight(fmt.Sprintf(".%06d", frac), "0")
+	}
+	if neg {
+		ms = "-" + ms
+	}
+	return []byte(ms), nil
+}
+
+func (millisecondsFormatter) Unmarshal(o UnmarshalOptions, b []byte, m proto.Message) error {
+	if _, _, err := timeFields(m.ProtoReflect(), ""); err != nil {
+		return err
+	}
+	name := m.ProtoReflect().Descriptor().FullName()
+	tok, err := json.NewDecoder(b).Read()
+	if err != nil {
+		return err
+	}
+	if tok.Kind() == json.String {
+		return unmarshalStandard(o, b, m.ProtoReflect())
+	}
+	if tok.Kind() != json.Number {
+		return errors.New("invalid %v value %v", name, tok.RawString())
+	}
+	secs, nanos, ok := parseMilliseconds(tok.RawString())
+	if !ok {
+		return errors.New("invalid %v value %v", name, tok.RawString())
+	}
+	if name == genid.Timestamp_message_fullname {
+		if nanos < 0 {
+			secs, nanos = secs-1, nanos+1e9
+		}
+		if secs < minTimestampSeconds || secs > maxTimestampSeconds {
+			return errors.New("%v value out of range: %v", name, tok.RawString())
+		}
+	} else if secs < -maxSecondsInDuration || secs > maxSecondsInDuration {
+		return errors.New("%v value out of range: %v", name, tok.RawString())
+	}
+	setTimeFields(m.ProtoReflect(), secs, nanos)
+	return nil
+}
+
+// parseMilliseconds parses a JSON number of milliseconds with up to six
+// fractional digits into seconds and nanoseconds of the same sign.
+func parseMilliseconds(s string) (int64, int32, bool) {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	intp, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intp, frac = s[:i], s[i+1:]
+	}
+	if len(frac) > 6 || strings.Trim(frac, "0123456789") != "" {
+		return 0, 0, false
+	}
+	ms, err := strconv.ParseUint(intp, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	var fracNanos uint64
+	if frac != "" {
+		fracNanos, _ = strconv.ParseUint((frac + "00000")[:6], 10, 32)
+	}
+	secs := int64(ms / 1000)
+	nanos := int32((ms%1000)*1e6 + fracNanos)
+	if neg {
+		secs, nanos = -secs, -nanos
+	}
+	return secs, nanos, true
+}
+
+// GoDuration is a CustomFormatter for google.protobuf.Duration that
+// represents a duration as a JSON string in the format of time.Duration,
+// such as "1h30m0s". Unmarshal accepts any string accepted by
+// time.ParseDuration. Durations beyond the range of time.Duration,
+// about 292 years, cannot be marshaled.
+var GoDuration CustomFormatter = goDurationFormatter{}
+
+type goDurationFormatter struct{}
+
+func (goDurationFormatter) Marshal(o MarshalOptions, m proto.Message) ([]byte, error) {
+	secs, nanos, err := timeFields(m.ProtoReflect(), genid.Duration_message_fullname)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := marshalStandard(m.ProtoReflect()); err != nil {
+		return nil, err
+	}
+	const maxSecs = math.MaxInt64 / int64(time.Second)
+	if secs <= -maxSecs || secs >= maxSecs {
+		return nil, errors.New("%s: seconds %v exceed the range of time.Duration", genid.Duration_message_fullname, secs)
+	}
+	e, _ := json.NewEncoder("")
+	e.WriteString((time.Duration(secs)*time.Second + time.Duration(nanos)).String())
+	return e.Bytes(), nil
+}
+
+func (goDurationFormatter) Unmarshal(o UnmarshalOptions, b []byte, m proto.Message) error {
+	if _, _, err := timeFields(m.ProtoReflect(), genid.Duration_message_fullname); err != nil {
+		return err
+	}
+	tok, err := json.NewDecoder(b).Read()
+	if err != nil {
+		return err
+	}
+	if tok.Kind() != json.String {
+		return errors.New("invalid %v value %v", genid.Duration_message_fullname, tok.RawString())
+	}
+	d, err := time.ParseDuration(tok.ParsedString())
+	if err != nil {
+		// The standard representation allows durations that exceed the
+		// range of time.Duration.
+		return unmarshalStandard(o, b, m.ProtoReflect())
+	}
+	setTimeFields(m.ProtoReflect(), int64(d/time.Second), int32(d%time.Second))
+	return nil
+}
+
+// timeFields returns the seconds and nanos fields of m, which must be a
+// Timestamp or a Duration. If name is not empty, m must have that full name.
+func timeFields(m pref.Message, name pref.FullName) (int64, int32, error) {
+	switch got := m.Descriptor().FullName(); {
+	case name != "" && got != name,
+		got != genid.Timestamp_message_fullname && got != genid.Duration_message_fullname:
+		return 0, 0, errors.New("cannot format %v as a timestamp or duration", got)
+	}
+	// The seconds and nanos fields have the same numbers in both types.
+	fds := m.Descriptor().Fields()
+	secs := m.Get(fds.ByNumber(genid.Timestamp_Seconds_field_number)).Int()
+	nanos := m.Get(fds.ByNumber(genid.Timestamp_Nanos_field_number)).Int()
+	return secs, int32(nanos), nil
+}
+
+// setTimeFields sets the seconds and nanos fields of the Timestamp or
+// Duration m.
+func setTimeFields(m pref.Message, secs int64, nanos int32) {
+	fds := m.Descriptor().Fields()
+	m.Set(fds.ByNumber(genid.Timestamp_Seconds_field_number), pref.ValueOfInt64(secs))
+	m.Set(fds.ByNumber(genid.Timestamp_Nanos_field_number), pref.ValueOfInt32(nanos))
+}
+
+// marshalStandard returns the standard representation of the Timestamp or
+// Duration m.
+func marshalStandard(m pref.Message) ([]byte, error) {
+	e, _ := json.NewEncoder("")
+	if err := wellKnownTypeMarshaler(m.Descriptor().FullName())(encoder{Encoder: e}, m); err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+// unmarshalStandard parses the JSON value b as the standard representation
+// of the Timestamp or Duration m.
+func unmarshalStandard(o UnmarshalOptions, b []byte, m pref.Message) error {
+	d := decoder{json.NewDecoder(b), o}
+	if err := wellKnownTypeUnmarshaler(m.Descriptor().FullName())(d, m); err != nil {
+		return errors.New("invalid %v value %s", m.Descriptor().FullName(), b)
+	}
+	return nil
+}
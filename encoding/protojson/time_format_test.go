@@ -0,0 +1,161 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protojson_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	pb2 "google.golang.org/protobuf/internal/testprotos/textpb2"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestTimeFormatters(t *testing.T) {
+	tests := []struct {
+		desc    string
+		fs      protojson.Formatters
+		input   proto.Message
+		want    string
+		wantErr string // marshal error
+	}{{
+		desc:  "TimestampLayout",
+		fs:    protojson.Formatters{"google.protobuf.Timestamp": protojson.TimestampLayout(time.RFC1123)},
+		input: &pb2.KnownTypes{OptTimestamp: &timestamppb.Timestamp{Seconds: 1257894000}},
+		want:  `{"optTimestamp":"Tue, 10 Nov 2009 23:00:00 UTC"}`,
+	}, {
+		desc:    "TimestampLayout out of range",
+		fs:      protojson.Formatters{"google.protobuf.Timestamp": protojson.TimestampLayout(time.RFC1123)},
+		input:   &timestamppb.Timestamp{Seconds: 1257894000, Nanos: -1},
+		wantErr: "nanos out of range",
+	}, {
+		desc: "Milliseconds",
+		fs: protojson.Formatters{
+			"google.protobuf.Timestamp": protojson.Milliseconds,
+			"google.protobuf.Duration":  protojson.Milliseconds,
+		},
+		input: &pb2.KnownTypes{
+			OptTimestamp: &timestamppb.Timestamp{Seconds: 1257894000, Nanos: 1500000},
+			OptDuration:  &durationpb.Duration{Seconds: 90},
+		},
+		want: `{"optDuration":90000,"optTimestamp":1257894000001.5}`,
+	}, {
+		desc:  "Milliseconds before epoch",
+		fs:    protojson.Formatters{"google.protobuf.Timestamp": protojson.Milliseconds},
+		input: &timestamppb.Timestamp{Seconds: -1, Nanos: 1000},
+		want:  `-999.999`,
+	}, {
+		desc:  "Milliseconds negative duration",
+		fs:    protojson.Formatters{"google.protobuf.Duration": protojson.Milliseconds},
+		input: &durationpb.Duration{Seconds: -2, Nanos: -250000},
+		want:  `-2000.25`,
+	}, {
+		desc:    "Milliseconds mismatched signs",
+		fs:      protojson.Formatters{"google.protobuf.Duration": protojson.Milliseconds},
+		input:   &durationpb.Duration{Seconds: 1, Nanos: -1},
+		wantErr: "signs of seconds and nanos do not match",
+	}, {
+		desc:  "GoDuration",
+		fs:    protojson.Formatters{"google.protobuf.Duration": protojson.GoDuration},
+		input: &pb2.KnownTypes{OptDuration: &durationpb.Duration{Seconds: 5400, Nanos: 5000}},
+		want:  `{"optDuration":"1h30m0.000005s"}`,
+	}, {
+		desc:    "GoDuration out of range",
+		fs:      protojson.Formatters{"google.protobuf.Duration": protojson.GoDuration},
+		input:   &durationpb.Duration{Seconds: 315576000000},
+		wantErr: "exceed the range of time.Duration",
+	}, {
+		desc:    "wrong type",
+		fs:      protojson.Formatters{"google.protobuf.Duration": protojson.TimestampLayout(time.RFC1123)},
+		input:   &durationpb.Duration{},
+		wantErr: "cannot format google.protobuf.Duration",
+	}}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.desc, func(t *testing.T) {
+			b, err := protojson.MarshalOptions{Formatters: tt.fs, Canonical: true, SortKeys: true}.Marshal(tt.input)
+			if err != nil {
+				if tt.wantErr == "" || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Marshal() error: %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if tt.wantErr != "" {
+				t.Fatalf("Marshal() got nil error, want %q", tt.wantErr)
+			}
+			if string(b) != tt.want {
+				t.Errorf("Marshal():\ngot:  %s\nwant: %s", b, tt.want)
+			}
+			got := tt.input.ProtoReflect().New().Interface()
+			if err := (protojson.UnmarshalOptions{Formatters: tt.fs}).Unmarshal(b, got); err != nil {
+				t.Fatalf("Unmarshal() error: %v", err)
+			}
+			if !proto.Equal(got, tt.input) {
+				t.Errorf("Unmarshal() round trip:\ngot:  %v\nwant: %v", got, tt.input)
+			}
+		})
+	}
+}
+
+func TestTimeFormattersUnmarshal(t *testing.T) {
+	fs := protojson.Formatters{
+		"google.protobuf.Timestamp": protojson.Milliseconds,
+		"google.protobuf.Duration":  protojson.GoDuration,
+	}
+	tests := []struct {
+		input   string
+		want    proto.Message
+		wantErr string
+	}{{
+		input: `{"optTimestamp": -1.5, "optDuration": "-1m30s"}`,
+		want: &pb2.KnownTypes{
+			OptTimestamp: &timestamppb.Timestamp{Seconds: -1, Nanos: 998500000},
+			OptDuration:  &durationpb.Duration{Seconds: -90},
+		},
+	}, {
+		input: `{"optTimestamp": "2009-11-10T23:00:00Z", "optDuration": "315576000000s"}`,
+		want: &pb2.KnownTypes{
+			OptTimestamp: &timestamppb.Timestamp{Seconds: 1257894000},
+			OptDuration:  &durationpb.Duration{Seconds: 315576000000},
+		},
+	}, {
+		input:   `{"optTimestamp": 1.0000001}`,
+		wantErr: "invalid google.protobuf.Timestamp value 1.0000001",
+	}, {
+		input:   `{"optTimestamp": 1e3}`,
+		wantErr: "invalid google.protobuf.Timestamp value 1e3",
+	}, {
+		input:   `{"optTimestamp": 253402300800000}`,
+		wantErr: "google.protobuf.Timestamp value out of range",
+	}, {
+		input:   `{"optDuration": "1 hour"}`,
+		wantErr: `invalid google.protobuf.Duration value "1 hour"`,
+	}, {
+		input:   `{"optDuration": 5}`,
+		wantErr: "invalid google.protobuf.Duration value 5",
+	}}
+
+	for _, tt := range tests {
+		got := &pb2.KnownTypes{}
+		err := protojson.UnmarshalOptions{Formatters: fs}.Unmarshal([]byte(tt.input), got)
+		if err != nil {
+			if tt.wantErr == "" || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Unmarshal(%s) error: %v, want %q", tt.input, err, tt.wantErr)
+			}
+			continue
+		}
+		if tt.wantErr != "" {
+			t.Errorf("Unmarshal(%s) got nil error, want %q", tt.input, tt.wantErr)
+			continue
+		}
+		if !proto.Equal(got, tt.want) {
+			t.Errorf("Unmarshal(%s):\ngot:  %v\nwant: %v", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protojson
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/internal/encoding/json"
+	"google.golang.org/protobuf/internal/errors"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// preservedUnknownNumber is the field number used to store unknown JSON
+// object members in the unknown fields of a message.
+// The value of the field is a JSON object containing the single member.
+const preservedUnknownNumber protowire.Number = 19999
+
+// preserveUnknownMember reads the value of the unknown member with the
+// name token tok and stores the member in the unknown fields of m.
+func (d decoder) preserveUnknownMember(m pref.Message, tok json.Token) error {
+	e, _ := json.NewEncoder("")
+	e.StartObject()
+	e.WriteName(tok.Name())
+	if err := copyJSONValue(e, d.Decoder); err != nil {
+		return err
+	}
+	e.EndObject()
+
+	b := m.GetUnknown()
+	b = protowire.AppendTag(b, preservedUnknownNumber, protowire.BytesType)
+	b = protowire.AppendBytes(b, e.Bytes())
+	m.SetUnknown(b)
+	return nil
+}
+
+// marshalPreservedUnknown marshals the JSON object members stored in the
+// unknown fields of m by UnmarshalOptions.PreserveUnknown.
+// Unknown fields which are not such members, or which cannot be parsed,
+// are skipped, as are members with the same name as a known field of m
+// so that the output does not contain duplicate names.
+func (e encoder) marshalPreservedUnknown(m pref.Message) error {
+	var names map[string]bool
+	b := m.GetUnknown()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil
+		}
+		b = b[n:]
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return nil
+		}
+		v := b[:n]
+		b = b[n:]
+		if num != preservedUnknownNumber || typ != protowire.BytesType {
+			continue
+		}
+		v, _ = protowire.ConsumeBytes(v)
+		name, ok := parsePreservedMember(v)
+		if !ok {
+			continue
+		}
+		if names == nil {
+			names = e.knownNames(m.Descriptor())
+		}
+		if names[name] || e.isKnownExtension(m.Descriptor(), name) {
+			continue
+		}
+		if err := e.WriteName(name); err != nil {
+			return err
+		}
+		d := json.NewDecoder(v)
+		d.Read() // {
+		d.Read() // name
+		if err := copyJSONValue(e.Encoder, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parsePreservedMember reports whether b is a JSON object with a single
+// member, as stored by preserveUnknownMember, and returns its name.
+func parsePreservedMember(b []byte) (name string, ok bool) {
+	d := json.NewDecoder(b)
+	if tok, err := d.Read(); err != nil || tok.Kind() != json.ObjectOpen {
+		return "", false
+	}
+	tok, err := d.Read()
+	if err != nil || tok.Kind() != json.Name {
+		return "", false
+	}
+	// Check that the value can be copied by encoding it to a scratch encoder.
+	e, _ := json.NewEncoder("")
+	e.StartObject()
+	if err := e.WriteName(tok.Name()); err != nil {
+		return "", false
+	}
+	if err := copyJSONValue(e, d); err != nil {
+		return "", false
+	}
+	for _, want := range []json.Kind{json.ObjectClose, json.EOF} {
+		if tok, err := d.Read(); err != nil || tok.Kind() != want {
+			return "", false
+		}
+	}
+	return tok.Name(), true
+}
+
+// knownNames returns the names of the fields of md, in each of the forms
+// accepted by Unmarshal and in the form emitted with the current options.
+func (e encoder) knownNames(md pref.MessageDescriptor) map[string]bool {
+	fds := md.Fields()
+	names := make(map[string]bool, 2*fds.Len())
+	for i := 0; i < fds.Len(); i++ {
+		fd := fds.Get(i)
+		names[fd.JSONName()] = true
+		names[string(fd.Name())] = true
+		if fd.Kind() == pref.GroupKind {
+			names[string(fd.Message().Name())] = true
+		}
+		if e.opts.FieldNameFunc != nil {
+			names[e.opts.FieldNameFunc(fd)] = true
+		}
+	}
+	return names
+}
+
+// isKnownExtension reports whether name is the bracketed full name
+// of an extension of md.
+func (e encoder) isKnownExtension(md pref.MessageDescriptor, name string) bool {
+	if !strings.HasPrefix(name, "[") || !strings.HasSuffix(name, "]") {
+		return false
+	}
+	xt, err := e.opts.Resolver.FindExtensionByName(pref.FullName(name[1 : len(name)-1]))
+	return err == nil && xt.TypeDescriptor().ContainingMessage().FullName() == md.FullName()
+}
+
+// copyJSONValue reads the next JSON value from d and writes it to e.
+func copyJSONValue(e *json.Encoder, d *json.Decoder) error {
+	tok, err := d.Read()
+	if err != nil {
+		return err
+	}
+	switch tok.Kind() {
+	case json.Null:
+		e.WriteNull()
+	case json.Bool:
+		e.WriteBool(tok.Bool())
+	case json.Number:
+		e.WriteNumber(tok.RawString())
+	case json.String:
+		if err := e.WriteString(tok.ParsedString()); err != nil {
+			return err
+		}
+	case json.ObjectOpen:
+		e.StartObject()
+		for {
+			tok, err := d.Read()
+			if err != nil {
+				return err
+			}
+			switch tok.Kind() {
+			case json.ObjectClose:
+				e.EndObject()
+				return nil
+			case json.Name:
+				if err := e.WriteName(tok.Name()); err != nil {
+					return err
+				}
+				if err := copyJSONValue(e, d); err != nil {
+					return err
+				}
+			default:
+				return errors.New("unexpected token %s", tok.RawString())
+			}
+		}
+	case json.ArrayOpen:
+		e.StartArray()
+		for {
+			tok, err := d.Peek()
+			if err != nil {
+				return err
+			}
+			if tok.Kind() == json.ArrayClose {
+				d.Read()
+				e.EndArray()
+				return nil
+			}
+			if err := copyJSONValue(e, d); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.New("unexpected token %s", tok.RawString())
+	}
+	return nil
+}
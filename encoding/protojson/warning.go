@@ -0,0 +1,75 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protojson
+
+import (
+	"fmt"
+
+	pref "google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Warning is a non-fatal issue encountered by Marshal or Unmarshal,
+// such as a conversion that loses information. Warnings are reported to
+// the WarningHandler of the options in use.
+//
+// The following are reported as warnings:
+//   - Unmarshal: an unknown field that is discarded due to DiscardUnknown.
+//   - Unmarshal: an unknown enum value name that is tolerated due to
+//     UnknownEnums.
+//   - Marshal: a 64-bit integer emitted as a JSON number due to
+//     UseInt64Numbers whose magnitude exceeds 2^53, so that it cannot be
+//     represented exactly by consumers that parse JSON numbers as
+//     IEEE 754 doubles.
+//
+// Timestamp and Duration values are never truncated; input with more than
+// nine fractional digits is rejected instead.
+type Warning struct {
+	// Field is the field the warning is about, if any.
+	Field pref.FieldDescriptor
+
+	// Line and Column are the position in the input that the warning
+	// is about, for warnings reported by Unmarshal. They are zero otherwise.
+	Line, Column int
+
+	// Message describes the issue.
+	Message string
+}
+
+func (w Warning) String() string {
+	if w.Line > 0 {
+		return fmt.Sprintf("(line %d:%d): %s", w.Line, w.Column, w.Message)
+	}
+	return w.Message
+}
+
+// maxExactInt is the largest magnitude of an integer that can be represented
+// exactly by an IEEE 754 double, as well as all integers of lower magnitude.
+const maxExactInt = 1 << 53
+
+// warn reports a warning about the value at the given position in the input,
+// if there is a WarningHandler.
+func (d decoder) warn(pos int, fd pref.FieldDescriptor, f string, x ...interface{}) {
+	if d.opts.WarningHandler == nil {
+		return
+	}
+	line, column := d.Position(pos)
+	d.opts.WarningHandler(Warning{
+		Field:   fd,
+		Line:    line,
+		Column:  column,
+		Message: fmt.Sprintf(f, x...),
+	})
+}
+
+// warn reports a warning if there is a WarningHandler.
+func (e encoder) warn(fd pref.FieldDescriptor, f string, x ...interface{}) {
+	if e.opts.WarningHandler == nil {
+		return
+	}
+	e.opts.WarningHandler(Warning{
+		Field:   fd,
+		Message: fmt.Sprintf(f, x...),
+	})
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protojson_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	pb3 "google.golang.org/protobuf/internal/testprotos/textpb3"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestUnmarshalWarnings(t *testing.T) {
+	tests := []struct {
+		desc  string
+		umo   protojson.UnmarshalOptions
+		input string
+		m     proto.Message
+		want  []string
+	}{{
+		desc:  "no warnings",
+		umo:   protojson.UnmarshalOptions{DiscardUnknown: true},
+		input: `{"sString": "hello"}`,
+		m:     &pb3.Scalars{},
+	}, {
+		desc:  "discarded unknown fields",
+		umo:   protojson.UnmarshalOptions{DiscardUnknown: true},
+		input: `{"foo": 1, "sNested": {"bar": {"baz": 2}}}`,
+		m:     &pb3.Nests{},
+		want: []string{
+			`(line 1:2): discarded unknown field "foo"`,
+			`(line 1:24): discarded unknown field "bar"`,
+		},
+	}, {
+		desc:  "preserved unknown fields",
+		umo:   protojson.UnmarshalOptions{PreserveUnknown: true},
+		input: `{"foo": 1}`,
+		m:     &pb3.Nests{},
+	}, {
+		desc:  "discarded unknown field in Empty",
+		umo:   protojson.UnmarshalOptions{DiscardUnknown: true},
+		input: `{"foo": 1}`,
+		m:     &emptypb.Empty{},
+		want:  []string{`(line 1:2): discarded unknown field "foo"`},
+	}, {
+		desc:  "discarded unknown fields in Any",
+		umo:   protojson.UnmarshalOptions{DiscardUnknown: true},
+		input: `{"@type": "type.googleapis.com/google.protobuf.Empty", "value": {}, "foo": 1}`,
+		m:     &anypb.Any{},
+		want:  []string{`(line 1:69): discarded unknown field "foo"`},
+	}, {
+		desc:  "discarded Any without type",
+		umo:   protojson.UnmarshalOptions{DiscardUnknown: true},
+		input: `{"foo": 1}`,
+		m:     &anypb.Any{},
+		want:  []string{`(line 1:1): discarded google.protobuf.Any without "@type" field`},
+	}, {
+		desc:  "unknown enum values",
+		umo:   protojson.UnmarshalOptions{UnknownEnums: protojson.UnknownEnumZero},
+		input: `{"sEnum": "FOUR"}`,
+		m:     &pb3.Enums{},
+		want:  []string{`(line 1:11): replaced unknown pb3.Enum value "FOUR" with the default`},
+	}, {
+		desc:  "skipped enum values",
+		umo:   protojson.UnmarshalOptions{UnknownEnums: protojson.UnknownEnumSkip},
+		input: `{"sEnum": "FOUR"}`,
+		m:     &pb3.Enums{},
+		want:  []string{`(line 1:11): skipped unknown pb3.Enum value "FOUR"`},
+	}}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.desc, func(t *testing.T) {
+			var got []string
+			tt.umo.WarningHandler = func(w protojson.Warning) {
+				got = append(got, w.String())
+			}
+			if err := tt.umo.Unmarshal([]byte(tt.input), tt.m); err != nil {
+				t.Fatalf("Unmarshal() error: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Unmarshal() warnings mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestMarshalWarnings(t *testing.T) {
+	m := &pb3.Scalars{
+		SInt64:    1 << 53,
+		SSint64:   -1<<53 - 1,
+		SUint64:   math.MaxUint64,
+		SFixed64:  1<<53 + 1,
+		SSfixed64: math.MinInt64,
+	}
+	want := []string{
+		"pb3.Scalars.s_uint64 value 18446744073709551615 is not exactly representable as a double",
+		"pb3.Scalars.s_sint64 value -9007199254740993 is not exactly representable as a double",
+		"pb3.Scalars.s_fixed64 value 9007199254740993 is not exactly representable as a double",
+		"pb3.Scalars.s_sfixed64 value -9223372036854775808 is not exactly representable as a double",
+	}
+	for _, mo := range []protojson.MarshalOptions{{}, {UseInt64Numbers: true}} {
+		var got []string
+		var gotFields []string
+		mo.WarningHandler = func(w protojson.Warning) {
+			got = append(got, w.String())
+			gotFields = append(gotFields, string(w.Field.Name()))
+		}
+		if _, err := mo.Marshal(m); err != nil {
+			t.Fatalf("Marshal() error: %v", err)
+		}
+		if !mo.UseInt64Numbers {
+			if len(got) > 0 {
+				t.Errorf("Marshal() without UseInt64Numbers reported warnings: %v", got)
+			}
+			continue
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Marshal() warnings mismatch (-want +got):\n%v", diff)
+		}
+		if diff := cmp.Diff([]string{"s_uint64", "s_sint64", "s_fixed64", "s_sfixed64"}, gotFields); diff != "" {
+			t.Errorf("Marshal() warning fields mismatch (-want +got):\n%v", diff)
+		}
+	}
+}
@@ -132,7 +132,7 @@ func (e encoder) marshalAny(m pref.Message) error {
 	}
 
 	// Resolve the type in order to unmarshal value field.
-	emt, err := e.opts.Resolver.FindMessageByURL(typeURL)
+	emt, err := findMessageByURL(e.opts.ctx, e.opts.Resolver, e.opts.Fetcher, typeURL)
 	if err != nil {
 		return errors.New("%s: unable to resolve %q: %v", genid.Any_message_fullname, typeURL, err)
 	}
@@ -149,7 +149,7 @@ func (e encoder) marshalAny(m pref.Message) error {
 	// If type of value has custom JSON encoding, marshal out a field "value"
 	// with corresponding custom JSON encoding of the embedded message as a
 	// field.
-	if marshal := wellKnownTypeMarshaler(emt.Descriptor().FullName()); marshal != nil {
+	if marshal := e.messageMarshaler(em); marshal != nil {
 		e.WriteName("value")
 		return marshal(e, em)
 	}
@@ -187,6 +187,7 @@ func (d decoder) unmarshalAny(m pref.Message) error {
 	case errMissingType:
 		if d.opts.DiscardUnknown {
 			// Treat all fields as unknowns, similar to an empty object.
+			d.warn(start.Pos(), nil, `discarded %v without "@type" field`, genid.Any_message_fullname)
 			return d.skipJSONValue()
 		}
 		// Use start.Pos() for line position.
@@ -199,14 +200,14 @@ func (d decoder) unmarshalAny(m pref.Message) error {
 	}
 
 	typeURL := tok.ParsedString()
-	emt, err := d.opts.Resolver.FindMessageByURL(typeURL)
+	emt, err := findMessageByURL(d.opts.ctx, d.opts.Resolver, d.opts.Fetcher, typeURL)
 	if err != nil {
 		return d.newError(tok.Pos(), "unable to resolve %v: %q", tok.RawString(), err)
 	}
 
 	// Create new message for the embedded message type and unmarshal into it.
 	em := emt.New()
-	if unmarshal := wellKnownTypeUnmarshaler(emt.Descriptor().FullName()); unmarshal != nil {
+	if unmarshal := d.messageUnmarshaler(em); unmarshal != nil {
 		// If embedded message is a custom type,
 		// unmarshal the JSON "value" field into it.
 		if err := d.unmarshalAnyValue(unmarshal, em); err != nil {
@@ -314,6 +315,7 @@ func (d decoder) skipJSONValue() error {
 	// Only need to continue reading for objects and arrays.
 	switch tok.Kind() {
 	case json.ObjectOpen:
+		var seen nameSet
 		for {
 			tok, err := d.Read()
 			if err != nil {
@@ -323,6 +325,9 @@ func (d decoder) skipJSONValue() error {
 			case json.ObjectClose:
 				return nil
 			case json.Name:
+				if err := d.checkDuplicateName(&seen, tok); err != nil {
+					return err
+				}
 				// Skip object field value.
 				if err := d.skipJSONValue(); err != nil {
 					return err
@@ -358,6 +363,7 @@ func (d decoder) unmarshalAnyValue(unmarshal unmarshalFunc, m pref.Message) erro
 	d.Read()
 
 	var found bool // Used for detecting duplicate "value".
+	var seen nameSet
 	for {
 		tok, err := d.Read()
 		if err != nil {
@@ -378,22 +384,26 @@ func (d decoder) unmarshalAnyValue(unmarshal unmarshalFunc, m pref.Message) erro
 
 			case "value":
 				if found {
-					return d.newError(tok.Pos(), `duplicate "value" field`)
+					return wrapPath(d.newError(tok.Pos(), `duplicate "value" field`), "value")
 				}
 				// Unmarshal the field value into the given message.
 				if err := unmarshal(d, m); err != nil {
-					return err
+					return wrapPath(err, "value")
 				}
 				found = true
 
 			default:
+				if err := d.checkDuplicateName(&seen, tok); err != nil {
+					return wrapPath(err, tok.Name())
+				}
 				if d.opts.DiscardUnknown {
+					d.warn(tok.Pos(), nil, "discarded unknown field %v", tok.RawString())
 					if err := d.skipJSONValue(); err != nil {
-						return err
+						return wrapPath(err, tok.Name())
 					}
 					continue
 				}
-				return d.newError(tok.Pos(), "unknown field %v", tok.RawString())
+				return wrapPath(d.newError(tok.Pos(), "unknown field %v", tok.RawString()), tok.Name())
 			}
 		}
 	}
@@ -434,6 +444,7 @@ func (d decoder) unmarshalEmpty(pref.Message) error {
 		return d.unexpectedTokenError(tok)
 	}
 
+	var seen nameSet
 	for {
 		tok, err := d.Read()
 		if err != nil {
@@ -444,7 +455,11 @@ func (d decoder) unmarshalEmpty(pref.Message) error {
 			return nil
 
 		case json.Name:
+			if err := d.checkDuplicateName(&seen, tok); err != nil {
+				return err
+			}
 			if d.opts.DiscardUnknown {
+				d.warn(tok.Pos(), nil, "discarded unknown field %v", tok.RawString())
 				if err := d.skipJSONValue(); err != nil {
 					return err
 				}
@@ -495,6 +510,12 @@ func (e encoder) marshalKnownValue(m pref.Message) error {
 	if fd == nil {
 		return errors.New("%s: none of the oneof fields is set", genid.Value_message_fullname)
 	}
+	if e.opts.Int64StructNumbers && fd.Number() == genid.Value_StructValue_field_number {
+		if s, ok := taggedIntegerString(m.Get(fd).Message()); ok {
+			e.WriteNumber(s)
+			return nil
+		}
+	}
 	return e.marshalSingular(m.Get(fd), fd)
 }
 
@@ -525,6 +546,13 @@ func (d decoder) unmarshalKnownValue(m pref.Message) error {
 		if err != nil {
 			return err
 		}
+		if d.opts.Int64StructNumbers {
+			fd = m.Descriptor().Fields().ByNumber(genid.Value_StructValue_field_number)
+			if v, ok := taggedInteger(m.NewField(fd), tok); ok {
+				m.Set(fd, v)
+				return nil
+			}
+		}
 		fd = m.Descriptor().Fields().ByNumber(genid.Value_NumberValue_field_number)
 		var ok bool
 		val, ok = unmarshalFloat(tok, 64)
@@ -568,6 +596,64 @@ func (d decoder) unmarshalKnownValue(m pref.Message) error {
 	return nil
 }
 
+// The names of the single member of the Struct that represents an integer
+// in a Value for Int64StructNumbers.
+const (
+	int64StructName  = "@int64"
+	uint64StructName = "@uint64"
+)
+
+// taggedInteger sets the Struct v to the tagged representation of the integer
+// tok, if it cannot be represented exactly by a double.
+func taggedInteger(v pref.Value, tok json.Token) (pref.Value, bool) {
+	var name, s string
+	if n, ok := tok.Int(64); ok {
+		if -maxExactInt <= n && n <= maxExactInt {
+			return pref.Value{}, false
+		}
+		name, s = int64StructName, strconv.FormatInt(n, 10)
+	} else if n, ok := tok.Uint(64); ok {
+		name, s = uint64StructName, strconv.FormatUint(n, 10)
+	} else {
+		return pref.Value{}, false
+	}
+	m := v.Message()
+	mmap := m.Mutable(m.Descriptor().Fields().ByNumber(genid.Struct_Fields_field_number)).Map()
+	mval := mmap.NewValue()
+	mval.Message().Set(mval.Message().Descriptor().Fields().ByNumber(genid.Value_StringValue_field_number), pref.ValueOfString(s))
+	mmap.Set(pref.ValueOfString(name).MapKey(), mval)
+	return v, true
+}
+
+// taggedIntegerString returns the decimal representation of the integer that
+// the Struct m represents, if it is in the form produced by taggedInteger.
+func taggedIntegerString(m pref.Message) (string, bool) {
+	mmap := m.Get(m.Descriptor().Fields().ByNumber(genid.Struct_Fields_field_number)).Map()
+	if mmap.Len() != 1 {
+		return "", false
+	}
+	for _, name := range []string{int64StructName, uint64StructName} {
+		k := pref.ValueOfString(name).MapKey()
+		if !mmap.Has(k) {
+			continue
+		}
+		vm := mmap.Get(k).Message()
+		fd := vm.Descriptor().Fields().ByNumber(genid.Value_StringValue_field_number)
+		if vm.WhichOneof(fd.ContainingOneof()) != fd {
+			return "", false
+		}
+		s := vm.Get(fd).String()
+		var err error
+		if name == int64StructName {
+			_, err = strconv.ParseInt(s, 10, 64)
+		} else {
+			_, err = strconv.ParseUint(s, 10, 64)
+		}
+		return s, err == nil
+	}
+	return "", false
+}
+
 // The JSON representation for a Duration is a JSON string that ends in the
 // suffix "s" (indicating seconds) and is preceded by the number of seconds,
 // with nanoseconds expressed as fractional seconds.
@@ -811,8 +897,9 @@ func (d decoder) unmarshalTimestamp(m pref.Message) error {
 		return d.unexpectedTokenError(tok)
 	}
 
-	t, err := time.Parse(time.RFC3339Nano, tok.ParsedString())
-	if err != nil {
+	s := tok.ParsedString()
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil || fractionalDigits(s) > 9 {
 		return d.newError(tok.Pos(), "invalid %v value %v", genid.Timestamp_message_fullname, tok.RawString())
 	}
 	// Validate seconds. No need to validate nanos because time.Parse would have
@@ -831,6 +918,24 @@ func (d decoder) unmarshalTimestamp(m pref.Message) error {
 	return nil
 }
 
+// fractionalDigits returns the number of fractional second digits in the
+// RFC 3339 timestamp s. Recent versions of time.Parse accept more than nine
+// digits and silently truncate the excess.
+func fractionalDigits(s string) int {
+	i := strings.IndexByte(s, '.')
+	if i < 0 {
+		return 0
+	}
+	n := 0
+	for _, c := range s[i+1:] {
+		if c < '0' || c > '9' {
+			break
+		}
+		n++
+	}
+	return n
+}
+
 // The JSON representation for a FieldMask is a JSON string where paths are
 // separated by a comma. Fields name in each path are converted to/from
 // lower-camel naming conventions. Encoding should fail if the path name would
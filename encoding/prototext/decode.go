@@ -5,10 +5,13 @@
 package prototext
 
 import (
+	"context"
 	"fmt"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/internal/encoding/messageset"
 	"google.golang.org/protobuf/internal/encoding/text"
 	"google.golang.org/protobuf/internal/errors"
@@ -42,6 +45,32 @@ type UnmarshalOptions struct {
 	// By default, unmarshal rejects unknown fields as an error.
 	DiscardUnknown bool
 
+	// Strict specifies whether to reject every field name that does not
+	// resolve to a field of the message, including reserved names, which are
+	// otherwise ignored. The error for an unknown field suggests the closest
+	// field names of the message, matching against both the field names and
+	// their JSON names. If Strict is set, DiscardUnknown is ignored.
+	// This is intended for parsing hand-written files where a misspelled
+	// field name is likely a mistake.
+	Strict bool
+
+	// AllErrors specifies whether to report all errors in the input rather
+	// than only the first one. If set, Unmarshal continues after errors such
+	// as unknown fields and invalid values, and returns a ParseErrors
+	// holding every error found. Parsing stops at the first syntax error.
+	AllErrors bool
+
+	// AllowFieldNumbers specifies whether to accept fields identified by
+	// field number, such as those written by MarshalOptions.EmitUnknownRaw.
+	// The value of such a field is converted to wire bytes: a message value
+	// becomes a length-delimited field whose fields must also be identified by
+	// number, a string becomes a length-delimited field, a hexadecimal literal
+	// of exactly 8 or 16 digits becomes a fixed32 or fixed64 field, and any
+	// other integer becomes a varint field. The wire bytes are then merged
+	// into the message, populating any known fields with those numbers and
+	// retaining the rest as unknown fields.
+	AllowFieldNumbers bool
+
 	// Resolver is used for looking up types when unmarshaling
 	// google.protobuf.Any messages or extension fields.
 	// If nil, this defaults to using protoregistry.GlobalTypes.
@@ -49,6 +78,22 @@ type UnmarshalOptions struct {
 		protoregistry.MessageTypeResolver
 		protoregistry.ExtensionTypeResolver
 	}
+
+	// Fetcher, if non-nil, is used for looking up the types of
+	// google.protobuf.Any messages that are not found by the Resolver.
+	Fetcher MessageTypeFetcher
+
+	// Opener, if non-nil, enables include directives, which are comment lines
+	// of the form "# proto-include: path" outside of any message value.
+	// Opener is called with the path of each included file and returns its
+	// contents, which are unmarshaled into a message of the same type.
+	// The included messages are merged in the order of the directives,
+	// followed by the fields of the including file, as if by proto.Merge,
+	// so that later files override the singular fields set by earlier ones.
+	// If Opener is nil, include directives are ignored as comments.
+	Opener func(path string) ([]byte, error)
+
+	ctx context.Context // set by UnmarshalContext
 }
 
 // Unmarshal reads the given []byte and populates the given proto.Message using options in
@@ -57,6 +102,12 @@ func (o UnmarshalOptions) Unmarshal(b []byte, m proto.Message) error {
 	return o.unmarshal(b, m)
 }
 
+// UnmarshalContext is like Unmarshal, but passes ctx to the Fetcher.
+func (o UnmarshalOptions) UnmarshalContext(ctx context.Context, b []byte, m proto.Message) error {
+	o.ctx = ctx
+	return o.unmarshal(b, m)
+}
+
 // unmarshal is a centralized function that all unmarshal operations go through.
 // For profiling purposes, avoid changing the name of this function or
 // introducing other code paths for unmarshal that do not go through this.
@@ -67,8 +118,13 @@ func (o UnmarshalOptions) unmarshal(b []byte, m proto.Message) error {
 		o.Resolver = protoregistry.GlobalTypes
 	}
 
-	dec := decoder{text.NewDecoder(b), o}
-	if err := dec.unmarshalMessage(m.ProtoReflect(), false); err != nil {
+	var err error
+	if o.Opener != nil {
+		err = o.unmarshalWithIncludes(b, m.ProtoReflect(), nil)
+	} else {
+		err = o.unmarshalText(b, m.ProtoReflect())
+	}
+	if err != nil {
 		return err
 	}
 	if o.AllowPartial {
@@ -77,16 +133,64 @@ func (o UnmarshalOptions) unmarshal(b []byte, m proto.Message) error {
 	return proto.CheckInitialized(m)
 }
 
+// unmarshalText unmarshals the textproto b into the empty message m.
+func (o UnmarshalOptions) unmarshalText(b []byte, m pref.Message) error {
+	dec := decoder{Decoder: text.NewDecoder(b), opts: o, in: b}
+	if o.AllErrors {
+		dec.errs = new(ParseErrors)
+	}
+	err := dec.unmarshalMessage(m, false)
+	if dec.errs != nil {
+		if err != nil {
+			dec.recover(dec.positionError(err))
+		}
+		if len(*dec.errs) > 0 {
+			return *dec.errs
+		}
+		return nil
+	}
+	return err
+}
+
 type decoder struct {
 	*text.Decoder
 	opts UnmarshalOptions
+	in   []byte
+
+	// errs holds the errors found so far if AllErrors is set.
+	errs *ParseErrors
 }
 
 // newError returns an error object with position info.
 func (d decoder) newError(pos int, f string, x ...interface{}) error {
 	line, column := d.Position(pos)
 	head := fmt.Sprintf("(line %d:%d): ", line, column)
-	return errors.New(head+f, x...)
+	return d.parseError(pos, errors.New(head+f, x...))
+}
+
+// parseError returns err as a *ParseError at the given position.
+func (d decoder) parseError(pos int, err error) *ParseError {
+	line, column := d.Position(pos)
+	return &ParseError{Line: line, Column: column, Token: tokenAt(d.in[pos:]), Err: err}
+}
+
+// positionError returns err as a *ParseError. Errors returned by the text
+// decoder are at the position of the unconsumed input.
+func (d decoder) positionError(err error) *ParseError {
+	if e, ok := err.(*ParseError); ok {
+		return e
+	}
+	return d.parseError(d.Offset(), err)
+}
+
+// recover records err, which must be a *ParseError, and reports whether
+// to continue parsing, which is the case if AllErrors is set.
+func (d decoder) recover(err error) bool {
+	if d.errs == nil {
+		return false
+	}
+	*d.errs = append(*d.errs, err.(*ParseError))
+	return true
 }
 
 // unexpectedTokenError returns a syntax error for the given unexpected token.
@@ -98,7 +202,7 @@ func (d decoder) unexpectedTokenError(tok text.Token) error {
 func (d decoder) syntaxError(pos int, f string, x ...interface{}) error {
 	line, column := d.Position(pos)
 	head := fmt.Sprintf("syntax error (line %d:%d): ", line, column)
-	return errors.New(head+f, x...)
+	return d.parseError(pos, errors.New(head+f, x...))
 }
 
 // unmarshalMessage unmarshals into the given protoreflect.Message.
@@ -125,6 +229,7 @@ func (d decoder) unmarshalMessage(m pref.Message, checkDelims bool) error {
 
 	var seenNums set.Ints
 	var seenOneofs set.Ints
+	var raw []byte
 	fieldDescs := messageDesc.Fields()
 
 	for {
@@ -140,14 +245,21 @@ func (d decoder) unmarshalMessage(m pref.Message, checkDelims bool) error {
 			if checkDelims {
 				return text.ErrUnexpectedEOF
 			}
-			return nil
+			return d.mergeRaw(m, raw)
 		default:
 			if checkDelims && typ == text.MessageClose {
-				return nil
+				return d.mergeRaw(m, raw)
 			}
 			return d.unexpectedTokenError(tok)
 		}
 
+		if d.opts.AllowFieldNumbers && tok.NameKind() == text.FieldNumber {
+			if raw, err = d.appendRawField(raw, tok); err != nil {
+				return err
+			}
+			continue
+		}
+
 		// Resolve the field descriptor.
 		var name pref.Name
 		var fd pref.FieldDescriptor
@@ -178,7 +290,10 @@ func (d decoder) unmarshalMessage(m pref.Message, checkDelims bool) error {
 			isFieldNumberName = true
 			num := pref.FieldNumber(tok.FieldNumber())
 			if !num.IsValid() {
-				return d.newError(tok.Pos(), "invalid field number: %d", num)
+				if err := d.skipField(d.newError(tok.Pos(), "invalid field number: %d", num)); err != nil {
+					return err
+				}
+				continue
 			}
 			fd = fieldDescs.ByNumber(num)
 			if fd == nil {
@@ -189,10 +304,16 @@ func (d decoder) unmarshalMessage(m pref.Message, checkDelims bool) error {
 		if xt != nil {
 			fd = xt.TypeDescriptor()
 			if !messageDesc.ExtensionRanges().Has(fd.Number()) || fd.ContainingMessage().FullName() != messageDesc.FullName() {
-				return d.newError(tok.Pos(), "message %v cannot be extended by %v", messageDesc.FullName(), fd.FullName())
+				if err := d.skipField(d.newError(tok.Pos(), "message %v cannot be extended by %v", messageDesc.FullName(), fd.FullName())); err != nil {
+					return err
+				}
+				continue
 			}
 		} else if xtErr != nil && xtErr != protoregistry.NotFound {
-			return d.newError(tok.Pos(), "unable to resolve [%s]: %v", tok.RawString(), xtErr)
+			if err := d.skipField(d.newError(tok.Pos(), "unable to resolve [%s]: %v", tok.RawString(), xtErr)); err != nil {
+				return err
+			}
+			continue
 		}
 		if flags.ProtoLegacy {
 			if fd != nil && fd.IsWeak() && fd.Message().IsPlaceholder() {
@@ -202,30 +323,45 @@ func (d decoder) unmarshalMessage(m pref.Message, checkDelims bool) error {
 
 		// Handle unknown fields.
 		if fd == nil {
-			if d.opts.DiscardUnknown || messageDesc.ReservedNames().Has(name) {
+			var err error
+			switch {
+			case d.opts.Strict:
+				if s := suggestFieldNames(fieldDescs, name); s != "" {
+					err = d.newError(tok.Pos(), "unknown field: %v, did you mean %s?", tok.RawString(), s)
+				} else {
+					err = d.newError(tok.Pos(), "unknown field: %v", tok.RawString())
+				}
+			case d.opts.DiscardUnknown || messageDesc.ReservedNames().Has(name):
 				d.skipValue()
 				continue
+			default:
+				err = d.newError(tok.Pos(), "unknown field: %v", tok.RawString())
+			}
+			if err := d.skipField(err); err != nil {
+				return err
 			}
-			return d.newError(tok.Pos(), "unknown field: %v", tok.RawString())
+			continue
 		}
 
 		// Handle fields identified by field number.
 		if isFieldNumberName {
-			// TODO: Add an option to permit parsing field numbers.
-			//
-			// This requires careful thought as the MarshalOptions.EmitUnknown
-			// option allows formatting unknown fields as the field number and the
-			// best-effort textual representation of the field value.  In that case,
-			// it may not be possible to unmarshal the value from a parser that does
-			// have information about the unknown field.
-			return d.newError(tok.Pos(), "cannot specify field by number: %v", tok.RawString())
+			// Fields identified by number are only permitted with the
+			// AllowFieldNumbers option, which is handled above, since the
+			// textual value of a field written by MarshalOptions.EmitUnknown
+			// does not identify its wire type.
+			if err := d.skipField(d.newError(tok.Pos(), "cannot specify field by number: %v", tok.RawString())); err != nil {
+				return err
+			}
+			continue
 		}
 
 		switch {
 		case fd.IsList():
 			kind := fd.Kind()
 			if kind != pref.MessageKind && kind != pref.GroupKind && !tok.HasSeparator() {
-				return d.syntaxError(tok.Pos(), "missing field separator :")
+				if err := d.syntaxError(tok.Pos(), "missing field separator :"); !d.recover(err) {
+					return err
+				}
 			}
 
 			list := m.Mutable(fd).List()
@@ -242,21 +378,27 @@ func (d decoder) unmarshalMessage(m pref.Message, checkDelims bool) error {
 		default:
 			kind := fd.Kind()
 			if kind != pref.MessageKind && kind != pref.GroupKind && !tok.HasSeparator() {
-				return d.syntaxError(tok.Pos(), "missing field separator :")
+				if err := d.syntaxError(tok.Pos(), "missing field separator :"); !d.recover(err) {
+					return err
+				}
 			}
 
 			// If field is a oneof, check if it has already been set.
 			if od := fd.ContainingOneof(); od != nil {
 				idx := uint64(od.Index())
 				if seenOneofs.Has(idx) {
-					return d.newError(tok.Pos(), "error parsing %q, oneof %v is already set", tok.RawString(), od.FullName())
+					if err := d.newError(tok.Pos(), "error parsing %q, oneof %v is already set", tok.RawString(), od.FullName()); !d.recover(err) {
+						return err
+					}
 				}
 				seenOneofs.Set(idx)
 			}
 
 			num := uint64(fd.Number())
 			if seenNums.Has(num) {
-				return d.newError(tok.Pos(), "non-repeated field %q is repeated", tok.RawString())
+				if err := d.newError(tok.Pos(), "non-repeated field %q is repeated", tok.RawString()); !d.recover(err) {
+					return err
+				}
 			}
 
 			if err := d.unmarshalSingular(fd, m); err != nil {
@@ -269,6 +411,192 @@ func (d decoder) unmarshalMessage(m pref.Message, checkDelims bool) error {
 	return nil
 }
 
+// suggestFieldNames returns the textproto names of the fields in fds that are
+// closest to name, either by their field name or their JSON name, as a quoted
+// list such as `"foo" or "bar"`. It returns an empty string if none are close.
+func suggestFieldNames(fds pref.FieldDescriptors, name pref.Name) string {
+	if name == "" {
+		return ""
+	}
+	// Allow about one edit for every three characters of the name.
+	best := len(name)/3 + 1
+	var names []string
+	for i := 0; i < fds.Len(); i++ {
+		fd := fds.Get(i)
+		s := string(fd.Name())
+		if fd.Kind() == pref.GroupKind {
+			s = string(fd.Message().Name())
+		}
+		dist := editDistance(string(name), s)
+		if d := editDistance(string(name), fd.JSONName()); d < dist {
+			dist = d
+		}
+		if d := editDistance(strings.ToLower(string(name)), strings.ToLower(s)); d < dist {
+			dist = d
+		}
+		switch {
+		case dist < best:
+			best, names = dist, append(names[:0], strconv.Quote(s))
+		case dist == best:
+			names = append(names, strconv.Quote(s))
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+// editDistance returns the Levenshtein distance between a and b,
+// which is the number of single byte insertions, deletions, and
+// substitutions needed to change a into b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// skipField records err and skips the value of the field if AllErrors is set,
+// and otherwise returns err.
+func (d decoder) skipField(err error) error {
+	if !d.recover(err) {
+		return err
+	}
+	return d.skipValue()
+}
+
+// mergeRaw merges the wire bytes of fields identified by number into m.
+func (d decoder) mergeRaw(m pref.Message, raw []byte) error {
+	if raw == nil {
+		return nil
+	}
+	return proto.UnmarshalOptions{
+		Merge:        true,
+		AllowPartial: true,
+		Resolver:     d.opts.Resolver,
+	}.Unmarshal(raw, m.Interface())
+}
+
+// appendRawField appends the wire bytes of the field identified by the field
+// number of the given name token, with the value read next.
+func (d decoder) appendRawField(b []byte, nameTok text.Token) ([]byte, error) {
+	num := protowire.Number(nameTok.FieldNumber())
+	if !num.IsValid() {
+		return nil, d.newError(nameTok.Pos(), "invalid field number: %d", num)
+	}
+
+	tok, err := d.Peek()
+	if err != nil {
+		return nil, err
+	}
+	if tok.Kind() == text.MessageOpen {
+		return d.appendRawValue(b, num)
+	}
+	if !nameTok.HasSeparator() {
+		return nil, d.syntaxError(nameTok.Pos(), "missing field separator :")
+	}
+	if tok.Kind() != text.ListOpen {
+		return d.appendRawValue(b, num)
+	}
+
+	d.Read()
+	for {
+		tok, err := d.Peek()
+		if err != nil {
+			return nil, err
+		}
+		if tok.Kind() == text.ListClose {
+			d.Read()
+			return b, nil
+		}
+		if b, err = d.appendRawValue(b, num); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// appendRawValue reads a message or scalar value and appends it to b as a
+// field with the given number.
+func (d decoder) appendRawValue(b []byte, num protowire.Number) ([]byte, error) {
+	tok, err := d.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok.Kind() {
+	case text.MessageOpen:
+		var v []byte
+		for {
+			tok, err := d.Read()
+			if err != nil {
+				return nil, err
+			}
+			if tok.Kind() == text.MessageClose {
+				break
+			}
+			if tok.Kind() != text.Name {
+				return nil, d.unexpectedTokenError(tok)
+			}
+			if tok.NameKind() != text.FieldNumber {
+				return nil, d.newError(tok.Pos(), "nested field must be identified by number: %v", tok.RawString())
+			}
+			if v, err = d.appendRawField(v, tok); err != nil {
+				return nil, err
+			}
+		}
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendBytes(b, v), nil
+
+	case text.Scalar:
+		if s, ok := tok.String(); ok {
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			return protowire.AppendString(b, s), nil
+		}
+		if s := tok.RawString(); strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+			switch len(s) {
+			case len("0x") + 8:
+				v, _ := tok.Uint32()
+				b = protowire.AppendTag(b, num, protowire.Fixed32Type)
+				return protowire.AppendFixed32(b, v), nil
+			case len("0x") + 16:
+				v, _ := tok.Uint64()
+				b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+				return protowire.AppendFixed64(b, v), nil
+			}
+		}
+		if v, ok := tok.Uint64(); ok {
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			return protowire.AppendVarint(b, v), nil
+		}
+		if v, ok := tok.Int64(); ok {
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			return protowire.AppendVarint(b, uint64(v)), nil
+		}
+	}
+	return nil, d.newError(tok.Pos(), "invalid value for field %d: %v", num, tok.RawString())
+}
+
 // findExtension returns protoreflect.ExtensionType from the Resolver if found.
 func (d decoder) findExtension(xtName pref.FullName) (pref.ExtensionType, error) {
 	xt, err := d.opts.Resolver.FindExtensionByName(xtName)
@@ -348,7 +676,7 @@ func (d decoder) unmarshalScalar(fd pref.FieldDescriptor) (pref.Value, error) {
 	case pref.StringKind:
 		if s, ok := tok.String(); ok {
 			if strs.EnforceUTF8(fd) && !utf8.ValidString(s) {
-				return pref.Value{}, d.newError(tok.Pos(), "contains invalid UTF-8")
+				return d.invalidScalar(fd, d.newError(tok.Pos(), "contains invalid UTF-8"))
 			}
 			return pref.ValueOfString(s), nil
 		}
@@ -373,7 +701,16 @@ func (d decoder) unmarshalScalar(fd pref.FieldDescriptor) (pref.Value, error) {
 		panic(fmt.Sprintf("invalid scalar kind %v", kind))
 	}
 
-	return pref.Value{}, d.newError(tok.Pos(), "invalid value for %v type: %v", kind, tok.RawString())
+	return d.invalidScalar(fd, d.newError(tok.Pos(), "invalid value for %v type: %v", kind, tok.RawString()))
+}
+
+// invalidScalar records err and returns the default value of fd if AllErrors
+// is set, and otherwise returns err.
+func (d decoder) invalidScalar(fd pref.FieldDescriptor, err error) (pref.Value, error) {
+	if !d.recover(err) {
+		return pref.Value{}, err
+	}
+	return fd.Default(), nil
 }
 
 // unmarshalList unmarshals into given protoreflect.List. A list value can
@@ -713,7 +1050,7 @@ Loop:
 }
 
 func (d decoder) unmarshalExpandedAny(typeURL string, pos int) ([]byte, error) {
-	mt, err := d.opts.Resolver.FindMessageByURL(typeURL)
+	mt, err := findMessageByURL(d.opts.ctx, d.opts.Resolver, d.opts.Fetcher, typeURL)
 	if err != nil {
 		return nil, d.newError(pos, "unable to resolve message [%v]: %v", typeURL, err)
 	}
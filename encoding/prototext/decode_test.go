@@ -5,6 +5,7 @@
 package prototext_test
 
 import (
+	"errors"
 	"math"
 	"strings"
 	"testing"
@@ -13,6 +14,7 @@ import (
 	"google.golang.org/protobuf/internal/flags"
 	"google.golang.org/protobuf/proto"
 	preg "google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/testing/protopack"
 
 	testpb "google.golang.org/protobuf/internal/testprotos/test"
 	weakpb "google.golang.org/protobuf/internal/testprotos/test/weak1"
@@ -241,6 +243,64 @@ s_string: "谷歌"
 		inputMessage: &pb3.Scalars{},
 		inputText:    "1: true",
 		wantErr:      "cannot specify field by number",
+	}, {
+		desc:         "field numbers into unknown fields",
+		umo:          prototext.UnmarshalOptions{AllowFieldNumbers: true},
+		inputMessage: &pb2.Scalars{},
+		inputText: `
+101: 255
+102: 0x00000047
+103: 0x00000000deadbeef
+104: {1: 1 2: "nested"}
+105: [-1, "hello"]
+`,
+		wantMessage: func() proto.Message {
+			m := new(pb2.Scalars)
+			m.ProtoReflect().SetUnknown(protopack.Message{
+				protopack.Tag{101, protopack.VarintType}, protopack.Varint(0xff),
+				protopack.Tag{102, protopack.Fixed32Type}, protopack.Uint32(0x47),
+				protopack.Tag{103, protopack.Fixed64Type}, protopack.Int64(0xdeadbeef),
+				protopack.Tag{104, protopack.BytesType}, protopack.LengthPrefix{protopack.Message{
+					protopack.Tag{1, protopack.VarintType}, protopack.Bool(true),
+					protopack.Tag{2, protopack.BytesType}, protopack.String("nested"),
+				}},
+				protopack.Tag{105, protopack.VarintType}, protopack.Varint(-1),
+				protopack.Tag{105, protopack.BytesType}, protopack.String("hello"),
+			}.Marshal())
+			return m
+		}(),
+	}, {
+		desc:         "field numbers into known fields",
+		umo:          prototext.UnmarshalOptions{AllowFieldNumbers: true},
+		inputMessage: &pb2.Nests{},
+		inputText:    `opt_nested: {opt_string: "a"} 1: {1: "b"} 2: 0x10`,
+		wantMessage: func() proto.Message {
+			m := &pb2.Nests{
+				OptNested: &pb2.Nested{OptString: proto.String("b")},
+			}
+			m.ProtoReflect().SetUnknown(protopack.Message{
+				protopack.Tag{2, protopack.VarintType}, protopack.Varint(0x10),
+			}.Marshal())
+			return m
+		}(),
+	}, {
+		desc:         "field numbers with named nested field",
+		umo:          prototext.UnmarshalOptions{AllowFieldNumbers: true},
+		inputMessage: &pb2.Scalars{},
+		inputText:    `101: {opt_string: "a"}`,
+		wantErr:      "nested field must be identified by number",
+	}, {
+		desc:         "field numbers with invalid value",
+		umo:          prototext.UnmarshalOptions{AllowFieldNumbers: true},
+		inputMessage: &pb2.Scalars{},
+		inputText:    `101: 1.5`,
+		wantErr:      "invalid value for field 101",
+	}, {
+		desc:         "field numbers missing separator",
+		umo:          prototext.UnmarshalOptions{AllowFieldNumbers: true},
+		inputMessage: &pb2.Scalars{},
+		inputText:    `101 1`,
+		wantErr:      "missing field separator",
 	}, {
 		desc:         "invalid bool value",
 		inputMessage: &pb3.Scalars{},
@@ -1318,6 +1378,48 @@ str_to_nested: {
 		inputMessage: &pb2.Nests{},
 		inputText:    "reserved_field: 'ignore this'",
 		wantMessage:  &pb2.Nests{},
+	}, {
+		desc:         "reserved field with Strict",
+		umo:          prototext.UnmarshalOptions{Strict: true},
+		inputMessage: &pb2.Nests{},
+		inputText:    "reserved_field: 'ignore this'",
+		wantErr:      "(line 1:1): unknown field: reserved_field",
+	}, {
+		desc:         "unknown field with Strict suggests field name",
+		umo:          prototext.UnmarshalOptions{Strict: true},
+		inputMessage: &pb2.Nests{},
+		inputText:    "opt_nestd: {}",
+		wantErr:      `unknown field: opt_nestd, did you mean "opt_nested"?`,
+	}, {
+		desc:         "unknown field with Strict suggests group name",
+		umo:          prototext.UnmarshalOptions{Strict: true},
+		inputMessage: &pb2.Nests{},
+		inputText:    "optgroup: {}",
+		wantErr:      `unknown field: optgroup, did you mean "OptGroup"?`,
+	}, {
+		desc:         "unknown field with Strict suggests by JSON name",
+		umo:          prototext.UnmarshalOptions{Strict: true},
+		inputMessage: &pb2.Nests{},
+		inputText:    "rptNested: {}",
+		wantErr:      `unknown field: rptNested, did you mean "rpt_nested"?`,
+	}, {
+		desc:         "unknown field with Strict suggests several names",
+		umo:          prototext.UnmarshalOptions{Strict: true},
+		inputMessage: &pb2.Nests{},
+		inputText:    "xpt_nested: {}",
+		wantErr:      `unknown field: xpt_nested, did you mean "opt_nested" or "rpt_nested"?`,
+	}, {
+		desc:         "unknown field with Strict without suggestions",
+		umo:          prototext.UnmarshalOptions{Strict: true, DiscardUnknown: true},
+		inputMessage: &pb2.Nests{},
+		inputText:    "something_else: 1",
+		wantErr:      "(line 1:1): unknown field: something_else",
+	}, {
+		desc:         "unknown extension with Strict",
+		umo:          prototext.UnmarshalOptions{Strict: true},
+		inputMessage: &pb2.Extensions{},
+		inputText:    "[pb2.unknown_ext]: 1",
+		wantErr:      "unknown field: [pb2.unknown_ext]",
 	}, {
 		desc:         "extensions of non-repeated fields",
 		inputMessage: &pb2.Extensions{},
@@ -1687,3 +1789,212 @@ type_url: "pb2.Nested"
 		})
 	}
 }
+
+func TestUnmarshalAllErrors(t *testing.T) {
+	type wantError struct {
+		line, column int
+		token        string
+		err          string
+	}
+	tests := []struct {
+		desc         string
+		umo          prototext.UnmarshalOptions
+		inputMessage proto.Message
+		inputText    string
+		want         []wantError
+	}{{
+		desc:         "no errors",
+		inputMessage: &pb2.Scalars{},
+		inputText:    `opt_int32: 1`,
+	}, {
+		desc:         "field and value errors",
+		inputMessage: &pb2.Scalars{},
+		inputText: `opt_int32: "one"
+unknown: {a: 1}
+opt_bool: true
+opt_string: 'a'
+opt_string: 'b'
+opt_uint32 2
+opt_int64: [1]
+`,
+		want: []wantError{
+			{1, 12, `"one"`, "invalid value for int32 type"},
+			{2, 1, "unknown", "unknown field: unknown"},
+			{5, 1, "opt_string", `non-repeated field "opt_string" is repeated`},
+			{6, 1, "opt_uint32", "missing field separator"},
+			{7, 12, "[", "unexpected token: ["},
+		},
+	}, {
+		desc:         "nested messages and lists",
+		inputMessage: &pb2.Nests{},
+		inputText:    `rpt_nested: [{opt_string: 1}, {unknown: 2}] opt_nested: {opt_nested: {foo: 3}}`,
+		want: []wantError{
+			{1, 27, "1", "invalid value for string type"},
+			{1, 32, "unknown", "unknown field: unknown"},
+			{1, 71, "foo", "unknown field: foo"},
+		},
+	}, {
+		desc:         "syntax error stops parsing",
+		inputMessage: &pb2.Scalars{},
+		inputText:    "unknown: 1\nopt_string: \"abc\nopt_bool: true",
+		want: []wantError{
+			{1, 1, "unknown", "unknown field: unknown"},
+			{2, 13, `"abc`, "syntax error (line 2:13): invalid character"},
+		},
+	}, {
+		desc:         "unexpected EOF",
+		inputMessage: &pb2.Nests{},
+		inputText:    "unknown: 1\nopt_nested: {",
+		want: []wantError{
+			{1, 1, "unknown", "unknown field: unknown"},
+			{2, 14, "", "unexpected EOF"},
+		},
+	}, {
+		desc:         "strict",
+		inputMessage: &pb2.Nests{},
+		umo:          prototext.UnmarshalOptions{Strict: true},
+		inputText:    "opt_nestd: {}\nrpt_nestd: {}",
+		want: []wantError{
+			{1, 1, "opt_nestd", `did you mean "opt_nested"?`},
+			{2, 1, "rpt_nestd", `did you mean "rpt_nested"?`},
+		},
+	}}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.desc, func(t *testing.T) {
+			tt.umo.AllErrors = true
+			err := tt.umo.Unmarshal([]byte(tt.inputText), tt.inputMessage)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Unmarshal() error: %v", err)
+				}
+				return
+			}
+			errs, ok := err.(prototext.ParseErrors)
+			if !ok {
+				t.Fatalf("Unmarshal() error = %T %v, want prototext.ParseErrors", err, err)
+			}
+			if len(errs) != len(tt.want) {
+				t.Fatalf("Unmarshal() returned %d errors, want %d:\n%v", len(errs), len(tt.want), errs)
+			}
+			for i, e := range errs {
+				w := tt.want[i]
+				if e.Line != w.line || e.Column != w.column || e.Token != w.token || !strings.Contains(e.Error(), w.err) {
+					t.Errorf("error %d = {%d, %d, %q, %q}, want {%d, %d, %q, %q}", i, e.Line, e.Column, e.Token, e.Error(), w.line, w.column, w.token, w.err)
+				}
+			}
+			if got := err.Error(); !strings.Contains(got, "more errors") && len(errs) > 1 {
+				t.Errorf("Error() = %q, want count of more errors", got)
+			}
+		})
+	}
+}
+
+func TestUnmarshalParseError(t *testing.T) {
+	err := prototext.Unmarshal([]byte("opt_string: 'a'\nopt_int32: 1.5"), &pb2.Scalars{})
+	e, ok := err.(*prototext.ParseError)
+	if !ok {
+		t.Fatalf("Unmarshal() error = %T %v, want *prototext.ParseError", err, err)
+	}
+	if e.Line != 2 || e.Column != 12 || e.Token != "1.5" {
+		t.Errorf("ParseError = {%d, %d, %q}, want {2, 12, %q}", e.Line, e.Column, e.Token, "1.5")
+	}
+	if !strings.Contains(e.Error(), "(line 2:12): invalid value for int32 type: 1.5") {
+		t.Errorf("Error() = %q", e.Error())
+	}
+}
+
+func TestUnmarshalInclude(t *testing.T) {
+	files := map[string]string{
+		"base.txtpb": `opt_nested: {opt_string: "base"}
+rpt_nested: {opt_string: "base"}`,
+		"middle.txtpb": `# proto-include: base.txtpb
+opt_nested: {opt_nested: {opt_string: "middle"}}`,
+		"cycle.txtpb":   `# proto-include: "cycle2.txtpb"`,
+		"cycle2.txtpb":  `# proto-include: "cycle.txtpb"`,
+		"invalid.txtpb": `unknown: 1`,
+	}
+	opener := func(path string) ([]byte, error) {
+		s, ok := files[path]
+		if !ok {
+			return nil, errors.New("file not found")
+		}
+		return []byte(s), nil
+	}
+
+	tests := []struct {
+		desc        string
+		noOpener    bool
+		inputText   string
+		wantMessage proto.Message
+		wantErr     string
+	}{{
+		desc: "includes are merged before the file",
+		inputText: `# Configuration.
+# proto-include: middle.txtpb
+opt_nested: {opt_string: "top"}
+rpt_nested: {opt_string: "top"}`,
+		wantMessage: &pb2.Nests{
+			OptNested: &pb2.Nested{
+				OptString: proto.String("top"),
+				OptNested: &pb2.Nested{OptString: proto.String("middle")},
+			},
+			RptNested: []*pb2.Nested{
+				{OptString: proto.String("base")},
+				{OptString: proto.String("top")},
+			},
+		},
+	}, {
+		desc: "directive in a message value is a comment",
+		inputText: `opt_nested: {
+  # proto-include: base.txtpb
+}`,
+		wantMessage: &pb2.Nests{OptNested: &pb2.Nested{}},
+	}, {
+		desc:        "without Opener",
+		noOpener:    true,
+		inputText:   "# proto-include: base.txtpb\n",
+		wantMessage: &pb2.Nests{},
+	}, {
+		desc:      "cycle",
+		inputText: "# proto-include: cycle.txtpb\n",
+		wantErr:   "include cycle: cycle.txtpb -> cycle2.txtpb -> cycle.txtpb",
+	}, {
+		desc:      "missing file",
+		inputText: "# proto-include: missing.txtpb\n",
+		wantErr:   "unable to include missing.txtpb: file not found",
+	}, {
+		desc:      "missing path",
+		inputText: "\n#proto-include:\n",
+		wantErr:   "(line 2:1): missing proto-include path",
+	}, {
+		desc:      "error in included file",
+		inputText: "# proto-include: invalid.txtpb\n",
+		wantErr:   "invalid.txtpb: (line 1:1): unknown field: unknown",
+	}}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.desc, func(t *testing.T) {
+			var umo prototext.UnmarshalOptions
+			if !tt.noOpener {
+				umo.Opener = opener
+			}
+			got := &pb2.Nests{}
+			err := umo.Unmarshal([]byte(tt.inputText), got)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Unmarshal() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal() error: %v", err)
+			}
+			if !proto.Equal(got, tt.wantMessage) {
+				t.Errorf("Unmarshal()\n<got>\n%v\n<want>\n%v\n", got, tt.wantMessage)
+			}
+		})
+	}
+}
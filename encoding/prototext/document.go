@@ -0,0 +1,401 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prototext
+
+import (
+	"bytes"
+	"strings"
+
+	"google.golang.org/protobuf/internal/encoding/text"
+	"google.golang.org/protobuf/internal/errors"
+)
+
+// Document is a parsed textproto document that can be edited and written back
+// out while preserving its formatting. Comments, blank lines, and the order of
+// fields are kept as they appear in the input, and only the parts of the
+// document that are changed are rewritten.
+//
+// A Document is not checked against any message type. To obtain a message,
+// unmarshal the output of Bytes.
+type Document struct {
+	root *DocumentField
+}
+
+// ParseDocument parses b as a textproto document.
+func ParseDocument(b []byte) (*Document, error) {
+	root, err := parseDocument(b)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{root}, nil
+}
+
+// Bytes returns the textproto document including all edits.
+func (d *Document) Bytes() []byte {
+	return d.root.appendFields(nil)
+}
+
+// Fields returns the top-level fields of the document in the order they appear.
+func (d *Document) Fields() []*DocumentField {
+	return d.root.Fields()
+}
+
+// Field returns the first top-level field with the given name, or nil if none.
+func (d *Document) Field(name string) *DocumentField {
+	return d.root.Field(name)
+}
+
+// AppendField adds a top-level field with the given name and value after the
+// existing fields. See DocumentField.AppendField.
+func (d *Document) AppendField(name, value string) (*DocumentField, error) {
+	return d.root.AppendField(name, value)
+}
+
+// DocumentField is a field in a Document. The value of a field is either a
+// message, which is made up of nested fields, or a scalar or list value, which
+// is only available as text. A list value, such as `a: [1, 2]`, is edited as
+// a whole, while each occurrence of a repeated field, such as `a: 1 a: 2`,
+// is a separate DocumentField.
+type DocumentField struct {
+	parent *DocumentField
+
+	prefix string // whitespace, comments, and separators before the name
+	name   string
+	hasSep bool   // whether the name is followed by a ":"
+	sep    string // text between the name and the value
+	value  string // scalar or list value
+	suffix string // text after the value through the end of the line
+
+	// Message values only.
+	message    bool
+	open       string // message open delimiter
+	openSuffix string // text after the open delimiter through the end of the line
+	fields     []*DocumentField
+	inner      string // text after the last field before the close delimiter
+	close      string // message close delimiter
+}
+
+// Name returns the name of the field as written, such as "foo",
+// "[example.ext]", or "1".
+func (f *DocumentField) Name() string {
+	return f.name
+}
+
+// IsMessage reports whether the value of the field is a message.
+func (f *DocumentField) IsMessage() bool {
+	return f.message
+}
+
+// Value returns the text of a scalar or list value, such as `"hello"`, `1.5`,
+// or `[1, 2]`. It returns an empty string for message values.
+func (f *DocumentField) Value() string {
+	return f.value
+}
+
+// SetValue replaces the value of the field with the given textproto value,
+// which may be a scalar, list, or message value such as `{a: 1}`.
+// The comments and position of the field are kept.
+func (f *DocumentField) SetValue(value string) error {
+	g, err := parseDocumentField(f.name, value)
+	if err != nil {
+		return err
+	}
+	if !g.message && !f.hasSep {
+		f.hasSep, f.sep = true, ": "
+	}
+	f.value = g.value
+	f.message, f.open, f.openSuffix, f.inner, f.close = g.message, g.open, g.openSuffix, g.inner, g.close
+	f.fields = g.fields
+	for _, c := range f.fields {
+		c.parent = f
+	}
+	return nil
+}
+
+// SetString replaces the value of the field with s as a quoted string.
+func (f *DocumentField) SetString(s string) {
+	enc, _ := text.NewEncoder("", [2]byte{}, false)
+	enc.WriteString(s)
+	f.SetValue(string(enc.Bytes()))
+}
+
+// Fields returns the fields of a message value in the order they appear.
+// It returns nil for other values.
+func (f *DocumentField) Fields() []*DocumentField {
+	return append([]*DocumentField(nil), f.fields...)
+}
+
+// Field returns the first field of a message value with the given name,
+// or nil if none.
+func (f *DocumentField) Field(name string) *DocumentField {
+	for _, c := range f.fields {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// AppendField adds a field with the given name and textproto value after the
+// existing fields of a message value, using the indentation of the preceding
+// field. It reports an error if the field is not a message or if the name or
+// value are invalid.
+func (f *DocumentField) AppendField(name, value string) (*DocumentField, error) {
+	if !f.message {
+		return nil, errors.New("cannot append field to non-message value of %v", f.name)
+	}
+	c, err := parseDocumentField(name, value)
+	if err != nil {
+		return nil, err
+	}
+	c.parent = f
+	switch n := len(f.fields); {
+	case n > 0 && strings.HasSuffix(f.fields[n-1].suffix, "\n"):
+		c.prefix, c.suffix = lineIndent(f.fields[n-1].prefix), "\n"
+	case n > 0:
+		c.prefix = " "
+	case f.parent == nil:
+		// Keep any comments of an empty document before the field.
+		c.prefix, c.suffix, f.inner = f.inner, "\n", ""
+		if c.prefix != "" && !strings.HasSuffix(c.prefix, "\n") {
+			c.prefix += "\n"
+		}
+	case strings.HasSuffix(f.openSuffix, "\n"):
+		c.prefix, c.suffix = lineIndent(f.prefix)+"  ", "\n"
+	default:
+		c.prefix, c.suffix = " ", " "
+	}
+	f.fields = append(f.fields, c)
+	return c, nil
+}
+
+// Remove removes the field from its message along with its leading comments.
+// Comments separated from the field by a blank line are kept.
+func (f *DocumentField) Remove() {
+	p := f.parent
+	if p == nil {
+		return
+	}
+	i := 0
+	for p.fields[i] != f {
+		i++
+	}
+	p.fields = append(p.fields[:i], p.fields[i+1:]...)
+	f.parent = nil
+
+	detached, _ := splitDetached(f.prefix)
+	if i < len(p.fields) {
+		next := p.fields[i]
+		if i == 0 {
+			// Drop a separator that followed the removed field.
+			if s := strings.TrimLeft(next.prefix, " \t"); s != "" && (s[0] == ',' || s[0] == ';') {
+				next.prefix = strings.TrimLeft(s[1:], " \t")
+			}
+		}
+		next.prefix = detached + next.prefix
+	} else {
+		p.inner = detached + p.inner
+	}
+}
+
+// LeadingComments returns the comment lines directly preceding the field,
+// without the "#" characters and one following space.
+func (f *DocumentField) LeadingComments() string {
+	_, attached := splitDetached(f.prefix)
+	var lines []string
+	for _, line := range strings.Split(attached, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			lines = append(lines, strings.TrimPrefix(line[1:], " "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SetLeadingComments replaces the comment lines directly preceding the field
+// with the lines of s. If s is empty, the comments are removed.
+func (f *DocumentField) SetLeadingComments(s string) {
+	detached, attached := splitDetached(f.prefix)
+	lead, indent := "", lineIndent(attached)
+	if !strings.Contains(attached, "\n") {
+		// The field does not start a line, so start one for the comments.
+		lead, indent = attached, ""
+		if s != "" && lead != "" {
+			lead = strings.TrimRight(lead, " \t") + "\n"
+		}
+	}
+	var b bytes.Buffer
+	b.WriteString(detached)
+	b.WriteString(lead)
+	if s != "" {
+		for _, line := range strings.Split(s, "\n") {
+			b.WriteString(indent)
+			b.WriteString("#")
+			if line != "" {
+				b.WriteString(" ")
+				b.WriteString(line)
+			}
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString(indent)
+	f.prefix = b.String()
+}
+
+func (f *DocumentField) appendTo(b []byte) []byte {
+	b = append(b, f.prefix...)
+	b = append(b, f.name...)
+	b = append(b, f.sep...)
+	if f.message {
+		b = append(b, f.open...)
+		b = append(b, f.openSuffix...)
+		b = f.appendFields(b)
+		b = append(b, f.close...)
+	} else {
+		b = append(b, f.value...)
+	}
+	return append(b, f.suffix...)
+}
+
+func (f *DocumentField) appendFields(b []byte) []byte {
+	for _, c := range f.fields {
+		b = c.appendTo(b)
+	}
+	return append(b, f.inner...)
+}
+
+// lineIndent returns the whitespace at the start of the last line of s.
+func lineIndent(s string) string {
+	s = s[strings.LastIndexByte(s, '\n')+1:]
+	return s[:len(s)-len(strings.TrimLeft(s, " \t"))]
+}
+
+// splitLine splits s after its first newline, if any. The first part holds
+// the text that trails a value on its line.
+func splitLine(s string) (string, string) {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i+1], s[i+1:]
+	}
+	return "", s
+}
+
+// splitDetached splits the text before a field after its last blank line,
+// which separates detached comments from the comments of the field.
+func splitDetached(s string) (string, string) {
+	end := 0
+	for i := 0; i < len(s); {
+		j := strings.IndexByte(s[i:], '\n')
+		if j < 0 {
+			break
+		}
+		if strings.TrimSpace(s[i:i+j]) == "" {
+			end = i + j + 1
+		}
+		i += j + 1
+	}
+	return s[:end], s[end:]
+}
+
+// parseDocumentField parses a single field with the given name and value.
+func parseDocumentField(name, value string) (*DocumentField, error) {
+	root, err := parseDocument([]byte(name + ": " + value))
+	if err != nil {
+		return nil, err
+	}
+	if len(root.fields) != 1 || root.fields[0].name != name || root.inner != "" {
+		return nil, errors.New("invalid field %q with value %q", name, value)
+	}
+	f := root.fields[0]
+	f.sep = ": "
+	if f.message {
+		f.sep = " "
+	}
+	return f, nil
+}
+
+// docParser builds DocumentFields from the tokens of a text.Decoder and the
+// text in between them.
+type docParser struct {
+	*text.Decoder
+	src []byte
+	end int // end of the last token read
+}
+
+func parseDocument(b []byte) (*DocumentField, error) {
+	p := &docParser{Decoder: text.NewDecoder(b), src: b}
+	root := &DocumentField{message: true}
+	if err := p.parseFields(root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// read returns the next token and the text between it and the last token.
+func (p *docParser) read() (text.Token, string, error) {
+	tok, err := p.Read()
+	if err != nil {
+		return text.Token{}, "", err
+	}
+	gap := string(p.src[p.end:tok.Pos()])
+	p.end = tok.Pos() + len(tok.RawString())
+	return tok, gap, nil
+}
+
+// parseFields parses the fields of the message m up to its close delimiter
+// or the end of input.
+func (p *docParser) parseFields(m *DocumentField) error {
+	for {
+		tok, gap, err := p.read()
+		if err != nil {
+			return err
+		}
+		if n := len(m.fields); n > 0 {
+			m.fields[n-1].suffix, gap = splitLine(gap)
+		} else if m.open != "" {
+			m.openSuffix, gap = splitLine(gap)
+		}
+		if tok.Kind() != text.Name {
+			// The decoder only returns other kinds for the end of the message.
+			m.inner, m.close = gap, tok.RawString()
+			return nil
+		}
+
+		f := &DocumentField{
+			parent: m,
+			prefix: gap,
+			name:   tok.RawString(),
+			hasSep: tok.HasSeparator(),
+		}
+		m.fields = append(m.fields, f)
+
+		tok, f.sep, err = p.read()
+		if err != nil {
+			return err
+		}
+		switch tok.Kind() {
+		case text.MessageOpen:
+			f.message, f.open = true, tok.RawString()
+			if err := p.parseFields(f); err != nil {
+				return err
+			}
+		case text.ListOpen:
+			start := tok.Pos()
+			for depth := 1; depth > 0; {
+				if tok, _, err = p.read(); err != nil {
+					return err
+				}
+				switch tok.Kind() {
+				case text.ListOpen:
+					depth++
+				case text.ListClose:
+					depth--
+				}
+			}
+			f.value = string(p.src[start:p.end])
+		default:
+			f.value = tok.RawString()
+		}
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prototext_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+
+	pb2 "google.golang.org/protobuf/internal/testprotos/textpb2"
+)
+
+const testDocument = `# Service configuration.
+
+# The name of the service.
+opt_string: "web"  # Trailing comment.
+
+rpt_nested: [{opt_string: "x"}, {opt_string: "y"}]
+
+# The primary backend.
+opt_nested {
+  # Its address.
+  opt_string: 'a:80'
+  opt_nested: <>
+}
+`
+
+func TestDocumentRoundTrip(t *testing.T) {
+	for _, in := range []string{
+		"",
+		testDocument,
+		`a: 1, b: "x" 'y';c {d: [1, 2] e <f: -inf>}  # end`,
+		"[ext.name]: 1\n1: {2: 3}\n\n",
+	} {
+		doc, err := prototext.ParseDocument([]byte(in))
+		if err != nil {
+			t.Errorf("ParseDocument(%q) returned error: %v", in, err)
+			continue
+		}
+		if got := string(doc.Bytes()); got != in {
+			t.Errorf("ParseDocument(%q).Bytes() mismatch (-want +got):\n%v", in, cmp.Diff(in, got))
+		}
+	}
+}
+
+func TestDocumentInvalid(t *testing.T) {
+	for _, in := range []string{
+		"a: ",
+		"a: {",
+		"a: 1 }",
+		"a: [1,",
+	} {
+		if _, err := prototext.ParseDocument([]byte(in)); err == nil {
+			t.Errorf("ParseDocument(%q) got nil error, want error", in)
+		}
+	}
+}
+
+func TestDocumentEdit(t *testing.T) {
+	tests := []struct {
+		desc    string
+		in      string
+		edit    func(*prototext.Document) error
+		want    string
+		wantErr bool
+	}{{
+		desc: "set values",
+		in:   testDocument,
+		edit: func(d *prototext.Document) error {
+			d.Field("opt_string").SetString("api")
+			if err := d.Field("rpt_nested").SetValue(`{opt_string: "z"}`); err != nil {
+				return err
+			}
+			return d.Field("opt_nested").Field("opt_string").SetValue(`"b:80"`)
+		},
+		want: `# Service configuration.
+
+# The name of the service.
+opt_string: "api"  # Trailing comment.
+
+rpt_nested: {opt_string: "z"}
+
+# The primary backend.
+opt_nested {
+  # Its address.
+  opt_string: "b:80"
+  opt_nested: <>
+}
+`,
+	}, {
+		desc: "append fields",
+		in:   testDocument,
+		edit: func(d *prototext.Document) error {
+			if _, err := d.Field("opt_nested").AppendField("rpt_nested", "{}"); err != nil {
+				return err
+			}
+			f, err := d.AppendField("opt_nested", `{opt_string: "c"}`)
+			if err != nil {
+				return err
+			}
+			f.SetLeadingComments("A new backend.")
+			_, err = f.AppendField("opt_nested", "{}")
+			return err
+		},
+		want: `# Service configuration.
+
+# The name of the service.
+opt_string: "web"  # Trailing comment.
+
+rpt_nested: [{opt_string: "x"}, {opt_string: "y"}]
+
+# The primary backend.
+opt_nested {
+  # Its address.
+  opt_string: 'a:80'
+  opt_nested: <>
+  rpt_nested {}
+}
+# A new backend.
+opt_nested {opt_string: "c" opt_nested {}}
+`,
+	}, {
+		desc: "append to empty documents and messages",
+		in:   "# Header.\na: {\n}\nb {}\n",
+		edit: func(d *prototext.Document) error {
+			if _, err := d.Field("a").AppendField("c", "1"); err != nil {
+				return err
+			}
+			_, err := d.Field("b").AppendField("c", "2")
+			return err
+		},
+		want: "# Header.\na: {\n  c: 1\n}\nb { c: 2 }\n",
+	}, {
+		desc: "append to comment-only document",
+		in:   "# Header.",
+		edit: func(d *prototext.Document) error {
+			_, err := d.AppendField("a", "1")
+			return err
+		},
+		want: "# Header.\na: 1\n",
+	}, {
+		desc: "remove fields",
+		in:   testDocument,
+		edit: func(d *prototext.Document) error {
+			d.Field("opt_string").Remove()
+			d.Field("opt_nested").Field("opt_string").Remove()
+			return nil
+		},
+		want: `# Service configuration.
+
+
+rpt_nested: [{opt_string: "x"}, {opt_string: "y"}]
+
+# The primary backend.
+opt_nested {
+  opt_nested: <>
+}
+`,
+	}, {
+		desc: "remove fields on one line",
+		in:   `a: 1, b: 2, c: 3`,
+		edit: func(d *prototext.Document) error {
+			d.Field("a").Remove()
+			d.Field("c").Remove()
+			return nil
+		},
+		want: `b: 2`,
+	}, {
+		desc: "set comments",
+		in:   "a: 1 b: 2\n# Old.\nc: 3\n",
+		edit: func(d *prototext.Document) error {
+			d.Field("b").SetLeadingComments("New\n\nlines.")
+			d.Field("c").SetLeadingComments("")
+			return nil
+		},
+		want: "a: 1\n# New\n#\n# lines.\nb: 2\nc: 3\n",
+	}, {
+		desc: "append to scalar",
+		in:   "a: 1",
+		edit: func(d *prototext.Document) error {
+			_, err := d.Field("a").AppendField("b", "2")
+			return err
+		},
+		wantErr: true,
+	}, {
+		desc: "set invalid value",
+		in:   "a: 1",
+		edit: func(d *prototext.Document) error {
+			return d.Field("a").SetValue("1 b: 2")
+		},
+		wantErr: true,
+	}, {
+		desc: "append invalid name",
+		in:   "a: 1",
+		edit: func(d *prototext.Document) error {
+			_, err := d.AppendField("-b", "2")
+			return err
+		},
+		wantErr: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			doc, err := prototext.ParseDocument([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("ParseDocument() returned error: %v", err)
+			}
+			err = tt.edit(doc)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("edit returned error: %v, want error: %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := string(doc.Bytes()); got != tt.want {
+				t.Errorf("Bytes() mismatch (-want +got):\n%v", cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
+
+func TestDocumentAccessors(t *testing.T) {
+	doc, err := prototext.ParseDocument([]byte(testDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range doc.Fields() {
+		names = append(names, f.Name())
+	}
+	if want := []string{"opt_string", "rpt_nested", "opt_nested"}; !cmp.Equal(names, want) {
+		t.Errorf("Fields() names = %q, want %q", names, want)
+	}
+	if got, want := doc.Field("opt_string").Value(), `"web"`; got != want {
+		t.Errorf("Value() = %q, want %q", got, want)
+	}
+	if got, want := doc.Field("rpt_nested").Value(), `[{opt_string: "x"}, {opt_string: "y"}]`; got != want {
+		t.Errorf("Value() = %q, want %q", got, want)
+	}
+	if f := doc.Field("opt_nested"); !f.IsMessage() || f.Value() != "" {
+		t.Errorf("opt_nested: IsMessage() = %v, Value() = %q; want true, empty", f.IsMessage(), f.Value())
+	}
+	if got, want := doc.Field("opt_string").LeadingComments(), "The name of the service."; got != want {
+		t.Errorf("LeadingComments() = %q, want %q", got, want)
+	}
+	if got, want := doc.Field("opt_nested").Field("opt_string").LeadingComments(), "Its address."; got != want {
+		t.Errorf("LeadingComments() = %q, want %q", got, want)
+	}
+	if doc.Field("missing") != nil {
+		t.Errorf("Field(missing) = %v, want nil", doc.Field("missing"))
+	}
+
+	// The edited document can be unmarshaled.
+	m := new(pb2.Nests)
+	if err := prototext.Unmarshal(doc.Bytes(), m); err == nil {
+		t.Errorf("Unmarshal() got nil error for opt_string in Nests, want error")
+	}
+	doc.Field("opt_string").Remove()
+	if err := prototext.Unmarshal(doc.Bytes(), m); err != nil {
+		t.Fatalf("Unmarshal() returned error: %v", err)
+	}
+	want := &pb2.Nests{
+		OptNested: &pb2.Nested{OptString: proto.String("a:80"), OptNested: &pb2.Nested{}},
+		RptNested: []*pb2.Nested{{OptString: proto.String("x")}, {OptString: proto.String("y")}},
+	}
+	if !proto.Equal(m, want) {
+		t.Errorf("Unmarshal() got %v, want %v", m, want)
+	}
+}
@@ -5,9 +5,11 @@
 package prototext
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strconv"
+	"strings"
 	"unicode/utf8"
 
 	"google.golang.org/protobuf/encoding/protowire"
@@ -18,6 +20,7 @@ import (
 	"google.golang.org/protobuf/internal/genid"
 	"google.golang.org/protobuf/internal/mapsort"
 	"google.golang.org/protobuf/internal/pragma"
+	"google.golang.org/protobuf/internal/redact"
 	"google.golang.org/protobuf/internal/strs"
 	"google.golang.org/protobuf/proto"
 	pref "google.golang.org/protobuf/reflect/protoreflect"
@@ -56,15 +59,37 @@ type MarshalOptions struct {
 	// Indent can only be composed of space or tab characters.
 	Indent string
 
+	// Width, if positive, specifies that each message in multi-line output is
+	// written on a single line if that line fits within Width columns,
+	// including its indentation, and otherwise with each field on a separate
+	// line. If the whole output fits, it is written on a single line, as if
+	// Multiline were false. Width implies Multiline.
+	Width int
+
 	// EmitASCII specifies whether to format strings and bytes as ASCII only
 	// as opposed to using UTF-8 encoding when possible.
+	// It is the same as setting StringEscaping to EscapeUnicode.
 	EmitASCII bool
 
+	// StringEscaping specifies how characters in strings and bytes are
+	// escaped. The default is EscapeUTF8.
+	StringEscaping StringEscaping
+
 	// allowInvalidUTF8 specifies whether to permit the encoding of strings
 	// with invalid UTF-8. This is unexported as it is intended to only
 	// be specified by the Format method.
 	allowInvalidUTF8 bool
 
+	// Canonical specifies that the output is stable, so that it is suitable
+	// for comparison against golden files. The output then only depends on
+	// the message and the other options: fields are emitted in the order they
+	// are declared in the message, followed by extension fields sorted by
+	// field number and then unknown fields in the order they were parsed;
+	// map entries are sorted by key, numerically for integer keys and
+	// lexically for string keys; and the whitespace is fixed.
+	// Without Canonical, the output is deliberately made unstable.
+	Canonical bool
+
 	// AllowPartial allows messages that have missing required fields to marshal
 	// without returning an error. If AllowPartial is false (the default),
 	// Marshal will return error if there are any missing required fields.
@@ -75,14 +100,90 @@ type MarshalOptions struct {
 	// The default is to exclude unknown fields.
 	EmitUnknown bool
 
+	// EmitUnknownRaw specifies whether to emit unknown fields in the output
+	// in a form that UnmarshalOptions.AllowFieldNumbers can parse back into
+	// the same wire bytes. Each unknown field is written as its field number
+	// followed by its value: varints as decimal integers, fixed32 and fixed64
+	// values as zero-padded hexadecimal literals of 8 and 16 digits, and
+	// length-delimited values as nested messages if they parse as a message
+	// which re-encodes to the same bytes, or as strings otherwise.
+	// Groups are written as nested messages and are parsed back as
+	// length-delimited fields.
+	EmitUnknownRaw bool
+
+	// EmitComments specifies whether to write the leading comments of each
+	// field declaration, as recorded in the source code info of its file,
+	// as "#" comments before the field. Comments are only written in
+	// multi-line output. This is intended for producing annotated templates
+	// for humans to edit.
+	EmitComments bool
+
+	// Redact specifies whether to replace the values of fields annotated with
+	// the debug_redact option with a placeholder. If specified, the unmarshaler
+	// will be unable to parse the output. Redaction is always performed by
+	// the Format method.
+	Redact bool
+
+	// RedactFunc, if non-nil, reports whether to replace the value of a field
+	// with the placeholder, in addition to the fields redacted by Redact.
+	// It allows redacting fields that are not annotated with debug_redact,
+	// such as by name or by a custom option.
+	RedactFunc func(pref.FieldDescriptor) bool
+
+	// AnyFormat specifies how google.protobuf.Any messages are written.
+	// The default is AnyExpandIfResolved.
+	AnyFormat AnyFormat
+
 	// Resolver is used for looking up types when expanding google.protobuf.Any
 	// messages. If nil, this defaults to using protoregistry.GlobalTypes.
 	Resolver interface {
 		protoregistry.ExtensionTypeResolver
 		protoregistry.MessageTypeResolver
 	}
+
+	// Fetcher, if non-nil, is used for looking up the types of
+	// google.protobuf.Any messages that are not found by the Resolver.
+	Fetcher MessageTypeFetcher
+
+	ctx context.Context // set by MarshalContext
 }
 
+// AnyFormat specifies how a google.protobuf.Any message is written.
+type AnyFormat uint8
+
+const (
+	// AnyExpandIfResolved writes an Any in the expanded form,
+	// such as `[type.googleapis.com/pkg.Message] { ... }`, if the message type
+	// of its type URL can be resolved and its value parsed, and otherwise in
+	// the raw form with the type_url and value fields.
+	AnyExpandIfResolved AnyFormat = iota
+	// AnyExpanded always writes an Any in the expanded form. Marshaling
+	// fails if the message type cannot be resolved or the value parsed.
+	AnyExpanded
+	// AnyRaw always writes an Any in the raw form with the type_url and
+	// value fields.
+	AnyRaw
+)
+
+// StringEscaping specifies how characters in strings and bytes are escaped.
+// Characters that are not printable, as well as quotes and backslashes,
+// are always escaped.
+type StringEscaping uint8
+
+const (
+	// EscapeUTF8 writes valid UTF-8 sequences for non-ASCII characters as is,
+	// unless EmitASCII is set. Other bytes are written as hexadecimal escapes,
+	// such as "\xff".
+	EscapeUTF8 StringEscaping = iota
+	// EscapeUnicode writes non-ASCII characters as Unicode escapes,
+	// such as "\u00e9", so that the output is ASCII only.
+	EscapeUnicode
+	// EscapeOctal writes every byte that is not printable ASCII as a
+	// three-digit octal escape, such as "\303\251", and also escapes single
+	// quotes. This matches the output of the C++ implementation.
+	EscapeOctal
+)
+
 // Format formats the message as a string.
 // This method is only intended for human consumption and ignores errors.
 // Do not depend on the output being stable. It may change over time across
@@ -94,34 +195,51 @@ func (o MarshalOptions) Format(m proto.Message) string {
 	o.allowInvalidUTF8 = true
 	o.AllowPartial = true
 	o.EmitUnknown = true
+	o.Redact = true
 	b, _ := o.Marshal(m)
 	return string(b)
 }
 
 // Marshal writes the given proto.Message in textproto format using options in
-// MarshalOptions object. Do not depend on the output being stable. It may
-// change over time across different versions of the program.
+// MarshalOptions object. Do not depend on the output being stable unless
+// Canonical is set. It may change over time across different versions of the
+// program.
 func (o MarshalOptions) Marshal(m proto.Message) ([]byte, error) {
 	return o.marshal(m)
 }
 
+// MarshalContext is like Marshal, but passes ctx to the Fetcher.
+func (o MarshalOptions) MarshalContext(ctx context.Context, m proto.Message) ([]byte, error) {
+	o.ctx = ctx
+	return o.marshal(m)
+}
+
 // marshal is a centralized function that all marshal operations go through.
 // For profiling purposes, avoid changing the name of this function or
 // introducing other code paths for marshal that do not go through this.
 func (o MarshalOptions) marshal(m proto.Message) ([]byte, error) {
 	var delims = [2]byte{'{', '}'}
 
-	if o.Multiline && o.Indent == "" {
+	if (o.Multiline || o.Width > 0) && o.Indent == "" {
 		o.Indent = defaultIndent
 	}
 	if o.Resolver == nil {
 		o.Resolver = protoregistry.GlobalTypes
 	}
 
-	internalEnc, err := text.NewEncoder(o.Indent, delims, o.EmitASCII)
+	internalEnc, err := text.NewEncoder(o.Indent, delims, o.EmitASCII || o.StringEscaping == EscapeUnicode)
 	if err != nil {
 		return nil, err
 	}
+	if o.Canonical {
+		internalEnc.SetStable()
+	}
+	if o.StringEscaping == EscapeOctal {
+		internalEnc.SetOctalEscapes()
+	}
+	if o.Width > 0 {
+		internalEnc.SetWidth(o.Width)
+	}
 
 	// Treat nil message interface as an empty message,
 	// in which case there is nothing to output.
@@ -129,13 +247,14 @@ func (o MarshalOptions) marshal(m proto.Message) ([]byte, error) {
 		return []byte{}, nil
 	}
 
-	enc := encoder{internalEnc, o}
+	enc := encoder{Encoder: internalEnc, opts: o}
 	err = enc.marshalMessage(m.ProtoReflect(), false)
 	if err != nil {
 		return nil, err
 	}
+	compact := o.Width > 0 && enc.Compact()
 	out := enc.Bytes()
-	if len(o.Indent) > 0 && len(out) > 0 {
+	if len(o.Indent) > 0 && len(out) > 0 && !compact {
 		out = append(out, '\n')
 	}
 	if o.AllowPartial {
@@ -162,10 +281,14 @@ func (e encoder) marshalMessage(m pref.Message, inclDelims bool) error {
 	}
 
 	// Handle Any expansion.
-	if messageDesc.FullName() == genid.Any_message_fullname {
-		if e.marshalAny(m) {
+	if messageDesc.FullName() == genid.Any_message_fullname && e.opts.AnyFormat != AnyRaw {
+		err := e.marshalAny(m)
+		if err == nil {
 			return nil
 		}
+		if e.opts.AnyFormat == AnyExpanded {
+			return err
+		}
 		// If unable to expand, continue on to marshal Any as a regular message.
 	}
 
@@ -202,7 +325,7 @@ func (e encoder) marshalMessage(m pref.Message, inclDelims bool) error {
 	}
 
 	// Marshal unknown fields.
-	if e.opts.EmitUnknown {
+	if e.opts.EmitUnknown || e.opts.EmitUnknownRaw {
 		e.marshalUnknown(m.GetUnknown())
 	}
 
@@ -211,7 +334,16 @@ func (e encoder) marshalMessage(m pref.Message, inclDelims bool) error {
 
 // marshalField marshals the given field with protoreflect.Value.
 func (e encoder) marshalField(name string, val pref.Value, fd pref.FieldDescriptor) error {
+	if e.opts.EmitComments {
+		if s := leadingComments(fd); s != "" {
+			e.WriteComment(s)
+		}
+	}
 	switch {
+	case e.isRedacted(fd):
+		e.WriteName(name)
+		e.WriteLiteral(redact.Placeholder)
+		return nil
 	case fd.IsList():
 		return e.marshalList(name, val.List(), fd)
 	case fd.IsMap():
@@ -222,6 +354,25 @@ func (e encoder) marshalField(name string, val pref.Value, fd pref.FieldDescript
 	}
 }
 
+// isRedacted reports whether the value of fd is replaced with the placeholder.
+func (e encoder) isRedacted(fd pref.FieldDescriptor) bool {
+	if e.opts.Redact && redact.IsRedacted(fd) {
+		return true
+	}
+	return e.opts.RedactFunc != nil && e.opts.RedactFunc(fd)
+}
+
+// leadingComments returns the leading comments of the declaration of fd in
+// the source information of its file, with the comment formatting removed.
+func leadingComments(fd pref.FieldDescriptor) string {
+	loc := fd.ParentFile().SourceLocations().ByDescriptor(fd)
+	lines := strings.Split(strings.TrimSuffix(loc.LeadingComments, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(strings.TrimPrefix(line, " "), " \t")
+	}
+	return strings.Join(lines, "\n")
+}
+
 // marshalSingular marshals the given non-repeated field value. This includes
 // all scalar types, enums, messages, and groups.
 func (e encoder) marshalSingular(val pref.Value, fd pref.FieldDescriptor) error {
@@ -337,8 +488,11 @@ func (e encoder) marshalExtensions(m pref.Message) error {
 		})
 		return true
 	})
-	// Sort extensions lexicographically.
+	// Sort extensions lexicographically, or by field number if Canonical.
 	sort.Slice(entries, func(i, j int) bool {
+		if e.opts.Canonical {
+			return entries[i].desc.Number() < entries[j].desc.Number()
+		}
 		return entries[i].key < entries[j].key
 	})
 
@@ -371,14 +525,28 @@ func (e encoder) marshalUnknown(b []byte) {
 		case protowire.Fixed32Type:
 			var v uint32
 			v, n = protowire.ConsumeFixed32(b)
+			if e.opts.EmitUnknownRaw {
+				e.WriteLiteral(fmt.Sprintf("0x%08x", v))
+				break
+			}
 			e.WriteLiteral("0x" + strconv.FormatUint(uint64(v), hex))
 		case protowire.Fixed64Type:
 			var v uint64
 			v, n = protowire.ConsumeFixed64(b)
+			if e.opts.EmitUnknownRaw {
+				e.WriteLiteral(fmt.Sprintf("0x%016x", v))
+				break
+			}
 			e.WriteLiteral("0x" + strconv.FormatUint(v, hex))
 		case protowire.BytesType:
 			var v []byte
 			v, n = protowire.ConsumeBytes(b)
+			if e.opts.EmitUnknownRaw && len(v) > 0 && isRawMessage(v) {
+				e.StartMessage()
+				e.marshalUnknown(v)
+				e.EndMessage()
+				break
+			}
 			e.WriteString(string(v))
 		case protowire.StartGroupType:
 			e.StartMessage()
@@ -394,16 +562,47 @@ func (e encoder) marshalUnknown(b []byte) {
 	}
 }
 
+// isRawMessage reports whether b parses as a sequence of fields, without
+// groups and with valid field numbers, that marshalUnknown writes in a form
+// which parses back into b.
+func isRawMessage(b []byte) bool {
+	for len(b) > 0 {
+		num, wtype, n := protowire.ConsumeTag(b)
+		if n < 0 || n != protowire.SizeTag(num) || !num.IsValid() {
+			return false
+		}
+		b = b[n:]
+		switch wtype {
+		case protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			if n >= 0 && n != protowire.SizeVarint(v) {
+				return false
+			}
+		case protowire.Fixed32Type, protowire.Fixed64Type, protowire.BytesType:
+			n = protowire.ConsumeFieldValue(num, wtype, b)
+		default:
+			return false
+		}
+		if n < 0 {
+			return false
+		}
+		b = b[n:]
+	}
+	return true
+}
+
 // marshalAny marshals the given google.protobuf.Any message in expanded form.
-// It returns true if it was able to marshal, else false.
-func (e encoder) marshalAny(any pref.Message) bool {
+// It returns an error if it was unable to marshal, in which case nothing is
+// written.
+func (e encoder) marshalAny(any pref.Message) error {
 	// Construct the embedded message.
 	fds := any.Descriptor().Fields()
 	fdType := fds.ByNumber(genid.Any_TypeUrl_field_number)
 	typeURL := any.Get(fdType).String()
-	mt, err := e.opts.Resolver.FindMessageByURL(typeURL)
+	mt, err := findMessageByURL(e.opts.ctx, e.opts.Resolver, e.opts.Fetcher, typeURL)
 	if err != nil {
-		return false
+		return errors.New("%s: unable to resolve %q: %v", genid.Any_message_fullname, typeURL, err)
 	}
 	m := mt.New().Interface()
 
@@ -415,7 +614,7 @@ func (e encoder) marshalAny(any pref.Message) bool {
 		Resolver:     e.opts.Resolver,
 	}.Unmarshal(value.Bytes(), m)
 	if err != nil {
-		return false
+		return errors.New("%s: unable to unmarshal %q: %v", genid.Any_message_fullname, typeURL, err)
 	}
 
 	// Get current encoder position. If marshaling fails, reset encoder output
@@ -427,7 +626,7 @@ func (e encoder) marshalAny(any pref.Message) bool {
 	err = e.marshalMessage(m.ProtoReflect(), true)
 	if err != nil {
 		e.Reset(pos)
-		return false
+		return err
 	}
-	return true
+	return nil
 }
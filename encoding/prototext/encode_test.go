@@ -12,13 +12,19 @@ import (
 
 	"google.golang.org/protobuf/encoding/prototext"
 	"google.golang.org/protobuf/internal/detrand"
+	"google.golang.org/protobuf/internal/filedesc"
 	"google.golang.org/protobuf/internal/flags"
+	"google.golang.org/protobuf/internal/genid"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
 	preg "google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/testing/protopack"
+	"google.golang.org/protobuf/types/dynamicpb"
 
 	pb2 "google.golang.org/protobuf/internal/testprotos/textpb2"
 	pb3 "google.golang.org/protobuf/internal/testprotos/textpb3"
+	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/known/anypb"
 )
 
@@ -166,6 +172,36 @@ opt_string: "谷歌"
 			OptString: proto.String("abc\xff"),
 		},
 		want: `opt_string: "abc\xff"
+`,
+	}, {
+		desc: "strings with EscapeUTF8",
+		mo:   prototext.MarshalOptions{StringEscaping: prototext.EscapeUTF8},
+		input: &pb2.Scalars{
+			OptBytes:  []byte("é\xff'"),
+			OptString: proto.String("é\n'"),
+		},
+		want: `opt_bytes: "é\xff'"
+opt_string: "é\n'"
+`,
+	}, {
+		desc: "strings with EscapeUnicode",
+		mo:   prototext.MarshalOptions{StringEscaping: prototext.EscapeUnicode},
+		input: &pb2.Scalars{
+			OptBytes:  []byte("é\xff'"),
+			OptString: proto.String("é\n'"),
+		},
+		want: `opt_bytes: "\u00e9\xff'"
+opt_string: "\u00e9\n'"
+`,
+	}, {
+		desc: "strings with EscapeOctal",
+		mo:   prototext.MarshalOptions{StringEscaping: prototext.EscapeOctal},
+		input: &pb2.Scalars{
+			OptBytes:  []byte("é\xff'\x00"),
+			OptString: proto.String("é\n'\x7f"),
+		},
+		want: `opt_bytes: "\303\251\377\'\000"
+opt_string: "\303\251\n\'\177"
 `,
 	}, {
 		desc: "proto3 string with invalid UTF-8",
@@ -961,6 +997,34 @@ req_nested: {}
   101: 0
   102: "inside a group"
 }
+`,
+	}, {
+		desc: "unknown fields in raw form",
+		mo:   prototext.MarshalOptions{EmitUnknownRaw: true},
+		input: func() proto.Message {
+			m := new(pb2.Scalars)
+			m.ProtoReflect().SetUnknown(protopack.Message{
+				protopack.Tag{101, protopack.VarintType}, protopack.Varint(0xff),
+				protopack.Tag{102, protopack.Fixed32Type}, protopack.Uint32(0x47),
+				protopack.Tag{103, protopack.Fixed64Type}, protopack.Int64(0xdeadbeef),
+				protopack.Tag{104, protopack.BytesType}, protopack.LengthPrefix{protopack.Message{
+					protopack.Tag{1, protopack.VarintType}, protopack.Bool(true),
+					protopack.Tag{2, protopack.BytesType}, protopack.String("nested"),
+				}},
+				protopack.Tag{105, protopack.BytesType}, protopack.String("hello world"),
+				protopack.Tag{106, protopack.BytesType}, protopack.Bytes(nil),
+			}.Marshal())
+			return m
+		}(),
+		want: `101: 255
+102: 0x00000047
+103: 0x00000000deadbeef
+104: {
+  1: 1
+  2: "nested"
+}
+105: "hello world"
+106: ""
 `,
 	}, {
 		desc: "unknown unpack repeated field",
@@ -1107,6 +1171,51 @@ opt_int32: 42
   }
 }
 [pb2.ExtensionsContainer.opt_ext_string]: "extension field"
+`,
+	}, {
+		desc: "Width with output that fits on one line",
+		mo:   prototext.MarshalOptions{Width: 80},
+		input: &pb2.Nests{
+			OptNested: &pb2.Nested{
+				OptString: proto.String("a"),
+			},
+			RptNested: []*pb2.Nested{{}, {OptString: proto.String("b")}},
+		},
+		want: `opt_nested: {opt_string: "a"} rpt_nested: {} rpt_nested: {opt_string: "b"}`,
+	}, {
+		desc: "Width with wrapped messages",
+		mo:   prototext.MarshalOptions{Width: 36},
+		input: &pb2.Nests{
+			OptNested: &pb2.Nested{
+				OptString: proto.String("a nested string value"),
+				OptNested: &pb2.Nested{
+					OptString: proto.String("inner"),
+				},
+			},
+			RptNested: []*pb2.Nested{{OptString: proto.String("b")}},
+		},
+		want: `opt_nested: {
+  opt_string: "a nested string value"
+  opt_nested: {opt_string: "inner"}
+}
+rpt_nested: {opt_string: "b"}
+`,
+	}, {
+		desc: "canonical extensions sorted by field number",
+		mo:   prototext.MarshalOptions{Canonical: true},
+		input: func() proto.Message {
+			m := &pb2.Extensions{OptString: proto.String("known")}
+			proto.SetExtension(m, pb2.E_ExtensionsContainer_OptExtString, "52")
+			proto.SetExtension(m, pb2.E_OptExtString, "22")
+			proto.SetExtension(m, pb2.E_ExtensionsContainer_OptExtBool, true)
+			proto.SetExtension(m, pb2.E_OptExtBool, false)
+			return m
+		}(),
+		want: `opt_string: "known"
+[pb2.opt_ext_bool]: false
+[pb2.opt_ext_string]: "22"
+[pb2.ExtensionsContainer.opt_ext_bool]: true
+[pb2.ExtensionsContainer.opt_ext_string]: "52"
 `,
 	}, {
 		desc: "extensions of repeated fields in another message",
@@ -1276,6 +1385,48 @@ value: "\n\x13embedded inside Any\x12\x0b\n\tinception"
 		},
 		want: `type_url: "foo/pb2.Nested"
 value: "\x80"
+`,
+	}, {
+		desc: "Any in raw form",
+		mo:   prototext.MarshalOptions{AnyFormat: prototext.AnyRaw},
+		input: &anypb.Any{
+			TypeUrl: "foo/pb2.Nested",
+			Value:   []byte("\n\x01x"),
+		},
+		want: `type_url: "foo/pb2.Nested"
+value: "\n\x01x"
+`,
+	}, {
+		desc: "Any in expanded form with unresolvable type",
+		mo: prototext.MarshalOptions{
+			AnyFormat: prototext.AnyExpanded,
+			Resolver:  new(preg.Types),
+		},
+		input: &anypb.Any{
+			TypeUrl: "foo/pb2.Nested",
+			Value:   []byte("\n\x01x"),
+		},
+		wantErr: true,
+	}, {
+		desc: "Any in expanded form with invalid value",
+		mo:   prototext.MarshalOptions{AnyFormat: prototext.AnyExpanded},
+		input: &pb2.KnownTypes{
+			OptAny: &anypb.Any{
+				TypeUrl: "foo/pb2.Nested",
+				Value:   []byte("\x80"),
+			},
+		},
+		wantErr: true,
+	}, {
+		desc: "Any in expanded form",
+		mo:   prototext.MarshalOptions{AnyFormat: prototext.AnyExpanded},
+		input: &anypb.Any{
+			TypeUrl: "foo/pb2.Nested",
+			Value:   []byte("\n\x01x"),
+		},
+		want: `[foo/pb2.Nested]: {
+  opt_string: "x"
+}
 `,
 	}, {
 		desc: "Any expanded in another message",
@@ -1435,3 +1586,186 @@ value: "\x80"
 		})
 	}
 }
+
+func TestMarshalRedact(t *testing.T) {
+	// The debug_redact option is not known to descriptorpb,
+	// so it is set as an unknown field of FieldOptions.
+	redacted := &descriptorpb.FieldOptions{}
+	redacted.ProtoReflect().SetUnknown(protopack.Message{
+		protopack.Tag{genid.FieldOptions_DebugRedact_field_number, protopack.VarintType}, protopack.Bool(true),
+	}.Marshal())
+	b, err := proto.Marshal(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("redact.proto"),
+		Package: proto.String("test.redact"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Message"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:   proto.String("public"),
+				Number: proto.Int32(1),
+				Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			}, {
+				Name:    proto.String("secret"),
+				Number:  proto.Int32(2),
+				Label:   descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:    descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				Options: redacted,
+			}, {
+				Name:     proto.String("secrets"),
+				Number:   proto.Int32(3),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+				TypeName: proto.String(".test.redact.Message"),
+				Options:  redacted,
+			}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := filedesc.Builder{RawDescriptor: b}.Build().File
+	m := dynamicpb.NewMessage(fd.Messages().Get(0))
+	if err := prototext.Unmarshal([]byte(`public: "a" secret: "b" secrets: {public: "c"}`), m); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		desc string
+		got  string
+		want string
+	}{{
+		desc: "Marshal",
+		got: func() string {
+			b, _ := prototext.Marshal(m)
+			return string(b)
+		}(),
+		want: `public:"a" secret:"b" secrets:{public:"c"}`,
+	}, {
+		desc: "Marshal with Redact",
+		got: func() string {
+			b, _ := prototext.MarshalOptions{Redact: true}.Marshal(m)
+			return string(b)
+		}(),
+		want: `public:"a" secret:[REDACTED] secrets:[REDACTED]`,
+	}, {
+		desc: "Marshal with RedactFunc",
+		got: func() string {
+			b, _ := prototext.MarshalOptions{
+				RedactFunc: func(fd pref.FieldDescriptor) bool {
+					return fd.Name() == "public"
+				},
+			}.Marshal(m)
+			return string(b)
+		}(),
+		want: `public:[REDACTED] secret:"b" secrets:{public:[REDACTED]}`,
+	}, {
+		desc: "Marshal with Redact and RedactFunc",
+		got: func() string {
+			b, _ := prototext.MarshalOptions{
+				Redact: true,
+				RedactFunc: func(fd pref.FieldDescriptor) bool {
+					return fd.Name() == "public"
+				},
+			}.Marshal(m)
+			return string(b)
+		}(),
+		want: `public:[REDACTED] secret:[REDACTED] secrets:[REDACTED]`,
+	}, {
+		desc: "Format",
+		got:  prototext.MarshalOptions{}.Format(m),
+		want: `public:"a" secret:[REDACTED] secrets:[REDACTED]`,
+	}} {
+		if test.got != test.want {
+			t.Errorf("%v: got %q, want %q", test.desc, test.got, test.want)
+		}
+	}
+}
+
+func TestMarshalComments(t *testing.T) {
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("comments.proto"),
+		Package: proto.String("test.comments"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Config"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:   proto.String("name"),
+				Number: proto.Int32(1),
+				Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			}, {
+				Name:     proto.String("backends"),
+				Number:   proto.Int32(2),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+				TypeName: proto.String(".test.comments.Config.Backend"),
+			}},
+			NestedType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Backend"),
+				Field: []*descriptorpb.FieldDescriptorProto{{
+					Name:   proto.String("address"),
+					Number: proto.Int32(1),
+					Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				}},
+			}},
+		}},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{
+			Location: []*descriptorpb.SourceCodeInfo_Location{{
+				Path:            []int32{4, 0, 2, 0},
+				Span:            []int32{1, 2, 20},
+				LeadingComments: proto.String(" The name of the service.\n"),
+			}, {
+				Path:            []int32{4, 0, 2, 1},
+				Span:            []int32{3, 2, 30},
+				LeadingComments: proto.String(" The backends to route to.\n\n Requests are balanced across them.\n"),
+			}, {
+				Path:            []int32{4, 0, 3, 0, 2, 0},
+				Span:            []int32{6, 4, 30},
+				LeadingComments: proto.String(" Address in host:port form.\n"),
+			}},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := dynamicpb.NewMessage(fd.Messages().Get(0))
+	if err := prototext.Unmarshal([]byte(`name: "web" backends: {address: "a:80"} backends: {address: "b:80"}`), m); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		desc string
+		mo   prototext.MarshalOptions
+		want string
+	}{{
+		desc: "multi-line",
+		mo:   prototext.MarshalOptions{Multiline: true, EmitComments: true},
+		want: `# The name of the service.
+name: "web"
+# The backends to route to.
+#
+# Requests are balanced across them.
+backends: {
+  # Address in host:port form.
+  address: "a:80"
+}
+backends: {
+  # Address in host:port form.
+  address: "b:80"
+}
+`,
+	}, {
+		desc: "single-line",
+		mo:   prototext.MarshalOptions{EmitComments: true},
+		want: `name:"web" backends:{address:"a:80"} backends:{address:"b:80"}`,
+	}} {
+		b, err := test.mo.Marshal(m)
+		if err != nil {
+			t.Errorf("%v: Marshal() returned error: %v", test.desc, err)
+			continue
+		}
+		if got := string(b); got != test.want {
+			t.Errorf("%v: Marshal() mismatch (-want +got):\n%v", test.desc, cmp.Diff(test.want, got))
+		}
+	}
+}
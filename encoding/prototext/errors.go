@@ -0,0 +1,100 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prototext
+
+import (
+	"fmt"
+)
+
+// ParseError is an error at a position in the textproto input.
+// Unmarshal returns a *ParseError for errors that are found in the input,
+// such as unknown fields or invalid values. With UnmarshalOptions.AllErrors,
+// it returns every such error in a ParseErrors.
+type ParseError struct {
+	// Line and Column are the position of the error in the input, starting at
+	// 1. The column counts runes.
+	Line, Column int
+
+	// Token is the text of the token at the position of the error, if any,
+	// such as the name of an unknown field or an invalid value.
+	Token string
+
+	// Err is the error, which includes the position.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseErrors is a list of errors in the textproto input, in the order they
+// appear in the input. It is returned by Unmarshal if
+// UnmarshalOptions.AllErrors is set.
+type ParseErrors []*ParseError
+
+func (e ParseErrors) Error() string {
+	switch len(e) {
+	case 0:
+		return "no errors"
+	case 1:
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more errors)", e[0], len(e)-1)
+}
+
+// tokenAt returns the text of the token starting at b[0]. A string token
+// extends to its closing quote, an extension or type URL name to its closing
+// bracket, and any other token to the next delimiter.
+func tokenAt(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	switch c := b[0]; c {
+	case '"', '\'':
+		for i := 1; i < len(b); i++ {
+			switch b[i] {
+			case '\\':
+				i++
+			case c:
+				return string(b[:i+1])
+			case '\n':
+				return string(b[:i])
+			}
+		}
+		return string(b)
+	case '[':
+		if len(b) == 1 || !isNameStart(b[1]) {
+			return "["
+		}
+		for i := 1; i < len(b); i++ {
+			switch b[i] {
+			case ']':
+				return string(b[:i+1])
+			case '\n':
+				return string(b[:i])
+			}
+		}
+		return string(b)
+	}
+	for i, c := range b {
+		switch c {
+		case ' ', '\t', '\n', '\r', ':', ',', ';', '{', '}', '<', '>', '[', ']', '#', '"', '\'':
+			if i == 0 {
+				return string(c)
+			}
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prototext
+
+import (
+	"bytes"
+	"strings"
+
+	"google.golang.org/protobuf/internal/errors"
+	"google.golang.org/protobuf/proto"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const includeHeader = "proto-include"
+
+// unmarshalWithIncludes unmarshals the textproto b into the empty message m,
+// after merging in the files named by its include directives. The stack
+// holds the paths of the files that include b, for detecting cycles.
+func (o UnmarshalOptions) unmarshalWithIncludes(b []byte, m pref.Message, stack []string) error {
+	paths, err := findIncludes(b)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return o.unmarshalText(b, m)
+	}
+	for _, path := range paths {
+		for _, p := range stack {
+			if p == path {
+				return errors.New("include cycle: %s -> %s", strings.Join(stack, " -> "), path)
+			}
+		}
+		inc, err := o.Opener(path)
+		if err != nil {
+			return errors.New("unable to include %s: %v", path, err)
+		}
+		im := m.New()
+		if err := o.unmarshalWithIncludes(inc, im, append(stack[:len(stack):len(stack)], path)); err != nil {
+			return includeError(path, err)
+		}
+		proto.Merge(m.Interface(), im.Interface())
+	}
+	fm := m.New()
+	if err := o.unmarshalText(b, fm); err != nil {
+		return err
+	}
+	proto.Merge(m.Interface(), fm.Interface())
+	return nil
+}
+
+// includeError returns err from the included file at path, with the path
+// prepended to its message.
+func includeError(path string, err error) error {
+	switch e := err.(type) {
+	case *ParseError:
+		return &ParseError{Line: e.Line, Column: e.Column, Token: e.Token, Err: errors.New("%s: %v", path, e.Err)}
+	case ParseErrors:
+		errs := make(ParseErrors, len(e))
+		for i := range e {
+			errs[i] = includeError(path, e[i]).(*ParseError)
+		}
+		return errs
+	}
+	return errors.New("%s: %v", path, err)
+}
+
+// findIncludes returns the paths of the include directives in the textproto b
+// that are outside of any message value. A path may be enclosed in quotes.
+func findIncludes(b []byte) ([]string, error) {
+	var paths []string
+	var scan streamScanner
+	for lineStart := 0; lineStart < len(b); {
+		line := b[lineStart:]
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i+1]
+		}
+		if scan.depth == 0 {
+			if path, ok := parseInclude(line); ok {
+				if path == "" {
+					n := bytes.Count(b[:lineStart], []byte("\n")) + 1
+					return nil, errors.New("(line %d:1): missing %s path", n, includeHeader)
+				}
+				paths = append(paths, path)
+			}
+		}
+		scan.scan(line)
+		lineStart += len(line)
+	}
+	return paths, nil
+}
+
+// parseInclude returns the path of an include directive line and whether
+// line is an include directive.
+func parseInclude(line []byte) (string, bool) {
+	s := strings.TrimSpace(string(line))
+	if !strings.HasPrefix(s, "#") {
+		return "", false
+	}
+	s = strings.TrimSpace(s[1:])
+	if !strings.HasPrefix(s, includeHeader+":") {
+		return "", false
+	}
+	s = strings.TrimSpace(s[len(includeHeader)+1:])
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		s = s[1 : len(s)-1]
+	}
+	return s, true
+}
@@ -5,11 +5,16 @@
 package prototext_test
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"testing"
 
 	"google.golang.org/protobuf/encoding/prototext"
 	"google.golang.org/protobuf/proto"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
 	preg "google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/testing/protopack"
 
 	pb2 "google.golang.org/protobuf/internal/testprotos/textpb2"
 	"google.golang.org/protobuf/types/known/anypb"
@@ -236,3 +241,116 @@ func TestRoundTrip(t *testing.T) {
 		})
 	}
 }
+
+func TestRoundTripUnknown(t *testing.T) {
+	want := protopack.Message{
+		protopack.Tag{101, protopack.VarintType}, protopack.Varint(-1),
+		protopack.Tag{102, protopack.Fixed32Type}, protopack.Uint32(0),
+		protopack.Tag{103, protopack.Fixed64Type}, protopack.Uint64(0xffffffffffffffff),
+		protopack.Tag{104, protopack.BytesType}, protopack.LengthPrefix{protopack.Message{
+			protopack.Tag{1, protopack.Fixed32Type}, protopack.Uint32(1),
+			protopack.Tag{2, protopack.BytesType}, protopack.LengthPrefix{protopack.Message{
+				protopack.Tag{3, protopack.VarintType}, protopack.Varint(3),
+			}},
+		}},
+		// Non-minimal varint, which must not be written as a message.
+		protopack.Tag{105, protopack.BytesType}, protopack.LengthPrefix{protopack.Message{
+			protopack.Tag{1, protopack.VarintType}, protopack.Raw("\x81\x00"),
+		}},
+		// Group, which must not be written as a message.
+		protopack.Tag{106, protopack.BytesType}, protopack.LengthPrefix{protopack.Message{
+			protopack.Tag{1, protopack.StartGroupType}, protopack.Tag{1, protopack.EndGroupType},
+		}},
+		protopack.Tag{107, protopack.BytesType}, protopack.Bytes("\xff\xfe"),
+	}.Marshal()
+
+	for _, multiline := range []bool{false, true} {
+		m := &pb2.Nested{OptString: proto.String("known")}
+		m.ProtoReflect().SetUnknown(want)
+		b, err := prototext.MarshalOptions{Multiline: multiline, EmitUnknownRaw: true}.Marshal(m)
+		if err != nil {
+			t.Fatalf("Marshal() returned error: %v", err)
+		}
+
+		got := new(pb2.Nested)
+		if err := (prototext.UnmarshalOptions{AllowFieldNumbers: true}).Unmarshal(b, got); err != nil {
+			t.Fatalf("Unmarshal() returned error: %v\n%s", err, b)
+		}
+		if got.GetOptString() != "known" {
+			t.Errorf("Unmarshal() opt_string = %q, want %q", got.GetOptString(), "known")
+		}
+		if !bytes.Equal(got.ProtoReflect().GetUnknown(), want) {
+			t.Errorf("Unmarshal() unknown fields mismatch\n<text>\n%s\n<got>\n%x\n<want>\n%x", b, got.ProtoReflect().GetUnknown(), want)
+		}
+	}
+}
+
+type ctxKey struct{}
+
+// testFetcher fetches the types in types, recording the type URLs and
+// the context values it was called with.
+type testFetcher struct {
+	types *preg.Types
+	calls []string
+}
+
+func (f *testFetcher) FetchMessageByURL(ctx context.Context, url string) (pref.MessageType, error) {
+	f.calls = append(f.calls, fmt.Sprintf("%v %v", ctx.Value(ctxKey{}), url))
+	return f.types.FindMessageByURL(url)
+}
+
+func TestAnyFetcher(t *testing.T) {
+	types := new(preg.Types)
+	if err := types.RegisterMessage((&pb2.Nested{}).ProtoReflect().Type()); err != nil {
+		t.Fatal(err)
+	}
+	b, err := proto.Marshal(&pb2.Nested{OptString: proto.String("fetched")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &anypb.Any{TypeUrl: "example.com/pb2.Nested", Value: b}
+	const want = `[example.com/pb2.Nested]:{opt_string:"fetched"}`
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	f := &testFetcher{types: types}
+	mo := prototext.MarshalOptions{Resolver: new(preg.Types), Fetcher: f}
+	got, err := mo.MarshalContext(ctx, m)
+	if err != nil {
+		t.Fatalf("MarshalContext error: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("MarshalContext:\ngot:  %s\nwant: %s", got, want)
+	}
+
+	m2 := &anypb.Any{}
+	umo := prototext.UnmarshalOptions{Resolver: new(preg.Types), Fetcher: f}
+	if err := umo.UnmarshalContext(ctx, got, m2); err != nil {
+		t.Fatalf("UnmarshalContext error: %v", err)
+	}
+	if !proto.Equal(m, m2) {
+		t.Errorf("UnmarshalContext:\ngot:  %v\nwant: %v", m2, m)
+	}
+	if err := umo.Unmarshal(got, m2); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+
+	wantCalls := []string{
+		"value example.com/pb2.Nested",
+		"value example.com/pb2.Nested",
+		"<nil> example.com/pb2.Nested",
+	}
+	if len(f.calls) != len(wantCalls) {
+		t.Fatalf("Fetcher calls = %q, want %q", f.calls, wantCalls)
+	}
+	for i := range f.calls {
+		if f.calls[i] != wantCalls[i] {
+			t.Errorf("Fetcher call %d = %q, want %q", i, f.calls[i], wantCalls[i])
+		}
+	}
+
+	// Errors from the Fetcher are reported.
+	f.types = new(preg.Types)
+	if err := umo.Unmarshal(got, m2); err == nil {
+		t.Errorf("Unmarshal with a failing Fetcher: got nil error, want error")
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prototext
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+
+	"google.golang.org/protobuf/internal/errors"
+	"google.golang.org/protobuf/proto"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// A stream of textproto messages is a sequence of messages in which each
+// message is preceded by header comments naming the file that declares the
+// message type and the full name of the message type:
+//
+//	# proto-file: path/to/file.proto
+//	# proto-message: package.Message
+//	field: "value"
+//
+// This follows the header convention for textproto files used by C++ and
+// other tools. A "# proto-file:" or "# proto-message:" line outside of any
+// message value starts a new message if the current message already has
+// fields or that header, so that each message is delimited by its header. Input without any headers is read
+// as a single message.
+
+// StreamHeader is the header of a message in a stream of textproto messages.
+type StreamHeader struct {
+	// File is the path of the file declaring the message type,
+	// from the "# proto-file:" header.
+	File string
+	// Message is the name of the message type,
+	// from the "# proto-message:" header.
+	Message string
+}
+
+const (
+	fileHeader    = "proto-file"
+	messageHeader = "proto-message"
+)
+
+// Encoder writes messages in the textproto format, each preceded by a
+// StreamHeader, to an output stream.
+type Encoder struct {
+	w    io.Writer
+	opts MarshalOptions
+	n    int // number of messages written
+	err  error
+}
+
+// NewEncoder returns an Encoder that writes to w using the options in o.
+func NewEncoder(w io.Writer, o MarshalOptions) *Encoder {
+	return &Encoder{w: w, opts: o}
+}
+
+// Encode writes m, preceded by its header, to the stream. The header names
+// the path of the file declaring the message type, if known, and the full
+// name of the message type. Messages are separated by a blank line.
+func (e *Encoder) Encode(m proto.Message) error {
+	if e.err != nil {
+		return e.err
+	}
+	if m == nil {
+		return errors.New("cannot encode nil message")
+	}
+	b, err := e.opts.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if e.n > 0 {
+		buf.WriteByte('\n')
+	}
+	md := m.ProtoReflect().Descriptor()
+	if fd := md.ParentFile(); fd != nil && fd.Path() != "" {
+		buf.WriteString("# " + fileHeader + ": " + fd.Path() + "\n")
+	}
+	buf.WriteString("# " + messageHeader + ": " + string(md.FullName()) + "\n")
+	buf.Write(b)
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	if _, e.err = e.w.Write(buf.Bytes()); e.err != nil {
+		return e.err
+	}
+	e.n++
+	return nil
+}
+
+// Default limit used when MaxMessageSize is zero.
+const defaultMaxMessageSize = 64 << 20
+
+// Decoder reads a stream of textproto messages from an input stream.
+// It is used as an iterator:
+//
+//	d := prototext.NewDecoder(r)
+//	for d.Next() {
+//		m, err := d.Message()
+//		...
+//	}
+//	if err := d.Err(); err != nil {
+//		...
+//	}
+//
+// Only the text of the current message is held in memory.
+type Decoder struct {
+	// Options are the options used to unmarshal each message.
+	// The Resolver is also used by Message to find message types.
+	Options UnmarshalOptions
+
+	// MaxMessageSize is the maximum size in bytes of the text of a single
+	// message. If zero, a default of 64 MiB is used.
+	MaxMessageSize int
+
+	r *bufio.Reader
+
+	header StreamHeader
+	text   []byte
+
+	// The header line read ahead for the next message.
+	next      StreamHeader
+	nextLines []byte
+
+	scan streamScanner
+	done bool
+	err  error
+}
+
+// NewDecoder returns a Decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Next advances to the next message in the stream and reports whether there
+// is one. It returns false at the end of the stream or when an error occurs,
+// which is reported by Err.
+func (d *Decoder) Next() bool {
+	if d.err != nil || d.done {
+		return false
+	}
+	maxSize := d.MaxMessageSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxMessageSize
+	}
+
+	d.header, d.text = d.next, append(d.text[:0], d.nextLines...)
+	d.next, d.nextLines = StreamHeader{}, d.nextLines[:0]
+	hasFields := false
+	for lineStart := true; ; {
+		line, err := d.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			err = nil
+		}
+		var name, value string
+		if lineStart && d.scan.depth == 0 {
+			name, value = parseStreamHeader(line)
+		}
+		switch {
+		case name == fileHeader && (d.header != StreamHeader{} || hasFields),
+			name == messageHeader && (d.header.Message != "" || hasFields):
+			// The line starts the next message.
+			d.nextLines = append(d.nextLines, line...)
+			if name == fileHeader {
+				d.next.File = value
+			} else {
+				d.next.Message = value
+			}
+			return true
+		case name == fileHeader:
+			d.header.File = value
+		case name == messageHeader:
+			d.header.Message = value
+		default:
+			if d.scan.scan(line) {
+				hasFields = true
+			}
+		}
+		if len(d.text)+len(line) > maxSize {
+			d.err = errors.New("textproto message exceeds the maximum size of %d bytes", maxSize)
+			return false
+		}
+		d.text = append(d.text, line...)
+		lineStart = len(line) > 0 && line[len(line)-1] == '\n'
+
+		if err == io.EOF {
+			d.done = true
+			return hasFields || d.header != StreamHeader{}
+		}
+		if err != nil {
+			d.err = err
+			return false
+		}
+	}
+}
+
+// Header returns the header of the current message.
+func (d *Decoder) Header() StreamHeader {
+	return d.header
+}
+
+// Bytes returns the text of the current message, including its header.
+// The slice is only valid until the next call to Next.
+func (d *Decoder) Bytes() []byte {
+	return d.text
+}
+
+// Decode unmarshals the current message into m.
+func (d *Decoder) Decode(m proto.Message) error {
+	return d.Options.Unmarshal(d.text, m)
+}
+
+// Message returns a new message of the type named by the header of the
+// current message, unmarshaled from the stream. A name in the header that is
+// not a full name is resolved relative to the package of the file in the
+// header, if the file is in protoregistry.GlobalFiles.
+func (d *Decoder) Message() (proto.Message, error) {
+	if d.header.Message == "" {
+		return nil, errors.New("message has no %s header", messageHeader)
+	}
+	resolver := d.Options.Resolver
+	if resolver == nil {
+		resolver = protoregistry.GlobalTypes
+	}
+	name := pref.FullName(d.header.Message)
+	mt, err := resolver.FindMessageByName(name)
+	if err == protoregistry.NotFound && d.header.File != "" {
+		if fd, ferr := protoregistry.GlobalFiles.FindFileByPath(d.header.File); ferr == nil && fd.Package() != "" {
+			mt, err = resolver.FindMessageByName(fd.Package().Append(pref.Name(name)))
+		}
+	}
+	if err != nil {
+		return nil, errors.New("unable to resolve %s %v: %v", messageHeader, name, err)
+	}
+	m := mt.New().Interface()
+	if err := d.Decode(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Err returns the first error that occurred while reading the stream.
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// streamScanner tracks the nesting of messages and lists in textproto input,
+// so that header lines within a message are not treated as the start of
+// the next message.
+type streamScanner struct {
+	depth   int
+	quote   byte // quote of the current string, if any
+	escaped bool
+	comment bool
+}
+
+// scan scans b, which continues the input scanned so far, and reports whether
+// it contains anything other than whitespace and comments.
+func (s *streamScanner) scan(b []byte) bool {
+	var content bool
+	for _, c := range b {
+		switch {
+		case c == '\n':
+			// Neither strings nor comments span lines.
+			s.quote, s.escaped, s.comment = 0, false, false
+		case s.comment:
+		case s.quote != 0:
+			switch {
+			case s.escaped:
+				s.escaped = false
+			case c == '\\':
+				s.escaped = true
+			case c == s.quote:
+				s.quote = 0
+			}
+		case c == '#':
+			s.comment = true
+		case c == ' ' || c == '\t' || c == '\r':
+		default:
+			content = true
+			switch c {
+			case '"', '\'':
+				s.quote = c
+			case '{', '<', '[':
+				s.depth++
+			case '}', '>', ']':
+				s.depth--
+			}
+		}
+	}
+	return content
+}
+
+// parseStreamHeader returns the name and value of a header comment line,
+// or empty strings if line is not a header.
+func parseStreamHeader(line []byte) (name, value string) {
+	s := strings.TrimSpace(string(line))
+	if !strings.HasPrefix(s, "#") {
+		return "", ""
+	}
+	s = strings.TrimSpace(s[1:])
+	for _, name := range []string{fileHeader, messageHeader} {
+		if strings.HasPrefix(s, name+":") {
+			return name, strings.TrimSpace(s[len(name)+1:])
+		}
+	}
+	return "", ""
+}
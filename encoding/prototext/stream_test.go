@@ -0,0 +1,181 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prototext_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/google/go-cmp/cmp"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+
+	pb2 "google.golang.org/protobuf/internal/testprotos/textpb2"
+	pb3 "google.golang.org/protobuf/internal/testprotos/textpb3"
+)
+
+func TestEncoder(t *testing.T) {
+	var got bytes.Buffer
+	enc := prototext.NewEncoder(&got, prototext.MarshalOptions{Multiline: true})
+	for _, m := range []proto.Message{
+		&pb3.Scalars{SString: "hello"},
+		&pb2.Nested{},
+		&pb2.Nests{OptNested: &pb2.Nested{OptString: proto.String("x")}},
+	} {
+		if err := enc.Encode(m); err != nil {
+			t.Fatalf("Encode() returned error: %v", err)
+		}
+	}
+	if err := enc.Encode(nil); err == nil {
+		t.Errorf("Encode(nil) got nil error, want error")
+	}
+	want := `# proto-file: internal/testprotos/textpb3/test.proto
+# proto-message: pb3.Scalars
+s_string: "hello"
+
+# proto-file: internal/testprotos/textpb2/test.proto
+# proto-message: pb2.Nested
+
+# proto-file: internal/testprotos/textpb2/test.proto
+# proto-message: pb2.Nests
+opt_nested: {
+  opt_string: "x"
+}
+`
+	if diff := cmp.Diff(want, got.String()); diff != "" {
+		t.Errorf("Encode() output mismatch (-want +got):\n%v", diff)
+	}
+}
+
+func TestEncoderWriteError(t *testing.T) {
+	wantErr := errors.New("write error")
+	enc := prototext.NewEncoder(errWriter{wantErr}, prototext.MarshalOptions{})
+	for i := 0; i < 2; i++ {
+		if err := enc.Encode(&pb2.Nested{}); err != wantErr {
+			t.Errorf("Encode() returned error %v, want %v", err, wantErr)
+		}
+	}
+}
+
+type errWriter struct{ err error }
+
+func (w errWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestDecoder(t *testing.T) {
+	const in = `# Copyright notice.
+
+# proto-file: internal/testprotos/textpb3/test.proto
+# proto-message: pb3.Scalars
+s_string: "hello"  # proto-message: not a header
+
+# proto-message: pb2.Nested
+# proto-file: internal/testprotos/textpb2/test.proto
+# proto-message: Nests
+opt_nested: {
+  # proto-file: not a header within a message
+  opt_string: "x"
+}
+`
+	wantHeaders := []prototext.StreamHeader{
+		{File: "internal/testprotos/textpb3/test.proto", Message: "pb3.Scalars"},
+		{Message: "pb2.Nested"},
+		{File: "internal/testprotos/textpb2/test.proto", Message: "Nests"},
+	}
+	wantMessages := []proto.Message{
+		&pb3.Scalars{SString: "hello"},
+		&pb2.Nested{},
+		&pb2.Nests{OptNested: &pb2.Nested{OptString: proto.String("x")}},
+	}
+
+	for _, newReader := range []func(string) io.Reader{
+		func(s string) io.Reader { return strings.NewReader(s) },
+		func(s string) io.Reader { return iotest.OneByteReader(strings.NewReader(s)) },
+	} {
+		dec := prototext.NewDecoder(newReader(in))
+		var i int
+		for ; dec.Next(); i++ {
+			if i >= len(wantHeaders) {
+				t.Fatalf("Next() returned true for message %d, want false", i)
+			}
+			if got := dec.Header(); got != wantHeaders[i] {
+				t.Errorf("message %d: Header() = %+v, want %+v", i, got, wantHeaders[i])
+			}
+			m, err := dec.Message()
+			if err != nil {
+				t.Errorf("message %d: Message() returned error: %v", i, err)
+				continue
+			}
+			if !proto.Equal(m, wantMessages[i]) {
+				t.Errorf("message %d: Message() = %v, want %v", i, m, wantMessages[i])
+			}
+		}
+		if err := dec.Err(); err != nil {
+			t.Errorf("Err() = %v, want nil", err)
+		}
+		if i != len(wantHeaders) {
+			t.Errorf("read %d messages, want %d", i, len(wantHeaders))
+		}
+	}
+}
+
+func TestDecoderWithoutHeaders(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want int
+	}{
+		{in: "", want: 0},
+		{in: "# Only a comment.\n\n", want: 0},
+		{in: "opt_string: \"a\"\n\nopt_nested: {}", want: 1},
+	} {
+		dec := prototext.NewDecoder(strings.NewReader(tt.in))
+		var got int
+		for dec.Next() {
+			got++
+			m := new(pb2.Nested)
+			if err := dec.Decode(m); err != nil {
+				t.Errorf("Decode() returned error: %v", err)
+			}
+			if want := tt.in; string(dec.Bytes()) != want {
+				t.Errorf("Bytes() = %q, want %q", dec.Bytes(), want)
+			}
+		}
+		if got != tt.want {
+			t.Errorf("NewDecoder(%q) read %d messages, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	dec := prototext.NewDecoder(strings.NewReader("# proto-message: pb2.Unknown\n"))
+	if !dec.Next() {
+		t.Fatalf("Next() = false, want true")
+	}
+	if _, err := dec.Message(); err == nil || !strings.Contains(err.Error(), "unable to resolve") {
+		t.Errorf("Message() returned error %v, want unable to resolve error", err)
+	}
+
+	dec = prototext.NewDecoder(strings.NewReader("opt_string: \"" + strings.Repeat("x", 100) + "\"\n"))
+	dec.MaxMessageSize = 50
+	if dec.Next() {
+		t.Errorf("Next() = true, want false")
+	}
+	if err := dec.Err(); err == nil || !strings.Contains(err.Error(), "maximum size") {
+		t.Errorf("Err() = %v, want maximum size error", err)
+	}
+
+	wantErr := errors.New("read error")
+	dec = prototext.NewDecoder(io.MultiReader(strings.NewReader("opt_string: \"a\"\n"), iotest.ErrReader(wantErr)))
+	if dec.Next() {
+		t.Errorf("Next() = true, want false")
+	}
+	if err := dec.Err(); err != wantErr {
+		t.Errorf("Err() = %v, want %v", err, wantErr)
+	}
+}
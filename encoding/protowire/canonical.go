@@ -0,0 +1,243 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protowire
+
+import (
+	"bytes"
+	"sort"
+
+	"google.golang.org/protobuf/internal/errors"
+)
+
+// Canonicalize returns the canonical form of the message b in the wire format,
+// which is the same for any two encodings of the message that differ only in
+// the order of their fields or the encoding of their varints.
+// It is equivalent to CanonicalizeOptions{}.Canonicalize(b).
+func Canonicalize(b []byte) ([]byte, error) {
+	return CanonicalizeOptions{}.Canonicalize(b)
+}
+
+// CanonicalizeOptions configures how a message is canonicalized.
+// Without any information about the fields of the message, only the
+// structure of the wire format is canonicalized.
+type CanonicalizeOptions struct {
+	// Field, if non-nil, returns information about the field with the field
+	// number num of the message being canonicalized.
+	Field func(num Number) CanonicalField
+}
+
+// CanonicalField describes a field of a message for canonicalization.
+// The zero value describes a field that is not a message.
+type CanonicalField struct {
+	// Message, if non-nil, holds the options for canonicalizing the value of
+	// the field as a nested message. For a group field, it describes the
+	// fields of the group. For a map field, it describes the map entry.
+	Message *CanonicalizeOptions
+
+	// MapKey is the kind of the keys of a map field. For a map field, the
+	// records of the field are sorted by the key of each entry.
+	MapKey MapKeyKind
+}
+
+// MapKeyKind is the encoding of the keys of a map field, which
+// determines the order of the entries of the map.
+type MapKeyKind int8
+
+const (
+	// NotMapKey is the MapKeyKind of a field that is not a map field.
+	NotMapKey MapKeyKind = iota
+	// UnsignedKey orders keys that are unsigned integers,
+	// which includes bool, uint32, uint64, fixed32, and fixed64 keys.
+	UnsignedKey
+	// SignedKey orders keys that are signed integers in two's complement,
+	// which includes int32, int64, sfixed32, and sfixed64 keys.
+	SignedKey
+	// ZigZagKey orders keys that are signed integers in the zig-zag
+	// encoding, which includes sint32 and sint64 keys.
+	ZigZagKey
+	// BytesKey orders keys bytewise, which includes string keys.
+	BytesKey
+)
+
+// Canonicalize returns the canonical form of the message b in the wire format:
+//
+// 1. Fields are stably sorted by field number. The records of a field that
+// occurs more than once are kept in order and not merged.
+//
+// 2. Every tag, varint value, and length prefix uses its minimal encoding.
+//
+// 3. The fields of groups and of length-delimited fields described as
+// messages are canonicalized recursively.
+//
+// 4. The entries of map fields are sorted by key, where integer keys are
+// compared numerically and string keys bytewise. An entry without a key has
+// the zero key. Entries with equal keys are kept in order.
+//
+// The contents of other length-delimited fields are copied verbatim.
+func (o CanonicalizeOptions) Canonicalize(b []byte) ([]byte, error) {
+	return o.appendCanonical(nil, b, 0)
+}
+
+// A canonicalRecord is a canonicalized field record.
+type canonicalRecord struct {
+	num Number
+	raw []byte // canonicalized record, including its tag
+	// The wire type and encoded value of the key of a map entry.
+	keyTyp Type
+	key    []byte
+}
+
+// appendCanonical appends the canonical form of the message b to out.
+func (o CanonicalizeOptions) appendCanonical(out, b []byte, depth int) ([]byte, error) {
+	if depth > defaultMaxDepth {
+		return out, errors.New("exceeded maximum recursion depth")
+	}
+	var records []canonicalRecord
+	var mapKeys map[Number]MapKeyKind
+	for len(b) > 0 {
+		num, typ, n := ConsumeTag(b)
+		if n < 0 {
+			return out, ParseError(n)
+		}
+		b = b[n:]
+		var fi CanonicalField
+		if o.Field != nil {
+			fi = o.Field(num)
+		}
+		rec := canonicalRecord{num: num}
+		raw := AppendTag(nil, num, typ)
+		switch typ {
+		case VarintType:
+			v, n := ConsumeVarint(b)
+			if n < 0 {
+				return out, ParseError(n)
+			}
+			raw = AppendVarint(raw, v)
+			b = b[n:]
+		case Fixed32Type, Fixed64Type:
+			n := ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return out, ParseError(n)
+			}
+			raw = append(raw, b[:n]...)
+			b = b[n:]
+		case BytesType:
+			v, n := ConsumeBytes(b)
+			if n < 0 {
+				return out, ParseError(n)
+			}
+			b = b[n:]
+			if fi.Message != nil {
+				var err error
+				if v, err = fi.Message.appendCanonical(nil, v, depth+1); err != nil {
+					return out, err
+				}
+			}
+			if fi.MapKey != NotMapKey {
+				if mapKeys == nil {
+					mapKeys = make(map[Number]MapKeyKind)
+				}
+				mapKeys[num] = fi.MapKey
+				rec.keyTyp, rec.key = mapEntryKey(v)
+			}
+			raw = AppendBytes(raw, v)
+		case StartGroupType:
+			v, n := ConsumeGroup(num, b)
+			if n < 0 {
+				return out, ParseError(n)
+			}
+			b = b[n:]
+			opts := fi.Message
+			if opts == nil {
+				opts = &CanonicalizeOptions{}
+			}
+			var err error
+			if raw, err = opts.appendCanonical(raw, v, depth+1); err != nil {
+				return out, err
+			}
+			raw = AppendTag(raw, num, EndGroupType)
+		case EndGroupType:
+			return out, errEndGroup
+		default:
+			return out, errReserved
+		}
+		rec.raw = raw
+		records = append(records, rec)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		ri, rj := records[i], records[j]
+		if ri.num != rj.num {
+			return ri.num < rj.num
+		}
+		if kind, ok := mapKeys[ri.num]; ok {
+			return lessMapKey(kind, ri.keyTyp, ri.key, rj.keyTyp, rj.key)
+		}
+		return false
+	})
+	for _, rec := range records {
+		out = append(out, rec.raw...)
+	}
+	return out, nil
+}
+
+// mapEntryKey returns the wire type and encoded value of the key of the
+// map entry b, or a nil value if it has none.
+func mapEntryKey(b []byte) (Type, []byte) {
+	var typ Type
+	var key []byte
+	for len(b) > 0 {
+		num, t, n := ConsumeTag(b)
+		if n < 0 {
+			break
+		}
+		m := ConsumeFieldValue(num, t, b[n:])
+		if m < 0 {
+			break
+		}
+		if num == 1 {
+			typ, key = t, b[n:n+m]
+		}
+		b = b[n+m:]
+	}
+	return typ, key
+}
+
+// lessMapKey reports whether the encoded map key x orders before y.
+func lessMapKey(kind MapKeyKind, tx Type, x []byte, ty Type, y []byte) bool {
+	if kind == BytesKey {
+		vx, _ := ConsumeBytes(x)
+		vy, _ := ConsumeBytes(y)
+		return bytes.Compare(vx, vy) < 0
+	}
+	vx, vy := decodeMapKey(kind, tx, x), decodeMapKey(kind, ty, y)
+	switch kind {
+	case SignedKey:
+		return int64(vx) < int64(vy)
+	case ZigZagKey:
+		return DecodeZigZag(vx) < DecodeZigZag(vy)
+	}
+	return vx < vy
+}
+
+// decodeMapKey decodes the integer key b of the wire type typ. A missing key
+// is zero, and a signed 32-bit fixed-width key is sign-extended.
+func decodeMapKey(kind MapKeyKind, typ Type, b []byte) uint64 {
+	if b == nil {
+		return 0
+	}
+	switch typ {
+	case Fixed32Type:
+		v, _ := ConsumeFixed32(b)
+		if kind == SignedKey {
+			return uint64(int64(int32(v)))
+		}
+		return uint64(v)
+	case Fixed64Type:
+		v, _ := ConsumeFixed64(b)
+		return v
+	}
+	v, _ := ConsumeVarint(b)
+	return v
+}
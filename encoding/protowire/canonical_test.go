@@ -0,0 +1,136 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protowire
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	// entry returns a map entry field record with number 3.
+	entry := func(key []byte, value string) []byte {
+		return cat(AppendTag(nil, 3, BytesType), AppendBytes(nil, cat(key, AppendTag(nil, 2, BytesType), AppendString(nil, value))))
+	}
+	varintKey := func(v uint64) []byte { return cat(AppendTag(nil, 1, VarintType), AppendVarint(nil, v)) }
+	stringKey := func(s string) []byte { return cat(AppendTag(nil, 1, BytesType), AppendString(nil, s)) }
+	mapOpts := func(kind MapKeyKind) CanonicalizeOptions {
+		return CanonicalizeOptions{Field: func(num Number) CanonicalField {
+			if num == 3 {
+				return CanonicalField{Message: &CanonicalizeOptions{}, MapKey: kind}
+			}
+			return CanonicalField{}
+		}}
+	}
+	nestedOpts := CanonicalizeOptions{Field: func(num Number) CanonicalField {
+		if num == 4 {
+			return CanonicalField{Message: &CanonicalizeOptions{}}
+		}
+		return CanonicalField{}
+	}}
+
+	tests := []struct {
+		desc string
+		opts CanonicalizeOptions
+		in   []byte
+		want []byte
+	}{{
+		desc: "empty",
+	}, {
+		desc: "sorted by field number",
+		in: cat(
+			AppendTag(nil, 2, Fixed32Type), AppendFixed32(nil, 1),
+			AppendTag(nil, 1, VarintType), AppendVarint(nil, 1),
+			AppendTag(nil, 2, Fixed32Type), AppendFixed32(nil, 2),
+		),
+		want: cat(
+			AppendTag(nil, 1, VarintType), AppendVarint(nil, 1),
+			AppendTag(nil, 2, Fixed32Type), AppendFixed32(nil, 1),
+			AppendTag(nil, 2, Fixed32Type), AppendFixed32(nil, 2),
+		),
+	}, {
+		desc: "minimal varints",
+		in:   []byte{0x88, 0x00, 0x81, 0x80, 0x00, 0x92, 0x80, 0x00, 0x01, 'x'},
+		want: []byte{0x08, 0x01, 0x12, 0x01, 'x'},
+	}, {
+		desc: "groups",
+		in: cat(
+			AppendTag(nil, 5, StartGroupType),
+			AppendTag(nil, 2, VarintType), AppendVarint(nil, 2),
+			AppendTag(nil, 1, VarintType), AppendVarint(nil, 1),
+			AppendTag(nil, 5, EndGroupType),
+		),
+		want: cat(
+			AppendTag(nil, 5, StartGroupType),
+			AppendTag(nil, 1, VarintType), AppendVarint(nil, 1),
+			AppendTag(nil, 2, VarintType), AppendVarint(nil, 2),
+			AppendTag(nil, 5, EndGroupType),
+		),
+	}, {
+		desc: "bytes are verbatim without options",
+		in:   cat(AppendTag(nil, 4, BytesType), AppendBytes(nil, cat(AppendTag(nil, 2, VarintType), AppendVarint(nil, 2), AppendTag(nil, 1, VarintType), AppendVarint(nil, 1)))),
+		want: cat(AppendTag(nil, 4, BytesType), AppendBytes(nil, cat(AppendTag(nil, 2, VarintType), AppendVarint(nil, 2), AppendTag(nil, 1, VarintType), AppendVarint(nil, 1)))),
+	}, {
+		desc: "nested message",
+		opts: nestedOpts,
+		in:   cat(AppendTag(nil, 4, BytesType), AppendBytes(nil, cat(AppendTag(nil, 2, VarintType), AppendVarint(nil, 2), AppendTag(nil, 1, VarintType), AppendVarint(nil, 1)))),
+		want: cat(AppendTag(nil, 4, BytesType), AppendBytes(nil, cat(AppendTag(nil, 1, VarintType), AppendVarint(nil, 1), AppendTag(nil, 2, VarintType), AppendVarint(nil, 2)))),
+	}, {
+		desc: "unsigned map keys",
+		opts: mapOpts(UnsignedKey),
+		in:   cat(entry(varintKey(1<<40), "c"), entry(varintKey(2), "b"), entry(nil, "a"), entry(varintKey(2), "b2")),
+		want: cat(entry(nil, "a"), entry(varintKey(2), "b"), entry(varintKey(2), "b2"), entry(varintKey(1<<40), "c")),
+	}, {
+		desc: "signed map keys",
+		opts: mapOpts(SignedKey),
+		in:   cat(entry(varintKey(1), "b"), entry(varintKey(^uint64(0)), "a")),
+		want: cat(entry(varintKey(^uint64(0)), "a"), entry(varintKey(1), "b")),
+	}, {
+		desc: "signed fixed32 map keys",
+		opts: mapOpts(SignedKey),
+		in: cat(
+			entry(cat(AppendTag(nil, 1, Fixed32Type), AppendFixed32(nil, 1)), "b"),
+			entry(cat(AppendTag(nil, 1, Fixed32Type), AppendFixed32(nil, 0xffffffff)), "a"),
+		),
+		want: cat(
+			entry(cat(AppendTag(nil, 1, Fixed32Type), AppendFixed32(nil, 0xffffffff)), "a"),
+			entry(cat(AppendTag(nil, 1, Fixed32Type), AppendFixed32(nil, 1)), "b"),
+		),
+	}, {
+		desc: "zig-zag map keys",
+		opts: mapOpts(ZigZagKey),
+		in:   cat(entry(varintKey(EncodeZigZag(1)), "b"), entry(varintKey(EncodeZigZag(-5)), "a")),
+		want: cat(entry(varintKey(EncodeZigZag(-5)), "a"), entry(varintKey(EncodeZigZag(1)), "b")),
+	}, {
+		desc: "string map keys",
+		opts: mapOpts(BytesKey),
+		in:   cat(entry(stringKey("b"), "2"), entry(stringKey("ab"), "1"), entry(cat(AppendTag(nil, 2, BytesType), AppendString(nil, "0"), stringKey("a")), "")),
+		want: cat(entry(cat(stringKey("a"), AppendTag(nil, 2, BytesType), AppendString(nil, "0")), ""), entry(stringKey("ab"), "1"), entry(stringKey("b"), "2")),
+	}}
+	for _, tt := range tests {
+		got, err := tt.opts.Canonicalize(tt.in)
+		if err != nil {
+			t.Errorf("%s: Canonicalize() error: %v", tt.desc, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: Canonicalize() = %x, want %x", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalizeMalformed(t *testing.T) {
+	for _, in := range [][]byte{
+		{0x80},
+		cat(AppendTag(nil, 1, BytesType), AppendVarint(nil, 5), []byte("abc")),
+		cat(AppendTag(nil, 1, StartGroupType), AppendTag(nil, 2, EndGroupType)),
+		AppendTag(nil, 1, EndGroupType),
+		AppendVarint(nil, 1<<3|6),
+	} {
+		if _, err := Canonicalize(in); err == nil {
+			t.Errorf("Canonicalize(%x): got nil error, want error", in)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protowire
+
+import (
+	"io"
+
+	"google.golang.org/protobuf/internal/errors"
+)
+
+// Default limit used when MaxDepth is zero.
+const defaultMaxDepth = 10000
+
+// Decoder reads the fields of a message in the wire format one at a time,
+// from either a byte slice or an io.Reader. It is used as an iterator:
+//
+//	d := protowire.NewDecoder(b)
+//	for {
+//		num, typ, err := d.NextField()
+//		if err == io.EOF {
+//			break
+//		}
+//		if err != nil {
+//			return err
+//		}
+//		switch {
+//		case num == 1 && typ == protowire.VarintType:
+//			v, err := d.Varint()
+//			...
+//		default:
+//			err = d.Skip()
+//		}
+//	}
+//
+// The value of each field is read with the method for its wire type or
+// skipped with Skip. A value that is not read is skipped by the next call to
+// NextField. Errors in the input are sticky: once NextField or a value method
+// returns such an error, every subsequent call returns it, and Offset reports
+// where it was found.
+//
+// Alternatively, NextToken reads each field together with its value.
+type Decoder struct {
+	// MaxDepth is the maximum nesting depth of groups.
+	// If zero, a default of 10000 is used. If negative, it is not limited.
+	MaxDepth int
+
+	// MaxBytesSize is the maximum length in bytes of a length-delimited value.
+	// If zero or negative, it is only limited by the length of the input.
+	MaxBytesSize int
+
+	r    io.Reader // nil if reading from a byte slice
+	buf  []byte
+	off  int   // offset of the unconsumed input within buf
+	base int64 // offset in the input of buf[0]
+	rerr error // error returned by the last read from r
+
+	num     Number
+	typ     Type
+	tagOff  int64    // offset in the input of the tag of the current field
+	pending bool     // whether the value of the current field is unread
+	groups  []Number // field numbers of the enclosing groups
+
+	err error // sticky error for malformed input
+}
+
+// NewDecoder returns a Decoder that reads from b.
+// The byte slices returned by Bytes alias b.
+func NewDecoder(b []byte) *Decoder {
+	return &Decoder{buf: b, rerr: io.EOF}
+}
+
+// NewReaderDecoder returns a Decoder that reads from r.
+// The Decoder buffers its input and may read data from r beyond the
+// fields requested.
+func NewReaderDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Offset returns the offset in the input of the next byte to be read.
+// After an error in the input, it is the offset of the malformed data.
+func (d *Decoder) Offset() int64 {
+	return d.base + int64(d.off)
+}
+
+// Depth returns the number of groups enclosing the current field.
+func (d *Decoder) Depth() int {
+	return len(d.groups)
+}
+
+// NextField reads the tag of the next field and returns its field number and
+// wire type. It returns io.EOF at the end of the input.
+//
+// If the previous field is a group that is not skipped, NextField reads the
+// first field of the group. The end of a group is returned as a field of type
+// EndGroupType, which is verified to match the field number of the group.
+func (d *Decoder) NextField() (Number, Type, error) {
+	if d.err != nil {
+		return 0, 0, d.err
+	}
+	if d.pending {
+		if d.typ == StartGroupType {
+			if err := d.startGroup(d.num); err != nil {
+				return 0, 0, err
+			}
+		} else if err := d.skipValue(); err != nil {
+			return 0, 0, err
+		}
+		d.pending = false
+	}
+	if !d.ensure(1) {
+		if d.rerr != io.EOF {
+			return 0, 0, d.fail(d.rerr)
+		}
+		if len(d.groups) > 0 {
+			return 0, 0, d.fail(io.ErrUnexpectedEOF)
+		}
+		d.err = io.EOF
+		return 0, 0, io.EOF
+	}
+
+	num, typ, n := ConsumeTag(d.parse(ConsumeTag))
+	if n < 0 {
+		return 0, 0, d.fail(d.parseError(n))
+	}
+	d.tagOff = d.Offset()
+	switch typ {
+	case VarintType, Fixed32Type, Fixed64Type, BytesType, StartGroupType:
+	case EndGroupType:
+		if len(d.groups) == 0 || d.groups[len(d.groups)-1] != num {
+			return 0, 0, d.fail(errEndGroup)
+		}
+		d.off += n
+		d.groups = d.groups[:len(d.groups)-1]
+		return num, typ, nil
+	default:
+		return 0, 0, d.fail(errReserved)
+	}
+	d.off += n
+	d.num, d.typ, d.pending = num, typ, true
+	return num, typ, nil
+}
+
+// Varint reads the value of the current field, which must be of VarintType.
+func (d *Decoder) Varint() (uint64, error) {
+	if err := d.checkValue(VarintType); err != nil {
+		return 0, err
+	}
+	v, n := ConsumeVarint(d.parse(varintLen))
+	if n < 0 {
+		return 0, d.fail(d.parseError(n))
+	}
+	d.off += n
+	d.pending = false
+	return v, nil
+}
+
+// Fixed32 reads the value of the current field, which must be of Fixed32Type.
+func (d *Decoder) Fixed32() (uint32, error) {
+	if err := d.checkValue(Fixed32Type); err != nil {
+		return 0, err
+	}
+	if !d.ensure(4) {
+		return 0, d.fail(d.truncated())
+	}
+	v, n := ConsumeFixed32(d.buf[d.off:])
+	d.off += n
+	d.pending = false
+	return v, nil
+}
+
+// Fixed64 reads the value of the current field, which must be of Fixed64Type.
+func (d *Decoder) Fixed64() (uint64, error) {
+	if err := d.checkValue(Fixed64Type); err != nil {
+		return 0, err
+	}
+	if !d.ensure(8) {
+		return 0, d.fail(d.truncated())
+	}
+	v, n := ConsumeFixed64(d.buf[d.off:])
+	d.off += n
+	d.pending = false
+	return v, nil
+}
+
+// Bytes reads the value of the current field, which must be of BytesType.
+// The returned slice aliases the input of a Decoder created by NewDecoder,
+// and is otherwise only valid until the next call to the Decoder.
+func (d *Decoder) Bytes() ([]byte, error) {
+	if err := d.checkValue(BytesType); err != nil {
+		return nil, err
+	}
+	n, err := d.bytesLen()
+	if err != nil {
+		return nil, err
+	}
+	v := d.buf[d.off : d.off+n : d.off+n]
+	d.off += n
+	d.pending = false
+	return v, nil
+}
+
+// Skip skips the value of the current field. For a group, it skips all of the
+// fields of the group through its end.
+func (d *Decoder) Skip() error {
+	if d.err != nil {
+		return d.err
+	}
+	if !d.pending {
+		return errors.New("no field value to skip")
+	}
+	d.pending = false
+	if d.typ != StartGroupType {
+		return d.skipValue()
+	}
+	depth := len(d.groups)
+	if err := d.startGroup(d.num); err != nil {
+		return err
+	}
+	for len(d.groups) > depth {
+		if _, _, err := d.NextField(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkValue reports an error if the current field has no unread value of
+// the wire type typ.
+func (d *Decoder) checkValue(typ Type) error {
+	switch {
+	case d.err != nil:
+		return d.err
+	case !d.pending:
+		return errors.New("no field value to read")
+	case d.typ != typ:
+		return errors.New("cannot read field %d of wire type %d as wire type %d", d.num, d.typ, typ)
+	}
+	return nil
+}
+
+// skipValue skips the value of the current field, which is not a group.
+func (d *Decoder) skipValue() error {
+	var n int
+	switch d.typ {
+	case VarintType:
+		if _, n = ConsumeVarint(d.parse(varintLen)); n < 0 {
+			return d.fail(d.parseError(n))
+		}
+	case Fixed32Type, Fixed64Type:
+		n = 4
+		if d.typ == Fixed64Type {
+			n = 8
+		}
+		if !d.ensure(n) {
+			return d.fail(d.truncated())
+		}
+	case BytesType:
+		var err error
+		if n, err = d.bytesLen(); err != nil {
+			return err
+		}
+	}
+	d.off += n
+	return nil
+}
+
+// bytesLen reads the length prefix of a length-delimited value and returns
+// the length once the value is available at d.off.
+func (d *Decoder) bytesLen() (int, error) {
+	v, n := ConsumeVarint(d.parse(varintLen))
+	if n < 0 {
+		return 0, d.fail(d.parseError(n))
+	}
+	if d.MaxBytesSize > 0 && v > uint64(d.MaxBytesSize) {
+		return 0, d.fail(errors.New("length-delimited value of %d bytes exceeds the maximum of %d bytes", v, d.MaxBytesSize))
+	}
+	if v > uint64(int(^uint(0)>>1)-n) {
+		return 0, d.fail(io.ErrUnexpectedEOF)
+	}
+	if !d.ensure(n + int(v)) {
+		return 0, d.fail(d.truncated())
+	}
+	d.off += n
+	return int(v), nil
+}
+
+// startGroup enters the group with the field number num.
+func (d *Decoder) startGroup(num Number) error {
+	maxDepth := d.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = defaultMaxDepth
+	}
+	if maxDepth > 0 && len(d.groups) >= maxDepth {
+		return d.fail(errors.New("exceeded maximum group depth of %d", maxDepth))
+	}
+	d.groups = append(d.groups, num)
+	return nil
+}
+
+// fail sets the sticky error to err and returns it.
+func (d *Decoder) fail(err error) error {
+	d.err = err
+	return err
+}
+
+// parseError returns the error for the error code n.
+func (d *Decoder) parseError(n int) error {
+	if n == errCodeTruncated {
+		return d.truncated()
+	}
+	return ParseError(n)
+}
+
+// truncated returns the error for input that ends in the middle of a value.
+func (d *Decoder) truncated() error {
+	if d.rerr != io.EOF {
+		return d.rerr
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// varintLen is ConsumeVarint with the signature of the argument of parse.
+func varintLen(b []byte) (Number, Type, int) {
+	_, n := ConsumeVarint(b)
+	return 0, 0, n
+}
+
+// parse returns the unconsumed input after reading enough input for consume
+// to not report it as truncated, or all of the input if there is no more.
+func (d *Decoder) parse(consume func([]byte) (Number, Type, int)) []byte {
+	for {
+		if _, _, n := consume(d.buf[d.off:]); n != errCodeTruncated || !d.fill() {
+			return d.buf[d.off:]
+		}
+	}
+}
+
+// ensure reads input until at least n bytes are unconsumed, and reports
+// whether there are.
+func (d *Decoder) ensure(n int) bool {
+	for len(d.buf)-d.off < n {
+		if !d.fill() {
+			return false
+		}
+	}
+	return true
+}
+
+// fill reads more input into buf and reports whether any was read.
+func (d *Decoder) fill() bool {
+	if d.r == nil || d.rerr != nil {
+		return false
+	}
+	if d.off > 0 {
+		n := copy(d.buf, d.buf[d.off:])
+		d.buf = d.buf[:n]
+		d.base += int64(d.off)
+		d.off = 0
+	}
+	if len(d.buf) == cap(d.buf) {
+		d.buf = append(d.buf, make([]byte, 4096)...)[:len(d.buf)]
+	}
+	for {
+		n, err := d.r.Read(d.buf[len(d.buf):cap(d.buf)])
+		d.buf = d.buf[:len(d.buf)+n]
+		if err != nil {
+			d.rerr = err
+		}
+		if n > 0 || err != nil {
+			return n > 0
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protowire
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// decodeAll reads every field of d, reading the values of fields 1 to 4 and
+// skipping the others, and returns a description of the fields.
+func decodeAll(d *Decoder) (string, error) {
+	var out []string
+	for {
+		num, typ, err := d.NextField()
+		if err == io.EOF {
+			return strings.Join(out, " "), nil
+		}
+		if err != nil {
+			return strings.Join(out, " "), err
+		}
+		var s string
+		switch {
+		case typ == EndGroupType:
+			s = fmt.Sprintf("%d:end", num)
+		case typ == StartGroupType && num < 5:
+			s = fmt.Sprintf("%d:start", num)
+		case typ == VarintType && num < 5:
+			var v uint64
+			v, err = d.Varint()
+			s = fmt.Sprintf("%d:%d", num, v)
+		case typ == Fixed32Type && num < 5:
+			var v uint32
+			v, err = d.Fixed32()
+			s = fmt.Sprintf("%d:0x%x", num, v)
+		case typ == Fixed64Type && num < 5:
+			var v uint64
+			v, err = d.Fixed64()
+			s = fmt.Sprintf("%d:0x%x", num, v)
+		case typ == BytesType && num < 5:
+			var v []byte
+			v, err = d.Bytes()
+			s = fmt.Sprintf("%d:%q", num, v)
+		default:
+			err = d.Skip()
+			s = fmt.Sprintf("%d:skip", num)
+		}
+		if err != nil {
+			return strings.Join(out, " "), err
+		}
+		out = append(out, s)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	tests := []struct {
+		desc       string
+		in         []byte
+		maxDepth   int
+		maxBytes   int
+		want       string
+		wantErr    error
+		wantOffset int64
+	}{{
+		desc: "empty",
+	}, {
+		desc: "scalars",
+		in: cat(
+			AppendTag(nil, 1, VarintType), AppendVarint(nil, 150),
+			AppendTag(nil, 2, Fixed32Type), AppendFixed32(nil, 0xdeadbeef),
+			AppendTag(nil, 3, Fixed64Type), AppendFixed64(nil, 0x0123456789abcdef),
+			AppendTag(nil, 4, BytesType), AppendString(nil, "hello"),
+		),
+		want:       `1:150 2:0xdeadbeef 3:0x123456789abcdef 4:"hello"`,
+		wantOffset: 24,
+	}, {
+		desc: "skipped fields",
+		in: cat(
+			AppendTag(nil, 5, VarintType), AppendVarint(nil, 1<<40),
+			AppendTag(nil, 6, Fixed32Type), AppendFixed32(nil, 1),
+			AppendTag(nil, 7, Fixed64Type), AppendFixed64(nil, 1),
+			AppendTag(nil, 8, BytesType), AppendString(nil, strings.Repeat("x", 5000)),
+			AppendTag(nil, 9, StartGroupType),
+			AppendTag(nil, 1, VarintType), AppendVarint(nil, 1),
+			AppendTag(nil, 9, EndGroupType),
+			AppendTag(nil, 1, VarintType), AppendVarint(nil, 2),
+		),
+		want:       "5:skip 6:skip 7:skip 8:skip 9:skip 1:2",
+		wantOffset: 5030,
+	}, {
+		desc: "groups",
+		in: cat(
+			AppendTag(nil, 1, StartGroupType),
+			AppendTag(nil, 2, StartGroupType),
+			AppendTag(nil, 3, VarintType), AppendVarint(nil, 1),
+			AppendTag(nil, 2, EndGroupType),
+			AppendTag(nil, 1, EndGroupType),
+		),
+		want:       "1:start 2:start 3:1 2:end 1:end",
+		wantOffset: 6,
+	}, {
+		desc:       "truncated tag",
+		in:         []byte{0x80},
+		wantErr:    io.ErrUnexpectedEOF,
+		wantOffset: 0,
+	}, {
+		desc:       "truncated bytes",
+		in:         cat(AppendTag(nil, 1, VarintType), AppendVarint(nil, 1), AppendTag(nil, 4, BytesType), AppendVarint(nil, 10), []byte("abc")),
+		want:       "1:1",
+		wantErr:    io.ErrUnexpectedEOF,
+		wantOffset: 3,
+	}, {
+		desc:       "truncated skipped fixed64",
+		in:         cat(AppendTag(nil, 7, Fixed64Type), []byte{1, 2, 3}),
+		wantErr:    io.ErrUnexpectedEOF,
+		wantOffset: 1,
+	}, {
+		desc:       "invalid field number",
+		in:         AppendTag(nil, 0, VarintType),
+		wantErr:    errFieldNumber,
+		wantOffset: 0,
+	}, {
+		desc:       "reserved wire type",
+		in:         AppendVarint(nil, 1<<3|6),
+		wantErr:    errReserved,
+		wantOffset: 0,
+	}, {
+		desc:       "unmatched end group",
+		in:         cat(AppendTag(nil, 1, StartGroupType), AppendTag(nil, 2, EndGroupType)),
+		want:       "1:start",
+		wantErr:    errEndGroup,
+		wantOffset: 1,
+	}, {
+		desc:       "end group at top level",
+		in:         AppendTag(nil, 1, EndGroupType),
+		wantErr:    errEndGroup,
+		wantOffset: 0,
+	}, {
+		desc:       "unterminated group",
+		in:         cat(AppendTag(nil, 1, StartGroupType), AppendTag(nil, 3, VarintType), AppendVarint(nil, 1)),
+		want:       "1:start 3:1",
+		wantErr:    io.ErrUnexpectedEOF,
+		wantOffset: 3,
+	}, {
+		desc: "group depth limit",
+		in: cat(
+			AppendTag(nil, 1, StartGroupType),
+			AppendTag(nil, 2, StartGroupType),
+			AppendTag(nil, 3, StartGroupType),
+		),
+		maxDepth:   2,
+		want:       "1:start 2:start 3:start",
+		wantErr:    errorString("exceeded maximum group depth of 2"),
+		wantOffset: 3,
+	}, {
+		desc:       "bytes size limit",
+		in:         cat(AppendTag(nil, 4, BytesType), AppendString(nil, "hello")),
+		maxBytes:   4,
+		wantErr:    errorString("length-delimited value of 5 bytes exceeds the maximum of 4 bytes"),
+		wantOffset: 1,
+	}}
+
+	for _, tt := range tests {
+		for _, reader := range []bool{false, true} {
+			d := NewDecoder(tt.in)
+			if reader {
+				d = NewReaderDecoder(iotest.OneByteReader(bytes.NewReader(tt.in)))
+			}
+			d.MaxDepth = tt.maxDepth
+			d.MaxBytesSize = tt.maxBytes
+			got, err := decodeAll(d)
+			if got != tt.want {
+				t.Errorf("%s (reader %v): got %s, want %s", tt.desc, reader, got, tt.want)
+			}
+			if !matchError(err, tt.wantErr) {
+				t.Errorf("%s (reader %v): error = %v, want %v", tt.desc, reader, err, tt.wantErr)
+			}
+			if d.Offset() != tt.wantOffset {
+				t.Errorf("%s (reader %v): Offset() = %d, want %d", tt.desc, reader, d.Offset(), tt.wantOffset)
+			}
+			if err != nil {
+				if _, _, err2 := d.NextField(); err2 != err {
+					t.Errorf("%s (reader %v): error is not sticky: got %v, want %v", tt.desc, reader, err2, err)
+				}
+			}
+		}
+	}
+}
+
+func TestDecoderMisuse(t *testing.T) {
+	d := NewDecoder(cat(AppendTag(nil, 1, VarintType), AppendVarint(nil, 1)))
+	if _, err := d.Varint(); err == nil {
+		t.Errorf("Varint() before NextField: got nil error, want error")
+	}
+	if _, _, err := d.NextField(); err != nil {
+		t.Fatalf("NextField() error: %v", err)
+	}
+	if _, err := d.Bytes(); err == nil {
+		t.Errorf("Bytes() of varint field: got nil error, want error")
+	}
+	if v, err := d.Varint(); err != nil || v != 1 {
+		t.Errorf("Varint() = %v, %v, want 1, nil", v, err)
+	}
+	if err := d.Skip(); err == nil {
+		t.Errorf("Skip() after reading the value: got nil error, want error")
+	}
+	if _, _, err := d.NextField(); err != io.EOF {
+		t.Errorf("NextField() at end = %v, want io.EOF", err)
+	}
+}
+
+// errorString is an error compared by its message.
+type errorString string
+
+func (e errorString) Error() string { return string(e) }
+
+func matchError(got, want error) bool {
+	if got == nil || want == nil {
+		return got == want
+	}
+	if s, ok := want.(errorString); ok {
+		return strings.Contains(got.Error(), string(s))
+	}
+	return got == want
+}
+
+func cat(bs ...[]byte) []byte {
+	return bytes.Join(bs, nil)
+}
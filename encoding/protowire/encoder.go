@@ -0,0 +1,125 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protowire
+
+// Encoder appends fields in the wire format to a byte slice. Unlike the
+// Append functions, it can write a length-delimited value, such as a nested
+// message, without knowing its length in advance:
+//
+//	e := protowire.NewEncoder(nil)
+//	e.AppendTag(1, protowire.BytesType)
+//	e.StartBytes()
+//	e.AppendTag(1, protowire.VarintType)
+//	e.AppendVarint(150)
+//	e.EndBytes()
+//	b := e.Bytes()
+//
+// This allows nested messages to be serialized in a single pass, without
+// first computing the size of each message.
+type Encoder struct {
+	b     []byte
+	opens []int // start offsets of the values between StartBytes and EndBytes
+}
+
+// NewEncoder returns an Encoder that appends to b.
+func NewEncoder(b []byte) *Encoder {
+	return &Encoder{b: b}
+}
+
+// Bytes returns the encoded fields, including the slice passed to NewEncoder.
+// It panics if a value started by StartBytes has not been ended.
+func (e *Encoder) Bytes() []byte {
+	if len(e.opens) > 0 {
+		panic("protowire: Bytes called with an unended length-delimited value")
+	}
+	return e.b
+}
+
+// Depth returns the number of values started by StartBytes that have not
+// been ended.
+func (e *Encoder) Depth() int {
+	return len(e.opens)
+}
+
+// AppendTag appends a tag.
+func (e *Encoder) AppendTag(num Number, typ Type) {
+	e.b = AppendTag(e.b, num, typ)
+}
+
+// AppendVarint appends v as a varint.
+func (e *Encoder) AppendVarint(v uint64) {
+	e.b = AppendVarint(e.b, v)
+}
+
+// AppendFixed32 appends v as a little-endian uint32.
+func (e *Encoder) AppendFixed32(v uint32) {
+	e.b = AppendFixed32(e.b, v)
+}
+
+// AppendFixed64 appends v as a little-endian uint64.
+func (e *Encoder) AppendFixed64(v uint64) {
+	e.b = AppendFixed64(e.b, v)
+}
+
+// AppendBytes appends v as a length-prefixed bytes value.
+func (e *Encoder) AppendBytes(v []byte) {
+	e.b = AppendBytes(e.b, v)
+}
+
+// AppendString appends v as a length-prefixed bytes value.
+func (e *Encoder) AppendString(v string) {
+	e.b = AppendString(e.b, v)
+}
+
+// StartBytes starts a length-delimited value whose contents are the data
+// appended until the matching call to EndBytes. Values may be nested.
+func (e *Encoder) StartBytes() {
+	var start int
+	e.b, start = StartBytes(e.b)
+	e.opens = append(e.opens, start)
+}
+
+// EndBytes ends the innermost value started by StartBytes and writes its
+// length prefix. It panics if there is no such value.
+func (e *Encoder) EndBytes() {
+	if len(e.opens) == 0 {
+		panic("protowire: EndBytes called without StartBytes")
+	}
+	start := e.opens[len(e.opens)-1]
+	e.opens = e.opens[:len(e.opens)-1]
+	e.b = EndBytes(e.b, start)
+}
+
+// StartBytes appends a placeholder for the length prefix of a
+// length-delimited value and returns the offset in the result at which the
+// contents of the value start. The contents are appended to the result
+// and the value is completed with EndBytes.
+//
+// This is the form of Encoder.StartBytes for code that appends to a byte
+// slice directly, such as the marshal functions of generated messages.
+func StartBytes(b []byte) ([]byte, int) {
+	b = append(b, 0)
+	return b, len(b)
+}
+
+// EndBytes writes the length prefix of the value whose contents are b[start:],
+// where start was returned by StartBytes, and returns the updated slice.
+//
+// The placeholder holds a length of up to 127 bytes. The contents of a longer
+// value are moved to make room for the longer varint.
+func EndBytes(b []byte, start int) []byte {
+	n := len(b) - start
+	if n < 1<<7 {
+		b[start-1] = byte(n)
+		return b
+	}
+	extra := SizeVarint(uint64(n)) - 1
+	for i := 0; i < extra; i++ {
+		b = append(b, 0)
+	}
+	copy(b[start+extra:], b[start:start+n])
+	AppendVarint(b[:start-1], uint64(n))
+	return b
+}
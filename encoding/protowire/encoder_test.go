@@ -0,0 +1,71 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protowire
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+	for _, n := range []int{0, 1, 127, 128, 300, 1 << 14, 1<<14 + 1, 1 << 21} {
+		payload := strings.Repeat("x", n)
+
+		// A bytes value nested in two messages.
+		inner := cat(AppendTag(nil, 1, VarintType), AppendVarint(nil, 150), AppendTag(nil, 2, BytesType), AppendString(nil, payload))
+		middle := cat(AppendTag(nil, 3, BytesType), AppendBytes(nil, inner), AppendTag(nil, 4, Fixed32Type), AppendFixed32(nil, 1))
+		want := cat([]byte("prefix"), AppendTag(nil, 5, BytesType), AppendBytes(nil, middle), AppendTag(nil, 6, Fixed64Type), AppendFixed64(nil, 2))
+
+		e := NewEncoder([]byte("prefix"))
+		e.AppendTag(5, BytesType)
+		e.StartBytes()
+		e.AppendTag(3, BytesType)
+		e.StartBytes()
+		e.AppendTag(1, VarintType)
+		e.AppendVarint(150)
+		e.AppendTag(2, BytesType)
+		e.AppendString(payload)
+		if got := e.Depth(); got != 2 {
+			t.Errorf("length %d: Depth() = %d, want 2", n, got)
+		}
+		e.EndBytes()
+		e.AppendTag(4, Fixed32Type)
+		e.AppendFixed32(1)
+		e.EndBytes()
+		e.AppendTag(6, Fixed64Type)
+		e.AppendFixed64(2)
+		if got := e.Bytes(); !bytes.Equal(got, want) {
+			t.Errorf("length %d: Encoder output does not match appended output", n)
+		}
+	}
+}
+
+func TestEncoderEmptyBytes(t *testing.T) {
+	b, start := StartBytes([]byte{1})
+	b = EndBytes(b, start)
+	if want := []byte{1, 0}; !bytes.Equal(b, want) {
+		t.Errorf("EndBytes of empty value = %x, want %x", b, want)
+	}
+}
+
+func TestEncoderMisuse(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		f    func(e *Encoder)
+	}{
+		{"EndBytes without StartBytes", func(e *Encoder) { e.EndBytes() }},
+		{"Bytes with unended value", func(e *Encoder) { e.StartBytes(); e.Bytes() }},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: did not panic", tt.desc)
+				}
+			}()
+			tt.f(NewEncoder(nil))
+		}()
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protowire
+
+import "google.golang.org/protobuf/internal/errors"
+
+// The functions in this file operate on the top-level field records of a
+// message in the wire format without decoding the rest of the message,
+// such as to read or rewrite a single field of a large message.
+// Fields within nested messages and groups are not considered.
+
+// FindField returns the offsets in b of the start and end of the last
+// top-level field record with the field number num, including its tag.
+// It returns -1, -1 if there is no such record.
+//
+// For a field with multiple records, the last record holds the value of a
+// scalar field, while the records of a message or repeated field are
+// combined when the message is decoded.
+func FindField(b []byte, num Number) (start, end int, err error) {
+	start, end = -1, -1
+	err = rangeFields(b, num, func(s, e int) {
+		start, end = s, e
+	})
+	if err != nil {
+		return -1, -1, err
+	}
+	return start, end, nil
+}
+
+// FieldValue returns the wire type and value of the last top-level field
+// record in b with the field number num, and reports whether there is one.
+// The value of a length-delimited field is its contents without the length
+// prefix and the value of a group is its fields without the end group marker.
+// Any other value is its encoded bytes. The value aliases b.
+func FieldValue(b []byte, num Number) (typ Type, v []byte, ok bool, err error) {
+	start, end, err := FindField(b, num)
+	if err != nil || start < 0 {
+		return 0, nil, false, err
+	}
+	_, typ, n := ConsumeTag(b[start:end])
+	v = b[start+n : end]
+	switch typ {
+	case BytesType:
+		v, _ = ConsumeBytes(v)
+	case StartGroupType:
+		v, _ = ConsumeGroup(num, v)
+	}
+	return typ, v, true, nil
+}
+
+// DeleteField removes every top-level field record in b with the field
+// number num and returns the result. The contents of b are overwritten,
+// unless b is malformed, in which case it is returned unmodified.
+func DeleteField(b []byte, num Number) ([]byte, error) {
+	var records [][2]int
+	if err := rangeFields(b, num, func(start, end int) {
+		records = append(records, [2]int{start, end})
+	}); err != nil {
+		return b, err
+	}
+	out := b[:0]
+	last := 0
+	for _, r := range records {
+		out = append(out, b[last:r[0]]...)
+		last = r[1]
+	}
+	return append(out, b[last:]...), nil
+}
+
+// ReplaceField returns a copy of b in which the field record f replaces the
+// top-level field records in b with the field number num. The record f is
+// placed at the position of the first such record, or at the end if there
+// is none. It must be a single, complete field record with the field
+// number num, such as produced by appending a tag and a value.
+func ReplaceField(b []byte, num Number, f []byte) ([]byte, error) {
+	if fnum, _, n := ConsumeField(f); n < 0 || n != len(f) || fnum != num {
+		return b, errors.New("invalid replacement for field %d", num)
+	}
+	out := make([]byte, 0, len(b)+len(f))
+	last, found := 0, false
+	err := rangeFields(b, num, func(start, end int) {
+		out = append(out, b[last:start]...)
+		if !found {
+			out = append(out, f...)
+			found = true
+		}
+		last = end
+	})
+	if err != nil {
+		return b, err
+	}
+	out = append(out, b[last:]...)
+	if !found {
+		out = append(out, f...)
+	}
+	return out, nil
+}
+
+// rangeFields calls f with the offsets of the start and end of each top-level
+// field record in b with the field number num, in order. It returns an error
+// if b is malformed.
+func rangeFields(b []byte, num Number, f func(start, end int)) error {
+	for off := 0; off < len(b); {
+		fnum, _, n := ConsumeField(b[off:])
+		if n < 0 {
+			return ParseError(n)
+		}
+		if fnum == num {
+			f(off, off+n)
+		}
+		off += n
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protowire
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestFields(t *testing.T) {
+	f1a := cat(AppendTag(nil, 1, BytesType), AppendString(nil, "first"))
+	f1b := cat(AppendTag(nil, 1, BytesType), AppendString(nil, "second"))
+	f2 := cat(AppendTag(nil, 2, VarintType), AppendVarint(nil, 300))
+	f3 := cat(AppendTag(nil, 3, StartGroupType), f1a, AppendTag(nil, 3, EndGroupType))
+	b := cat(f1a, f2, f3, f1b)
+
+	if start, end, err := FindField(b, 1); err != nil || start != len(b)-len(f1b) || end != len(b) {
+		t.Errorf("FindField(1) = %d, %d, %v; want %d, %d, nil", start, end, err, len(b)-len(f1b), len(b))
+	}
+	if start, end, err := FindField(b, 4); err != nil || start != -1 || end != -1 {
+		t.Errorf("FindField(4) = %d, %d, %v; want -1, -1, nil", start, end, err)
+	}
+
+	for _, tt := range []struct {
+		num     Number
+		wantTyp Type
+		want    []byte
+		wantOK  bool
+	}{
+		{1, BytesType, []byte("second"), true},
+		{2, VarintType, AppendVarint(nil, 300), true},
+		{3, StartGroupType, f1a, true},
+		{4, 0, nil, false},
+	} {
+		typ, v, ok, err := FieldValue(b, tt.num)
+		if err != nil || typ != tt.wantTyp || !bytes.Equal(v, tt.want) || ok != tt.wantOK {
+			t.Errorf("FieldValue(%d) = %v, %q, %v, %v; want %v, %q, %v, nil", tt.num, typ, v, ok, err, tt.wantTyp, tt.want, tt.wantOK)
+		}
+	}
+
+	f1new := cat(AppendTag(nil, 1, BytesType), AppendString(nil, "replacement"))
+	if got, err := ReplaceField(b, 1, f1new); err != nil || !bytes.Equal(got, cat(f1new, f2, f3)) {
+		t.Errorf("ReplaceField(1) = %x, %v; want %x, nil", got, err, cat(f1new, f2, f3))
+	}
+	f4 := cat(AppendTag(nil, 4, Fixed32Type), AppendFixed32(nil, 1))
+	if got, err := ReplaceField(b, 4, f4); err != nil || !bytes.Equal(got, cat(b, f4)) {
+		t.Errorf("ReplaceField(4) = %x, %v; want %x, nil", got, err, cat(b, f4))
+	}
+	for _, f := range [][]byte{f4, cat(f1new, f1new), f1new[:len(f1new)-1]} {
+		if _, err := ReplaceField(b, 1, f); err == nil {
+			t.Errorf("ReplaceField(1, %x): got nil error, want error", f)
+		}
+	}
+
+	if got, err := DeleteField(cat(b), 1); err != nil || !bytes.Equal(got, cat(f2, f3)) {
+		t.Errorf("DeleteField(1) = %x, %v; want %x, nil", got, err, cat(f2, f3))
+	}
+	if got, err := DeleteField(cat(b), 3); err != nil || !bytes.Equal(got, cat(f1a, f2, f1b)) {
+		t.Errorf("DeleteField(3) = %x, %v; want %x, nil", got, err, cat(f1a, f2, f1b))
+	}
+}
+
+func TestFieldsMalformed(t *testing.T) {
+	b := cat(AppendTag(nil, 1, VarintType), AppendVarint(nil, 1), AppendTag(nil, 2, BytesType), AppendVarint(nil, 5), []byte("abc"))
+	orig := cat(b)
+	if _, _, err := FindField(b, 1); err != io.ErrUnexpectedEOF {
+		t.Errorf("FindField error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if _, _, _, err := FieldValue(b, 1); err != io.ErrUnexpectedEOF {
+		t.Errorf("FieldValue error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if _, err := ReplaceField(b, 1, cat(AppendTag(nil, 1, VarintType), AppendVarint(nil, 2))); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReplaceField error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if _, err := DeleteField(b, 1); err != io.ErrUnexpectedEOF {
+		t.Errorf("DeleteField error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if !bytes.Equal(b, orig) {
+		t.Errorf("malformed input was modified")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protowire
+
+// The functions in this file encode and decode the contents of packed repeated
+// fields of fixed-width types as whole slices, which is about as fast as
+// copying the values on little-endian platforms. The contents do not include
+// the tag and the length prefix of the field.
+
+// AppendPackedFixed32 appends v to b as the contents of a packed repeated
+// fixed32 field.
+func AppendPackedFixed32(b []byte, v []uint32) []byte {
+	return appendPacked32(b, v)
+}
+
+// AppendPackedFixed64 appends v to b as the contents of a packed repeated
+// fixed64 field.
+func AppendPackedFixed64(b []byte, v []uint64) []byte {
+	return appendPacked64(b, v)
+}
+
+// AppendPackedSfixed32 appends v to b as the contents of a packed repeated
+// sfixed32 field.
+func AppendPackedSfixed32(b []byte, v []int32) []byte {
+	return appendPackedSfixed32(b, v)
+}
+
+// AppendPackedSfixed64 appends v to b as the contents of a packed repeated
+// sfixed64 field.
+func AppendPackedSfixed64(b []byte, v []int64) []byte {
+	return appendPackedSfixed64(b, v)
+}
+
+// AppendPackedFloat appends v to b as the contents of a packed repeated
+// float field.
+func AppendPackedFloat(b []byte, v []float32) []byte {
+	return appendPackedFloat(b, v)
+}
+
+// AppendPackedDouble appends v to b as the contents of a packed repeated
+// double field.
+func AppendPackedDouble(b []byte, v []float64) []byte {
+	return appendPackedDouble(b, v)
+}
+
+// ConsumePackedFixed32 parses b as the contents of a packed repeated fixed32
+// field, appending the values to s, and returns the resulting slice and
+// the length of b. This returns a negative length upon an error (see ParseError).
+func ConsumePackedFixed32(s []uint32, b []byte) ([]uint32, int) {
+	if len(b)%4 != 0 {
+		return s, errCodeTruncated
+	}
+	return consumePacked32(s, b), len(b)
+}
+
+// ConsumePackedFixed64 parses b as the contents of a packed repeated fixed64
+// field, appending the values to s, and returns the resulting slice and
+// the length of b. This returns a negative length upon an error (see ParseError).
+func ConsumePackedFixed64(s []uint64, b []byte) ([]uint64, int) {
+	if len(b)%8 != 0 {
+		return s, errCodeTruncated
+	}
+	return consumePacked64(s, b), len(b)
+}
+
+// ConsumePackedSfixed32 parses b as the contents of a packed repeated sfixed32
+// field, appending the values to s, and returns the resulting slice and
+// the length of b. This returns a negative length upon an error (see ParseError).
+func ConsumePackedSfixed32(s []int32, b []byte) ([]int32, int) {
+	if len(b)%4 != 0 {
+		return s, errCodeTruncated
+	}
+	return consumePackedSfixed32(s, b), len(b)
+}
+
+// ConsumePackedSfixed64 parses b as the contents of a packed repeated sfixed64
+// field, appending the values to s, and returns the resulting slice and
+// the length of b. This returns a negative length upon an error (see ParseError).
+func ConsumePackedSfixed64(s []int64, b []byte) ([]int64, int) {
+	if len(b)%8 != 0 {
+		return s, errCodeTruncated
+	}
+	return consumePackedSfixed64(s, b), len(b)
+}
+
+// ConsumePackedFloat parses b as the contents of a packed repeated float
+// field, appending the values to s, and returns the resulting slice and
+// the length of b. This returns a negative length upon an error (see ParseError).
+func ConsumePackedFloat(s []float32, b []byte) ([]float32, int) {
+	if len(b)%4 != 0 {
+		return s, errCodeTruncated
+	}
+	return consumePackedFloat(s, b), len(b)
+}
+
+// ConsumePackedDouble parses b as the contents of a packed repeated double
+// field, appending the values to s, and returns the resulting slice and
+// the length of b. This returns a negative length upon an error (see ParseError).
+func ConsumePackedDouble(s []float64, b []byte) ([]float64, int) {
+	if len(b)%8 != 0 {
+		return s, errCodeTruncated
+	}
+	return consumePackedDouble(s, b), len(b)
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protowire
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestPacked(t *testing.T) {
+	v32 := []uint32{0, 1, 0xdeadbeef, math.MaxUint32}
+	var want32 []byte
+	for _, v := range v32 {
+		want32 = AppendFixed32(want32, v)
+	}
+	v64 := []uint64{0, 1, 0x0123456789abcdef, math.MaxUint64}
+	var want64 []byte
+	for _, v := range v64 {
+		want64 = AppendFixed64(want64, v)
+	}
+	vd := []float64{0, -1.5, math.Inf(1), math.SmallestNonzeroFloat64}
+	var wantd []byte
+	for _, v := range vd {
+		wantd = AppendFixed64(wantd, math.Float64bits(v))
+	}
+
+	vs32 := []int32{0, -1, math.MinInt32, math.MaxInt32}
+	var wants32 []byte
+	for _, v := range vs32 {
+		wants32 = AppendFixed32(wants32, uint32(v))
+	}
+	vs64 := []int64{0, -1, math.MinInt64, math.MaxInt64}
+	var wants64 []byte
+	for _, v := range vs64 {
+		wants64 = AppendFixed64(wants64, uint64(v))
+	}
+	vf := []float32{0, -1.5, float32(math.Inf(-1)), math.SmallestNonzeroFloat32}
+	var wantf []byte
+	for _, v := range vf {
+		wantf = AppendFixed32(wantf, math.Float32bits(v))
+	}
+
+	prefix := []byte("prefix")
+	if got := AppendPackedFixed32(prefix, v32); !bytes.Equal(got, cat(prefix, want32)) {
+		t.Errorf("AppendPackedFixed32 = %x, want %x", got, cat(prefix, want32))
+	}
+	if got := AppendPackedFixed64(prefix, v64); !bytes.Equal(got, cat(prefix, want64)) {
+		t.Errorf("AppendPackedFixed64 = %x, want %x", got, cat(prefix, want64))
+	}
+	if got := AppendPackedDouble(prefix, vd); !bytes.Equal(got, cat(prefix, wantd)) {
+		t.Errorf("AppendPackedDouble = %x, want %x", got, cat(prefix, wantd))
+	}
+	if got := AppendPackedSfixed32(prefix, vs32); !bytes.Equal(got, cat(prefix, wants32)) {
+		t.Errorf("AppendPackedSfixed32 = %x, want %x", got, cat(prefix, wants32))
+	}
+	if got := AppendPackedSfixed64(prefix, vs64); !bytes.Equal(got, cat(prefix, wants64)) {
+		t.Errorf("AppendPackedSfixed64 = %x, want %x", got, cat(prefix, wants64))
+	}
+	if got := AppendPackedFloat(prefix, vf); !bytes.Equal(got, cat(prefix, wantf)) {
+		t.Errorf("AppendPackedFloat = %x, want %x", got, cat(prefix, wantf))
+	}
+	if got := AppendPackedFixed32(prefix, nil); !bytes.Equal(got, prefix) {
+		t.Errorf("AppendPackedFixed32 of no values = %x, want %x", got, prefix)
+	}
+
+	if got, n := ConsumePackedFixed32([]uint32{7}, want32); n != len(want32) || !reflect.DeepEqual(got, append([]uint32{7}, v32...)) {
+		t.Errorf("ConsumePackedFixed32 = %v, %d; want %v, %d", got, n, append([]uint32{7}, v32...), len(want32))
+	}
+	if got, n := ConsumePackedFixed64(nil, want64); n != len(want64) || !reflect.DeepEqual(got, v64) {
+		t.Errorf("ConsumePackedFixed64 = %v, %d; want %v, %d", got, n, v64, len(want64))
+	}
+	if got, n := ConsumePackedDouble(nil, wantd); n != len(wantd) || !reflect.DeepEqual(got, vd) {
+		t.Errorf("ConsumePackedDouble = %v, %d; want %v, %d", got, n, vd, len(wantd))
+	}
+	if got, n := ConsumePackedSfixed32(nil, wants32); n != len(wants32) || !reflect.DeepEqual(got, vs32) {
+		t.Errorf("ConsumePackedSfixed32 = %v, %d; want %v, %d", got, n, vs32, len(wants32))
+	}
+	if got, n := ConsumePackedSfixed64(nil, wants64); n != len(wants64) || !reflect.DeepEqual(got, vs64) {
+		t.Errorf("ConsumePackedSfixed64 = %v, %d; want %v, %d", got, n, vs64, len(wants64))
+	}
+	if got, n := ConsumePackedFloat(nil, wantf); n != len(wantf) || !reflect.DeepEqual(got, vf) {
+		t.Errorf("ConsumePackedFloat = %v, %d; want %v, %d", got, n, vf, len(wantf))
+	}
+	if got, n := ConsumePackedFixed32(nil, nil); n != 0 || len(got) != 0 {
+		t.Errorf("ConsumePackedFixed32 of no values = %v, %d; want [], 0", got, n)
+	}
+
+	if _, n := ConsumePackedFixed32(nil, want32[:5]); n >= 0 {
+		t.Errorf("ConsumePackedFixed32 of truncated input = %d, want error", n)
+	}
+	if _, n := ConsumePackedFixed64(nil, want64[:9]); n >= 0 {
+		t.Errorf("ConsumePackedFixed64 of truncated input = %d, want error", n)
+	}
+	if _, n := ConsumePackedDouble(nil, wantd[:7]); n >= 0 {
+		t.Errorf("ConsumePackedDouble of truncated input = %d, want error", n)
+	}
+	if _, n := ConsumePackedSfixed32(nil, wants32[:3]); n >= 0 {
+		t.Errorf("ConsumePackedSfixed32 of truncated input = %d, want error", n)
+	}
+	if _, n := ConsumePackedSfixed64(nil, wants64[:12]); n >= 0 {
+		t.Errorf("ConsumePackedSfixed64 of truncated input = %d, want error", n)
+	}
+	if _, n := ConsumePackedFloat(nil, wantf[:6]); n >= 0 {
+		t.Errorf("ConsumePackedFloat of truncated input = %d, want error", n)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protowire
+
+import "io"
+
+// The functions in this file operate on a stream of length-prefixed records,
+// in which each record, typically a serialized message, is preceded by its
+// length as a varint. A record is appended to a stream with AppendBytes and
+// read with ConsumeBytes.
+
+// CountRecords returns the number of records in the stream b.
+// It returns an error if the last record is incomplete or a length is invalid.
+func CountRecords(b []byte) (int, error) {
+	var count int
+	for len(b) > 0 {
+		_, n := ConsumeBytes(b)
+		if n < 0 {
+			return count, ParseError(n)
+		}
+		b = b[n:]
+		count++
+	}
+	return count, nil
+}
+
+// SplitRecords returns the records in the stream b, without their length
+// prefixes. The records alias b. If the last record is incomplete or a length
+// is invalid, it returns the records before it and an error.
+func SplitRecords(b []byte) ([][]byte, error) {
+	var records [][]byte
+	for len(b) > 0 {
+		v, n := ConsumeBytes(b)
+		if n < 0 {
+			return records, ParseError(n)
+		}
+		records = append(records, v)
+		b = b[n:]
+	}
+	return records, nil
+}
+
+// ScanRecords is a split function for a bufio.Scanner that returns each
+// record in a stream of length-prefixed records, without its length prefix.
+// The size of the buffer of the Scanner limits the size of a record.
+func ScanRecords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	v, n := ConsumeBytes(data)
+	switch {
+	case n == errCodeTruncated && atEOF:
+		return 0, nil, io.ErrUnexpectedEOF
+	case n == errCodeTruncated:
+		return 0, nil, nil // request more data
+	case n < 0:
+		return 0, nil, ParseError(n)
+	}
+	return n, v, nil
+}
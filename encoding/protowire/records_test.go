@@ -0,0 +1,68 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protowire
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestRecords(t *testing.T) {
+	records := [][]byte{[]byte("a"), {}, []byte(strings.Repeat("x", 300)), []byte("last")}
+	var stream []byte
+	for _, r := range records {
+		stream = AppendBytes(stream, r)
+	}
+
+	if n, err := CountRecords(stream); n != len(records) || err != nil {
+		t.Errorf("CountRecords() = %d, %v; want %d, nil", n, err, len(records))
+	}
+	got, err := SplitRecords(stream)
+	if err != nil || !reflect.DeepEqual(got, records) {
+		t.Errorf("SplitRecords() = %q, %v; want %q, nil", got, err, records)
+	}
+	if len(got) > 0 && &got[0][0] != &stream[1] {
+		t.Errorf("SplitRecords() copied the records")
+	}
+
+	s := bufio.NewScanner(iotest.OneByteReader(bytes.NewReader(stream)))
+	s.Split(ScanRecords)
+	got = nil
+	for s.Scan() {
+		got = append(got, append([]byte{}, s.Bytes()...))
+	}
+	if err := s.Err(); err != nil || !reflect.DeepEqual(got, records) {
+		t.Errorf("Scanner with ScanRecords = %q, %v; want %q, nil", got, err, records)
+	}
+
+	// A truncated last record.
+	truncated := stream[:len(stream)-1]
+	if n, err := CountRecords(truncated); n != len(records)-1 || err != io.ErrUnexpectedEOF {
+		t.Errorf("CountRecords(truncated) = %d, %v; want %d, %v", n, err, len(records)-1, io.ErrUnexpectedEOF)
+	}
+	if got, err := SplitRecords(truncated); len(got) != len(records)-1 || err != io.ErrUnexpectedEOF {
+		t.Errorf("SplitRecords(truncated) = %d records, %v; want %d, %v", len(got), err, len(records)-1, io.ErrUnexpectedEOF)
+	}
+	s = bufio.NewScanner(bytes.NewReader(truncated))
+	s.Split(ScanRecords)
+	var n int
+	for s.Scan() {
+		n++
+	}
+	if n != len(records)-1 || s.Err() != io.ErrUnexpectedEOF {
+		t.Errorf("Scanner(truncated) = %d records, %v; want %d, %v", n, s.Err(), len(records)-1, io.ErrUnexpectedEOF)
+	}
+
+	// An invalid length.
+	overflow := bytes.Repeat([]byte{0xff}, 11)
+	if _, err := CountRecords(overflow); err != errOverflow {
+		t.Errorf("CountRecords(overflow) error = %v, want %v", err, errOverflow)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protowire
+
+import "fmt"
+
+// TokenKind is the kind of a Token.
+type TokenKind int8
+
+const (
+	_ TokenKind = iota
+	// ScalarToken is a field of VarintType, Fixed32Type, or Fixed64Type.
+	ScalarToken
+	// LengthDelimitedToken is a field of BytesType.
+	LengthDelimitedToken
+	// StartGroupToken is the start of a group, which is followed by the
+	// tokens of the fields of the group and an EndGroupToken.
+	StartGroupToken
+	// EndGroupToken is the end of a group.
+	EndGroupToken
+)
+
+func (k TokenKind) String() string {
+	switch k {
+	case ScalarToken:
+		return "Scalar"
+	case LengthDelimitedToken:
+		return "LengthDelimited"
+	case StartGroupToken:
+		return "StartGroup"
+	case EndGroupToken:
+		return "EndGroup"
+	default:
+		return fmt.Sprintf("<unknown:%d>", k)
+	}
+}
+
+// Token is a field record, or the start or end of a group, in the wire format.
+type Token struct {
+	Kind   TokenKind
+	Number Number
+	Type   Type
+
+	// Depth is the number of groups enclosing the token. The tokens for the
+	// start and end of a group have the depth of the group itself.
+	Depth int
+
+	// Offset is the offset in the input of the tag of the token.
+	Offset int64
+
+	// Scalar is the value of a ScalarToken. A Fixed32Type value is
+	// zero-extended.
+	Scalar uint64
+
+	// Bytes is the value of a LengthDelimitedToken, without the length prefix.
+	// It is subject to the aliasing rules of Decoder.Bytes.
+	Bytes []byte
+}
+
+// NextToken reads the next token in the input, reading the value of the field
+// as well as its tag. It returns io.EOF at the end of the input.
+//
+// Unlike NextField, it does not skip groups: the fields of every group are
+// returned between the tokens for the start and end of the group, so that
+// arbitrary data in the wire format can be walked without a descriptor.
+// As with NextField, an unread value of a field returned by NextField is
+// skipped first.
+func (d *Decoder) NextToken() (Token, error) {
+	num, typ, err := d.NextField()
+	if err != nil {
+		return Token{}, err
+	}
+	tok := Token{Number: num, Type: typ, Depth: d.Depth(), Offset: d.tagOff}
+	switch typ {
+	case VarintType, Fixed64Type:
+		tok.Kind = ScalarToken
+		if typ == VarintType {
+			tok.Scalar, err = d.Varint()
+		} else {
+			tok.Scalar, err = d.Fixed64()
+		}
+	case Fixed32Type:
+		tok.Kind = ScalarToken
+		var v uint32
+		v, err = d.Fixed32()
+		tok.Scalar = uint64(v)
+	case BytesType:
+		tok.Kind = LengthDelimitedToken
+		tok.Bytes, err = d.Bytes()
+	case StartGroupType:
+		tok.Kind = StartGroupToken
+	case EndGroupType:
+		tok.Kind = EndGroupToken
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	return tok, nil
+}
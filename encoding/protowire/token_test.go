@@ -0,0 +1,71 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protowire
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestNextToken(t *testing.T) {
+	in := cat(
+		AppendTag(nil, 1, VarintType), AppendVarint(nil, 150),
+		AppendTag(nil, 2, StartGroupType),
+		AppendTag(nil, 3, Fixed32Type), AppendFixed32(nil, 0xffffffff),
+		AppendTag(nil, 4, StartGroupType),
+		AppendTag(nil, 5, BytesType), AppendString(nil, "hello"),
+		AppendTag(nil, 4, EndGroupType),
+		AppendTag(nil, 2, EndGroupType),
+		AppendTag(nil, 6, Fixed64Type), AppendFixed64(nil, 1),
+	)
+	want := strings.Join([]string{
+		"0@0 Scalar 1:0 150 \"\"",
+		"0@3 StartGroup 2:3 0 \"\"",
+		"1@4 Scalar 3:5 4294967295 \"\"",
+		"1@9 StartGroup 4:3 0 \"\"",
+		"2@10 LengthDelimited 5:2 0 \"hello\"",
+		"1@17 EndGroup 4:4 0 \"\"",
+		"0@18 EndGroup 2:4 0 \"\"",
+		"0@19 Scalar 6:1 1 \"\"",
+	}, "\n")
+
+	for _, reader := range []bool{false, true} {
+		d := NewDecoder(in)
+		if reader {
+			d = NewReaderDecoder(iotest.OneByteReader(bytes.NewReader(in)))
+		}
+		var got []string
+		for {
+			tok, err := d.NextToken()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("reader %v: NextToken error: %v", reader, err)
+			}
+			got = append(got, fmt.Sprintf("%d@%d %v %d:%d %d %q", tok.Depth, tok.Offset, tok.Kind, tok.Number, tok.Type, tok.Scalar, tok.Bytes))
+		}
+		if s := strings.Join(got, "\n"); s != want {
+			t.Errorf("reader %v: tokens:\n%s\nwant:\n%s", reader, s, want)
+		}
+	}
+}
+
+func TestNextTokenError(t *testing.T) {
+	d := NewDecoder(cat(AppendTag(nil, 1, StartGroupType), AppendTag(nil, 2, BytesType), AppendVarint(nil, 3)))
+	if tok, err := d.NextToken(); err != nil || tok.Kind != StartGroupToken {
+		t.Fatalf("NextToken() = %v, %v; want StartGroup token", tok, err)
+	}
+	if _, err := d.NextToken(); err != io.ErrUnexpectedEOF {
+		t.Errorf("NextToken() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if d.Offset() != 2 {
+		t.Errorf("Offset() = %d, want 2", d.Offset())
+	}
+}
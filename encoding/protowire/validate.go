@@ -0,0 +1,30 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protowire
+
+import "io"
+
+// Validate checks that b is a syntactically valid sequence of fields in the
+// wire format: that every tag has a valid field number and wire type, that
+// every value is complete, and that every group is terminated by a matching
+// end group marker. It does not use a message descriptor, so the values
+// themselves are not checked.
+//
+// If b is valid, Validate returns len(b) and nil. Otherwise, it returns the
+// offset in b of the first malformed tag or value and an error describing it.
+func Validate(b []byte) (int, error) {
+	d := NewDecoder(b)
+	d.MaxDepth = -1
+	for {
+		// Values are not read, so NextField skips them and enters groups.
+		_, _, err := d.NextField()
+		if err == io.EOF {
+			return len(b), nil
+		}
+		if err != nil {
+			return int(d.Offset()), err
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protowire
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid := cat(
+		AppendTag(nil, 1, VarintType), AppendVarint(nil, 1<<63),
+		AppendTag(nil, 2, Fixed32Type), AppendFixed32(nil, 1),
+		AppendTag(nil, 3, Fixed64Type), AppendFixed64(nil, 1),
+		AppendTag(nil, 4, BytesType), AppendString(nil, "hello"),
+		AppendTag(nil, 5, StartGroupType),
+		AppendTag(nil, 6, StartGroupType),
+		AppendTag(nil, 1, VarintType), AppendVarint(nil, 1),
+		AppendTag(nil, 6, EndGroupType),
+		AppendTag(nil, 5, EndGroupType),
+	)
+	tests := []struct {
+		desc    string
+		in      []byte
+		wantOff int
+		wantErr error
+	}{{
+		desc: "empty",
+	}, {
+		desc:    "valid",
+		in:      valid,
+		wantOff: len(valid),
+	}, {
+		desc:    "truncated tag",
+		in:      cat(valid, []byte{0x80}),
+		wantOff: len(valid),
+		wantErr: io.ErrUnexpectedEOF,
+	}, {
+		desc:    "truncated varint",
+		in:      cat(valid, AppendTag(nil, 1, VarintType), []byte{0xff}),
+		wantOff: len(valid) + 1,
+		wantErr: io.ErrUnexpectedEOF,
+	}, {
+		desc:    "overflowing varint",
+		in:      cat(AppendTag(nil, 1, VarintType), []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}),
+		wantOff: 1,
+		wantErr: errOverflow,
+	}, {
+		desc:    "truncated fixed32",
+		in:      cat(AppendTag(nil, 2, Fixed32Type), []byte{1, 2, 3}),
+		wantOff: 1,
+		wantErr: io.ErrUnexpectedEOF,
+	}, {
+		desc:    "length beyond input",
+		in:      cat(AppendTag(nil, 4, BytesType), AppendVarint(nil, 6), []byte("hello")),
+		wantOff: 1,
+		wantErr: io.ErrUnexpectedEOF,
+	}, {
+		desc:    "field number zero",
+		in:      cat(valid, AppendTag(nil, 0, BytesType)),
+		wantOff: len(valid),
+		wantErr: errFieldNumber,
+	}, {
+		desc:    "reserved wire type",
+		in:      cat(valid, AppendVarint(nil, 1<<3|7)),
+		wantOff: len(valid),
+		wantErr: errReserved,
+	}, {
+		desc:    "mismatched end group",
+		in:      cat(AppendTag(nil, 1, StartGroupType), AppendTag(nil, 2, EndGroupType)),
+		wantOff: 1,
+		wantErr: errEndGroup,
+	}, {
+		desc:    "unterminated group",
+		in:      cat(AppendTag(nil, 1, StartGroupType), AppendTag(nil, 2, VarintType), AppendVarint(nil, 1)),
+		wantOff: 3,
+		wantErr: io.ErrUnexpectedEOF,
+	}, {
+		desc:    "deeply nested groups",
+		in:      cat(bytes.Repeat(AppendTag(nil, 1, StartGroupType), 20000), bytes.Repeat(AppendTag(nil, 1, EndGroupType), 20000)),
+		wantOff: 40000,
+	}}
+	for _, tt := range tests {
+		off, err := Validate(tt.in)
+		if off != tt.wantOff || err != tt.wantErr {
+			t.Errorf("%s: Validate() = %d, %v; want %d, %v", tt.desc, off, err, tt.wantOff, tt.wantErr)
+		}
+	}
+}
@@ -10,6 +10,7 @@
 package protowire
 
 import (
+	"encoding/binary"
 	"io"
 	"math"
 	"math/bits"
@@ -268,6 +269,19 @@ func ConsumeVarint(b []byte) (v uint64, n int) {
 	if v < 0x80 {
 		return v, 1
 	}
+	if len(b) >= 8 {
+		// Parse a varint of up to 8 bytes with a single load. The terminating
+		// byte is the first without its continuation bit set.
+		x := binary.LittleEndian.Uint64(b)
+		if stop := ^x & 0x8080808080808080; stop != 0 {
+			x &= stop ^ (stop - 1) // discard the bytes after the terminating byte
+			// Remove the continuation bits by joining adjacent groups of bits.
+			x = x&0x007f007f007f007f | (x&0x7f007f007f007f00)>>1
+			x = x&0x00003fff00003fff | (x&0x3fff00003fff0000)>>2
+			x = x&0x000000000fffffff | (x&0x0fffffff00000000)>>4
+			return x, bits.TrailingZeros64(stop)/8 + 1
+		}
+	}
 	v -= 0x80
 
 	if len(b) <= 1 {
@@ -0,0 +1,96 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build purego appengine !386,!amd64,!amd64p32,!arm,!arm64,!mips64le,!mipsle,!ppc64le,!riscv64,!wasm
+
+package protowire
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+func appendPacked32(b []byte, v []uint32) []byte {
+	for _, x := range v {
+		b = AppendFixed32(b, x)
+	}
+	return b
+}
+
+func appendPacked64(b []byte, v []uint64) []byte {
+	for _, x := range v {
+		b = AppendFixed64(b, x)
+	}
+	return b
+}
+
+func appendPackedSfixed32(b []byte, v []int32) []byte {
+	for _, x := range v {
+		b = AppendFixed32(b, uint32(x))
+	}
+	return b
+}
+
+func appendPackedSfixed64(b []byte, v []int64) []byte {
+	for _, x := range v {
+		b = AppendFixed64(b, uint64(x))
+	}
+	return b
+}
+
+func appendPackedFloat(b []byte, v []float32) []byte {
+	for _, x := range v {
+		b = AppendFixed32(b, math.Float32bits(x))
+	}
+	return b
+}
+
+func appendPackedDouble(b []byte, v []float64) []byte {
+	for _, x := range v {
+		b = AppendFixed64(b, math.Float64bits(x))
+	}
+	return b
+}
+
+func consumePacked32(s []uint32, b []byte) []uint32 {
+	for ; len(b) >= 4; b = b[4:] {
+		s = append(s, binary.LittleEndian.Uint32(b))
+	}
+	return s
+}
+
+func consumePacked64(s []uint64, b []byte) []uint64 {
+	for ; len(b) >= 8; b = b[8:] {
+		s = append(s, binary.LittleEndian.Uint64(b))
+	}
+	return s
+}
+
+func consumePackedSfixed32(s []int32, b []byte) []int32 {
+	for ; len(b) >= 4; b = b[4:] {
+		s = append(s, int32(binary.LittleEndian.Uint32(b)))
+	}
+	return s
+}
+
+func consumePackedSfixed64(s []int64, b []byte) []int64 {
+	for ; len(b) >= 8; b = b[8:] {
+		s = append(s, int64(binary.LittleEndian.Uint64(b)))
+	}
+	return s
+}
+
+func consumePackedFloat(s []float32, b []byte) []float32 {
+	for ; len(b) >= 4; b = b[4:] {
+		s = append(s, math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	}
+	return s
+}
+
+func consumePackedDouble(s []float64, b []byte) []float64 {
+	for ; len(b) >= 8; b = b[8:] {
+		s = append(s, math.Float64frombits(binary.LittleEndian.Uint64(b)))
+	}
+	return s
+}
@@ -678,3 +678,45 @@ func TestZigZag(t *testing.T) {
 		}
 	}
 }
+
+func TestConsumeVarintLoad(t *testing.T) {
+	// Varints of every length followed by enough bytes to use a single load.
+	for shift := uint(0); shift < 64; shift++ {
+		for _, v := range []uint64{1<<shift - 1, 1 << shift, 1<<shift + 1} {
+			b := AppendVarint(nil, v)
+			n0 := len(b)
+			b = append(b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+			if got, n := ConsumeVarint(b); got != v || n != n0 {
+				t.Errorf("ConsumeVarint(%x) = %d, %d; want %d, %d", b, got, n, v, n0)
+			}
+		}
+	}
+
+	// Non-minimal encodings.
+	for _, tt := range []struct {
+		in    []byte
+		wantV uint64
+		wantN int
+	}{
+		{[]byte{0x80, 0x00, 0, 0, 0, 0, 0, 0}, 0, 2},
+		{[]byte{0xff, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00}, 0x7f, 8},
+	} {
+		if v, n := ConsumeVarint(tt.in); v != tt.wantV || n != tt.wantN {
+			t.Errorf("ConsumeVarint(%x) = %d, %d; want %d, %d", tt.in, v, n, tt.wantV, tt.wantN)
+		}
+	}
+}
+
+func BenchmarkConsumeVarint(b *testing.B) {
+	var buf []byte
+	for i := uint(0); i < 64; i += 7 {
+		buf = AppendVarint(buf, 1<<i)
+	}
+	b.SetBytes(int64(len(buf)))
+	for i := 0; i < b.N; i++ {
+		for p := buf; len(p) > 0; {
+			_, n := ConsumeVarint(p)
+			p = p[n:]
+		}
+	}
+}
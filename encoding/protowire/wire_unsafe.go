@@ -0,0 +1,123 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !purego,!appengine
+// +build 386 amd64 amd64p32 arm arm64 mips64le mipsle ppc64le riscv64 wasm
+
+package protowire
+
+import "unsafe"
+
+type sliceHeader struct {
+	Data unsafe.Pointer
+	Len  int
+	Cap  int
+}
+
+// byteView returns the n bytes of memory at p as a byte slice.
+func byteView(p unsafe.Pointer, n int) (b []byte) {
+	h := (*sliceHeader)(unsafe.Pointer(&b))
+	h.Data, h.Len, h.Cap = p, n, n
+	return b
+}
+
+// The values of a packed fixed-width field have the same representation in
+// the wire format as in memory on a little-endian platform, so they are
+// copied directly.
+
+func appendPacked32(b []byte, v []uint32) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	return append(b, byteView(unsafe.Pointer(&v[0]), 4*len(v))...)
+}
+
+func appendPacked64(b []byte, v []uint64) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	return append(b, byteView(unsafe.Pointer(&v[0]), 8*len(v))...)
+}
+
+func appendPackedSfixed32(b []byte, v []int32) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	return append(b, byteView(unsafe.Pointer(&v[0]), 4*len(v))...)
+}
+
+func appendPackedSfixed64(b []byte, v []int64) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	return append(b, byteView(unsafe.Pointer(&v[0]), 8*len(v))...)
+}
+
+func appendPackedFloat(b []byte, v []float32) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	return append(b, byteView(unsafe.Pointer(&v[0]), 4*len(v))...)
+}
+
+func appendPackedDouble(b []byte, v []float64) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	return append(b, byteView(unsafe.Pointer(&v[0]), 8*len(v))...)
+}
+
+func consumePacked32(s []uint32, b []byte) []uint32 {
+	i := len(s)
+	s = append(s, make([]uint32, len(b)/4)...)
+	if len(b) > 0 {
+		copy(byteView(unsafe.Pointer(&s[i]), len(b)), b)
+	}
+	return s
+}
+
+func consumePacked64(s []uint64, b []byte) []uint64 {
+	i := len(s)
+	s = append(s, make([]uint64, len(b)/8)...)
+	if len(b) > 0 {
+		copy(byteView(unsafe.Pointer(&s[i]), len(b)), b)
+	}
+	return s
+}
+
+func consumePackedSfixed32(s []int32, b []byte) []int32 {
+	i := len(s)
+	s = append(s, make([]int32, len(b)/4)...)
+	if len(b) > 0 {
+		copy(byteView(unsafe.Pointer(&s[i]), len(b)), b)
+	}
+	return s
+}
+
+func consumePackedSfixed64(s []int64, b []byte) []int64 {
+	i := len(s)
+	s = append(s, make([]int64, len(b)/8)...)
+	if len(b) > 0 {
+		copy(byteView(unsafe.Pointer(&s[i]), len(b)), b)
+	}
+	return s
+}
+
+func consumePackedFloat(s []float32, b []byte) []float32 {
+	i := len(s)
+	s = append(s, make([]float32, len(b)/4)...)
+	if len(b) > 0 {
+		copy(byteView(unsafe.Pointer(&s[i]), len(b)), b)
+	}
+	return s
+}
+
+func consumePackedDouble(s []float64, b []byte) []float64 {
+	i := len(s)
+	s = append(s, make([]float64, len(b)/8)...)
+	if len(b) > 0 {
+		copy(byteView(unsafe.Pointer(&s[i]), len(b)), b)
+	}
+	return s
+}
@@ -367,7 +367,21 @@ func append{{.Name}}Slice(b []byte, p pointer, f *coderFieldInfo, _ marshalOptio
 // consume{{.Name}}Slice wire decodes a []{{.GoType}} pointer as a repeated {{.Name}}.
 func consume{{.Name}}Slice(b []byte, p pointer, wtyp protowire.Type, f *coderFieldInfo, _ unmarshalOptions) (out unmarshalOutput, err error) {
 	sp := p.{{.GoType.PointerMethod}}Slice()
-	{{- if .WireType.Packable}}
+	{{- if .PackedFunc}}
+	if wtyp == protowire.BytesType {
+		b, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return out, protowire.ParseError(n)
+		}
+		s, m := protowire.ConsumePacked{{.PackedFunc}}(*sp, b)
+		if m < 0 {
+			return out, protowire.ParseError(m)
+		}
+		*sp = s
+		out.n = n
+		return out, nil
+	}
+	{{- else if .WireType.Packable}}
 	if wtyp == protowire.BytesType {
 		s := *sp
 		b, n := protowire.ConsumeBytes(b)
@@ -480,9 +494,13 @@ func append{{.Name}}PackedSlice(b []byte, p pointer, f *coderFieldInfo, _ marsha
 	}
 	{{- end}}
 	b = protowire.AppendVarint(b, uint64(n))
+	{{if .PackedFunc -}}
+	b = protowire.AppendPacked{{.PackedFunc}}(b, s)
+	{{- else -}}
 	for _, v := range s {
 		{{template "Append" .}}
 	}
+	{{- end}}
 	return b, nil
 }
 
@@ -746,6 +764,21 @@ func (m *{{.}}) ProtoMessageInfo() *MessageInfo {
 	return m.messageInfo()
 }
 
+// ProtoSizeCache is a pseudo-internal API for allowing the proto package
+// to access the cached size of the message. It returns nil if the message
+// has no size cache.
+//
+// WARNING: This method is exempt from the compatibility promise and
+// may be removed in the future without warning.
+func (m *{{.}}) ProtoSizeCache() *int32 {
+	mi := m.messageInfo()
+	mi.init()
+	if !mi.sizecacheOffset.IsValid() {
+		return nil
+	}
+	return m.pointer().Apply(mi.sizecacheOffset).Int32()
+}
+
 func (m *{{.}}) Range(f func(protoreflect.FieldDescriptor, protoreflect.Value) bool) {
 	m.messageInfo().init()
 	for _, ri := range m.messageInfo().rangeInfos {
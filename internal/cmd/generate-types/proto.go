@@ -103,6 +103,10 @@ type ProtoKind struct {
 	FromGoType     Expr
 	NoPointer      bool
 	NoValueCodec   bool
+
+	// PackedFunc is the suffix of the protowire functions that encode and
+	// decode the contents of a packed field of this kind as a whole slice.
+	PackedFunc string
 }
 
 func (k ProtoKind) Expr() Expr {
@@ -187,6 +191,7 @@ var ProtoKinds = []ProtoKind{
 		GoType:     GoInt32,
 		ToGoType:   "int32(v)",
 		FromGoType: "uint32(v)",
+		PackedFunc: "Sfixed32",
 	},
 	{
 		Name:       "Fixed32",
@@ -196,6 +201,7 @@ var ProtoKinds = []ProtoKind{
 		GoType:     GoUint32,
 		ToGoType:   "v",
 		FromGoType: "v",
+		PackedFunc: "Fixed32",
 	},
 	{
 		Name:       "Float",
@@ -205,6 +211,7 @@ var ProtoKinds = []ProtoKind{
 		GoType:     GoFloat32,
 		ToGoType:   "math.Float32frombits(v)",
 		FromGoType: "math.Float32bits(v)",
+		PackedFunc: "Float",
 	},
 	{
 		Name:       "Sfixed64",
@@ -214,6 +221,7 @@ var ProtoKinds = []ProtoKind{
 		GoType:     GoInt64,
 		ToGoType:   "int64(v)",
 		FromGoType: "uint64(v)",
+		PackedFunc: "Sfixed64",
 	},
 	{
 		Name:       "Fixed64",
@@ -223,6 +231,7 @@ var ProtoKinds = []ProtoKind{
 		GoType:     GoUint64,
 		ToGoType:   "v",
 		FromGoType: "v",
+		PackedFunc: "Fixed64",
 	},
 	{
 		Name:       "Double",
@@ -232,6 +241,7 @@ var ProtoKinds = []ProtoKind{
 		GoType:     GoFloat64,
 		ToGoType:   "math.Float64frombits(v)",
 		FromGoType: "math.Float64bits(v)",
+		PackedFunc: "Double",
 	},
 	{
 		Name:       "String",
@@ -294,7 +304,9 @@ func (o UnmarshalOptions) unmarshalScalar(b []byte, wtyp protowire.Type, fd prot
 		}
 		{{if (eq .Name "String") -}}
 		if strs.EnforceUTF8(fd) && !utf8.Valid(v) {
-			return protoreflect.Value{}, 0, errors.InvalidUTF8(string(fd.FullName()))
+			if v, err = o.invalidUTF8(fd, v); err != nil {
+				return protoreflect.Value{}, 0, err
+			}
 		}
 		{{end -}}
 		return {{.ToValue}}, n, nil
@@ -338,7 +350,9 @@ func (o UnmarshalOptions) unmarshalList(b []byte, wtyp protowire.Type, list prot
 		}
 		{{if (eq .Name "String") -}}
 		if strs.EnforceUTF8(fd) && !utf8.Valid(v) {
-			return 0, errors.InvalidUTF8(string(fd.FullName()))
+			if v, err = o.invalidUTF8(fd, v); err != nil {
+				return 0, err
+			}
 		}
 		{{end -}}
 		{{if or (eq .Name "Message") (eq .Name "Group") -}}
@@ -377,10 +391,14 @@ func (o MarshalOptions) marshalSingular(b []byte, fd protoreflect.FieldDescripto
 	{{- range .}}
 	case {{.Expr}}:
 		{{- if (eq .Name "String") }}
-		if strs.EnforceUTF8(fd) && !utf8.ValidString(v.String()) {
-			return b, errors.InvalidUTF8(string(fd.FullName()))
+		s := {{.FromValue}}
+		if strs.EnforceUTF8(fd) && !utf8.ValidString(s) {
+			var err error
+			if s, err = o.invalidUTF8(fd, s); err != nil {
+				return b, err
+			}
 		}
-		b = protowire.AppendString(b, {{.FromValue}})
+		b = protowire.AppendString(b, s)
 		{{- else if (eq .Name "Message") -}}
 		var pos int
 		var err error
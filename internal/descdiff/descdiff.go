@@ -0,0 +1,482 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package descdiff computes the differences between two versions of a schema.
+package descdiff
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Kind is the kind of a Change.
+type Kind int
+
+const (
+	// Added is the kind of a declaration present only in the new descriptor.
+	Added Kind = iota + 1
+	// Removed is the kind of a declaration present only in the old descriptor.
+	Removed
+	// Changed is the kind of a declaration present in both descriptors
+	// whose properties differ.
+	Changed
+)
+
+// String returns the name of k.
+func (k Kind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	default:
+		return fmt.Sprintf("<unknown:%d>", k)
+	}
+}
+
+// Change is a difference between an old and a new version of a schema.
+type Change struct {
+	Kind Kind
+
+	// Old and New are the declaration in the old and new schema.
+	// Old is nil for an added declaration and New for a removed one.
+	Old, New protoreflect.Descriptor
+
+	// Detail describes a change of kind Changed, such as
+	// "kind changed from int32 to int64".
+	Detail string
+}
+
+// FullName returns the full name of the changed declaration,
+// in the new schema unless it was removed.
+func (c Change) FullName() protoreflect.FullName {
+	if c.New != nil {
+		return c.New.FullName()
+	}
+	return c.Old.FullName()
+}
+
+// String returns a description of the change, such as
+// "changed a.Msg.foo: kind changed from int32 to int64".
+func (c Change) String() string {
+	if c.Detail == "" {
+		return fmt.Sprintf("%v %v", c.Kind, c.FullName())
+	}
+	return fmt.Sprintf("%v %v: %v", c.Kind, c.FullName(), c.Detail)
+}
+
+// Options configures how descriptors are compared.
+type Options struct {
+	// EqualOptions reports whether two options messages are equal.
+	// If nil, options are not compared.
+	EqualOptions func(x, y protoreflect.ProtoMessage) bool
+}
+
+// Files returns the differences between the old file descriptor x and
+// the new file descriptor y. Declarations are matched by full name,
+// except that fields are matched by field number and enum values by name.
+// Source locations and the file path are not compared.
+//
+// The changes of a declaration are reported before those of its children,
+// in the order of declaration in x, followed by the declarations added in y.
+func (o Options) Files(x, y protoreflect.FileDescriptor) []Change {
+	d := differ{Options: o}
+	d.diffFile(x, y)
+	return d.changes
+}
+
+// Messages returns the differences between the old message descriptor x
+// and the new message descriptor y, including their nested declarations.
+// The full names of x and y are not compared. See Files for details.
+func (o Options) Messages(x, y protoreflect.MessageDescriptor) []Change {
+	d := differ{Options: o}
+	d.diffMessage(x, y)
+	return d.changes
+}
+
+// Descriptors returns the differences between the old descriptor x and
+// the new descriptor y, which are expected to be of the same kind.
+// A change is reported if they are of different kinds.
+// The full names of x and y are not compared. See Files for details.
+func (o Options) Descriptors(x, y protoreflect.Descriptor) []Change {
+	d := differ{Options: o}
+	switch x := x.(type) {
+	case protoreflect.FileDescriptor:
+		if y, ok := y.(protoreflect.FileDescriptor); ok {
+			d.diffFile(x, y)
+			return d.changes
+		}
+	case protoreflect.MessageDescriptor:
+		if y, ok := y.(protoreflect.MessageDescriptor); ok {
+			d.diffMessage(x, y)
+			return d.changes
+		}
+	case protoreflect.FieldDescriptor:
+		if y, ok := y.(protoreflect.FieldDescriptor); ok {
+			d.diffField(x, y)
+			return d.changes
+		}
+	case protoreflect.EnumDescriptor:
+		if y, ok := y.(protoreflect.EnumDescriptor); ok {
+			d.diffEnum(x, y)
+			return d.changes
+		}
+	case protoreflect.EnumValueDescriptor:
+		if y, ok := y.(protoreflect.EnumValueDescriptor); ok {
+			d.diffEnumValue(x, y)
+			return d.changes
+		}
+	case protoreflect.ServiceDescriptor:
+		if y, ok := y.(protoreflect.ServiceDescriptor); ok {
+			d.diffService(x, y)
+			return d.changes
+		}
+	}
+	d.changed(x, y, "declaration changed from %v to %v", kindOf(x), kindOf(y))
+	return d.changes
+}
+
+// differ accumulates the changes between two schemas.
+type differ struct {
+	Options
+	changes []Change
+}
+
+func (d *differ) add(c Change) {
+	d.changes = append(d.changes, c)
+}
+
+func (d *differ) changed(x, y protoreflect.Descriptor, f string, args ...interface{}) {
+	d.add(Change{Kind: Changed, Old: x, New: y, Detail: fmt.Sprintf(f, args...)})
+}
+
+func (d *differ) diffFile(x, y protoreflect.FileDescriptor) {
+	if x.Syntax() != y.Syntax() {
+		d.changed(x, y, "syntax changed from %v to %v", x.Syntax(), y.Syntax())
+	}
+	if x.Package() != y.Package() {
+		d.changed(x, y, "package changed from %q to %q", x.Package(), y.Package())
+	}
+	d.diffOptions(x, y)
+	d.diffDecls(x, y)
+	xs, ys := x.Services(), y.Services()
+	for i := 0; i < xs.Len(); i++ {
+		if sy := ys.ByName(xs.Get(i).Name()); sy != nil {
+			d.diffService(xs.Get(i), sy)
+		} else {
+			d.add(Change{Kind: Removed, Old: xs.Get(i)})
+		}
+	}
+	for i := 0; i < ys.Len(); i++ {
+		if xs.ByName(ys.Get(i).Name()) == nil {
+			d.add(Change{Kind: Added, New: ys.Get(i)})
+		}
+	}
+}
+
+// declarations is implemented by file and message descriptors.
+type declarations interface {
+	Enums() protoreflect.EnumDescriptors
+	Messages() protoreflect.MessageDescriptors
+	Extensions() protoreflect.ExtensionDescriptors
+}
+
+// diffDecls diffs the enums, messages, and extensions declared in x and y.
+func (d *differ) diffDecls(x, y declarations) {
+	xe, ye := x.Enums(), y.Enums()
+	for i := 0; i < xe.Len(); i++ {
+		if ey := ye.ByName(xe.Get(i).Name()); ey != nil {
+			d.diffEnum(xe.Get(i), ey)
+		} else {
+			d.add(Change{Kind: Removed, Old: xe.Get(i)})
+		}
+	}
+	for i := 0; i < ye.Len(); i++ {
+		if xe.ByName(ye.Get(i).Name()) == nil {
+			d.add(Change{Kind: Added, New: ye.Get(i)})
+		}
+	}
+
+	xm, ym := x.Messages(), y.Messages()
+	for i := 0; i < xm.Len(); i++ {
+		if my := ym.ByName(xm.Get(i).Name()); my != nil {
+			d.diffMessage(xm.Get(i), my)
+		} else {
+			d.add(Change{Kind: Removed, Old: xm.Get(i)})
+		}
+	}
+	for i := 0; i < ym.Len(); i++ {
+		if xm.ByName(ym.Get(i).Name()) == nil {
+			d.add(Change{Kind: Added, New: ym.Get(i)})
+		}
+	}
+
+	xx, yx := x.Extensions(), y.Extensions()
+	for i := 0; i < xx.Len(); i++ {
+		if fy := yx.ByName(xx.Get(i).Name()); fy != nil {
+			d.diffField(xx.Get(i), fy)
+		} else {
+			d.add(Change{Kind: Removed, Old: xx.Get(i)})
+		}
+	}
+	for i := 0; i < yx.Len(); i++ {
+		if xx.ByName(yx.Get(i).Name()) == nil {
+			d.add(Change{Kind: Added, New: yx.Get(i)})
+		}
+	}
+}
+
+func (d *differ) diffMessage(x, y protoreflect.MessageDescriptor) {
+	if x.IsMapEntry() != y.IsMapEntry() {
+		d.changed(x, y, "map entry changed from %v to %v", x.IsMapEntry(), y.IsMapEntry())
+	}
+	if !equalRanges(x.ReservedRanges(), y.ReservedRanges()) {
+		d.changed(x, y, "reserved ranges changed")
+	}
+	if !equalNames(x.ReservedNames(), y.ReservedNames()) {
+		d.changed(x, y, "reserved names changed")
+	}
+	if !equalRanges(x.ExtensionRanges(), y.ExtensionRanges()) {
+		d.changed(x, y, "extension ranges changed")
+	}
+	d.diffOptions(x, y)
+
+	xf, yf := x.Fields(), y.Fields()
+	for i := 0; i < xf.Len(); i++ {
+		if fy := yf.ByNumber(xf.Get(i).Number()); fy != nil {
+			d.diffField(xf.Get(i), fy)
+		} else {
+			d.add(Change{Kind: Removed, Old: xf.Get(i)})
+		}
+	}
+	for i := 0; i < yf.Len(); i++ {
+		if xf.ByNumber(yf.Get(i).Number()) == nil {
+			d.add(Change{Kind: Added, New: yf.Get(i)})
+		}
+	}
+
+	xo, yo := x.Oneofs(), y.Oneofs()
+	for i := 0; i < xo.Len(); i++ {
+		if oy := yo.ByName(xo.Get(i).Name()); oy != nil {
+			d.diffOptions(xo.Get(i), oy)
+		} else if !xo.Get(i).IsSynthetic() {
+			d.add(Change{Kind: Removed, Old: xo.Get(i)})
+		}
+	}
+	for i := 0; i < yo.Len(); i++ {
+		if xo.ByName(yo.Get(i).Name()) == nil && !yo.Get(i).IsSynthetic() {
+			d.add(Change{Kind: Added, New: yo.Get(i)})
+		}
+	}
+
+	d.diffDecls(x, y)
+}
+
+func (d *differ) diffField(x, y protoreflect.FieldDescriptor) {
+	if x.Name() != y.Name() {
+		d.changed(x, y, "name changed from %v to %v", x.Name(), y.Name())
+	}
+	if x.Number() != y.Number() {
+		d.changed(x, y, "number changed from %d to %d", x.Number(), y.Number())
+	}
+	if x.Kind() != y.Kind() {
+		d.changed(x, y, "kind changed from %v to %v", x.Kind(), y.Kind())
+	} else if nx, ny := TypeName(x), TypeName(y); nx != ny {
+		d.changed(x, y, "type changed from %v to %v", nx, ny)
+	}
+	if x.Cardinality() != y.Cardinality() {
+		d.changed(x, y, "cardinality changed from %v to %v", x.Cardinality(), y.Cardinality())
+	}
+	if x.HasPresence() != y.HasPresence() {
+		d.changed(x, y, "presence changed from %v to %v", x.HasPresence(), y.HasPresence())
+	}
+	if x.IsPacked() != y.IsPacked() {
+		d.changed(x, y, "packed changed from %v to %v", x.IsPacked(), y.IsPacked())
+	}
+	if x.JSONName() != y.JSONName() {
+		d.changed(x, y, "JSON name changed from %q to %q", x.JSONName(), y.JSONName())
+	}
+	if dx, dy := DefaultString(x), DefaultString(y); dx != dy {
+		d.changed(x, y, "default changed from %v to %v", dx, dy)
+	}
+	if ox, oy := RealOneofName(x), RealOneofName(y); ox != oy {
+		d.changed(x, y, "oneof changed from %q to %q", ox, oy)
+	}
+	if x.IsExtension() && x.ContainingMessage().FullName() != y.ContainingMessage().FullName() {
+		d.changed(x, y, "extendee changed from %v to %v", x.ContainingMessage().FullName(), y.ContainingMessage().FullName())
+	}
+	d.diffOptions(x, y)
+}
+
+func (d *differ) diffEnum(x, y protoreflect.EnumDescriptor) {
+	if !equalEnumRanges(x.ReservedRanges(), y.ReservedRanges()) {
+		d.changed(x, y, "reserved ranges changed")
+	}
+	if !equalNames(x.ReservedNames(), y.ReservedNames()) {
+		d.changed(x, y, "reserved names changed")
+	}
+	d.diffOptions(x, y)
+
+	xv, yv := x.Values(), y.Values()
+	for i := 0; i < xv.Len(); i++ {
+		vx := xv.Get(i)
+		vy := yv.ByName(vx.Name())
+		if vy == nil {
+			d.add(Change{Kind: Removed, Old: vx})
+			continue
+		}
+		d.diffEnumValue(vx, vy)
+	}
+	for i := 0; i < yv.Len(); i++ {
+		if xv.ByName(yv.Get(i).Name()) == nil {
+			d.add(Change{Kind: Added, New: yv.Get(i)})
+		}
+	}
+}
+
+func (d *differ) diffEnumValue(x, y protoreflect.EnumValueDescriptor) {
+	if x.Number() != y.Number() {
+		d.changed(x, y, "number changed from %d to %d", x.Number(), y.Number())
+	}
+	d.diffOptions(x, y)
+}
+
+func (d *differ) diffService(x, y protoreflect.ServiceDescriptor) {
+	d.diffOptions(x, y)
+	xm, ym := x.Methods(), y.Methods()
+	for i := 0; i < xm.Len(); i++ {
+		mx := xm.Get(i)
+		my := ym.ByName(mx.Name())
+		if my == nil {
+			d.add(Change{Kind: Removed, Old: mx})
+			continue
+		}
+		if mx.Input().FullName() != my.Input().FullName() {
+			d.changed(mx, my, "input changed from %v to %v", mx.Input().FullName(), my.Input().FullName())
+		}
+		if mx.Output().FullName() != my.Output().FullName() {
+			d.changed(mx, my, "output changed from %v to %v", mx.Output().FullName(), my.Output().FullName())
+		}
+		if mx.IsStreamingClient() != my.IsStreamingClient() {
+			d.changed(mx, my, "client streaming changed from %v to %v", mx.IsStreamingClient(), my.IsStreamingClient())
+		}
+		if mx.IsStreamingServer() != my.IsStreamingServer() {
+			d.changed(mx, my, "server streaming changed from %v to %v", mx.IsStreamingServer(), my.IsStreamingServer())
+		}
+		d.diffOptions(mx, my)
+	}
+	for i := 0; i < ym.Len(); i++ {
+		if xm.ByName(ym.Get(i).Name()) == nil {
+			d.add(Change{Kind: Added, New: ym.Get(i)})
+		}
+	}
+}
+
+// diffOptions reports a change if the options of x and y differ.
+func (d *differ) diffOptions(x, y protoreflect.Descriptor) {
+	if d.EqualOptions != nil && !d.EqualOptions(x.Options(), y.Options()) {
+		d.changed(x, y, "options changed")
+	}
+}
+
+// TypeName returns the full name of the message or enum type of fd,
+// or the empty string for a scalar field.
+func TypeName(fd protoreflect.FieldDescriptor) protoreflect.FullName {
+	switch {
+	case fd.Message() != nil:
+		return fd.Message().FullName()
+	case fd.Enum() != nil:
+		return fd.Enum().FullName()
+	}
+	return ""
+}
+
+// RealOneofName returns the name of the oneof containing fd, or the empty
+// string if there is none or it is synthetic.
+func RealOneofName(fd protoreflect.FieldDescriptor) protoreflect.Name {
+	if od := fd.ContainingOneof(); od != nil && !od.IsSynthetic() {
+		return od.Name()
+	}
+	return ""
+}
+
+// DefaultString returns the explicit default value of fd formatted as text.
+func DefaultString(fd protoreflect.FieldDescriptor) string {
+	switch {
+	case !fd.HasDefault():
+		return "none"
+	case fd.DefaultEnumValue() != nil:
+		return string(fd.DefaultEnumValue().Name())
+	case fd.Kind() == protoreflect.BytesKind:
+		return fmt.Sprintf("%q", fd.Default().Bytes())
+	case fd.Kind() == protoreflect.StringKind:
+		return fmt.Sprintf("%q", fd.Default().String())
+	}
+	return fmt.Sprint(fd.Default().Interface())
+}
+
+// kindOf returns the kind of declaration d, such as "message".
+func kindOf(d protoreflect.Descriptor) string {
+	switch d := d.(type) {
+	case protoreflect.FileDescriptor:
+		return "file"
+	case protoreflect.MessageDescriptor:
+		return "message"
+	case protoreflect.FieldDescriptor:
+		if d.IsExtension() {
+			return "extension"
+		}
+		return "field"
+	case protoreflect.OneofDescriptor:
+		return "oneof"
+	case protoreflect.EnumDescriptor:
+		return "enum"
+	case protoreflect.EnumValueDescriptor:
+		return "enum value"
+	case protoreflect.ServiceDescriptor:
+		return "service"
+	case protoreflect.MethodDescriptor:
+		return "method"
+	}
+	return fmt.Sprintf("%T", d)
+}
+
+func equalRanges(x, y protoreflect.FieldRanges) bool {
+	if x.Len() != y.Len() {
+		return false
+	}
+	for i := 0; i < x.Len(); i++ {
+		if x.Get(i) != y.Get(i) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalEnumRanges(x, y protoreflect.EnumRanges) bool {
+	if x.Len() != y.Len() {
+		return false
+	}
+	for i := 0; i < x.Len(); i++ {
+		if x.Get(i) != y.Get(i) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalNames(x, y protoreflect.Names) bool {
+	if x.Len() != y.Len() {
+		return false
+	}
+	for i := 0; i < x.Len(); i++ {
+		if !y.Has(x.Get(i)) {
+			return false
+		}
+	}
+	return true
+}
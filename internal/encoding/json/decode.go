@@ -48,6 +48,14 @@ type Decoder struct {
 	orig []byte
 	// in contains the unconsumed input.
 	in []byte
+
+	// maxDepth is the maximum length of openStack, if positive.
+	maxDepth int
+
+	// maxValues is the maximum of numValues, the number of values read,
+	// if positive.
+	maxValues int
+	numValues int
 }
 
 // NewDecoder returns a Decoder to read the given []byte.
@@ -55,6 +63,20 @@ func NewDecoder(b []byte) *Decoder {
 	return &Decoder{orig: b, in: b}
 }
 
+// SetMaxDepth limits the nesting depth of JSON objects and arrays to n.
+// Reading an object or array beyond that depth returns a syntax error.
+// If n is zero or negative, the depth is not limited.
+func (d *Decoder) SetMaxDepth(n int) {
+	d.maxDepth = n
+}
+
+// SetMaxValues limits the number of JSON values to n, counting each object,
+// array, and scalar value. Reading a value beyond that number returns
+// a syntax error. If n is zero or negative, the number is not limited.
+func (d *Decoder) SetMaxValues(n int) {
+	d.maxValues = n
+}
+
 // Peek looks ahead and returns the next token kind without advancing a read.
 func (d *Decoder) Peek() (Token, error) {
 	defer func() { d.lastCall = peekCall }()
@@ -117,6 +139,9 @@ func (d *Decoder) Read() (Token, error) {
 		if !d.isValueNext() {
 			return Token{}, d.newSyntaxError(tok.pos, unexpectedFmt, tok.RawString())
 		}
+		if d.maxDepth > 0 && len(d.openStack) >= d.maxDepth {
+			return Token{}, d.newSyntaxError(tok.pos, "exceeded maximum nesting depth of %d", d.maxDepth)
+		}
 		d.openStack = append(d.openStack, tok.kind)
 
 	case ObjectClose:
@@ -142,6 +167,13 @@ func (d *Decoder) Read() (Token, error) {
 		}
 	}
 
+	if d.maxValues > 0 && tok.kind&(scalar|ObjectOpen|ArrayOpen) != 0 {
+		if d.numValues >= d.maxValues {
+			return Token{}, d.newSyntaxError(tok.pos, "exceeded maximum of %d values", d.maxValues)
+		}
+		d.numValues++
+	}
+
 	// Update d.lastToken only after validating token to be in the right sequence.
 	d.lastToken = tok
 
@@ -212,12 +244,30 @@ func (d *Decoder) parseNext() (Token, error) {
 	return Token{}, d.newSyntaxError(d.currPos(), "invalid value %s", errRegexp.Find(in))
 }
 
+// SyntaxError is the error returned for malformed input.
+type SyntaxError struct {
+	// Line and Column are the position of the error within the input.
+	Line, Column int
+
+	// Err is the underlying error, whose message includes the position.
+	Err error
+}
+
+func (e *SyntaxError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e *SyntaxError) Unwrap() error { return e.Err }
+
 // newSyntaxError returns an error with line and column information useful for
 // syntax errors.
 func (d *Decoder) newSyntaxError(pos int, f string, x ...interface{}) error {
 	e := errors.New(f, x...)
 	line, column := d.Position(pos)
-	return errors.New("syntax error (line %d:%d): %v", line, column, e)
+	return &SyntaxError{
+		Line:   line,
+		Column: column,
+		Err:    errors.New("syntax error (line %d:%d): %v", line, column, e),
+	}
 }
 
 // Position returns line and column number of given index of the original input.
@@ -1379,6 +1379,73 @@ func errorf(t *testing.T, in string, fmtStr string, args ...interface{}) {
 	t.Errorf("input:\n%s\n~end~\n"+fmtStr, vargs...)
 }
 
+func TestDecoderSetMaxDepth(t *testing.T) {
+	tests := []struct {
+		in      string
+		max     int
+		wantErr string
+	}{
+		{in: `[[{"a":[]}]]`, max: 0},
+		{in: `[[{"a":[]}]]`, max: -1},
+		{in: `[[{"a":[]}]]`, max: 4},
+		{in: `[[{"a":[]}]]`, max: 3, wantErr: `syntax error (line 1:8): exceeded maximum nesting depth of 3`},
+		{in: `[[],[],{}]`, max: 2},
+		{in: `{"a":{"b":{}}}`, max: 1, wantErr: `syntax error (line 1:6): exceeded maximum nesting depth of 1`},
+	}
+	for _, tc := range tests {
+		dec := json.NewDecoder([]byte(tc.in))
+		dec.SetMaxDepth(tc.max)
+		var gotErr string
+		for {
+			tok, err := dec.Read()
+			if err != nil {
+				gotErr = err.Error()
+				break
+			}
+			if tok.Kind() == json.EOF {
+				break
+			}
+		}
+		if (gotErr == "") != (tc.wantErr == "") || !strings.Contains(gotErr, tc.wantErr) {
+			t.Errorf("SetMaxDepth(%d) reading %s: got error %q, want %q", tc.max, tc.in, gotErr, tc.wantErr)
+		}
+	}
+}
+
+func TestDecoderSetMaxValues(t *testing.T) {
+	tests := []struct {
+		in      string
+		max     int
+		wantErr string
+	}{
+		{in: `[{},{},{}]`, max: 0},
+		{in: `[{},{},{}]`, max: -1},
+		{in: `[{},{},{}]`, max: 4},
+		{in: `[{},{},{}]`, max: 3, wantErr: `syntax error (line 1:8): exceeded maximum of 3 values`},
+		{in: `{"a":1,"b":[true,null]}`, max: 5},
+		{in: `{"a":1,"b":[true,null]}`, max: 4, wantErr: `syntax error (line 1:18): exceeded maximum of 4 values`},
+		{in: `"a"`, max: 1},
+	}
+	for _, tc := range tests {
+		dec := json.NewDecoder([]byte(tc.in))
+		dec.SetMaxValues(tc.max)
+		var gotErr string
+		for {
+			tok, err := dec.Read()
+			if err != nil {
+				gotErr = err.Error()
+				break
+			}
+			if tok.Kind() == json.EOF {
+				break
+			}
+		}
+		if (gotErr == "") != (tc.wantErr == "") || !strings.Contains(gotErr, tc.wantErr) {
+			t.Errorf("SetMaxValues(%d) reading %s: got error %q, want %q", tc.max, tc.in, gotErr, tc.wantErr)
+		}
+	}
+}
+
 func TestClone(t *testing.T) {
 	input := `{"outer":{"str":"hello", "number": 123}}`
 	dec := json.NewDecoder([]byte(input))
@@ -5,8 +5,10 @@
 package json
 
 import (
+	"io"
 	"math"
 	"math/bits"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode/utf8"
@@ -35,28 +37,123 @@ type Encoder struct {
 	lastKind kind
 	indents  []byte
 	out      []byte
+
+	// w, if non-nil, is where the output is written once out grows
+	// beyond flushSize. err is the first error returned by w.
+	w   io.Writer
+	err error
+
+	// stable disables the random whitespace added to the output.
+	stable bool
+
+	// nameSep is written after each name.
+	nameSep string
+
+	// sortNames and compactArrays are set by SetSortNames and
+	// SetCompactArrays. If either is set, scopes holds the open objects
+	// and arrays, so that their content can be rewritten once closed.
+	sortNames     bool
+	compactArrays bool
+	scopes        []scope
 }
 
+// scope is an open object or array.
+type scope struct {
+	array   bool
+	start   int      // offset of the content, following the opening bracket
+	members []member // names of an object, or values of an array
+	nested  bool     // whether an array contains an object or array
+}
+
+// member is a name of an object or a value of an array.
+type member struct {
+	name     string
+	sepStart int // offset of the separator that precedes the member
+	start    int // offset of the member
+}
+
+// flushSize is the size of the buffered output at which an Encoder
+// created by NewStreamEncoder writes it out.
+const flushSize = 4096
+
 // NewEncoder returns an Encoder.
 //
 // If indent is a non-empty string, it causes every entry for an Array or Object
 // to be preceded by the indent and trailed by a newline.
 func NewEncoder(indent string) (*Encoder, error) {
-	e := &Encoder{}
+	e := &Encoder{nameSep: ":"}
 	if len(indent) > 0 {
 		if strings.Trim(indent, " \t") != "" {
 			return nil, errors.New("indent may only be composed of space or tab characters")
 		}
 		e.indent = indent
+		e.nameSep = ": "
 	}
 	return e, nil
 }
 
+// NewStreamEncoder returns an Encoder that writes its output to w as it is
+// produced, rather than retaining all of it. Flush must be called to write
+// out any remaining output.
+func NewStreamEncoder(w io.Writer, indent string) (*Encoder, error) {
+	e, err := NewEncoder(indent)
+	if err != nil {
+		return nil, err
+	}
+	e.w = w
+	return e, nil
+}
+
+// SetStable disables the deliberately unstable whitespace in the output,
+// so that the output only depends on the sequence of values written.
+func (e *Encoder) SetStable() {
+	e.stable = true
+}
+
+// SetNameSeparator sets the separator written between each name and its
+// value, which by default is ":" for single-line output and ": " otherwise.
+// The separator must be a colon, optionally surrounded by space or tab
+// characters.
+func (e *Encoder) SetNameSeparator(sep string) error {
+	if strings.Trim(sep, " \t") != ":" {
+		return errors.New("name separator must be a colon surrounded by space or tab characters")
+	}
+	e.nameSep = sep
+	return nil
+}
+
+// SetSortNames causes the members of each object to be written out sorted
+// by name, rather than in the order they are written. The content of objects
+// is buffered until the outermost object or array is closed.
+func (e *Encoder) SetSortNames() {
+	e.sortNames = true
+}
+
+// SetCompactArrays causes the values of an array in multiline output to be
+// written on a single line, separated by ", ", if none of them is an object
+// or array. The content of arrays is buffered until the outermost object
+// or array is closed.
+func (e *Encoder) SetCompactArrays() {
+	e.compactArrays = true
+}
+
 // Bytes returns the content of the written bytes.
+// For an Encoder created by NewStreamEncoder, it only returns the content
+// that has not yet been written out.
 func (e *Encoder) Bytes() []byte {
 	return e.out
 }
 
+// Flush writes out any buffered output of an Encoder created by
+// NewStreamEncoder. It returns the first error encountered while writing.
+func (e *Encoder) Flush() error {
+	if e.err == nil && len(e.out) > 0 {
+		_, e.err = e.w.Write(e.out)
+	}
+	e.out = e.out[:0]
+	return e.err
+}
+
 // WriteNull writes out the null value.
 func (e *Encoder) WriteNull() {
 	e.prepareNext(scalar)
@@ -173,6 +270,13 @@ func appendFloat(out []byte, n float64, bitSize int) []byte {
 	return out
 }
 
+// WriteNumber writes out the given JSON number literal as is.
+// The literal must be valid, such as the raw string of a Number token.
+func (e *Encoder) WriteNumber(s string) {
+	e.prepareNext(scalar)
+	e.out = append(e.out, s...)
+}
+
 // WriteInt writes out the given signed integer in JSON number value.
 func (e *Encoder) WriteInt(n int64) {
 	e.prepareNext(scalar)
@@ -202,10 +306,14 @@ func (e *Encoder) EndObject() {
 // should not be likely as protobuf field names should be valid.
 func (e *Encoder) WriteName(s string) error {
 	e.prepareNext(name)
+	if n := len(e.scopes); n > 0 && !e.scopes[n-1].array {
+		members := e.scopes[n-1].members
+		members[len(members)-1].name = s
+	}
 	var err error
 	// Append to output regardless of error.
 	e.out, err = appendString(e.out, s)
-	e.out = append(e.out, ':')
+	e.out = append(e.out, e.nameSep...)
 	return err
 }
 
@@ -221,9 +329,121 @@ func (e *Encoder) EndArray() {
 	e.out = append(e.out, ']')
 }
 
-// prepareNext adds possible comma and indentation for the next value based
-// on last type and indent option. It also updates lastKind to next.
+// Fork returns an Encoder for writing out the next value of the innermost
+// open array separately, such as concurrently with other values, with the
+// same options and indentation. The value is then written out by WriteForked,
+// in the order of the values of the array.
+func (e *Encoder) Fork() *Encoder {
+	indents := append([]byte(nil), e.indents...)
+	if e.lastKind&arrayOpen != 0 {
+		indents = append(indents, e.indent...)
+	}
+	return &Encoder{
+		indent:        e.indent,
+		indents:       indents,
+		stable:        e.stable,
+		nameSep:       e.nameSep,
+		sortNames:     e.sortNames,
+		compactArrays: e.compactArrays,
+	}
+}
+
+// WriteForked writes out the single value written to f, which must have
+// been returned by Fork.
+func (e *Encoder) WriteForked(f *Encoder) {
+	e.prepareNext(scalar)
+	if n := len(e.scopes); n > 0 && len(f.out) > 0 && (f.out[0] == '{' || f.out[0] == '[') {
+		e.scopes[n-1].nested = true
+	}
+	e.out = append(e.out, f.out...)
+}
+
+// prepareNext writes the separator for the next value, keeping track of the
+// open objects and arrays if their content may need to be rewritten.
 func (e *Encoder) prepareNext(next kind) {
+	if e.w != nil && len(e.out) >= flushSize && len(e.scopes) == 0 {
+		e.Flush()
+	}
+	if !e.sortNames && !e.compactArrays {
+		e.writeSeparator(next)
+		return
+	}
+	if next&(objectClose|arrayClose) != 0 {
+		e.closeScope(next)
+		return
+	}
+
+	sepStart := len(e.out)
+	e.writeSeparator(next)
+	if n := len(e.scopes); n > 0 {
+		s := &e.scopes[n-1]
+		if s.array != (next == name) {
+			s.members = append(s.members, member{sepStart: sepStart, start: len(e.out)})
+		}
+		if s.array && next&(objectOpen|arrayOpen) != 0 {
+			s.nested = true
+		}
+	}
+	if next&(objectOpen|arrayOpen) != 0 {
+		// The content starts after the opening bracket.
+		e.scopes = append(e.scopes, scope{array: next == arrayOpen, start: len(e.out) + 1})
+	}
+}
+
+// closeScope rewrites the content of the innermost open object or array as
+// needed before it is closed by next.
+func (e *Encoder) closeScope(next kind) {
+	s := e.scopes[len(e.scopes)-1]
+	e.scopes = e.scopes[:len(e.scopes)-1]
+	end := len(e.out)
+	switch {
+	case !s.array && e.sortNames && len(s.members) > 1:
+		sorted := make([]int, len(s.members))
+		for i := range sorted {
+			sorted[i] = i
+		}
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return s.members[sorted[i]].name < s.members[sorted[j]].name
+		})
+		content := func(i int) []byte {
+			if i+1 < len(s.members) {
+				return e.out[s.members[i].start:s.members[i+1].sepStart]
+			}
+			return e.out[s.members[i].start:end]
+		}
+		// Keep the separators in place, since they may differ.
+		var b []byte
+		for i, j := range sorted {
+			if i > 0 {
+				b = append(b, e.out[s.members[i].sepStart:s.members[i].start]...)
+			}
+			b = append(b, content(j)...)
+		}
+		copy(e.out[s.members[0].start:end], b)
+
+	case s.array && e.compactArrays && len(e.indent) > 0 && !s.nested && len(s.members) > 0:
+		var b []byte
+		for i, m := range s.members {
+			if i > 0 {
+				b = append(b, ", "...)
+			}
+			if i+1 < len(s.members) {
+				b = append(b, e.out[m.start:s.members[i+1].sepStart]...)
+			} else {
+				b = append(b, e.out[m.start:end]...)
+			}
+		}
+		e.out = append(e.out[:s.start], b...)
+		e.indents = e.indents[:len(e.indents)-len(e.indent)]
+		e.lastKind = next
+		return
+	}
+	e.writeSeparator(next)
+}
+
+// writeSeparator adds possible comma and indentation for the next value based
+// on last type and indent option. It also updates lastKind to next.
+func (e *Encoder) writeSeparator(next kind) {
 	defer func() {
 		// Set lastKind to next.
 		e.lastKind = next
@@ -236,7 +456,7 @@ func (e *Encoder) prepareNext(next kind) {
 			e.out = append(e.out, ',')
 			// For single-line output, add a random extra space after each
 			// comma to make output unstable.
-			if detrand.Bool() {
+			if detrand.Bool() && !e.stable {
 				e.out = append(e.out, ' ')
 			}
 		}
@@ -266,10 +486,9 @@ func (e *Encoder) prepareNext(next kind) {
 		e.out = append(e.out, e.indents...)
 
 	case e.lastKind&name != 0:
-		e.out = append(e.out, ' ')
 		// For multi-line output, add a random extra space after key: to make
 		// output unstable.
-		if detrand.Bool() {
+		if detrand.Bool() && !e.stable {
 			e.out = append(e.out, ' ')
 		}
 	}
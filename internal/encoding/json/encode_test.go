@@ -397,3 +397,134 @@ func TestWriteStringError(t *testing.T) {
 		})
 	}
 }
+
+func TestEncoderSetStable(t *testing.T) {
+	for _, indent := range []string{"", "  "} {
+		e, err := json.NewEncoder(indent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.SetStable()
+		e.StartObject()
+		e.WriteName("a")
+		e.WriteInt(1)
+		e.WriteName("b")
+		e.WriteBool(true)
+		e.EndObject()
+
+		want := `{"a":1,"b":true}`
+		if indent != "" {
+			want = "{\n  \"a\": 1,\n  \"b\": true\n}"
+		}
+		if got := string(e.Bytes()); got != want {
+			t.Errorf("NewEncoder(%q) with SetStable:\ngot:  %q\nwant: %q", indent, got, want)
+		}
+	}
+}
+
+func TestEncoderFormat(t *testing.T) {
+	write := func(e *json.Encoder) {
+		e.StartObject()
+		e.WriteName("b")
+		e.StartArray()
+		e.WriteInt(1)
+		e.WriteString("x")
+		e.EndArray()
+		e.WriteName("a")
+		e.StartObject()
+		e.WriteName("z")
+		e.WriteNull()
+		e.WriteName("y")
+		e.StartArray()
+		e.EndArray()
+		e.EndObject()
+		e.WriteName("c")
+		e.StartArray()
+		e.StartObject()
+		e.EndObject()
+		e.EndArray()
+		e.EndObject()
+	}
+	tests := []struct {
+		desc   string
+		indent string
+		set    func(*json.Encoder) error
+		want   string
+	}{{
+		desc: "name separator",
+		set: func(e *json.Encoder) error {
+			return e.SetNameSeparator(" : ")
+		},
+		want: `{"b" : [1,"x"],"a" : {"z" : null,"y" : []},"c" : [{}]}`,
+	}, {
+		desc:   "multiline name separator",
+		indent: "  ",
+		set: func(e *json.Encoder) error {
+			return e.SetNameSeparator(":")
+		},
+		want: "{\n  \"b\":[\n    1,\n    \"x\"\n  ],\n  \"a\":{\n    \"z\":null,\n    \"y\":[]\n  },\n  \"c\":[\n    {}\n  ]\n}",
+	}, {
+		desc: "sort names",
+		set: func(e *json.Encoder) error {
+			e.SetSortNames()
+			return nil
+		},
+		want: `{"a":{"y":[],"z":null},"b":[1,"x"],"c":[{}]}`,
+	}, {
+		desc:   "multiline sort names",
+		indent: "  ",
+		set: func(e *json.Encoder) error {
+			e.SetSortNames()
+			return nil
+		},
+		want: "{\n  \"a\": {\n    \"y\": [],\n    \"z\": null\n  },\n  \"b\": [\n    1,\n    \"x\"\n  ],\n  \"c\": [\n    {}\n  ]\n}",
+	}, {
+		desc: "compact arrays",
+		set: func(e *json.Encoder) error {
+			e.SetCompactArrays()
+			return nil
+		},
+		want: `{"b":[1,"x"],"a":{"z":null,"y":[]},"c":[{}]}`,
+	}, {
+		desc:   "multiline compact arrays",
+		indent: "  ",
+		set: func(e *json.Encoder) error {
+			e.SetCompactArrays()
+			return nil
+		},
+		want: "{\n  \"b\": [1, \"x\"],\n  \"a\": {\n    \"z\": null,\n    \"y\": []\n  },\n  \"c\": [\n    {}\n  ]\n}",
+	}, {
+		desc:   "multiline sort names and compact arrays",
+		indent: "\t",
+		set: func(e *json.Encoder) error {
+			e.SetSortNames()
+			e.SetCompactArrays()
+			return nil
+		},
+		want: "{\n\t\"a\": {\n\t\t\"y\": [],\n\t\t\"z\": null\n\t},\n\t\"b\": [1, \"x\"],\n\t\"c\": [\n\t\t{}\n\t]\n}",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			e, err := json.NewEncoder(tc.indent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e.SetStable()
+			if err := tc.set(e); err != nil {
+				t.Fatal(err)
+			}
+			write(e)
+			if got := string(e.Bytes()); got != tc.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+
+	e, _ := json.NewEncoder("")
+	for _, sep := range []string{"", "::", " ", ", "} {
+		if err := e.SetNameSeparator(sep); err == nil {
+			t.Errorf("SetNameSeparator(%q): got nil error, want error", sep)
+		}
+	}
+}
@@ -607,6 +607,12 @@ func (d *Decoder) newSyntaxError(f string, x ...interface{}) error {
 	return errors.New("syntax error (line %d:%d): %v", line, column, e)
 }
 
+// Offset returns the index in the original input of the unconsumed input,
+// which is where the last syntax error was found, if any.
+func (d *Decoder) Offset() int {
+	return len(d.orig) - len(d.in)
+}
+
 // Position returns line and column number of given index of the original input.
 // It will panic if index is out of range.
 func (d *Decoder) Position(idx int) (line int, column int) {
@@ -29,19 +29,23 @@ func (d *Decoder) parseStringValue() (Token, error) {
 	//	`"foo"'bar'"baz"` => "foobarbaz"
 	in0 := d.in
 	var ss []string
+	var size int
 	for len(d.in) > 0 && (d.in[0] == '"' || d.in[0] == '\'') {
 		s, err := d.parseString()
 		if err != nil {
 			return Token{}, err
 		}
 		ss = append(ss, s)
+		// The raw bytes exclude any whitespace or comments after the last
+		// string, which are consumed before checking for another string.
+		size = len(in0) - len(d.in)
+		d.consume(0)
 	}
-	// d.in already points to the end of the value at this point.
 	return Token{
 		kind:  Scalar,
 		attrs: stringValue,
 		pos:   len(d.orig) - len(in0),
-		raw:   in0[:len(in0)-len(d.in)],
+		raw:   in0[:size],
 		str:   strings.Join(ss, ""),
 	}, nil
 }
@@ -63,8 +67,7 @@ func (d *Decoder) parseString() (string, error) {
 		case r == 0 || r == '\n':
 			return "", d.newSyntaxError("invalid character %q in string", r)
 		case r == rune(quote):
-			in = in[1:]
-			d.consume(len(d.in) - len(in))
+			d.in = in[1:]
 			return string(out), nil
 		case r == '\\':
 			if len(in) < 2 {
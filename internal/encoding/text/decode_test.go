@@ -553,6 +553,18 @@ func TestDecoder(t *testing.T) {
 				{K: text.EOF},
 			},
 		},
+		{
+			in: `name: "hello" ` + space + `'world'` + space + `# comment`,
+			want: []R{
+				{K: text.Name},
+				{
+					K:  text.Scalar,
+					T:  ST{ok: Str{"helloworld"}},
+					RS: `"hello" ` + space + `'world'`,
+				},
+				{K: text.EOF},
+			},
+		},
 		{
 			in: `name: 'hello'`,
 			want: []R{
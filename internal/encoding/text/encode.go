@@ -5,6 +5,7 @@
 package text
 
 import (
+	"bytes"
 	"math"
 	"math/bits"
 	"strconv"
@@ -24,6 +25,7 @@ const (
 	scalar
 	messageOpen
 	messageClose
+	comment
 )
 
 // Encoder provides methods to write out textproto constructs and values. The user is
@@ -35,12 +37,27 @@ type Encoder struct {
 	newline     string // set to "\n" if len(indent) > 0
 	delims      [2]byte
 	outputASCII bool
+
+	// stable disables the random whitespace added to the output.
+	stable bool
+	// octal enables C-style octal escapes in strings.
+	octal bool
+
+	// width is the column width that messages are compacted to fit, if set.
+	width int
+	// commented reports whether any comments were written.
+	commented bool
 }
 
 type encoderState struct {
 	lastType encType
 	indents  []byte
 	out      []byte
+
+	// opens holds the positions in out of the open delimiters of the
+	// messages being written if a width is set, or -1 for messages that
+	// contain comments and so cannot be compacted.
+	opens []int
 }
 
 // NewEncoder returns an Encoder.
@@ -76,6 +93,67 @@ func NewEncoder(indent string, delims [2]byte, outputASCII bool) (*Encoder, erro
 	return e, nil
 }
 
+// SetStable disables the deliberately unstable whitespace in the output,
+// so that the output only depends on the sequence of values written.
+func (e *Encoder) SetStable() {
+	e.stable = true
+}
+
+// SetOctalEscapes causes strings to be serialized with C-style escapes, where
+// every byte that is not printable ASCII is written as a three-digit octal
+// escape such as "\303". This matches the output of the C++ implementation.
+// It takes precedence over outputASCII.
+func (e *Encoder) SetOctalEscapes() {
+	e.octal = true
+}
+
+// SetWidth causes every message in multi-line output to be written on a
+// single line when it is closed if the line then fits within width columns,
+// including its indentation. Messages with comments are not compacted.
+func (e *Encoder) SetWidth(width int) {
+	if len(e.indent) > 0 {
+		e.width = width
+	}
+}
+
+// Compact writes all of the output on a single line if it fits within the
+// width set by SetWidth and has no comments, and reports whether it did.
+func (e *Encoder) Compact() bool {
+	if e.width <= 0 || e.commented {
+		return false
+	}
+	return e.compact(0)
+}
+
+// compact rewrites the output from position start onwards on a single line
+// if the line then fits within the width, and reports whether it did.
+func (e *Encoder) compact(start int) bool {
+	lineStart := bytes.LastIndexByte(e.out[:start], '\n') + 1
+	column := utf8.RuneCount(e.out[lineStart:start])
+	var b []byte
+	for in := e.out[start:]; len(in) > 0; {
+		i := bytes.IndexByte(in, '\n')
+		if i < 0 {
+			b = append(b, in...)
+			break
+		}
+		b = append(b, in[:i]...)
+		in = bytes.TrimLeft(in[i+1:], " \t")
+		// Separate fields by a space, but not from the delimiters.
+		if len(b) > 0 && b[len(b)-1] != e.delims[0] && len(in) > 0 && in[0] != e.delims[1] {
+			b = append(b, ' ')
+		}
+		if column+utf8.RuneCount(b) > e.width {
+			return false
+		}
+	}
+	if column+utf8.RuneCount(b) > e.width {
+		return false
+	}
+	e.out = append(e.out[:start], b...)
+	return true
+}
+
 // Bytes returns the content of the written bytes.
 func (e *Encoder) Bytes() []byte {
 	return e.out
@@ -85,12 +163,23 @@ func (e *Encoder) Bytes() []byte {
 func (e *Encoder) StartMessage() {
 	e.prepareNext(messageOpen)
 	e.out = append(e.out, e.delims[0])
+	if e.width > 0 {
+		e.opens = append(e.opens, len(e.out)-1)
+	}
 }
 
 // EndMessage writes out the '}' or '>' symbol.
 func (e *Encoder) EndMessage() {
 	e.prepareNext(messageClose)
 	e.out = append(e.out, e.delims[1])
+	if e.width > 0 {
+		n := len(e.opens) - 1
+		start := e.opens[n]
+		e.opens = e.opens[:n]
+		if start >= 0 {
+			e.compact(start)
+		}
+	}
 }
 
 // WriteName writes out the field name and the separator ':'.
@@ -100,6 +189,27 @@ func (e *Encoder) WriteName(s string) {
 	e.out = append(e.out, ':')
 }
 
+// WriteComment writes out s as comment lines, each prefixed with "#".
+// It is ignored in single-line output, where a comment would extend to the
+// end of the output. The comment must be followed by a name.
+func (e *Encoder) WriteComment(s string) {
+	if len(e.indent) == 0 {
+		return
+	}
+	e.commented = true
+	for i := range e.opens {
+		e.opens[i] = -1
+	}
+	for _, line := range strings.Split(s, "\n") {
+		e.prepareNext(comment)
+		e.out = append(e.out, '#')
+		if line != "" {
+			e.out = append(e.out, ' ')
+			e.out = append(e.out, line...)
+		}
+	}
+}
+
 // WriteBool writes out the given boolean value.
 func (e *Encoder) WriteBool(b bool) {
 	if b {
@@ -112,6 +222,10 @@ func (e *Encoder) WriteBool(b bool) {
 // WriteString writes out the given string value.
 func (e *Encoder) WriteString(s string) {
 	e.prepareNext(scalar)
+	if e.octal {
+		e.out = appendOctalString(e.out, s)
+		return
+	}
 	e.out = appendString(e.out, s, e.outputASCII)
 }
 
@@ -164,6 +278,28 @@ func appendString(out []byte, in string, outputASCII bool) []byte {
 	return out
 }
 
+func appendOctalString(out []byte, in string) []byte {
+	out = append(out, '"')
+	for i := 0; i < len(in); i++ {
+		switch c := in[i]; {
+		case c == '"' || c == '\\' || c == '\'':
+			out = append(out, '\\', c)
+		case c == '\n':
+			out = append(out, '\\', 'n')
+		case c == '\r':
+			out = append(out, '\\', 'r')
+		case c == '\t':
+			out = append(out, '\\', 't')
+		case c < ' ' || c >= 0x7f:
+			out = append(out, '\\', '0'+(c>>6), '0'+(c>>3)&7, '0'+(c&7))
+		default:
+			out = append(out, c)
+		}
+	}
+	out = append(out, '"')
+	return out
+}
+
 // indexNeedEscapeInString returns the index of the character that needs
 // escaping. If no characters need escaping, this returns the input length.
 func indexNeedEscapeInString(s string) int {
@@ -226,7 +362,7 @@ func (e *Encoder) prepareNext(next encType) {
 		if e.lastType&(scalar|messageClose) != 0 && next == name {
 			e.out = append(e.out, ' ')
 			// Add a random extra space to make output unstable.
-			if detrand.Bool() {
+			if detrand.Bool() && !e.stable {
 				e.out = append(e.out, ' ')
 			}
 		}
@@ -238,7 +374,7 @@ func (e *Encoder) prepareNext(next encType) {
 	case e.lastType == name:
 		e.out = append(e.out, ' ')
 		// Add a random extra space after name: to make output unstable.
-		if detrand.Bool() {
+		if detrand.Bool() && !e.stable {
 			e.out = append(e.out, ' ')
 		}
 
@@ -247,6 +383,10 @@ func (e *Encoder) prepareNext(next encType) {
 		e.out = append(e.out, '\n')
 		e.out = append(e.out, e.indents...)
 
+	case e.lastType == comment:
+		e.out = append(e.out, '\n')
+		e.out = append(e.out, e.indents...)
+
 	case e.lastType&(scalar|messageClose) != 0:
 		if next == messageClose {
 			e.indents = e.indents[:len(e.indents)-len(e.indent)]
@@ -63,6 +63,29 @@ func TestEncoder(t *testing.T) {
 			wantOut:       `01234:"hello"`,
 			wantOutIndent: `01234: "hello"`,
 		},
+		{
+			desc: "comments",
+			write: func(e *text.Encoder) {
+				e.WriteComment("first")
+				e.WriteName("str")
+				e.WriteString("hello")
+				e.WriteName("msg")
+				e.StartMessage()
+				e.WriteComment("second\n\nlines")
+				e.WriteName("num")
+				e.WriteUint(1)
+				e.EndMessage()
+			},
+			wantOut: `str:"hello" msg:{num:1}`,
+			wantOutIndent: `# first
+str: "hello"
+msg: {
+	# second
+	#
+	# lines
+	num: 1
+}`,
+		},
 		{
 			desc: "string",
 			write: func(e *text.Encoder) {
@@ -524,6 +547,69 @@ func runEncodeStringsTest(t *testing.T, in string, want string, outputASCII bool
 	}
 }
 
+func TestEncoderSetStable(t *testing.T) {
+	for _, indent := range []string{"", "  "} {
+		e, err := text.NewEncoder(indent, [2]byte{}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.SetStable()
+		e.WriteName("a")
+		e.WriteInt(1)
+		e.WriteName("b")
+		e.StartMessage()
+		e.WriteName("c")
+		e.WriteBool(true)
+		e.EndMessage()
+
+		want := "a:1 b:{c:true}"
+		if indent != "" {
+			want = "a: 1\nb: {\n  c: true\n}"
+		}
+		if got := string(e.Bytes()); got != want {
+			t.Errorf("NewEncoder(%q) with SetStable:\ngot:  %q\nwant: %q", indent, got, want)
+		}
+	}
+}
+
+func TestEncoderSetOctalEscapes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "hello", want: `"hello"`},
+		{in: `"'\`, want: `"\"\'\\"`},
+		{in: "\n\r\t", want: `"\n\r\t"`},
+		{in: "\x00\x01\x1f\x7f", want: `"\000\001\037\177"`},
+		{in: "é\u1234", want: `"\303\251\341\210\264"`},
+		{in: "abc\xff", want: `"abc\377"`},
+	}
+	for _, tt := range tests {
+		enc, err := text.NewEncoder("", [2]byte{}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc.SetOctalEscapes()
+		enc.WriteString(tt.in)
+		if got := string(enc.Bytes()); got != tt.want {
+			t.Errorf("WriteString(%q) with SetOctalEscapes: got %s, want %s", tt.in, got, tt.want)
+		}
+
+		// The output must decode back to the input.
+		d := text.NewDecoder([]byte("a: " + tt.want))
+		if _, err := d.Read(); err != nil {
+			t.Fatal(err)
+		}
+		tok, err := d.Read()
+		if err != nil {
+			t.Fatalf("Read(%s) error: %v", tt.want, err)
+		}
+		if got, _ := tok.String(); got != tt.in {
+			t.Errorf("Read(%s): got %q, want %q", tt.want, got, tt.in)
+		}
+	}
+}
+
 func TestReset(t *testing.T) {
 	enc, err := text.NewEncoder("\t", [2]byte{}, false)
 	if err != nil {
@@ -548,3 +634,82 @@ func TestReset(t *testing.T) {
 		t.Errorf("Reset did not restore given position:\n<got>\n%v\n<want>\n%v\n", got, want)
 	}
 }
+
+func TestEncoderSetWidth(t *testing.T) {
+	write := func(e *text.Encoder) {
+		e.WriteName("a")
+		e.WriteInt(1)
+		e.WriteName("b")
+		e.StartMessage()
+		e.WriteName("c")
+		e.WriteBool(true)
+		e.WriteName("d")
+		e.StartMessage()
+		e.WriteName("e")
+		e.WriteString("hello")
+		e.EndMessage()
+		e.EndMessage()
+		e.WriteName("f")
+		e.StartMessage()
+		e.EndMessage()
+	}
+	tests := []struct {
+		width   int
+		compact bool
+		want    string
+	}{{
+		width:   100,
+		compact: true,
+		want:    `a: 1 b: {c: true d: {e: "hello"}} f: {}`,
+	}, {
+		width: 30,
+		want:  "a: 1\nb: {c: true d: {e: \"hello\"}}\nf: {}",
+	}, {
+		width: 20,
+		want:  "a: 1\nb: {\n  c: true\n  d: {e: \"hello\"}\n}\nf: {}",
+	}, {
+		width: 15,
+		want:  "a: 1\nb: {\n  c: true\n  d: {\n    e: \"hello\"\n  }\n}\nf: {}",
+	}}
+	for _, tt := range tests {
+		e, err := text.NewEncoder("  ", [2]byte{}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.SetStable()
+		e.SetWidth(tt.width)
+		write(e)
+		if got := e.Compact(); got != tt.compact {
+			t.Errorf("SetWidth(%d): Compact() = %v, want %v", tt.width, got, tt.compact)
+		}
+		if got := string(e.Bytes()); got != tt.want {
+			t.Errorf("SetWidth(%d):\ngot:  %q\nwant: %q", tt.width, got, tt.want)
+		}
+	}
+
+	// Messages with comments are not compacted.
+	e, err := text.NewEncoder("  ", [2]byte{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetStable()
+	e.SetWidth(100)
+	e.WriteName("a")
+	e.StartMessage()
+	e.WriteComment("comment")
+	e.WriteName("b")
+	e.WriteInt(1)
+	e.EndMessage()
+	e.WriteName("c")
+	e.StartMessage()
+	e.WriteName("d")
+	e.WriteInt(2)
+	e.EndMessage()
+	if e.Compact() {
+		t.Errorf("Compact() with comments = true, want false")
+	}
+	want := "a: {\n  # comment\n  b: 1\n}\nc: {d: 2}"
+	if got := string(e.Bytes()); got != want {
+		t.Errorf("SetWidth with comments:\ngot:  %q\nwant: %q", got, want)
+	}
+}
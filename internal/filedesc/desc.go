@@ -213,6 +213,7 @@ type (
 		IsPacked         bool // promoted from google.protobuf.FieldOptions
 		HasEnforceUTF8   bool // promoted from google.protobuf.FieldOptions
 		EnforceUTF8      bool // promoted from google.protobuf.FieldOptions
+		IsRedacted       bool // promoted from google.protobuf.FieldOptions
 		Default          defaultValue
 		ContainingOneof  pref.OneofDescriptor // must be consistent with Message.Oneofs.Fields
 		Enum             pref.EnumDescriptor
@@ -345,6 +346,14 @@ func (fd *Field) EnforceUTF8() bool {
 	return fd.L0.ParentFile.L1.Syntax == pref.Proto3
 }
 
+// IsRedacted is a pseudo-internal API to determine whether the field is
+// annotated with the debug_redact option, in which case its value should
+// not be shown in debugging output.
+//
+// WARNING: This method is exempt from the compatibility promise and may be
+// removed in the future without warning.
+func (fd *Field) IsRedacted() bool { return fd.L1.IsRedacted }
+
 func (od *Oneof) IsSynthetic() bool {
 	return od.L0.ParentFile.L1.Syntax == pref.Proto3 && len(od.L1.Fields.List) == 1 && od.L1.Fields.List[0].HasOptionalKeyword()
 }
@@ -375,6 +384,7 @@ type (
 		JSONName         jsonName
 		IsProto3Optional bool // promoted from google.protobuf.FieldDescriptorProto
 		IsPacked         bool // promoted from google.protobuf.FieldOptions
+		IsRedacted       bool // promoted from google.protobuf.FieldOptions
 		Default          defaultValue
 		Enum             pref.EnumDescriptor
 		Message          pref.MessageDescriptor
@@ -413,6 +423,14 @@ func (xd *Extension) Message() pref.MessageDescriptor            { return xd.laz
 func (xd *Extension) Format(s fmt.State, r rune)                 { descfmt.FormatDesc(s, r, xd) }
 func (xd *Extension) ProtoType(pref.FieldDescriptor)             {}
 func (xd *Extension) ProtoInternal(pragma.DoNotImplement)        {}
+
+// IsRedacted is a pseudo-internal API to determine whether the extension
+// field is annotated with the debug_redact option.
+//
+// WARNING: This method is exempt from the compatibility promise and may be
+// removed in the future without warning.
+func (xd *Extension) IsRedacted() bool { return xd.lazyInit().IsRedacted }
+
 func (xd *Extension) lazyInit() *ExtensionL2 {
 	xd.L0.ParentFile.lazyInit() // implicitly initializes L2
 	return xd.L2
@@ -496,6 +496,8 @@ func (fd *Field) unmarshalOptions(b []byte) {
 			case FieldOptions_EnforceUTF8:
 				fd.L1.HasEnforceUTF8 = true
 				fd.L1.EnforceUTF8 = protowire.DecodeBool(v)
+			case genid.FieldOptions_DebugRedact_field_number:
+				fd.L1.IsRedacted = protowire.DecodeBool(v)
 			}
 		default:
 			m := protowire.ConsumeFieldValue(num, typ, b)
@@ -588,6 +590,8 @@ func (xd *Extension) unmarshalOptions(b []byte) {
 			switch num {
 			case genid.FieldOptions_Packed_field_number:
 				xd.L2.IsPacked = protowire.DecodeBool(v)
+			case genid.FieldOptions_DebugRedact_field_number:
+				xd.L2.IsRedacted = protowire.DecodeBool(v)
 			}
 		default:
 			m := protowire.ConsumeFieldValue(num, typ, b)
@@ -0,0 +1,15 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package genid
+
+import protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+
+// Fields of google.protobuf.FieldOptions that are not declared in the version
+// of descriptor.proto from which descriptor_gen.go is generated.
+const (
+	FieldOptions_DebugRedact_field_name protoreflect.Name = "debug_redact"
+
+	FieldOptions_DebugRedact_field_number protoreflect.FieldNumber = 16
+)
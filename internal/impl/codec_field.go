@@ -232,10 +232,26 @@ func sizeMessageInfo(p pointer, f *coderFieldInfo, opts marshalOptions) int {
 
 func appendMessageInfo(b []byte, p pointer, f *coderFieldInfo, opts marshalOptions) ([]byte, error) {
 	b = protowire.AppendVarint(b, f.wiretag)
+	if !opts.UseCachedSize() {
+		return appendMessagePatched(b, p.Elem(), f.mi, opts)
+	}
 	b = protowire.AppendVarint(b, uint64(f.mi.sizePointer(p.Elem(), opts)))
 	return f.mi.marshalAppendPointer(b, p.Elem(), opts)
 }
 
+// appendMessagePatched appends the length-prefixed message p, writing the
+// length once the message has been marshaled. It is used when sizes are not
+// cached, since computing the size of every nested message before marshaling
+// it takes time quadratic in the depth of the message tree.
+func appendMessagePatched(b []byte, p pointer, mi *MessageInfo, opts marshalOptions) ([]byte, error) {
+	b, start := protowire.StartBytes(b)
+	b, err := mi.marshalAppendPointer(b, p, opts)
+	if err != nil {
+		return b, err
+	}
+	return protowire.EndBytes(b, start), nil
+}
+
 func consumeMessageInfo(b []byte, p pointer, wtyp protowire.Type, f *coderFieldInfo, opts unmarshalOptions) (out unmarshalOutput, err error) {
 	if wtyp != protowire.BytesType {
 		return out, errUnknown
@@ -478,6 +494,12 @@ func appendMessageSliceInfo(b []byte, p pointer, f *coderFieldInfo, opts marshal
 	var err error
 	for _, v := range s {
 		b = protowire.AppendVarint(b, f.wiretag)
+		if !opts.UseCachedSize() {
+			if b, err = appendMessagePatched(b, v, f.mi, opts); err != nil {
+				return b, err
+			}
+			continue
+		}
 		siz := f.mi.sizePointer(v, opts)
 		b = protowire.AppendVarint(b, uint64(siz))
 		b, err = f.mi.marshalAppendPointer(b, v, opts)
@@ -3145,18 +3145,13 @@ func appendSfixed32Slice(b []byte, p pointer, f *coderFieldInfo, _ marshalOption
 func consumeSfixed32Slice(b []byte, p pointer, wtyp protowire.Type, f *coderFieldInfo, _ unmarshalOptions) (out unmarshalOutput, err error) {
 	sp := p.Int32Slice()
 	if wtyp == protowire.BytesType {
-		s := *sp
 		b, n := protowire.ConsumeBytes(b)
 		if n < 0 {
 			return out, protowire.ParseError(n)
 		}
-		for len(b) > 0 {
-			v, n := protowire.ConsumeFixed32(b)
-			if n < 0 {
-				return out, protowire.ParseError(n)
-			}
-			s = append(s, int32(v))
-			b = b[n:]
+		s, m := protowire.ConsumePackedSfixed32(*sp, b)
+		if m < 0 {
+			return out, protowire.ParseError(m)
 		}
 		*sp = s
 		out.n = n
@@ -3200,9 +3195,7 @@ func appendSfixed32PackedSlice(b []byte, p pointer, f *coderFieldInfo, _ marshal
 	b = protowire.AppendVarint(b, f.wiretag)
 	n := len(s) * protowire.SizeFixed32()
 	b = protowire.AppendVarint(b, uint64(n))
-	for _, v := range s {
-		b = protowire.AppendFixed32(b, uint32(v))
-	}
+	b = protowire.AppendPackedSfixed32(b, s)
 	return b, nil
 }
 
@@ -3461,18 +3454,13 @@ func appendFixed32Slice(b []byte, p pointer, f *coderFieldInfo, _ marshalOptions
 func consumeFixed32Slice(b []byte, p pointer, wtyp protowire.Type, f *coderFieldInfo, _ unmarshalOptions) (out unmarshalOutput, err error) {
 	sp := p.Uint32Slice()
 	if wtyp == protowire.BytesType {
-		s := *sp
 		b, n := protowire.ConsumeBytes(b)
 		if n < 0 {
 			return out, protowire.ParseError(n)
 		}
-		for len(b) > 0 {
-			v, n := protowire.ConsumeFixed32(b)
-			if n < 0 {
-				return out, protowire.ParseError(n)
-			}
-			s = append(s, v)
-			b = b[n:]
+		s, m := protowire.ConsumePackedFixed32(*sp, b)
+		if m < 0 {
+			return out, protowire.ParseError(m)
 		}
 		*sp = s
 		out.n = n
@@ -3516,9 +3504,7 @@ func appendFixed32PackedSlice(b []byte, p pointer, f *coderFieldInfo, _ marshalO
 	b = protowire.AppendVarint(b, f.wiretag)
 	n := len(s) * protowire.SizeFixed32()
 	b = protowire.AppendVarint(b, uint64(n))
-	for _, v := range s {
-		b = protowire.AppendFixed32(b, v)
-	}
+	b = protowire.AppendPackedFixed32(b, s)
 	return b, nil
 }
 
@@ -3777,18 +3763,13 @@ func appendFloatSlice(b []byte, p pointer, f *coderFieldInfo, _ marshalOptions)
 func consumeFloatSlice(b []byte, p pointer, wtyp protowire.Type, f *coderFieldInfo, _ unmarshalOptions) (out unmarshalOutput, err error) {
 	sp := p.Float32Slice()
 	if wtyp == protowire.BytesType {
-		s := *sp
 		b, n := protowire.ConsumeBytes(b)
 		if n < 0 {
 			return out, protowire.ParseError(n)
 		}
-		for len(b) > 0 {
-			v, n := protowire.ConsumeFixed32(b)
-			if n < 0 {
-				return out, protowire.ParseError(n)
-			}
-			s = append(s, math.Float32frombits(v))
-			b = b[n:]
+		s, m := protowire.ConsumePackedFloat(*sp, b)
+		if m < 0 {
+			return out, protowire.ParseError(m)
 		}
 		*sp = s
 		out.n = n
@@ -3832,9 +3813,7 @@ func appendFloatPackedSlice(b []byte, p pointer, f *coderFieldInfo, _ marshalOpt
 	b = protowire.AppendVarint(b, f.wiretag)
 	n := len(s) * protowire.SizeFixed32()
 	b = protowire.AppendVarint(b, uint64(n))
-	for _, v := range s {
-		b = protowire.AppendFixed32(b, math.Float32bits(v))
-	}
+	b = protowire.AppendPackedFloat(b, s)
 	return b, nil
 }
 
@@ -4093,18 +4072,13 @@ func appendSfixed64Slice(b []byte, p pointer, f *coderFieldInfo, _ marshalOption
 func consumeSfixed64Slice(b []byte, p pointer, wtyp protowire.Type, f *coderFieldInfo, _ unmarshalOptions) (out unmarshalOutput, err error) {
 	sp := p.Int64Slice()
 	if wtyp == protowire.BytesType {
-		s := *sp
 		b, n := protowire.ConsumeBytes(b)
 		if n < 0 {
 			return out, protowire.ParseError(n)
 		}
-		for len(b) > 0 {
-			v, n := protowire.ConsumeFixed64(b)
-			if n < 0 {
-				return out, protowire.ParseError(n)
-			}
-			s = append(s, int64(v))
-			b = b[n:]
+		s, m := protowire.ConsumePackedSfixed64(*sp, b)
+		if m < 0 {
+			return out, protowire.ParseError(m)
 		}
 		*sp = s
 		out.n = n
@@ -4148,9 +4122,7 @@ func appendSfixed64PackedSlice(b []byte, p pointer, f *coderFieldInfo, _ marshal
 	b = protowire.AppendVarint(b, f.wiretag)
 	n := len(s) * protowire.SizeFixed64()
 	b = protowire.AppendVarint(b, uint64(n))
-	for _, v := range s {
-		b = protowire.AppendFixed64(b, uint64(v))
-	}
+	b = protowire.AppendPackedSfixed64(b, s)
 	return b, nil
 }
 
@@ -4409,18 +4381,13 @@ func appendFixed64Slice(b []byte, p pointer, f *coderFieldInfo, _ marshalOptions
 func consumeFixed64Slice(b []byte, p pointer, wtyp protowire.Type, f *coderFieldInfo, _ unmarshalOptions) (out unmarshalOutput, err error) {
 	sp := p.Uint64Slice()
 	if wtyp == protowire.BytesType {
-		s := *sp
 		b, n := protowire.ConsumeBytes(b)
 		if n < 0 {
 			return out, protowire.ParseError(n)
 		}
-		for len(b) > 0 {
-			v, n := protowire.ConsumeFixed64(b)
-			if n < 0 {
-				return out, protowire.ParseError(n)
-			}
-			s = append(s, v)
-			b = b[n:]
+		s, m := protowire.ConsumePackedFixed64(*sp, b)
+		if m < 0 {
+			return out, protowire.ParseError(m)
 		}
 		*sp = s
 		out.n = n
@@ -4464,9 +4431,7 @@ func appendFixed64PackedSlice(b []byte, p pointer, f *coderFieldInfo, _ marshalO
 	b = protowire.AppendVarint(b, f.wiretag)
 	n := len(s) * protowire.SizeFixed64()
 	b = protowire.AppendVarint(b, uint64(n))
-	for _, v := range s {
-		b = protowire.AppendFixed64(b, v)
-	}
+	b = protowire.AppendPackedFixed64(b, s)
 	return b, nil
 }
 
@@ -4725,18 +4690,13 @@ func appendDoubleSlice(b []byte, p pointer, f *coderFieldInfo, _ marshalOptions)
 func consumeDoubleSlice(b []byte, p pointer, wtyp protowire.Type, f *coderFieldInfo, _ unmarshalOptions) (out unmarshalOutput, err error) {
 	sp := p.Float64Slice()
 	if wtyp == protowire.BytesType {
-		s := *sp
 		b, n := protowire.ConsumeBytes(b)
 		if n < 0 {
 			return out, protowire.ParseError(n)
 		}
-		for len(b) > 0 {
-			v, n := protowire.ConsumeFixed64(b)
-			if n < 0 {
-				return out, protowire.ParseError(n)
-			}
-			s = append(s, math.Float64frombits(v))
-			b = b[n:]
+		s, m := protowire.ConsumePackedDouble(*sp, b)
+		if m < 0 {
+			return out, protowire.ParseError(m)
 		}
 		*sp = s
 		out.n = n
@@ -4780,9 +4740,7 @@ func appendDoublePackedSlice(b []byte, p pointer, f *coderFieldInfo, _ marshalOp
 	b = protowire.AppendVarint(b, f.wiretag)
 	n := len(s) * protowire.SizeFixed64()
 	b = protowire.AppendVarint(b, uint64(n))
-	for _, v := range s {
-		b = protowire.AppendFixed64(b, math.Float64bits(v))
-	}
+	b = protowire.AppendPackedDouble(b, s)
 	return b, nil
 }
 
@@ -8,9 +8,11 @@ import (
 	"errors"
 	"reflect"
 	"sort"
+	"sync"
 
 	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/internal/genid"
+	"google.golang.org/protobuf/internal/protoerrors"
 	pref "google.golang.org/protobuf/reflect/protoreflect"
 )
 
@@ -124,13 +126,15 @@ func consumeMap(b []byte, mapv reflect.Value, wtyp protowire.Type, mapi *mapInfo
 		key = mapi.keyZero
 		val = mapi.conv.valConv.New()
 	)
+	entryLen := len(b)
 	for len(b) > 0 {
+		rec, offset := b, entryLen-len(b)
 		num, wtyp, n := protowire.ConsumeTag(b)
 		if n < 0 {
-			return out, protowire.ParseError(n)
+			return out, protoerrors.Wrap(protowire.ParseError(n), rec, offset, num, wtyp)
 		}
 		if num > protowire.MaxValidNumber {
-			return out, errors.New("invalid field number")
+			return out, protoerrors.Wrap(errors.New("invalid field number"), rec, offset, num, wtyp)
 		}
 		b = b[n:]
 		err := errUnknown
@@ -157,10 +161,10 @@ func consumeMap(b []byte, mapv reflect.Value, wtyp protowire.Type, mapi *mapInfo
 		if err == errUnknown {
 			n = protowire.ConsumeFieldValue(num, wtyp, b)
 			if n < 0 {
-				return out, protowire.ParseError(n)
+				return out, protoerrors.Wrap(protowire.ParseError(n), rec, offset, num, wtyp)
 			}
 		} else if err != nil {
-			return out, err
+			return out, protoerrors.Wrap(err, rec, offset, num, wtyp)
 		}
 		b = b[n:]
 	}
@@ -181,13 +185,15 @@ func consumeMapOfMessage(b []byte, mapv reflect.Value, wtyp protowire.Type, mapi
 		key = mapi.keyZero
 		val = reflect.New(f.mi.GoReflectType.Elem())
 	)
+	entryLen := len(b)
 	for len(b) > 0 {
+		rec, offset := b, entryLen-len(b)
 		num, wtyp, n := protowire.ConsumeTag(b)
 		if n < 0 {
-			return out, protowire.ParseError(n)
+			return out, protoerrors.Wrap(protowire.ParseError(n), rec, offset, num, wtyp)
 		}
 		if num > protowire.MaxValidNumber {
-			return out, errors.New("invalid field number")
+			return out, protoerrors.Wrap(errors.New("invalid field number"), rec, offset, num, wtyp)
 		}
 		b = b[n:]
 		err := errUnknown
@@ -208,7 +214,7 @@ func consumeMapOfMessage(b []byte, mapv reflect.Value, wtyp protowire.Type, mapi
 			var v []byte
 			v, n = protowire.ConsumeBytes(b)
 			if n < 0 {
-				return out, protowire.ParseError(n)
+				return out, protoerrors.Wrap(protowire.ParseError(n), rec, offset, num, wtyp)
 			}
 			var o unmarshalOutput
 			o, err = f.mi.unmarshalPointer(v, pointerOfValue(val), 0, opts)
@@ -221,10 +227,10 @@ func consumeMapOfMessage(b []byte, mapv reflect.Value, wtyp protowire.Type, mapi
 		if err == errUnknown {
 			n = protowire.ConsumeFieldValue(num, wtyp, b)
 			if n < 0 {
-				return out, protowire.ParseError(n)
+				return out, protoerrors.Wrap(protowire.ParseError(n), rec, offset, num, wtyp)
 			}
 		} else if err != nil {
-			return out, err
+			return out, protoerrors.Wrap(err, rec, offset, num, wtyp)
 		}
 		b = b[n:]
 	}
@@ -284,27 +290,21 @@ func appendMap(b []byte, mapv reflect.Value, mapi *mapInfo, f *coderFieldInfo, o
 }
 
 func appendMapDeterministic(b []byte, mapv reflect.Value, mapi *mapInfo, f *coderFieldInfo, opts marshalOptions) ([]byte, error) {
-	keys := mapv.MapKeys()
-	sort.Slice(keys, func(i, j int) bool {
-		switch keys[i].Kind() {
-		case reflect.Bool:
-			return !keys[i].Bool() && keys[j].Bool()
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			return keys[i].Int() < keys[j].Int()
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-			return keys[i].Uint() < keys[j].Uint()
-		case reflect.Float32, reflect.Float64:
-			return keys[i].Float() < keys[j].Float()
-		case reflect.String:
-			return keys[i].String() < keys[j].String()
-		default:
-			panic("invalid kind: " + keys[i].Kind().String())
-		}
-	})
-	for _, key := range keys {
+	// The entries are copied into slices, which avoids allocating each key
+	// and value separately, and are sorted by their typed keys.
+	n := mapv.Len()
+	t := mapv.Type()
+	keys := reflect.MakeSlice(reflect.SliceOf(t.Key()), n, n)
+	vals := reflect.MakeSlice(reflect.SliceOf(t.Elem()), n, n)
+	copyMapEntries(mapv, keys, vals)
+	s := mapSorterPool.Get().(*mapSorter)
+	defer s.release()
+	s.init(keys)
+	sort.Sort(s)
+	for _, e := range s.entries {
 		var err error
 		b = protowire.AppendVarint(b, f.wiretag)
-		b, err = appendMapItem(b, key, mapv.MapIndex(key), mapi, f, opts)
+		b, err = appendMapItem(b, keys.Index(e.index), vals.Index(e.index), mapi, f, opts)
 		if err != nil {
 			return b, err
 		}
@@ -312,6 +312,74 @@ func appendMapDeterministic(b []byte, mapv reflect.Value, mapi *mapInfo, f *code
 	return b, nil
 }
 
+// mapSorter sorts the entries of a map by key.
+//
+// Each key is converted to a form that is compared without reflection.
+// Sorters are pooled so that deterministic marshaling of a map does not
+// allocate a new slice of entries every time.
+type mapSorter struct {
+	entries  []mapSortEntry
+	byString bool
+}
+
+type mapSortEntry struct {
+	ord   uint64 // order-preserving representation of a bool or integer key
+	str   string // string key
+	index int    // index of the entry in the copied keys and values
+}
+
+var mapSorterPool = sync.Pool{
+	New: func() interface{} { return new(mapSorter) },
+}
+
+// init sets the entries to sort from a slice of map keys.
+func (s *mapSorter) init(keys reflect.Value) {
+	n := keys.Len()
+	if cap(s.entries) < n {
+		s.entries = make([]mapSortEntry, n)
+	}
+	s.entries = s.entries[:n]
+	kind := keys.Type().Elem().Kind()
+	s.byString = kind == reflect.String
+	for i := range s.entries {
+		e := &s.entries[i]
+		e.index = i
+		switch k := keys.Index(i); kind {
+		case reflect.Bool:
+			if k.Bool() {
+				e.ord = 1
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			e.ord = uint64(k.Int()) ^ (1 << 63)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			e.ord = k.Uint()
+		case reflect.String:
+			e.str = k.String()
+		default:
+			panic("invalid kind: " + kind.String())
+		}
+	}
+}
+
+func (s *mapSorter) Len() int      { return len(s.entries) }
+func (s *mapSorter) Swap(i, j int) { s.entries[i], s.entries[j] = s.entries[j], s.entries[i] }
+func (s *mapSorter) Less(i, j int) bool {
+	if s.byString {
+		return s.entries[i].str < s.entries[j].str
+	}
+	return s.entries[i].ord < s.entries[j].ord
+}
+
+// release clears the entries, so as not to retain references to the map,
+// and returns the sorter to the pool.
+func (s *mapSorter) release() {
+	for i := range s.entries {
+		s.entries[i] = mapSortEntry{}
+	}
+	s.entries = s.entries[:0]
+	mapSorterPool.Put(s)
+}
+
 func isInitMap(mapv reflect.Value, mapi *mapInfo, f *coderFieldInfo) error {
 	if mi := f.mi; mi != nil {
 		mi.init()
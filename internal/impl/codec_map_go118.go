@@ -0,0 +1,19 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build go1.18
+
+package impl
+
+import "reflect"
+
+// copyMapEntries copies the entries of the map mapv into the slices keys and
+// vals, which have the length of the map, without allocating each of them.
+func copyMapEntries(mapv, keys, vals reflect.Value) {
+	iter := mapv.MapRange()
+	for i := 0; iter.Next(); i++ {
+		keys.Index(i).SetIterKey(iter)
+		vals.Index(i).SetIterValue(iter)
+	}
+}
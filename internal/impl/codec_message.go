@@ -148,7 +148,12 @@ func (mi *MessageInfo) makeCoderMethods(t reflect.Type, si structInfo) {
 	}
 	if mi.methods.Unmarshal == nil {
 		mi.methods.Flags |= piface.SupportUnmarshalDiscardUnknown
+		mi.methods.Flags |= piface.SupportUnmarshalRejectUnknown
+		mi.methods.Flags |= piface.SupportUnmarshalUnknownFieldHandler
 		mi.methods.Unmarshal = mi.unmarshal
+		if mi.methods.Validate == nil {
+			mi.methods.Validate = mi.validateInput
+		}
 	}
 	if mi.methods.CheckInitialized == nil {
 		mi.methods.CheckInitialized = mi.checkInitialized
@@ -156,4 +161,7 @@ func (mi *MessageInfo) makeCoderMethods(t reflect.Type, si structInfo) {
 	if mi.methods.Merge == nil {
 		mi.methods.Merge = mi.merge
 	}
+	if mi.methods.Equal == nil {
+		mi.methods.Equal = mi.equal
+	}
 }
@@ -11,6 +11,7 @@ import (
 	"google.golang.org/protobuf/internal/encoding/messageset"
 	"google.golang.org/protobuf/internal/errors"
 	"google.golang.org/protobuf/internal/flags"
+	"google.golang.org/protobuf/internal/protoerrors"
 )
 
 func sizeMessageSet(mi *MessageInfo, p pointer, opts marshalOptions) (size int) {
@@ -105,8 +106,15 @@ func unmarshalMessageSet(mi *MessageInfo, b []byte, p pointer, opts unmarshalOpt
 	err = messageset.Unmarshal(b, true, func(num protowire.Number, v []byte) error {
 		o, err := mi.unmarshalExtension(v, num, protowire.BytesType, ext, opts)
 		if err == errUnknown {
+			if opts.RejectUnknown() {
+				return protoerrors.UnknownField(mi.Desc, nil, num, protowire.BytesType)
+			}
+			field := len(*unknown)
 			*unknown = protowire.AppendTag(*unknown, num, protowire.BytesType)
 			*unknown = append(*unknown, v...)
+			if opts.unknownHandler != nil && !opts.unknownHandler(mi.Desc, num, protowire.BytesType, (*unknown)[field:]) {
+				*unknown = (*unknown)[:field]
+			}
 			return nil
 		}
 		if !o.initialized {
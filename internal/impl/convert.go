@@ -320,6 +320,10 @@ func (c *stringConverter) PBValueOf(v reflect.Value) pref.Value {
 	if v.Type() != c.goType {
 		panic(fmt.Sprintf("invalid type: got %v, want %v", v.Type(), c.goType))
 	}
+	if v.Kind() == reflect.String {
+		// Convert copies an addressable value, such as a map key being sorted.
+		return pref.ValueOfString(v.String())
+	}
 	return pref.ValueOfString(v.Convert(stringType).String())
 }
 func (c *stringConverter) GoValueOf(v pref.Value) reflect.Value {
@@ -10,6 +10,7 @@ import (
 	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/internal/errors"
 	"google.golang.org/protobuf/internal/flags"
+	"google.golang.org/protobuf/internal/protoerrors"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	preg "google.golang.org/protobuf/reflect/protoregistry"
@@ -23,6 +24,7 @@ type unmarshalOptions struct {
 		FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error)
 		FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error)
 	}
+	unknownHandler func(protoreflect.MessageDescriptor, protowire.Number, protowire.Type, []byte) bool
 }
 
 func (o unmarshalOptions) Options() proto.UnmarshalOptions {
@@ -30,14 +32,27 @@ func (o unmarshalOptions) Options() proto.UnmarshalOptions {
 		Merge:          true,
 		AllowPartial:   true,
 		DiscardUnknown: o.DiscardUnknown(),
+		RejectUnknown:  o.RejectUnknown(),
 		Resolver:       o.resolver,
+
+		UnknownFieldHandler: o.unknownHandler,
 	}
 }
 
 func (o unmarshalOptions) DiscardUnknown() bool { return o.flags&piface.UnmarshalDiscardUnknown != 0 }
+func (o unmarshalOptions) RejectUnknown() bool  { return o.flags&piface.UnmarshalRejectUnknown != 0 }
+
+// retainUnknown reports whether to store the unknown field b
+// in the unknown fields of a message with the descriptor md.
+func (o unmarshalOptions) retainUnknown(md protoreflect.MessageDescriptor, num protowire.Number, wtyp protowire.Type, b []byte) bool {
+	if o.unknownHandler != nil {
+		return o.unknownHandler(md, num, wtyp, b)
+	}
+	return !o.DiscardUnknown()
+}
 
 func (o unmarshalOptions) IsDefault() bool {
-	return o.flags == 0 && o.resolver == preg.GlobalTypes
+	return o.flags == 0 && o.resolver == preg.GlobalTypes && o.unknownHandler == nil
 }
 
 var lazyUnmarshalOptions = unmarshalOptions{
@@ -58,8 +73,9 @@ func (mi *MessageInfo) unmarshal(in piface.UnmarshalInput) (piface.UnmarshalOutp
 		p = in.Message.(*messageReflectWrapper).pointer()
 	}
 	out, err := mi.unmarshalPointer(in.Buf, p, 0, unmarshalOptions{
-		flags:    in.Flags,
-		resolver: in.Resolver,
+		flags:          in.Flags,
+		resolver:       in.Resolver,
+		unknownHandler: in.UnknownFieldHandler,
 	})
 	var flags piface.UnmarshalOutputFlags
 	if out.initialized {
@@ -88,6 +104,8 @@ func (mi *MessageInfo) unmarshalPointer(b []byte, p pointer, groupTag protowire.
 	var exts *map[int32]ExtensionField
 	start := len(b)
 	for len(b) > 0 {
+		rec := b
+
 		// Parse the tag (field number and wire type).
 		var tag uint64
 		if b[0] < 0x80 {
@@ -100,13 +118,14 @@ func (mi *MessageInfo) unmarshalPointer(b []byte, p pointer, groupTag protowire.
 			var n int
 			tag, n = protowire.ConsumeVarint(b)
 			if n < 0 {
-				return out, protowire.ParseError(n)
+				return out, protoerrors.Wrap(protowire.ParseError(n), rec, start-len(rec), 0, 0)
 			}
 			b = b[n:]
 		}
 		var num protowire.Number
 		if n := tag >> 3; n < uint64(protowire.MinValidNumber) || n > uint64(protowire.MaxValidNumber) {
-			return out, errors.New("invalid field number")
+			err := errors.New("invalid field number")
+			return out, protoerrors.Wrap(err, rec, start-len(rec), protowire.Number(n), protowire.Type(tag&7))
 		} else {
 			num = protowire.Number(n)
 		}
@@ -114,7 +133,8 @@ func (mi *MessageInfo) unmarshalPointer(b []byte, p pointer, groupTag protowire.
 
 		if wtyp == protowire.EndGroupType {
 			if num != groupTag {
-				return out, errors.New("mismatching end group marker")
+				err := errors.New("mismatching end group marker")
+				return out, protoerrors.Wrap(err, rec, start-len(rec), num, wtyp)
 			}
 			groupTag = 0
 			break
@@ -166,13 +186,17 @@ func (mi *MessageInfo) unmarshalPointer(b []byte, p pointer, groupTag protowire.
 		}
 		if err != nil {
 			if err != errUnknown {
-				return out, err
+				return out, protoerrors.Wrap(err, rec, start-len(rec), num, wtyp)
+			}
+			if opts.RejectUnknown() {
+				err := protoerrors.UnknownField(mi.Desc, mi.Desc.Fields().ByNumber(num), num, wtyp)
+				return out, protoerrors.Wrap(err, rec, start-len(rec), num, wtyp)
 			}
 			n = protowire.ConsumeFieldValue(num, wtyp, b)
 			if n < 0 {
-				return out, protowire.ParseError(n)
+				return out, protoerrors.Wrap(protowire.ParseError(n), rec, start-len(rec), num, wtyp)
 			}
-			if !opts.DiscardUnknown() && mi.unknownOffset.IsValid() {
+			if opts.retainUnknown(mi.Desc, num, wtyp, rec[:len(rec)-len(b)+n]) && mi.unknownOffset.IsValid() {
 				u := p.Apply(mi.unknownOffset).Bytes()
 				*u = protowire.AppendTag(*u, num, wtyp)
 				*u = append(*u, b[:n]...)
@@ -0,0 +1,173 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package impl
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
+	piface "google.golang.org/protobuf/runtime/protoiface"
+)
+
+// equal is protoreflect.Methods.Equal.
+func (mi *MessageInfo) equal(in piface.EqualInput) piface.EqualOutput {
+	return piface.EqualOutput{Equal: equalMessage(in.MessageA, in.MessageB)}
+}
+
+// equalMessage compares two messages. It accesses the fields of messages
+// with the same MessageInfo directly, rather than through protoreflect.Message.
+func equalMessage(mx, my pref.Message) bool {
+	px, mix := messagePointerInfo(mx)
+	py, miy := messagePointerInfo(my)
+	if mix == nil || mix != miy {
+		return proto.Equal(mx.Interface(), my.Interface())
+	}
+	return mix.equalPointer(px, py)
+}
+
+func messagePointerInfo(m pref.Message) (pointer, *MessageInfo) {
+	switch m := m.(type) {
+	case *messageState:
+		return m.pointer(), m.messageInfo()
+	case *messageReflectWrapper:
+		return m.pointer(), m.messageInfo()
+	}
+	return pointer{}, nil
+}
+
+func (mi *MessageInfo) equalPointer(px, py pointer) bool {
+	mi.init()
+	for _, ri := range mi.rangeInfos {
+		var fi *fieldInfo
+		switch ri := ri.(type) {
+		case *fieldInfo:
+			hx, hy := ri.has(px), ri.has(py)
+			if hx != hy {
+				return false
+			}
+			if !hx {
+				continue
+			}
+			fi = ri
+		case *oneofInfo:
+			nx, ny := ri.which(px), ri.which(py)
+			if nx != ny {
+				return false
+			}
+			if nx == 0 {
+				continue
+			}
+			fi = mi.fields[nx]
+		}
+		if !equalField(fi.fieldDesc, fi.get(px), fi.get(py)) {
+			return false
+		}
+	}
+	if !equalExtensions(mi.extensionMap(px), mi.extensionMap(py)) {
+		return false
+	}
+	return equalUnknown(mi.getUnknown(px), mi.getUnknown(py))
+}
+
+// equalExtensions compares two extension maps,
+// where empty lists are treated as unpopulated.
+func equalExtensions(ex, ey *extensionMap) bool {
+	nx := 0
+	equal := true
+	ex.Range(func(xd pref.FieldDescriptor, vx pref.Value) bool {
+		nx++
+		var y ExtensionField
+		ok := false
+		if ey != nil {
+			y, ok = (*ey)[int32(xd.Number())]
+		}
+		equal = ok && equalField(xd, vx, y.Value())
+		return equal
+	})
+	if !equal {
+		return false
+	}
+	ny := 0
+	ey.Range(func(pref.FieldDescriptor, pref.Value) bool {
+		ny++
+		return true
+	})
+	return nx == ny
+}
+
+func equalField(fd pref.FieldDescriptor, x, y pref.Value) bool {
+	switch {
+	case fd.IsList():
+		lx, ly := x.List(), y.List()
+		if lx.Len() != ly.Len() {
+			return false
+		}
+		for i := lx.Len() - 1; i >= 0; i-- {
+			if !equalValue(fd, lx.Get(i), ly.Get(i)) {
+				return false
+			}
+		}
+		return true
+	case fd.IsMap():
+		mx, my := x.Map(), y.Map()
+		if mx.Len() != my.Len() {
+			return false
+		}
+		equal := true
+		mx.Range(func(k pref.MapKey, vx pref.Value) bool {
+			vy := my.Get(k)
+			equal = vy.IsValid() && equalValue(fd.MapValue(), vx, vy)
+			return equal
+		})
+		return equal
+	default:
+		return equalValue(fd, x, y)
+	}
+}
+
+func equalValue(fd pref.FieldDescriptor, x, y pref.Value) bool {
+	switch fd.Kind() {
+	case pref.MessageKind, pref.GroupKind:
+		return equalMessage(x.Message(), y.Message())
+	case pref.BytesKind:
+		return bytes.Equal(x.Bytes(), y.Bytes())
+	case pref.FloatKind, pref.DoubleKind:
+		fx, fy := x.Float(), y.Float()
+		if math.IsNaN(fx) || math.IsNaN(fy) {
+			return math.IsNaN(fx) && math.IsNaN(fy)
+		}
+		return fx == fy
+	default:
+		return x.Interface() == y.Interface()
+	}
+}
+
+// equalUnknown compares unknown fields by direct comparison on the raw bytes
+// of each individual field number.
+func equalUnknown(x, y pref.RawFields) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	if bytes.Equal([]byte(x), []byte(y)) {
+		return true
+	}
+	mx := make(map[pref.FieldNumber]pref.RawFields)
+	my := make(map[pref.FieldNumber]pref.RawFields)
+	for len(x) > 0 {
+		fnum, _, n := protowire.ConsumeField(x)
+		mx[fnum] = append(mx[fnum], x[:n]...)
+		x = x[n:]
+	}
+	for len(y) > 0 {
+		fnum, _, n := protowire.ConsumeField(y)
+		my[fnum] = append(my[fnum], y[:n]...)
+		y = y[n:]
+	}
+	return reflect.DeepEqual(mx, my)
+}
@@ -40,6 +40,21 @@ func (m *messageState) ProtoMessageInfo() *MessageInfo {
 	return m.messageInfo()
 }
 
+// ProtoSizeCache is a pseudo-internal API for allowing the proto package
+// to access the cached size of the message. It returns nil if the message
+// has no size cache.
+//
+// WARNING: This method is exempt from the compatibility promise and
+// may be removed in the future without warning.
+func (m *messageState) ProtoSizeCache() *int32 {
+	mi := m.messageInfo()
+	mi.init()
+	if !mi.sizecacheOffset.IsValid() {
+		return nil
+	}
+	return m.pointer().Apply(mi.sizecacheOffset).Int32()
+}
+
 func (m *messageState) Range(f func(protoreflect.FieldDescriptor, protoreflect.Value) bool) {
 	m.messageInfo().init()
 	for _, ri := range m.messageInfo().rangeInfos {
@@ -160,6 +175,21 @@ func (m *messageReflectWrapper) ProtoMessageInfo() *MessageInfo {
 	return m.messageInfo()
 }
 
+// ProtoSizeCache is a pseudo-internal API for allowing the proto package
+// to access the cached size of the message. It returns nil if the message
+// has no size cache.
+//
+// WARNING: This method is exempt from the compatibility promise and
+// may be removed in the future without warning.
+func (m *messageReflectWrapper) ProtoSizeCache() *int32 {
+	mi := m.messageInfo()
+	mi.init()
+	if !mi.sizecacheOffset.IsValid() {
+		return nil
+	}
+	return m.pointer().Apply(mi.sizecacheOffset).Int32()
+}
+
 func (m *messageReflectWrapper) Range(f func(protoreflect.FieldDescriptor, protoreflect.Value) bool) {
 	m.messageInfo().init()
 	for _, ri := range m.messageInfo().rangeInfos {
@@ -74,6 +74,32 @@ func Validate(mt pref.MessageType, in piface.UnmarshalInput) (out piface.Unmarsh
 	return out, st
 }
 
+// validateInput is protoreflect.Methods.Validate.
+func (mi *MessageInfo) validateInput(in piface.UnmarshalInput) (out piface.ValidateOutput) {
+	if in.Flags&piface.UnmarshalRejectUnknown != 0 {
+		// The validator accepts unknown fields, so it cannot render
+		// a judgement when they must be rejected.
+		return out
+	}
+	if in.Resolver == nil {
+		in.Resolver = preg.GlobalTypes
+	}
+	o, st := mi.validate(in.Buf, 0, unmarshalOptions{
+		flags:    in.Flags,
+		resolver: in.Resolver,
+	})
+	switch st {
+	case ValidationValid:
+		out.Flags |= piface.ValidateValid
+		if o.initialized {
+			out.Flags |= piface.ValidateInitialized
+		}
+	case ValidationInvalid:
+		out.Flags |= piface.ValidateInvalid
+	}
+	return out
+}
+
 type validationInfo struct {
 	mi               *MessageInfo
 	typ              validationType
@@ -0,0 +1,96 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package protoerrors implements the errors reported when parsing the wire
+// format, which are shared by every implementation of unmarshaling.
+package protoerrors
+
+import (
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/internal/errors"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// UnmarshalError is the error returned by Unmarshal when the input is not
+// a valid wire-format encoding of the message.
+// It is exported as proto.UnmarshalError.
+type UnmarshalError struct {
+	// Offset is the byte offset within the input of the start of the
+	// innermost field record containing the error.
+	Offset int
+
+	// Path is the sequence of field numbers leading from the top-level
+	// message to the innermost field record containing the error.
+	// Map entries appear as a message with a key field (1) and
+	// a value field (2).
+	Path []protowire.Number
+
+	// WireType is the wire type of the innermost field record.
+	// For known fields, this is the wire type expected for the field,
+	// since a mismatching wire type causes the record to be treated
+	// as an unknown field instead.
+	WireType protowire.Type
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *UnmarshalError) Error() string {
+	path := make([]byte, 0, 4*len(e.Path))
+	for i, num := range e.Path {
+		if i > 0 {
+			path = append(path, '.')
+		}
+		path = strconv.AppendInt(path, int64(num), 10)
+	}
+	return errors.New("%v (field %s, wire type %d, offset %d)", e.Err, path, e.WireType, e.Offset).Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *UnmarshalError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the proto.Error sentinel.
+func (e *UnmarshalError) Is(target error) bool {
+	return target == errors.Error
+}
+
+// Wrap annotates err, which occurred while parsing the field record
+// at the start of b, with the number and wire type of the field
+// and the offset of the record within the enclosing message.
+//
+// If err is an UnmarshalError from a message nested within the record,
+// it is updated to be relative to the enclosing message.
+func Wrap(err error, b []byte, offset int, num protowire.Number, wtyp protowire.Type) error {
+	e, ok := err.(*UnmarshalError)
+	if !ok {
+		return &UnmarshalError{
+			Offset:   offset,
+			Path:     []protowire.Number{num},
+			WireType: wtyp,
+			Err:      err,
+		}
+	}
+	_, _, n := protowire.ConsumeTag(b)
+	if wtyp == protowire.BytesType {
+		_, m := protowire.ConsumeVarint(b[n:])
+		n += m
+	}
+	e.Offset += offset + n
+	e.Path = append([]protowire.Number{num}, e.Path...)
+	return e
+}
+
+// UnknownField returns the error reported by UnmarshalOptions.RejectUnknown
+// for a field of message md with the given number and wire type,
+// where fd is the field descriptor if the field is known.
+func UnknownField(md protoreflect.MessageDescriptor, fd protoreflect.FieldDescriptor, num protowire.Number, wtyp protowire.Type) error {
+	if fd != nil {
+		return errors.New("%v: field %v has unexpected wire type %d", md.FullName(), fd.Name(), wtyp)
+	}
+	return errors.New("%v: unknown field %v", md.FullName(), num)
+}
@@ -0,0 +1,25 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package redact provides support for the debug_redact field option.
+package redact
+
+import (
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Placeholder is the text written in place of the value of a redacted field.
+const Placeholder = "[REDACTED]"
+
+// IsRedacted reports whether the field is annotated with the debug_redact
+// option, in which case its value should not be shown in debugging output.
+func IsRedacted(fd protoreflect.FieldDescriptor) bool {
+	if xd, ok := fd.(protoreflect.ExtensionTypeDescriptor); ok {
+		fd = xd.Descriptor()
+	}
+	if fd, ok := fd.(interface{ IsRedacted() bool }); ok {
+		return fd.IsRedacted()
+	}
+	return false
+}
@@ -42,7 +42,8 @@ import (
 //	6. Tag a new version, where the tag is is the current String.
 //
 //	7. Write release notes for all notable changes
-//	between this release and the last release.
+//	between this release and the last release,
+//	starting from those collected in RELEASE_NOTES.md.
 //
 //	8. Create a new CL.
 //
@@ -11,6 +11,8 @@ import (
 	"testing"
 
 	"google.golang.org/protobuf/proto"
+
+	testpb "google.golang.org/protobuf/internal/testprotos/test"
 )
 
 // The results of these microbenchmarks are unlikely to correspond well
@@ -59,3 +61,82 @@ func BenchmarkDecode(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkEncodeMap benchmarks encoding large map fields,
+// with and without deterministic ordering.
+func BenchmarkEncodeMap(b *testing.B) {
+	m := &testpb.TestAllTypes{
+		MapInt32Int32:   make(map[int32]int32),
+		MapStringString: make(map[string]string),
+	}
+	for i := int32(0); i < 1000; i++ {
+		m.MapInt32Int32[i*7919%1000-500] = i
+		m.MapStringString[fmt.Sprint(i*7919%1000)] = "value"
+	}
+	for _, deterministic := range []bool{false, true} {
+		opts := proto.MarshalOptions{Deterministic: deterministic}
+		b.Run(fmt.Sprintf("Deterministic=%v", deterministic), func(b *testing.B) {
+			b.ReportAllocs()
+			var buf []byte
+			for i := 0; i < b.N; i++ {
+				var err error
+				buf, err = opts.MarshalAppend(buf[:0], m)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEqual benchmarks comparing each test message with a copy of itself.
+func BenchmarkEqual(b *testing.B) {
+	for _, test := range testValidMessages {
+		for _, x := range test.decodeTo {
+			y := proto.Clone(x)
+			b.Run(fmt.Sprintf("%s (%T)", test.desc, x), func(b *testing.B) {
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						if !proto.Equal(x, y) {
+							b.Fatal("proto.Equal = false, want true")
+						}
+					}
+				})
+			})
+		}
+	}
+}
+
+// BenchmarkEncodeBatch benchmarks encoding many small length-prefixed
+// messages, one at a time and as a batch.
+func BenchmarkEncodeBatch(b *testing.B) {
+	ms := make([]proto.Message, 1000)
+	for i := range ms {
+		ms[i] = &testpb.TestAllTypes{
+			OptionalInt32:  proto.Int32(int32(i)),
+			OptionalString: proto.String("record"),
+		}
+	}
+	opts := proto.MarshalOptions{Framing: proto.FramingVarint}
+	b.Run("Single", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var buf []byte
+			for _, m := range ms {
+				var err error
+				buf, err = opts.MarshalAppend(buf, m)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("Batch", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := opts.MarshalAppendBatch(nil, ms); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// CanonicalizeWire returns the canonical form of the wire-format encoding b
+// of a message of the type md, as produced by protowire.CanonicalizeOptions.
+// Nested messages, groups, and maps are canonicalized according to the
+// fields of md. Unlike unmarshaling and marshaling with MarshalOptions.Canonical,
+// it does not require a Go type for the message and preserves every field
+// record in b, including unknown fields and repeated records of a field.
+func CanonicalizeWire(b []byte, md protoreflect.MessageDescriptor) ([]byte, error) {
+	return canonicalizeOptions(md).Canonicalize(b)
+}
+
+// canonicalizeOptions returns the options for canonicalizing a message of the
+// type md. The options for nested messages are created lazily, which permits
+// recursive message types.
+func canonicalizeOptions(md protoreflect.MessageDescriptor) *protowire.CanonicalizeOptions {
+	fields := md.Fields()
+	return &protowire.CanonicalizeOptions{
+		Field: func(num protowire.Number) protowire.CanonicalField {
+			fd := fields.ByNumber(num)
+			if fd == nil || fd.Message() == nil {
+				return protowire.CanonicalField{}
+			}
+			f := protowire.CanonicalField{Message: canonicalizeOptions(fd.Message())}
+			if fd.IsMap() {
+				f.MapKey = mapKeyKind(fd.MapKey().Kind())
+			}
+			return f
+		},
+	}
+}
+
+func mapKeyKind(k protoreflect.Kind) protowire.MapKeyKind {
+	switch k {
+	case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind:
+		return protowire.SignedKey
+	case protoreflect.Sint32Kind, protoreflect.Sint64Kind:
+		return protowire.ZigZagKey
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		return protowire.BytesKey
+	default:
+		return protowire.UnsignedKey
+	}
+}
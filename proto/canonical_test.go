@@ -0,0 +1,59 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto_test
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	testpb "google.golang.org/protobuf/internal/testprotos/test"
+)
+
+func TestCanonicalizeWire(t *testing.T) {
+	m := &testpb.TestAllTypes{
+		OptionalInt32: proto.Int32(1),
+		OptionalNestedMessage: &testpb.TestAllTypes_NestedMessage{
+			A:           proto.Int32(2),
+			Corecursive: &testpb.TestAllTypes{OptionalString: proto.String("nested")},
+		},
+		Optionalgroup:       &testpb.TestAllTypes_OptionalGroup{A: proto.Int32(3)},
+		MapInt32Int32:       map[int32]int32{-1: 1, 0: 2, 5: 3, 1 << 20: 4},
+		MapSint64Sint64:     map[int64]int64{-100: 1, -1: 2, 1: 3},
+		MapSfixed32Sfixed32: map[int32]int32{-7: 1, 7: 2},
+		MapBoolBool:         map[bool]bool{true: true, false: false},
+		MapStringString:     map[string]string{"b": "1", "a": "2", "ab": "3", "": "4"},
+		MapStringNestedMessage: map[string]*testpb.TestAllTypes_NestedMessage{
+			"x": {A: proto.Int32(1)},
+			"y": {Corecursive: &testpb.TestAllTypes{MapUint32Uint32: map[uint32]uint32{3: 1, 1: 2, 2: 3}}},
+		},
+	}
+	want, err := proto.MarshalOptions{Canonical: true}.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reverse the order of the top-level fields of the default encoding.
+	b, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var in []byte
+	for len(b) > 0 {
+		_, _, n := protowire.ConsumeField(b)
+		in = append(append([]byte(nil), b[:n]...), in...)
+		b = b[n:]
+	}
+
+	got, err := proto.CanonicalizeWire(in, m.ProtoReflect().Descriptor())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("CanonicalizeWire does not match canonical marshaling:\ngot:  %x\nwant: %x", got, want)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"google.golang.org/protobuf/internal/flags"
 	"google.golang.org/protobuf/internal/genid"
 	"google.golang.org/protobuf/internal/pragma"
+	"google.golang.org/protobuf/internal/protoerrors"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/runtime/protoiface"
@@ -25,7 +26,12 @@ type UnmarshalOptions struct {
 
 	// Merge merges the input into the destination message.
 	// The default behavior is to always reset the message before unmarshaling,
-	// unless Merge is specified.
+	// unless Merge is specified. Since the reset is performed by the
+	// unmarshaler, there is no need to call Reset before Unmarshal.
+	//
+	// When merging, populated scalar fields in the input replace those in the
+	// destination, singular messages are merged, and the elements of repeated
+	// fields and entries of map fields are appended and inserted respectively.
 	Merge bool
 
 	// AllowPartial accepts input for messages that will result in missing
@@ -36,6 +42,62 @@ type UnmarshalOptions struct {
 	// If DiscardUnknown is set, unknown fields are ignored.
 	DiscardUnknown bool
 
+	// If RejectUnknown is set, Unmarshal reports an error upon encountering
+	// a field that would otherwise be placed in the unknown fields of any
+	// message: a field number not declared by the message, an extension that
+	// cannot be resolved, or a known field with an unexpected wire type.
+	// It takes precedence over DiscardUnknown.
+	RejectUnknown bool
+
+	// UnknownFieldHandler, if non-nil, is called for every unknown field
+	// encountered in the input, including those within nested messages.
+	// It is passed the descriptor of the message containing the field,
+	// the field number and wire type, and the wire-format encoding of the
+	// field including its tag, which must not be retained after the handler
+	// returns. The field is stored in the unknown fields of the message if
+	// and only if the handler returns true.
+	//
+	// It takes precedence over DiscardUnknown, and is not called
+	// if RejectUnknown is set.
+	UnknownFieldHandler func(md protoreflect.MessageDescriptor, num protowire.Number, typ protowire.Type, b []byte) (retain bool)
+
+	// Fields, if non-nil, is the set of field numbers of the top-level message
+	// to unmarshal. The records of all other fields are skipped without being
+	// decoded, and are treated as unknown fields: they are retained in the
+	// unknown fields of the message unless DiscardUnknown is set or
+	// UnknownFieldHandler says otherwise. RejectUnknown does not apply to them.
+	//
+	// Selected message fields are unmarshaled in their entirety.
+	// Since unselected fields are not decoded, required fields among them
+	// are reported as missing unless AllowPartial is set.
+	Fields []protoreflect.FieldNumber
+
+	// InvalidUTF8 specifies how a string field that must contain valid UTF-8
+	// is handled if it does not. The default is to report an error.
+	// Setting this to any other value disables the fast-path unmarshaler.
+	InvalidUTF8 InvalidUTF8Handling
+
+	// InvalidUTF8Handler, if non-nil, is called for every string field in the
+	// input that must contain valid UTF-8 but does not, and is not rejected
+	// as a result of the InvalidUTF8 setting. It may be used to collect
+	// warnings about the input.
+	InvalidUTF8Handler func(fd protoreflect.FieldDescriptor)
+
+	// DuplicateFieldHandler, if non-nil, is called for every record in the
+	// input for a singular field that was already set by an earlier record
+	// for the same message, or for a member of a oneof that already had a
+	// member set by an earlier record. Such records replace the earlier
+	// value, or are merged into it for message fields. They are reported
+	// for nested messages as well, but records within separate occurrences
+	// of the same message field are not compared against each other.
+	// Setting this disables the fast-path unmarshaler.
+	DuplicateFieldHandler func(fd protoreflect.FieldDescriptor)
+
+	// WeakFields specifies how weak fields are unmarshaled.
+	// Setting this to any value other than the default disables
+	// the fast-path unmarshaler.
+	WeakFields WeakFieldHandling
+
 	// Resolver is used for looking up types when unmarshaling extension fields.
 	// If nil, this defaults to using protoregistry.GlobalTypes.
 	Resolver interface {
@@ -44,6 +106,25 @@ type UnmarshalOptions struct {
 	}
 }
 
+// WeakFieldHandling specifies how a weak field is unmarshaled.
+// Weak fields are only supported with the protolegacy build tag;
+// otherwise they are always treated as unknown fields.
+type WeakFieldHandling uint8
+
+const (
+	// WeakFieldsDecode unmarshals a weak field if the message type it refers
+	// to is linked into the program, and treats it as an unknown field
+	// otherwise.
+	WeakFieldsDecode WeakFieldHandling = iota
+
+	// WeakFieldsUnknown treats every weak field as an unknown field.
+	WeakFieldsUnknown
+
+	// WeakFieldsDiscard drops every weak field, even if unknown fields
+	// are otherwise retained.
+	WeakFieldsDiscard
+)
+
 // Unmarshal parses the wire-format message in b and places the result in m.
 func Unmarshal(b []byte, m Message) error {
 	_, err := UnmarshalOptions{}.unmarshal(b, m.ProtoReflect())
@@ -78,16 +159,21 @@ func (o UnmarshalOptions) unmarshal(b []byte, m protoreflect.Message) (out proto
 	o.Merge = true
 	o.AllowPartial = true
 	methods := protoMethods(m)
-	if methods != nil && methods.Unmarshal != nil &&
-		!(o.DiscardUnknown && methods.Flags&protoiface.SupportUnmarshalDiscardUnknown == 0) {
+	if o.Fields != nil {
+		err = o.unmarshalSelected(b, m)
+	} else if methods != nil && methods.Unmarshal != nil && o.supportedBy(methods) {
 		in := protoiface.UnmarshalInput{
-			Message:  m,
-			Buf:      b,
-			Resolver: o.Resolver,
+			Message:             m,
+			Buf:                 b,
+			Resolver:            o.Resolver,
+			UnknownFieldHandler: o.UnknownFieldHandler,
 		}
 		if o.DiscardUnknown {
 			in.Flags |= protoiface.UnmarshalDiscardUnknown
 		}
+		if o.RejectUnknown {
+			in.Flags |= protoiface.UnmarshalRejectUnknown
+		}
 		out, err = methods.Unmarshal(in)
 	} else {
 		err = o.unmarshalMessageSlow(b, m)
@@ -101,25 +187,119 @@ func (o UnmarshalOptions) unmarshal(b []byte, m protoreflect.Message) (out proto
 	return out, checkInitialized(m)
 }
 
+// supportedBy reports whether the fast-path methods implement the options.
+// The Fields option is never supported.
+func (o UnmarshalOptions) supportedBy(methods *protoiface.Methods) bool {
+	return o.Fields == nil &&
+		o.InvalidUTF8 == InvalidUTF8Reject && o.DuplicateFieldHandler == nil &&
+		o.WeakFields == WeakFieldsDecode &&
+		!(o.DiscardUnknown && methods.Flags&protoiface.SupportUnmarshalDiscardUnknown == 0) &&
+		!(o.RejectUnknown && methods.Flags&protoiface.SupportUnmarshalRejectUnknown == 0) &&
+		!(o.UnknownFieldHandler != nil && methods.Flags&protoiface.SupportUnmarshalUnknownFieldHandler == 0)
+}
+
+// unmarshalSelected unmarshals the records of b for the fields in o.Fields,
+// and handles the records for all other fields as unknown fields.
+func (o UnmarshalOptions) unmarshalSelected(b []byte, m protoreflect.Message) error {
+	selected := o.Fields
+	o.Fields = nil
+	md := m.Descriptor()
+	var seen map[protoreflect.FullName]bool
+	if o.DuplicateFieldHandler != nil {
+		// The records of a field may be split across several runs,
+		// so the fields already set are tracked for the whole message.
+		seen = make(map[protoreflect.FullName]bool)
+	}
+	start := len(b)
+	for len(b) > 0 {
+		// Unmarshal each run of consecutive selected records in a single call.
+		n := 0
+		for n < len(b) {
+			num, _, recLen := protowire.ConsumeField(b[n:])
+			if recLen < 0 || !isSelectedField(selected, num) {
+				break
+			}
+			n += recLen
+		}
+		if n > 0 {
+			var err error
+			if seen != nil {
+				// The fast path is not used with a DuplicateFieldHandler.
+				err = o.unmarshalFieldsSlow(b[:n], m, seen)
+			} else {
+				_, err = o.unmarshal(b[:n], m)
+			}
+			if err != nil {
+				return offsetUnmarshalError(err, start-len(b))
+			}
+			b = b[n:]
+			continue
+		}
+
+		num, wtyp, n := protowire.ConsumeField(b)
+		if n < 0 {
+			// Let the unmarshaler report the error for the malformed record.
+			_, err := o.unmarshal(b, m)
+			if err == nil {
+				err = protowire.ParseError(n)
+			}
+			return offsetUnmarshalError(err, start-len(b))
+		}
+		if o.retainUnknown(md, num, wtyp, b[:n]) {
+			m.SetUnknown(append(m.GetUnknown(), b[:n]...))
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func isSelectedField(selected []protoreflect.FieldNumber, num protowire.Number) bool {
+	for _, n := range selected {
+		if n == num {
+			return true
+		}
+	}
+	return false
+}
+
+// offsetUnmarshalError adjusts err, which occurred while parsing a suffix of
+// the input beginning at offset, to be relative to the start of the input.
+func offsetUnmarshalError(err error, offset int) error {
+	if e, ok := err.(*UnmarshalError); ok {
+		e.Offset += offset
+	}
+	return err
+}
+
 func (o UnmarshalOptions) unmarshalMessage(b []byte, m protoreflect.Message) error {
 	_, err := o.unmarshal(b, m)
 	return err
 }
 
 func (o UnmarshalOptions) unmarshalMessageSlow(b []byte, m protoreflect.Message) error {
+	return o.unmarshalFieldsSlow(b, m, nil)
+}
+
+// unmarshalFieldsSlow unmarshals the records of b into m. The seen map holds
+// the singular fields and oneofs already set by earlier records of m, and is
+// allocated as needed if nil.
+func (o UnmarshalOptions) unmarshalFieldsSlow(b []byte, m protoreflect.Message, seen map[protoreflect.FullName]bool) error {
 	md := m.Descriptor()
 	if messageset.IsMessageSet(md) {
 		return o.unmarshalMessageSet(b, m)
 	}
 	fields := md.Fields()
+	start := len(b)
 	for len(b) > 0 {
+		offset := start - len(b)
+
 		// Parse the tag (field number and wire type).
 		num, wtyp, tagLen := protowire.ConsumeTag(b)
 		if tagLen < 0 {
-			return protowire.ParseError(tagLen)
+			return protoerrors.Wrap(protowire.ParseError(tagLen), b, offset, num, wtyp)
 		}
 		if num > protowire.MaxValidNumber {
-			return errors.New("invalid field number")
+			return protoerrors.Wrap(errors.New("invalid field number"), b, offset, num, wtyp)
 		}
 
 		// Find the field descriptor for this field number.
@@ -127,17 +307,24 @@ func (o UnmarshalOptions) unmarshalMessageSlow(b []byte, m protoreflect.Message)
 		if fd == nil && md.ExtensionRanges().Has(num) {
 			extType, err := o.Resolver.FindExtensionByNumber(md.FullName(), num)
 			if err != nil && err != protoregistry.NotFound {
-				return errors.New("%v: unable to resolve extension %v: %v", md.FullName(), num, err)
+				err = errors.New("%v: unable to resolve extension %v: %v", md.FullName(), num, err)
+				return protoerrors.Wrap(err, b, offset, num, wtyp)
 			}
 			if extType != nil {
 				fd = extType.TypeDescriptor()
 			}
 		}
 		var err error
+		discard := false
 		if fd == nil {
 			err = errUnknown
-		} else if flags.ProtoLegacy {
-			if fd.IsWeak() && fd.Message().IsPlaceholder() {
+		} else if flags.ProtoLegacy && fd.IsWeak() {
+			switch {
+			case o.WeakFields == WeakFieldsDiscard:
+				err, discard = errUnknown, true
+			case o.WeakFields == WeakFieldsUnknown:
+				err = errUnknown
+			case fd.Message().IsPlaceholder():
 				err = errUnknown // weak referent is not linked in
 			}
 		}
@@ -155,16 +342,33 @@ func (o UnmarshalOptions) unmarshalMessageSlow(b []byte, m protoreflect.Message)
 		}
 		if err != nil {
 			if err != errUnknown {
-				return err
+				return protoerrors.Wrap(err, b, offset, num, wtyp)
+			}
+			if o.RejectUnknown && !discard {
+				return protoerrors.Wrap(protoerrors.UnknownField(md, fd, num, wtyp), b, offset, num, wtyp)
 			}
 			valLen = protowire.ConsumeFieldValue(num, wtyp, b[tagLen:])
 			if valLen < 0 {
-				return protowire.ParseError(valLen)
+				return protoerrors.Wrap(protowire.ParseError(valLen), b, offset, num, wtyp)
 			}
-			if !o.DiscardUnknown {
+			if !discard && o.retainUnknown(md, num, wtyp, b[:tagLen+valLen]) {
 				m.SetUnknown(append(m.GetUnknown(), b[:tagLen+valLen]...))
 			}
 		}
+		if err == nil && o.DuplicateFieldHandler != nil && !fd.IsList() && !fd.IsMap() {
+			name := fd.FullName()
+			if od := fd.ContainingOneof(); od != nil {
+				name = od.FullName()
+			}
+			if seen[name] {
+				o.DuplicateFieldHandler(fd)
+			} else {
+				if seen == nil {
+					seen = make(map[protoreflect.FullName]bool)
+				}
+				seen[name] = true
+			}
+		}
 		b = b[tagLen+valLen:]
 	}
 	return nil
@@ -210,13 +414,15 @@ func (o UnmarshalOptions) unmarshalMap(b []byte, wtyp protowire.Type, mapv proto
 	}
 	// Map entries are represented as a two-element message with fields
 	// containing the key and value.
+	entryLen := len(b)
 	for len(b) > 0 {
+		rec, offset := b, entryLen-len(b)
 		num, wtyp, n := protowire.ConsumeTag(b)
 		if n < 0 {
-			return 0, protowire.ParseError(n)
+			return 0, protoerrors.Wrap(protowire.ParseError(n), rec, offset, num, wtyp)
 		}
 		if num > protowire.MaxValidNumber {
-			return 0, errors.New("invalid field number")
+			return 0, protoerrors.Wrap(errors.New("invalid field number"), rec, offset, num, wtyp)
 		}
 		b = b[n:]
 		err = errUnknown
@@ -236,7 +442,7 @@ func (o UnmarshalOptions) unmarshalMap(b []byte, wtyp protowire.Type, mapv proto
 			switch valField.Kind() {
 			case protoreflect.GroupKind, protoreflect.MessageKind:
 				if err := o.unmarshalMessage(v.Bytes(), val.Message()); err != nil {
-					return 0, err
+					return 0, protoerrors.Wrap(err, rec, offset, num, wtyp)
 				}
 			default:
 				val = v
@@ -246,10 +452,10 @@ func (o UnmarshalOptions) unmarshalMap(b []byte, wtyp protowire.Type, mapv proto
 		if err == errUnknown {
 			n = protowire.ConsumeFieldValue(num, wtyp, b)
 			if n < 0 {
-				return 0, protowire.ParseError(n)
+				return 0, protoerrors.Wrap(protowire.ParseError(n), rec, offset, num, wtyp)
 			}
 		} else if err != nil {
-			return 0, err
+			return 0, protoerrors.Wrap(err, rec, offset, num, wtyp)
 		}
 		b = b[n:]
 	}
@@ -268,6 +474,24 @@ func (o UnmarshalOptions) unmarshalMap(b []byte, wtyp protowire.Type, mapv proto
 	return n, nil
 }
 
+// UnmarshalError is the error returned by Unmarshal when the input is not
+// a valid wire-format encoding of the message. Use errors.As to retrieve it.
+//
+// An UnmarshalError describes the innermost field record that could not be
+// parsed, and the path of field records leading to it from the top-level
+// message. Errors that are not associated with a particular field record,
+// such as missing required fields, are not reported as an UnmarshalError.
+type UnmarshalError = protoerrors.UnmarshalError
+
+// retainUnknown reports whether to store the unknown field b
+// in the unknown fields of a message with the descriptor md.
+func (o UnmarshalOptions) retainUnknown(md protoreflect.MessageDescriptor, num protowire.Number, wtyp protowire.Type, b []byte) bool {
+	if o.UnknownFieldHandler != nil {
+		return o.UnknownFieldHandler(md, num, wtyp, b)
+	}
+	return !o.DiscardUnknown
+}
+
 // errUnknown is used internally to indicate fields which should be added
 // to the unknown field set of a message. It is never returned from an exported
 // function.
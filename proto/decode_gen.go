@@ -11,7 +11,6 @@ import (
 	"unicode/utf8"
 
 	"google.golang.org/protobuf/encoding/protowire"
-	"google.golang.org/protobuf/internal/errors"
 	"google.golang.org/protobuf/internal/strs"
 	"google.golang.org/protobuf/reflect/protoreflect"
 )
@@ -156,7 +155,9 @@ func (o UnmarshalOptions) unmarshalScalar(b []byte, wtyp protowire.Type, fd prot
 			return val, 0, protowire.ParseError(n)
 		}
 		if strs.EnforceUTF8(fd) && !utf8.Valid(v) {
-			return protoreflect.Value{}, 0, errors.InvalidUTF8(string(fd.FullName()))
+			if v, err = o.invalidUTF8(fd, v); err != nil {
+				return protoreflect.Value{}, 0, err
+			}
 		}
 		return protoreflect.ValueOfString(string(v)), n, nil
 	case protoreflect.BytesKind:
@@ -552,7 +553,9 @@ func (o UnmarshalOptions) unmarshalList(b []byte, wtyp protowire.Type, list prot
 			return 0, protowire.ParseError(n)
 		}
 		if strs.EnforceUTF8(fd) && !utf8.Valid(v) {
-			return 0, errors.InvalidUTF8(string(fd.FullName()))
+			if v, err = o.invalidUTF8(fd, v); err != nil {
+				return 0, err
+			}
 		}
 		list.Append(protoreflect.ValueOfString(string(v)))
 		return n, nil
@@ -10,10 +10,15 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+
 	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/testing/protopack"
+	"google.golang.org/protobuf/types/dynamicpb"
 
 	testpb "google.golang.org/protobuf/internal/testprotos/test"
 	test3pb "google.golang.org/protobuf/internal/testprotos/test3"
@@ -132,6 +137,191 @@ func TestDecodeEmptyBytes(t *testing.T) {
 	}
 }
 
+func TestDecodeErrorDetails(t *testing.T) {
+	for _, test := range []struct {
+		desc     string
+		m        proto.Message
+		wire     []byte
+		offset   int
+		path     []protowire.Number
+		wireType protowire.Type
+	}{{
+		desc: "truncated varint",
+		m:    &testpb.TestAllTypes{},
+		wire: protopack.Message{
+			protopack.Tag{1, protopack.VarintType}, protopack.Raw{0x80},
+		}.Marshal(),
+		offset:   0,
+		path:     []protowire.Number{1},
+		wireType: protowire.VarintType,
+	}, {
+		desc: "after valid field",
+		m:    &testpb.TestAllTypes{},
+		wire: protopack.Message{
+			protopack.Tag{2, protopack.VarintType}, protopack.Varint(1),
+			protopack.Tag{1, protopack.VarintType}, protopack.Raw{0x80},
+		}.Marshal(),
+		offset:   2,
+		path:     []protowire.Number{1},
+		wireType: protowire.VarintType,
+	}, {
+		desc: "invalid field number",
+		m:    &testpb.TestAllTypes{},
+		wire: protopack.Message{
+			protopack.Tag{2, protopack.VarintType}, protopack.Varint(1),
+			protopack.Tag{0, protopack.VarintType}, protopack.Varint(1),
+		}.Marshal(),
+		offset:   2,
+		path:     []protowire.Number{0},
+		wireType: protowire.VarintType,
+	}, {
+		desc: "nested message",
+		m:    &testpb.TestAllTypes{},
+		wire: protopack.Message{
+			protopack.Tag{1, protopack.VarintType}, protopack.Varint(1),
+			protopack.Tag{18, protopack.BytesType}, protopack.LengthPrefix(protopack.Message{
+				protopack.Tag{1, protopack.VarintType}, protopack.Varint(1),
+				protopack.Tag{2, protopack.BytesType}, protopack.Bytes{0x08},
+			}),
+		}.Marshal(),
+		// 2 bytes for field 1, 2+1 bytes for field 18's tag and length,
+		// 2 bytes for field 18.1, 1+1 bytes for field 18.2's tag and length.
+		offset:   9,
+		path:     []protowire.Number{18, 2, 1},
+		wireType: protowire.VarintType,
+	}, {
+		desc: "group",
+		m:    &testpb.TestAllTypes{},
+		wire: protopack.Message{
+			protopack.Tag{16, protopack.StartGroupType},
+			protopack.Tag{1000, protopack.BytesType}, protopack.LengthPrefix(protopack.Message{
+				protopack.Tag{1, protopack.VarintType}, protopack.Raw{0x80},
+			}),
+			protopack.Tag{16, protopack.EndGroupType},
+		}.Marshal(),
+		// 2 bytes for field 16's tag, 2+1 bytes for field 16.1000's tag and length.
+		offset:   5,
+		path:     []protowire.Number{16, 1000, 1},
+		wireType: protowire.VarintType,
+	}, {
+		desc: "map value",
+		m:    &testpb.TestAllTypes{},
+		wire: protopack.Message{
+			protopack.Tag{71, protopack.BytesType}, protopack.LengthPrefix(protopack.Message{
+				protopack.Tag{1, protopack.BytesType}, protopack.String("k"),
+				protopack.Tag{2, protopack.BytesType}, protopack.LengthPrefix(protopack.Message{
+					protopack.Tag{1, protopack.VarintType}, protopack.Raw{0x80},
+				}),
+			}),
+		}.Marshal(),
+		// 2+1 bytes for field 71's tag and length, 3 bytes for the key,
+		// 1+1 bytes for the value's tag and length.
+		offset:   8,
+		path:     []protowire.Number{71, 2, 1},
+		wireType: protowire.VarintType,
+	}, {
+		desc: "invalid UTF-8",
+		m:    &test3pb.TestAllTypes{},
+		wire: protopack.Message{
+			protopack.Tag{81, protopack.VarintType}, protopack.Varint(1),
+			protopack.Tag{94, protopack.BytesType}, protopack.String("\xff"),
+		}.Marshal(),
+		offset:   3,
+		path:     []protowire.Number{94},
+		wireType: protowire.BytesType,
+	}} {
+		for _, m := range []proto.Message{test.m, dynamicpb.NewMessage(test.m.ProtoReflect().Descriptor())} {
+			t.Run(fmt.Sprintf("%s (%T)", test.desc, m), func(t *testing.T) {
+				err := proto.Unmarshal(test.wire, m)
+				uerr, ok := err.(*proto.UnmarshalError)
+				if !ok {
+					t.Fatalf("Unmarshal error = %v (%T), want *proto.UnmarshalError", err, err)
+				}
+				if uerr.Offset != test.offset {
+					t.Errorf("Offset = %v, want %v", uerr.Offset, test.offset)
+				}
+				if !reflect.DeepEqual(uerr.Path, test.path) {
+					t.Errorf("Path = %v, want %v", uerr.Path, test.path)
+				}
+				if uerr.WireType != test.wireType {
+					t.Errorf("WireType = %v, want %v", uerr.WireType, test.wireType)
+				}
+				if uerr.Err == nil {
+					t.Errorf("Err = nil, want non-nil")
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeRejectUnknown(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		m       proto.Message
+		wire    []byte
+		wantErr bool
+	}{{
+		desc: "known fields",
+		m:    &testpb.TestAllTypes{},
+		wire: protopack.Message{
+			protopack.Tag{1, protopack.VarintType}, protopack.Varint(1),
+			protopack.Tag{18, protopack.BytesType}, protopack.LengthPrefix(protopack.Message{
+				protopack.Tag{1, protopack.VarintType}, protopack.Varint(1),
+			}),
+		}.Marshal(),
+	}, {
+		desc: "unknown field number",
+		m:    &testpb.TestAllTypes{},
+		wire: protopack.Message{
+			protopack.Tag{1, protopack.VarintType}, protopack.Varint(1),
+			protopack.Tag{100000, protopack.VarintType}, protopack.Varint(1),
+		}.Marshal(),
+		wantErr: true,
+	}, {
+		desc: "unexpected wire type",
+		m:    &testpb.TestAllTypes{},
+		wire: protopack.Message{
+			protopack.Tag{1, protopack.Fixed32Type}, protopack.Uint32(1),
+		}.Marshal(),
+		wantErr: true,
+	}, {
+		desc: "nested unknown field",
+		m:    &testpb.TestAllTypes{},
+		wire: protopack.Message{
+			protopack.Tag{18, protopack.BytesType}, protopack.LengthPrefix(protopack.Message{
+				protopack.Tag{100000, protopack.VarintType}, protopack.Varint(1),
+			}),
+		}.Marshal(),
+		wantErr: true,
+	}, {
+		desc: "unresolvable extension",
+		m:    &testpb.TestAllExtensions{},
+		wire: protopack.Message{
+			protopack.Tag{1, protopack.VarintType}, protopack.Varint(1),
+		}.Marshal(),
+		wantErr: true,
+	}} {
+		for _, m := range []proto.Message{test.m, dynamicpb.NewMessage(test.m.ProtoReflect().Descriptor())} {
+			t.Run(fmt.Sprintf("%s (%T)", test.desc, m), func(t *testing.T) {
+				opts := proto.UnmarshalOptions{
+					RejectUnknown: true,
+					Resolver:      new(protoregistry.Types),
+				}
+				err := opts.Unmarshal(test.wire, m)
+				if gotErr := err != nil; gotErr != test.wantErr {
+					t.Errorf("Unmarshal error = %v, want error %v", err, test.wantErr)
+				}
+				if err := (proto.UnmarshalOptions{RejectUnknown: true, DiscardUnknown: true, Resolver: opts.Resolver}).Unmarshal(test.wire, m); (err != nil) != test.wantErr {
+					t.Errorf("Unmarshal with DiscardUnknown error = %v, want error %v", err, test.wantErr)
+				}
+				if err := opts.Validate(test.wire, m); (err != nil) != test.wantErr {
+					t.Errorf("Validate error = %v, want error %v", err, test.wantErr)
+				}
+			})
+		}
+	}
+}
+
 func build(m proto.Message, opts ...buildOpt) proto.Message {
 	for _, opt := range opts {
 		opt(m)
@@ -152,3 +342,272 @@ func extend(desc protoreflect.ExtensionType, value interface{}) buildOpt {
 		proto.SetExtension(m, desc, value)
 	}
 }
+
+func TestDecodeUnknownFieldHandler(t *testing.T) {
+	wire := protopack.Message{
+		protopack.Tag{1, protopack.VarintType}, protopack.Varint(1),
+		protopack.Tag{1, protopack.Fixed32Type}, protopack.Uint32(2),
+		protopack.Tag{18, protopack.BytesType}, protopack.LengthPrefix(protopack.Message{
+			protopack.Tag{1, protopack.VarintType}, protopack.Varint(3),
+			protopack.Tag{100000, protopack.VarintType}, protopack.Varint(4),
+		}),
+		protopack.Tag{200000, protopack.BytesType}, protopack.String("five"),
+	}.Marshal()
+
+	type call struct {
+		Message protoreflect.FullName
+		Num     protowire.Number
+		Type    protowire.Type
+		Field   []byte
+	}
+	wantCalls := []call{{
+		Message: "goproto.proto.test.TestAllTypes",
+		Num:     1,
+		Type:    protowire.Fixed32Type,
+		Field:   protopack.Message{protopack.Tag{1, protopack.Fixed32Type}, protopack.Uint32(2)}.Marshal(),
+	}, {
+		Message: "goproto.proto.test.TestAllTypes.NestedMessage",
+		Num:     100000,
+		Type:    protowire.VarintType,
+		Field:   protopack.Message{protopack.Tag{100000, protopack.VarintType}, protopack.Varint(4)}.Marshal(),
+	}, {
+		Message: "goproto.proto.test.TestAllTypes",
+		Num:     200000,
+		Type:    protowire.BytesType,
+		Field:   protopack.Message{protopack.Tag{200000, protopack.BytesType}, protopack.String("five")}.Marshal(),
+	}}
+	want := &testpb.TestAllTypes{
+		OptionalInt32:         proto.Int32(1),
+		OptionalNestedMessage: &testpb.TestAllTypes_NestedMessage{A: proto.Int32(3)},
+	}
+	want.ProtoReflect().SetUnknown(wantCalls[2].Field)
+
+	for _, m := range []proto.Message{&testpb.TestAllTypes{}, dynamicpb.NewMessage(want.ProtoReflect().Descriptor())} {
+		t.Run(fmt.Sprintf("%T", m), func(t *testing.T) {
+			var calls []call
+			opts := proto.UnmarshalOptions{
+				DiscardUnknown: true, // ignored in favor of the handler
+				UnknownFieldHandler: func(md protoreflect.MessageDescriptor, num protowire.Number, typ protowire.Type, b []byte) bool {
+					calls = append(calls, call{md.FullName(), num, typ, append([]byte(nil), b...)})
+					return num == 200000
+				},
+			}
+			if err := opts.Unmarshal(wire, m); err != nil {
+				t.Fatalf("Unmarshal error: %v", err)
+			}
+			if diff := cmp.Diff(wantCalls, calls); diff != "" {
+				t.Errorf("UnknownFieldHandler calls mismatch (-want +got):\n%v", diff)
+			}
+			if !proto.Equal(m, want) {
+				t.Errorf("Unmarshal result mismatch:\ngot:  %v\nwant: %v", prototext.Format(m), prototext.Format(want))
+			}
+
+			calls = nil
+			if err := opts.Validate(wire, m); err != nil {
+				t.Errorf("Validate error: %v", err)
+			}
+			if len(calls) > 0 {
+				t.Errorf("UnknownFieldHandler called %v times during Validate, want 0", len(calls))
+			}
+		})
+	}
+}
+
+func TestDecodeFields(t *testing.T) {
+	wire := protopack.Message{
+		protopack.Tag{1, protopack.VarintType}, protopack.Varint(1),
+		protopack.Tag{14, protopack.BytesType}, protopack.String("two"),
+		protopack.Tag{18, protopack.BytesType}, protopack.LengthPrefix(protopack.Message{
+			protopack.Tag{1, protopack.VarintType}, protopack.Varint(3),
+		}),
+		protopack.Tag{31, protopack.VarintType}, protopack.Varint(4),
+		protopack.Tag{1, protopack.VarintType}, protopack.Varint(5),
+	}.Marshal()
+	skipped := protopack.Message{
+		protopack.Tag{14, protopack.BytesType}, protopack.String("two"),
+		protopack.Tag{31, protopack.VarintType}, protopack.Varint(4),
+	}.Marshal()
+
+	want := &testpb.TestAllTypes{
+		OptionalInt32:         proto.Int32(5),
+		OptionalNestedMessage: &testpb.TestAllTypes_NestedMessage{A: proto.Int32(3)},
+	}
+	for _, m := range []proto.Message{&testpb.TestAllTypes{}, dynamicpb.NewMessage(want.ProtoReflect().Descriptor())} {
+		t.Run(fmt.Sprintf("%T", m), func(t *testing.T) {
+			opts := proto.UnmarshalOptions{
+				Fields: []protoreflect.FieldNumber{1, 18},
+			}
+			if err := opts.Unmarshal(wire, m); err != nil {
+				t.Fatalf("Unmarshal error: %v", err)
+			}
+			want := proto.Clone(want)
+			want.ProtoReflect().SetUnknown(skipped)
+			if !proto.Equal(m, want) {
+				t.Errorf("Unmarshal result mismatch:\ngot:  %v\nwant: %v", prototext.Format(m), prototext.Format(want))
+			}
+
+			opts.DiscardUnknown = true
+			if err := opts.Unmarshal(wire, m); err != nil {
+				t.Fatalf("Unmarshal error: %v", err)
+			}
+			want.ProtoReflect().SetUnknown(nil)
+			if !proto.Equal(m, want) {
+				t.Errorf("Unmarshal with DiscardUnknown result mismatch:\ngot:  %v\nwant: %v", prototext.Format(m), prototext.Format(want))
+			}
+		})
+	}
+
+	// Errors in selected fields are reported relative to the start of the input.
+	bad := append(protopack.Message{
+		protopack.Tag{14, protopack.BytesType}, protopack.String("skipped"),
+	}.Marshal(), protopack.Message{
+		protopack.Tag{18, protopack.BytesType}, protopack.LengthPrefix(protopack.Message{
+			protopack.Tag{1, protopack.VarintType}, protopack.Raw{0xff},
+		}),
+	}.Marshal()...)
+	err := proto.UnmarshalOptions{Fields: []protoreflect.FieldNumber{18}}.Unmarshal(bad, &testpb.TestAllTypes{})
+	uerr, ok := err.(*proto.UnmarshalError)
+	if !ok {
+		t.Fatalf("Unmarshal error = %v, want UnmarshalError", err)
+	}
+	if got, want := uerr.Offset, len(bad)-2; got != want {
+		t.Errorf("UnmarshalError.Offset = %v, want %v", got, want)
+	}
+}
+
+func TestDecodeFieldsDuplicateFieldHandler(t *testing.T) {
+	// The unselected records split the records of optional_int32
+	// into separate runs.
+	wire := protopack.Message{
+		protopack.Tag{1, protopack.VarintType}, protopack.Varint(1),
+		protopack.Tag{31, protopack.VarintType}, protopack.Varint(2),
+		protopack.Tag{31, protopack.VarintType}, protopack.Varint(3),
+		protopack.Tag{18, protopack.BytesType}, protopack.LengthPrefix(protopack.Message{
+			protopack.Tag{1, protopack.VarintType}, protopack.Varint(4),
+			protopack.Tag{1, protopack.VarintType}, protopack.Varint(5),
+		}),
+		protopack.Tag{111, protopack.VarintType}, protopack.Varint(6),
+		protopack.Tag{14, protopack.BytesType}, protopack.String("seven"),
+		protopack.Tag{1, protopack.VarintType}, protopack.Varint(8),
+		protopack.Tag{113, protopack.BytesType}, protopack.String("nine"),
+	}.Marshal()
+	want := []protoreflect.FullName{
+		"goproto.proto.test.TestAllTypes.NestedMessage.a",
+		"goproto.proto.test.TestAllTypes.optional_int32",
+		"goproto.proto.test.TestAllTypes.oneof_string",
+	}
+
+	for _, m := range []proto.Message{&testpb.TestAllTypes{}, dynamicpb.NewMessage((&testpb.TestAllTypes{}).ProtoReflect().Descriptor())} {
+		t.Run(fmt.Sprintf("%T", m), func(t *testing.T) {
+			var got []protoreflect.FullName
+			err := proto.UnmarshalOptions{
+				Fields: []protoreflect.FieldNumber{1, 18, 111, 113},
+				DuplicateFieldHandler: func(fd protoreflect.FieldDescriptor) {
+					got = append(got, fd.FullName())
+				},
+			}.Unmarshal(wire, m)
+			if err != nil {
+				t.Fatalf("Unmarshal error: %v", err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("DuplicateFieldHandler calls mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestDecodeInvalidUTF8Handling(t *testing.T) {
+	wire := protopack.Message{
+		protopack.Tag{94, protopack.BytesType}, protopack.Bytes("a\xffb"),
+		protopack.Tag{44, protopack.BytesType}, protopack.Bytes("\xc0"),
+		protopack.Tag{69, protopack.BytesType}, protopack.LengthPrefix(protopack.Message{
+			protopack.Tag{1, protopack.BytesType}, protopack.Bytes("k\xfe"),
+			protopack.Tag{2, protopack.BytesType}, protopack.Bytes("v"),
+		}),
+	}.Marshal()
+
+	tests := []struct {
+		handling proto.InvalidUTF8Handling
+		want     *test3pb.TestAllTypes
+	}{{
+		handling: proto.InvalidUTF8Replace,
+		want: &test3pb.TestAllTypes{
+			SingularString:  "a�b",
+			RepeatedString:  []string{"�"},
+			MapStringString: map[string]string{"k�": "v"},
+		},
+	}, {
+		handling: proto.InvalidUTF8Accept,
+		want: &test3pb.TestAllTypes{
+			SingularString:  "a\xffb",
+			RepeatedString:  []string{"\xc0"},
+			MapStringString: map[string]string{"k\xfe": "v"},
+		},
+	}}
+	for _, test := range tests {
+		var invalid []protoreflect.FullName
+		got := &test3pb.TestAllTypes{}
+		err := proto.UnmarshalOptions{
+			InvalidUTF8: test.handling,
+			InvalidUTF8Handler: func(fd protoreflect.FieldDescriptor) {
+				invalid = append(invalid, fd.FullName())
+			},
+		}.Unmarshal(wire, got)
+		if err != nil {
+			t.Errorf("Unmarshal with InvalidUTF8 = %v: %v", test.handling, err)
+			continue
+		}
+		if !proto.Equal(got, test.want) {
+			t.Errorf("Unmarshal with InvalidUTF8 = %v mismatch:\ngot:  %v\nwant: %v", test.handling, prototext.Format(got), prototext.Format(test.want))
+		}
+		wantInvalid := []protoreflect.FullName{
+			"goproto.proto.test3.TestAllTypes.singular_string",
+			"goproto.proto.test3.TestAllTypes.repeated_string",
+			"goproto.proto.test3.TestAllTypes.MapStringStringEntry.key",
+		}
+		if diff := cmp.Diff(wantInvalid, invalid); diff != "" {
+			t.Errorf("InvalidUTF8Handler calls mismatch (-want +got):\n%v", diff)
+		}
+	}
+
+	if err := proto.Unmarshal(wire, &test3pb.TestAllTypes{}); err == nil {
+		t.Errorf("Unmarshal with default InvalidUTF8 = nil, want error")
+	}
+}
+
+func TestDecodeDuplicateFieldHandler(t *testing.T) {
+	wire := protopack.Message{
+		protopack.Tag{1, protopack.VarintType}, protopack.Varint(1),
+		protopack.Tag{31, protopack.VarintType}, protopack.Varint(2),
+		protopack.Tag{31, protopack.VarintType}, protopack.Varint(3),
+		protopack.Tag{18, protopack.BytesType}, protopack.LengthPrefix(protopack.Message{
+			protopack.Tag{1, protopack.VarintType}, protopack.Varint(4),
+			protopack.Tag{1, protopack.VarintType}, protopack.Varint(5),
+		}),
+		protopack.Tag{111, protopack.VarintType}, protopack.Varint(6),
+		protopack.Tag{1, protopack.VarintType}, protopack.Varint(7),
+		protopack.Tag{113, protopack.BytesType}, protopack.String("eight"),
+	}.Marshal()
+	want := []protoreflect.FullName{
+		"goproto.proto.test.TestAllTypes.NestedMessage.a",
+		"goproto.proto.test.TestAllTypes.optional_int32",
+		"goproto.proto.test.TestAllTypes.oneof_string",
+	}
+
+	for _, m := range []proto.Message{&testpb.TestAllTypes{}, dynamicpb.NewMessage((&testpb.TestAllTypes{}).ProtoReflect().Descriptor())} {
+		t.Run(fmt.Sprintf("%T", m), func(t *testing.T) {
+			var got []protoreflect.FullName
+			err := proto.UnmarshalOptions{
+				DuplicateFieldHandler: func(fd protoreflect.FieldDescriptor) {
+					got = append(got, fd.FullName())
+				},
+			}.Unmarshal(wire, m)
+			if err != nil {
+				t.Fatalf("Unmarshal error: %v", err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("DuplicateFieldHandler calls mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
@@ -5,10 +5,13 @@
 package proto
 
 import (
+	"encoding/binary"
+	"math"
 	"sort"
 
 	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/internal/encoding/messageset"
+	"google.golang.org/protobuf/internal/errors"
 	"google.golang.org/protobuf/internal/fieldsort"
 	"google.golang.org/protobuf/internal/mapsort"
 	"google.golang.org/protobuf/internal/pragma"
@@ -51,6 +54,35 @@ type MarshalOptions struct {
 	// detail and subject to change.
 	Deterministic bool
 
+	// Canonical controls whether the message is serialized in a canonical form
+	// that is stable across releases of this module.
+	//
+	// Setting this option implies Deterministic and additionally guarantees
+	// the following properties of the output, which are covered by tests
+	// that lock down the exact bytes produced:
+	//
+	// 1. Known fields and extension fields are emitted together in
+	// ascending field number order.
+	//
+	// 2. Repeated scalar fields are packed if and only if the field
+	// descriptor reports them as packed.
+	//
+	// 3. Map entries are emitted in ascending key order, where integer keys
+	// are compared numerically, boolean keys order false before true,
+	// and string keys are compared bytewise. Each entry contains
+	// the key followed by the value.
+	//
+	// 4. Unknown fields are emitted after all known fields, stably sorted by
+	// field number. Their contents are otherwise copied verbatim.
+	//
+	// 5. Every varint and length prefix uses its minimal encoding.
+	//
+	// Canonical serialization is still NOT canonical across languages,
+	// and messages that are equal but have different unknown fields
+	// encode differently. Fast-path marshal methods are bypassed,
+	// so canonical serialization is slower than the default.
+	Canonical bool
+
 	// UseCachedSize indicates that the result of a previous Size call
 	// may be reused.
 	//
@@ -70,8 +102,36 @@ type MarshalOptions struct {
 	// There is absolutely no guarantee that Size followed by Marshal with
 	// UseCachedSize set will perform equivalently to Marshal alone.
 	UseCachedSize bool
+
+	// Framing specifies a prefix that Marshal and MarshalAppend emit before
+	// the message, which delimits it from any data that follows
+	// (e.g., in a file containing a sequence of records).
+	// It only applies to the top-level message and is not included
+	// in the result of Size.
+	Framing Framing
+
+	// InvalidUTF8 specifies how a string field that must contain valid UTF-8
+	// is handled if it does not. The default is to report an error.
+	// Setting this to any other value disables the fast-path marshaler.
+	InvalidUTF8 InvalidUTF8Handling
 }
 
+// Framing is a method of delimiting a marshaled message.
+type Framing uint8
+
+const (
+	// FramingNone emits the message without a prefix.
+	FramingNone Framing = iota
+
+	// FramingVarint prefixes the message with its length encoded as a varint,
+	// in the same way as the length of a length-delimited field.
+	FramingVarint
+
+	// FramingFixed32 prefixes the message with its length encoded as
+	// a little-endian 32-bit integer.
+	FramingFixed32
+)
+
 // Marshal returns the wire-format encoding of m.
 func Marshal(m Message) ([]byte, error) {
 	// Treat nil message interface as an empty message; nothing to output.
@@ -90,14 +150,14 @@ func Marshal(m Message) ([]byte, error) {
 func (o MarshalOptions) Marshal(m Message) ([]byte, error) {
 	// Treat nil message interface as an empty message; nothing to output.
 	if m == nil {
-		return nil, nil
+		return o.MarshalAppend(nil, m)
 	}
 
-	out, err := o.marshal(nil, m.ProtoReflect())
-	if len(out.Buf) == 0 && err == nil {
-		out.Buf = emptyBytesForMessage(m)
+	b, err := o.marshalFramed(nil, m.ProtoReflect())
+	if len(b) == 0 && err == nil {
+		b = emptyBytesForMessage(m)
 	}
-	return out.Buf, err
+	return b, err
 }
 
 // emptyBytesForMessage returns a nil buffer if and only if m is invalid,
@@ -117,15 +177,101 @@ func emptyBytesForMessage(m Message) []byte {
 // MarshalAppend appends the wire-format encoding of m to b,
 // returning the result.
 func (o MarshalOptions) MarshalAppend(b []byte, m Message) ([]byte, error) {
-	// Treat nil message interface as an empty message; nothing to append.
+	// Treat nil message interface as an empty message; nothing to append
+	// other than the framing.
 	if m == nil {
+		switch o.Framing {
+		case FramingVarint:
+			b = protowire.AppendVarint(b, 0)
+		case FramingFixed32:
+			b = protowire.AppendFixed32(b, 0)
+		}
 		return b, nil
 	}
 
-	out, err := o.marshal(b, m.ProtoReflect())
+	return o.marshalFramed(b, m.ProtoReflect())
+}
+
+// marshalFramed appends the framing prefix followed by the encoding of m.
+func (o MarshalOptions) marshalFramed(b []byte, m protoreflect.Message) ([]byte, error) {
+	switch o.Framing {
+	case FramingVarint:
+		// The message is marshaled with the size computed here,
+		// so that the size of each sub-message is only computed once.
+		b = protowire.AppendVarint(b, uint64(o.size(m)))
+		o.UseCachedSize = true
+	case FramingFixed32:
+		// Reserve space for the prefix and fill it in afterwards.
+		start := len(b)
+		out, err := o.marshal(protowire.AppendFixed32(b, 0), m)
+		if err != nil {
+			return out.Buf, err
+		}
+		n := len(out.Buf) - start - 4
+		if uint64(n) > math.MaxUint32 {
+			return out.Buf, errors.New("%v: message of size %d is too large for fixed32 framing", m.Descriptor().FullName(), n)
+		}
+		binary.LittleEndian.PutUint32(out.Buf[start:], uint32(n))
+		return out.Buf, nil
+	}
+	out, err := o.marshal(b, m)
 	return out.Buf, err
 }
 
+// MarshalAppendBatch appends the wire-format encoding of each message in ms
+// to b, each preceded by the prefix specified by o.Framing. A nil message is
+// treated as an empty message.
+// If o.Framing is FramingNone, the encodings are simply concatenated.
+//
+// The size of every message is computed up front, so that b is grown at most
+// once and each message is marshaled using its cached size.
+func (o MarshalOptions) MarshalAppendBatch(b []byte, ms []Message) ([]byte, error) {
+	sizes := make([]int, len(ms))
+	total := 0
+	for i, m := range ms {
+		if m == nil {
+			continue
+		}
+		sizes[i] = o.size(m.ProtoReflect())
+		total += sizes[i]
+	}
+	switch o.Framing {
+	case FramingVarint:
+		for _, size := range sizes {
+			total += protowire.SizeVarint(uint64(size))
+		}
+	case FramingFixed32:
+		total += 4 * len(ms)
+	}
+	if cap(b) < len(b)+total {
+		nb := make([]byte, len(b), growcap(cap(b), len(b)+total))
+		copy(nb, b)
+		b = nb
+	}
+
+	o.UseCachedSize = true
+	for i, m := range ms {
+		switch o.Framing {
+		case FramingVarint:
+			b = protowire.AppendVarint(b, uint64(sizes[i]))
+		case FramingFixed32:
+			if uint64(sizes[i]) > math.MaxUint32 {
+				return b, errors.New("%v: message of size %d is too large for fixed32 framing", m.ProtoReflect().Descriptor().FullName(), sizes[i])
+			}
+			b = protowire.AppendFixed32(b, uint32(sizes[i]))
+		}
+		if m == nil {
+			continue
+		}
+		out, err := o.marshal(b, m.ProtoReflect())
+		if err != nil {
+			return out.Buf, err
+		}
+		b = out.Buf
+	}
+	return b, nil
+}
+
 // MarshalState returns the wire-format encoding of a message.
 //
 // This method permits fine-grained control over the marshaler.
@@ -140,7 +286,11 @@ func (o MarshalOptions) MarshalState(in protoiface.MarshalInput) (protoiface.Mar
 func (o MarshalOptions) marshal(b []byte, m protoreflect.Message) (out protoiface.MarshalOutput, err error) {
 	allowPartial := o.AllowPartial
 	o.AllowPartial = true
-	if methods := protoMethods(m); methods != nil && methods.Marshal != nil &&
+	if o.Canonical {
+		o.Deterministic = true
+	}
+	if methods := protoMethods(m); methods != nil && methods.Marshal != nil && !o.Canonical &&
+		o.InvalidUTF8 == InvalidUTF8Reject &&
 		!(o.Deterministic && methods.Flags&protoiface.SupportMarshalDeterministic == 0) {
 		in := protoiface.MarshalInput{
 			Message: m,
@@ -225,10 +375,38 @@ func (o MarshalOptions) marshalMessageSlow(b []byte, m protoreflect.Message) ([]
 	if err != nil {
 		return b, err
 	}
+	if o.Canonical {
+		return appendSortedUnknown(b, m.GetUnknown())
+	}
 	b = append(b, m.GetUnknown()...)
 	return b, nil
 }
 
+// appendSortedUnknown appends the unknown fields in raw to b,
+// stably sorted by field number.
+func appendSortedUnknown(b []byte, raw protoreflect.RawFields) ([]byte, error) {
+	type field struct {
+		num protowire.Number
+		raw []byte
+	}
+	var fields []field
+	for len(raw) > 0 {
+		num, _, n := protowire.ConsumeField(raw)
+		if n < 0 {
+			return b, protowire.ParseError(n)
+		}
+		fields = append(fields, field{num, raw[:n]})
+		raw = raw[n:]
+	}
+	sort.SliceStable(fields, func(i, j int) bool {
+		return fields[i].num < fields[j].num
+	})
+	for _, f := range fields {
+		b = append(b, f.raw...)
+	}
+	return b, nil
+}
+
 // rangeFields visits fields in a defined order when deterministic serialization is enabled.
 func (o MarshalOptions) rangeFields(m protoreflect.Message, f func(protoreflect.FieldDescriptor, protoreflect.Value) bool) {
 	if !o.Deterministic {
@@ -240,9 +418,15 @@ func (o MarshalOptions) rangeFields(m protoreflect.Message, f func(protoreflect.
 		fds = append(fds, fd)
 		return true
 	})
-	sort.Slice(fds, func(a, b int) bool {
-		return fieldsort.Less(fds[a], fds[b])
-	})
+	if o.Canonical {
+		sort.Slice(fds, func(a, b int) bool {
+			return fds[a].Number() < fds[b].Number()
+		})
+	} else {
+		sort.Slice(fds, func(a, b int) bool {
+			return fieldsort.Less(fds[a], fds[b])
+		})
+	}
 	for _, fd := range fds {
 		if !f(fd, m.Get(fd)) {
 			break
@@ -68,10 +68,14 @@ func (o MarshalOptions) marshalSingular(b []byte, fd protoreflect.FieldDescripto
 	case protoreflect.DoubleKind:
 		b = protowire.AppendFixed64(b, math.Float64bits(v.Float()))
 	case protoreflect.StringKind:
-		if strs.EnforceUTF8(fd) && !utf8.ValidString(v.String()) {
-			return b, errors.InvalidUTF8(string(fd.FullName()))
+		s := v.String()
+		if strs.EnforceUTF8(fd) && !utf8.ValidString(s) {
+			var err error
+			if s, err = o.invalidUTF8(fd, s); err != nil {
+				return b, err
+			}
 		}
-		b = protowire.AppendString(b, v.String())
+		b = protowire.AppendString(b, s)
 	case protoreflect.BytesKind:
 		b = protowire.AppendBytes(b, v.Bytes())
 	case protoreflect.MessageKind:
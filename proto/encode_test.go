@@ -17,6 +17,8 @@ import (
 	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 	pref "google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/testing/protopack"
+	"google.golang.org/protobuf/types/dynamicpb"
 
 	orderpb "google.golang.org/protobuf/internal/testprotos/order"
 	testpb "google.golang.org/protobuf/internal/testprotos/test"
@@ -92,6 +94,33 @@ func TestEncodeDeterministic(t *testing.T) {
 	}
 }
 
+func TestEncodeDeterministicMapOrder(t *testing.T) {
+	// The fast-path and reflection-based marshalers sort map keys separately;
+	// check that they agree on the order for every kind of map key.
+	for _, m := range []*testpb.TestAllTypes{
+		{MapInt32Int32: map[int32]int32{math.MinInt32: 1, -1: 2, 0: 3, 1: 4, math.MaxInt32: 5}},
+		{MapSint64Sint64: map[int64]int64{math.MinInt64: 1, -1: 2, 0: 3, 1: 4, math.MaxInt64: 5}},
+		{MapUint64Uint64: map[uint64]uint64{0: 1, 1: 2, math.MaxInt64 + 1: 3, math.MaxUint64: 4}},
+		{MapBoolBool: map[bool]bool{true: true, false: false}},
+		{MapStringString: map[string]string{"": "a", "a": "b", "ab": "c", "b": "d", "\xff": "e"}},
+	} {
+		opts := proto.MarshalOptions{Deterministic: true}
+		got, err := opts.Marshal(m)
+		if err != nil {
+			t.Fatalf("Marshal error: %v", err)
+		}
+		dm := dynamicpb.NewMessage(m.ProtoReflect().Descriptor())
+		proto.Merge(dm, m)
+		want, err := opts.Marshal(dm)
+		if err != nil {
+			t.Fatalf("Marshal error: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("deterministic Marshal(%v) differs from reflection-based marshal:\ngot:  %x\nwant: %x", prototext.Format(m), got, want)
+		}
+	}
+}
+
 func TestEncodeRequiredFieldChecks(t *testing.T) {
 	for _, test := range testValidMessages {
 		if !test.partial {
@@ -122,6 +151,96 @@ func TestEncodeAppend(t *testing.T) {
 	}
 }
 
+func TestEncodeFraming(t *testing.T) {
+	for _, test := range testValidMessages {
+		for _, m := range test.decodeTo {
+			t.Run(fmt.Sprintf("%s (%T)", test.desc, m), func(t *testing.T) {
+				opts := proto.MarshalOptions{
+					AllowPartial:  test.partial,
+					Deterministic: true,
+				}
+				want, err := opts.Marshal(m)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				opts.Framing = proto.FramingVarint
+				got, err := opts.MarshalAppend([]byte("prefix"), m)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = bytes.TrimPrefix(got, []byte("prefix"))
+				v, n := protowire.ConsumeBytes(got)
+				if n != len(got) || !bytes.Equal(v, want) {
+					t.Errorf("varint framing: got %x, want %x", got, protowire.AppendBytes(nil, want))
+				}
+
+				opts.Framing = proto.FramingFixed32
+				got, err = opts.Marshal(m)
+				if err != nil {
+					t.Fatal(err)
+				}
+				size, n := protowire.ConsumeFixed32(got)
+				if n < 0 || int(size) != len(got)-n || !bytes.Equal(got[n:], want) {
+					t.Errorf("fixed32 framing: got %x, want %x", got, append(protowire.AppendFixed32(nil, uint32(len(want))), want...))
+				}
+
+				if got, want := opts.Size(m), len(want); got != want {
+					t.Errorf("Size with framing = %v, want %v", got, want)
+				}
+			})
+		}
+	}
+
+	for _, test := range []struct {
+		framing proto.Framing
+		want    []byte
+	}{
+		{proto.FramingNone, nil},
+		{proto.FramingVarint, []byte{0}},
+		{proto.FramingFixed32, []byte{0, 0, 0, 0}},
+	} {
+		got, err := proto.MarshalOptions{Framing: test.framing}.Marshal(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("Marshal(nil) with framing %v = %x, want %x", test.framing, got, test.want)
+		}
+	}
+}
+
+func TestEncodeBatch(t *testing.T) {
+	var ms []proto.Message
+	for _, test := range testValidMessages {
+		if !test.partial {
+			ms = append(ms, test.decodeTo...)
+		}
+	}
+	ms = append(ms, nil)
+	for _, framing := range []proto.Framing{proto.FramingNone, proto.FramingVarint, proto.FramingFixed32} {
+		opts := proto.MarshalOptions{
+			Deterministic: true,
+			Framing:       framing,
+		}
+		want := []byte("prefix")
+		for _, m := range ms {
+			var err error
+			want, err = opts.MarshalAppend(want, m)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := opts.MarshalAppendBatch([]byte("prefix"), ms)
+		if err != nil {
+			t.Fatalf("MarshalAppendBatch with framing %v: %v", framing, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("MarshalAppendBatch with framing %v:\ngot:  %x\nwant: %x", framing, got, want)
+		}
+	}
+}
+
 func TestEncodeInvalidMessages(t *testing.T) {
 	for _, test := range testInvalidMessages {
 		for _, m := range test.decodeTo {
@@ -224,6 +343,102 @@ func TestEncodeOrder(t *testing.T) {
 	}
 }
 
+func TestEncodeCanonical(t *testing.T) {
+	// The canonical output is part of the API contract.
+	// Changes to the expected bytes in this test are breaking changes.
+	m := &orderpb.Message{
+		Field_1:  proto.String("one"),
+		Field_2:  proto.String("two"),
+		Field_20: proto.String("twenty"),
+		Oneof_1:  &orderpb.Message_Field_10{"ten"},
+	}
+	proto.SetExtension(m, orderpb.E_Field_32, "thirty-two")
+	proto.SetExtension(m, orderpb.E_Field_30, "thirty")
+	m.ProtoReflect().SetUnknown(protopack.Message{
+		protopack.Tag{50, protopack.VarintType}, protopack.Varint(2),
+		protopack.Tag{45, protopack.VarintType}, protopack.Varint(1),
+		protopack.Tag{50, protopack.VarintType}, protopack.Varint(3),
+	}.Marshal())
+	m3 := &test3pb.TestAllTypes{
+		SingularInt32:  -1,
+		SingularString: "x",
+		RepeatedInt32:  []int32{1, 300},
+		MapInt32Int32:  map[int32]int32{3: 30, -1: 10, 2: 20},
+		MapStringString: map[string]string{
+			"b": "2",
+			"a": "1",
+		},
+		SingularNestedMessage: &test3pb.TestAllTypes_NestedMessage{A: 1},
+		OneofField:            &test3pb.TestAllTypes_OneofUint32{5},
+	}
+
+	for _, test := range []struct {
+		desc string
+		m    proto.Message
+		want []byte
+	}{{
+		desc: "field order",
+		m:    m,
+		want: protopack.Message{
+			protopack.Tag{1, protopack.BytesType}, protopack.String("one"),
+			protopack.Tag{2, protopack.BytesType}, protopack.String("two"),
+			protopack.Tag{10, protopack.BytesType}, protopack.String("ten"),
+			protopack.Tag{20, protopack.BytesType}, protopack.String("twenty"),
+			protopack.Tag{30, protopack.BytesType}, protopack.String("thirty"),
+			protopack.Tag{32, protopack.BytesType}, protopack.String("thirty-two"),
+			protopack.Tag{45, protopack.VarintType}, protopack.Varint(1),
+			protopack.Tag{50, protopack.VarintType}, protopack.Varint(2),
+			protopack.Tag{50, protopack.VarintType}, protopack.Varint(3),
+		}.Marshal(),
+	}, {
+		desc: "packed and maps",
+		m:    m3,
+		want: protopack.Message{
+			protopack.Tag{31, protopack.BytesType}, protopack.LengthPrefix{
+				protopack.Varint(1), protopack.Varint(300),
+			},
+			protopack.Tag{56, protopack.BytesType}, protopack.LengthPrefix{
+				protopack.Tag{1, protopack.VarintType}, protopack.Varint(-1),
+				protopack.Tag{2, protopack.VarintType}, protopack.Varint(10),
+			},
+			protopack.Tag{56, protopack.BytesType}, protopack.LengthPrefix{
+				protopack.Tag{1, protopack.VarintType}, protopack.Varint(2),
+				protopack.Tag{2, protopack.VarintType}, protopack.Varint(20),
+			},
+			protopack.Tag{56, protopack.BytesType}, protopack.LengthPrefix{
+				protopack.Tag{1, protopack.VarintType}, protopack.Varint(3),
+				protopack.Tag{2, protopack.VarintType}, protopack.Varint(30),
+			},
+			protopack.Tag{69, protopack.BytesType}, protopack.LengthPrefix{
+				protopack.Tag{1, protopack.BytesType}, protopack.String("a"),
+				protopack.Tag{2, protopack.BytesType}, protopack.String("1"),
+			},
+			protopack.Tag{69, protopack.BytesType}, protopack.LengthPrefix{
+				protopack.Tag{1, protopack.BytesType}, protopack.String("b"),
+				protopack.Tag{2, protopack.BytesType}, protopack.String("2"),
+			},
+			protopack.Tag{81, protopack.VarintType}, protopack.Varint(-1),
+			protopack.Tag{94, protopack.BytesType}, protopack.String("x"),
+			protopack.Tag{98, protopack.BytesType}, protopack.LengthPrefix{
+				protopack.Tag{1, protopack.VarintType}, protopack.Varint(1),
+			},
+			protopack.Tag{111, protopack.VarintType}, protopack.Uvarint(5),
+		}.Marshal(),
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			for i := 0; i < 3; i++ {
+				got, err := proto.MarshalOptions{Canonical: true}.Marshal(test.m)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, test.want) {
+					t.Fatalf("canonical marshal mismatch:\ngot:  %x\nwant: %x", got, test.want)
+				}
+			}
+		})
+	}
+}
+
 func TestEncodeLarge(t *testing.T) {
 	// Encode/decode a message large enough to overflow a 32-bit size cache.
 	t.Skip("too slow and memory-hungry to run all the time")
@@ -272,3 +487,85 @@ func TestEncodeEmpty(t *testing.T) {
 		}
 	}
 }
+
+func TestSizeFields(t *testing.T) {
+	for _, test := range testValidMessages {
+		for _, m := range test.decodeTo {
+			t.Run(fmt.Sprintf("%s (%T)", test.desc, m), func(t *testing.T) {
+				total := 0
+				for _, n := range proto.SizeFields(m) {
+					total += n
+				}
+				if want := proto.Size(m); total != want {
+					t.Errorf("sum of SizeFields(m) = %v, want Size(m) = %v\nMessage:\n%v", total, want, prototext.Format(m))
+				}
+			})
+		}
+	}
+
+	m := &testpb.TestAllTypes{
+		OptionalInt32:         proto.Int32(1),
+		OptionalString:        proto.String("hello"),
+		OptionalNestedMessage: &testpb.TestAllTypes_NestedMessage{A: proto.Int32(1)},
+		RepeatedInt32:         []int32{1, 2, 3},
+		MapInt32Int32:         map[int32]int32{1: 2},
+	}
+	m.ProtoReflect().SetUnknown(protopack.Message{
+		protopack.Tag{10000, protopack.VarintType}, protopack.Varint(1),
+		protopack.Tag{10000, protopack.VarintType}, protopack.Varint(2),
+	}.Marshal())
+	want := map[pref.FieldNumber]int{
+		1:     1 + 1,       // tag + varint
+		14:    1 + 1 + 5,   // tag + length + string
+		18:    2 + 1 + 2,   // tag + length + message
+		31:    3 * (2 + 1), // 3 * (tag + varint)
+		56:    2 + 1 + 2*2, // tag + length + entry key and value
+		10000: 2 * (3 + 1), // 2 * (tag + varint)
+	}
+	if got := proto.SizeFields(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("SizeFields(m) = %v, want %v", got, want)
+	}
+}
+
+func TestEncodeInvalidUTF8Handling(t *testing.T) {
+	m := &test3pb.TestAllTypes{
+		SingularString:  "a\xffb",
+		RepeatedString:  []string{"\xc0"},
+		MapStringString: map[string]string{"k": "v\xfe"},
+	}
+	for _, test := range []struct {
+		handling proto.InvalidUTF8Handling
+		want     *test3pb.TestAllTypes
+	}{{
+		handling: proto.InvalidUTF8Replace,
+		want: &test3pb.TestAllTypes{
+			SingularString:  "a�b",
+			RepeatedString:  []string{"�"},
+			MapStringString: map[string]string{"k": "v�"},
+		},
+	}, {
+		handling: proto.InvalidUTF8Accept,
+		want:     m,
+	}} {
+		opts := proto.MarshalOptions{InvalidUTF8: test.handling}
+		b, err := opts.Marshal(m)
+		if err != nil {
+			t.Errorf("Marshal with InvalidUTF8 = %v: %v", test.handling, err)
+			continue
+		}
+		if got, want := opts.Size(m), len(b); got != want {
+			t.Errorf("Size with InvalidUTF8 = %v: got %v, want %v", test.handling, got, want)
+		}
+		got := &test3pb.TestAllTypes{}
+		if err := (proto.UnmarshalOptions{InvalidUTF8: proto.InvalidUTF8Accept}).Unmarshal(b, got); err != nil {
+			t.Fatal(err)
+		}
+		if !proto.Equal(got, test.want) {
+			t.Errorf("Marshal with InvalidUTF8 = %v mismatch:\ngot:  %v\nwant: %v", test.handling, prototext.Format(got), prototext.Format(test.want))
+		}
+	}
+
+	if _, err := proto.Marshal(m); err == nil {
+		t.Errorf("Marshal with default InvalidUTF8 = nil, want error")
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	"google.golang.org/protobuf/encoding/protowire"
 	pref "google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/runtime/protoiface"
 )
 
 // Equal reports whether two messages are equal.
@@ -46,6 +47,12 @@ func equalMessage(mx, my pref.Message) bool {
 	if mx.Descriptor() != my.Descriptor() {
 		return false
 	}
+	if methods := protoMethods(mx); methods != nil && methods.Equal != nil && methods == protoMethods(my) {
+		return methods.Equal(protoiface.EqualInput{
+			MessageA: mx,
+			MessageB: my,
+		}).Equal
+	}
 
 	nx := 0
 	equal := true
@@ -5,6 +5,9 @@
 package proto
 
 import (
+	"sort"
+
+	"google.golang.org/protobuf/internal/pragma"
 	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
@@ -18,7 +21,13 @@ func HasExtension(m Message, xt protoreflect.ExtensionType) bool {
 
 	// As a special-case, we reports invalid or mismatching descriptors
 	// as always not being populated (since they aren't).
-	if xt == nil || m.ProtoReflect().Descriptor() != xt.TypeDescriptor().ContainingMessage() {
+	// The descriptors are compared by name, since an extension type created
+	// from a descriptor set may extend a different descriptor of the message,
+	// such as that of a generated message.
+	if xt == nil {
+		return false
+	}
+	if md, xmd := m.ProtoReflect().Descriptor(), xt.TypeDescriptor().ContainingMessage(); md != xmd && md.FullName() != xmd.FullName() {
 		return false
 	}
 
@@ -90,3 +99,52 @@ func RangeExtensions(m Message, f func(protoreflect.ExtensionType, interface{})
 		return true
 	})
 }
+
+// RangeExtensionsOptions configures the extension iterator.
+//
+// Example usage:
+//   RangeExtensionsOptions{Deterministic: true}.RangeExtensions(m, f)
+type RangeExtensionsOptions struct {
+	pragma.NoUnkeyedLiterals
+
+	// Deterministic specifies that extension fields are visited
+	// in ascending order of field number.
+	Deterministic bool
+}
+
+// RangeExtensions iterates over every populated extension field in m,
+// calling f for each extension type and value encountered.
+// It returns immediately if f returns false.
+// While iterating, mutating operations may only be performed
+// on the current extension field.
+func (o RangeExtensionsOptions) RangeExtensions(m Message, f func(protoreflect.ExtensionType, interface{}) bool) {
+	if !o.Deterministic {
+		RangeExtensions(m, f)
+		return
+	}
+
+	// Treat nil message interface as an empty message; nothing to range over.
+	if m == nil {
+		return
+	}
+
+	type entry struct {
+		xt protoreflect.ExtensionType
+		v  protoreflect.Value
+	}
+	var entries []entry
+	m.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.IsExtension() {
+			entries = append(entries, entry{fd.(protoreflect.ExtensionTypeDescriptor).Type(), v})
+		}
+		return true
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].xt.TypeDescriptor().Number() < entries[j].xt.TypeDescriptor().Number()
+	})
+	for _, e := range entries {
+		if !f(e.xt, e.xt.InterfaceOf(e.v)) {
+			return
+		}
+	}
+}
@@ -7,6 +7,7 @@ package proto_test
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"sync"
 	"testing"
 
@@ -250,6 +251,29 @@ func TestExtensionRanger(t *testing.T) {
 		if diff := cmp.Diff(tt.want, got, protocmp.Transform()); diff != "" {
 			t.Errorf("proto.RangeExtensions mismatch (-want +got):\n%s", diff)
 		}
+
+		var nums []pref.FieldNumber
+		got = make(map[pref.ExtensionType]interface{})
+		proto.RangeExtensionsOptions{Deterministic: true}.RangeExtensions(tt.msg, func(xt pref.ExtensionType, v interface{}) bool {
+			nums = append(nums, xt.TypeDescriptor().Number())
+			got[xt] = v
+			return true
+		})
+		if diff := cmp.Diff(tt.want, got, protocmp.Transform()); diff != "" {
+			t.Errorf("deterministic proto.RangeExtensions mismatch (-want +got):\n%s", diff)
+		}
+		if !sort.SliceIsSorted(nums, func(i, j int) bool { return nums[i] < nums[j] }) {
+			t.Errorf("deterministic proto.RangeExtensions visited fields in order %v, want ascending order", nums)
+		}
+
+		var n int
+		proto.RangeExtensionsOptions{Deterministic: true}.RangeExtensions(tt.msg, func(pref.ExtensionType, interface{}) bool {
+			n++
+			return false
+		})
+		if n != 1 {
+			t.Errorf("deterministic proto.RangeExtensions called f %v times after returning false, want 1", n)
+		}
 	}
 }
 
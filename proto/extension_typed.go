@@ -0,0 +1,70 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package proto
+
+import (
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// TypedExtensionType is an extension type whose Go type is statically known.
+// The type parameter T is the type returned by GetExtension for xt
+// (e.g., int32 for an optional int32 field, []int32 for a repeated one,
+// and *M for a message field of type M).
+//
+// A TypedExtensionType is itself a protoreflect.ExtensionType and may be
+// used with the untyped extension functions.
+type TypedExtensionType[T any] struct {
+	protoreflect.ExtensionType
+}
+
+// NewTypedExtensionType wraps xt as a TypedExtensionType.
+// It panics if the Go type of the extension field is not T.
+func NewTypedExtensionType[T any](xt protoreflect.ExtensionType) TypedExtensionType[T] {
+	if _, ok := xt.InterfaceOf(xt.Zero()).(T); !ok {
+		panic(extensionTypeMismatch[T](xt))
+	}
+	return TypedExtensionType[T]{xt}
+}
+
+// Get retrieves the value for the extension field in m.
+// It has the same semantics as GetExtension.
+func (xt TypedExtensionType[T]) Get(m Message) T {
+	return GetExtension(m, xt.ExtensionType).(T)
+}
+
+// Set stores the value of the extension field in m.
+// It has the same semantics as SetExtension.
+func (xt TypedExtensionType[T]) Set(m Message, v T) {
+	SetExtension(m, xt.ExtensionType, v)
+}
+
+// GetExtensionTyped retrieves the value for an extension field as type T.
+// It has the same semantics as GetExtension, and additionally panics
+// if the Go type of the extension field is not T.
+func GetExtensionTyped[T any](m Message, xt protoreflect.ExtensionType) T {
+	v, ok := GetExtension(m, xt).(T)
+	if !ok {
+		panic(extensionTypeMismatch[T](xt))
+	}
+	return v
+}
+
+// SetExtensionTyped stores the value of an extension field.
+// It has the same semantics as SetExtension, except that the type of v
+// is checked at compile time against the type parameter.
+func SetExtensionTyped[T any](m Message, xt protoreflect.ExtensionType, v T) {
+	SetExtension(m, xt, v)
+}
+
+func extensionTypeMismatch[T any](xt protoreflect.ExtensionType) string {
+	return fmt.Sprintf("proto: extension %v has Go type %T, not %v",
+		xt.TypeDescriptor().FullName(), xt.InterfaceOf(xt.Zero()), reflect.TypeOf((*T)(nil)).Elem())
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package proto_test
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/runtime/protoimpl"
+
+	testpb "google.golang.org/protobuf/internal/testprotos/test"
+)
+
+func TestExtensionTyped(t *testing.T) {
+	m := &testpb.TestAllExtensions{}
+	if got := proto.GetExtensionTyped[int32](m, testpb.E_OptionalInt32); got != 0 {
+		t.Errorf("GetExtensionTyped(empty, optional_int32) = %v, want 0", got)
+	}
+	proto.SetExtensionTyped(m, testpb.E_OptionalInt32, int32(5))
+	if got := proto.GetExtensionTyped[int32](m, testpb.E_OptionalInt32); got != 5 {
+		t.Errorf("GetExtensionTyped(m, optional_int32) = %v, want 5", got)
+	}
+
+	repeated := protoimpl.TypedExtension[[]int32](testpb.E_RepeatedInt32)
+	repeated.Set(m, []int32{1, 2})
+	if got := repeated.Get(m); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("repeated_int32.Get(m) = %v, want [1 2]", got)
+	}
+	if !proto.HasExtension(m, repeated) {
+		t.Errorf("HasExtension(m, repeated_int32) = false, want true")
+	}
+
+	nested := proto.NewTypedExtensionType[*testpb.TestAllExtensions_NestedMessage](testpb.E_OptionalNestedMessage)
+	if got := nested.Get(m); got != nil {
+		t.Errorf("optional_nested_message.Get(empty) = %v, want nil", got)
+	}
+	nested.Set(m, &testpb.TestAllExtensions_NestedMessage{A: proto.Int32(1)})
+	if got := nested.Get(m).GetA(); got != 1 {
+		t.Errorf("optional_nested_message.Get(m).GetA() = %v, want 1", got)
+	}
+}
+
+func TestExtensionTypedMismatch(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		f    func()
+	}{{
+		desc: "NewTypedExtensionType",
+		f:    func() { proto.NewTypedExtensionType[int64](testpb.E_OptionalInt32) },
+	}, {
+		desc: "GetExtensionTyped",
+		f:    func() { proto.GetExtensionTyped[string](&testpb.TestAllExtensions{}, testpb.E_OptionalInt32) },
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%v with mismatching type did not panic", test.desc)
+				}
+			}()
+			test.f()
+		})
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"reflect"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// EstimateMemory returns an approximation of the number of bytes of memory
+// occupied by m and every value reachable from it. This includes the message
+// structs themselves, the backing arrays of repeated fields (by capacity
+// where it is known), the storage for map fields, and unknown fields.
+// It is distinct from Size, which reports the length of the wire encoding.
+//
+// The estimate is intended for capacity planning and is not exact.
+// It does not account for allocator overhead or for memory shared with
+// other messages, and memory referenced more than once from m is only
+// counted once.
+func EstimateMemory(m Message) int {
+	// Treat a nil message interface as an empty message; nothing allocated.
+	if m == nil {
+		return 0
+	}
+	e := memoryEstimator{seen: make(map[uintptr]bool)}
+	return e.message(m.ProtoReflect())
+}
+
+// Approximate sizes used for values whose memory layout is not visible.
+// The size of a pointer is declared by build-specific files.
+const (
+	stringHdrSize  = 2 * pointerSize
+	sliceHdrSize   = 3 * pointerSize
+	mapHeaderSize  = 6 * pointerSize
+	mapEntryExtra  = 2  // tophash byte and overflow pointer amortized per entry
+	mapLoadDivisor = 13 // Go maps are on average 6.5/8 full; 8/6.5 == 16/13
+)
+
+type memoryEstimator struct {
+	seen map[uintptr]bool
+}
+
+func (e *memoryEstimator) message(m protoreflect.Message) (size int) {
+	if !m.IsValid() {
+		return 0
+	}
+	rv := reflect.ValueOf(m.Interface())
+	if rv.Kind() == reflect.Ptr {
+		if e.seen[rv.Pointer()] {
+			return 0
+		}
+		e.seen[rv.Pointer()] = true
+		size += int(rv.Type().Elem().Size())
+	}
+
+	// Generated messages store known fields in exported Go struct fields,
+	// which make capacities visible. Other implementations (e.g., dynamicpb)
+	// are walked using protoreflect.
+	if rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Struct && hasExportedFields(rv.Elem().Type(), m.Descriptor()) {
+		size += e.value(rv.Elem())
+		m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+			if fd.IsExtension() {
+				size += e.extension(fd, v)
+			}
+			return true
+		})
+	} else {
+		m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+			if fd.IsExtension() {
+				size += e.extension(fd, v)
+			} else {
+				size += e.field(fd, v)
+			}
+			return true
+		})
+	}
+	size += cap(m.GetUnknown())
+	return size
+}
+
+func hasExportedFields(t reflect.Type, md protoreflect.MessageDescriptor) bool {
+	if md.Fields().Len() == 0 {
+		return true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// extension returns the memory occupied by the value of an extension field,
+// including its entry in the extension map of the message.
+func (e *memoryEstimator) extension(fd protoreflect.FieldDescriptor, v protoreflect.Value) int {
+	xt := fd.(protoreflect.ExtensionTypeDescriptor).Type()
+	return mapEntrySize(4, 2*pointerSize) + e.value(reflect.ValueOf(xt.InterfaceOf(v)))
+}
+
+// value returns the memory referenced by the Go value v,
+// excluding the memory occupied by v itself.
+func (e *memoryEstimator) value(v reflect.Value) (size int) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return 0
+		}
+		if m, ok := v.Interface().(Message); ok {
+			return e.message(m.ProtoReflect())
+		}
+		if e.seen[v.Pointer()] {
+			return 0
+		}
+		e.seen[v.Pointer()] = true
+		return int(v.Type().Elem().Size()) + e.value(v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		if v.Elem().Kind() != reflect.Ptr {
+			size += int(v.Elem().Type().Size())
+		}
+		return size + e.value(v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			return 0
+		}
+		size = v.Cap() * int(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			size += e.value(v.Index(i))
+		}
+		return size
+	case reflect.String:
+		return v.Len()
+	case reflect.Map:
+		if v.IsNil() {
+			return 0
+		}
+		size = mapHeaderSize + v.Len()*mapEntrySize(int(v.Type().Key().Size()), int(v.Type().Elem().Size()))
+		for _, k := range v.MapKeys() {
+			size += e.value(k) + e.value(v.MapIndex(k))
+		}
+		return size
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				size += e.value(v.Field(i))
+			}
+		}
+		return size
+	default:
+		return 0
+	}
+}
+
+// field returns the memory occupied by the value of a populated field,
+// as seen through protoreflect.
+func (e *memoryEstimator) field(fd protoreflect.FieldDescriptor, v protoreflect.Value) (size int) {
+	switch {
+	case fd.IsList():
+		list := v.List()
+		size = sliceHdrSize + list.Len()*kindSize(fd)
+		for i := 0; i < list.Len(); i++ {
+			size += e.singular(fd, list.Get(i))
+		}
+	case fd.IsMap():
+		mapv := v.Map()
+		size = mapHeaderSize + mapv.Len()*mapEntrySize(kindSize(fd.MapKey()), kindSize(fd.MapValue()))
+		mapv.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			size += e.singular(fd.MapKey(), k.Value()) + e.singular(fd.MapValue(), v)
+			return true
+		})
+	default:
+		size = kindSize(fd) + e.singular(fd, v)
+	}
+	return size
+}
+
+// singular returns the memory referenced by a singular value of field fd,
+// excluding the memory occupied by the value itself.
+func (e *memoryEstimator) singular(fd protoreflect.FieldDescriptor, v protoreflect.Value) int {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return len(v.String())
+	case protoreflect.BytesKind:
+		return cap(v.Bytes())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return e.message(v.Message())
+	default:
+		return 0
+	}
+}
+
+// kindSize returns the size of a singular value of field fd.
+func kindSize(fd protoreflect.FieldDescriptor) int {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return 1
+	case protoreflect.EnumKind, protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Uint32Kind,
+		protoreflect.Sfixed32Kind, protoreflect.Fixed32Kind, protoreflect.FloatKind:
+		return 4
+	case protoreflect.StringKind:
+		return stringHdrSize
+	case protoreflect.BytesKind:
+		return sliceHdrSize
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return pointerSize
+	default:
+		return 8
+	}
+}
+
+// mapEntrySize approximates the memory used per entry of a Go map
+// with the given key and value sizes.
+func mapEntrySize(keySize, valSize int) int {
+	return (keySize + valSize + mapEntryExtra) * 16 / mapLoadDivisor
+}
@@ -0,0 +1,12 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build purego appengine
+
+package proto
+
+import "strconv"
+
+// An int is as wide as a pointer on every platform that Go supports.
+const pointerSize = strconv.IntSize / 8
@@ -0,0 +1,84 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto_test
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	testpb "google.golang.org/protobuf/internal/testprotos/test"
+)
+
+func TestEstimateMemory(t *testing.T) {
+	if got := proto.EstimateMemory(nil); got != 0 {
+		t.Errorf("EstimateMemory(nil) = %v, want 0", got)
+	}
+	if got := proto.EstimateMemory((*testpb.TestAllTypes)(nil)); got != 0 {
+		t.Errorf("EstimateMemory(typed nil) = %v, want 0", got)
+	}
+
+	structSize := int(reflect.TypeOf(testpb.TestAllTypes{}).Size())
+	empty := proto.EstimateMemory(&testpb.TestAllTypes{})
+	if empty != structSize {
+		t.Errorf("EstimateMemory(empty) = %v, want struct size %v", empty, structSize)
+	}
+
+	for _, test := range []struct {
+		desc string
+		m    *testpb.TestAllTypes
+		min  int // minimum number of bytes in addition to the empty message
+	}{{
+		desc: "repeated capacity",
+		m:    &testpb.TestAllTypes{RepeatedInt64: make([]int64, 1, 100)},
+		min:  100 * 8,
+	}, {
+		desc: "string",
+		m:    &testpb.TestAllTypes{OptionalString: proto.String(string(make([]byte, 1000)))},
+		min:  1000,
+	}, {
+		desc: "map",
+		m:    &testpb.TestAllTypes{MapInt32Int32: map[int32]int32{1: 1, 2: 2, 3: 3}},
+		min:  3 * 8,
+	}, {
+		desc: "nested message",
+		m:    &testpb.TestAllTypes{OptionalNestedMessage: &testpb.TestAllTypes_NestedMessage{Corecursive: &testpb.TestAllTypes{}}},
+		min:  structSize,
+	}, {
+		desc: "oneof message",
+		m:    &testpb.TestAllTypes{OneofField: &testpb.TestAllTypes_OneofNestedMessage{&testpb.TestAllTypes_NestedMessage{Corecursive: &testpb.TestAllTypes{}}}},
+		min:  structSize,
+	}, {
+		desc: "unknown fields",
+		m: func() *testpb.TestAllTypes {
+			m := &testpb.TestAllTypes{}
+			m.ProtoReflect().SetUnknown(make([]byte, 0, 500))
+			return m
+		}(),
+		min: 500,
+	}} {
+		if got := proto.EstimateMemory(test.m) - empty; got < test.min {
+			t.Errorf("%v: EstimateMemory(m) - EstimateMemory(empty) = %v, want at least %v", test.desc, got, test.min)
+		}
+	}
+
+	// Memory shared within the message is only counted once.
+	nested := &testpb.TestAllTypes_NestedMessage{Corecursive: &testpb.TestAllTypes{RepeatedInt64: make([]int64, 100)}}
+	once := proto.EstimateMemory(&testpb.TestAllTypes{RepeatedNestedMessage: []*testpb.TestAllTypes_NestedMessage{nested}})
+	twice := proto.EstimateMemory(&testpb.TestAllTypes{RepeatedNestedMessage: []*testpb.TestAllTypes_NestedMessage{nested, nested}})
+	if twice-once >= 100*8 {
+		t.Errorf("EstimateMemory counted a shared message twice: %v with one reference, %v with two", once, twice)
+	}
+
+	// Messages without a generated Go struct are estimated using protoreflect.
+	dm := dynamicpb.NewMessage((&testpb.TestAllTypes{}).ProtoReflect().Descriptor())
+	dempty := proto.EstimateMemory(dm)
+	proto.Merge(dm, &testpb.TestAllTypes{OptionalString: proto.String(string(make([]byte, 1000)))})
+	if got := proto.EstimateMemory(dm) - dempty; got < 1000 {
+		t.Errorf("dynamic message: EstimateMemory(m) - EstimateMemory(empty) = %v, want at least 1000", got)
+	}
+}
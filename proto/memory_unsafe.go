@@ -0,0 +1,11 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !purego,!appengine
+
+package proto
+
+import "unsafe"
+
+const pointerSize = int(unsafe.Sizeof(uintptr(0)))
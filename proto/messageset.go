@@ -9,6 +9,7 @@ import (
 	"google.golang.org/protobuf/internal/encoding/messageset"
 	"google.golang.org/protobuf/internal/errors"
 	"google.golang.org/protobuf/internal/flags"
+	"google.golang.org/protobuf/internal/protoerrors"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
 )
@@ -58,9 +59,16 @@ func (o UnmarshalOptions) unmarshalMessageSet(b []byte, m protoreflect.Message)
 	return messageset.Unmarshal(b, false, func(num protowire.Number, v []byte) error {
 		err := o.unmarshalMessageSetField(m, num, v)
 		if err == errUnknown {
+			if o.RejectUnknown {
+				return protoerrors.UnknownField(m.Descriptor(), nil, num, protowire.BytesType)
+			}
 			unknown := m.GetUnknown()
+			field := len(unknown)
 			unknown = protowire.AppendTag(unknown, num, protowire.BytesType)
 			unknown = protowire.AppendBytes(unknown, v)
+			if o.UnknownFieldHandler != nil && !o.UnknownFieldHandler(m.Descriptor(), num, protowire.BytesType, unknown[field:]) {
+				return nil
+			}
 			m.SetUnknown(unknown)
 			return nil
 		}
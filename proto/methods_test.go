@@ -18,6 +18,7 @@ import (
 	"google.golang.org/protobuf/runtime/protoiface"
 
 	legacypb "google.golang.org/protobuf/internal/testprotos/legacy"
+	testpb "google.golang.org/protobuf/internal/testprotos/test"
 )
 
 type selfMarshaler struct {
@@ -182,3 +183,86 @@ func TestLegacyMergeMethod(t *testing.T) {
 		t.Errorf("Merge(dst, src): want src.src = nil, got %v", got)
 	}
 }
+
+func TestValidateAllocations(t *testing.T) {
+	m := &testpb.TestAllTypes{
+		OptionalInt32:   proto.Int32(1),
+		OptionalString:  proto.String("hello"),
+		RepeatedFixed32: []uint32{1, 2, 3},
+		OptionalNestedMessage: &testpb.TestAllTypes_NestedMessage{
+			A: proto.Int32(2),
+		},
+	}
+	b, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mt := (*testpb.TestAllTypes)(nil)
+	if allocs := testing.AllocsPerRun(100, func() {
+		if err := proto.Validate(b, mt); err != nil {
+			t.Fatal(err)
+		}
+	}); allocs > 0 {
+		t.Errorf("Validate performed %v allocations, want 0", allocs)
+	}
+}
+
+func TestCachedSize(t *testing.T) {
+	m := &testpb.TestAllTypes{
+		OptionalNestedMessage: &testpb.TestAllTypes_NestedMessage{A: proto.Int32(1)},
+		RepeatedNestedMessage: []*testpb.TestAllTypes_NestedMessage{{A: proto.Int32(2)}},
+	}
+	size := proto.Size(m)
+	if got, ok := proto.CachedSize(m); !ok || got != size {
+		t.Errorf("CachedSize after Size = %v, %v; want %v, true", got, ok, size)
+	}
+
+	// Modify a nested message; the cached sizes are now stale.
+	m.RepeatedNestedMessage[0].A = proto.Int32(1000)
+	proto.InvalidateSize(m)
+	if _, ok := proto.CachedSize(m); ok {
+		t.Errorf("CachedSize after InvalidateSize reports ok, want !ok")
+	}
+	if _, ok := proto.CachedSize(m.RepeatedNestedMessage[0]); ok {
+		t.Errorf("CachedSize of nested message after InvalidateSize reports ok, want !ok")
+	}
+	got, err := proto.MarshalOptions{UseCachedSize: true}.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Marshal with UseCachedSize after InvalidateSize:\ngot:  %x\nwant: %x", got, want)
+	}
+	if got, ok := proto.CachedSize(m); !ok || got != len(want) {
+		t.Errorf("CachedSize after Marshal = %v, %v; want %v, true", got, ok, len(want))
+	}
+}
+
+func TestMarshalWithoutCachedSize(t *testing.T) {
+	// Without cached sizes, the fast-path marshaler writes the length of each
+	// nested message after marshaling it.
+	m := &testpb.TestAllTypes{OptionalString: proto.String(string(make([]byte, 200)))}
+	for i := 0; i < 20; i++ {
+		m = &testpb.TestAllTypes{
+			OptionalNestedMessage: &testpb.TestAllTypes_NestedMessage{A: proto.Int32(int32(i))},
+			RepeatedNestedMessage: []*testpb.TestAllTypes_NestedMessage{{A: proto.Int32(1)}, {Corecursive: m}},
+		}
+	}
+	want, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := m.ProtoReflect().ProtoMethods().Marshal(protoiface.MarshalInput{
+		Message: m.ProtoReflect(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Buf, want) {
+		t.Errorf("Marshal without UseCachedSize does not match proto.Marshal")
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/internal/errors"
+)
+
+// PeekField returns the raw value of the field at the given path of field
+// numbers within the wire-format message b, without unmarshaling b.
+// Every field in the path except the last must be a message field.
+// It reports ok as false if the field is not present.
+//
+// The value is a sub-slice of b and has the wire type typ. The length prefix
+// of a length-delimited value and the end marker of a group are not included.
+// If the field appears more than once, the last occurrence is returned,
+// which yields the value of a singular scalar field.
+// For a message field, the value is only one of its occurrences, which would
+// be merged together if b were unmarshaled.
+func PeekField(b []byte, path ...protowire.Number) (v []byte, typ protowire.Type, ok bool, err error) {
+	if len(path) == 0 {
+		return nil, 0, false, errors.New("empty field path")
+	}
+	for len(b) > 0 {
+		num, wtyp, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, 0, false, protowire.ParseError(n)
+		}
+		b = b[n:]
+		var val []byte
+		switch wtyp {
+		case protowire.BytesType:
+			val, n = protowire.ConsumeBytes(b)
+		case protowire.StartGroupType:
+			val, n = protowire.ConsumeGroup(num, b)
+		default:
+			n = protowire.ConsumeFieldValue(num, wtyp, b)
+			if n >= 0 {
+				val = b[:n]
+			}
+		}
+		if n < 0 {
+			return nil, 0, false, protowire.ParseError(n)
+		}
+		b = b[n:]
+		if num != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			v, typ, ok = val, wtyp, true
+			continue
+		}
+		if wtyp != protowire.BytesType && wtyp != protowire.StartGroupType {
+			continue
+		}
+		// Fields of a message may be split across multiple occurrences.
+		v2, typ2, ok2, err := PeekField(val, path[1:]...)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		if ok2 {
+			v, typ, ok = v2, typ2, true
+		}
+	}
+	return v, typ, ok, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto_test
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protopack"
+)
+
+func TestPeekField(t *testing.T) {
+	wire := protopack.Message{
+		protopack.Tag{1, protopack.VarintType}, protopack.Varint(1),
+		protopack.Tag{2, protopack.BytesType}, protopack.LengthPrefix(protopack.Message{
+			protopack.Tag{1, protopack.BytesType}, protopack.String("first"),
+			protopack.Tag{2, protopack.Fixed32Type}, protopack.Uint32(2),
+		}),
+		protopack.Tag{3, protopack.StartGroupType},
+		protopack.Tag{1, protopack.Fixed64Type}, protopack.Uint64(3),
+		protopack.Tag{3, protopack.EndGroupType},
+		protopack.Tag{2, protopack.BytesType}, protopack.LengthPrefix(protopack.Message{
+			protopack.Tag{1, protopack.BytesType}, protopack.String("second"),
+		}),
+		protopack.Tag{1, protopack.VarintType}, protopack.Varint(4),
+	}.Marshal()
+
+	tests := []struct {
+		path    []protowire.Number
+		want    []byte
+		wantTyp protowire.Type
+		wantOK  bool
+	}{{
+		path:    []protowire.Number{1},
+		want:    protowire.AppendVarint(nil, 4),
+		wantTyp: protowire.VarintType,
+		wantOK:  true,
+	}, {
+		path:    []protowire.Number{2, 1},
+		want:    []byte("second"),
+		wantTyp: protowire.BytesType,
+		wantOK:  true,
+	}, {
+		path:    []protowire.Number{2, 2},
+		want:    protowire.AppendFixed32(nil, 2),
+		wantTyp: protowire.Fixed32Type,
+		wantOK:  true,
+	}, {
+		path:    []protowire.Number{3, 1},
+		want:    protowire.AppendFixed64(nil, 3),
+		wantTyp: protowire.Fixed64Type,
+		wantOK:  true,
+	}, {
+		path: []protowire.Number{2, 3},
+	}, {
+		path: []protowire.Number{1, 1},
+	}, {
+		path: []protowire.Number{4},
+	}}
+	for _, test := range tests {
+		got, typ, ok, err := proto.PeekField(wire, test.path...)
+		if err != nil {
+			t.Errorf("PeekField(%v) error: %v", test.path, err)
+			continue
+		}
+		if ok != test.wantOK || !bytes.Equal(got, test.want) || typ != test.wantTyp {
+			t.Errorf("PeekField(%v) = %x, %v, %v; want %x, %v, %v", test.path, got, typ, ok, test.want, test.wantTyp, test.wantOK)
+		}
+	}
+
+	if _, _, _, err := proto.PeekField(wire[:len(wire)-1], 1); err == nil {
+		t.Errorf("PeekField on truncated input: got nil error, want error")
+	}
+}
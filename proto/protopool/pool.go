@@ -0,0 +1,82 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package protopool provides pools of reusable messages, keyed by message type.
+//
+// Messages returned to a pool are reset such that the memory allocated for
+// their repeated fields, map fields, and unknown fields is retained,
+// reducing allocations when messages of the same type are repeatedly
+// unmarshaled (e.g., the requests handled by a server).
+// See proto.ResetOptions.RetainCapacity for details.
+//
+// The retained memory is only reused if a message from the pool is
+// unmarshaled into with proto.UnmarshalOptions.Merge set, since
+// an ordinary unmarshal first calls proto.Reset, which discards it:
+//
+//	m := pool.Get(mt)
+//	if err := (proto.UnmarshalOptions{Merge: true}).Unmarshal(b, m); err != nil {
+//		...
+//	}
+//	...
+//	pool.Put(m)
+//
+// A message must not be used after it has been returned to a pool,
+// and must not be returned to a pool while it is still referenced
+// elsewhere (e.g., as a sub-message of another message).
+package protopool
+
+import (
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Pool is a set of free messages, maintained separately for each message type.
+// The zero value is an empty pool ready to use.
+// A Pool is safe for concurrent use and must not be copied after first use.
+type Pool struct {
+	pools sync.Map // map[protoreflect.MessageType]*sync.Pool
+}
+
+// Get returns an empty, mutable message of type mt, either from the pool
+// or newly allocated. To reuse the memory retained by the message,
+// unmarshal into it with proto.UnmarshalOptions.Merge set.
+func (p *Pool) Get(mt protoreflect.MessageType) proto.Message {
+	if m, ok := p.pool(mt).Get().(proto.Message); ok {
+		return m
+	}
+	return mt.New().Interface()
+}
+
+// Put resets m and adds it to the pool for its message type.
+// It does nothing if m is nil or invalid.
+func (p *Pool) Put(m proto.Message) {
+	if m == nil || !m.ProtoReflect().IsValid() {
+		return
+	}
+	proto.ResetOptions{RetainCapacity: true}.Reset(m)
+	p.pool(m.ProtoReflect().Type()).Put(m)
+}
+
+func (p *Pool) pool(mt protoreflect.MessageType) *sync.Pool {
+	if v, ok := p.pools.Load(mt); ok {
+		return v.(*sync.Pool)
+	}
+	v, _ := p.pools.LoadOrStore(mt, new(sync.Pool))
+	return v.(*sync.Pool)
+}
+
+var global Pool
+
+// Get returns an empty, mutable message of type mt from a global pool.
+func Get(mt protoreflect.MessageType) proto.Message {
+	return global.Get(mt)
+}
+
+// Put resets m and adds it to a global pool.
+// It does nothing if m is nil or invalid.
+func Put(m proto.Message) {
+	global.Put(m)
+}
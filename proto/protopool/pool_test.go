@@ -0,0 +1,100 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protopool_test
+
+import (
+	"sync"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/proto/protopool"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	testpb "google.golang.org/protobuf/internal/testprotos/test"
+)
+
+func TestPool(t *testing.T) {
+	var pool protopool.Pool
+	generated := (&testpb.TestAllTypes{}).ProtoReflect().Type()
+	dynamic := dynamicpb.NewMessageType(generated.Descriptor())
+	other := (&testpb.ForeignMessage{}).ProtoReflect().Type()
+
+	b, err := proto.Marshal(&testpb.TestAllTypes{
+		OptionalInt32: proto.Int32(1),
+		RepeatedInt32: []int32{1, 2, 3},
+		MapInt32Int32: map[int32]int32{1: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for _, mt := range []protoreflect.MessageType{generated, dynamic, other} {
+					m := pool.Get(mt)
+					if got := m.ProtoReflect().Type(); got != mt {
+						t.Errorf("Get(%v) returned message of type %v", mt.Descriptor().FullName(), got.Descriptor().FullName())
+						return
+					}
+					if n := proto.Size(m); n != 0 {
+						t.Errorf("Get(%v) returned non-empty message of size %v", mt.Descriptor().FullName(), n)
+						return
+					}
+					if mt != other {
+						if err := (proto.UnmarshalOptions{Merge: true}).Unmarshal(b, m); err != nil {
+							t.Errorf("Unmarshal error: %v", err)
+							return
+						}
+					}
+					pool.Put(m)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Nil and invalid messages are ignored.
+	pool.Put(nil)
+	pool.Put((*testpb.TestAllTypes)(nil))
+	protopool.Put(protopool.Get(generated))
+}
+
+func TestPoolRetainsCapacity(t *testing.T) {
+	var pool protopool.Pool
+	mt := (&testpb.TestAllTypes{}).ProtoReflect().Type()
+	b, err := proto.Marshal(&testpb.TestAllTypes{RepeatedInt32: []int32{1, 2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The pool may drop messages at any time, notably in race mode,
+	// so try with new messages until one is returned. Each message is
+	// returned to the pool only once.
+	for i := 0; i < 100; i++ {
+		m := pool.Get(mt).(*testpb.TestAllTypes)
+		if err := (proto.UnmarshalOptions{Merge: true}).Unmarshal(b, m); err != nil {
+			t.Fatal(err)
+		}
+		storage := &m.RepeatedInt32[0]
+		pool.Put(m)
+		if got := pool.Get(mt); got != m {
+			continue
+		}
+
+		if err := (proto.UnmarshalOptions{Merge: true}).Unmarshal(b, m); err != nil {
+			t.Fatal(err)
+		}
+		if len(m.RepeatedInt32) != 3 || &m.RepeatedInt32[0] != storage {
+			t.Errorf("Unmarshal with Merge into pooled message did not reuse the storage of repeated_int32")
+		}
+		return
+	}
+	t.Skip("pool did not return the message")
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"google.golang.org/protobuf/internal/redact"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Redact clears every field in m that is annotated with the debug_redact
+// field option, recursively descending into all populated sub-messages,
+// including those in repeated fields, map values, and extensions.
+//
+// Unknown fields are left as is, as are the contents of google.protobuf.Any
+// messages, which are only available in serialized form.
+func Redact(m Message) {
+	// Treat a nil message interface as an empty message; nothing to redact.
+	if m == nil {
+		return
+	}
+	redactMessage(m.ProtoReflect())
+}
+
+func redactMessage(m protoreflect.Message) {
+	if !m.IsValid() {
+		return
+	}
+	var clear, descend []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		switch {
+		case redact.IsRedacted(fd):
+			clear = append(clear, fd)
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			descend = append(descend, fd)
+		case !fd.IsMap() && fd.Message() != nil:
+			descend = append(descend, fd)
+		}
+		return true
+	})
+	for _, fd := range clear {
+		m.Clear(fd)
+	}
+	for _, fd := range descend {
+		v := m.Mutable(fd)
+		switch {
+		case fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				redactMessage(list.Get(i).Message())
+			}
+		case fd.IsMap():
+			v.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				redactMessage(v.Message())
+				return true
+			})
+		default:
+			redactMessage(v.Message())
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto_test
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/internal/genid"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/testing/protopack"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestRedact(t *testing.T) {
+	// The debug_redact option is not known to descriptorpb,
+	// so it is set as an unknown field of FieldOptions.
+	redacted := &descriptorpb.FieldOptions{}
+	redacted.ProtoReflect().SetUnknown(protopack.Message{
+		protopack.Tag{genid.FieldOptions_DebugRedact_field_number, protopack.VarintType}, protopack.Bool(true),
+	}.Marshal())
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("redact.proto"),
+		Package: proto.String("test.redact"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Message"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:   proto.String("public"),
+				Number: proto.Int32(1),
+				Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			}, {
+				Name:    proto.String("secret"),
+				Number:  proto.Int32(2),
+				Label:   descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:    descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				Options: redacted,
+			}, {
+				Name:     proto.String("child"),
+				Number:   proto.Int32(3),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+				TypeName: proto.String(".test.redact.Message"),
+			}, {
+				Name:     proto.String("children"),
+				Number:   proto.Int32(4),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+				TypeName: proto.String(".test.redact.Message"),
+			}},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := fd.Messages().Get(0)
+	parse := func(s string) proto.Message {
+		m := dynamicpb.NewMessage(md)
+		if err := prototext.Unmarshal([]byte(s), m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	got := parse(`
+		public: "a" secret: "b"
+		child: {public: "c" secret: "d" child: {secret: "e"}}
+		children: {public: "f" secret: "g"}
+		children: {secret: "h"}
+	`)
+	want := parse(`
+		public: "a"
+		child: {public: "c" child: {}}
+		children: {public: "f"}
+		children: {}
+	`)
+	proto.Redact(got)
+	if !proto.Equal(got, want) {
+		t.Errorf("Redact() = %v, want %v", got, want)
+	}
+}
@@ -7,12 +7,16 @@ package proto
 import (
 	"fmt"
 
+	"google.golang.org/protobuf/internal/pragma"
 	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 // Reset clears every field in the message.
 // The resulting message shares no observable memory with its previous state
 // other than the memory for the message itself.
+//
+// The reset is shallow: sub-messages are dropped rather than cleared,
+// so other references to them observe no change.
 func Reset(m Message) {
 	if mr, ok := m.(interface{ Reset() }); ok && hasProtoMethods {
 		mr.Reset()
@@ -41,3 +45,68 @@ func resetMessage(m protoreflect.Message) {
 	// Clear unknown fields.
 	m.SetUnknown(nil)
 }
+
+// ResetOptions configures the resetter.
+//
+// Example usage:
+//   ResetOptions{RetainCapacity: true}.Reset(m)
+type ResetOptions struct {
+	pragma.NoUnkeyedLiterals
+
+	// RetainCapacity specifies that memory allocated for repeated scalar
+	// fields, map fields, and the unknown fields of the message is retained
+	// so that it may be reused by subsequent operations such as Unmarshal.
+	// This is intended for messages that are reused from a pool.
+	//
+	// The message is still semantically empty after being reset, but unlike
+	// Reset it continues to share memory with its previous state.
+	// Repeated message fields and singular message fields are always
+	// cleared, so that the sub-messages may be garbage collected.
+	RetainCapacity bool
+}
+
+// Reset clears every field in the message.
+func (o ResetOptions) Reset(m Message) {
+	if !o.RetainCapacity {
+		Reset(m)
+		return
+	}
+	o.resetMessage(m.ProtoReflect())
+}
+
+func (o ResetOptions) resetMessage(m protoreflect.Message) {
+	if !m.IsValid() {
+		panic(fmt.Sprintf("cannot reset invalid %v message", m.Descriptor().FullName()))
+	}
+
+	// Clear all populated fields, truncating those whose memory is retained.
+	// Unpopulated fields may still hold allocated memory and are left as is.
+	var fds []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fds = append(fds, fd)
+		return true
+	})
+	for _, fd := range fds {
+		switch {
+		case fd.IsList() && fd.Message() == nil:
+			m.Mutable(fd).List().Truncate(0)
+		case fd.IsMap():
+			mapv := m.Mutable(fd).Map()
+			var keys []protoreflect.MapKey
+			mapv.Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+				keys = append(keys, k)
+				return true
+			})
+			for _, k := range keys {
+				mapv.Clear(k)
+			}
+		default:
+			m.Clear(fd)
+		}
+	}
+
+	// Truncate unknown fields.
+	if u := m.GetUnknown(); u != nil {
+		m.SetUnknown(u[:0])
+	}
+}
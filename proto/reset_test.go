@@ -56,3 +56,81 @@ func TestReset(t *testing.T) {
 		t.Errorf("m.ProtoReflect().GetUnknown() = %d, want nil", got)
 	}
 }
+
+func TestResetRetainCapacity(t *testing.T) {
+	m := &testpb.TestAllTypes{
+		OptionalInt32:          proto.Int32(5),
+		RepeatedInt32:          make([]int32, 3, 10),
+		RepeatedNestedMessage:  []*testpb.TestAllTypes_NestedMessage{{}},
+		MapStringString:        map[string]string{"a": "b"},
+		OptionalForeignMessage: &testpb.ForeignMessage{},
+		OneofField:             &testpb.TestAllTypes_OneofUint32{1},
+	}
+	m.ProtoReflect().SetUnknown(make([]byte, 5, 20))
+	mapv := m.MapStringString
+
+	proto.ResetOptions{RetainCapacity: true}.Reset(m)
+
+	if !proto.Equal(m, &testpb.TestAllTypes{}) {
+		t.Errorf("message not empty after reset: %v", m)
+	}
+	if len(m.RepeatedInt32) != 0 || cap(m.RepeatedInt32) != 10 {
+		t.Errorf("m.RepeatedInt32: len=%v cap=%v, want len=0 cap=10", len(m.RepeatedInt32), cap(m.RepeatedInt32))
+	}
+	if m.RepeatedNestedMessage != nil {
+		t.Errorf("m.RepeatedNestedMessage = %p, want nil", m.RepeatedNestedMessage)
+	}
+	if len(m.MapStringString) != 0 {
+		t.Errorf("len(m.MapStringString) = %v, want 0", len(m.MapStringString))
+	}
+	mapv["x"] = "y"
+	if len(m.MapStringString) != 1 {
+		t.Errorf("m.MapStringString does not retain the original map")
+	}
+	delete(mapv, "x")
+	if m.OptionalForeignMessage != nil {
+		t.Errorf("m.OptionalForeignMessage = %p, want nil", m.OptionalForeignMessage)
+	}
+	if got := m.ProtoReflect().GetUnknown(); len(got) != 0 || cap(got) != 20 {
+		t.Errorf("unknown fields: len=%v cap=%v, want len=0 cap=20", len(got), cap(got))
+	}
+
+	// Unmarshaling into the message reuses the retained memory.
+	b, err := proto.Marshal(&testpb.TestAllTypes{RepeatedInt32: []int32{1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := &m.RepeatedInt32[:1][0]
+	if err := (proto.UnmarshalOptions{Merge: true}).Unmarshal(b, m); err != nil {
+		t.Fatal(err)
+	}
+	if &m.RepeatedInt32[0] != before {
+		t.Errorf("Unmarshal did not reuse the retained m.RepeatedInt32 slice")
+	}
+}
+
+func TestResetShallow(t *testing.T) {
+	for _, reset := range []struct {
+		name string
+		f    func(proto.Message)
+	}{
+		{"Reset", proto.Reset},
+		{"RetainCapacity", proto.ResetOptions{RetainCapacity: true}.Reset},
+	} {
+		nested := &testpb.TestAllTypes_NestedMessage{A: proto.Int32(1)}
+		elem := &testpb.TestAllTypes_NestedMessage{A: proto.Int32(2)}
+		m := &testpb.TestAllTypes{
+			OptionalNestedMessage: nested,
+			RepeatedNestedMessage: []*testpb.TestAllTypes_NestedMessage{elem},
+		}
+
+		reset.f(m)
+
+		if !proto.Equal(m, &testpb.TestAllTypes{}) {
+			t.Errorf("%v: message not empty after reset: %v", reset.name, m)
+		}
+		if nested.GetA() != 1 || elem.GetA() != 2 {
+			t.Errorf("%v: reset cleared sub-messages: optional_nested_message.a = %v, repeated_nested_message[0].a = %v; want 1, 2", reset.name, nested.GetA(), elem.GetA())
+		}
+	}
+}
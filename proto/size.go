@@ -5,6 +5,8 @@
 package proto
 
 import (
+	"sync/atomic"
+
 	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/internal/encoding/messageset"
 	"google.golang.org/protobuf/reflect/protoreflect"
@@ -30,6 +32,12 @@ func (o MarshalOptions) Size(m Message) int {
 // For profiling purposes, avoid changing the name of this function or
 // introducing other code paths for size that do not go through this.
 func (o MarshalOptions) size(m protoreflect.Message) (size int) {
+	if o.InvalidUTF8 == InvalidUTF8Replace {
+		// Replacing invalid UTF-8 may change the length of a string,
+		// so the only way to determine the size is to marshal the message.
+		out, _ := o.marshal(nil, m)
+		return len(out.Buf)
+	}
 	methods := protoMethods(m)
 	if methods != nil && methods.Size != nil {
 		out := methods.Size(protoiface.SizeInput{
@@ -48,6 +56,121 @@ func (o MarshalOptions) size(m protoreflect.Message) (size int) {
 	return o.sizeMessageSlow(m)
 }
 
+// sizeCacher is implemented by messages that cache their size.
+type sizeCacher interface {
+	ProtoSizeCache() *int32
+}
+
+// CachedSize returns the size of m recorded in its size cache by the most
+// recent call to Size or Marshal, which is used by a subsequent marshal
+// operation with MarshalOptions.UseCachedSize set.
+// It reports false if m does not have a size cache or if the cached size
+// has been invalidated by InvalidateSize.
+//
+// The cache of a message that has never been sized holds zero, which cannot
+// be distinguished from the cached size of an empty message.
+func CachedSize(m Message) (size int, ok bool) {
+	if m == nil {
+		return 0, false
+	}
+	sc, ok := m.ProtoReflect().(sizeCacher)
+	if !ok || !hasProtoMethods {
+		return 0, false
+	}
+	p := sc.ProtoSizeCache()
+	if p == nil {
+		return 0, false
+	}
+	size = int(atomic.LoadInt32(p))
+	return size, size >= 0
+}
+
+// InvalidateSize invalidates the cached size of m and of every message
+// reachable from it, so that a subsequent marshal operation with
+// MarshalOptions.UseCachedSize set recomputes the size of any message
+// that has been modified since it was last sized.
+func InvalidateSize(m Message) {
+	if m == nil {
+		return
+	}
+	invalidateSize(m.ProtoReflect())
+}
+
+func invalidateSize(m protoreflect.Message) {
+	if sc, ok := m.(sizeCacher); ok {
+		if p := sc.ProtoSizeCache(); p != nil {
+			atomic.StoreInt32(p, -1)
+		}
+	}
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				invalidateSize(list.Get(i).Message())
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			v.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				invalidateSize(v.Message())
+				return true
+			})
+		case !fd.IsList() && !fd.IsMap() && fd.Message() != nil:
+			invalidateSize(v.Message())
+		}
+		return true
+	})
+}
+
+// SizeFields returns the size in bytes of the wire-format encoding of m,
+// broken down by top-level field number.
+// See MarshalOptions.SizeFields for details.
+func SizeFields(m Message) map[protoreflect.FieldNumber]int {
+	return MarshalOptions{}.SizeFields(m)
+}
+
+// SizeFields returns the size in bytes of the wire-format encoding of m,
+// broken down by top-level field number. Each entry is the number of bytes
+// contributed by the field, including its tags and any length prefixes,
+// so that the sum of all entries is equal to Size(m).
+//
+// Extension fields and unknown fields are attributed to their field numbers.
+// Unknown fields that cannot be parsed are attributed to field number 0.
+// Only populated fields have an entry in the returned map.
+func (o MarshalOptions) SizeFields(m Message) map[protoreflect.FieldNumber]int {
+	sizes := make(map[protoreflect.FieldNumber]int)
+	// Treat a nil message interface as an empty message; nothing to output.
+	if m == nil {
+		return sizes
+	}
+
+	mr := m.ProtoReflect()
+	isMessageSet := messageset.IsMessageSet(mr.Descriptor())
+	mr.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if isMessageSet {
+			sizes[fd.Number()] += messageset.SizeField(fd.Number()) +
+				protowire.SizeTag(messageset.FieldMessage) +
+				protowire.SizeBytes(o.size(v.Message()))
+		} else {
+			sizes[fd.Number()] += o.sizeField(fd, v)
+		}
+		return true
+	})
+	for b := mr.GetUnknown(); len(b) > 0; {
+		num, _, n := protowire.ConsumeField(b)
+		if n < 0 {
+			sizes[0] += len(b)
+			break
+		}
+		if isMessageSet {
+			sizes[num] += messageset.SizeUnknown(b[:n])
+		} else {
+			sizes[num] += n
+		}
+		b = b[n:]
+	}
+	return sizes
+}
+
 func (o MarshalOptions) sizeMessageSlow(m protoreflect.Message) (size int) {
 	if messageset.IsMessageSet(m.Descriptor()) {
 		return o.sizeMessageSet(m)
@@ -0,0 +1,76 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Transform calls f for every populated value in m, replacing each value
+// with the one that f returns. The values visited are those of singular
+// fields, the elements of repeated fields, and the values of map fields,
+// including those of extension fields. Map keys and unknown fields are not
+// visited. The order in which fields are visited is undefined.
+//
+// Message values are passed to f before the fields within them are visited,
+// and Transform descends into the message returned by f.
+// The value returned by f must be valid and of the same type as the input;
+// to leave a value unchanged, return it as is.
+//
+// The path to each value lists the fields from m to the value. For an
+// element of a repeated field or a value of a map field, the last field in
+// the path is the repeated or map field; the type of a map value is given by
+// its MapValue.
+// The path is only valid for the duration of the call to f and must be copied
+// if it is retained. It panics if m is invalid.
+func Transform(m Message, f func(path []protoreflect.FieldDescriptor, v protoreflect.Value) protoreflect.Value) {
+	// Treat a nil message interface as an empty message; nothing to visit.
+	if m == nil {
+		return
+	}
+	transformMessage(m.ProtoReflect(), nil, f)
+}
+
+func transformMessage(m protoreflect.Message, path []protoreflect.FieldDescriptor, f func([]protoreflect.FieldDescriptor, protoreflect.Value) protoreflect.Value) {
+	var fds []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fds = append(fds, fd)
+		return true
+	})
+	for _, fd := range fds {
+		path := append(path, fd)
+		switch {
+		case fd.IsList():
+			list := m.Mutable(fd).List()
+			for i := 0; i < list.Len(); i++ {
+				list.Set(i, transformValue(path, fd, list.Get(i), f))
+			}
+		case fd.IsMap():
+			mapv := m.Mutable(fd).Map()
+			var keys []protoreflect.MapKey
+			mapv.Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+				keys = append(keys, k)
+				return true
+			})
+			for _, k := range keys {
+				mapv.Set(k, transformValue(path, fd.MapValue(), mapv.Get(k), f))
+			}
+		default:
+			v := m.Get(fd)
+			if fd.Message() != nil {
+				v = m.Mutable(fd)
+			}
+			m.Set(fd, transformValue(path, fd, v, f))
+		}
+	}
+}
+
+func transformValue(path []protoreflect.FieldDescriptor, fd protoreflect.FieldDescriptor, v protoreflect.Value, f func([]protoreflect.FieldDescriptor, protoreflect.Value) protoreflect.Value) protoreflect.Value {
+	v = f(path, v)
+	if fd.Message() != nil {
+		transformMessage(v.Message(), path, f)
+	}
+	return v
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	testpb "google.golang.org/protobuf/internal/testprotos/test"
+)
+
+func TestTransform(t *testing.T) {
+	newMessage := func() *testpb.TestAllTypes {
+		m := &testpb.TestAllTypes{
+			OptionalString: proto.String(" a "),
+			OptionalNestedMessage: &testpb.TestAllTypes_NestedMessage{
+				Corecursive: &testpb.TestAllTypes{RepeatedString: []string{" b ", "c "}},
+			},
+			RepeatedNestedMessage: []*testpb.TestAllTypes_NestedMessage{{A: proto.Int32(1)}},
+			MapStringString:       map[string]string{" k ": " d "},
+			MapStringNestedMessage: map[string]*testpb.TestAllTypes_NestedMessage{
+				"m": {Corecursive: &testpb.TestAllTypes{OptionalString: proto.String(" e")}},
+			},
+			OneofField: &testpb.TestAllTypes_OneofString{" f "},
+		}
+		return m
+	}
+	want := &testpb.TestAllTypes{
+		OptionalString: proto.String("a"),
+		OptionalNestedMessage: &testpb.TestAllTypes_NestedMessage{
+			Corecursive: &testpb.TestAllTypes{RepeatedString: []string{"b", "c"}},
+		},
+		RepeatedNestedMessage: []*testpb.TestAllTypes_NestedMessage{{A: proto.Int32(2)}},
+		MapStringString:       map[string]string{" k ": "d"},
+		MapStringNestedMessage: map[string]*testpb.TestAllTypes_NestedMessage{
+			"m": {Corecursive: &testpb.TestAllTypes{OptionalString: proto.String("e")}},
+		},
+		OneofField: &testpb.TestAllTypes_OneofString{"f"},
+	}
+	wantPaths := []string{
+		"map_string_nested_message",
+		"map_string_nested_message.corecursive",
+		"map_string_nested_message.corecursive.optional_string",
+		"map_string_string",
+		"oneof_string",
+		"optional_nested_message",
+		"optional_nested_message.corecursive",
+		"optional_nested_message.corecursive.repeated_string",
+		"optional_nested_message.corecursive.repeated_string",
+		"optional_string",
+		"repeated_nested_message",
+		"repeated_nested_message.a",
+	}
+
+	for _, m := range []proto.Message{newMessage(), dynamicpb.NewMessage(want.ProtoReflect().Descriptor())} {
+		if dm, ok := m.(*dynamicpb.Message); ok {
+			proto.Merge(dm, newMessage())
+		}
+		var paths []string
+		proto.Transform(m, func(path []protoreflect.FieldDescriptor, v protoreflect.Value) protoreflect.Value {
+			var names []string
+			for _, fd := range path {
+				names = append(names, string(fd.Name()))
+			}
+			paths = append(paths, strings.Join(names, "."))
+			fd := transformField(path)
+			switch fd.Kind() {
+			case protoreflect.StringKind:
+				return protoreflect.ValueOfString(strings.TrimSpace(v.String()))
+			case protoreflect.Int32Kind:
+				return protoreflect.ValueOfInt32(int32(v.Int()) + 1)
+			}
+			return v
+		})
+		if !proto.Equal(m, want) {
+			t.Errorf("%T: Transform result mismatch:\ngot:  %v\nwant: %v", m, prototext.Format(m), prototext.Format(want))
+		}
+		sort.Strings(paths)
+		if diff := cmp.Diff(wantPaths, paths); diff != "" {
+			t.Errorf("%T: Transform paths mismatch (-want +got):\n%v", m, diff)
+		}
+	}
+
+	// Replacing a message value descends into the replacement.
+	m := &testpb.TestAllTypes{OptionalNestedMessage: &testpb.TestAllTypes_NestedMessage{A: proto.Int32(1)}}
+	proto.Transform(m, func(path []protoreflect.FieldDescriptor, v protoreflect.Value) protoreflect.Value {
+		switch transformField(path).Kind() {
+		case protoreflect.MessageKind:
+			return protoreflect.ValueOfMessage((&testpb.TestAllTypes_NestedMessage{A: proto.Int32(10)}).ProtoReflect())
+		case protoreflect.Int32Kind:
+			return protoreflect.ValueOfInt32(int32(v.Int()) + 1)
+		}
+		return v
+	})
+	if got, want := m.GetOptionalNestedMessage().GetA(), int32(11); got != want {
+		t.Errorf("replaced message: optional_nested_message.a = %v, want %v", got, want)
+	}
+}
+
+// transformField returns the descriptor of the field or map value
+// at the end of a path passed to the Transform callback.
+func transformField(path []protoreflect.FieldDescriptor) protoreflect.FieldDescriptor {
+	fd := path[len(path)-1]
+	if fd.IsMap() {
+		return fd.MapValue()
+	}
+	return fd
+}
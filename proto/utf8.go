@@ -0,0 +1,53 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"google.golang.org/protobuf/internal/errors"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// InvalidUTF8Handling specifies how a string field that is required to
+// contain valid UTF-8 (e.g., a string field in a proto3 message) is
+// handled when it does not.
+type InvalidUTF8Handling uint8
+
+const (
+	// InvalidUTF8Reject reports an error for the invalid string.
+	InvalidUTF8Reject InvalidUTF8Handling = iota
+
+	// InvalidUTF8Replace replaces each byte of the string that is not part
+	// of a valid UTF-8 sequence with the Unicode replacement character
+	// (U+FFFD), as done when converting a Go string to a []rune.
+	InvalidUTF8Replace
+
+	// InvalidUTF8Accept accepts the string unchanged.
+	InvalidUTF8Accept
+)
+
+func (o UnmarshalOptions) invalidUTF8(fd protoreflect.FieldDescriptor, v []byte) ([]byte, error) {
+	switch o.InvalidUTF8 {
+	case InvalidUTF8Replace:
+		v = []byte(string([]rune(string(v))))
+	case InvalidUTF8Accept:
+	default:
+		return nil, errors.InvalidUTF8(string(fd.FullName()))
+	}
+	if o.InvalidUTF8Handler != nil {
+		o.InvalidUTF8Handler(fd)
+	}
+	return v, nil
+}
+
+func (o MarshalOptions) invalidUTF8(fd protoreflect.FieldDescriptor, s string) (string, error) {
+	switch o.InvalidUTF8 {
+	case InvalidUTF8Replace:
+		return string([]rune(s)), nil
+	case InvalidUTF8Accept:
+		return s, nil
+	default:
+		return "", errors.InvalidUTF8(string(fd.FullName()))
+	}
+}
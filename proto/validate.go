@@ -0,0 +1,62 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/runtime/protoiface"
+)
+
+// Validate reports whether b is a valid wire-format encoding of a message
+// of the same type as m. The contents of m are neither examined nor modified,
+// and m may be a typed nil pointer.
+//
+// Validation checks that the input is well-formed, that strings which must
+// be valid UTF-8 are, and that all required fields are set.
+func Validate(b []byte, m Message) error {
+	return UnmarshalOptions{}.Validate(b, m)
+}
+
+// Validate reports whether b is a valid wire-format encoding of a message
+// of the same type as m. The contents of m are neither examined nor modified,
+// and m may be a typed nil pointer.
+//
+// The options are interpreted as they are by Unmarshal, such that Validate
+// returns nil if and only if o.Unmarshal(b, m.ProtoReflect().New()) would.
+// For messages with generated fast-path methods, and options which those
+// methods support, a successful validation does not construct any message.
+// Reporting an invalid input may require unmarshaling it in order to produce
+// a descriptive error.
+func (o UnmarshalOptions) Validate(b []byte, m Message) error {
+	mr := m.ProtoReflect()
+	o.Merge = true
+	o.UnknownFieldHandler = nil // not called for a message that is discarded
+	o.DuplicateFieldHandler = nil
+	if o.Resolver == nil {
+		o.Resolver = protoregistry.GlobalTypes
+	}
+	if methods := protoMethods(mr); methods != nil && methods.Validate != nil && o.supportedBy(methods) {
+		in := protoiface.UnmarshalInput{
+			Message:  mr,
+			Buf:      b,
+			Resolver: o.Resolver,
+		}
+		if o.DiscardUnknown {
+			in.Flags |= protoiface.UnmarshalDiscardUnknown
+		}
+		if o.RejectUnknown {
+			in.Flags |= protoiface.UnmarshalRejectUnknown
+		}
+		out := methods.Validate(in)
+		if out.Flags&protoiface.ValidateValid != 0 &&
+			(o.AllowPartial || out.Flags&protoiface.ValidateInitialized != 0) {
+			return nil
+		}
+	}
+	// Either the validator could not render a judgement or the input
+	// is invalid. Unmarshal into a new message to find out which,
+	// and to produce the same error that Unmarshal would have.
+	return o.Unmarshal(b, mr.New().Interface())
+}
@@ -9,7 +9,11 @@ import (
 	"testing"
 
 	"google.golang.org/protobuf/internal/impl"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	piface "google.golang.org/protobuf/runtime/protoiface"
+
+	testpb "google.golang.org/protobuf/internal/testprotos/test"
 )
 
 // TestValidate tests the internal message validator.
@@ -56,3 +60,64 @@ func TestValidateInvalid(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateAPI(t *testing.T) {
+	for _, test := range testValidMessages {
+		for _, m := range test.decodeTo {
+			t.Run(fmt.Sprintf("%s (%T)", test.desc, m), func(t *testing.T) {
+				opts := test.unmarshalOptions
+				opts.AllowPartial = test.partial
+				if err := opts.Validate(test.wire, m); err != nil {
+					t.Errorf("Validate(%x) = %v, want nil", test.wire, err)
+				}
+				if !test.partial {
+					return
+				}
+				opts.AllowPartial = false
+				if err := opts.Validate(test.wire, m); err == nil {
+					t.Errorf("Validate(%x) without AllowPartial = nil, want error", test.wire)
+				}
+			})
+		}
+	}
+	for _, test := range testInvalidMessages {
+		for _, m := range test.decodeTo {
+			t.Run(fmt.Sprintf("%s (%T)", test.desc, m), func(t *testing.T) {
+				opts := test.unmarshalOptions
+				opts.AllowPartial = test.partial
+				if err := opts.Validate(test.wire, m); err == nil {
+					t.Errorf("Validate(%x) = nil, want error", test.wire)
+				}
+			})
+		}
+	}
+}
+
+// TestValidateOptions tests that Validate agrees with Unmarshal for options
+// which the fast-path validator does not implement.
+func TestValidateOptions(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		opts proto.UnmarshalOptions
+		wire []byte
+		m    proto.Message
+	}{{
+		desc: "required field not in Fields",
+		opts: proto.UnmarshalOptions{Fields: []protoreflect.FieldNumber{2}},
+		wire: []byte{0x08, 0x01},
+		m:    &testpb.TestRequired{},
+	}, {
+		desc: "required field in Fields",
+		opts: proto.UnmarshalOptions{Fields: []protoreflect.FieldNumber{1}},
+		wire: []byte{0x08, 0x01},
+		m:    &testpb.TestRequired{},
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			uerr := test.opts.Unmarshal(test.wire, test.m.ProtoReflect().New().Interface())
+			verr := test.opts.Validate(test.wire, test.m)
+			if (uerr == nil) != (verr == nil) {
+				t.Errorf("Validate(%x) = %v, but Unmarshal = %v", test.wire, verr, uerr)
+			}
+		})
+	}
+}
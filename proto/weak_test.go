@@ -123,3 +123,40 @@ func TestWeakMarshalNil(t *testing.T) {
 		t.Errorf("Marshal(weak field set to typed nil) = [%x], %v; want [], nil", b, err)
 	}
 }
+
+func TestWeakFieldHandling(t *testing.T) {
+	if !flags.ProtoLegacy {
+		t.SkipNow()
+	}
+	wire := protopack.Message{
+		protopack.Tag{1, protopack.BytesType}, protopack.LengthPrefix(protopack.Message{
+			protopack.Tag{1, protopack.VarintType}, protopack.Varint(1000),
+		}),
+	}.Marshal()
+
+	decoded := &testpb.TestWeak{}
+	decoded.SetWeakMessage1(&weakpb.WeakImportMessage1{
+		A: proto.Int32(1000),
+	})
+	unknown := &testpb.TestWeak{}
+	unknown.ProtoReflect().SetUnknown(wire)
+
+	for _, test := range []struct {
+		opts proto.UnmarshalOptions
+		want proto.Message
+	}{
+		{proto.UnmarshalOptions{WeakFields: proto.WeakFieldsDecode}, decoded},
+		{proto.UnmarshalOptions{WeakFields: proto.WeakFieldsUnknown}, unknown},
+		{proto.UnmarshalOptions{WeakFields: proto.WeakFieldsDiscard}, &testpb.TestWeak{}},
+		{proto.UnmarshalOptions{WeakFields: proto.WeakFieldsDiscard, RejectUnknown: true}, &testpb.TestWeak{}},
+	} {
+		got := &testpb.TestWeak{}
+		if err := test.opts.Unmarshal(wire, got); err != nil {
+			t.Errorf("Unmarshal with WeakFields = %v: %v", test.opts.WeakFields, err)
+			continue
+		}
+		if !proto.Equal(got, test.want) {
+			t.Errorf("Unmarshal with WeakFields = %v:\ngot:  %v\nwant: %v", test.opts.WeakFields, got, test.want)
+		}
+	}
+}
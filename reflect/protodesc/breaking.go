@@ -0,0 +1,354 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protodesc
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/internal/descdiff"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Severity is the severity of a BreakingChange.
+type Severity int
+
+const (
+	// Warning is the severity of a change that is compatible, but that
+	// risks future incompatible changes or changes the meaning of values,
+	// such as removing a field without reserving its number.
+	Warning Severity = iota + 1
+	// JSONBreaking is the severity of a change that is compatible with the
+	// wire format, but not with the JSON or text formats,
+	// such as renaming a field.
+	JSONBreaking
+	// WireBreaking is the severity of a change that is incompatible with
+	// the wire format, such as changing the type of a field.
+	WireBreaking
+)
+
+// String returns the name of s.
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case JSONBreaking:
+		return "JSON breaking"
+	case WireBreaking:
+		return "wire breaking"
+	default:
+		return fmt.Sprintf("<unknown:%d>", s)
+	}
+}
+
+// BreakingChange is a change to a schema that may break the compatibility
+// of messages encoded with one version of the schema and decoded with the
+// other, as reported by BreakingChanges.
+type BreakingChange struct {
+	Severity Severity
+
+	// Old and New are the declaration in the old and new schema.
+	// Old is nil for an added declaration and New for a removed one.
+	Old, New protoreflect.Descriptor
+
+	// Detail describes the change, such as
+	// "kind changed from int32 to string".
+	Detail string
+}
+
+// FullName returns the full name of the changed declaration,
+// in the new schema unless it was removed.
+func (c BreakingChange) FullName() protoreflect.FullName {
+	if c.New != nil {
+		return c.New.FullName()
+	}
+	return c.Old.FullName()
+}
+
+// String returns a description of the change, such as
+// "wire breaking: a.Msg.foo: kind changed from int32 to string".
+func (c BreakingChange) String() string {
+	return fmt.Sprintf("%v: %v: %v", c.Severity, c.FullName(), c.Detail)
+}
+
+// BreakingChanges returns the breaking changes from the old descriptor set x
+// to the new descriptor set y. Declarations are matched by full name,
+// so moving a declaration to another file is not a change,
+// except that fields are matched by field number and enum values by name.
+// Dependencies missing from a set are replaced by placeholders.
+//
+// The changes are reported in the order of declaration in x,
+// with the files of x in order of their paths.
+func BreakingChanges(x, y *descriptorpb.FileDescriptorSet) ([]BreakingChange, error) {
+	o := FileOptions{AllowUnresolvable: true}
+	rx, err := o.NewFiles(x)
+	if err != nil {
+		return nil, err
+	}
+	ry, err := o.NewFiles(y)
+	if err != nil {
+		return nil, err
+	}
+	var files []protoreflect.FileDescriptor
+	rx.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		files = append(files, fd)
+		return true
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].Path() < files[j].Path() })
+
+	b := breaker{new: ry}
+	for _, fd := range files {
+		b.checkDecls(fd)
+		for i := 0; i < fd.Services().Len(); i++ {
+			b.checkService(fd.Services().Get(i))
+		}
+	}
+	return b.changes, nil
+}
+
+// breaker accumulates the breaking changes from an old schema to the new one.
+type breaker struct {
+	new     *protoregistry.Files
+	changes []BreakingChange
+}
+
+func (b *breaker) add(s Severity, x, y protoreflect.Descriptor, f string, args ...interface{}) {
+	b.changes = append(b.changes, BreakingChange{Severity: s, Old: x, New: y, Detail: fmt.Sprintf(f, args...)})
+}
+
+// find returns the declaration in the new schema with the same full name
+// as x, or nil if there is none.
+func (b *breaker) find(x protoreflect.Descriptor) protoreflect.Descriptor {
+	d, err := b.new.FindDescriptorByName(x.FullName())
+	if err != nil {
+		return nil
+	}
+	return d
+}
+
+// declarations is implemented by file and message descriptors.
+type declarations interface {
+	Enums() protoreflect.EnumDescriptors
+	Messages() protoreflect.MessageDescriptors
+	Extensions() protoreflect.ExtensionDescriptors
+}
+
+// checkDecls checks the enums, messages, and extensions declared in x.
+func (b *breaker) checkDecls(x declarations) {
+	for i := 0; i < x.Enums().Len(); i++ {
+		ex := x.Enums().Get(i)
+		if ey, ok := b.find(ex).(protoreflect.EnumDescriptor); ok {
+			b.checkEnum(ex, ey)
+		} else {
+			b.add(Warning, ex, nil, "enum removed")
+		}
+	}
+	for i := 0; i < x.Messages().Len(); i++ {
+		mx := x.Messages().Get(i)
+		if mx.IsMapEntry() {
+			continue // checked as part of the map field
+		}
+		if my, ok := b.find(mx).(protoreflect.MessageDescriptor); ok {
+			b.checkMessage(mx, my)
+		} else {
+			b.add(Warning, mx, nil, "message removed")
+		}
+	}
+	for i := 0; i < x.Extensions().Len(); i++ {
+		xx := x.Extensions().Get(i)
+		if xy, ok := b.find(xx).(protoreflect.ExtensionDescriptor); ok {
+			b.checkField(xx, xy)
+		} else {
+			b.add(Warning, xx, nil, "extension removed")
+		}
+	}
+}
+
+func (b *breaker) checkMessage(x, y protoreflect.MessageDescriptor) {
+	if sx, sy := IsMessageSetWireFormat(x), IsMessageSetWireFormat(y); sx != sy {
+		b.add(WireBreaking, x, y, "message set wire format changed from %v to %v", sx, sy)
+	}
+
+	xf, yf := x.Fields(), y.Fields()
+	for i := 0; i < xf.Len(); i++ {
+		fx := xf.Get(i)
+		if fy := yf.ByNumber(fx.Number()); fy != nil {
+			b.checkField(fx, fy)
+			continue
+		}
+		switch {
+		case fx.Cardinality() == protoreflect.Required:
+			b.add(WireBreaking, fx, nil, "required field removed")
+		case !y.ReservedNames().Has(fx.Name()):
+			b.add(JSONBreaking, fx, nil, "field removed without reserving name %q", fx.Name())
+		case !y.ReservedRanges().Has(fx.Number()):
+			b.add(Warning, fx, nil, "field removed without reserving number %d", fx.Number())
+		}
+	}
+	for i := 0; i < yf.Len(); i++ {
+		fy := yf.Get(i)
+		if xf.ByNumber(fy.Number()) != nil {
+			continue
+		}
+		switch {
+		case x.ReservedRanges().Has(fy.Number()):
+			b.add(WireBreaking, nil, fy, "field added with reserved number %d", fy.Number())
+		case x.ReservedNames().Has(fy.Name()):
+			b.add(JSONBreaking, nil, fy, "field added with reserved name %q", fy.Name())
+		case fy.Cardinality() == protoreflect.Required:
+			b.add(WireBreaking, nil, fy, "required field added")
+		}
+	}
+
+	b.checkDecls(x)
+}
+
+func (b *breaker) checkField(x, y protoreflect.FieldDescriptor) {
+	if x.Number() != y.Number() {
+		b.add(WireBreaking, x, y, "number changed from %d to %d", x.Number(), y.Number())
+	}
+	if x.Name() != y.Name() {
+		b.add(JSONBreaking, x, y, "name changed from %v to %v", x.Name(), y.Name())
+	} else if x.JSONName() != y.JSONName() {
+		b.add(JSONBreaking, x, y, "JSON name changed from %q to %q", x.JSONName(), y.JSONName())
+	}
+
+	switch {
+	case x.IsMap() && y.IsMap():
+		b.checkFieldType(x, y, x.MapKey(), y.MapKey(), "map key ")
+		b.checkFieldType(x, y, x.MapValue(), y.MapValue(), "map value ")
+	case x.IsMap() != y.IsMap():
+		b.add(WireBreaking, x, y, "map changed from %v to %v", x.IsMap(), y.IsMap())
+	default:
+		b.checkFieldType(x, y, x, y, "")
+	}
+
+	cx, cy := x.Cardinality(), y.Cardinality()
+	switch {
+	case cx == cy:
+	case cx == protoreflect.Required || cy == protoreflect.Required:
+		b.add(WireBreaking, x, y, "cardinality changed from %v to %v", cx, cy)
+	case !x.IsMap() && !y.IsMap():
+		b.add(JSONBreaking, x, y, "cardinality changed from %v to %v", cx, cy)
+	}
+	if ox, oy := descdiff.RealOneofName(x), descdiff.RealOneofName(y); ox != oy {
+		b.add(Warning, x, y, "oneof changed from %q to %q", ox, oy)
+	}
+	if dx, dy := descdiff.DefaultString(x), descdiff.DefaultString(y); dx != dy {
+		b.add(Warning, x, y, "default changed from %v to %v", dx, dy)
+	}
+	if x.IsExtension() && x.ContainingMessage().FullName() != y.ContainingMessage().FullName() {
+		b.add(WireBreaking, x, y, "extendee changed from %v to %v", x.ContainingMessage().FullName(), y.ContainingMessage().FullName())
+	}
+}
+
+// checkFieldType checks the type of the field, map key, or map value y
+// against x, reporting changes on the fields fx and fy. The prefix is
+// prepended to the details of a change.
+func (b *breaker) checkFieldType(fx, fy, x, y protoreflect.FieldDescriptor, prefix string) {
+	kx, ky := x.Kind(), y.Kind()
+	switch {
+	case kx == ky:
+		if nx, ny := descdiff.TypeName(x), descdiff.TypeName(y); nx != ny && !isPlaceholderType(x) && !isPlaceholderType(y) {
+			b.add(WireBreaking, fx, fy, "%stype changed from %v to %v", prefix, nx, ny)
+		}
+	case wireClass(kx) != 0 && wireClass(kx) == wireClass(ky):
+		b.add(JSONBreaking, fx, fy, "%skind changed from %v to %v", prefix, kx, ky)
+	default:
+		b.add(WireBreaking, fx, fy, "%skind changed from %v to %v", prefix, kx, ky)
+	}
+}
+
+func (b *breaker) checkEnum(x, y protoreflect.EnumDescriptor) {
+	xv, yv := x.Values(), y.Values()
+	for i := 0; i < xv.Len(); i++ {
+		vx := xv.Get(i)
+		vy := yv.ByName(vx.Name())
+		switch {
+		case vy != nil:
+			if vx.Number() != vy.Number() {
+				b.add(WireBreaking, vx, vy, "number changed from %d to %d", vx.Number(), vy.Number())
+			}
+		case yv.ByNumber(vx.Number()) != nil:
+			b.add(JSONBreaking, vx, yv.ByNumber(vx.Number()), "name changed from %v to %v", vx.Name(), yv.ByNumber(vx.Number()).Name())
+		case !y.ReservedNames().Has(vx.Name()):
+			b.add(JSONBreaking, vx, nil, "enum value removed without reserving name %q", vx.Name())
+		case !y.ReservedRanges().Has(vx.Number()):
+			b.add(Warning, vx, nil, "enum value removed without reserving number %d", vx.Number())
+		}
+	}
+	for i := 0; i < yv.Len(); i++ {
+		vy := yv.Get(i)
+		if xv.ByName(vy.Name()) == nil && x.ReservedRanges().Has(vy.Number()) {
+			b.add(WireBreaking, nil, vy, "enum value added with reserved number %d", vy.Number())
+		}
+	}
+}
+
+func (b *breaker) checkService(x protoreflect.ServiceDescriptor) {
+	y, ok := b.find(x).(protoreflect.ServiceDescriptor)
+	if !ok {
+		b.add(WireBreaking, x, nil, "service removed")
+		return
+	}
+	xm, ym := x.Methods(), y.Methods()
+	for i := 0; i < xm.Len(); i++ {
+		mx := xm.Get(i)
+		my := ym.ByName(mx.Name())
+		if my == nil {
+			b.add(WireBreaking, mx, nil, "method removed")
+			continue
+		}
+		if mx.Input().FullName() != my.Input().FullName() {
+			b.add(WireBreaking, mx, my, "input changed from %v to %v", mx.Input().FullName(), my.Input().FullName())
+		}
+		if mx.Output().FullName() != my.Output().FullName() {
+			b.add(WireBreaking, mx, my, "output changed from %v to %v", mx.Output().FullName(), my.Output().FullName())
+		}
+		if mx.IsStreamingClient() != my.IsStreamingClient() {
+			b.add(WireBreaking, mx, my, "client streaming changed from %v to %v", mx.IsStreamingClient(), my.IsStreamingClient())
+		}
+		if mx.IsStreamingServer() != my.IsStreamingServer() {
+			b.add(WireBreaking, mx, my, "server streaming changed from %v to %v", mx.IsStreamingServer(), my.IsStreamingServer())
+		}
+	}
+}
+
+// wireClass returns a number identifying the kinds whose values may be
+// decoded as each other in the wire format, or zero if k is only compatible
+// with itself. Values of different kinds in the same class may still be
+// truncated or reinterpreted when decoded.
+//
+// See https://developers.google.com/protocol-buffers/docs/proto3#updating.
+func wireClass(k protoreflect.Kind) int {
+	switch k {
+	case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Uint32Kind, protoreflect.Uint64Kind, protoreflect.BoolKind, protoreflect.EnumKind:
+		return 1
+	case protoreflect.Sint32Kind, protoreflect.Sint64Kind:
+		return 2
+	case protoreflect.Fixed32Kind, protoreflect.Sfixed32Kind:
+		return 3
+	case protoreflect.Fixed64Kind, protoreflect.Sfixed64Kind:
+		return 4
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		return 5
+	}
+	return 0
+}
+
+// isPlaceholderType reports whether the message or enum type of fd
+// could not be resolved.
+func isPlaceholderType(fd protoreflect.FieldDescriptor) bool {
+	switch {
+	case fd.Message() != nil:
+		return fd.Message().IsPlaceholder()
+	case fd.Enum() != nil:
+		return fd.Enum().IsPlaceholder()
+	}
+	return false
+}
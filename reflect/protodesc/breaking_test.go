@@ -0,0 +1,92 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protodesc
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestBreakingChanges(t *testing.T) {
+	old := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{mustParseFile(`
+		syntax:  "proto2"
+		name:    "test.proto"
+		package: "test"
+		message_type: [{
+			name: "M"
+			field: [
+				{name:"id" number:1 label:LABEL_REQUIRED type:TYPE_INT64},
+				{name:"count" number:2 label:LABEL_OPTIONAL type:TYPE_INT32},
+				{name:"label" number:3 label:LABEL_OPTIONAL type:TYPE_STRING},
+				{name:"gone" number:4 label:LABEL_OPTIONAL type:TYPE_BOOL},
+				{name:"kept" number:5 label:LABEL_OPTIONAL type:TYPE_FIXED32},
+				{name:"tags" number:6 label:LABEL_REPEATED type:TYPE_STRING},
+				{name:"reserved_ok" number:7 label:LABEL_OPTIONAL type:TYPE_BOOL}
+			]
+			reserved_range: [{start:100 end:101}]
+		}, {
+			name: "Unused"
+		}]
+		enum_type: [{name:"E" value:[{name:"A" number:0}, {name:"B" number:1}, {name:"C" number:2}]}]
+		service: [{name:"S" method:[{name:"Get" input_type:".test.M" output_type:".test.M"}]}]
+	`)}}
+	new := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{mustParseFile(`
+		syntax:  "proto2"
+		name:    "moved.proto"
+		package: "test"
+		message_type: [{
+			name: "M"
+			field: [
+				{name:"count" number:2 label:LABEL_OPTIONAL type:TYPE_UINT32},
+				{name:"name" number:3 label:LABEL_OPTIONAL type:TYPE_STRING},
+				{name:"kept" number:5 label:LABEL_OPTIONAL type:TYPE_STRING},
+				{name:"tags" number:6 label:LABEL_OPTIONAL type:TYPE_STRING},
+				{name:"reused" number:100 label:LABEL_OPTIONAL type:TYPE_INT32}
+			]
+			reserved_range: [{start:7 end:8}]
+			reserved_name: ["reserved_ok"]
+		}]
+		enum_type: [{name:"E" value:[{name:"A" number:0}, {name:"BEE" number:1}, {name:"C" number:3}]}]
+		service: [{name:"S" method:[{name:"Get" input_type:".test.M" output_type:".test.M" server_streaming:true}]}]
+	`)}}
+
+	got, err := BreakingChanges(old, new)
+	if err != nil {
+		t.Fatalf("BreakingChanges error: %v", err)
+	}
+	want := []string{
+		`JSON breaking: test.BEE: name changed from B to BEE`,
+		`wire breaking: test.C: number changed from 2 to 3`,
+		`wire breaking: test.M.id: required field removed`,
+		`JSON breaking: test.M.count: kind changed from int32 to uint32`,
+		`JSON breaking: test.M.name: name changed from label to name`,
+		`JSON breaking: test.M.gone: field removed without reserving name "gone"`,
+		`wire breaking: test.M.kept: kind changed from fixed32 to string`,
+		`JSON breaking: test.M.tags: cardinality changed from repeated to optional`,
+		`wire breaking: test.M.reused: field added with reserved number 100`,
+		`warning: test.Unused: message removed`,
+		`wire breaking: test.S.Get: server streaming changed from false to true`,
+	}
+	if len(got) != len(want) {
+		t.Errorf("BreakingChanges reported %d changes, want %d", len(got), len(want))
+	}
+	for i := 0; i < len(got) || i < len(want); i++ {
+		var g, w string
+		if i < len(got) {
+			g = got[i].String()
+		}
+		if i < len(want) {
+			w = want[i]
+		}
+		if g != w {
+			t.Errorf("change %d:\ngot  %s\nwant %s", i, g, w)
+		}
+	}
+
+	if got, err := BreakingChanges(old, old); err != nil || len(got) != 0 {
+		t.Errorf("BreakingChanges(old, old) = %v, %v; want no changes", got, err)
+	}
+}
@@ -0,0 +1,585 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protodesc
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/internal/errors"
+	"google.golang.org/protobuf/internal/strs"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// FileBuilder constructs a file descriptor programmatically, as an
+// alternative to populating a descriptorpb.FileDescriptorProto by hand:
+//
+//	b := protodesc.NewFileBuilder("example/foo.proto", "example")
+//	m := b.AddMessage("Foo")
+//	m.AddField("name", 1, protoreflect.StringKind)
+//	m.AddField("bars", 2, protoreflect.MessageKind).Type("example.Bar").Repeated()
+//	b.AddMessage("Bar").AddField("id", 1, protoreflect.Int64Kind)
+//	fd, err := b.Build(nil)
+//
+// Each builder method checks its arguments as it is called. The first
+// problem found, and any error from validating the file in Build, is
+// reported by Build together with the builder call that declared the
+// offending element and the location of that call.
+type FileBuilder struct {
+	fd     *descriptorpb.FileDescriptorProto
+	err    error
+	decls  []builderDecl
+	fields []*FieldBuilder
+}
+
+// builderDecl records the builder call that declared an element.
+type builderDecl struct {
+	name protoreflect.FullName
+	call string // description and location of the builder call
+}
+
+// NewFileBuilder returns a builder for a file with the given path and package,
+// where the package may be empty. The file uses proto3 syntax unless changed
+// with Syntax.
+func NewFileBuilder(path string, pkg protoreflect.FullName) *FileBuilder {
+	b := &FileBuilder{fd: &descriptorpb.FileDescriptorProto{
+		Name:   proto.String(path),
+		Syntax: proto.String("proto3"),
+	}}
+	if pkg != "" {
+		b.fd.Package = proto.String(string(pkg))
+	}
+	call := b.call(fmt.Sprintf("NewFileBuilder(%q)", path))
+	switch {
+	case path == "":
+		b.fail(call, "file path must be populated")
+	case pkg != "" && !pkg.IsValid():
+		b.fail(call, "invalid package %q", pkg)
+	}
+	return b
+}
+
+// Syntax sets the syntax of the file, which is proto3 by default.
+func (b *FileBuilder) Syntax(s protoreflect.Syntax) *FileBuilder {
+	call := b.call(fmt.Sprintf("Syntax(%v)", s))
+	switch s {
+	case protoreflect.Proto2, protoreflect.Proto3:
+		b.fd.Syntax = proto.String(s.String())
+	default:
+		b.fail(call, "invalid syntax")
+	}
+	return b
+}
+
+// Import adds a dependency on the file with the given path, which must be
+// resolvable by the Resolver passed to Build.
+func (b *FileBuilder) Import(path string) *FileBuilder {
+	call := b.call(fmt.Sprintf("Import(%q)", path))
+	for _, dep := range b.fd.Dependency {
+		if dep == path {
+			b.fail(call, "already imported")
+			return b
+		}
+	}
+	b.fd.Dependency = append(b.fd.Dependency, path)
+	return b
+}
+
+// Options sets the options of the file.
+func (b *FileBuilder) Options(opts *descriptorpb.FileOptions) *FileBuilder {
+	b.fd.Options = opts
+	return b
+}
+
+// AddMessage declares a top-level message and returns a builder for it.
+func (b *FileBuilder) AddMessage(name protoreflect.Name) *MessageBuilder {
+	md := &descriptorpb.DescriptorProto{Name: proto.String(string(name))}
+	b.fd.MessageType = append(b.fd.MessageType, md)
+	mb := &MessageBuilder{file: b, md: md, fullName: b.qualify(name)}
+	b.declare(name, mb.fullName, "AddMessage")
+	return mb
+}
+
+// AddEnum declares a top-level enum and returns a builder for it.
+func (b *FileBuilder) AddEnum(name protoreflect.Name) *EnumBuilder {
+	ed := &descriptorpb.EnumDescriptorProto{Name: proto.String(string(name))}
+	b.fd.EnumType = append(b.fd.EnumType, ed)
+	eb := &EnumBuilder{file: b, ed: ed, fullName: b.qualify(name)}
+	b.declare(name, eb.fullName, "AddEnum")
+	return eb
+}
+
+// AddExtension declares a top-level extension of the message extendee
+// and returns a builder for it.
+func (b *FileBuilder) AddExtension(name protoreflect.Name, num protoreflect.FieldNumber, kind protoreflect.Kind, extendee protoreflect.FullName) *FieldBuilder {
+	fd := &descriptorpb.FieldDescriptorProto{Extendee: proto.String(fullRef(extendee))}
+	b.fd.Extension = append(b.fd.Extension, fd)
+	fb := b.newField(fd, name, b.qualify(name), num, kind, "AddExtension")
+	if !extendee.IsValid() {
+		b.fail(fb.call, "invalid extendee %q", extendee)
+	}
+	return fb
+}
+
+// Proto returns the file descriptor message constructed so far.
+// The result is a copy which the caller may modify.
+func (b *FileBuilder) Proto() *descriptorpb.FileDescriptorProto {
+	fd := proto.Clone(b.fd).(*descriptorpb.FileDescriptorProto)
+	// Give every proto3 optional field a synthetic oneof, after the oneofs
+	// declared with AddOneof.
+	proto3 := fd.GetSyntax() == "proto3"
+	var walk func([]*descriptorpb.DescriptorProto)
+	walk = func(mds []*descriptorpb.DescriptorProto) {
+		for _, md := range mds {
+			for _, f := range md.Field {
+				if !f.GetProto3Optional() {
+					continue
+				}
+				if !proto3 {
+					f.Proto3Optional = nil
+					continue
+				}
+				f.OneofIndex = proto.Int32(int32(len(md.OneofDecl)))
+				md.OneofDecl = append(md.OneofDecl, &descriptorpb.OneofDescriptorProto{
+					Name: proto.String(syntheticOneofName(md, f.GetName())),
+				})
+			}
+			walk(md.NestedType)
+		}
+	}
+	walk(fd.MessageType)
+	return fd
+}
+
+// Build returns the file descriptor constructed by the builder, resolving
+// imports with r as NewFile does. The descriptor is not registered.
+//
+// An error is reported with the builder call that declared the element at
+// fault, such as:
+//
+//	AddField("name") at foo.go:42: ...
+func (b *FileBuilder) Build(r Resolver) (protoreflect.FileDescriptor, error) {
+	for _, fb := range b.fields {
+		if isNamedKind(protoreflect.Kind(fb.fd.GetType())) && fb.fd.TypeName == nil {
+			b.fail(fb.call, "the type of a field of kind %v must be set with Type", protoreflect.Kind(fb.fd.GetType()))
+		}
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	fd, err := NewFile(b.Proto(), r)
+	if err != nil {
+		// Attribute the error to the element with the longest full name
+		// that it mentions, which is the most specific one.
+		s := err.Error()
+		var decl *builderDecl
+		for i, d := range b.decls {
+			if strings.Contains(s, strconv.Quote(string(d.name))) && (decl == nil || len(d.name) > len(decl.name)) {
+				decl = &b.decls[i]
+			}
+		}
+		if decl != nil {
+			return nil, errors.Wrap(err, "%s", decl.call)
+		}
+		return nil, err
+	}
+	return fd, nil
+}
+
+// MessageBuilder constructs a message within a FileBuilder.
+type MessageBuilder struct {
+	file     *FileBuilder
+	md       *descriptorpb.DescriptorProto
+	fullName protoreflect.FullName
+	numbers  map[protoreflect.FieldNumber]bool
+}
+
+// FullName returns the full name of the message.
+func (b *MessageBuilder) FullName() protoreflect.FullName {
+	return b.fullName
+}
+
+// AddField declares a field of the message and returns a builder for it.
+// A field of MessageKind, GroupKind, or EnumKind must be given its type
+// with FieldBuilder.Type.
+func (b *MessageBuilder) AddField(name protoreflect.Name, num protoreflect.FieldNumber, kind protoreflect.Kind) *FieldBuilder {
+	fd := &descriptorpb.FieldDescriptorProto{}
+	b.md.Field = append(b.md.Field, fd)
+	fb := b.file.newField(fd, name, b.fullName.Append(name), num, kind, "AddField")
+	b.checkNumber(fb)
+	return fb
+}
+
+// AddMapField declares a map field of the message with keys of the kind key
+// and values of the kind value, and returns a builder for the field.
+// If the values are messages or enums, valueType is their full name.
+func (b *MessageBuilder) AddMapField(name protoreflect.Name, num protoreflect.FieldNumber, key, value protoreflect.Kind, valueType protoreflect.FullName) *FieldBuilder {
+	entryName := protoreflect.Name(strs.MapEntryName(string(name)))
+	entry := &descriptorpb.DescriptorProto{
+		Name: proto.String(string(entryName)),
+		Field: []*descriptorpb.FieldDescriptorProto{{
+			Name:     proto.String("key"),
+			JsonName: proto.String("key"),
+			Number:   proto.Int32(1),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descriptorpb.FieldDescriptorProto_Type(key).Enum(),
+		}, {
+			Name:     proto.String("value"),
+			JsonName: proto.String("value"),
+			Number:   proto.Int32(2),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descriptorpb.FieldDescriptorProto_Type(value).Enum(),
+		}},
+		Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+	}
+	if valueType != "" {
+		entry.Field[1].TypeName = proto.String(fullRef(valueType))
+	}
+	b.md.NestedType = append(b.md.NestedType, entry)
+
+	fd := &descriptorpb.FieldDescriptorProto{TypeName: proto.String(fullRef(b.fullName.Append(entryName)))}
+	b.md.Field = append(b.md.Field, fd)
+	fb := b.file.newField(fd, name, b.fullName.Append(name), num, protoreflect.MessageKind, "AddMapField")
+	fb.isMap = true
+	fd.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	b.checkNumber(fb)
+	switch key {
+	case protoreflect.BoolKind, protoreflect.StringKind,
+		protoreflect.Int32Kind, protoreflect.Int64Kind,
+		protoreflect.Sint32Kind, protoreflect.Sint64Kind,
+		protoreflect.Uint32Kind, protoreflect.Uint64Kind,
+		protoreflect.Fixed32Kind, protoreflect.Fixed64Kind,
+		protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind:
+	default:
+		b.file.fail(fb.call, "invalid map key kind %v", key)
+	}
+	switch {
+	case value == protoreflect.GroupKind || !value.IsValid():
+		b.file.fail(fb.call, "invalid map value kind %v", value)
+	case (value == protoreflect.MessageKind || value == protoreflect.EnumKind) != (valueType != ""):
+		b.file.fail(fb.call, "a value type must be given for exactly the message and enum value kinds")
+	case valueType != "" && !valueType.IsValid():
+		b.file.fail(fb.call, "invalid value type %q", valueType)
+	}
+	return fb
+}
+
+// AddOneof declares a oneof of the message and returns a builder for it.
+// The fields of a oneof must be added consecutively.
+func (b *MessageBuilder) AddOneof(name protoreflect.Name) *OneofBuilder {
+	b.md.OneofDecl = append(b.md.OneofDecl, &descriptorpb.OneofDescriptorProto{Name: proto.String(string(name))})
+	ob := &OneofBuilder{msg: b, index: int32(len(b.md.OneofDecl) - 1)}
+	ob.call = b.file.declare(name, b.fullName.Append(name), "AddOneof")
+	return ob
+}
+
+// AddMessage declares a message nested in the message and
+// returns a builder for it.
+func (b *MessageBuilder) AddMessage(name protoreflect.Name) *MessageBuilder {
+	md := &descriptorpb.DescriptorProto{Name: proto.String(string(name))}
+	b.md.NestedType = append(b.md.NestedType, md)
+	mb := &MessageBuilder{file: b.file, md: md, fullName: b.fullName.Append(name)}
+	b.file.declare(name, mb.fullName, "AddMessage")
+	return mb
+}
+
+// AddEnum declares an enum nested in the message and returns a builder for it.
+func (b *MessageBuilder) AddEnum(name protoreflect.Name) *EnumBuilder {
+	ed := &descriptorpb.EnumDescriptorProto{Name: proto.String(string(name))}
+	b.md.EnumType = append(b.md.EnumType, ed)
+	eb := &EnumBuilder{file: b.file, ed: ed, fullName: b.fullName.Append(name)}
+	b.file.declare(name, eb.fullName, "AddEnum")
+	return eb
+}
+
+// AddExtension declares an extension of the message extendee in the scope of
+// the message and returns a builder for it.
+func (b *MessageBuilder) AddExtension(name protoreflect.Name, num protoreflect.FieldNumber, kind protoreflect.Kind, extendee protoreflect.FullName) *FieldBuilder {
+	fd := &descriptorpb.FieldDescriptorProto{Extendee: proto.String(fullRef(extendee))}
+	b.md.Extension = append(b.md.Extension, fd)
+	fb := b.file.newField(fd, name, b.fullName.Append(name), num, kind, "AddExtension")
+	if !extendee.IsValid() {
+		b.file.fail(fb.call, "invalid extendee %q", extendee)
+	}
+	return fb
+}
+
+// ReservedRange reserves the field numbers from start to end inclusive.
+func (b *MessageBuilder) ReservedRange(start, end protoreflect.FieldNumber) *MessageBuilder {
+	b.md.ReservedRange = append(b.md.ReservedRange, &descriptorpb.DescriptorProto_ReservedRange{
+		Start: proto.Int32(int32(start)),
+		End:   proto.Int32(int32(end) + 1),
+	})
+	return b
+}
+
+// ReservedName reserves the field name.
+func (b *MessageBuilder) ReservedName(name protoreflect.Name) *MessageBuilder {
+	b.md.ReservedName = append(b.md.ReservedName, string(name))
+	return b
+}
+
+// ExtensionRange declares the field numbers from start to end inclusive
+// as available for extensions.
+func (b *MessageBuilder) ExtensionRange(start, end protoreflect.FieldNumber) *MessageBuilder {
+	b.md.ExtensionRange = append(b.md.ExtensionRange, &descriptorpb.DescriptorProto_ExtensionRange{
+		Start: proto.Int32(int32(start)),
+		End:   proto.Int32(int32(end) + 1),
+	})
+	return b
+}
+
+// Options sets the options of the message.
+func (b *MessageBuilder) Options(opts *descriptorpb.MessageOptions) *MessageBuilder {
+	b.md.Options = opts
+	return b
+}
+
+// checkNumber reports an error if the number of the field is already used.
+func (b *MessageBuilder) checkNumber(fb *FieldBuilder) {
+	num := protoreflect.FieldNumber(fb.fd.GetNumber())
+	if b.numbers == nil {
+		b.numbers = make(map[protoreflect.FieldNumber]bool)
+	}
+	if b.numbers[num] {
+		b.file.fail(fb.call, "field number %d already used in %v", num, b.fullName)
+	}
+	b.numbers[num] = true
+}
+
+// OneofBuilder constructs a oneof within a MessageBuilder.
+type OneofBuilder struct {
+	msg   *MessageBuilder
+	index int32
+	call  string
+}
+
+// AddField declares a field of the message that is a member of the oneof
+// and returns a builder for it.
+func (b *OneofBuilder) AddField(name protoreflect.Name, num protoreflect.FieldNumber, kind protoreflect.Kind) *FieldBuilder {
+	fd := &descriptorpb.FieldDescriptorProto{OneofIndex: proto.Int32(b.index)}
+	b.msg.md.Field = append(b.msg.md.Field, fd)
+	fb := b.msg.file.newField(fd, name, b.msg.fullName.Append(name), num, kind, "AddField")
+	b.msg.checkNumber(fb)
+	return fb
+}
+
+// EnumBuilder constructs an enum within a FileBuilder.
+type EnumBuilder struct {
+	file     *FileBuilder
+	ed       *descriptorpb.EnumDescriptorProto
+	fullName protoreflect.FullName
+}
+
+// FullName returns the full name of the enum.
+func (b *EnumBuilder) FullName() protoreflect.FullName {
+	return b.fullName
+}
+
+// AddValue declares a value of the enum. The values of an enum are in the
+// scope enclosing the enum.
+func (b *EnumBuilder) AddValue(name protoreflect.Name, num protoreflect.EnumNumber) *EnumBuilder {
+	b.ed.Value = append(b.ed.Value, &descriptorpb.EnumValueDescriptorProto{
+		Name:   proto.String(string(name)),
+		Number: proto.Int32(int32(num)),
+	})
+	b.file.declare(name, b.fullName.Parent().Append(name), "AddValue")
+	return b
+}
+
+// Options sets the options of the enum.
+func (b *EnumBuilder) Options(opts *descriptorpb.EnumOptions) *EnumBuilder {
+	b.ed.Options = opts
+	return b
+}
+
+// FieldBuilder constructs a field or extension. Its methods return the
+// builder so that they may be chained.
+type FieldBuilder struct {
+	file  *FileBuilder
+	fd    *descriptorpb.FieldDescriptorProto
+	call  string
+	isMap bool
+}
+
+// Type sets the full name of the message or enum type of a field of
+// MessageKind, GroupKind, or EnumKind.
+func (b *FieldBuilder) Type(name protoreflect.FullName) *FieldBuilder {
+	switch {
+	case b.isMap:
+		b.file.fail(b.call, "cannot set the type of a map field")
+	case !isNamedKind(protoreflect.Kind(b.fd.GetType())):
+		b.file.fail(b.call, "cannot set the type of a field of kind %v", protoreflect.Kind(b.fd.GetType()))
+	case !name.IsValid():
+		b.file.fail(b.call, "invalid type name %q", name)
+	default:
+		b.fd.TypeName = proto.String(fullRef(name))
+	}
+	return b
+}
+
+// Repeated makes the field a repeated field.
+func (b *FieldBuilder) Repeated() *FieldBuilder {
+	b.setLabel(descriptorpb.FieldDescriptorProto_LABEL_REPEATED)
+	return b
+}
+
+// Required makes the field a proto2 required field.
+func (b *FieldBuilder) Required() *FieldBuilder {
+	b.setLabel(descriptorpb.FieldDescriptorProto_LABEL_REQUIRED)
+	return b
+}
+
+// Optional makes the field an optional field with explicit presence.
+// This is the default in proto2; in proto3, the field is given a synthetic
+// oneof as for the optional keyword.
+func (b *FieldBuilder) Optional() *FieldBuilder {
+	b.setLabel(descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL)
+	if b.fd.Extendee == nil && b.fd.OneofIndex == nil {
+		b.fd.Proto3Optional = proto.Bool(true)
+	}
+	return b
+}
+
+// setLabel sets the cardinality of the field.
+func (b *FieldBuilder) setLabel(label descriptorpb.FieldDescriptorProto_Label) {
+	if b.isMap {
+		b.file.fail(b.call, "cannot set the cardinality of a map field")
+		return
+	}
+	b.fd.Label = label.Enum()
+	b.fd.Proto3Optional = nil
+}
+
+// JSONName sets the JSON name of the field, which is otherwise derived from
+// its name.
+func (b *FieldBuilder) JSONName(name string) *FieldBuilder {
+	b.fd.JsonName = proto.String(name)
+	return b
+}
+
+// Default sets the default value of a proto2 scalar field, in the form used
+// by descriptorpb.FieldDescriptorProto.DefaultValue.
+func (b *FieldBuilder) Default(v string) *FieldBuilder {
+	b.fd.DefaultValue = proto.String(v)
+	return b
+}
+
+// Packed sets whether a repeated scalar field uses the packed encoding.
+func (b *FieldBuilder) Packed(packed bool) *FieldBuilder {
+	if b.fd.Options == nil {
+		b.fd.Options = &descriptorpb.FieldOptions{}
+	}
+	b.fd.Options.Packed = proto.Bool(packed)
+	return b
+}
+
+// Options sets the options of the field.
+func (b *FieldBuilder) Options(opts *descriptorpb.FieldOptions) *FieldBuilder {
+	b.fd.Options = opts
+	return b
+}
+
+// newField populates fd, which is declared by the builder method method,
+// and returns a builder for it.
+func (b *FileBuilder) newField(fd *descriptorpb.FieldDescriptorProto, name protoreflect.Name, fullName protoreflect.FullName, num protoreflect.FieldNumber, kind protoreflect.Kind, method string) *FieldBuilder {
+	fd.Name = proto.String(string(name))
+	fd.Number = proto.Int32(int32(num))
+	fd.Label = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	fd.Type = descriptorpb.FieldDescriptorProto_Type(kind).Enum()
+	if fd.Extendee == nil {
+		fd.JsonName = proto.String(strs.JSONCamelCase(string(name)))
+	}
+	fb := &FieldBuilder{file: b, fd: fd}
+	fb.call = b.declare(name, fullName, method)
+	b.fields = append(b.fields, fb)
+	switch {
+	case !num.IsValid():
+		b.fail(fb.call, "invalid field number %d", num)
+	case !kind.IsValid():
+		b.fail(fb.call, "invalid kind %v", kind)
+	}
+	return fb
+}
+
+// declare records the declaration of an element by the builder method method
+// and returns the description of the call.
+func (b *FileBuilder) declare(name protoreflect.Name, fullName protoreflect.FullName, method string) string {
+	call := b.call(fmt.Sprintf("%s(%q)", method, name))
+	for _, d := range b.decls {
+		if d.name == fullName {
+			b.fail(call, "%q already declared by %s", fullName, d.call)
+		}
+	}
+	b.decls = append(b.decls, builderDecl{fullName, call})
+	if !name.IsValid() {
+		b.fail(call, "invalid name %q", name)
+	}
+	return call
+}
+
+// call returns a description of the builder call desc, which includes the
+// location of the caller of the builder method.
+func (b *FileBuilder) call(desc string) string {
+	// Report the first caller outside of this package.
+	for skip := 2; ; skip++ {
+		pc, file, line, ok := runtime.Caller(skip)
+		if !ok {
+			return desc
+		}
+		if fn := runtime.FuncForPC(pc); fn != nil && strings.HasPrefix(fn.Name(), "google.golang.org/protobuf/reflect/protodesc.") &&
+			!strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		return fmt.Sprintf("%s at %s:%d", desc, filepath.Base(file), line)
+	}
+}
+
+// fail records the error for the builder call call, unless an earlier call
+// has already failed.
+func (b *FileBuilder) fail(call string, f string, x ...interface{}) {
+	if b.err == nil {
+		b.err = errors.New("%s: %s", call, fmt.Sprintf(f, x...))
+	}
+}
+
+// qualify returns the full name of a top-level declaration.
+func (b *FileBuilder) qualify(name protoreflect.Name) protoreflect.FullName {
+	return protoreflect.FullName(b.fd.GetPackage()).Append(name)
+}
+
+// fullRef returns the fully-qualified reference to name used in
+// descriptorpb messages.
+func fullRef(name protoreflect.FullName) string {
+	return "." + string(name)
+}
+
+// isNamedKind reports whether fields of the kind k refer to a named type.
+func isNamedKind(k protoreflect.Kind) bool {
+	return k == protoreflect.MessageKind || k == protoreflect.GroupKind || k == protoreflect.EnumKind
+}
+
+// syntheticOneofName returns the name of the synthetic oneof of the proto3
+// optional field name in md, as protoc would choose it.
+func syntheticOneofName(md *descriptorpb.DescriptorProto, name string) string {
+	taken := make(map[string]bool)
+	for _, f := range md.Field {
+		taken[f.GetName()] = true
+	}
+	for _, o := range md.OneofDecl {
+		taken[o.GetName()] = true
+	}
+	s := "_" + name
+	for taken[s] {
+		s = "X" + s
+	}
+	return s
+}
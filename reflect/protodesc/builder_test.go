@@ -0,0 +1,206 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protodesc
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+func TestFileBuilder(t *testing.T) {
+	b := NewFileBuilder("test/builder.proto", "test.builder")
+	b.Import("proto2_enum.proto")
+	m := b.AddMessage("Message")
+	m.AddField("name", 1, protoreflect.StringKind)
+	m.AddField("count", 2, protoreflect.Int32Kind).Optional()
+	m.AddField("children", 3, protoreflect.MessageKind).Type("test.builder.Message").Repeated()
+	m.AddField("state", 4, protoreflect.EnumKind).Type("test.builder.Message.State")
+	m.AddMapField("labels", 5, protoreflect.StringKind, protoreflect.MessageKind, "test.builder.Other")
+	o := m.AddOneof("choice")
+	o.AddField("a", 6, protoreflect.BoolKind)
+	o.AddField("b", 7, protoreflect.BytesKind).JSONName("bee")
+	m.AddEnum("State").AddValue("UNKNOWN", 0).AddValue("ACTIVE", 1)
+	m.AddField("packed", 8, protoreflect.Fixed32Kind).Repeated().Packed(false)
+	m.ReservedRange(10, 20).ReservedName("old")
+	b.AddMessage("Other")
+
+	r := new(protoregistry.Files)
+	dep, err := NewFile(proto2Enum, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RegisterFile(dep); err != nil {
+		t.Fatal(err)
+	}
+	fd, err := b.Build(r)
+	if err != nil {
+		t.Fatalf("Build error: %v", err)
+	}
+
+	md := fd.Messages().ByName("Message")
+	fds := md.Fields()
+	if got := fds.ByName("name"); got.Kind() != protoreflect.StringKind || got.HasPresence() {
+		t.Errorf("field name: kind %v, presence %v; want string without presence", got.Kind(), got.HasPresence())
+	}
+	if got := fds.ByName("count"); !got.HasPresence() || got.ContainingOneof() == nil || !got.ContainingOneof().IsSynthetic() {
+		t.Errorf("field count is not a proto3 optional field")
+	}
+	if got := fds.ByName("children"); !got.IsList() || got.Message() != md {
+		t.Errorf("field children: list %v, message %v; want list of Message", got.IsList(), got.Message().FullName())
+	}
+	if got := fds.ByName("state").Enum(); got.FullName() != "test.builder.Message.State" || got.Values().Len() != 2 {
+		t.Errorf("field state has enum %v", got.FullName())
+	}
+	if got := fds.ByName("labels"); !got.IsMap() || got.MapKey().Kind() != protoreflect.StringKind || got.MapValue().Message().FullName() != "test.builder.Other" {
+		t.Errorf("field labels is not a map<string, Other>")
+	}
+	if got := md.Oneofs().ByName("choice"); got.Fields().Len() != 2 || got.Index() != 0 {
+		t.Errorf("oneof choice: %d fields at index %d, want 2 fields at index 0", got.Fields().Len(), got.Index())
+	}
+	if got := fds.ByName("b").JSONName(); got != "bee" {
+		t.Errorf("field b has JSON name %q, want bee", got)
+	}
+	if got := fds.ByName("packed"); got.IsPacked() {
+		t.Errorf("field packed is packed")
+	}
+	if !md.ReservedRanges().Has(15) || md.ReservedRanges().Has(21) || !md.ReservedNames().Has("old") {
+		t.Errorf("reserved ranges or names not declared")
+	}
+
+	// Proto reflects the same file.
+	if got := ToFileDescriptorProto(fd); !proto.Equal(got, b.Proto()) {
+		t.Errorf("Proto() does not match the built file:\ngot  %v\nwant %v", b.Proto(), got)
+	}
+}
+
+func TestFileBuilderProto2(t *testing.T) {
+	b := NewFileBuilder("test/builder2.proto", "").Syntax(protoreflect.Proto2)
+	m := b.AddMessage("Message").ExtensionRange(100, 199)
+	m.AddField("id", 1, protoreflect.Int64Kind).Required().Default("5")
+	m.AddField("opt", 2, protoreflect.StringKind).Optional()
+	b.AddExtension("ext", 100, protoreflect.Int32Kind, "Message")
+
+	fd, err := b.Build(nil)
+	if err != nil {
+		t.Fatalf("Build error: %v", err)
+	}
+	f := fd.Messages().ByName("Message").Fields().ByName("id")
+	if f.Cardinality() != protoreflect.Required || f.Default().Int() != 5 {
+		t.Errorf("field id: cardinality %v, default %v; want required with default 5", f.Cardinality(), f.Default())
+	}
+	if got := fd.Messages().ByName("Message").Oneofs().Len(); got != 0 {
+		t.Errorf("proto2 message has %d oneofs, want 0", got)
+	}
+	if got := fd.Extensions().ByName("ext"); got.ContainingMessage().FullName() != "Message" {
+		t.Errorf("extension ext extends %v, want Message", got.ContainingMessage().FullName())
+	}
+}
+
+func TestFileBuilderErrors(t *testing.T) {
+	tests := []struct {
+		desc  string
+		build func() *FileBuilder
+		want  string
+	}{{
+		desc: "invalid field number",
+		build: func() *FileBuilder {
+			b := NewFileBuilder("a.proto", "a")
+			b.AddMessage("M").AddField("x", 0, protoreflect.Int32Kind)
+			return b
+		},
+		want: `AddField("x") at builder_test.go:`,
+	}, {
+		desc: "duplicate field number",
+		build: func() *FileBuilder {
+			b := NewFileBuilder("a.proto", "a")
+			m := b.AddMessage("M")
+			m.AddField("x", 1, protoreflect.Int32Kind)
+			m.AddField("y", 1, protoreflect.Int32Kind)
+			return b
+		},
+		want: `AddField("y") at builder_test.go:`,
+	}, {
+		desc: "duplicate name",
+		build: func() *FileBuilder {
+			b := NewFileBuilder("a.proto", "a")
+			b.AddMessage("M")
+			b.AddEnum("M").AddValue("ZERO", 0)
+			return b
+		},
+		want: `AddEnum("M") at builder_test.go:`,
+	}, {
+		desc: "invalid name",
+		build: func() *FileBuilder {
+			b := NewFileBuilder("a.proto", "a")
+			b.AddMessage("M").AddField("x.y", 1, protoreflect.Int32Kind)
+			return b
+		},
+		want: `invalid name "x.y"`,
+	}, {
+		desc: "missing type",
+		build: func() *FileBuilder {
+			b := NewFileBuilder("a.proto", "a")
+			b.AddMessage("M").AddField("x", 1, protoreflect.MessageKind)
+			return b
+		},
+		want: `AddField("x") at builder_test.go:`,
+	}, {
+		desc: "type for scalar",
+		build: func() *FileBuilder {
+			b := NewFileBuilder("a.proto", "a")
+			b.AddMessage("M").AddField("x", 1, protoreflect.Int32Kind).Type("a.M")
+			return b
+		},
+		want: "cannot set the type",
+	}, {
+		desc: "unresolvable type",
+		build: func() *FileBuilder {
+			b := NewFileBuilder("a.proto", "a")
+			m := b.AddMessage("M")
+			m.AddField("ok", 1, protoreflect.Int32Kind)
+			m.AddField("bad", 2, protoreflect.MessageKind).Type("a.Missing")
+			return b
+		},
+		want: `AddField("bad") at builder_test.go:`,
+	}, {
+		desc: "proto3 required",
+		build: func() *FileBuilder {
+			b := NewFileBuilder("a.proto", "a")
+			b.AddMessage("M").AddField("req", 1, protoreflect.Int32Kind).Required()
+			return b
+		},
+		want: `AddField("req") at builder_test.go:`,
+	}, {
+		desc: "invalid map key",
+		build: func() *FileBuilder {
+			b := NewFileBuilder("a.proto", "a")
+			b.AddMessage("M").AddMapField("m", 1, protoreflect.DoubleKind, protoreflect.Int32Kind, "")
+			return b
+		},
+		want: "invalid map key kind double",
+	}, {
+		desc: "repeated map",
+		build: func() *FileBuilder {
+			b := NewFileBuilder("a.proto", "a")
+			b.AddMessage("M").AddMapField("m", 1, protoreflect.Int32Kind, protoreflect.Int32Kind, "").Repeated()
+			return b
+		},
+		want: "cannot set the cardinality of a map field",
+	}}
+	for _, tt := range tests {
+		_, err := tt.build().Build(nil)
+		if err == nil {
+			t.Errorf("%s: Build succeeded, want error", tt.desc)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Build error %q, want it to contain %q", tt.desc, err, tt.want)
+		}
+	}
+}
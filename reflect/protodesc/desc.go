@@ -10,11 +10,14 @@
 // The protoreflect.FileDescriptor is a more structured representation of
 // the FileDescriptorProto message where references and remote dependencies
 // can be directly followed.
+//
+// Files that use protobuf editions are not supported.
 package protodesc
 
 import (
 	"google.golang.org/protobuf/internal/errors"
 	"google.golang.org/protobuf/internal/filedesc"
+	"google.golang.org/protobuf/internal/genid"
 	"google.golang.org/protobuf/internal/pragma"
 	"google.golang.org/protobuf/internal/strs"
 	"google.golang.org/protobuf/proto"
@@ -59,6 +62,14 @@ type FileOptions struct {
 	// then the placeholder will contain an invalid FullName with a "*." prefix,
 	// indicating that the starting prefix of the full name is unknown.
 	AllowUnresolvable bool
+
+	// ReportAllErrors configures New to continue past problems with the file
+	// where possible and report all of them as a ValidationErrors.
+	// Each ValidationError identifies the declaration with the problem by
+	// its path in the FileDescriptorProto.
+	//
+	// Otherwise, New reports only the first problem found.
+	ReportAllErrors bool
 }
 
 // NewFile creates a new protoreflect.FileDescriptor from the provided
@@ -86,6 +97,11 @@ func (o FileOptions) New(fd *descriptorpb.FileDescriptorProto, r Resolver) (prot
 		r = (*protoregistry.Files)(nil) // empty resolver
 	}
 
+	v := &validator{file: fd.GetName(), all: o.ReportAllErrors}
+	filePath := func(n protoreflect.FieldNumber, e ...int32) protoreflect.SourcePath {
+		return appendPath(protoreflect.SourcePath{int32(n)}, e...)
+	}
+
 	// Handle the file descriptor content.
 	f := &filedesc.File{L2: &filedesc.FileL2{}}
 	switch fd.GetSyntax() {
@@ -93,16 +109,31 @@ func (o FileOptions) New(fd *descriptorpb.FileDescriptorProto, r Resolver) (prot
 		f.L1.Syntax = protoreflect.Proto2
 	case "proto3":
 		f.L1.Syntax = protoreflect.Proto3
+	case "editions":
+		// The descriptor.proto from which descriptorpb is generated predates
+		// editions: it has neither the edition field of FileDescriptorProto
+		// nor the FeatureSet options from which features would be resolved.
+		if err := v.report(filePath(genid.FileDescriptorProto_Syntax_field_number), errors.New("editions are not supported")); err != nil {
+			return nil, err
+		}
+		f.L1.Syntax = protoreflect.Proto2
 	default:
-		return nil, errors.New("invalid syntax: %q", fd.GetSyntax())
+		if err := v.report(filePath(genid.FileDescriptorProto_Syntax_field_number), errors.New("invalid syntax: %q", fd.GetSyntax())); err != nil {
+			return nil, err
+		}
+		f.L1.Syntax = protoreflect.Proto2
 	}
 	f.L1.Path = fd.GetName()
 	if f.L1.Path == "" {
-		return nil, errors.New("file path must be populated")
+		if err := v.report(filePath(genid.FileDescriptorProto_Name_field_number), errors.New("file path must be populated")); err != nil {
+			return nil, err
+		}
 	}
 	f.L1.Package = protoreflect.FullName(fd.GetPackage())
 	if !f.L1.Package.IsValid() && f.L1.Package != "" {
-		return nil, errors.New("invalid package: %q", f.L1.Package)
+		if err := v.report(filePath(genid.FileDescriptorProto_Package_field_number), errors.New("invalid package: %q", f.L1.Package)); err != nil {
+			return nil, err
+		}
 	}
 	if opts := fd.GetOptions(); opts != nil {
 		opts = proto.Clone(opts).(*descriptorpb.FileOptions)
@@ -110,31 +141,43 @@ func (o FileOptions) New(fd *descriptorpb.FileDescriptorProto, r Resolver) (prot
 	}
 
 	f.L2.Imports = make(filedesc.FileImports, len(fd.GetDependency()))
-	for _, i := range fd.GetPublicDependency() {
+	for j, i := range fd.GetPublicDependency() {
 		if !(0 <= i && int(i) < len(f.L2.Imports)) || f.L2.Imports[i].IsPublic {
-			return nil, errors.New("invalid or duplicate public import index: %d", i)
+			if err := v.report(filePath(genid.FileDescriptorProto_PublicDependency_field_number, int32(j)), errors.New("invalid or duplicate public import index: %d", i)); err != nil {
+				return nil, err
+			}
+			continue
 		}
 		f.L2.Imports[i].IsPublic = true
 	}
-	for _, i := range fd.GetWeakDependency() {
+	for j, i := range fd.GetWeakDependency() {
 		if !(0 <= i && int(i) < len(f.L2.Imports)) || f.L2.Imports[i].IsWeak {
-			return nil, errors.New("invalid or duplicate weak import index: %d", i)
+			if err := v.report(filePath(genid.FileDescriptorProto_WeakDependency_field_number, int32(j)), errors.New("invalid or duplicate weak import index: %d", i)); err != nil {
+				return nil, err
+			}
+			continue
 		}
 		f.L2.Imports[i].IsWeak = true
 	}
 	imps := importSet{f.Path(): true}
 	for i, path := range fd.GetDependency() {
 		imp := &f.L2.Imports[i]
+		ip := filePath(genid.FileDescriptorProto_Dependency_field_number, int32(i))
 		f, err := r.FindFileByPath(path)
 		if err == protoregistry.NotFound && (o.AllowUnresolvable || imp.IsWeak) {
 			f = filedesc.PlaceholderFile(path)
 		} else if err != nil {
-			return nil, errors.New("could not resolve import %q: %v", path, err)
+			if err := v.report(ip, errors.New("could not resolve import %q: %v", path, err)); err != nil {
+				return nil, err
+			}
+			f = filedesc.PlaceholderFile(path)
 		}
 		imp.FileDescriptor = f
 
 		if imps[imp.Path()] {
-			return nil, errors.New("already imported %q", path)
+			if err := v.report(ip, errors.New("already imported %q", path)); err != nil {
+				return nil, err
+			}
 		}
 		imps[imp.Path()] = true
 	}
@@ -144,7 +187,8 @@ func (o FileOptions) New(fd *descriptorpb.FileDescriptorProto, r Resolver) (prot
 	}
 
 	// Handle source locations.
-	for _, loc := range fd.GetSourceCodeInfo().GetLocation() {
+	f.L2.Locations.File = f
+	for i, loc := range fd.GetSourceCodeInfo().GetLocation() {
 		var l protoreflect.SourceLocation
 		// TODO: Validate that the path points to an actual declaration?
 		l.Path = protoreflect.SourcePath(loc.GetPath())
@@ -155,7 +199,11 @@ func (o FileOptions) New(fd *descriptorpb.FileDescriptorProto, r Resolver) (prot
 		case 4:
 			l.StartLine, l.StartColumn, l.EndLine, l.EndColumn = int(s[0]), int(s[1]), int(s[2]), int(s[3])
 		default:
-			return nil, errors.New("invalid span: %v", s)
+			lp := filePath(genid.FileDescriptorProto_SourceCodeInfo_field_number, int32(genid.SourceCodeInfo_Location_field_number), int32(i))
+			if err := v.report(lp, errors.New("invalid span: %v", s)); err != nil {
+				return nil, err
+			}
+			continue
 		}
 		// TODO: Validate that the span information is sensible?
 		// See https://github.com/protocolbuffers/protobuf/issues/6378.
@@ -180,42 +228,45 @@ func (o FileOptions) New(fd *descriptorpb.FileDescriptorProto, r Resolver) (prot
 	var err error
 	sb := new(strs.Builder)
 	r1 := make(descsByName)
-	if f.L1.Enums.List, err = r1.initEnumDeclarations(fd.GetEnumType(), f, sb); err != nil {
+	if f.L1.Enums.List, err = r1.initEnumDeclarations(fd.GetEnumType(), f, sb, v, filePath(genid.FileDescriptorProto_EnumType_field_number)); err != nil {
 		return nil, err
 	}
-	if f.L1.Messages.List, err = r1.initMessagesDeclarations(fd.GetMessageType(), f, sb); err != nil {
+	if f.L1.Messages.List, err = r1.initMessagesDeclarations(fd.GetMessageType(), f, sb, v, filePath(genid.FileDescriptorProto_MessageType_field_number)); err != nil {
 		return nil, err
 	}
-	if f.L1.Extensions.List, err = r1.initExtensionDeclarations(fd.GetExtension(), f, sb); err != nil {
+	if f.L1.Extensions.List, err = r1.initExtensionDeclarations(fd.GetExtension(), f, sb, v, filePath(genid.FileDescriptorProto_Extension_field_number)); err != nil {
 		return nil, err
 	}
-	if f.L1.Services.List, err = r1.initServiceDeclarations(fd.GetService(), f, sb); err != nil {
+	if f.L1.Services.List, err = r1.initServiceDeclarations(fd.GetService(), f, sb, v, filePath(genid.FileDescriptorProto_Service_field_number)); err != nil {
 		return nil, err
 	}
 
 	// Step 2: Resolve every dependency reference not handled by step 1.
-	r2 := &resolver{local: r1, remote: r, imports: imps, allowUnresolvable: o.AllowUnresolvable}
-	if err := r2.resolveMessageDependencies(f.L1.Messages.List, fd.GetMessageType()); err != nil {
+	r2 := &resolver{local: r1, remote: r, imports: imps, v: v, allowUnresolvable: o.AllowUnresolvable}
+	if err := r2.resolveMessageDependencies(f.L1.Messages.List, fd.GetMessageType(), filePath(genid.FileDescriptorProto_MessageType_field_number)); err != nil {
 		return nil, err
 	}
-	if err := r2.resolveExtensionDependencies(f.L1.Extensions.List, fd.GetExtension()); err != nil {
+	if err := r2.resolveExtensionDependencies(f.L1.Extensions.List, fd.GetExtension(), filePath(genid.FileDescriptorProto_Extension_field_number)); err != nil {
 		return nil, err
 	}
-	if err := r2.resolveServiceDependencies(f.L1.Services.List, fd.GetService()); err != nil {
+	if err := r2.resolveServiceDependencies(f.L1.Services.List, fd.GetService(), filePath(genid.FileDescriptorProto_Service_field_number)); err != nil {
 		return nil, err
 	}
 
 	// Step 3: Validate every enum, message, and extension declaration.
-	if err := validateEnumDeclarations(f.L1.Enums.List, fd.GetEnumType()); err != nil {
+	if err := validateEnumDeclarations(f.L1.Enums.List, fd.GetEnumType(), v, filePath(genid.FileDescriptorProto_EnumType_field_number)); err != nil {
 		return nil, err
 	}
-	if err := validateMessageDeclarations(f.L1.Messages.List, fd.GetMessageType()); err != nil {
+	if err := validateMessageDeclarations(f.L1.Messages.List, fd.GetMessageType(), v, filePath(genid.FileDescriptorProto_MessageType_field_number)); err != nil {
 		return nil, err
 	}
-	if err := validateExtensionDeclarations(f.L1.Extensions.List, fd.GetExtension()); err != nil {
+	if err := validateExtensionDeclarations(f.L1.Extensions.List, fd.GetExtension(), v, filePath(genid.FileDescriptorProto_Extension_field_number)); err != nil {
 		return nil, err
 	}
 
+	if len(v.errs) > 0 {
+		return nil, v.errs
+	}
 	return f, nil
 }
 
@@ -0,0 +1,75 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protodesc
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ValidationError is a problem with a declaration in a FileDescriptorProto.
+type ValidationError struct {
+	// File is the path of the file with the problem.
+	File string
+
+	// Path identifies the declaration with the problem in the
+	// FileDescriptorProto, in the same form as the path of a
+	// google.protobuf.SourceCodeInfo.Location. It is empty for
+	// problems with the file itself.
+	Path protoreflect.SourcePath
+
+	// Err describes the problem.
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors is the list of problems found in a FileDescriptorProto
+// when FileOptions.ReportAllErrors is set. The problems are listed in the
+// order in which they were found.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	switch len(e) {
+	case 0:
+		return "no errors"
+	case 1:
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d other errors)", e[0], len(e)-1)
+}
+
+// validator records the problems found while constructing a file descriptor.
+type validator struct {
+	file string
+	all  bool // whether to continue after the first problem
+	errs ValidationErrors
+}
+
+// report records err, if non-nil, as a problem with the declaration at path p.
+// It returns err if construction must stop, and nil if it may continue.
+func (v *validator) report(p protoreflect.SourcePath, err error) error {
+	if err == nil {
+		return nil
+	}
+	v.errs = append(v.errs, &ValidationError{File: v.file, Path: p, Err: err})
+	if v.all {
+		return nil
+	}
+	return err
+}
+
+// appendPath returns a copy of p followed by the elements e.
+func appendPath(p protoreflect.SourcePath, e ...int32) protoreflect.SourcePath {
+	return append(append(protoreflect.SourcePath(nil), p...), e...)
+}
@@ -5,8 +5,10 @@
 package protodesc
 
 import (
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/internal/errors"
 	"google.golang.org/protobuf/internal/filedesc"
+	"google.golang.org/protobuf/internal/genid"
 	"google.golang.org/protobuf/internal/strs"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
@@ -14,15 +16,21 @@ import (
 	"google.golang.org/protobuf/types/descriptorpb"
 )
 
+// descsByName maps the full names of the declarations in a file to their
+// descriptors. Its init methods report problems to v, where p is the path of
+// the list of declarations within the FileDescriptorProto.
 type descsByName map[protoreflect.FullName]protoreflect.Descriptor
 
-func (r descsByName) initEnumDeclarations(eds []*descriptorpb.EnumDescriptorProto, parent protoreflect.Descriptor, sb *strs.Builder) (es []filedesc.Enum, err error) {
+func (r descsByName) initEnumDeclarations(eds []*descriptorpb.EnumDescriptorProto, parent protoreflect.Descriptor, sb *strs.Builder, v *validator, p protoreflect.SourcePath) (es []filedesc.Enum, err error) {
 	es = make([]filedesc.Enum, len(eds)) // allocate up-front to ensure stable pointers
 	for i, ed := range eds {
 		e := &es[i]
 		e.L2 = new(filedesc.EnumL2)
+		ep := appendPath(p, int32(i))
 		if e.L0, err = r.makeBase(e, parent, ed.GetName(), i, sb); err != nil {
-			return nil, err
+			if err := v.report(ep, err); err != nil {
+				return nil, err
+			}
 		}
 		if opts := ed.GetOptions(); opts != nil {
 			opts = proto.Clone(opts).(*descriptorpb.EnumOptions)
@@ -37,36 +45,41 @@ func (r descsByName) initEnumDeclarations(eds []*descriptorpb.EnumDescriptorProt
 				protoreflect.EnumNumber(rr.GetEnd()),
 			})
 		}
-		if e.L2.Values.List, err = r.initEnumValuesFromDescriptorProto(ed.GetValue(), e, sb); err != nil {
+		if e.L2.Values.List, err = r.initEnumValuesFromDescriptorProto(ed.GetValue(), e, sb, v, appendPath(ep, int32(genid.EnumDescriptorProto_Value_field_number))); err != nil {
 			return nil, err
 		}
 	}
 	return es, nil
 }
 
-func (r descsByName) initEnumValuesFromDescriptorProto(vds []*descriptorpb.EnumValueDescriptorProto, parent protoreflect.Descriptor, sb *strs.Builder) (vs []filedesc.EnumValue, err error) {
+func (r descsByName) initEnumValuesFromDescriptorProto(vds []*descriptorpb.EnumValueDescriptorProto, parent protoreflect.Descriptor, sb *strs.Builder, v *validator, p protoreflect.SourcePath) (vs []filedesc.EnumValue, err error) {
 	vs = make([]filedesc.EnumValue, len(vds)) // allocate up-front to ensure stable pointers
 	for i, vd := range vds {
-		v := &vs[i]
-		if v.L0, err = r.makeBase(v, parent, vd.GetName(), i, sb); err != nil {
-			return nil, err
+		ev := &vs[i]
+		if ev.L0, err = r.makeBase(ev, parent, vd.GetName(), i, sb); err != nil {
+			if err := v.report(appendPath(p, int32(i)), err); err != nil {
+				return nil, err
+			}
 		}
 		if opts := vd.GetOptions(); opts != nil {
 			opts = proto.Clone(opts).(*descriptorpb.EnumValueOptions)
-			v.L1.Options = func() protoreflect.ProtoMessage { return opts }
+			ev.L1.Options = func() protoreflect.ProtoMessage { return opts }
 		}
-		v.L1.Number = protoreflect.EnumNumber(vd.GetNumber())
+		ev.L1.Number = protoreflect.EnumNumber(vd.GetNumber())
 	}
 	return vs, nil
 }
 
-func (r descsByName) initMessagesDeclarations(mds []*descriptorpb.DescriptorProto, parent protoreflect.Descriptor, sb *strs.Builder) (ms []filedesc.Message, err error) {
+func (r descsByName) initMessagesDeclarations(mds []*descriptorpb.DescriptorProto, parent protoreflect.Descriptor, sb *strs.Builder, v *validator, p protoreflect.SourcePath) (ms []filedesc.Message, err error) {
 	ms = make([]filedesc.Message, len(mds)) // allocate up-front to ensure stable pointers
 	for i, md := range mds {
 		m := &ms[i]
 		m.L2 = new(filedesc.MessageL2)
+		mp := appendPath(p, int32(i))
 		if m.L0, err = r.makeBase(m, parent, md.GetName(), i, sb); err != nil {
-			return nil, err
+			if err := v.report(mp, err); err != nil {
+				return nil, err
+			}
 		}
 		if opts := md.GetOptions(); opts != nil {
 			opts = proto.Clone(opts).(*descriptorpb.MessageOptions)
@@ -95,31 +108,33 @@ func (r descsByName) initMessagesDeclarations(mds []*descriptorpb.DescriptorProt
 			}
 			m.L2.ExtensionRangeOptions = append(m.L2.ExtensionRangeOptions, optsFunc)
 		}
-		if m.L2.Fields.List, err = r.initFieldsFromDescriptorProto(md.GetField(), m, sb); err != nil {
+		if m.L2.Fields.List, err = r.initFieldsFromDescriptorProto(md.GetField(), m, sb, v, appendPath(mp, int32(genid.DescriptorProto_Field_field_number))); err != nil {
 			return nil, err
 		}
-		if m.L2.Oneofs.List, err = r.initOneofsFromDescriptorProto(md.GetOneofDecl(), m, sb); err != nil {
+		if m.L2.Oneofs.List, err = r.initOneofsFromDescriptorProto(md.GetOneofDecl(), m, sb, v, appendPath(mp, int32(genid.DescriptorProto_OneofDecl_field_number))); err != nil {
 			return nil, err
 		}
-		if m.L1.Enums.List, err = r.initEnumDeclarations(md.GetEnumType(), m, sb); err != nil {
+		if m.L1.Enums.List, err = r.initEnumDeclarations(md.GetEnumType(), m, sb, v, appendPath(mp, int32(genid.DescriptorProto_EnumType_field_number))); err != nil {
 			return nil, err
 		}
-		if m.L1.Messages.List, err = r.initMessagesDeclarations(md.GetNestedType(), m, sb); err != nil {
+		if m.L1.Messages.List, err = r.initMessagesDeclarations(md.GetNestedType(), m, sb, v, appendPath(mp, int32(genid.DescriptorProto_NestedType_field_number))); err != nil {
 			return nil, err
 		}
-		if m.L1.Extensions.List, err = r.initExtensionDeclarations(md.GetExtension(), m, sb); err != nil {
+		if m.L1.Extensions.List, err = r.initExtensionDeclarations(md.GetExtension(), m, sb, v, appendPath(mp, int32(genid.DescriptorProto_Extension_field_number))); err != nil {
 			return nil, err
 		}
 	}
 	return ms, nil
 }
 
-func (r descsByName) initFieldsFromDescriptorProto(fds []*descriptorpb.FieldDescriptorProto, parent protoreflect.Descriptor, sb *strs.Builder) (fs []filedesc.Field, err error) {
+func (r descsByName) initFieldsFromDescriptorProto(fds []*descriptorpb.FieldDescriptorProto, parent protoreflect.Descriptor, sb *strs.Builder, v *validator, p protoreflect.SourcePath) (fs []filedesc.Field, err error) {
 	fs = make([]filedesc.Field, len(fds)) // allocate up-front to ensure stable pointers
 	for i, fd := range fds {
 		f := &fs[i]
 		if f.L0, err = r.makeBase(f, parent, fd.GetName(), i, sb); err != nil {
-			return nil, err
+			if err := v.report(appendPath(p, int32(i)), err); err != nil {
+				return nil, err
+			}
 		}
 		f.L1.IsProto3Optional = fd.GetProto3Optional()
 		if opts := fd.GetOptions(); opts != nil {
@@ -128,6 +143,7 @@ func (r descsByName) initFieldsFromDescriptorProto(fds []*descriptorpb.FieldDesc
 			f.L1.IsWeak = opts.GetWeak()
 			f.L1.HasPacked = opts.Packed != nil
 			f.L1.IsPacked = opts.GetPacked()
+			f.L1.IsRedacted = isRedacted(opts)
 		}
 		f.L1.Number = protoreflect.FieldNumber(fd.GetNumber())
 		f.L1.Cardinality = protoreflect.Cardinality(fd.GetLabel())
@@ -141,12 +157,14 @@ func (r descsByName) initFieldsFromDescriptorProto(fds []*descriptorpb.FieldDesc
 	return fs, nil
 }
 
-func (r descsByName) initOneofsFromDescriptorProto(ods []*descriptorpb.OneofDescriptorProto, parent protoreflect.Descriptor, sb *strs.Builder) (os []filedesc.Oneof, err error) {
+func (r descsByName) initOneofsFromDescriptorProto(ods []*descriptorpb.OneofDescriptorProto, parent protoreflect.Descriptor, sb *strs.Builder, v *validator, p protoreflect.SourcePath) (os []filedesc.Oneof, err error) {
 	os = make([]filedesc.Oneof, len(ods)) // allocate up-front to ensure stable pointers
 	for i, od := range ods {
 		o := &os[i]
 		if o.L0, err = r.makeBase(o, parent, od.GetName(), i, sb); err != nil {
-			return nil, err
+			if err := v.report(appendPath(p, int32(i)), err); err != nil {
+				return nil, err
+			}
 		}
 		if opts := od.GetOptions(); opts != nil {
 			opts = proto.Clone(opts).(*descriptorpb.OneofOptions)
@@ -156,18 +174,21 @@ func (r descsByName) initOneofsFromDescriptorProto(ods []*descriptorpb.OneofDesc
 	return os, nil
 }
 
-func (r descsByName) initExtensionDeclarations(xds []*descriptorpb.FieldDescriptorProto, parent protoreflect.Descriptor, sb *strs.Builder) (xs []filedesc.Extension, err error) {
+func (r descsByName) initExtensionDeclarations(xds []*descriptorpb.FieldDescriptorProto, parent protoreflect.Descriptor, sb *strs.Builder, v *validator, p protoreflect.SourcePath) (xs []filedesc.Extension, err error) {
 	xs = make([]filedesc.Extension, len(xds)) // allocate up-front to ensure stable pointers
 	for i, xd := range xds {
 		x := &xs[i]
 		x.L2 = new(filedesc.ExtensionL2)
 		if x.L0, err = r.makeBase(x, parent, xd.GetName(), i, sb); err != nil {
-			return nil, err
+			if err := v.report(appendPath(p, int32(i)), err); err != nil {
+				return nil, err
+			}
 		}
 		if opts := xd.GetOptions(); opts != nil {
 			opts = proto.Clone(opts).(*descriptorpb.FieldOptions)
 			x.L2.Options = func() protoreflect.ProtoMessage { return opts }
 			x.L2.IsPacked = opts.GetPacked()
+			x.L2.IsRedacted = isRedacted(opts)
 		}
 		x.L1.Number = protoreflect.FieldNumber(xd.GetNumber())
 		x.L1.Cardinality = protoreflect.Cardinality(xd.GetLabel())
@@ -181,31 +202,36 @@ func (r descsByName) initExtensionDeclarations(xds []*descriptorpb.FieldDescript
 	return xs, nil
 }
 
-func (r descsByName) initServiceDeclarations(sds []*descriptorpb.ServiceDescriptorProto, parent protoreflect.Descriptor, sb *strs.Builder) (ss []filedesc.Service, err error) {
+func (r descsByName) initServiceDeclarations(sds []*descriptorpb.ServiceDescriptorProto, parent protoreflect.Descriptor, sb *strs.Builder, v *validator, p protoreflect.SourcePath) (ss []filedesc.Service, err error) {
 	ss = make([]filedesc.Service, len(sds)) // allocate up-front to ensure stable pointers
 	for i, sd := range sds {
 		s := &ss[i]
 		s.L2 = new(filedesc.ServiceL2)
+		sp := appendPath(p, int32(i))
 		if s.L0, err = r.makeBase(s, parent, sd.GetName(), i, sb); err != nil {
-			return nil, err
+			if err := v.report(sp, err); err != nil {
+				return nil, err
+			}
 		}
 		if opts := sd.GetOptions(); opts != nil {
 			opts = proto.Clone(opts).(*descriptorpb.ServiceOptions)
 			s.L2.Options = func() protoreflect.ProtoMessage { return opts }
 		}
-		if s.L2.Methods.List, err = r.initMethodsFromDescriptorProto(sd.GetMethod(), s, sb); err != nil {
+		if s.L2.Methods.List, err = r.initMethodsFromDescriptorProto(sd.GetMethod(), s, sb, v, appendPath(sp, int32(genid.ServiceDescriptorProto_Method_field_number))); err != nil {
 			return nil, err
 		}
 	}
 	return ss, nil
 }
 
-func (r descsByName) initMethodsFromDescriptorProto(mds []*descriptorpb.MethodDescriptorProto, parent protoreflect.Descriptor, sb *strs.Builder) (ms []filedesc.Method, err error) {
+func (r descsByName) initMethodsFromDescriptorProto(mds []*descriptorpb.MethodDescriptorProto, parent protoreflect.Descriptor, sb *strs.Builder, v *validator, p protoreflect.SourcePath) (ms []filedesc.Method, err error) {
 	ms = make([]filedesc.Method, len(mds)) // allocate up-front to ensure stable pointers
 	for i, md := range mds {
 		m := &ms[i]
 		if m.L0, err = r.makeBase(m, parent, md.GetName(), i, sb); err != nil {
-			return nil, err
+			if err := v.report(appendPath(p, int32(i)), err); err != nil {
+				return nil, err
+			}
 		}
 		if opts := md.GetOptions(); opts != nil {
 			opts = proto.Clone(opts).(*descriptorpb.MethodOptions)
@@ -217,9 +243,12 @@ func (r descsByName) initMethodsFromDescriptorProto(mds []*descriptorpb.MethodDe
 	return ms, nil
 }
 
+// makeBase returns the base of the declaration child. The base is populated
+// even if an error is reported, so that later problems may still be found.
 func (r descsByName) makeBase(child, parent protoreflect.Descriptor, name string, idx int, sb *strs.Builder) (filedesc.BaseL0, error) {
+	var err error
 	if !protoreflect.Name(name).IsValid() {
-		return filedesc.BaseL0{}, errors.New("descriptor %q has an invalid nested name: %q", parent.FullName(), name)
+		err = errors.New("descriptor %q has an invalid nested name: %q", parent.FullName(), name)
 	}
 
 	// Derive the full name of the child.
@@ -230,10 +259,11 @@ func (r descsByName) makeBase(child, parent protoreflect.Descriptor, name string
 	} else {
 		fullName = sb.AppendFullName(parent.FullName(), protoreflect.Name(name))
 	}
-	if _, ok := r[fullName]; ok {
-		return filedesc.BaseL0{}, errors.New("descriptor %q already declared", fullName)
+	if _, ok := r[fullName]; ok && err == nil {
+		err = errors.New("descriptor %q already declared", fullName)
+	} else if !ok {
+		r[fullName] = child
 	}
-	r[fullName] = child
 
 	// TODO: Verify that the full name does not already exist in the resolver?
 	// This is not as critical since most usages of NewFile will register
@@ -244,5 +274,24 @@ func (r descsByName) makeBase(child, parent protoreflect.Descriptor, name string
 		ParentFile: parent.ParentFile().(*filedesc.File),
 		Parent:     parent,
 		Index:      idx,
-	}, nil
+	}, err
+}
+
+// isRedacted reports whether the debug_redact option is set.
+// The option is not known to descriptorpb and is read from the unknown fields.
+func isRedacted(opts *descriptorpb.FieldOptions) (redacted bool) {
+	b := opts.ProtoReflect().GetUnknown()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeField(b)
+		if n < 0 {
+			break
+		}
+		if num == genid.FieldOptions_DebugRedact_field_number && typ == protowire.VarintType {
+			_, _, m := protowire.ConsumeTag(b)
+			v, _ := protowire.ConsumeVarint(b[m:])
+			redacted = protowire.DecodeBool(v)
+		}
+		b = b[n:]
+	}
+	return redacted
 }
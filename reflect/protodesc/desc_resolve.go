@@ -8,6 +8,7 @@ import (
 	"google.golang.org/protobuf/internal/encoding/defval"
 	"google.golang.org/protobuf/internal/errors"
 	"google.golang.org/protobuf/internal/filedesc"
+	"google.golang.org/protobuf/internal/genid"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
 
@@ -17,92 +18,144 @@ import (
 // resolver is a wrapper around a local registry of declarations within the file
 // and the remote resolver. The remote resolver is restricted to only return
 // descriptors that have been imported.
+//
+// The resolve methods report problems to v, where p is the path of the list of
+// declarations within the FileDescriptorProto. A reference that cannot be
+// resolved is replaced by a placeholder so that validation may continue.
 type resolver struct {
 	local   descsByName
 	remote  Resolver
 	imports importSet
+	v       *validator
 
 	allowUnresolvable bool
 }
 
-func (r *resolver) resolveMessageDependencies(ms []filedesc.Message, mds []*descriptorpb.DescriptorProto) (err error) {
+func (r *resolver) resolveMessageDependencies(ms []filedesc.Message, mds []*descriptorpb.DescriptorProto, p protoreflect.SourcePath) (err error) {
 	for i, md := range mds {
 		m := &ms[i]
+		mp := appendPath(p, int32(i))
 		for j, fd := range md.GetField() {
 			f := &m.L2.Fields.List[j]
+			fp := appendPath(mp, int32(genid.DescriptorProto_Field_field_number), int32(j))
 			if f.L1.Cardinality == protoreflect.Required {
 				m.L2.RequiredNumbers.List = append(m.L2.RequiredNumbers.List, f.L1.Number)
 			}
 			if fd.OneofIndex != nil {
 				k := int(fd.GetOneofIndex())
 				if !(0 <= k && k < len(md.GetOneofDecl())) {
-					return errors.New("message field %q has an invalid oneof index: %d", f.FullName(), k)
+					if err := r.v.report(fp, errors.New("message field %q has an invalid oneof index: %d", f.FullName(), k)); err != nil {
+						return err
+					}
+				} else {
+					o := &m.L2.Oneofs.List[k]
+					f.L1.ContainingOneof = o
+					o.L1.Fields.List = append(o.L1.Fields.List, f)
 				}
-				o := &m.L2.Oneofs.List[k]
-				f.L1.ContainingOneof = o
-				o.L1.Fields.List = append(o.L1.Fields.List, f)
 			}
 
-			if f.L1.Kind, f.L1.Enum, f.L1.Message, err = r.findTarget(f.Kind(), f.Parent().FullName(), partialName(fd.GetTypeName()), f.IsWeak()); err != nil {
-				return errors.New("message field %q cannot resolve type: %v", f.FullName(), err)
+			ref := partialName(fd.GetTypeName())
+			if f.L1.Kind, f.L1.Enum, f.L1.Message, err = r.findTarget(f.Kind(), f.Parent().FullName(), ref, f.IsWeak()); err != nil {
+				if err := r.v.report(fp, errors.New("message field %q cannot resolve type: %v", f.FullName(), err)); err != nil {
+					return err
+				}
+				f.L1.Kind, f.L1.Enum, f.L1.Message = placeholderTarget(protoreflect.Kind(fd.GetType()), ref)
 			}
 			if fd.DefaultValue != nil {
 				v, ev, err := unmarshalDefault(fd.GetDefaultValue(), f, r.allowUnresolvable)
 				if err != nil {
-					return errors.New("message field %q has invalid default: %v", f.FullName(), err)
+					if err := r.v.report(fp, errors.New("message field %q has invalid default: %v", f.FullName(), err)); err != nil {
+						return err
+					}
+				} else {
+					f.L1.Default = filedesc.DefaultValue(v, ev)
 				}
-				f.L1.Default = filedesc.DefaultValue(v, ev)
 			}
 		}
 
-		if err := r.resolveMessageDependencies(m.L1.Messages.List, md.GetNestedType()); err != nil {
+		if err := r.resolveMessageDependencies(m.L1.Messages.List, md.GetNestedType(), appendPath(mp, int32(genid.DescriptorProto_NestedType_field_number))); err != nil {
 			return err
 		}
-		if err := r.resolveExtensionDependencies(m.L1.Extensions.List, md.GetExtension()); err != nil {
+		if err := r.resolveExtensionDependencies(m.L1.Extensions.List, md.GetExtension(), appendPath(mp, int32(genid.DescriptorProto_Extension_field_number))); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (r *resolver) resolveExtensionDependencies(xs []filedesc.Extension, xds []*descriptorpb.FieldDescriptorProto) (err error) {
+func (r *resolver) resolveExtensionDependencies(xs []filedesc.Extension, xds []*descriptorpb.FieldDescriptorProto, p protoreflect.SourcePath) (err error) {
 	for i, xd := range xds {
 		x := &xs[i]
-		if x.L1.Extendee, err = r.findMessageDescriptor(x.Parent().FullName(), partialName(xd.GetExtendee()), false); err != nil {
-			return errors.New("extension field %q cannot resolve extendee: %v", x.FullName(), err)
+		xp := appendPath(p, int32(i))
+		extendee := partialName(xd.GetExtendee())
+		if x.L1.Extendee, err = r.findMessageDescriptor(x.Parent().FullName(), extendee, false); err != nil {
+			if err := r.v.report(xp, errors.New("extension field %q cannot resolve extendee: %v", x.FullName(), err)); err != nil {
+				return err
+			}
+			x.L1.Extendee = filedesc.PlaceholderMessage(extendee.FullName())
 		}
-		if x.L1.Kind, x.L2.Enum, x.L2.Message, err = r.findTarget(x.Kind(), x.Parent().FullName(), partialName(xd.GetTypeName()), false); err != nil {
-			return errors.New("extension field %q cannot resolve type: %v", x.FullName(), err)
+		ref := partialName(xd.GetTypeName())
+		if x.L1.Kind, x.L2.Enum, x.L2.Message, err = r.findTarget(x.Kind(), x.Parent().FullName(), ref, false); err != nil {
+			if err := r.v.report(xp, errors.New("extension field %q cannot resolve type: %v", x.FullName(), err)); err != nil {
+				return err
+			}
+			x.L1.Kind, x.L2.Enum, x.L2.Message = placeholderTarget(protoreflect.Kind(xd.GetType()), ref)
 		}
 		if xd.DefaultValue != nil {
 			v, ev, err := unmarshalDefault(xd.GetDefaultValue(), x, r.allowUnresolvable)
 			if err != nil {
-				return errors.New("extension field %q has invalid default: %v", x.FullName(), err)
+				if err := r.v.report(xp, errors.New("extension field %q has invalid default: %v", x.FullName(), err)); err != nil {
+					return err
+				}
+			} else {
+				x.L2.Default = filedesc.DefaultValue(v, ev)
 			}
-			x.L2.Default = filedesc.DefaultValue(v, ev)
 		}
 	}
 	return nil
 }
 
-func (r *resolver) resolveServiceDependencies(ss []filedesc.Service, sds []*descriptorpb.ServiceDescriptorProto) (err error) {
+func (r *resolver) resolveServiceDependencies(ss []filedesc.Service, sds []*descriptorpb.ServiceDescriptorProto, p protoreflect.SourcePath) (err error) {
 	for i, sd := range sds {
 		s := &ss[i]
 		for j, md := range sd.GetMethod() {
 			m := &s.L2.Methods.List[j]
-			m.L1.Input, err = r.findMessageDescriptor(m.Parent().FullName(), partialName(md.GetInputType()), false)
+			mp := appendPath(p, int32(i), int32(genid.ServiceDescriptorProto_Method_field_number), int32(j))
+			input := partialName(md.GetInputType())
+			m.L1.Input, err = r.findMessageDescriptor(m.Parent().FullName(), input, false)
 			if err != nil {
-				return errors.New("service method %q cannot resolve input: %v", m.FullName(), err)
+				if err := r.v.report(mp, errors.New("service method %q cannot resolve input: %v", m.FullName(), err)); err != nil {
+					return err
+				}
+				m.L1.Input = filedesc.PlaceholderMessage(input.FullName())
 			}
-			m.L1.Output, err = r.findMessageDescriptor(s.FullName(), partialName(md.GetOutputType()), false)
+			output := partialName(md.GetOutputType())
+			m.L1.Output, err = r.findMessageDescriptor(s.FullName(), output, false)
 			if err != nil {
-				return errors.New("service method %q cannot resolve output: %v", m.FullName(), err)
+				if err := r.v.report(mp, errors.New("service method %q cannot resolve output: %v", m.FullName(), err)); err != nil {
+					return err
+				}
+				m.L1.Output = filedesc.PlaceholderMessage(output.FullName())
 			}
 		}
 	}
 	return nil
 }
 
+// placeholderTarget returns the placeholder target of a field of kind k
+// whose type name ref could not be resolved.
+func placeholderTarget(k protoreflect.Kind, ref partialName) (protoreflect.Kind, protoreflect.EnumDescriptor, protoreflect.MessageDescriptor) {
+	switch k {
+	case protoreflect.EnumKind:
+		return k, filedesc.PlaceholderEnum(ref.FullName()), nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return k, nil, filedesc.PlaceholderMessage(ref.FullName())
+	case 0:
+		return k, filedesc.PlaceholderEnum(ref.FullName()), filedesc.PlaceholderMessage(ref.FullName())
+	}
+	return k, nil, nil
+}
+
 // findTarget finds an enum or message descriptor if k is an enum, message,
 // group, or unknown. If unknown, and the name could be resolved, the kind
 // returned kind is set based on the type of the resolved descriptor.
@@ -0,0 +1,69 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protodesc
+
+import (
+	"google.golang.org/protobuf/internal/descdiff"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ChangeKind is the kind of a Change.
+type ChangeKind = descdiff.Kind
+
+const (
+	// Added is the kind of a declaration present only in the new descriptor.
+	Added = descdiff.Added
+	// Removed is the kind of a declaration present only in the old descriptor.
+	Removed = descdiff.Removed
+	// Changed is the kind of a declaration present in both descriptors
+	// whose properties differ.
+	Changed = descdiff.Changed
+)
+
+// Change is a difference between an old and a new version of a schema,
+// as reported by DiffFiles and DiffMessages.
+type Change = descdiff.Change
+
+// EqualFiles reports whether two file descriptors declare the same schema,
+// which is whether DiffFiles reports no changes.
+func EqualFiles(x, y protoreflect.FileDescriptor) bool {
+	return len(DiffFiles(x, y)) == 0
+}
+
+// EqualMessages reports whether two message descriptors declare the same
+// message, which is whether DiffMessages reports no changes.
+func EqualMessages(x, y protoreflect.MessageDescriptor) bool {
+	return len(DiffMessages(x, y)) == 0
+}
+
+// DiffFiles returns the differences between the old file descriptor x and
+// the new file descriptor y. Declarations are matched by full name,
+// except that fields are matched by field number and enum values by name.
+// Source locations and the file path are not compared.
+//
+// The changes of a declaration are reported before those of its children,
+// in the order of declaration in x, followed by the declarations added in y.
+func DiffFiles(x, y protoreflect.FileDescriptor) []Change {
+	return diffOptions.Files(x, y)
+}
+
+// DiffMessages returns the differences between the old message descriptor x
+// and the new message descriptor y, including their nested declarations.
+// The full names of x and y are not compared. See DiffFiles for details.
+func DiffMessages(x, y protoreflect.MessageDescriptor) []Change {
+	return diffOptions.Messages(x, y)
+}
+
+var diffOptions = descdiff.Options{EqualOptions: equalOptions}
+
+// equalOptions reports whether two options messages are equal.
+// Unset and empty options are equal.
+func equalOptions(x, y protoreflect.ProtoMessage) bool {
+	if proto.Size(x) == 0 && proto.Size(y) == 0 {
+		return true
+	}
+	return proto.Equal(x, y)
+}
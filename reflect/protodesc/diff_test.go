@@ -0,0 +1,79 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protodesc
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestDiffFiles(t *testing.T) {
+	build := func(v2 bool) protoreflect.FileDescriptor {
+		b := NewFileBuilder("test/diff.proto", "test.diff").Syntax(protoreflect.Proto2)
+		m := b.AddMessage("Message")
+		m.AddField("same", 1, protoreflect.StringKind)
+		m.AddEnum("Enum").AddValue("ZERO", 0).AddValue("ONE", 1)
+		if v2 {
+			m.AddField("kind", 2, protoreflect.Int64Kind).Repeated()
+			m.AddField("new_name", 3, protoreflect.Int32Kind).Default("7")
+			m.AddField("added", 5, protoreflect.BoolKind)
+		} else {
+			m.AddField("kind", 2, protoreflect.Int32Kind)
+			m.AddField("renamed", 3, protoreflect.Int32Kind)
+			m.AddField("removed", 4, protoreflect.BoolKind)
+		}
+		e := b.AddEnum("Status").AddValue("UNKNOWN", 0)
+		if v2 {
+			e.AddValue("DONE", 2)
+			b.AddMessage("Added")
+		} else {
+			e.AddValue("DONE", 1)
+			b.AddMessage("Removed")
+		}
+		fd, err := b.Build(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fd
+	}
+	x, y := build(false), build(true)
+
+	var got []string
+	for _, c := range DiffFiles(x, y) {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"changed test.diff.DONE: number changed from 1 to 2",
+		"changed test.diff.Message.kind: kind changed from int32 to int64",
+		"changed test.diff.Message.kind: cardinality changed from optional to repeated",
+		"changed test.diff.Message.kind: presence changed from true to false",
+		"changed test.diff.Message.new_name: name changed from renamed to new_name",
+		`changed test.diff.Message.new_name: JSON name changed from "renamed" to "newName"`,
+		"changed test.diff.Message.new_name: default changed from none to 7",
+		"removed test.diff.Message.removed",
+		"added test.diff.Message.added",
+		"removed test.diff.Removed",
+		"added test.diff.Added",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("DiffFiles:\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if !EqualFiles(x, build(false)) {
+		t.Errorf("EqualFiles of identical files = false, want true")
+	}
+	if EqualFiles(x, y) {
+		t.Errorf("EqualFiles of different files = true, want false")
+	}
+	mx, my := x.Messages().ByName("Message"), y.Messages().ByName("Message")
+	if EqualMessages(mx, my) || !EqualMessages(mx, build(false).Messages().ByName("Message")) {
+		t.Errorf("EqualMessages does not match DiffMessages")
+	}
+	if got := len(DiffMessages(mx, my)); got != 8 {
+		t.Errorf("DiffMessages reported %d changes, want 8", got)
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protodesc
+
+import "google.golang.org/protobuf/reflect/protoreflect"
+
+// ExtensionsByMessage returns the extensions declared in fd that extend the
+// given message, including extensions declared within messages, in order of
+// declaration. For the extensions declared across a set of files, see
+// protoregistry.Files.RangeExtensionsByMessage.
+func ExtensionsByMessage(fd protoreflect.FileDescriptor, message protoreflect.FullName) []protoreflect.ExtensionDescriptor {
+	var out []protoreflect.ExtensionDescriptor
+	var walk func(protoreflect.MessageDescriptors, protoreflect.ExtensionDescriptors)
+	walk = func(mds protoreflect.MessageDescriptors, xds protoreflect.ExtensionDescriptors) {
+		for i := 0; i < xds.Len(); i++ {
+			if xd := xds.Get(i); xd.ContainingMessage().FullName() == message {
+				out = append(out, xd)
+			}
+		}
+		for i := 0; i < mds.Len(); i++ {
+			walk(mds.Get(i).Messages(), mds.Get(i).Extensions())
+		}
+	}
+	walk(fd.Messages(), fd.Extensions())
+	return out
+}
@@ -103,6 +103,10 @@ func TestNewFile(t *testing.T) {
 		label:   "invalid syntax",
 		inDesc:  mustParseFile(`name:"weird" syntax:"proto9"`),
 		wantErr: `invalid syntax: "proto9"`,
+	}, {
+		label:   "editions syntax",
+		inDesc:  mustParseFile(`name:"weird" syntax:"editions"`),
+		wantErr: `editions are not supported`,
 	}, {
 		label:   "bad package",
 		inDesc:  mustParseFile(`name:"weird" package:"$"`),
@@ -994,3 +998,127 @@ func TestNewFilesImportCycle(t *testing.T) {
 		t.Fatal("NewFiles with import cycle: success, want error")
 	}
 }
+
+func TestSourceLocations(t *testing.T) {
+	fd, err := NewFile(mustParseFile(`
+		syntax:  "proto2"
+		name:    "source.proto"
+		package: "test"
+		message_type: [{
+			name:        "Message"
+			field:       [{name:"a" number:1 label:LABEL_OPTIONAL type:TYPE_INT32 oneof_index:0}]
+			nested_type: [{name:"Nested" field:[{name:"b" number:1 label:LABEL_OPTIONAL type:TYPE_INT32}]}]
+			oneof_decl:  [{name:"o"}]
+			extension_range: [{start:1000 end:2000}]
+		}]
+		enum_type: [{name:"Enum" value:[{name:"ZERO" number:0}]}]
+		extension: [{name:"x" number:1000 label:LABEL_OPTIONAL type:TYPE_INT32 extendee:".test.Message"}]
+		service: [{name:"Service" method:[{name:"Method" input_type:".test.Message" output_type:".test.Message"}]}]
+		source_code_info: {location: [
+			{path:[4,0] span:[1,0,5,1] leading_comments:"message"},
+			{path:[4,0,2,0] span:[2,2,20] leading_comments:"a"},
+			{path:[4,0,3,0,2,0] span:[3,2,20] leading_comments:"b"},
+			{path:[4,0,8,0] span:[4,2,20] leading_comments:"o"},
+			{path:[5,0,2,0] span:[6,2,20] leading_comments:"zero"},
+			{path:[7,0] span:[7,0,20] leading_comments:"x"},
+			{path:[6,0,2,0] span:[8,2,20] leading_comments:"method"},
+			{path:[4,0,2,0] span:[9,2,20] leading_comments:"a again"}
+		]}
+	`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := fd.Messages().ByName("Message")
+	locs := fd.SourceLocations()
+	for _, tt := range []struct {
+		d    protoreflect.Descriptor
+		want string
+	}{
+		{md, "message"},
+		{md.Fields().ByName("a"), "a"},
+		{md.Messages().ByName("Nested").Fields().ByName("b"), "b"},
+		{md.Oneofs().ByName("o"), "o"},
+		{fd.Enums().ByName("Enum").Values().ByName("ZERO"), "zero"},
+		{fd.Extensions().ByName("x"), "x"},
+		{fd.Services().ByName("Service").Methods().ByName("Method"), "method"},
+		{fd.Services().ByName("Service"), ""},
+		{md.Messages().ByName("Nested"), ""},
+		{proto2Enum.ProtoReflect().Descriptor(), ""},
+	} {
+		if got := locs.ByDescriptor(tt.d).LeadingComments; got != tt.want {
+			t.Errorf("ByDescriptor(%v).LeadingComments = %q, want %q", tt.d.FullName(), got, tt.want)
+		}
+	}
+
+	loc := locs.ByPath(protoreflect.SourcePath{4, 0, 2, 0})
+	if loc.LeadingComments != "a" || loc.Next != 7 {
+		t.Errorf("ByPath(4,0,2,0) = %q with Next %d, want %q with Next 7", loc.LeadingComments, loc.Next, "a")
+	}
+	if got := locs.Get(loc.Next); got.LeadingComments != "a again" || got.Next != 0 {
+		t.Errorf("Get(%d) = %q with Next %d, want %q with Next 0", loc.Next, got.LeadingComments, got.Next, "a again")
+	}
+	if got := locs.ByPath(protoreflect.SourcePath{4, 1}); got.Path != nil {
+		t.Errorf("ByPath of a missing path = %v, want the zero value", got.Path)
+	}
+}
+
+func TestNewFileReportAllErrors(t *testing.T) {
+	fd := mustParseFile(`
+		syntax:  "proto3"
+		name:    "errors.proto"
+		package: "test"
+		dependency: "missing.proto"
+		message_type: [{
+			name: "M"
+			field: [
+				{name:"a" number:1 label:LABEL_REQUIRED type:TYPE_INT32},
+				{name:"b" number:2 label:LABEL_OPTIONAL type:TYPE_MESSAGE type_name:".test.Missing"},
+				{name:"c" number:0 label:LABEL_OPTIONAL type:TYPE_INT32}
+			]
+			nested_type: [{name:"N" field:[{name:"x.y" number:1 label:LABEL_OPTIONAL type:TYPE_INT32}]}]
+		}]
+		enum_type: [{name:"E" value:[{name:"E_ONE" number:1}]}]
+		service: [{name:"S" method:[{name:"Do" input_type:".test.M" output_type:".test.Gone"}]}]
+	`)
+	type problem struct {
+		path protoreflect.SourcePath
+		err  string
+	}
+	want := []problem{
+		{protoreflect.SourcePath{3, 0}, `could not resolve import "missing.proto"`},
+		{protoreflect.SourcePath{4, 0, 3, 0, 2, 0}, `invalid nested name: "x.y"`},
+		{protoreflect.SourcePath{4, 0, 2, 1}, `message field "test.M.b" cannot resolve type`},
+		{protoreflect.SourcePath{6, 0, 2, 0}, `service method "test.S.Do" cannot resolve output`},
+		{protoreflect.SourcePath{5, 0}, `using proto3 semantics must have zero number for the first value`},
+		{protoreflect.SourcePath{4, 0, 2, 0}, `message field "test.M.a" using proto3 semantics cannot be required`},
+		{protoreflect.SourcePath{4, 0, 2, 2}, `message field "test.M.c" has an invalid number`},
+	}
+
+	_, err := FileOptions{ReportAllErrors: true}.New(fd, nil)
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("New error = %v (%T), want ValidationErrors", err, err)
+	}
+	var got []problem
+	for _, e := range errs {
+		if e.File != "errors.proto" {
+			t.Errorf("error %v reported for file %q, want errors.proto", e, e.File)
+		}
+		got = append(got, problem{e.Path, e.Error()})
+	}
+	if len(got) != len(want) {
+		t.Fatalf("New reported %d errors, want %d:\n%v", len(got), len(want), err)
+	}
+	for i := range want {
+		if fmt.Sprint(got[i].path) != fmt.Sprint(want[i].path) || !strings.Contains(got[i].err, want[i].err) {
+			t.Errorf("error %d = %v at %v, want %q at %v", i, got[i].err, got[i].path, want[i].err, want[i].path)
+		}
+	}
+
+	// Without ReportAllErrors, only the first problem is reported.
+	if _, err := NewFile(fd, nil); err == nil || !strings.Contains(err.Error(), want[0].err) {
+		t.Errorf("NewFile error = %v, want %q", err, want[0].err)
+	} else if _, ok := err.(ValidationErrors); ok {
+		t.Errorf("NewFile returned ValidationErrors without ReportAllErrors")
+	}
+}
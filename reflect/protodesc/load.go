@@ -0,0 +1,117 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protodesc
+
+import (
+	"google.golang.org/protobuf/internal/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// LoadFileDescriptorSets registers the files in the serialized
+// FileDescriptorSet messages with r. See FileOptions.LoadFileDescriptorSets
+// for more information.
+func LoadFileDescriptorSets(r *protoregistry.Files, sets ...[]byte) ([]protoreflect.FileDescriptor, error) {
+	return FileOptions{}.LoadFileDescriptorSets(r, sets...)
+}
+
+// LoadFileDescriptorSets registers the files in the serialized
+// FileDescriptorSet messages with r, such as the output of
+// "protoc --include_imports --descriptor_set_out".
+// It returns the top-level files: those that no other file in the sets
+// imports, in the order they first appear.
+//
+// The files may appear in any order, with each file registered after the
+// files it imports. A file that appears in more than one set must have the
+// same contents in each. A file already registered with r is not created
+// again; the registered file is used in its place, even if its contents
+// differ from those in the sets. Imports that are in neither the sets nor r
+// are resolved as by New.
+//
+// If an error occurs, the files registered before the error remain
+// registered with r.
+func (o FileOptions) LoadFileDescriptorSets(r *protoregistry.Files, sets ...[]byte) ([]protoreflect.FileDescriptor, error) {
+	l := &loader{
+		o:        o,
+		r:        r,
+		files:    make(map[string]*descriptorpb.FileDescriptorProto),
+		visiting: make(map[string]bool),
+	}
+	var order []string
+	for _, b := range sets {
+		fds := new(descriptorpb.FileDescriptorSet)
+		if err := proto.Unmarshal(b, fds); err != nil {
+			return nil, errors.Wrap(err, "invalid FileDescriptorSet")
+		}
+		for _, fd := range fds.File {
+			if prev, ok := l.files[fd.GetName()]; ok {
+				if !proto.Equal(prev, fd) {
+					return nil, errors.New("file appears multiple times with different contents: %q", fd.GetName())
+				}
+				continue
+			}
+			l.files[fd.GetName()] = fd
+			order = append(order, fd.GetName())
+		}
+	}
+
+	imported := make(map[string]bool)
+	for _, fd := range l.files {
+		for _, dep := range fd.Dependency {
+			imported[dep] = true
+		}
+	}
+	var top []protoreflect.FileDescriptor
+	for _, path := range order {
+		f, err := l.load(path)
+		if err != nil {
+			return nil, err
+		}
+		if !imported[path] {
+			top = append(top, f)
+		}
+	}
+	return top, nil
+}
+
+type loader struct {
+	o        FileOptions
+	r        *protoregistry.Files
+	files    map[string]*descriptorpb.FileDescriptorProto
+	visiting map[string]bool // files whose imports are being loaded
+}
+
+// load registers the file at path from the sets, after the files it imports,
+// unless it is already registered.
+func (l *loader) load(path string) (protoreflect.FileDescriptor, error) {
+	if f, err := l.r.FindFileByPath(path); err == nil {
+		return f, nil
+	}
+	if l.visiting[path] {
+		return nil, errors.New("import cycle in file: %q", path)
+	}
+	fd := l.files[path]
+	l.visiting[path] = true
+	for _, dep := range fd.Dependency {
+		if _, ok := l.files[dep]; !ok {
+			continue
+		}
+		if _, err := l.load(dep); err != nil {
+			return nil, err
+		}
+	}
+	delete(l.visiting, path)
+	f, err := l.o.New(fd, l.r)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.r.RegisterFile(f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
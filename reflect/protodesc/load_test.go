@@ -0,0 +1,118 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protodesc
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func mustMarshalSet(t *testing.T, fds ...*descriptorpb.FileDescriptorProto) []byte {
+	b, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: fds})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestLoadFileDescriptorSets(t *testing.T) {
+	descFile := ToFileDescriptorProto(descriptorpb.File_google_protobuf_descriptor_proto)
+	c := mustParseFile(`name:"c.proto" package:"c" message_type:[{name:"C"}]`)
+	b := mustParseFile(`
+		name:"b.proto" package:"b" dependency:"c.proto"
+		message_type:[{name:"B" field:[{name:"c" number:1 label:LABEL_OPTIONAL type_name:".c.C"}]}]
+	`)
+	a := mustParseFile(`
+		name:"a.proto" package:"a" dependency:["b.proto", "google/protobuf/descriptor.proto"]
+		message_type:[{name:"A" field:[
+			{name:"b" number:1 label:LABEL_OPTIONAL type_name:".b.B"},
+			{name:"d" number:2 label:LABEL_OPTIONAL type_name:".google.protobuf.DescriptorProto"}
+		]}]
+	`)
+	z := mustParseFile(`name:"z.proto" package:"z" dependency:"c.proto"`)
+
+	r := new(protoregistry.Files)
+	if err := r.RegisterFile(descriptorpb.File_google_protobuf_descriptor_proto); err != nil {
+		t.Fatal(err)
+	}
+	// The files are out of order, and b.proto is in both sets.
+	top, err := LoadFileDescriptorSets(r,
+		mustMarshalSet(t, a, b, descFile),
+		mustMarshalSet(t, z, c, b),
+	)
+	if err != nil {
+		t.Fatalf("LoadFileDescriptorSets() error: %v", err)
+	}
+	var got []string
+	for _, f := range top {
+		got = append(got, f.Path())
+	}
+	if want := []string{"a.proto", "z.proto"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("top-level files = %v, want %v", got, want)
+	}
+	if r.NumFiles() != 5 {
+		t.Errorf("NumFiles() = %d, want 5", r.NumFiles())
+	}
+	if f, _ := r.FindFileByPath("google/protobuf/descriptor.proto"); f != descriptorpb.File_google_protobuf_descriptor_proto {
+		t.Errorf("registered descriptor.proto was replaced")
+	}
+	d, err := r.FindDescriptorByName("a.A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.(protoreflect.MessageDescriptor).Fields().ByName("d").Message(); got != descriptorpb.File_google_protobuf_descriptor_proto.Messages().ByName("DescriptorProto") {
+		t.Errorf("field a.A.d resolved to %v, want the registered google.protobuf.DescriptorProto", got)
+	}
+
+	// Loading the same files again returns the registered files.
+	again, err := LoadFileDescriptorSets(r, mustMarshalSet(t, a, b, c))
+	if err != nil {
+		t.Fatalf("LoadFileDescriptorSets() error: %v", err)
+	}
+	if len(again) != 1 || again[0] != top[0] {
+		t.Errorf("reloading a.proto returned %v, want the registered file", again)
+	}
+}
+
+func TestLoadFileDescriptorSetsErrors(t *testing.T) {
+	a := mustParseFile(`name:"a.proto" package:"a" dependency:"b.proto"`)
+	b := mustParseFile(`name:"b.proto" package:"b" dependency:"a.proto"`)
+	b2 := mustParseFile(`name:"b.proto" package:"other"`)
+	tests := []struct {
+		name string
+		sets [][]byte
+		want string
+	}{{
+		name: "invalid set",
+		sets: [][]byte{{0xff}},
+		want: "invalid FileDescriptorSet",
+	}, {
+		name: "import cycle",
+		sets: [][]byte{mustMarshalSet(t, a, b)},
+		want: `import cycle in file: "a.proto"`,
+	}, {
+		name: "conflicting contents",
+		sets: [][]byte{mustMarshalSet(t, b2), mustMarshalSet(t, b)},
+		want: `file appears multiple times with different contents: "b.proto"`,
+	}, {
+		name: "unresolvable import",
+		sets: [][]byte{mustMarshalSet(t, a)},
+		want: `could not resolve import "b.proto"`,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadFileDescriptorSets(new(protoregistry.Files), tt.sets...)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadFileDescriptorSets() error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protodesc
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// The functions in this file read commonly used options of a descriptor
+// without asserting the type of protoreflect.Descriptor.Options.
+// The json_name and packed options are already reflected by the
+// HasJSONName, JSONName, and IsPacked methods of protoreflect.FieldDescriptor.
+
+// IsDeprecated reports whether d is marked with the deprecated option.
+// A descriptor whose options have no deprecated field, such as a oneof,
+// is never deprecated.
+func IsDeprecated(d protoreflect.Descriptor) bool {
+	v, _ := boolOption(d, "deprecated")
+	return v
+}
+
+// IsMessageSetWireFormat reports whether md is marked with the
+// message_set_wire_format option.
+func IsMessageSetWireFormat(md protoreflect.MessageDescriptor) bool {
+	v, _ := boolOption(md, "message_set_wire_format")
+	return v
+}
+
+// PackedOption returns the value of the packed option of fd and whether it
+// is explicitly set. Unlike fd.IsPacked, it does not apply the default of
+// the syntax of the file.
+func PackedOption(fd protoreflect.FieldDescriptor) (packed, ok bool) {
+	return boolOption(fd, "packed")
+}
+
+// HasOption reports whether the custom option xt is set on d.
+// It returns false if xt does not extend the options message of d.
+func HasOption(d protoreflect.Descriptor, xt protoreflect.ExtensionType) bool {
+	return proto.HasExtension(d.Options(), xt)
+}
+
+// GetOption returns the value of the custom option xt of d, which is the
+// default value if the option is unset. It panics if xt does not extend the
+// options message of d.
+func GetOption(d protoreflect.Descriptor, xt protoreflect.ExtensionType) interface{} {
+	opts := d.Options()
+	if opts == nil || opts.ProtoReflect().Descriptor() != xt.TypeDescriptor().ContainingMessage() {
+		panic("extension " + string(xt.TypeDescriptor().FullName()) + " does not extend the options of " + string(d.FullName()))
+	}
+	return proto.GetExtension(opts, xt)
+}
+
+// boolOption returns the value of the bool field name of the options of d
+// and whether it is set.
+func boolOption(d protoreflect.Descriptor, name protoreflect.Name) (v, ok bool) {
+	opts := d.Options()
+	if opts == nil {
+		return false, false
+	}
+	m := opts.ProtoReflect()
+	fd := m.Descriptor().Fields().ByName(name)
+	if fd == nil || fd.Kind() != protoreflect.BoolKind || !m.Has(fd) {
+		return false, false
+	}
+	return m.Get(fd).Bool(), true
+}
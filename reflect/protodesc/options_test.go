@@ -0,0 +1,91 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protodesc
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"google.golang.org/protobuf/internal/testprotos/messageset/messagesetpb"
+	test3pb "google.golang.org/protobuf/internal/testprotos/test3"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestOptions(t *testing.T) {
+	msgOpts := &descriptorpb.MessageOptions{Deprecated: proto.Bool(true)}
+	proto.SetExtension(msgOpts, test3pb.E_OptionalString, "custom")
+
+	b := NewFileBuilder("test/options.proto", "test.options").Syntax(protoreflect.Proto2)
+	m := b.AddMessage("Message").Options(msgOpts)
+	m.AddField("packed", 1, protoreflect.Int32Kind).Repeated().Packed(true)
+	m.AddField("unpacked", 2, protoreflect.Int32Kind).Repeated().Packed(false)
+	m.AddField("plain", 3, protoreflect.Int32Kind).Repeated()
+	m.AddField("old", 4, protoreflect.Int32Kind).Options(&descriptorpb.FieldOptions{Deprecated: proto.Bool(true)})
+	m.AddOneof("choice").AddField("a", 5, protoreflect.Int32Kind)
+	b.AddEnum("Enum").AddValue("ZERO", 0)
+	fd, err := b.Build(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := fd.Messages().ByName("Message")
+	fds := md.Fields()
+
+	for _, tt := range []struct {
+		d    protoreflect.Descriptor
+		want bool
+	}{
+		{fd, false},
+		{md, true},
+		{fds.ByName("old"), true},
+		{fds.ByName("plain"), false},
+		{md.Oneofs().ByName("choice"), false},
+		{fd.Enums().ByName("Enum"), false},
+	} {
+		if got := IsDeprecated(tt.d); got != tt.want {
+			t.Errorf("IsDeprecated(%v) = %v, want %v", tt.d.FullName(), got, tt.want)
+		}
+	}
+
+	if !IsMessageSetWireFormat((*messagesetpb.MessageSet)(nil).ProtoReflect().Descriptor()) || IsMessageSetWireFormat(md) {
+		t.Errorf("IsMessageSetWireFormat does not match the option")
+	}
+
+	for _, tt := range []struct {
+		name     protoreflect.Name
+		packed   bool
+		explicit bool
+	}{
+		{"packed", true, true},
+		{"unpacked", false, true},
+		{"plain", false, false},
+	} {
+		if packed, ok := PackedOption(fds.ByName(tt.name)); packed != tt.packed || ok != tt.explicit {
+			t.Errorf("PackedOption(%v) = %v, %v; want %v, %v", tt.name, packed, ok, tt.packed, tt.explicit)
+		}
+	}
+
+	if !HasOption(md, test3pb.E_OptionalString) || HasOption(md, test3pb.E_OptionalInt32) {
+		t.Errorf("HasOption does not match the options of %v", md.FullName())
+	}
+	if HasOption(fds.ByName("old"), test3pb.E_OptionalString) {
+		t.Errorf("HasOption for an option of another descriptor kind = true, want false")
+	}
+	if got := GetOption(md, test3pb.E_OptionalString); got != "custom" {
+		t.Errorf("GetOption(optional_string) = %v, want custom", got)
+	}
+	if got := GetOption(md, test3pb.E_OptionalInt32); got != int32(0) {
+		t.Errorf("GetOption(optional_int32) = %v, want 0", got)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("GetOption with an option of another descriptor kind did not panic")
+			}
+		}()
+		GetOption(fds.ByName("old"), test3pb.E_OptionalString)
+	}()
+}
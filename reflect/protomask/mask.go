@@ -0,0 +1,244 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package protomask provides operations on messages restricted to a set of
+// field paths, as described by the google.protobuf.FieldMask message.
+//
+// A field path is a sequence of field names separated by dots
+// (e.g., "foo.bar.baz"), where every name except the last must refer to
+// a singular message field. A path that ends at a message field covers
+// that field and all of its sub-fields.
+package protomask
+
+import (
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/internal/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Mask is a set of field paths validated against a particular message
+// descriptor. The zero value is not usable; create one with New.
+// A Mask is immutable and safe for concurrent use.
+type Mask struct {
+	desc protoreflect.MessageDescriptor
+	root *node
+}
+
+// node is a single message level of a mask.
+// A nil node covers every field at that level and all levels below it.
+type node struct {
+	fields map[protoreflect.FieldNumber]*node
+}
+
+// New parses the field paths relative to md and returns a Mask covering them.
+// It reports an error if any path does not name a field in md, or if a
+// non-terminal path component names a repeated or non-message field.
+//
+// Redundant paths are permitted; a path covered by a shorter path is ignored.
+func New(md protoreflect.MessageDescriptor, paths ...string) (*Mask, error) {
+	root := &node{fields: make(map[protoreflect.FieldNumber]*node)}
+	for _, path := range paths {
+		if err := root.insert(md, path); err != nil {
+			return nil, err
+		}
+	}
+	return &Mask{desc: md, root: root}, nil
+}
+
+func (n *node) insert(md protoreflect.MessageDescriptor, path string) error {
+	if path == "" {
+		return errors.New("invalid empty field path for %v", md.FullName())
+	}
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		fd := md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			return errors.New("invalid field path %q: %v has no field named %q", path, md.FullName(), name)
+		}
+		last := i == len(names)-1
+		if !last && (fd.IsList() || fd.IsMap() || fd.Message() == nil) {
+			return errors.New("invalid field path %q: %v is not a singular message field", path, fd.FullName())
+		}
+		child, ok := n.fields[fd.Number()]
+		switch {
+		case ok && child == nil:
+			// A shorter path already covers this field entirely.
+			return nil
+		case last:
+			n.fields[fd.Number()] = nil
+			return nil
+		case !ok:
+			child = &node{fields: make(map[protoreflect.FieldNumber]*node)}
+			n.fields[fd.Number()] = child
+		}
+		n, md = child, fd.Message()
+	}
+	return nil
+}
+
+// Descriptor returns the message descriptor the mask was created for.
+func (m *Mask) Descriptor() protoreflect.MessageDescriptor {
+	return m.desc
+}
+
+// Paths returns the field paths covered by the mask in normalized form:
+// sorted, and with paths covered by another path removed.
+func (m *Mask) Paths() []string {
+	var paths []string
+	m.root.appendPaths(&paths, m.desc, "")
+	sort.Strings(paths)
+	return paths
+}
+
+func (n *node) appendPaths(paths *[]string, md protoreflect.MessageDescriptor, prefix string) {
+	for num, child := range n.fields {
+		fd := md.Fields().ByNumber(num)
+		path := prefix + string(fd.Name())
+		if child == nil {
+			*paths = append(*paths, path)
+			continue
+		}
+		child.appendPaths(paths, fd.Message(), path+".")
+	}
+}
+
+// Covers reports whether the field path is covered by the mask.
+// A path is covered if it, or any prefix of it, is in the mask.
+// Path components are not checked against the descriptor.
+func (m *Mask) Covers(path string) bool {
+	n, md := m.root, m.desc
+	for _, name := range strings.Split(path, ".") {
+		if n == nil {
+			return true
+		}
+		if md == nil {
+			return false
+		}
+		fd := md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			return false
+		}
+		child, ok := n.fields[fd.Number()]
+		if !ok {
+			return false
+		}
+		n, md = child, fd.Message()
+	}
+	return n == nil
+}
+
+// Prune clears every field of msg that is not covered by the mask,
+// recursively descending into sub-messages that are partially covered.
+// Unknown fields are cleared at every level that is pruned.
+//
+// It panics if msg does not have the descriptor the mask was created for.
+func (m *Mask) Prune(msg proto.Message) {
+	mr := msg.ProtoReflect()
+	m.checkDescriptor(mr)
+	if !mr.IsValid() {
+		return
+	}
+	m.root.prune(mr)
+}
+
+func (n *node) prune(m protoreflect.Message) {
+	var clear, descend []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		child, ok := n.fields[fd.Number()]
+		switch {
+		case !ok:
+			clear = append(clear, fd)
+		case child != nil:
+			descend = append(descend, fd)
+		}
+		return true
+	})
+	for _, fd := range clear {
+		m.Clear(fd)
+	}
+	for _, fd := range descend {
+		n.fields[fd.Number()].prune(m.Mutable(fd).Message())
+	}
+	if len(m.GetUnknown()) > 0 {
+		m.SetUnknown(nil)
+	}
+}
+
+// Merge merges the fields of src that are covered by the mask into dst,
+// which must both have the descriptor the mask was created for.
+//
+// Covered fields are merged with the same semantics as proto.Merge:
+// populated scalars replace the destination value, messages are merged
+// recursively, list elements are appended, and map entries are copied.
+// Covered fields that are not populated in src leave dst unchanged.
+// Unknown fields are not merged.
+func (m *Mask) Merge(dst, src proto.Message) {
+	dstMsg, srcMsg := dst.ProtoReflect(), src.ProtoReflect()
+	m.checkDescriptor(dstMsg)
+	m.checkDescriptor(srcMsg)
+	m.root.merge(dstMsg, srcMsg)
+}
+
+func (n *node) merge(dst, src protoreflect.Message) {
+	for num, child := range n.fields {
+		fd := src.Descriptor().Fields().ByNumber(num)
+		if !src.Has(fd) {
+			continue
+		}
+		switch {
+		case child != nil:
+			child.merge(dst.Mutable(fd).Message(), src.Get(fd).Message())
+		case fd.IsList():
+			dstList, srcList := dst.Mutable(fd).List(), src.Get(fd).List()
+			for i := 0; i < srcList.Len(); i++ {
+				dstList.Append(cloneValue(fd, srcList.Get(i), dstList.NewElement))
+			}
+		case fd.IsMap():
+			dstMap, srcMap := dst.Mutable(fd).Map(), src.Get(fd).Map()
+			srcMap.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				dstMap.Set(k, cloneValue(fd.MapValue(), v, dstMap.NewValue))
+				return true
+			})
+		case fd.Message() != nil:
+			proto.Merge(dst.Mutable(fd).Message().Interface(), src.Get(fd).Message().Interface())
+		default:
+			dst.Set(fd, cloneValue(fd, src.Get(fd), nil))
+		}
+	}
+}
+
+// cloneValue returns a deep copy of a singular value v of field fd.
+// The newMessage function is used to allocate a destination message value.
+func cloneValue(fd protoreflect.FieldDescriptor, v protoreflect.Value, newMessage func() protoreflect.Value) protoreflect.Value {
+	switch {
+	case fd.Message() != nil:
+		nv := newMessage()
+		proto.Merge(nv.Message().Interface(), v.Message().Interface())
+		return nv
+	case fd.Kind() == protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes(append([]byte{}, v.Bytes()...))
+	default:
+		return v
+	}
+}
+
+// Marshal returns the wire-format encoding of the fields of msg that are
+// covered by the mask. It is equivalent to marshaling a copy of msg that has
+// been pruned, but only the covered fields are copied.
+func (m *Mask) Marshal(o proto.MarshalOptions, msg proto.Message) ([]byte, error) {
+	mr := msg.ProtoReflect()
+	m.checkDescriptor(mr)
+	masked := mr.New()
+	m.root.merge(masked, mr)
+	return o.Marshal(masked.Interface())
+}
+
+func (m *Mask) checkDescriptor(mr protoreflect.Message) {
+	if got, want := mr.Descriptor().FullName(), m.desc.FullName(); got != want {
+		panic("protomask: descriptor mismatch: " + string(got) + " != " + string(want))
+	}
+}
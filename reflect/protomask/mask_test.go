@@ -0,0 +1,199 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protomask_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protomask"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	testpb "google.golang.org/protobuf/internal/testprotos/test"
+)
+
+func TestNew(t *testing.T) {
+	md := (*testpb.TestAllTypes)(nil).ProtoReflect().Descriptor()
+	for _, test := range []struct {
+		paths   []string
+		want    []string
+		wantErr bool
+	}{
+		{paths: nil, want: nil},
+		{paths: []string{"optional_int32"}, want: []string{"optional_int32"}},
+		{
+			paths: []string{"optional_nested_message.a", "optional_int32", "optional_nested_message.corecursive.optional_int32"},
+			want:  []string{"optional_int32", "optional_nested_message.a", "optional_nested_message.corecursive.optional_int32"},
+		},
+		{
+			paths: []string{"optional_nested_message.a", "optional_nested_message"},
+			want:  []string{"optional_nested_message"},
+		},
+		{
+			paths: []string{"optional_nested_message", "optional_nested_message.a"},
+			want:  []string{"optional_nested_message"},
+		},
+		{paths: []string{""}, wantErr: true},
+		{paths: []string{"no_such_field"}, wantErr: true},
+		{paths: []string{"optional_int32.a"}, wantErr: true},
+		{paths: []string{"repeated_nested_message.a"}, wantErr: true},
+		{paths: []string{"map_string_nested_message.a"}, wantErr: true},
+	} {
+		mask, err := protomask.New(md, test.paths...)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("New(%q) error = %v, want error %v", test.paths, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if diff := cmp.Diff(test.want, mask.Paths()); diff != "" {
+			t.Errorf("New(%q).Paths() mismatch (-want +got):\n%s", test.paths, diff)
+		}
+	}
+}
+
+func TestCovers(t *testing.T) {
+	md := (*testpb.TestAllTypes)(nil).ProtoReflect().Descriptor()
+	mask, err := protomask.New(md, "optional_int32", "optional_nested_message.corecursive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]bool{
+		"optional_int32":                                     true,
+		"optional_int64":                                     false,
+		"optional_nested_message":                            false,
+		"optional_nested_message.a":                          false,
+		"optional_nested_message.corecursive":                true,
+		"optional_nested_message.corecursive.optional_int64": true,
+		"optional_int32.foo":                                 true,
+		"optional_int64.foo":                                 false,
+	} {
+		if got := mask.Covers(path); got != want {
+			t.Errorf("Covers(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func newTestMessage() *testpb.TestAllTypes {
+	m := &testpb.TestAllTypes{
+		OptionalInt32:  proto.Int32(1),
+		OptionalString: proto.String("string"),
+		OptionalNestedMessage: &testpb.TestAllTypes_NestedMessage{
+			A: proto.Int32(2),
+			Corecursive: &testpb.TestAllTypes{
+				OptionalInt32: proto.Int32(3),
+				OptionalInt64: proto.Int64(4),
+			},
+		},
+		RepeatedInt32: []int32{5, 6},
+		MapStringNestedMessage: map[string]*testpb.TestAllTypes_NestedMessage{
+			"k": {A: proto.Int32(7)},
+		},
+		OneofField: &testpb.TestAllTypes_OneofUint32{8},
+	}
+	m.ProtoReflect().SetUnknown([]byte{0xf8, 0x06, 0x01})
+	return m
+}
+
+func TestPrune(t *testing.T) {
+	md := (*testpb.TestAllTypes)(nil).ProtoReflect().Descriptor()
+	mask, err := protomask.New(md,
+		"optional_int32",
+		"optional_nested_message.corecursive.optional_int64",
+		"map_string_nested_message",
+		"oneof_uint32",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := newTestMessage()
+	mask.Prune(got)
+	want := &testpb.TestAllTypes{
+		OptionalInt32: proto.Int32(1),
+		OptionalNestedMessage: &testpb.TestAllTypes_NestedMessage{
+			Corecursive: &testpb.TestAllTypes{
+				OptionalInt64: proto.Int64(4),
+			},
+		},
+		MapStringNestedMessage: map[string]*testpb.TestAllTypes_NestedMessage{
+			"k": {A: proto.Int32(7)},
+		},
+		OneofField: &testpb.TestAllTypes_OneofUint32{8},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("Prune() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	md := (*testpb.TestAllTypes)(nil).ProtoReflect().Descriptor()
+	mask, err := protomask.New(md,
+		"optional_string",
+		"optional_int64",
+		"optional_nested_message.a",
+		"repeated_int32",
+		"map_string_nested_message",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := newTestMessage()
+	dst := &testpb.TestAllTypes{
+		OptionalInt32:  proto.Int32(100),
+		OptionalString: proto.String("old"),
+		OptionalInt64:  proto.Int64(101),
+		OptionalNestedMessage: &testpb.TestAllTypes_NestedMessage{
+			A: proto.Int32(102),
+		},
+		RepeatedInt32: []int32{103},
+	}
+	mask.Merge(dst, src)
+	want := &testpb.TestAllTypes{
+		OptionalInt32:  proto.Int32(100),
+		OptionalString: proto.String("string"),
+		OptionalInt64:  proto.Int64(101),
+		OptionalNestedMessage: &testpb.TestAllTypes_NestedMessage{
+			A: proto.Int32(2),
+		},
+		RepeatedInt32: []int32{103, 5, 6},
+		MapStringNestedMessage: map[string]*testpb.TestAllTypes_NestedMessage{
+			"k": {A: proto.Int32(7)},
+		},
+	}
+	if diff := cmp.Diff(want, dst, protocmp.Transform()); diff != "" {
+		t.Errorf("Merge() mismatch (-want +got):\n%s", diff)
+	}
+	if dst.MapStringNestedMessage["k"] == src.MapStringNestedMessage["k"] {
+		t.Errorf("Merge() did not copy map value message")
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	md := (*testpb.TestAllTypes)(nil).ProtoReflect().Descriptor()
+	mask, err := protomask.New(md, "optional_int32", "optional_nested_message.corecursive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newTestMessage()
+	b, err := mask.Marshal(proto.MarshalOptions{}, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &testpb.TestAllTypes{}
+	if err := proto.Unmarshal(b, got); err != nil {
+		t.Fatal(err)
+	}
+	want := proto.Clone(m).(*testpb.TestAllTypes)
+	mask.Prune(want)
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("Marshal() mismatch (-want +got):\n%s", diff)
+	}
+	if !proto.Equal(m, newTestMessage()) {
+		t.Errorf("Marshal() modified its input")
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protopath
+
+import (
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/internal/errors"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// ParsePath parses s as a path relative to a message of the type md and
+// returns the path, which starts with a Root step for md. A path is a
+// sequence of field names separated by dots, where the name of a list field
+// may be followed by an index and the name of a map field by a key:
+//
+//	foo.bar[3].baz["key"]
+//
+// A map key is a quoted string, a decimal integer, or true or false,
+// according to the key type of the map. An extension field is named by its
+// full name in brackets, as in foo.[pkg.ext], and is resolved with
+// protoregistry.GlobalTypes. The path may be preceded by the full name of md
+// in parentheses, as produced by Path.String.
+func ParsePath(md protoreflect.MessageDescriptor, s string) (Path, error) {
+	p := Path{Root(md)}
+	in := s
+	switch {
+	case strings.HasPrefix(in, "("):
+		i := strings.IndexByte(in, ')')
+		if i < 0 || protoreflect.FullName(in[1:i]) != md.FullName() {
+			return nil, errors.New("invalid path %q: does not start with (%v)", s, md.FullName())
+		}
+		in = in[i+1:]
+	case in != "":
+		in = "." + in
+	}
+	if in == "" {
+		return nil, errors.New("invalid empty path for %v", md.FullName())
+	}
+
+	var fd protoreflect.FieldDescriptor // field of the current value, if any
+	for in != "" {
+		switch in[0] {
+		case '.':
+			if md == nil {
+				return nil, errors.New("invalid path %q: %v is not a message", s, p)
+			}
+			var err error
+			if fd, in, err = parseField(md, in[1:]); err != nil {
+				return nil, errors.New("invalid path %q: %v", s, err)
+			}
+			p = append(p, FieldAccess(fd))
+			md = nil
+			if !fd.IsList() && !fd.IsMap() {
+				md = fd.Message()
+			}
+		case '[':
+			i := indexClose(in)
+			if i < 0 {
+				return nil, errors.New("invalid path %q: unterminated index", s)
+			}
+			index := in[1:i]
+			in = in[i+1:]
+			switch {
+			case fd != nil && fd.IsList() && p.Index(-1).Kind() == FieldAccessStep:
+				n, err := strconv.ParseUint(index, 10, 31)
+				if err != nil {
+					return nil, errors.New("invalid path %q: invalid list index %s", s, index)
+				}
+				p = append(p, ListIndex(int(n)))
+				md = fd.Message()
+			case fd != nil && fd.IsMap() && p.Index(-1).Kind() == FieldAccessStep:
+				k, err := parseMapKey(fd.MapKey(), index)
+				if err != nil {
+					return nil, errors.New("invalid path %q: invalid map key %s", s, index)
+				}
+				p = append(p, MapIndex(k))
+				md = fd.MapValue().Message()
+			default:
+				return nil, errors.New("invalid path %q: %v is not a list or map", s, p)
+			}
+		default:
+			return nil, errors.New("invalid path %q: unexpected %q after %v", s, in[0], p)
+		}
+	}
+	return p, nil
+}
+
+// parseField parses the field name at the start of s, which follows a dot,
+// and returns the field of md and the rest of s.
+func parseField(md protoreflect.MessageDescriptor, s string) (protoreflect.FieldDescriptor, string, error) {
+	if strings.HasPrefix(s, "[") {
+		i := strings.IndexByte(s, ']')
+		if i < 0 {
+			return nil, "", errors.New("unterminated extension name")
+		}
+		name := protoreflect.FullName(s[1:i])
+		xt, err := protoregistry.GlobalTypes.FindExtensionByName(name)
+		if err != nil {
+			return nil, "", errors.New("unable to resolve extension %v: %v", name, err)
+		}
+		if xd := xt.TypeDescriptor(); xd.ContainingMessage().FullName() != md.FullName() {
+			return nil, "", errors.New("%v does not extend %v", name, md.FullName())
+		}
+		return xt.TypeDescriptor(), s[i+1:], nil
+	}
+	i := strings.IndexAny(s, ".[")
+	if i < 0 {
+		i = len(s)
+	}
+	name := protoreflect.Name(s[:i])
+	fd := md.Fields().ByName(name)
+	if fd == nil {
+		return nil, "", errors.New("%v has no field named %q", md.FullName(), name)
+	}
+	return fd, s[i:], nil
+}
+
+// indexClose returns the index of the bracket that closes the index at the
+// start of s, skipping over a quoted string, or -1 if there is none.
+func indexClose(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case ']':
+			return i
+		case '"', '\'':
+			q := s[i]
+			for i++; i < len(s) && s[i] != q; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// parseMapKey parses s as a key of the map field kd.
+func parseMapKey(kd protoreflect.FieldDescriptor, s string) (protoreflect.MapKey, error) {
+	var v protoreflect.Value
+	switch kd.Kind() {
+	case protoreflect.StringKind:
+		if len(s) < 2 || s[0] != s[len(s)-1] || (s[0] != '"' && s[0] != '\'') {
+			return protoreflect.MapKey{}, errors.New("unquoted string")
+		}
+		if s[0] == '\'' {
+			// strconv.Unquote only accepts single characters in single quotes.
+			s = `"` + strings.Replace(strings.Replace(s[1:len(s)-1], `\'`, `'`, -1), `"`, `\"`, -1) + `"`
+		}
+		str, err := strconv.Unquote(s)
+		if err != nil {
+			return protoreflect.MapKey{}, err
+		}
+		v = protoreflect.ValueOfString(str)
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(s)
+		if err != nil || (s != "true" && s != "false") {
+			return protoreflect.MapKey{}, errors.New("invalid bool")
+		}
+		v = protoreflect.ValueOfBool(b)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return protoreflect.MapKey{}, err
+		}
+		v = protoreflect.ValueOfInt32(int32(n))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return protoreflect.MapKey{}, err
+		}
+		v = protoreflect.ValueOfInt64(n)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return protoreflect.MapKey{}, err
+		}
+		v = protoreflect.ValueOfUint32(uint32(n))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return protoreflect.MapKey{}, err
+		}
+		v = protoreflect.ValueOfUint64(n)
+	default:
+		return protoreflect.MapKey{}, errors.New("invalid map key kind %v", kd.Kind())
+	}
+	return v.MapKey(), nil
+}
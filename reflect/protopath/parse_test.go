@@ -0,0 +1,146 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protopath_test
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protopath"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	testpb "google.golang.org/protobuf/internal/testprotos/test"
+)
+
+func TestParsePath(t *testing.T) {
+	md := (*testpb.TestAllTypes)(nil).ProtoReflect().Descriptor()
+	amd := (*testpb.TestAllExtensions)(nil).ProtoReflect().Descriptor()
+	tests := []struct {
+		md   protoreflect.MessageDescriptor
+		in   string
+		want string // empty if an error is expected
+	}{
+		{md, "optional_int32", "(goproto.proto.test.TestAllTypes).optional_int32"},
+		{md, "optional_nested_message.corecursive.repeated_int32[3]", "(goproto.proto.test.TestAllTypes).optional_nested_message.corecursive.repeated_int32[3]"},
+		{md, `map_string_nested_message["k\"ey"].a`, `(goproto.proto.test.TestAllTypes).map_string_nested_message["k\"ey"].a`},
+		{md, `map_string_string['it\'s']`, `(goproto.proto.test.TestAllTypes).map_string_string["it's"]`},
+		{md, "map_int32_int32[-5]", "(goproto.proto.test.TestAllTypes).map_int32_int32[-5]"},
+		{md, "map_uint64_uint64[18446744073709551615]", "(goproto.proto.test.TestAllTypes).map_uint64_uint64[18446744073709551615]"},
+		{md, "map_bool_bool[true]", "(goproto.proto.test.TestAllTypes).map_bool_bool[true]"},
+		{md, "(goproto.proto.test.TestAllTypes).repeated_nested_message[0].a", "(goproto.proto.test.TestAllTypes).repeated_nested_message[0].a"},
+		{amd, "[goproto.proto.test.optional_nested_message].a", "(goproto.proto.test.TestAllExtensions).[goproto.proto.test.optional_nested_message].a"},
+
+		{md, "", ""},
+		{md, "no_such_field", ""},
+		{md, "optional_int32.a", ""},
+		{md, "optional_int32[0]", ""},
+		{md, "repeated_int32[-1]", ""},
+		{md, "repeated_int32[0][0]", ""},
+		{md, "repeated_int32[0", ""},
+		{md, "map_string_string[key]", ""},
+		{md, "map_int32_int32[1<<40]", ""},
+		{md, "map_bool_bool[1]", ""},
+		{md, "(goproto.proto.test.TestAllExtensions).optional_int32", ""},
+		{md, "[goproto.proto.test.optional_int32]", ""},
+		{amd, "[goproto.proto.test.no_such_extension]", ""},
+		{md, "optional_int32 ", ""},
+	}
+	for _, tt := range tests {
+		p, err := protopath.ParsePath(tt.md, tt.in)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("ParsePath(%q) = %v, want error", tt.in, p)
+		case tt.want != "" && err != nil:
+			t.Errorf("ParsePath(%q) error: %v", tt.in, err)
+		case tt.want != "" && p.String() != tt.want:
+			t.Errorf("ParsePath(%q) = %v, want %v", tt.in, p, tt.want)
+		}
+	}
+}
+
+func TestGetSetClear(t *testing.T) {
+	m := &testpb.TestAllTypes{
+		RepeatedInt32: []int32{1, 2, 3},
+		MapStringNestedMessage: map[string]*testpb.TestAllTypes_NestedMessage{
+			"k": {A: proto.Int32(5)},
+		},
+	}
+	mr := m.ProtoReflect()
+	path := func(s string) protopath.Path {
+		p, err := protopath.ParsePath(mr.Descriptor(), s)
+		if err != nil {
+			t.Fatalf("ParsePath(%q) error: %v", s, err)
+		}
+		return p
+	}
+
+	for _, tt := range []struct {
+		path string
+		want interface{}
+	}{
+		{"repeated_int32[1]", int32(2)},
+		{`map_string_nested_message["k"].a`, int32(5)},
+		{"optional_nested_message.a", int32(0)},
+		{"optional_nested_message.corecursive.optional_int32", int32(0)},
+	} {
+		v, err := protopath.Get(mr, path(tt.path))
+		if err != nil || v.Interface() != tt.want {
+			t.Errorf("Get(%s) = %v, %v; want %v", tt.path, v, err, tt.want)
+		}
+	}
+	for _, s := range []string{"repeated_int32[3]", `map_string_nested_message["x"]`} {
+		if v, err := protopath.Get(mr, path(s)); err == nil {
+			t.Errorf("Get(%s) = %v, want error", s, v)
+		}
+	}
+	if m.OptionalNestedMessage != nil {
+		t.Errorf("Get populated optional_nested_message")
+	}
+
+	if err := protopath.Set(mr, path("optional_nested_message.corecursive.optional_int32"), protoreflect.ValueOfInt32(7)); err != nil {
+		t.Errorf("Set error: %v", err)
+	}
+	if err := protopath.Set(mr, path(`map_string_nested_message["new"].a`), protoreflect.ValueOfInt32(8)); err != nil {
+		t.Errorf("Set error: %v", err)
+	}
+	if err := protopath.Set(mr, path("repeated_int32[0]"), protoreflect.ValueOfInt32(9)); err != nil {
+		t.Errorf("Set error: %v", err)
+	}
+	if err := protopath.Set(mr, path("repeated_nested_message[0].a"), protoreflect.ValueOfInt32(1)); err == nil {
+		t.Errorf("Set of out-of-range list element: got nil error, want error")
+	}
+
+	if err := protopath.Clear(mr, path("repeated_int32[1]")); err != nil {
+		t.Errorf("Clear error: %v", err)
+	}
+	if err := protopath.Clear(mr, path(`map_string_nested_message["k"]`)); err != nil {
+		t.Errorf("Clear error: %v", err)
+	}
+	if err := protopath.Clear(mr, path("optional_foreign_message.c")); err != nil {
+		t.Errorf("Clear error: %v", err)
+	}
+	if m.OptionalForeignMessage != nil {
+		t.Errorf("Clear populated optional_foreign_message")
+	}
+
+	want := &testpb.TestAllTypes{
+		RepeatedInt32: []int32{9, 3},
+		OptionalNestedMessage: &testpb.TestAllTypes_NestedMessage{
+			Corecursive: &testpb.TestAllTypes{OptionalInt32: proto.Int32(7)},
+		},
+		MapStringNestedMessage: map[string]*testpb.TestAllTypes_NestedMessage{
+			"new": {A: proto.Int32(8)},
+		},
+	}
+	if !proto.Equal(m, want) {
+		t.Errorf("after Set and Clear:\ngot  %v\nwant %v", m, want)
+	}
+
+	other := (*testpb.TestAllExtensions)(nil).ProtoReflect().Descriptor()
+	p, _ := protopath.ParsePath(other, "[goproto.proto.test.optional_int32]")
+	if _, err := protopath.Get(mr, p); err == nil {
+		t.Errorf("Get with path for another message: got nil error, want error")
+	}
+}
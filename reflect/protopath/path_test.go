@@ -0,0 +1,77 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protopath_test
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/reflect/protopath"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	testpb "google.golang.org/protobuf/internal/testprotos/test"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestPath(t *testing.T) {
+	md := (*testpb.TestAllTypes)(nil).ProtoReflect().Descriptor()
+	fds := md.Fields()
+	nmd := (*testpb.TestAllTypes_NestedMessage)(nil).ProtoReflect().Descriptor()
+	p := protopath.Path{
+		protopath.Root(md),
+		protopath.FieldAccess(fds.ByName("repeated_nested_message")),
+		protopath.ListIndex(3),
+		protopath.FieldAccess(nmd.Fields().ByName("corecursive")),
+		protopath.FieldAccess(fds.ByName("map_string_nested_message")),
+		protopath.MapIndex(protoreflect.ValueOfString("k\"ey").MapKey()),
+		protopath.FieldAccess(nmd.Fields().ByName("corecursive")),
+		protopath.FieldAccess(fds.ByName("map_int32_int32")),
+		protopath.MapIndex(protoreflect.ValueOfInt32(-5).MapKey()),
+	}
+	want := `(goproto.proto.test.TestAllTypes).repeated_nested_message[3].corecursive.map_string_nested_message["k\"ey"].corecursive.map_int32_int32[-5]`
+	if got := p.String(); got != want {
+		t.Errorf("Path.String() = %s, want %s", got, want)
+	}
+
+	p = protopath.Path{
+		protopath.Root((*anypb.Any)(nil).ProtoReflect().Descriptor()),
+		protopath.AnyExpand(md),
+		protopath.FieldAccess(testpb.E_OptionalInt32.TypeDescriptor()),
+		protopath.UnknownAccess(),
+	}
+	want = `(google.protobuf.Any).(goproto.proto.test.TestAllTypes).[goproto.proto.test.optional_int32].?`
+	if got := p.String(); got != want {
+		t.Errorf("Path.String() = %s, want %s", got, want)
+	}
+
+	if got := p.Index(-1).Kind(); got != protopath.UnknownAccessStep {
+		t.Errorf("Index(-1).Kind() = %v, want %v", got, protopath.UnknownAccessStep)
+	}
+	if got := p.Index(1).MessageDescriptor(); got != md {
+		t.Errorf("Index(1).MessageDescriptor() = %v, want %v", got, md)
+	}
+	if got := p.Index(4).Kind(); got != 0 {
+		t.Errorf("Index(4).Kind() = %v, want invalid step", got)
+	}
+}
+
+func TestValues(t *testing.T) {
+	m := &testpb.TestAllTypes{RepeatedInt32: []int32{1, 2}}
+	mr := m.ProtoReflect()
+	fd := mr.Descriptor().Fields().ByName("repeated_int32")
+	v := protopath.Values{
+		Path:   protopath.Path{protopath.Root(mr.Descriptor()), protopath.FieldAccess(fd), protopath.ListIndex(1)},
+		Values: []protoreflect.Value{protoreflect.ValueOfMessage(mr), mr.Get(fd), protoreflect.ValueOfInt32(2)},
+	}
+	if got, want := v.String(), "(goproto.proto.test.TestAllTypes).repeated_int32[1] = 2"; got != want {
+		t.Errorf("Values.String() = %s, want %s", got, want)
+	}
+	step, val := v.Index(-2)
+	if step.FieldDescriptor() != fd || val.List().Len() != 2 {
+		t.Errorf("Index(-2) = %v, %v; want the repeated_int32 field", step, val)
+	}
+	if step, val := v.Index(3); step.Kind() != 0 || val.IsValid() {
+		t.Errorf("Index(3) = %v, %v; want zero values", step, val)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protopath
+
+import (
+	"google.golang.org/protobuf/internal/errors"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Get returns the value at the path p in m, where p starts with a Root step
+// for the type of m. An unpopulated field has its default value.
+// It reports an error if a list index is out of range or a map has no entry
+// for a key.
+func Get(m protoreflect.Message, p Path) (protoreflect.Value, error) {
+	v, last, ok, err := walk(m, p, walkGet)
+	if err != nil {
+		return protoreflect.Value{}, err
+	}
+	if ok {
+		switch last.Kind() {
+		case RootStep:
+			return v, nil
+		case FieldAccessStep:
+			return v.Message().Get(last.FieldDescriptor()), nil
+		case ListIndexStep:
+			if ls := v.List(); last.ListIndex() < ls.Len() {
+				return ls.Get(last.ListIndex()), nil
+			}
+		case MapIndexStep:
+			if mv := v.Map().Get(last.MapIndex()); mv.IsValid() {
+				return mv, nil
+			}
+		}
+	}
+	return protoreflect.Value{}, errors.New("%v: no such list element or map entry", p)
+}
+
+// Set stores v at the path p in m, where p starts with a Root step for the
+// type of m. Unpopulated messages along the path are populated. It reports an
+// error if a list index is out of range. A map entry along the path is
+// created if it does not exist.
+//
+// As with protoreflect.Message.Set, it panics if v is not of the type of the
+// value at p.
+func Set(m protoreflect.Message, p Path, v protoreflect.Value) error {
+	pv, last, _, err := walk(m, p, walkSet)
+	if err != nil {
+		return err
+	}
+	switch last.Kind() {
+	case RootStep:
+		return errors.New("%v: cannot set the root message", p)
+	case FieldAccessStep:
+		pv.Message().Set(last.FieldDescriptor(), v)
+	case ListIndexStep:
+		ls := pv.List()
+		if i := last.ListIndex(); i >= ls.Len() {
+			return errors.New("%v: list index %d out of range with length %d", p, i, ls.Len())
+		}
+		ls.Set(last.ListIndex(), v)
+	default: // MapIndexStep
+		pv.Map().Set(last.MapIndex(), v)
+	}
+	return nil
+}
+
+// Clear clears the value at the path p in m, where p starts with a Root step
+// for the type of m. A list element is removed by shifting the elements that
+// follow it. Clearing a value that is not populated is a no-op.
+func Clear(m protoreflect.Message, p Path) error {
+	pv, last, ok, err := walk(m, p, walkClear)
+	if err != nil || !ok {
+		return err
+	}
+	switch last.Kind() {
+	case RootStep:
+		return errors.New("%v: cannot clear the root message", p)
+	case FieldAccessStep:
+		pv.Message().Clear(last.FieldDescriptor())
+	case ListIndexStep:
+		ls := pv.List()
+		i := last.ListIndex()
+		if i >= ls.Len() {
+			return nil
+		}
+		for ; i < ls.Len()-1; i++ {
+			ls.Set(i, ls.Get(i+1))
+		}
+		ls.Truncate(ls.Len() - 1)
+	default: // MapIndexStep
+		pv.Map().Clear(last.MapIndex())
+	}
+	return nil
+}
+
+// walkMode is how walk treats values along a path that are not populated.
+type walkMode int
+
+const (
+	walkGet   walkMode = iota // use the default value of unpopulated fields
+	walkSet                   // populate unpopulated messages and map entries
+	walkClear                 // stop at unpopulated fields
+)
+
+// walk returns the value addressed by all but the last step of p, together
+// with the last step. It reports false if a list element or map entry along
+// the path does not exist, or if a field is not populated in walkClear mode.
+func walk(m protoreflect.Message, p Path, mode walkMode) (v protoreflect.Value, last Step, ok bool, err error) {
+	if len(p) == 0 || p[0].Kind() != RootStep {
+		return v, last, false, errors.New("path %v does not start with a root step", p)
+	}
+	if md := p[0].MessageDescriptor(); md.FullName() != m.Descriptor().FullName() {
+		return v, last, false, errors.New("path %v does not apply to message %v", p, m.Descriptor().FullName())
+	}
+	v = protoreflect.ValueOfMessage(m)
+	for i := 1; i < len(p); i++ {
+		step := p[i]
+		if err := checkStep(p[:i], step); err != nil {
+			return v, last, false, err
+		}
+		if i == len(p)-1 {
+			break
+		}
+		switch step.Kind() {
+		case FieldAccessStep:
+			fd := step.FieldDescriptor()
+			m := v.Message()
+			switch {
+			case mode == walkSet:
+				v = m.Mutable(fd)
+			case mode == walkGet || m.Has(fd):
+				v = m.Get(fd)
+			default:
+				return v, last, false, nil
+			}
+		case ListIndexStep:
+			ls := v.List()
+			j := step.ListIndex()
+			if j >= ls.Len() {
+				if mode == walkSet {
+					return v, last, false, errors.New("%v: list index %d out of range with length %d", p[:i+1], j, ls.Len())
+				}
+				return v, last, false, nil
+			}
+			v = ls.Get(j)
+		case MapIndexStep:
+			mp := v.Map()
+			switch {
+			case mode == walkSet:
+				v = mp.Mutable(step.MapIndex())
+			case mp.Has(step.MapIndex()):
+				v = mp.Get(step.MapIndex())
+			default:
+				return v, last, false, nil
+			}
+		}
+	}
+	return v, p[len(p)-1], true, nil
+}
+
+// checkStep reports an error if step cannot follow the path p.
+func checkStep(p Path, step Step) error {
+	prev := p.Index(-1)
+	// The field descriptor of the value addressed by p, if it is a field.
+	var fd protoreflect.FieldDescriptor
+	if prev.Kind() == FieldAccessStep {
+		fd = prev.FieldDescriptor()
+	}
+	// The message descriptor of the value addressed by p, if it is a message.
+	var md protoreflect.MessageDescriptor
+	switch {
+	case prev.Kind() == RootStep:
+		md = prev.MessageDescriptor()
+	case fd != nil:
+		if !fd.IsList() && !fd.IsMap() {
+			md = fd.Message()
+		}
+	case prev.Kind() == ListIndexStep:
+		md = p.Index(-2).FieldDescriptor().Message()
+	case prev.Kind() == MapIndexStep:
+		md = p.Index(-2).FieldDescriptor().MapValue().Message()
+	}
+
+	switch step.Kind() {
+	case FieldAccessStep:
+		if md == nil {
+			return errors.New("path %v: %v is not a message", append(p, step), p)
+		}
+		if step.FieldDescriptor().ContainingMessage().FullName() != md.FullName() {
+			return errors.New("path %v: %v is not a field of %v", append(p, step), step.FieldDescriptor().FullName(), md.FullName())
+		}
+		return nil
+	case ListIndexStep:
+		if fd == nil || !fd.IsList() {
+			return errors.New("path %v: %v is not a list", append(p, step), p)
+		}
+		return nil
+	case MapIndexStep:
+		if fd == nil || !fd.IsMap() {
+			return errors.New("path %v: %v is not a map", append(p, step), p)
+		}
+		return nil
+	default:
+		return errors.New("path %v: unsupported step %v", append(p, step), step)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protorange_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protopath"
+	"google.golang.org/protobuf/reflect/protorange"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	testpb "google.golang.org/protobuf/internal/testprotos/test"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func newTestMessage() *testpb.TestAllTypes {
+	m := &testpb.TestAllTypes{
+		OptionalInt32: proto.Int32(1),
+		OptionalNestedMessage: &testpb.TestAllTypes_NestedMessage{
+			A: proto.Int32(2),
+		},
+		RepeatedInt32: []int32{3, 4},
+		MapStringNestedMessage: map[string]*testpb.TestAllTypes_NestedMessage{
+			"b": {A: proto.Int32(5)},
+			"a": {},
+		},
+	}
+	m.ProtoReflect().SetUnknown(protowire.AppendVarint(protowire.AppendTag(nil, 9999, protowire.VarintType), 1))
+	return m
+}
+
+func TestRange(t *testing.T) {
+	var got []string
+	err := protorange.Options{Stable: true}.Range(newTestMessage().ProtoReflect(),
+		func(p protopath.Values) error {
+			got = append(got, "push "+p.Path[1:].String())
+			return nil
+		},
+		func(p protopath.Values) error {
+			got = append(got, "pop "+p.Path[1:].String())
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"push ",
+		"push .optional_int32",
+		"pop .optional_int32",
+		"push .optional_nested_message",
+		"push .optional_nested_message.a",
+		"pop .optional_nested_message.a",
+		"pop .optional_nested_message",
+		"push .repeated_int32",
+		"push .repeated_int32[0]",
+		"pop .repeated_int32[0]",
+		"push .repeated_int32[1]",
+		"pop .repeated_int32[1]",
+		"pop .repeated_int32",
+		"push .map_string_nested_message",
+		`push .map_string_nested_message["a"]`,
+		`pop .map_string_nested_message["a"]`,
+		`push .map_string_nested_message["b"]`,
+		`push .map_string_nested_message["b"].a`,
+		`pop .map_string_nested_message["b"].a`,
+		`pop .map_string_nested_message["b"]`,
+		"pop .map_string_nested_message",
+		"push .?",
+		"pop .?",
+		"pop ",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Range visited:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRangeBreakAndTerminate(t *testing.T) {
+	var got []string
+	err := protorange.Options{Stable: true}.Range(newTestMessage().ProtoReflect(), func(p protopath.Values) error {
+		got = append(got, p.Path[1:].String())
+		switch p.Path.Index(-1).Kind() {
+		case protopath.FieldAccessStep:
+			if p.Path.Index(-1).FieldDescriptor().IsList() {
+				return protorange.Break
+			}
+		case protopath.MapIndexStep:
+			return protorange.Terminate
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `|.optional_int32|.optional_nested_message|.optional_nested_message.a|.repeated_int32|.map_string_nested_message|.map_string_nested_message["a"]`
+	if s := strings.Join(got, "|"); s != want {
+		t.Errorf("Range visited %s, want %s", s, want)
+	}
+
+	wantErr := errors.New("failure")
+	err = protorange.Range(newTestMessage().ProtoReflect(), func(protopath.Values) error {
+		return wantErr
+	})
+	if err != wantErr {
+		t.Errorf("Range() error = %v, want %v", err, wantErr)
+	}
+}
+
+func TestRangeMutation(t *testing.T) {
+	// Clear every field named "a" when it is visited.
+	m := newTestMessage()
+	err := protorange.Range(m.ProtoReflect(), func(p protopath.Values) error {
+		step := p.Path.Index(-1)
+		if step.Kind() != protopath.FieldAccessStep {
+			return nil
+		}
+		if step.FieldDescriptor().Name() == "a" {
+			_, parent := p.Index(-2)
+			parent.Message().Clear(step.FieldDescriptor())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.OptionalNestedMessage.A != nil || m.MapStringNestedMessage["b"].A != nil {
+		t.Errorf("fields named a were not cleared: %v", m)
+	}
+}
+
+func TestRangeAny(t *testing.T) {
+	inner := &testpb.TestAllTypes{OptionalString: proto.String("inner")}
+	b, err := proto.Marshal(inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &anypb.Any{TypeUrl: "type.googleapis.com/goproto.proto.test.TestAllTypes", Value: b}
+	var got []string
+	push := func(p protopath.Values) error {
+		got = append(got, p.Path.String())
+		return nil
+	}
+	if err := protorange.Range(a.ProtoReflect(), push); err != nil {
+		t.Fatal(err)
+	}
+	want := "(google.protobuf.Any)|(google.protobuf.Any).(goproto.proto.test.TestAllTypes)|(google.protobuf.Any).(goproto.proto.test.TestAllTypes).optional_string"
+	if s := strings.Join(got, "|"); s != want {
+		t.Errorf("Range visited %s, want %s", s, want)
+	}
+
+	got = nil
+	if err := (protorange.Options{Stable: true, Resolver: (*protoregistry.Types)(nil)}).Range(a.ProtoReflect(), push, nil); err != nil {
+		t.Fatal(err)
+	}
+	want = "(google.protobuf.Any)|(google.protobuf.Any).type_url|(google.protobuf.Any).value"
+	if s := strings.Join(got, "|"); s != want {
+		t.Errorf("Range without resolver visited %s, want %s", s, want)
+	}
+}
@@ -5,6 +5,7 @@
 package protoreflect
 
 import (
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/internal/pragma"
 )
 
@@ -23,6 +24,8 @@ type (
 		Unmarshal        func(unmarshalInput) (unmarshalOutput, error)
 		Merge            func(mergeInput) mergeOutput
 		CheckInitialized func(checkInitializedInput) (checkInitializedOutput, error)
+		Validate         func(unmarshalInput) validateOutput
+		Equal            func(equalInput) equalOutput
 	}
 	supportFlags = uint64
 	sizeInput    = struct {
@@ -53,6 +56,7 @@ type (
 			FindExtensionByName(field FullName) (ExtensionType, error)
 			FindExtensionByNumber(message FullName, field FieldNumber) (ExtensionType, error)
 		}
+		UnknownFieldHandler func(MessageDescriptor, protowire.Number, protowire.Type, []byte) bool
 	}
 	unmarshalOutput = struct {
 		pragma.NoUnkeyedLiterals
@@ -67,6 +71,15 @@ type (
 		pragma.NoUnkeyedLiterals
 		Flags uint8
 	}
+	equalInput = struct {
+		pragma.NoUnkeyedLiterals
+		MessageA Message
+		MessageB Message
+	}
+	equalOutput = struct {
+		pragma.NoUnkeyedLiterals
+		Equal bool
+	}
 	checkInitializedInput = struct {
 		pragma.NoUnkeyedLiterals
 		Message Message
@@ -74,4 +87,8 @@ type (
 	checkInitializedOutput = struct {
 		pragma.NoUnkeyedLiterals
 	}
+	validateOutput = struct {
+		pragma.NoUnkeyedLiterals
+		Flags uint8
+	}
 )
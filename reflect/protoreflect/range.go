@@ -0,0 +1,51 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protoreflect
+
+import "sort"
+
+// RangeOrdered iterates over every populated field in m like Message.Range,
+// but in a deterministic order: the known fields of the message in ascending
+// order of field number, followed by the extension fields in ascending order
+// of field number. RangeOrdered returns immediately if f returns false.
+// While iterating, mutating operations may only be performed
+// on the current field descriptor.
+//
+// The populated fields are gathered before f is first called, so the order is
+// unaffected by the implementation of m. Generic serializers built on
+// reflection may use it to produce deterministic output.
+func RangeOrdered(m Message, f func(FieldDescriptor, Value) bool) {
+	type field struct {
+		fd FieldDescriptor
+		v  Value
+	}
+	var fields []field
+	sorted := true
+	m.Range(func(fd FieldDescriptor, v Value) bool {
+		if n := len(fields); n > 0 && !lessField(fields[n-1].fd, fd) {
+			sorted = false
+		}
+		fields = append(fields, field{fd, v})
+		return true
+	})
+	if !sorted {
+		sort.Slice(fields, func(i, j int) bool {
+			return lessField(fields[i].fd, fields[j].fd)
+		})
+	}
+	for _, x := range fields {
+		if !f(x.fd, x.v) {
+			return
+		}
+	}
+}
+
+// lessField reports whether field a is visited before field b by RangeOrdered.
+func lessField(a, b FieldDescriptor) bool {
+	if ea, eb := a.IsExtension(), b.IsExtension(); ea != eb {
+		return eb
+	}
+	return a.Number() < b.Number()
+}
@@ -0,0 +1,57 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protoreflect_test
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	testpb "google.golang.org/protobuf/internal/testprotos/test"
+)
+
+func TestRangeOrdered(t *testing.T) {
+	m := &testpb.TestAllExtensions{}
+	proto.SetExtension(m, testpb.E_OptionalString, "s")
+	proto.SetExtension(m, testpb.E_OptionalInt32, int32(1))
+	proto.SetExtension(m, testpb.E_RepeatedInt64, []int64{2})
+	proto.SetExtension(m, testpb.E_OptionalBool, true)
+	m2 := &testpb.TestAllTypes{
+		OneofField:     &testpb.TestAllTypes_OneofUint32{OneofUint32: 5},
+		RepeatedInt32:  []int32{1},
+		OptionalString: proto.String("x"),
+		OptionalInt32:  proto.Int32(3),
+	}
+
+	for _, m := range []proto.Message{m, m2} {
+		var nums []protoreflect.FieldNumber
+		protoreflect.RangeOrdered(m.ProtoReflect(), func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+			if !m.ProtoReflect().Has(fd) || !v.IsValid() {
+				t.Errorf("RangeOrdered passed unpopulated field %v", fd.FullName())
+			}
+			nums = append(nums, fd.Number())
+			return true
+		})
+		if len(nums) != 4 {
+			t.Errorf("RangeOrdered over %T visited %d fields, want 4", m, len(nums))
+		}
+		for i := 1; i < len(nums); i++ {
+			if nums[i-1] >= nums[i] {
+				t.Errorf("RangeOrdered over %T visited fields in order %v, want ascending", m, nums)
+				break
+			}
+		}
+	}
+
+	var n int
+	protoreflect.RangeOrdered(m2.ProtoReflect(), func(protoreflect.FieldDescriptor, protoreflect.Value) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("RangeOrdered called f %d times after it returned false, want 1", n)
+	}
+}
@@ -10,10 +10,20 @@ type SourceLocations interface {
 	Len() int
 	// Get returns the ith SourceLocation. It panics if out of bounds.
 	Get(int) SourceLocation
+	// ByPath returns the SourceLocation for the given path,
+	// returning the first location if multiple exist for the same path.
+	// If multiple locations exist for the same path,
+	// then SourceLocation.Next index can be used to identify the
+	// index of the next SourceLocation.
+	// If no location exists for this path, it returns the zero value.
+	// Lookups by path take constant time after the first.
+	ByPath(path SourcePath) SourceLocation
+	// ByDescriptor returns the SourceLocation for the given descriptor,
+	// returning the first location if multiple exist for the same path.
+	// If no location exists for this descriptor, it returns the zero value.
+	ByDescriptor(desc Descriptor) SourceLocation
 
 	doNotImplement
-
-	// TODO: Add ByPath and ByDescriptor helper methods.
 }
 
 // SourceLocation describes a source location and
@@ -39,6 +49,10 @@ type SourceLocation struct {
 	LeadingComments string
 	// TrailingComments is the trailing attached comment for the declaration.
 	TrailingComments string
+
+	// Next is an index into SourceLocations for the next source location that
+	// has the same Path. It is zero if there is no next location.
+	Next int
 }
 
 // SourcePath identifies part of a file descriptor for a source location.
@@ -84,6 +84,8 @@ type Descriptor interface {
 	//
 	// If true, only Name and FullName are valid.
 	// For FileDescriptor, the Path is also valid.
+	// A placeholder may be replaced with the real descriptor once it is
+	// registered using protoregistry.Files.ResolvePlaceholder.
 	IsPlaceholder() bool
 
 	// Options returns the descriptor options. The caller must not modify
@@ -59,6 +59,7 @@ type Message interface {
 	// Range returns immediately if f returns false.
 	// While iterating, mutating operations may only be performed
 	// on the current field descriptor.
+	// See RangeOrdered for iteration in a deterministic order.
 	Range(f func(FieldDescriptor, Value) bool)
 
 	// Has reports whether a field is populated.
@@ -174,6 +175,97 @@ func (b RawFields) IsValid() bool {
 	return true
 }
 
+// Range iterates over every field in b in order, calling f for each with the
+// field number, wire type, and value. The value is a sub-slice of b that
+// excludes the length prefix of a length-delimited field and the end marker
+// of a group. Range stops if f returns false or if the remainder of b is not
+// syntactically correct wire format.
+func (b RawFields) Range(f func(num FieldNumber, typ protowire.Type, v []byte) bool) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return
+		}
+		b = b[n:]
+		var v []byte
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.StartGroupType:
+			v, n = protowire.ConsumeGroup(num, b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n >= 0 {
+				v = b[:n]
+			}
+		}
+		if n < 0 || !f(num, typ, v) {
+			return
+		}
+		b = b[n:]
+	}
+}
+
+// Has reports whether b contains a field with the given number.
+func (b RawFields) Has(num FieldNumber) bool {
+	for len(b) > 0 {
+		n, _, m := protowire.ConsumeField(b)
+		if m < 0 {
+			return false
+		}
+		if n == num {
+			return true
+		}
+		b = b[m:]
+	}
+	return false
+}
+
+// Get returns the fields in b with the given number, in order.
+// It returns nil if there are none.
+func (b RawFields) Get(num FieldNumber) RawFields {
+	var out RawFields
+	for len(b) > 0 {
+		n, _, m := protowire.ConsumeField(b)
+		if m < 0 {
+			break
+		}
+		if n == num {
+			out = append(out, b[:m]...)
+		}
+		b = b[m:]
+	}
+	return out
+}
+
+// Delete returns a copy of b with all fields with the given numbers removed.
+// The input is not modified. The remainder of b that is not syntactically
+// correct wire format, if any, is retained as is.
+func (b RawFields) Delete(nums ...FieldNumber) RawFields {
+	out := make(RawFields, 0, len(b))
+	for len(b) > 0 {
+		n, _, m := protowire.ConsumeField(b)
+		if m < 0 {
+			out = append(out, b...)
+			break
+		}
+		if !containsFieldNumber(nums, n) {
+			out = append(out, b[:m]...)
+		}
+		b = b[m:]
+	}
+	return out
+}
+
+func containsFieldNumber(nums []FieldNumber, num FieldNumber) bool {
+	for _, n := range nums {
+		if n == num {
+			return true
+		}
+	}
+	return false
+}
+
 // List is a zero-indexed, ordered list.
 // The element Value type is determined by FieldDescriptor.Kind.
 // Providing a Value that is invalid or of an incorrect type panics.
@@ -9,6 +9,8 @@ import (
 	"math"
 	"reflect"
 	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
 )
 
 func TestValue(t *testing.T) {
@@ -145,3 +147,61 @@ func BenchmarkValue(b *testing.B) {
 
 	_, _, _ = sink1, sink2, sink3
 }
+
+func TestRawFields(t *testing.T) {
+	var b RawFields
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, 100)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, "hello")
+	b = protowire.AppendTag(b, 3, protowire.StartGroupType)
+	b = protowire.AppendTag(b, 1, protowire.Fixed32Type)
+	b = protowire.AppendFixed32(b, 5)
+	b = protowire.AppendTag(b, 3, protowire.EndGroupType)
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, 200)
+
+	type field struct {
+		num FieldNumber
+		typ protowire.Type
+		v   string
+	}
+	var got []field
+	b.Range(func(num FieldNumber, typ protowire.Type, v []byte) bool {
+		got = append(got, field{num, typ, string(v)})
+		return true
+	})
+	want := []field{
+		{1, protowire.VarintType, string(protowire.AppendVarint(nil, 100))},
+		{2, protowire.BytesType, "hello"},
+		{3, protowire.StartGroupType, string(protowire.AppendFixed32(protowire.AppendTag(nil, 1, protowire.Fixed32Type), 5))},
+		{1, protowire.VarintType, string(protowire.AppendVarint(nil, 200))},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Range:\ngot:  %v\nwant: %v", got, want)
+	}
+
+	if !b.Has(3) || b.Has(4) {
+		t.Errorf("Has(3), Has(4) = %v, %v; want true, false", b.Has(3), b.Has(4))
+	}
+
+	wantOnes := append(protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 100),
+		protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 200)...)
+	if got := b.Get(1); !bytes.Equal(got, wantOnes) {
+		t.Errorf("Get(1) = %x, want %x", got, wantOnes)
+	}
+	if got := b.Get(4); got != nil {
+		t.Errorf("Get(4) = %x, want nil", got)
+	}
+
+	orig := append(RawFields(nil), b...)
+	if got := b.Delete(2, 3); !bytes.Equal(got, wantOnes) {
+		t.Errorf("Delete(2, 3) = %x, want %x", got, wantOnes)
+	}
+	if !bytes.Equal(b, orig) {
+		t.Errorf("Delete modified its input")
+	}
+	if got := b.Delete(1, 2, 3); len(got) != 0 {
+		t.Errorf("Delete(1, 2, 3) = %x, want empty", got)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protoregistry
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/internal/descdiff"
+	"google.golang.org/protobuf/internal/errors"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// SetStrict enables or disables strict mode, which is disabled by default.
+//
+// In strict mode, registering a file that has the same path or declares a
+// descriptor with the same full name as a registered file, but whose
+// contents differ, reports a *DriftError describing the differences. This
+// is an error even for GlobalFiles, which otherwise ignores conflicts.
+// Registering the same contents again is reported as in normal mode.
+func (r *Files) SetStrict(strict bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.strict = strict
+}
+
+// SetStrict enables or disables strict mode, which is disabled by default.
+//
+// In strict mode, registering a type that has the same full name as a
+// registered type, but whose descriptor differs, reports a *DriftError
+// describing the differences. This is an error even for GlobalTypes,
+// which otherwise ignores conflicts. Registering a type with the same
+// descriptor again is reported as in normal mode.
+func (r *Types) SetStrict(strict bool) {
+	if r == GlobalTypes {
+		globalMutex.Lock()
+		defer globalMutex.Unlock()
+	}
+	r.strict = strict
+}
+
+// DriftError reports that two registrations share a full name or file path
+// but differ in content, such as when two Go modules embed different
+// versions of the generated code for the same .proto file.
+type DriftError struct {
+	// Name is the full name of the conflicting descriptor.
+	// It is empty if the conflict is over a file path.
+	Name protoreflect.FullName
+
+	// Path is the path of the file being registered.
+	Path string
+
+	// Prev and Curr describe where the registered descriptor and the one
+	// being registered came from.
+	Prev, Curr Provenance
+
+	// Differences describes each way in which the descriptor being
+	// registered differs from the registered one.
+	Differences []string
+}
+
+func (e *DriftError) Error() string {
+	var s string
+	if e.Name == "" {
+		s = fmt.Sprintf("file %q differs from the registered file with the same path", e.Path)
+	} else {
+		s = fmt.Sprintf("file %q declares %v differently from the registered %v", e.Path, e.Name, e.Name)
+	}
+	for _, d := range e.Differences {
+		s += "\n\t" + d
+	}
+	return errors.New("%s%s", s, provenanceSuffix(e.Prev, e.Curr, e.Path)).Error()
+}
+
+// Unwrap returns the sentinel matching all errors produced by this module.
+func (e *DriftError) Unwrap() error {
+	return errors.Error
+}
+
+// driftError returns a *DriftError if the registration of curr conflicts with
+// the registered prev and their descriptors differ. It returns nil otherwise,
+// or if strict mode is disabled.
+func driftError(strict bool, path string, name protoreflect.FullName, prev, curr interface{}) error {
+	if !strict {
+		return nil
+	}
+	pd, ok1 := descriptorOf(prev)
+	cd, ok2 := descriptorOf(curr)
+	if !ok1 || !ok2 {
+		return nil
+	}
+	// Options are not compared since that requires the proto package.
+	changes := descdiff.Options{}.Descriptors(pd, cd)
+	if len(changes) == 0 {
+		return nil
+	}
+	diffs := make([]string, len(changes))
+	for i, c := range changes {
+		diffs[i] = c.String()
+	}
+	prevProv, _ := provenanceOf(prev)
+	currProv, _ := provenanceOf(curr)
+	return &DriftError{Name: name, Path: path, Prev: prevProv, Curr: currProv, Differences: diffs}
+}
+
+// fileOf returns the path of the file that declares d.
+func fileOf(d protoreflect.Descriptor) string {
+	if fd := d.ParentFile(); fd != nil {
+		return fd.Path()
+	}
+	return ""
+}
+
+// descriptorOf returns the descriptor of the type or descriptor v.
+func descriptorOf(v interface{}) (protoreflect.Descriptor, bool) {
+	switch t := v.(type) {
+	case protoreflect.EnumType:
+		return t.Descriptor(), true
+	case protoreflect.MessageType:
+		return t.Descriptor(), true
+	case protoreflect.ExtensionType:
+		return t.TypeDescriptor(), true
+	case protoreflect.Descriptor:
+		return t, true
+	}
+	return nil, false
+}
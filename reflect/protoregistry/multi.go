@@ -0,0 +1,148 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protoregistry
+
+import (
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// MultiResolver is a resolver that consults several registries in order,
+// returning the first result found. Earlier registries take precedence over
+// later ones, so a registry of local overrides may be placed before
+// GlobalFiles and GlobalTypes, followed by a registry of types fetched from
+// a remote source. It allows per-use overlays without copying a registry.
+//
+// Each element is typically a *Files or a *Types, but may be any value that
+// implements some of the Find methods of those types. An element that does
+// not implement a method is skipped by that method. A lookup stops at the
+// first element that reports an error other than NotFound.
+//
+// MultiResolver implements MessageTypeResolver and ExtensionTypeResolver,
+// as well as the methods of Files used to resolve file imports and names.
+type MultiResolver []interface{}
+
+var (
+	_ MessageTypeResolver   = MultiResolver(nil)
+	_ ExtensionTypeResolver = MultiResolver(nil)
+)
+
+// FindFileByPath looks up a file by the path in the first registry
+// that contains it.
+//
+// This returns (nil, NotFound) if not found.
+func (r MultiResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	for _, x := range r {
+		if x, ok := x.(interface {
+			FindFileByPath(string) (protoreflect.FileDescriptor, error)
+		}); ok {
+			if fd, err := x.FindFileByPath(path); err != NotFound {
+				return fd, err
+			}
+		}
+	}
+	return nil, NotFound
+}
+
+// FindDescriptorByName looks up a descriptor by the full name in the first
+// registry that contains it.
+//
+// This returns (nil, NotFound) if not found.
+func (r MultiResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	for _, x := range r {
+		if x, ok := x.(interface {
+			FindDescriptorByName(protoreflect.FullName) (protoreflect.Descriptor, error)
+		}); ok {
+			if d, err := x.FindDescriptorByName(name); err != NotFound {
+				return d, err
+			}
+		}
+	}
+	return nil, NotFound
+}
+
+// FindEnumByName looks up an enum by its full name in the first registry
+// that contains it.
+//
+// This returns (nil, NotFound) if not found.
+func (r MultiResolver) FindEnumByName(enum protoreflect.FullName) (protoreflect.EnumType, error) {
+	for _, x := range r {
+		if x, ok := x.(interface {
+			FindEnumByName(protoreflect.FullName) (protoreflect.EnumType, error)
+		}); ok {
+			if et, err := x.FindEnumByName(enum); err != NotFound {
+				return et, err
+			}
+		}
+	}
+	return nil, NotFound
+}
+
+// FindMessageByName looks up a message by its full name in the first
+// registry that contains it.
+//
+// This returns (nil, NotFound) if not found.
+func (r MultiResolver) FindMessageByName(message protoreflect.FullName) (protoreflect.MessageType, error) {
+	for _, x := range r {
+		if x, ok := x.(interface {
+			FindMessageByName(protoreflect.FullName) (protoreflect.MessageType, error)
+		}); ok {
+			if mt, err := x.FindMessageByName(message); err != NotFound {
+				return mt, err
+			}
+		}
+	}
+	return nil, NotFound
+}
+
+// FindMessageByURL looks up a message by a URL identifier in the first
+// registry that contains it.
+//
+// This returns (nil, NotFound) if not found.
+func (r MultiResolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	for _, x := range r {
+		if x, ok := x.(interface {
+			FindMessageByURL(string) (protoreflect.MessageType, error)
+		}); ok {
+			if mt, err := x.FindMessageByURL(url); err != NotFound {
+				return mt, err
+			}
+		}
+	}
+	return nil, NotFound
+}
+
+// FindExtensionByName looks up an extension field by the field's full name
+// in the first registry that contains it.
+//
+// This returns (nil, NotFound) if not found.
+func (r MultiResolver) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	for _, x := range r {
+		if x, ok := x.(interface {
+			FindExtensionByName(protoreflect.FullName) (protoreflect.ExtensionType, error)
+		}); ok {
+			if xt, err := x.FindExtensionByName(field); err != NotFound {
+				return xt, err
+			}
+		}
+	}
+	return nil, NotFound
+}
+
+// FindExtensionByNumber looks up an extension field by the field number
+// within some parent message in the first registry that contains it.
+//
+// This returns (nil, NotFound) if not found.
+func (r MultiResolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	for _, x := range r {
+		if x, ok := x.(interface {
+			FindExtensionByNumber(protoreflect.FullName, protoreflect.FieldNumber) (protoreflect.ExtensionType, error)
+		}); ok {
+			if xt, err := x.FindExtensionByNumber(message, field); err != NotFound {
+				return xt, err
+			}
+		}
+	}
+	return nil, NotFound
+}
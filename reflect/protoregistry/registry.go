@@ -20,6 +20,7 @@ import (
 	"log"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"google.golang.org/protobuf/internal/errors"
 	"google.golang.org/protobuf/reflect/protoreflect"
@@ -56,6 +57,10 @@ var NotFound = errors.New("not found")
 // descriptors contained within them.
 // The Find and Range methods are safe for concurrent use.
 type Files struct {
+	// mu guards the fields below. Lookups take it for writing when they
+	// register a file materialized by a provider.
+	mu sync.RWMutex
+
 	// The map of descsByName contains:
 	//	EnumDescriptor
 	//	EnumValueDescriptor
@@ -70,6 +75,30 @@ type Files struct {
 	// scope as the parent enum.
 	descsByName map[protoreflect.FullName]interface{}
 	filesByPath map[string]protoreflect.FileDescriptor
+
+	// extensionsByMessage contains every extension declared in any file,
+	// including those nested in messages, keyed by the extended message.
+	extensionsByMessage map[protoreflect.FullName][]protoreflect.ExtensionDescriptor
+
+	// providers are consulted in order when a lookup misses.
+	providers []FileProvider
+
+	// shared is non-zero if the maps above are shared with a clone
+	// and must be copied before they are modified.
+	// It is accessed atomically, since r may be cloned concurrently.
+	shared uint32
+
+	// strict reports whether conflicts over descriptors with different
+	// contents are reported as a *DriftError. See SetStrict.
+	strict bool
+
+	// watchers are notified of each registered file. The slice is
+	// replaced rather than modified, so that it may be used without locking.
+	watchers []*fileWatcher
+}
+
+type fileWatcher struct {
+	f func(protoreflect.FileDescriptor)
 }
 
 type packageDescriptor struct {
@@ -84,15 +113,25 @@ type packageDescriptor struct {
 //
 // It is permitted for multiple files to have the same file path.
 func (r *Files) RegisterFile(file protoreflect.FileDescriptor) error {
-	if r == GlobalFiles {
-		globalMutex.Lock()
-		defer globalMutex.Unlock()
-	}
+	err := func() error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.registerFile(file)
+	}()
+	if err == nil {
+		r.notify(file)
+	}
+	return err
+}
+
+func (r *Files) registerFile(file protoreflect.FileDescriptor) error {
+	r.unshare()
 	if r.descsByName == nil {
 		r.descsByName = map[protoreflect.FullName]interface{}{
 			"": &packageDescriptor{},
 		}
 		r.filesByPath = make(map[string]protoreflect.FileDescriptor)
+		r.extensionsByMessage = make(map[protoreflect.FullName][]protoreflect.ExtensionDescriptor)
 	}
 	path := file.Path()
 	if prev := r.filesByPath[path]; prev != nil {
@@ -128,6 +167,9 @@ func (r *Files) RegisterFile(file protoreflect.FileDescriptor) error {
 				path, prevPath, currPath, prevModule, prevVersion, prevPath))
 		}
 
+		if err := driftError(r.strict, path, "", prev, file); err != nil {
+			return err
+		}
 		err := errors.New("file %q is already registered", file.Path())
 		err = amendErrorWithCaller(err, prev, file)
 		if r == GlobalFiles && ignoreConflict(file, err) {
@@ -148,11 +190,14 @@ func (r *Files) RegisterFile(file protoreflect.FileDescriptor) error {
 			return err
 		}
 	}
-	var err error
+	var err, driftErr error
 	var hasConflict bool
 	rangeTopLevelDescriptors(file, func(d protoreflect.Descriptor) {
 		if prev := r.descsByName[d.FullName()]; prev != nil {
 			hasConflict = true
+			if driftErr == nil {
+				driftErr = driftError(r.strict, path, d.FullName(), prev, d)
+			}
 			err = errors.New("file %q has a name conflict over %v", file.Path(), d.FullName())
 			err = amendErrorWithCaller(err, prev, file)
 			if r == GlobalFiles && ignoreConflict(d, err) {
@@ -160,6 +205,9 @@ func (r *Files) RegisterFile(file protoreflect.FileDescriptor) error {
 			}
 		}
 	})
+	if driftErr != nil {
+		return driftErr
+	}
 	if hasConflict {
 		return err
 	}
@@ -174,21 +222,206 @@ func (r *Files) RegisterFile(file protoreflect.FileDescriptor) error {
 	rangeTopLevelDescriptors(file, func(d protoreflect.Descriptor) {
 		r.descsByName[d.FullName()] = d
 	})
+	rangeAllExtensions(file.Messages(), file.Extensions(), func(xd protoreflect.ExtensionDescriptor) {
+		name := xd.ContainingMessage().FullName()
+		r.extensionsByMessage[name] = append(r.extensionsByMessage[name], xd)
+	})
 	r.filesByPath[path] = file
 	return nil
 }
 
+// DeleteFile unregisters the file registered with the given path, along
+// with the descriptors declared in it, so that a file with the same path or
+// declarations may be registered again.
+// Descriptors in other files that refer to the deleted file's descriptors
+// are unaffected.
+//
+// This returns NotFound if no file is registered with the path.
+func (r *Files) DeleteFile(path string) error {
+	if r == nil {
+		return NotFound
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	file, ok := r.filesByPath[path]
+	if !ok {
+		return NotFound
+	}
+	r.deleteFile(file)
+	return nil
+}
+
+// ReplaceFile registers the provided file descriptor in place of the file
+// registered with the same path, if any. It is equivalent to DeleteFile
+// followed by RegisterFile, except that the change is atomic: if any
+// descriptor within the file conflicts with that of another registered file,
+// the previously registered file remains registered and an error is returned.
+func (r *Files) ReplaceFile(file protoreflect.FileDescriptor) error {
+	err := func() error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		prev, ok := r.filesByPath[file.Path()]
+		if ok {
+			r.deleteFile(prev)
+		}
+		err := r.registerFile(file)
+		if err != nil && ok {
+			if err := r.registerFile(prev); err != nil {
+				panic(fmt.Sprintf("re-registering file %q: %v", prev.Path(), err))
+			}
+		}
+		return err
+	}()
+	if err == nil {
+		r.notify(file)
+	}
+	return err
+}
+
+func (r *Files) deleteFile(file protoreflect.FileDescriptor) {
+	r.unshare()
+	delete(r.filesByPath, file.Path())
+	rangeTopLevelDescriptors(file, func(d protoreflect.Descriptor) {
+		if prev, ok := r.descsByName[d.FullName()].(protoreflect.Descriptor); ok && prev.ParentFile() == file {
+			delete(r.descsByName, d.FullName())
+		}
+	})
+	rangeAllExtensions(file.Messages(), file.Extensions(), func(xd protoreflect.ExtensionDescriptor) {
+		name := xd.ContainingMessage().FullName()
+		xds := r.extensionsByMessage[name]
+		for i, x := range xds {
+			if x == xd {
+				xds = append(xds[:i:i], xds[i+1:]...)
+				break
+			}
+		}
+		if len(xds) == 0 {
+			delete(r.extensionsByMessage, name)
+		} else {
+			r.extensionsByMessage[name] = xds
+		}
+	})
+
+	// Remove the file from its package, and remove the package and its
+	// parents if no other file uses them.
+	if p, ok := r.descsByName[file.Package()].(*packageDescriptor); ok {
+		for i, f := range p.files {
+			if f == file {
+				p.files = append(p.files[:i:i], p.files[i+1:]...)
+				break
+			}
+		}
+	}
+	for name := file.Package(); name != ""; name = name.Parent() {
+		if r.packageInUse(name) {
+			break
+		}
+		delete(r.descsByName, name)
+	}
+}
+
+// Clone returns a copy of the registry, including its providers but not
+// its watchers. Files registered with or deleted from the copy do not
+// affect r, and vice versa. The copy is cheap to make: the contents of the registry are
+// only copied when either registry is first modified.
+func (r *Files) Clone() *Files {
+	if r == nil {
+		return new(Files)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	atomic.StoreUint32(&r.shared, 1)
+	return &Files{
+		descsByName:         r.descsByName,
+		filesByPath:         r.filesByPath,
+		extensionsByMessage: r.extensionsByMessage,
+		providers:           r.providers[:len(r.providers):len(r.providers)],
+		shared:              1,
+		strict:              r.strict,
+	}
+}
+
+// unshare copies the contents of the registry if they are shared with a
+// clone, so that they may be modified.
+func (r *Files) unshare() {
+	if atomic.LoadUint32(&r.shared) == 0 {
+		return
+	}
+	atomic.StoreUint32(&r.shared, 0)
+	if r.descsByName == nil {
+		return
+	}
+	descsByName := make(map[protoreflect.FullName]interface{}, len(r.descsByName))
+	for name, d := range r.descsByName {
+		if p, ok := d.(*packageDescriptor); ok {
+			d = &packageDescriptor{files: append([]protoreflect.FileDescriptor(nil), p.files...)}
+		}
+		descsByName[name] = d
+	}
+	filesByPath := make(map[string]protoreflect.FileDescriptor, len(r.filesByPath))
+	for path, fd := range r.filesByPath {
+		filesByPath[path] = fd
+	}
+	extensionsByMessage := make(map[protoreflect.FullName][]protoreflect.ExtensionDescriptor, len(r.extensionsByMessage))
+	for name, xds := range r.extensionsByMessage {
+		extensionsByMessage[name] = xds[:len(xds):len(xds)]
+	}
+	r.descsByName, r.filesByPath, r.extensionsByMessage = descsByName, filesByPath, extensionsByMessage
+}
+
+// packageInUse reports whether any registered file is in the package
+// or one of its sub-packages.
+func (r *Files) packageInUse(name protoreflect.FullName) bool {
+	for _, f := range r.filesByPath {
+		if hasPackagePrefix(f.Package(), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPackagePrefix reports whether the package name is prefix or one of its
+// sub-packages. Every package has the empty prefix.
+func hasPackagePrefix(name, prefix protoreflect.FullName) bool {
+	return prefix == "" || name == prefix || strings.HasPrefix(string(name), string(prefix)+".")
+}
+
 // FindDescriptorByName looks up a descriptor by the full name.
+// If no registered file declares it, the registered providers are asked
+// for the file that does.
 //
 // This returns (nil, NotFound) if not found.
 func (r *Files) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
 	if r == nil {
 		return nil, NotFound
 	}
-	if r == GlobalFiles {
-		globalMutex.RLock()
-		defer globalMutex.RUnlock()
+	d, err := r.findDescriptorByName(name)
+	if err != NotFound {
+		return d, err
 	}
+	for _, p := range r.fileProviders() {
+		fd, err := p.ProvideFileByName(name)
+		if err == NotFound {
+			continue
+		}
+		if err == nil {
+			var files []protoreflect.FileDescriptor
+			files, err = r.registerProvided(fd)
+			r.notify(files...)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if d, err := r.findDescriptorByName(name); err != NotFound {
+			return d, err
+		}
+	}
+	return nil, NotFound
+}
+
+func (r *Files) findDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	prefix := name
 	suffix := nameSuffix("")
 	for prefix != "" {
@@ -271,31 +504,211 @@ func (s *nameSuffix) Pop() (name protoreflect.Name) {
 }
 
 // FindFileByPath looks up a file by the path.
+// If no file is registered with the path, the registered providers are asked
+// for it.
 //
 // This returns (nil, NotFound) if not found.
 func (r *Files) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
 	if r == nil {
 		return nil, NotFound
 	}
-	if r == GlobalFiles {
-		globalMutex.RLock()
-		defer globalMutex.RUnlock()
+	fd, err := r.findFileByPath(path)
+	if err != NotFound {
+		return fd, err
+	}
+	for _, p := range r.fileProviders() {
+		fd, err := p.ProvideFileByPath(path)
+		if err == NotFound {
+			continue
+		}
+		if err == nil {
+			var files []protoreflect.FileDescriptor
+			files, err = r.registerProvided(fd)
+			r.notify(files...)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if fd, err := r.findFileByPath(path); err != NotFound {
+			return fd, err
+		}
 	}
+	return nil, NotFound
+}
+
+func (r *Files) findFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	if fd, ok := r.filesByPath[path]; ok {
 		return fd, nil
 	}
 	return nil, NotFound
 }
 
+// FileProvider materializes file descriptors on demand.
+// It allows a Files registry to defer constructing the descriptors of files
+// until they are first looked up. See Files.RegisterProvider.
+type FileProvider interface {
+	// ProvideFileByPath returns the file with the given path.
+	// It returns (nil, NotFound) if the provider has no such file.
+	ProvideFileByPath(path string) (protoreflect.FileDescriptor, error)
+
+	// ProvideFileByName returns the file that declares the descriptor with
+	// the given full name, which may be that of a nested declaration
+	// such as a field or an enum value.
+	// It returns (nil, NotFound) if the provider has no such file.
+	ProvideFileByName(name protoreflect.FullName) (protoreflect.FileDescriptor, error)
+}
+
+// RegisterProvider registers a provider that is asked for the files that
+// FindFileByPath or FindDescriptorByName do not find among the registered
+// files. Providers are asked in the order they were registered, and the first
+// file provided is registered, along with the files it imports, as if by
+// RegisterFile. It is an error for a provided file to conflict with a
+// registered file.
+//
+// Since every lookup that misses asks the providers, a provider should be
+// able to report NotFound quickly. A provider may look up the files a
+// provided file imports in r, but must not otherwise register files with r.
+// The Num and Range methods only report the files registered so far.
+func (r *Files) RegisterProvider(p FileProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers = append(r.providers, p)
+}
+
+func (r *Files) fileProviders() []FileProvider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.providers
+}
+
+// registerProvided registers a file provided by a FileProvider, after the
+// files it imports, and returns the files it registered. Files registered
+// concurrently with the same path, such as by another lookup asking for the
+// same file, are left in place.
+func (r *Files) registerProvided(file protoreflect.FileDescriptor) ([]protoreflect.FileDescriptor, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var registered []protoreflect.FileDescriptor
+	var register func(protoreflect.FileDescriptor) error
+	register = func(fd protoreflect.FileDescriptor) error {
+		if _, ok := r.filesByPath[fd.Path()]; ok || fd.IsPlaceholder() {
+			return nil
+		}
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			if err := register(imports.Get(i).FileDescriptor); err != nil {
+				return err
+			}
+		}
+		if err := r.registerFile(fd); err != nil {
+			return err
+		}
+		registered = append(registered, fd)
+		return nil
+	}
+	err := register(file)
+	return registered, err
+}
+
+// Watch arranges for f to be called with each file registered with r after
+// Watch returns, including those registered by ReplaceFile or materialized
+// by a provider. It returns a function that stops further calls to f.
+// Deleting a file is not reported.
+//
+// The function f is called by the goroutine that registers the file, after
+// the registration is complete, so it may use r. Calls to f are not
+// synchronized with each other.
+func (r *Files) Watch(f func(protoreflect.FileDescriptor)) (stop func()) {
+	w := &fileWatcher{f}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.watchers = append(r.watchers[:len(r.watchers):len(r.watchers)], w)
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for i, x := range r.watchers {
+			if x == w {
+				r.watchers = append(r.watchers[:i:i], r.watchers[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// notify calls the watchers with each of the files that is registered.
+func (r *Files) notify(files ...protoreflect.FileDescriptor) {
+	watchers, files := r.registeredFiles(files)
+	for _, fd := range files {
+		for _, w := range watchers {
+			w.f(fd)
+		}
+	}
+}
+
+// registeredFiles returns the watchers of r and those of the files that
+// are registered. Registering a file that conflicts with another may be
+// ignored without reporting an error.
+func (r *Files) registeredFiles(files []protoreflect.FileDescriptor) ([]*fileWatcher, []protoreflect.FileDescriptor) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.watchers) == 0 {
+		return nil, nil
+	}
+	var registered []protoreflect.FileDescriptor
+	for _, fd := range files {
+		if r.filesByPath[fd.Path()] == fd {
+			registered = append(registered, fd)
+		}
+	}
+	return r.watchers, registered
+}
+
+// ResolvePlaceholder returns the registered descriptor that the placeholder d
+// stands in for, such as the message type of a field whose dependency was
+// weak or unresolvable when the field was created. This allows a placeholder
+// to be upgraded once the file declaring the real descriptor is registered.
+//
+// It returns d itself if d is not a placeholder or if no descriptor of the
+// same kind is registered with its full name (or path, for a file).
+// The result has the same kind of descriptor as d.
+func (r *Files) ResolvePlaceholder(d protoreflect.Descriptor) protoreflect.Descriptor {
+	if d == nil || !d.IsPlaceholder() {
+		return d
+	}
+	if fd, ok := d.(protoreflect.FileDescriptor); ok {
+		if f, err := r.FindFileByPath(fd.Path()); err == nil && !f.IsPlaceholder() {
+			return f
+		}
+		return d
+	}
+	found, err := r.FindDescriptorByName(d.FullName())
+	if err != nil || found.IsPlaceholder() {
+		return d
+	}
+	var ok bool
+	switch d.(type) {
+	case protoreflect.MessageDescriptor:
+		_, ok = found.(protoreflect.MessageDescriptor)
+	case protoreflect.EnumDescriptor:
+		_, ok = found.(protoreflect.EnumDescriptor)
+	case protoreflect.EnumValueDescriptor:
+		_, ok = found.(protoreflect.EnumValueDescriptor)
+	}
+	if !ok {
+		return d
+	}
+	return found
+}
+
 // NumFiles reports the number of registered files.
 func (r *Files) NumFiles() int {
 	if r == nil {
 		return 0
 	}
-	if r == GlobalFiles {
-		globalMutex.RLock()
-		defer globalMutex.RUnlock()
-	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	return len(r.filesByPath)
 }
 
@@ -305,10 +718,8 @@ func (r *Files) RangeFiles(f func(protoreflect.FileDescriptor) bool) {
 	if r == nil {
 		return
 	}
-	if r == GlobalFiles {
-		globalMutex.RLock()
-		defer globalMutex.RUnlock()
-	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	for _, file := range r.filesByPath {
 		if !f(file) {
 			return
@@ -321,10 +732,8 @@ func (r *Files) NumFilesByPackage(name protoreflect.FullName) int {
 	if r == nil {
 		return 0
 	}
-	if r == GlobalFiles {
-		globalMutex.RLock()
-		defer globalMutex.RUnlock()
-	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	p, ok := r.descsByName[name].(*packageDescriptor)
 	if !ok {
 		return 0
@@ -338,10 +747,8 @@ func (r *Files) RangeFilesByPackage(name protoreflect.FullName, f func(protorefl
 	if r == nil {
 		return
 	}
-	if r == GlobalFiles {
-		globalMutex.RLock()
-		defer globalMutex.RUnlock()
-	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	p, ok := r.descsByName[name].(*packageDescriptor)
 	if !ok {
 		return
@@ -353,6 +760,71 @@ func (r *Files) RangeFilesByPackage(name protoreflect.FullName, f func(protorefl
 	}
 }
 
+// RangeFilesByPackagePrefix iterates over all registered files in a given
+// proto package or any of its sub-packages while f returns true. For example,
+// the prefix "google.api" matches the packages "google.api" and
+// "google.api.expr", but not "google.apis". The empty prefix matches every
+// package. The iteration order is undefined.
+func (r *Files) RangeFilesByPackagePrefix(prefix protoreflect.FullName, f func(protoreflect.FileDescriptor) bool) {
+	if r == nil {
+		return
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for name, d := range r.descsByName {
+		p, ok := d.(*packageDescriptor)
+		if !ok || !hasPackagePrefix(name, prefix) {
+			continue
+		}
+		for _, file := range p.files {
+			if !f(file) {
+				return
+			}
+		}
+	}
+}
+
+// NumExtensionsByMessage reports the number of extensions declared in the
+// registered files that extend the given message, including extensions
+// declared within messages.
+func (r *Files) NumExtensionsByMessage(message protoreflect.FullName) int {
+	if r == nil {
+		return 0
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.extensionsByMessage[message])
+}
+
+// RangeExtensionsByMessage iterates over all extensions declared in the
+// registered files that extend the given message, including extensions
+// declared within messages, while f returns true.
+// The iteration order is undefined.
+func (r *Files) RangeExtensionsByMessage(message protoreflect.FullName, f func(protoreflect.ExtensionDescriptor) bool) {
+	if r == nil {
+		return
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, xd := range r.extensionsByMessage[message] {
+		if !f(xd) {
+			return
+		}
+	}
+}
+
+// rangeAllExtensions calls f for each extension in xds and each extension
+// declared within the messages mds, recursively.
+func rangeAllExtensions(mds protoreflect.MessageDescriptors, xds protoreflect.ExtensionDescriptors, f func(protoreflect.ExtensionDescriptor)) {
+	for i := 0; i < xds.Len(); i++ {
+		f(xds.Get(i))
+	}
+	for i := 0; i < mds.Len(); i++ {
+		md := mds.Get(i)
+		rangeAllExtensions(md.Messages(), md.Extensions(), f)
+	}
+}
+
 // rangeTopLevelDescriptors iterates over all top-level descriptors in a file
 // which will be directly entered into the registry.
 func rangeTopLevelDescriptors(fd protoreflect.FileDescriptor, f func(protoreflect.Descriptor)) {
@@ -434,6 +906,23 @@ type Types struct {
 	numEnums      int
 	numMessages   int
 	numExtensions int
+
+	// shared is non-zero if the maps above are shared with a clone
+	// and must be copied before they are modified.
+	// It is accessed atomically, since r may be cloned concurrently.
+	shared uint32
+
+	// strict reports whether conflicts over descriptors with different
+	// contents are reported as a *DriftError. See SetStrict.
+	strict bool
+
+	// watchers are notified of each registered type. The slice is
+	// replaced rather than modified, so that it may be used without locking.
+	watchers []*typeWatcher
+}
+
+type typeWatcher struct {
+	f func(interface{})
 }
 
 type (
@@ -450,16 +939,22 @@ func (r *Types) RegisterMessage(mt protoreflect.MessageType) error {
 	// examine the registry, so fetch it before locking.
 	md := mt.Descriptor()
 
-	if r == GlobalTypes {
-		globalMutex.Lock()
-		defer globalMutex.Unlock()
-	}
+	err := func() error {
+		if r == GlobalTypes {
+			globalMutex.Lock()
+			defer globalMutex.Unlock()
+		}
 
-	if err := r.register("message", md, mt); err != nil {
-		return err
+		if err := r.register("message", md, mt); err != nil {
+			return err
+		}
+		r.numMessages++
+		return nil
+	}()
+	if err == nil {
+		r.notify(mt)
 	}
-	r.numMessages++
-	return nil
+	return err
 }
 
 // RegisterEnum registers the provided enum type.
@@ -470,16 +965,22 @@ func (r *Types) RegisterEnum(et protoreflect.EnumType) error {
 	// examine the registry, so fetch it before locking.
 	ed := et.Descriptor()
 
-	if r == GlobalTypes {
-		globalMutex.Lock()
-		defer globalMutex.Unlock()
-	}
+	err := func() error {
+		if r == GlobalTypes {
+			globalMutex.Lock()
+			defer globalMutex.Unlock()
+		}
 
-	if err := r.register("enum", ed, et); err != nil {
-		return err
+		if err := r.register("enum", ed, et); err != nil {
+			return err
+		}
+		r.numEnums++
+		return nil
+	}()
+	if err == nil {
+		r.notify(et)
 	}
-	r.numEnums++
-	return nil
+	return err
 }
 
 // RegisterExtension registers the provided extension type.
@@ -493,39 +994,54 @@ func (r *Types) RegisterExtension(xt protoreflect.ExtensionType) error {
 	// legacy ExtensionDesc can consult the global registry.
 	xd := xt.TypeDescriptor()
 
-	if r == GlobalTypes {
-		globalMutex.Lock()
-		defer globalMutex.Unlock()
-	}
+	err := func() error {
+		if r == GlobalTypes {
+			globalMutex.Lock()
+			defer globalMutex.Unlock()
+		}
 
-	field := xd.Number()
-	message := xd.ContainingMessage().FullName()
-	if prev := r.extensionsByMessage[message][field]; prev != nil {
-		err := errors.New("extension number %d is already registered on message %v", field, message)
-		err = amendErrorWithCaller(err, prev, xt)
-		if !(r == GlobalTypes && ignoreConflict(xd, err)) {
-			return err
+		field := xd.Number()
+		message := xd.ContainingMessage().FullName()
+		if prev := r.extensionsByMessage[message][field]; prev != nil {
+			if prev.TypeDescriptor().FullName() == xd.FullName() {
+				if err := driftError(r.strict, fileOf(xd), xd.FullName(), prev, xt); err != nil {
+					return err
+				}
+			}
+			err := errors.New("extension number %d is already registered on message %v", field, message)
+			err = amendErrorWithCaller(err, prev, xt)
+			if !(r == GlobalTypes && ignoreConflict(xd, err)) {
+				return err
+			}
 		}
-	}
 
-	if err := r.register("extension", xd, xt); err != nil {
-		return err
-	}
-	if r.extensionsByMessage == nil {
-		r.extensionsByMessage = make(extensionsByMessage)
-	}
-	if r.extensionsByMessage[message] == nil {
-		r.extensionsByMessage[message] = make(extensionsByNumber)
-	}
-	r.extensionsByMessage[message][field] = xt
-	r.numExtensions++
-	return nil
+		if err := r.register("extension", xd, xt); err != nil {
+			return err
+		}
+		if r.extensionsByMessage == nil {
+			r.extensionsByMessage = make(extensionsByMessage)
+		}
+		if r.extensionsByMessage[message] == nil {
+			r.extensionsByMessage[message] = make(extensionsByNumber)
+		}
+		r.extensionsByMessage[message][field] = xt
+		r.numExtensions++
+		return nil
+	}()
+	if err == nil {
+		r.notify(xt)
+	}
+	return err
 }
 
 func (r *Types) register(kind string, desc protoreflect.Descriptor, typ interface{}) error {
+	r.unshare()
 	name := desc.FullName()
 	prev := r.typesByName[name]
 	if prev != nil {
+		if err := driftError(r.strict, fileOf(desc), name, prev, typ); err != nil {
+			return err
+		}
 		err := errors.New("%v %v is already registered", kind, name)
 		err = amendErrorWithCaller(err, prev, typ)
 		if !(r == GlobalTypes && ignoreConflict(desc, err)) {
@@ -539,6 +1055,138 @@ func (r *Types) register(kind string, desc protoreflect.Descriptor, typ interfac
 	return nil
 }
 
+// DeleteType unregisters the enum, message, or extension type registered
+// with the given full name, so that a type with the same name or extension
+// number may be registered again.
+//
+// This returns NotFound if no type is registered with the name.
+func (r *Types) DeleteType(name protoreflect.FullName) error {
+	if r == nil {
+		return NotFound
+	}
+	if r == GlobalTypes {
+		globalMutex.Lock()
+		defer globalMutex.Unlock()
+	}
+	r.unshare()
+	switch t := r.typesByName[name].(type) {
+	case protoreflect.EnumType:
+		r.numEnums--
+	case protoreflect.MessageType:
+		r.numMessages--
+	case protoreflect.ExtensionType:
+		xd := t.TypeDescriptor()
+		message := xd.ContainingMessage().FullName()
+		if x := r.extensionsByMessage[message][xd.Number()]; x != nil && x.TypeDescriptor().FullName() == name {
+			delete(r.extensionsByMessage[message], xd.Number())
+			if len(r.extensionsByMessage[message]) == 0 {
+				delete(r.extensionsByMessage, message)
+			}
+		}
+		r.numExtensions--
+	default:
+		return NotFound
+	}
+	delete(r.typesByName, name)
+	return nil
+}
+
+// Clone returns a copy of the registry, not including its watchers.
+// Types registered with or deleted from the copy do not affect r,
+// and vice versa. The copy is cheap to make:
+// the contents of the registry are only copied when either registry is first
+// modified.
+func (r *Types) Clone() *Types {
+	if r == nil {
+		return new(Types)
+	}
+	if r == GlobalTypes {
+		globalMutex.Lock()
+		defer globalMutex.Unlock()
+	}
+	atomic.StoreUint32(&r.shared, 1)
+	return &Types{
+		typesByName:         r.typesByName,
+		extensionsByMessage: r.extensionsByMessage,
+		numEnums:            r.numEnums,
+		numMessages:         r.numMessages,
+		numExtensions:       r.numExtensions,
+		shared:              1,
+		strict:              r.strict,
+	}
+}
+
+// unshare copies the contents of the registry if they are shared with a
+// clone, so that they may be modified.
+func (r *Types) unshare() {
+	if atomic.LoadUint32(&r.shared) == 0 {
+		return
+	}
+	atomic.StoreUint32(&r.shared, 0)
+	if r.typesByName != nil {
+		typesByName := make(typesByName, len(r.typesByName))
+		for name, typ := range r.typesByName {
+			typesByName[name] = typ
+		}
+		r.typesByName = typesByName
+	}
+	if r.extensionsByMessage != nil {
+		extensionsByMessage := make(extensionsByMessage, len(r.extensionsByMessage))
+		for message, xts := range r.extensionsByMessage {
+			extensionsByMessage[message] = make(extensionsByNumber, len(xts))
+			for field, xt := range xts {
+				extensionsByMessage[message][field] = xt
+			}
+		}
+		r.extensionsByMessage = extensionsByMessage
+	}
+}
+
+// Watch arranges for f to be called with each type registered with r after
+// Watch returns. The type is a protoreflect.EnumType,
+// protoreflect.MessageType, or protoreflect.ExtensionType.
+// It returns a function that stops further calls to f.
+// Deleting a type is not reported.
+//
+// The function f is called by the goroutine that registers the type, after
+// the registration is complete, so it may use r. Calls to f are not
+// synchronized with each other.
+func (r *Types) Watch(f func(typ interface{})) (stop func()) {
+	w := &typeWatcher{f}
+	if r == GlobalTypes {
+		globalMutex.Lock()
+		defer globalMutex.Unlock()
+	}
+	r.watchers = append(r.watchers[:len(r.watchers):len(r.watchers)], w)
+	return func() {
+		if r == GlobalTypes {
+			globalMutex.Lock()
+			defer globalMutex.Unlock()
+		}
+		for i, x := range r.watchers {
+			if x == w {
+				r.watchers = append(r.watchers[:i:i], r.watchers[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// notify calls the watchers with the registered type.
+func (r *Types) notify(typ interface{}) {
+	for _, w := range r.typeWatchers() {
+		w.f(typ)
+	}
+}
+
+func (r *Types) typeWatchers() []*typeWatcher {
+	if r == GlobalTypes {
+		globalMutex.RLock()
+		defer globalMutex.RUnlock()
+	}
+	return r.watchers
+}
+
 // FindEnumByName looks up an enum by its full name.
 // E.g., "google.protobuf.Field.Kind".
 //
@@ -698,6 +1346,36 @@ func (r *Types) RangeMessages(f func(protoreflect.MessageType) bool) {
 	}
 }
 
+// RangeMessagesByPackage iterates over all registered messages declared in
+// a given proto package while f returns true. This includes nested messages,
+// but not messages in sub-packages. Iteration order is undefined.
+func (r *Types) RangeMessagesByPackage(name protoreflect.FullName, f func(protoreflect.MessageType) bool) {
+	if r == nil {
+		return
+	}
+	if r == GlobalTypes {
+		globalMutex.RLock()
+		defer globalMutex.RUnlock()
+	}
+	for _, typ := range r.typesByName {
+		if mt, ok := typ.(protoreflect.MessageType); ok && packageOf(mt.Descriptor()) == name {
+			if !f(mt) {
+				return
+			}
+		}
+	}
+}
+
+// packageOf returns the proto package that declares d.
+func packageOf(d protoreflect.Descriptor) protoreflect.FullName {
+	if fd := d.ParentFile(); fd != nil {
+		return fd.Package()
+	}
+	// Without a file, assume that the parent of a top-level declaration
+	// is its package.
+	return d.FullName().Parent()
+}
+
 // NumExtensions reports the number of registered extensions.
 func (r *Types) NumExtensions() int {
 	if r == nil {
@@ -772,16 +1450,92 @@ func typeName(t interface{}) string {
 	}
 }
 
+// amendErrorWithCaller amends a registration conflict error with where
+// the previously registered descriptor prev came from, and the Go package
+// that registers each of prev and curr if they differ.
 func amendErrorWithCaller(err error, prev, curr interface{}) error {
-	prevPkg := goPackage(prev)
-	currPkg := goPackage(curr)
-	if prevPkg == "" || currPkg == "" || prevPkg == currPkg {
+	prevProv, _ := provenanceOf(prev)
+	currProv, _ := provenanceOf(curr)
+	var s string
+	if pd, ok := prev.(*packageDescriptor); ok && len(pd.files) > 0 {
+		s = fmt.Sprintf("\n\tpreviously declared as a package by file: %q", pd.files[0].Path())
+		prevProv.File = ""
+	}
+	s += provenanceSuffix(prevProv, currProv, currProv.File)
+	if s == "" {
 		return err
 	}
-	return errors.New("%s\n\tpreviously from: %q\n\tcurrently from:  %q", err, prevPkg, currPkg)
+	return errors.New("%s%s", err, s)
+}
+
+// provenanceSuffix describes where a previously registered descriptor
+// came from, for the error reporting a conflict with one declared in the
+// file at path.
+func provenanceSuffix(prev, curr Provenance, path string) string {
+	var s string
+	if prev.File != "" && prev.File != path {
+		s += fmt.Sprintf("\n\tpreviously declared in file: %q", prev.File)
+	}
+	if prev.GoPackagePath != "" && prev.GoPackagePath != curr.GoPackagePath {
+		s += fmt.Sprintf("\n\tpreviously from: %q", prev.GoPackagePath)
+		if curr.GoPackagePath != "" {
+			s += fmt.Sprintf("\n\tcurrently from:  %q", curr.GoPackagePath)
+		}
+	}
+	return s
 }
 
-func goPackage(v interface{}) string {
+// Provenance describes where a registered descriptor or type came from.
+type Provenance struct {
+	// File is the path of the file that declares the descriptor.
+	File string
+
+	// Package is the protobuf package of the file.
+	Package protoreflect.FullName
+
+	// GoPackagePath is the import path of the Go package that registered
+	// the descriptor. It is empty if unknown, such as for descriptors that
+	// are not generated Go code.
+	GoPackagePath string
+}
+
+// Provenance reports where the descriptor registered with the full name
+// came from. It does not ask the registered providers for the descriptor.
+//
+// This returns NotFound if no descriptor is registered with the name.
+func (r *Files) Provenance(name protoreflect.FullName) (Provenance, error) {
+	if r == nil {
+		return Provenance{}, NotFound
+	}
+	d, err := r.findDescriptorByName(name)
+	if err != nil {
+		return Provenance{}, err
+	}
+	return provenanceOf(d)
+}
+
+// Provenance reports where the enum, message, or extension type registered
+// with the full name came from.
+//
+// This returns NotFound if no type is registered with the name.
+func (r *Types) Provenance(name protoreflect.FullName) (Provenance, error) {
+	if r == nil {
+		return Provenance{}, NotFound
+	}
+	if r == GlobalTypes {
+		globalMutex.RLock()
+		defer globalMutex.RUnlock()
+	}
+	typ, ok := r.typesByName[name]
+	if !ok {
+		return Provenance{}, NotFound
+	}
+	return provenanceOf(typ)
+}
+
+// provenanceOf reports where the type, descriptor, or package v came from.
+// It returns NotFound if v is none of those.
+func provenanceOf(v interface{}) (Provenance, error) {
 	switch d := v.(type) {
 	case protoreflect.EnumType:
 		v = d.Descriptor()
@@ -789,12 +1543,23 @@ func goPackage(v interface{}) string {
 		v = d.Descriptor()
 	case protoreflect.ExtensionType:
 		v = d.TypeDescriptor()
+	case *packageDescriptor:
+		if len(d.files) == 0 {
+			return Provenance{}, NotFound
+		}
+		v = d.files[0]
+	}
+	d, ok := v.(protoreflect.Descriptor)
+	if !ok {
+		return Provenance{}, NotFound
 	}
-	if d, ok := v.(protoreflect.Descriptor); ok {
-		v = d.ParentFile()
+	fd := d.ParentFile()
+	if fd == nil {
+		return Provenance{}, nil
 	}
-	if d, ok := v.(interface{ GoPackagePath() string }); ok {
-		return d.GoPackagePath()
+	p := Provenance{File: fd.Path(), Package: fd.Package()}
+	if fd, ok := fd.(interface{ GoPackagePath() string }); ok {
+		p.GoPackagePath = fd.GoPackagePath()
 	}
-	return ""
+	return p, nil
 }
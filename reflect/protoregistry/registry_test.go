@@ -7,6 +7,7 @@ package protoregistry_test
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -20,6 +21,7 @@ import (
 
 	testpb "google.golang.org/protobuf/internal/testprotos/registry"
 	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
 )
 
 func mustMakeFile(s string) pref.FileDescriptor {
@@ -647,3 +649,892 @@ func TestTypes(t *testing.T) {
 		}
 	})
 }
+
+func TestFilesExtensionsByMessage(t *testing.T) {
+	var files preg.Files
+	for _, s := range []string{
+		`syntax:"proto2" name:"base.proto" package:"test" message_type:[{name:"Base" extension_range:[{start:100 end:200}]}]`,
+		`syntax:"proto2" name:"ext1.proto" package:"test" dependency:"base.proto"
+			extension:[{name:"top" number:100 label:LABEL_OPTIONAL type:TYPE_INT32 extendee:".test.Base"}]
+			message_type:[{name:"Outer" nested_type:[{name:"Inner"
+				extension:[{name:"nested" number:101 label:LABEL_OPTIONAL type:TYPE_INT32 extendee:".test.Base"}]
+			}]}]`,
+		`syntax:"proto2" name:"ext2.proto" package:"test" dependency:"base.proto"
+			message_type:[{name:"Other" extension_range:[{start:1 end:10}]}]
+			extension:[
+				{name:"other" number:1 label:LABEL_OPTIONAL type:TYPE_INT32 extendee:".test.Other"},
+				{name:"third" number:102 label:LABEL_OPTIONAL type:TYPE_INT32 extendee:".test.Base"}
+			]`,
+	} {
+		pb := new(descriptorpb.FileDescriptorProto)
+		if err := prototext.Unmarshal([]byte(s), pb); err != nil {
+			t.Fatal(err)
+		}
+		fd, err := pdesc.NewFile(pb, &files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := files.RegisterFile(fd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	files.RangeExtensionsByMessage("test.Base", func(xd pref.ExtensionDescriptor) bool {
+		got = append(got, string(xd.FullName()))
+		return true
+	})
+	want := []string{"test.Outer.Inner.nested", "test.third", "test.top"}
+	if diff := cmp.Diff(want, got, cmpopts.SortSlices(func(x, y string) bool { return x < y })); diff != "" {
+		t.Errorf("RangeExtensionsByMessage(test.Base) mismatch (-want +got):\n%v", diff)
+	}
+	if got := files.NumExtensionsByMessage("test.Base"); got != 3 {
+		t.Errorf("NumExtensionsByMessage(test.Base) = %d, want 3", got)
+	}
+	if got := files.NumExtensionsByMessage("test.Other"); got != 1 {
+		t.Errorf("NumExtensionsByMessage(test.Other) = %d, want 1", got)
+	}
+	if got := files.NumExtensionsByMessage("test.Missing"); got != 0 {
+		t.Errorf("NumExtensionsByMessage(test.Missing) = %d, want 0", got)
+	}
+
+	fd, _ := files.FindFileByPath("ext1.proto")
+	got = nil
+	for _, xd := range pdesc.ExtensionsByMessage(fd, "test.Base") {
+		got = append(got, string(xd.FullName()))
+	}
+	if diff := cmp.Diff([]string{"test.top", "test.Outer.Inner.nested"}, got); diff != "" {
+		t.Errorf("ExtensionsByMessage(ext1.proto, test.Base) mismatch (-want +got):\n%v", diff)
+	}
+}
+
+func TestFilesResolvePlaceholder(t *testing.T) {
+	pb := new(descriptorpb.FileDescriptorProto)
+	if err := prototext.Unmarshal([]byte(`syntax:"proto2" name:"early.proto" package:"test" dependency:"late.proto"
+		message_type:[{name:"Early" field:[
+			{name:"m" number:1 label:LABEL_OPTIONAL type:TYPE_MESSAGE type_name:".test.Late"},
+			{name:"e" number:2 label:LABEL_OPTIONAL type:TYPE_ENUM type_name:".test.LateEnum" default_value:"LATE_ONE"},
+			{name:"x" number:3 label:LABEL_OPTIONAL type:TYPE_MESSAGE type_name:".test.LateEnum"}
+		]}]`), pb); err != nil {
+		t.Fatal(err)
+	}
+	early, err := pdesc.FileOptions{AllowUnresolvable: true}.New(pb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := early.Messages().ByName("Early").Fields()
+	md := fields.ByName("m").Message()
+	ed := fields.ByName("e").Enum()
+	evd := fields.ByName("e").DefaultEnumValue()
+	imp := early.Imports().Get(0).FileDescriptor
+	wrongKind := fields.ByName("x").Message()
+
+	var files preg.Files
+	for _, d := range []pref.Descriptor{md, ed, evd, imp} {
+		if got := files.ResolvePlaceholder(d); got != d {
+			t.Errorf("ResolvePlaceholder(%v) before registration = %v, want the placeholder", d.FullName(), got)
+		}
+	}
+
+	late := mustMakeFile(`syntax:"proto2" name:"late.proto" package:"test"
+		message_type:[{name:"Late"}]
+		enum_type:[{name:"LateEnum" value:[{name:"LATE_ONE" number:1}]}]`)
+	if err := files.RegisterFile(late); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		in   pref.Descriptor
+		want pref.Descriptor
+	}{
+		{md, late.Messages().ByName("Late")},
+		{ed, late.Enums().ByName("LateEnum")},
+		{evd, late.Enums().ByName("LateEnum").Values().ByName("LATE_ONE")},
+		{imp, late},
+		{wrongKind, wrongKind},
+		{early, early},
+	} {
+		if got := files.ResolvePlaceholder(tt.in); got != tt.want {
+			t.Errorf("ResolvePlaceholder(%v) = %v, want %v", tt.in.FullName(), got, tt.want)
+		}
+	}
+}
+
+func TestFilesDeleteFile(t *testing.T) {
+	base := mustMakeFile(`syntax:"proto2" name:"base.proto" package:"a.b"
+		message_type:[{name:"Base" extension_range:[{start:100 end:200}]}]
+		enum_type:[{name:"Enum" value:[{name:"ONE" number:1}]}]`)
+	other := mustMakeFile(`syntax:"proto2" name:"other.proto" package:"a"
+		message_type:[{name:"Other"}]`)
+
+	var files preg.Files
+	for _, fd := range []pref.FileDescriptor{base, other} {
+		if err := files.RegisterFile(fd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pb := new(descriptorpb.FileDescriptorProto)
+	if err := prototext.Unmarshal([]byte(`syntax:"proto2" name:"ext.proto" package:"a.b" dependency:"base.proto"
+		extension:[{name:"ext" number:100 label:LABEL_OPTIONAL type:TYPE_INT32 extendee:".a.b.Base"}]`), pb); err != nil {
+		t.Fatal(err)
+	}
+	ext, err := pdesc.NewFile(pb, &files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := files.RegisterFile(ext); err != nil {
+		t.Fatal(err)
+	}
+	if got := files.NumExtensionsByMessage("a.b.Base"); got != 1 {
+		t.Errorf("NumExtensionsByMessage(a.b.Base) = %d, want 1", got)
+	}
+	if err := files.DeleteFile("missing.proto"); err != preg.NotFound {
+		t.Errorf("DeleteFile(missing.proto) = %v, want NotFound", err)
+	}
+	if err := files.DeleteFile("ext.proto"); err != nil {
+		t.Fatalf("DeleteFile(ext.proto) = %v", err)
+	}
+	if got := files.NumExtensionsByMessage("a.b.Base"); got != 0 {
+		t.Errorf("NumExtensionsByMessage(a.b.Base) = %d, want 0", got)
+	}
+	if err := files.DeleteFile("base.proto"); err != nil {
+		t.Fatalf("DeleteFile(base.proto) = %v", err)
+	}
+	for _, name := range []pref.FullName{"a.b.Base", "a.b.Enum", "a.b.ONE", "a.b.ext"} {
+		if _, err := files.FindDescriptorByName(name); err != preg.NotFound {
+			t.Errorf("FindDescriptorByName(%v) after delete = %v, want NotFound", name, err)
+		}
+	}
+	if _, err := files.FindDescriptorByName("a.Other"); err != nil {
+		t.Errorf("FindDescriptorByName(a.Other) = %v, want found", err)
+	}
+	if got := files.NumFiles(); got != 1 {
+		t.Errorf("NumFiles() = %d, want 1", got)
+	}
+	if got := files.NumFilesByPackage("a.b"); got != 0 {
+		t.Errorf("NumFilesByPackage(a.b) = %d, want 0", got)
+	}
+
+	// The deleted declarations and the unused package name may be
+	// registered again.
+	for _, fd := range []pref.FileDescriptor{
+		mustMakeFile(`syntax:"proto2" name:"b.proto" package:"a" message_type:[{name:"b"}]`),
+		mustMakeFile(`syntax:"proto2" name:"base.proto" package:"x" message_type:[{name:"Base"}]`),
+	} {
+		if err := files.RegisterFile(fd); err != nil {
+			t.Errorf("RegisterFile(%v) = %v", fd.Path(), err)
+		}
+	}
+	if got := files.NumFilesByPackage("a"); got != 2 {
+		t.Errorf("NumFilesByPackage(a) = %d, want 2", got)
+	}
+}
+
+func TestFilesReplaceFile(t *testing.T) {
+	v1 := mustMakeFile(`syntax:"proto2" name:"plugin.proto" package:"plugin" message_type:[{name:"Old"}]`)
+	v2 := mustMakeFile(`syntax:"proto2" name:"plugin.proto" package:"plugin" message_type:[{name:"New"}]`)
+	taken := mustMakeFile(`syntax:"proto2" name:"taken.proto" package:"taken" message_type:[{name:"M"}]`)
+	bad := mustMakeFile(`syntax:"proto2" name:"plugin.proto" package:"taken" message_type:[{name:"M"}]`)
+
+	var files preg.Files
+	if err := files.ReplaceFile(v1); err != nil {
+		t.Fatalf("ReplaceFile(v1) = %v", err)
+	}
+	if err := files.RegisterFile(taken); err != nil {
+		t.Fatal(err)
+	}
+	if err := files.ReplaceFile(v2); err != nil {
+		t.Fatalf("ReplaceFile(v2) = %v", err)
+	}
+	if _, err := files.FindDescriptorByName("plugin.Old"); err != preg.NotFound {
+		t.Errorf("FindDescriptorByName(plugin.Old) = %v, want NotFound", err)
+	}
+	if _, err := files.FindDescriptorByName("plugin.New"); err != nil {
+		t.Errorf("FindDescriptorByName(plugin.New) = %v", err)
+	}
+
+	// A conflicting replacement leaves the previous file registered.
+	if err := files.ReplaceFile(bad); err == nil {
+		t.Errorf("ReplaceFile(bad) succeeded, want conflict")
+	}
+	if fd, _ := files.FindFileByPath("plugin.proto"); fd != v2 {
+		t.Errorf("FindFileByPath(plugin.proto) = %v, want v2", fd)
+	}
+	if _, err := files.FindDescriptorByName("plugin.New"); err != nil {
+		t.Errorf("FindDescriptorByName(plugin.New) = %v", err)
+	}
+}
+
+func TestTypesDeleteType(t *testing.T) {
+	mt1 := pimpl.Export{}.MessageTypeOf(&testpb.Message1{})
+	et1 := pimpl.Export{}.EnumTypeOf(testpb.Enum1_ONE)
+	xt1 := testpb.E_StringField
+	registry := new(preg.Types)
+	for _, err := range []error{
+		registry.RegisterMessage(mt1),
+		registry.RegisterEnum(et1),
+		registry.RegisterExtension(xt1),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, typ := range []pref.Descriptor{mt1.Descriptor(), et1.Descriptor(), xt1.TypeDescriptor()} {
+		if err := registry.DeleteType(typ.FullName()); err != nil {
+			t.Errorf("DeleteType(%v) = %v", typ.FullName(), err)
+		}
+	}
+	if err := registry.DeleteType(mt1.Descriptor().FullName()); err != preg.NotFound {
+		t.Errorf("DeleteType(%v) again = %v, want NotFound", mt1.Descriptor().FullName(), err)
+	}
+	if n := registry.NumMessages() + registry.NumEnums() + registry.NumExtensions(); n != 0 {
+		t.Errorf("registry has %d types after deleting all, want 0", n)
+	}
+	xd := xt1.TypeDescriptor()
+	if _, err := registry.FindExtensionByNumber(xd.ContainingMessage().FullName(), xd.Number()); err != preg.NotFound {
+		t.Errorf("FindExtensionByNumber(%v) = %v, want NotFound", xd.FullName(), err)
+	}
+	if err := registry.RegisterExtension(xt1); err != nil {
+		t.Errorf("RegisterExtension(%v) after delete = %v", xd.FullName(), err)
+	}
+}
+
+// testProvider provides files built from the FileDescriptorProtos in text
+// form, recording how many times it builds each file.
+type testProvider struct {
+	r     *preg.Files
+	files map[string]string
+	names map[pref.FullName]string // top-level names to file paths
+
+	mu     sync.Mutex
+	builds map[string]int
+}
+
+func (p *testProvider) ProvideFileByPath(path string) (pref.FileDescriptor, error) {
+	s, ok := p.files[path]
+	if !ok {
+		return nil, preg.NotFound
+	}
+	pb := new(descriptorpb.FileDescriptorProto)
+	if err := prototext.Unmarshal([]byte(s), pb); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.builds[path]++
+	p.mu.Unlock()
+	return pdesc.NewFile(pb, p.r)
+}
+
+func (p *testProvider) ProvideFileByName(name pref.FullName) (pref.FileDescriptor, error) {
+	for ; name != ""; name = name.Parent() {
+		if path, ok := p.names[name]; ok {
+			return p.ProvideFileByPath(path)
+		}
+	}
+	return nil, preg.NotFound
+}
+
+func TestFilesRegisterProvider(t *testing.T) {
+	files := new(preg.Files)
+	p := &testProvider{
+		r: files,
+		files: map[string]string{
+			"a.proto": `
+				name:"a.proto" package:"a" dependency:"b.proto"
+				message_type:[{name:"A" field:[{name:"b" number:1 label:LABEL_OPTIONAL type:TYPE_MESSAGE type_name:".b.B"}]}]
+			`,
+			"b.proto": `
+				name:"b.proto" package:"b"
+				message_type:[{name:"B"}]
+				enum_type:[{name:"E" value:[{name:"V" number:0}]}]
+			`,
+		},
+		names:  map[pref.FullName]string{"a.A": "a.proto", "b.B": "b.proto", "b.E": "b.proto", "b.V": "b.proto"},
+		builds: map[string]int{},
+	}
+	files.RegisterProvider(p)
+	if n := files.NumFiles(); n != 0 {
+		t.Errorf("NumFiles() = %d before any lookup, want 0", n)
+	}
+
+	// Looking up a name provides its file and the files it imports.
+	d, err := files.FindDescriptorByName("a.A.b")
+	if err != nil {
+		t.Fatalf("FindDescriptorByName(a.A.b) = %v", err)
+	}
+	if got := d.(pref.FieldDescriptor).Message().FullName(); got != "b.B" {
+		t.Errorf("field a.A.b has message type %v, want b.B", got)
+	}
+	if n := files.NumFiles(); n != 2 {
+		t.Errorf("NumFiles() = %d, want 2", n)
+	}
+	if _, err := files.FindDescriptorByName("b.V"); err != nil {
+		t.Errorf("FindDescriptorByName(b.V) = %v", err)
+	}
+	if _, err := files.FindFileByPath("a.proto"); err != nil {
+		t.Errorf("FindFileByPath(a.proto) = %v", err)
+	}
+	for path, n := range p.builds {
+		if n != 1 {
+			t.Errorf("file %v built %d times, want 1", path, n)
+		}
+	}
+
+	// Lookups that the providers cannot satisfy report NotFound.
+	if _, err := files.FindDescriptorByName("c.C"); err != preg.NotFound {
+		t.Errorf("FindDescriptorByName(c.C) = %v, want NotFound", err)
+	}
+	if _, err := files.FindFileByPath("c.proto"); err != preg.NotFound {
+		t.Errorf("FindFileByPath(c.proto) = %v, want NotFound", err)
+	}
+
+	// Errors from the providers are returned.
+	p.files["c.proto"] = `name:"c.proto" dependency:"missing.proto"`
+	if _, err := files.FindFileByPath("c.proto"); err == nil || err == preg.NotFound {
+		t.Errorf("FindFileByPath(c.proto) = %v, want an error", err)
+	}
+}
+
+func TestFilesRegisterProviderConcurrent(t *testing.T) {
+	files := new(preg.Files)
+	files.RegisterProvider(&testProvider{
+		r: files,
+		files: map[string]string{
+			"a.proto": `
+				name:"a.proto" package:"a" dependency:"b.proto"
+				message_type:[{name:"A" field:[{name:"b" number:1 label:LABEL_OPTIONAL type:TYPE_MESSAGE type_name:".b.B"}]}]
+			`,
+			"b.proto": `name:"b.proto" package:"b" message_type:[{name:"B"}]`,
+		},
+		names:  map[pref.FullName]string{"a.A": "a.proto", "b.B": "b.proto"},
+		builds: map[string]int{},
+	})
+
+	// Lookups that miss register the provided files while other
+	// lookups read the registry.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := files.FindDescriptorByName("a.A.b"); err != nil {
+				t.Errorf("FindDescriptorByName(a.A.b) = %v", err)
+			}
+			if _, err := files.FindFileByPath("b.proto"); err != nil {
+				t.Errorf("FindFileByPath(b.proto) = %v", err)
+			}
+			files.RangeFiles(func(pref.FileDescriptor) bool { return true })
+		}()
+	}
+	wg.Wait()
+	if n := files.NumFiles(); n != 2 {
+		t.Errorf("NumFiles() = %d, want 2", n)
+	}
+}
+
+// errorResolver is a resolver that fails every lookup.
+type errorResolver struct{ err error }
+
+func (r errorResolver) FindMessageByName(pref.FullName) (pref.MessageType, error) {
+	return nil, r.err
+}
+
+func TestMultiResolver(t *testing.T) {
+	mt1 := pimpl.Export{}.MessageTypeOf(&testpb.Message1{})
+	dmt1 := dynamicpb.NewMessageType(mt1.Descriptor())
+	et1 := pimpl.Export{}.EnumTypeOf(testpb.Enum1_ONE)
+	xt1 := testpb.E_StringField
+
+	local := new(preg.Types)
+	if err := local.RegisterMessage(dmt1); err != nil {
+		t.Fatal(err)
+	}
+	global := new(preg.Types)
+	for _, err := range []error{
+		global.RegisterMessage(mt1),
+		global.RegisterEnum(et1),
+		global.RegisterExtension(xt1),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := new(preg.Files)
+	if err := files.RegisterFile(testpb.File_internal_testprotos_registry_test_proto); err != nil {
+		t.Fatal(err)
+	}
+	remoteErr := fmt.Errorf("remote unavailable")
+	r := preg.MultiResolver{local, files, global, errorResolver{remoteErr}}
+
+	// Earlier registries take precedence.
+	if mt, err := r.FindMessageByName(mt1.Descriptor().FullName()); err != nil || mt != dmt1 {
+		t.Errorf("FindMessageByName(%v) = (%v, %v), want the local type", mt1.Descriptor().FullName(), mt, err)
+	}
+	if mt, err := r.FindMessageByURL("type.googleapis.com/" + string(mt1.Descriptor().FullName())); err != nil || mt != dmt1 {
+		t.Errorf("FindMessageByURL(%v) = (%v, %v), want the local type", mt1.Descriptor().FullName(), mt, err)
+	}
+	// Lookups fall through to later registries.
+	if et, err := r.FindEnumByName(et1.Descriptor().FullName()); err != nil || et != et1 {
+		t.Errorf("FindEnumByName(%v) = (%v, %v), want %v", et1.Descriptor().FullName(), et, err, et1)
+	}
+	xd := xt1.TypeDescriptor()
+	if xt, err := r.FindExtensionByName(xd.FullName()); err != nil || xt != xt1 {
+		t.Errorf("FindExtensionByName(%v) = (%v, %v), want %v", xd.FullName(), xt, err, xt1)
+	}
+	if xt, err := r.FindExtensionByNumber(xd.ContainingMessage().FullName(), xd.Number()); err != nil || xt != xt1 {
+		t.Errorf("FindExtensionByNumber(%v) = (%v, %v), want %v", xd.FullName(), xt, err, xt1)
+	}
+	if fd, err := r.FindFileByPath(testpb.File_internal_testprotos_registry_test_proto.Path()); err != nil || fd != testpb.File_internal_testprotos_registry_test_proto {
+		t.Errorf("FindFileByPath() = (%v, %v), want the registered file", fd, err)
+	}
+	if d, err := r.FindDescriptorByName(mt1.Descriptor().FullName()); err != nil || d != mt1.Descriptor() {
+		t.Errorf("FindDescriptorByName(%v) = (%v, %v), want %v", mt1.Descriptor().FullName(), d, err, mt1.Descriptor())
+	}
+	// Registries that lack a method are skipped.
+	if _, err := r.FindExtensionByName("foo.bar"); err != preg.NotFound {
+		t.Errorf("FindExtensionByName(foo.bar) = %v, want NotFound", err)
+	}
+	// Errors other than NotFound are returned.
+	if _, err := r.FindMessageByName("foo.Bar"); err != remoteErr {
+		t.Errorf("FindMessageByName(foo.Bar) = %v, want %v", err, remoteErr)
+	}
+	if _, err := (preg.MultiResolver{}).FindFileByPath("foo.proto"); err != preg.NotFound {
+		t.Errorf("empty FindFileByPath(foo.proto) = %v, want NotFound", err)
+	}
+}
+
+func TestFilesClone(t *testing.T) {
+	fd1 := mustMakeFile(`name:"a.proto" package:"foo" message_type:[{name:"A"}]`)
+	fd2 := mustMakeFile(`name:"b.proto" package:"foo" message_type:[{name:"B"}]`)
+	fd3 := mustMakeFile(`name:"c.proto" package:"bar" message_type:[{name:"C"}]`)
+	files := new(preg.Files)
+	if err := files.RegisterFile(fd1); err != nil {
+		t.Fatal(err)
+	}
+	clone := files.Clone()
+	if err := clone.RegisterFile(fd2); err != nil {
+		t.Fatal(err)
+	}
+	if err := files.RegisterFile(fd3); err != nil {
+		t.Fatal(err)
+	}
+	if err := clone.DeleteFile("a.proto"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		files *preg.Files
+		name  string
+		found map[string]bool
+	}{
+		{files, "original", map[string]bool{"a.proto": true, "b.proto": false, "c.proto": true}},
+		{clone, "clone", map[string]bool{"a.proto": false, "b.proto": true, "c.proto": false}},
+	} {
+		for path, want := range tt.found {
+			if _, err := tt.files.FindFileByPath(path); (err == nil) != want {
+				t.Errorf("%v: FindFileByPath(%v) = %v, want found %v", tt.name, path, err, want)
+			}
+		}
+	}
+	if n := files.NumFilesByPackage("foo"); n != 1 {
+		t.Errorf("original: NumFilesByPackage(foo) = %d, want 1", n)
+	}
+	if n := clone.NumFilesByPackage("foo"); n != 1 {
+		t.Errorf("clone: NumFilesByPackage(foo) = %d, want 1", n)
+	}
+	if n := new(preg.Files).Clone().NumFiles(); n != 0 {
+		t.Errorf("clone of empty registry: NumFiles() = %d, want 0", n)
+	}
+}
+
+func TestTypesClone(t *testing.T) {
+	mt1 := pimpl.Export{}.MessageTypeOf(&testpb.Message1{})
+	et1 := pimpl.Export{}.EnumTypeOf(testpb.Enum1_ONE)
+	xt1 := testpb.E_StringField
+	xt2 := testpb.E_Message4_MessageField
+	registry := new(preg.Types)
+	if err := registry.RegisterMessage(mt1); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.RegisterExtension(xt1); err != nil {
+		t.Fatal(err)
+	}
+	clone := registry.Clone()
+	if err := clone.RegisterEnum(et1); err != nil {
+		t.Fatal(err)
+	}
+	if err := clone.RegisterExtension(xt2); err != nil {
+		t.Fatal(err)
+	}
+	if err := clone.DeleteType(mt1.Descriptor().FullName()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := registry.FindMessageByName(mt1.Descriptor().FullName()); err != nil {
+		t.Errorf("original: FindMessageByName(%v) = %v", mt1.Descriptor().FullName(), err)
+	}
+	if _, err := registry.FindEnumByName(et1.Descriptor().FullName()); err != preg.NotFound {
+		t.Errorf("original: FindEnumByName(%v) = %v, want NotFound", et1.Descriptor().FullName(), err)
+	}
+	xd2 := xt2.TypeDescriptor()
+	if n := registry.NumExtensionsByMessage(xd2.ContainingMessage().FullName()); n != 1 {
+		t.Errorf("original: NumExtensionsByMessage(%v) = %d, want 1", xd2.ContainingMessage().FullName(), n)
+	}
+	if _, err := clone.FindMessageByName(mt1.Descriptor().FullName()); err != preg.NotFound {
+		t.Errorf("clone: FindMessageByName(%v) = %v, want NotFound", mt1.Descriptor().FullName(), err)
+	}
+	if _, err := clone.FindExtensionByNumber(xd2.ContainingMessage().FullName(), xd2.Number()); err != nil {
+		t.Errorf("clone: FindExtensionByNumber(%v) = %v", xd2.FullName(), err)
+	}
+	if got, want := [3]int{clone.NumMessages(), clone.NumEnums(), clone.NumExtensions()}, [3]int{0, 1, 2}; got != want {
+		t.Errorf("clone: (NumMessages, NumEnums, NumExtensions) = %v, want %v", got, want)
+	}
+	if got, want := [3]int{registry.NumMessages(), registry.NumEnums(), registry.NumExtensions()}, [3]int{1, 0, 1}; got != want {
+		t.Errorf("original: (NumMessages, NumEnums, NumExtensions) = %v, want %v", got, want)
+	}
+}
+
+// TestCloneConcurrent tests that a registry may be cloned by multiple
+// goroutines at once. Run with -race.
+func TestCloneConcurrent(t *testing.T) {
+	files := new(preg.Files)
+	if err := files.RegisterFile(mustMakeFile(`name:"a.proto" package:"foo" message_type:[{name:"A"}]`)); err != nil {
+		t.Fatal(err)
+	}
+	types := new(preg.Types)
+	if err := types.RegisterMessage(pimpl.Export{}.MessageTypeOf(&testpb.Message1{})); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fd := mustMakeFile(fmt.Sprintf(`name:"b%d.proto" package:"foo" message_type:[{name:"B%d"}]`, i, i))
+			fc := files.Clone()
+			if err := fc.RegisterFile(fd); err != nil {
+				t.Error(err)
+			}
+			if n := fc.NumFilesByPackage("foo"); n != 2 {
+				t.Errorf("clone: NumFilesByPackage(foo) = %d, want 2", n)
+			}
+			tc := types.Clone()
+			if err := tc.RegisterEnum(pimpl.Export{}.EnumTypeOf(testpb.Enum1_ONE)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := files.NumFilesByPackage("foo"); n != 1 {
+		t.Errorf("original: NumFilesByPackage(foo) = %d, want 1", n)
+	}
+	if n := types.NumEnums(); n != 0 {
+		t.Errorf("original: NumEnums() = %d, want 0", n)
+	}
+}
+
+func TestConflictProvenance(t *testing.T) {
+	files := new(preg.Files)
+	if err := files.RegisterFile(mustMakeFile(`name:"a.proto" package:"foo" message_type:[{name:"A"}]`)); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		file string
+		want string
+	}{{
+		file: `name:"b.proto" package:"foo" message_type:[{name:"A"}]`,
+		want: `previously declared in file: "a.proto"`,
+	}, {
+		file: `name:"c.proto" package:"foo.A.bar"`,
+		want: `previously declared in file: "a.proto"`,
+	}, {
+		file: `name:"d.proto" message_type:[{name:"foo"}]`,
+		want: `previously declared as a package by file: "a.proto"`,
+	}} {
+		err := files.RegisterFile(mustMakeFile(tt.file))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("RegisterFile(%v) = %v, want error containing %q", tt.file, err, tt.want)
+		}
+	}
+
+	mt1 := pimpl.Export{}.MessageTypeOf(&testpb.Message1{})
+	types := new(preg.Types)
+	if err := types.RegisterMessage(mt1); err != nil {
+		t.Fatal(err)
+	}
+	md := mustMakeFile(`name:"other.proto" package:"testprotos" message_type:[{name:"Message1"}]`).Messages().Get(0)
+	err := types.RegisterMessage(dynamicpb.NewMessageType(md))
+	for _, want := range []string{
+		`previously declared in file: "internal/testprotos/registry/test.proto"`,
+		`previously from: "google.golang.org/protobuf/internal/testprotos/registry"`,
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("RegisterMessage(%v) = %v, want error containing %q", md.FullName(), err, want)
+		}
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	files := new(preg.Files)
+	if err := files.RegisterFile(mustMakeFile(`name:"a.proto" package:"foo" message_type:[{name:"A" nested_type:[{name:"B"}]}]`)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := files.Provenance("foo.A.B")
+	if want := (preg.Provenance{File: "a.proto", Package: "foo"}); err != nil || got != want {
+		t.Errorf("Files.Provenance(foo.A.B) = (%+v, %v), want %+v", got, err, want)
+	}
+	if _, err := files.Provenance("foo.C"); err != preg.NotFound {
+		t.Errorf("Files.Provenance(foo.C) = %v, want NotFound", err)
+	}
+
+	mt1 := pimpl.Export{}.MessageTypeOf(&testpb.Message1{})
+	types := new(preg.Types)
+	if err := types.RegisterMessage(mt1); err != nil {
+		t.Fatal(err)
+	}
+	got, err = types.Provenance(mt1.Descriptor().FullName())
+	want := preg.Provenance{
+		File:          "internal/testprotos/registry/test.proto",
+		Package:       "testprotos",
+		GoPackagePath: "google.golang.org/protobuf/internal/testprotos/registry",
+	}
+	if err != nil || got != want {
+		t.Errorf("Types.Provenance(%v) = (%+v, %v), want %+v", mt1.Descriptor().FullName(), got, err, want)
+	}
+	if _, err := types.Provenance("foo.C"); err != preg.NotFound {
+		t.Errorf("Types.Provenance(foo.C) = %v, want NotFound", err)
+	}
+}
+
+func TestFilesWatch(t *testing.T) {
+	files := new(preg.Files)
+	var got []string
+	stop := files.Watch(func(fd pref.FileDescriptor) {
+		// The registration is complete when watchers are called.
+		if _, err := files.FindFileByPath(fd.Path()); err != nil {
+			t.Errorf("FindFileByPath(%v) in watcher = %v", fd.Path(), err)
+		}
+		got = append(got, fd.Path())
+	})
+	fd1 := mustMakeFile(`name:"a.proto" package:"foo" message_type:[{name:"A"}]`)
+	if err := files.RegisterFile(fd1); err != nil {
+		t.Fatal(err)
+	}
+	if err := files.RegisterFile(mustMakeFile(`name:"b.proto" package:"foo" message_type:[{name:"A"}]`)); err == nil {
+		t.Fatal("RegisterFile(b.proto) succeeded, want conflict")
+	}
+	if err := files.ReplaceFile(mustMakeFile(`name:"a.proto" package:"foo" message_type:[{name:"A2"}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := files.DeleteFile("a.proto"); err != nil {
+		t.Fatal(err)
+	}
+	files.Clone().RegisterFile(fd1)
+	stop()
+	files.RegisterFile(fd1)
+	if want := []string{"a.proto", "a.proto"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("watched files = %v, want %v", got, want)
+	}
+}
+
+func TestTypesWatch(t *testing.T) {
+	mt1 := pimpl.Export{}.MessageTypeOf(&testpb.Message1{})
+	et1 := pimpl.Export{}.EnumTypeOf(testpb.Enum1_ONE)
+	xt1 := testpb.E_StringField
+	registry := new(preg.Types)
+	var got []interface{}
+	stop := registry.Watch(func(typ interface{}) {
+		got = append(got, typ)
+	})
+	for _, err := range []error{
+		registry.RegisterMessage(mt1),
+		registry.RegisterEnum(et1),
+		registry.RegisterExtension(xt1),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := registry.RegisterMessage(mt1); err == nil {
+		t.Fatal("RegisterMessage succeeded twice, want conflict")
+	}
+	stop()
+	registry.DeleteType(mt1.Descriptor().FullName())
+	registry.RegisterMessage(mt1)
+	if len(got) != 3 || got[0] != mt1 || got[1] != et1 || got[2] != xt1 {
+		t.Errorf("watched types = %v, want [%v %v %v]", got, mt1, et1, xt1)
+	}
+}
+
+func TestFilesRangeFilesByPackagePrefix(t *testing.T) {
+	files := new(preg.Files)
+	for _, s := range []string{
+		`name:"a.proto" package:"foo"`,
+		`name:"b.proto" package:"foo.bar"`,
+		`name:"c.proto" package:"foo.bar.baz"`,
+		`name:"d.proto" package:"foobar"`,
+		`name:"e.proto"`,
+	} {
+		if err := files.RegisterFile(mustMakeFile(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sortStrings := cmpopts.SortSlices(func(x, y string) bool { return x < y })
+	for _, tt := range []struct {
+		prefix pref.FullName
+		want   []string
+	}{
+		{"foo", []string{"a.proto", "b.proto", "c.proto"}},
+		{"foo.bar", []string{"b.proto", "c.proto"}},
+		{"foo.ba", nil},
+		{"", []string{"a.proto", "b.proto", "c.proto", "d.proto", "e.proto"}},
+	} {
+		var got []string
+		files.RangeFilesByPackagePrefix(tt.prefix, func(fd pref.FileDescriptor) bool {
+			got = append(got, fd.Path())
+			return true
+		})
+		if diff := cmp.Diff(tt.want, got, sortStrings); diff != "" {
+			t.Errorf("RangeFilesByPackagePrefix(%q) mismatch (-want +got):\n%v", tt.prefix, diff)
+		}
+	}
+}
+
+func TestTypesRangeMessagesByPackage(t *testing.T) {
+	registry := new(preg.Types)
+	md := mustMakeFile(`name:"a.proto" package:"testprotos.sub" message_type:[{name:"A"}]`).Messages().Get(0)
+	for _, mt := range []pref.MessageType{
+		pimpl.Export{}.MessageTypeOf(&testpb.Message1{}),
+		pimpl.Export{}.MessageTypeOf(&testpb.Message4{}),
+		dynamicpb.NewMessageType(md),
+	} {
+		if err := registry.RegisterMessage(mt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := registry.RegisterEnum(pimpl.Export{}.EnumTypeOf(testpb.Enum1_ONE)); err != nil {
+		t.Fatal(err)
+	}
+	sortNames := cmpopts.SortSlices(func(x, y pref.FullName) bool { return x < y })
+	for _, tt := range []struct {
+		pkg  pref.FullName
+		want []pref.FullName
+	}{
+		{"testprotos", []pref.FullName{"testprotos.Message1", "testprotos.Message4"}},
+		{"testprotos.sub", []pref.FullName{"testprotos.sub.A"}},
+		{"other", nil},
+	} {
+		var got []pref.FullName
+		registry.RangeMessagesByPackage(tt.pkg, func(mt pref.MessageType) bool {
+			got = append(got, mt.Descriptor().FullName())
+			return true
+		})
+		if diff := cmp.Diff(tt.want, got, sortNames); diff != "" {
+			t.Errorf("RangeMessagesByPackage(%q) mismatch (-want +got):\n%v", tt.pkg, diff)
+		}
+	}
+}
+
+func TestStrictDrift(t *testing.T) {
+	const a = `name:"a.proto" package:"foo" message_type:[{name:"A" field:[{name:"x" number:1 label:LABEL_OPTIONAL type:TYPE_INT32}]}]`
+	fdA := mustMakeFile(a)
+	fdB := mustMakeFile(`name:"b.proto" package:"foo" message_type:[{name:"A" field:[
+		{name:"x" number:1 label:LABEL_OPTIONAL type:TYPE_INT64},
+		{name:"y" number:2 label:LABEL_OPTIONAL type:TYPE_STRING}
+	]}]`)
+	fdC := mustMakeFile(strings.Replace(a, "a.proto", "c.proto", 1))
+	fdA2 := mustMakeFile(strings.Replace(a, "TYPE_INT32", "TYPE_SINT32", 1))
+
+	files := new(preg.Files)
+	files.SetStrict(true)
+	if err := files.RegisterFile(fdA); err != nil {
+		t.Fatal(err)
+	}
+	err := files.RegisterFile(fdB)
+	derr, ok := err.(*preg.DriftError)
+	if !ok {
+		t.Fatalf("RegisterFile(b.proto) = %v, want *DriftError", err)
+	}
+	want := &preg.DriftError{
+		Name: "foo.A",
+		Path: "b.proto",
+		Prev: preg.Provenance{File: "a.proto", Package: "foo"},
+		Curr: preg.Provenance{File: "b.proto", Package: "foo"},
+		Differences: []string{
+			"changed foo.A.x: kind changed from int32 to int64",
+			"added foo.A.y",
+		},
+	}
+	if diff := cmp.Diff(want, derr); diff != "" {
+		t.Errorf("RegisterFile(b.proto) mismatch (-want +got):\n%v", diff)
+	}
+	if !strings.Contains(err.Error(), `previously declared in file: "a.proto"`) {
+		t.Errorf("RegisterFile(b.proto) = %v, want the previous file", err)
+	}
+	if err := files.RegisterFile(fdA2); err == nil {
+		t.Errorf("RegisterFile(a.proto) succeeded twice")
+	} else if derr, ok := err.(*preg.DriftError); !ok || derr.Name != "" || derr.Path != "a.proto" {
+		t.Errorf("RegisterFile(a.proto) = %v, want *DriftError over the path", err)
+	}
+	// Conflicts over identical contents are not drift.
+	if err := files.RegisterFile(fdC); err == nil {
+		t.Errorf("RegisterFile(c.proto) succeeded, want conflict")
+	} else if _, ok := err.(*preg.DriftError); ok {
+		t.Errorf("RegisterFile(c.proto) = %v, want a conflict that is not drift", err)
+	}
+	// Drift is not reported in normal mode.
+	files = new(preg.Files)
+	if err := files.RegisterFile(fdA); err != nil {
+		t.Fatal(err)
+	}
+	if err := files.RegisterFile(fdB); err == nil {
+		t.Errorf("RegisterFile(b.proto) succeeded, want conflict")
+	} else if _, ok := err.(*preg.DriftError); ok {
+		t.Errorf("RegisterFile(b.proto) = %v in normal mode, want a conflict that is not drift", err)
+	}
+
+	types := new(preg.Types)
+	types.SetStrict(true)
+	if err := types.RegisterMessage(dynamicpb.NewMessageType(fdA.Messages().Get(0))); err != nil {
+		t.Fatal(err)
+	}
+	err = types.RegisterMessage(dynamicpb.NewMessageType(fdB.Messages().Get(0)))
+	if derr, ok := err.(*preg.DriftError); !ok || derr.Name != "foo.A" || len(derr.Differences) != 2 {
+		t.Errorf("RegisterMessage(foo.A) = %v, want *DriftError with 2 differences", err)
+	}
+	err = types.RegisterMessage(dynamicpb.NewMessageType(fdC.Messages().Get(0)))
+	if _, ok := err.(*preg.DriftError); ok || err == nil {
+		t.Errorf("RegisterMessage(foo.A) = %v, want a conflict that is not drift", err)
+	}
+}
+
+func TestStrictDriftMatchesDiffFiles(t *testing.T) {
+	// Fields are matched by number, and bytes defaults are quoted.
+	fdA := mustMakeFile(`name:"a.proto" package:"foo" message_type:[{name:"A" field:[
+		{name:"x" number:1 label:LABEL_OPTIONAL type:TYPE_BYTES default_value:"\\001\\002"}
+	]}]`)
+	fdB := mustMakeFile(`name:"b.proto" package:"foo" message_type:[{name:"A" field:[
+		{name:"z" number:1 label:LABEL_OPTIONAL type:TYPE_BYTES default_value:"\\003"}
+	]}]`)
+	var want []string
+	for _, c := range pdesc.DiffFiles(fdA, fdB) {
+		want = append(want, c.String())
+	}
+	if len(want) != 3 {
+		t.Fatalf("DiffFiles = %q, want 3 changes to foo.A.z", want)
+	}
+
+	files := new(preg.Files)
+	files.SetStrict(true)
+	if err := files.RegisterFile(fdA); err != nil {
+		t.Fatal(err)
+	}
+	err := files.RegisterFile(fdB)
+	derr, ok := err.(*preg.DriftError)
+	if !ok {
+		t.Fatalf("RegisterFile(b.proto) = %v, want *DriftError", err)
+	}
+	if diff := cmp.Diff(want, derr.Differences); diff != "" {
+		t.Errorf("DriftError.Differences mismatch with DiffFiles (-want +got):\n%v", diff)
+	}
+}
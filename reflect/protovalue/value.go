@@ -0,0 +1,285 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package protovalue converts between protoreflect.Value and native Go values
+// according to the kind of a field.
+//
+// The Go types used for each kind are:
+//
+//	╔════════════════════════════════════════╤═══════════════════════════════╗
+//	║ Kind                                   │ Go type                       ║
+//	╠════════════════════════════════════════╪═══════════════════════════════╣
+//	║ BoolKind                               │ bool                          ║
+//	║ Int32Kind, Sint32Kind, Sfixed32Kind    │ int32                         ║
+//	║ Int64Kind, Sint64Kind, Sfixed64Kind    │ int64                         ║
+//	║ Uint32Kind, Fixed32Kind                │ uint32                        ║
+//	║ Uint64Kind, Fixed64Kind                │ uint64                        ║
+//	║ FloatKind                              │ float32                       ║
+//	║ DoubleKind                             │ float64                       ║
+//	║ StringKind                             │ string                        ║
+//	║ BytesKind                              │ []byte                        ║
+//	║ EnumKind                               │ protoreflect.EnumNumber       ║
+//	║ MessageKind, GroupKind                 │ protoreflect.ProtoMessage     ║
+//	╚════════════════════════════════════════╧═══════════════════════════════╝
+//
+// A repeated field is a slice of the element type, such as []int32, and a map
+// field is a Go map of the key and value types, such as map[string]int64.
+//
+// When converting to a protoreflect.Value, an enum may also be given as an
+// int32 or a protoreflect.Enum, and a message as a protoreflect.Message.
+// Repeated and map fields accept any slice or map whose elements convert.
+package protovalue
+
+import (
+	"reflect"
+
+	"google.golang.org/protobuf/internal/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Get returns the value of the field fd of m as a native Go value.
+func Get(m protoreflect.Message, fd protoreflect.FieldDescriptor) interface{} {
+	return Interface(fd, m.Get(fd))
+}
+
+// Set stores the native Go value v in the field fd of m. It reports an error
+// if v does not have a Go type for the kind of the field, in which case m
+// is unmodified. A nil slice, map, or message clears the field.
+func Set(m protoreflect.Message, fd protoreflect.FieldDescriptor, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	switch {
+	case fd.IsList():
+		if rv.Kind() != reflect.Slice {
+			return typeError(fd, v)
+		}
+		if rv.IsNil() {
+			m.Clear(fd)
+			return nil
+		}
+		lv := m.NewField(fd)
+		ls := lv.List()
+		for i := 0; i < rv.Len(); i++ {
+			ev, err := valueOf(fd, ls.NewElement, rv.Index(i).Interface())
+			if err != nil {
+				return err
+			}
+			ls.Append(ev)
+		}
+		m.Set(fd, lv)
+	case fd.IsMap():
+		if rv.Kind() != reflect.Map {
+			return typeError(fd, v)
+		}
+		if rv.IsNil() {
+			m.Clear(fd)
+			return nil
+		}
+		mv := m.NewField(fd)
+		mp := mv.Map()
+		for _, k := range rv.MapKeys() {
+			kv, err := valueOf(fd.MapKey(), nil, k.Interface())
+			if err != nil {
+				return err
+			}
+			vv, err := valueOf(fd.MapValue(), func() protoreflect.Value {
+				return mp.NewValue()
+			}, rv.MapIndex(k).Interface())
+			if err != nil {
+				return err
+			}
+			mp.Set(kv.MapKey(), vv)
+		}
+		m.Set(fd, mv)
+	default:
+		if isNilMessage(fd, rv) {
+			m.Clear(fd)
+			return nil
+		}
+		pv, err := valueOf(fd, func() protoreflect.Value { return m.NewField(fd) }, v)
+		if err != nil {
+			return err
+		}
+		m.Set(fd, pv)
+	}
+	return nil
+}
+
+// ValueOf converts the native Go value v to a value of the singular field fd,
+// which must not be a repeated or map field. It reports an error if v does
+// not have a Go type for the kind of the field.
+//
+// A message value is used as is, so it must be of the Go type used by the
+// message containing fd; see Set for storing a message of any type.
+func ValueOf(fd protoreflect.FieldDescriptor, v interface{}) (protoreflect.Value, error) {
+	if fd.IsList() || fd.IsMap() {
+		return protoreflect.Value{}, errors.New("field %v is not a singular field", fd.FullName())
+	}
+	return valueOf(fd, nil, v)
+}
+
+// Interface converts the value v of the field fd to a native Go value.
+// A repeated or map field is copied into a new slice or map.
+func Interface(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch {
+	case fd.IsList():
+		ls := v.List()
+		rv := reflect.MakeSlice(reflect.SliceOf(goType(fd)), ls.Len(), ls.Len())
+		for i := 0; i < ls.Len(); i++ {
+			rv.Index(i).Set(reflect.ValueOf(scalarInterface(fd, ls.Get(i))))
+		}
+		return rv.Interface()
+	case fd.IsMap():
+		mp := v.Map()
+		kd, vd := fd.MapKey(), fd.MapValue()
+		rv := reflect.MakeMapWithSize(reflect.MapOf(goType(kd), goType(vd)), mp.Len())
+		mp.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			rv.SetMapIndex(reflect.ValueOf(scalarInterface(kd, k.Value())), reflect.ValueOf(scalarInterface(vd, v)))
+			return true
+		})
+		return rv.Interface()
+	default:
+		return scalarInterface(fd, v)
+	}
+}
+
+// goTypes maps each kind to the Go type of a single value of that kind.
+var goTypes = map[protoreflect.Kind]reflect.Type{
+	protoreflect.BoolKind:     reflect.TypeOf(false),
+	protoreflect.EnumKind:     reflect.TypeOf(protoreflect.EnumNumber(0)),
+	protoreflect.Int32Kind:    reflect.TypeOf(int32(0)),
+	protoreflect.Sint32Kind:   reflect.TypeOf(int32(0)),
+	protoreflect.Sfixed32Kind: reflect.TypeOf(int32(0)),
+	protoreflect.Int64Kind:    reflect.TypeOf(int64(0)),
+	protoreflect.Sint64Kind:   reflect.TypeOf(int64(0)),
+	protoreflect.Sfixed64Kind: reflect.TypeOf(int64(0)),
+	protoreflect.Uint32Kind:   reflect.TypeOf(uint32(0)),
+	protoreflect.Fixed32Kind:  reflect.TypeOf(uint32(0)),
+	protoreflect.Uint64Kind:   reflect.TypeOf(uint64(0)),
+	protoreflect.Fixed64Kind:  reflect.TypeOf(uint64(0)),
+	protoreflect.FloatKind:    reflect.TypeOf(float32(0)),
+	protoreflect.DoubleKind:   reflect.TypeOf(float64(0)),
+	protoreflect.StringKind:   reflect.TypeOf(""),
+	protoreflect.BytesKind:    reflect.TypeOf([]byte(nil)),
+	protoreflect.MessageKind:  reflect.TypeOf((*protoreflect.ProtoMessage)(nil)).Elem(),
+	protoreflect.GroupKind:    reflect.TypeOf((*protoreflect.ProtoMessage)(nil)).Elem(),
+}
+
+// goType returns the Go type of a single value of the field fd.
+func goType(fd protoreflect.FieldDescriptor) reflect.Type {
+	return goTypes[fd.Kind()]
+}
+
+// scalarInterface converts a single value of the field fd to a native Go value.
+func scalarInterface(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		return v.Enum()
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return v.Message().Interface()
+	}
+	return v.Interface()
+}
+
+// valueOf converts a single native Go value v to a value of the field fd.
+// If newMessage is non-nil, it returns an empty message into which a message
+// of another Go type is merged.
+func valueOf(fd protoreflect.FieldDescriptor, newMessage func() protoreflect.Value, v interface{}) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		if v, ok := v.(bool); ok {
+			return protoreflect.ValueOfBool(v), nil
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if v, ok := v.(int32); ok {
+			return protoreflect.ValueOfInt32(v), nil
+		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if v, ok := v.(int64); ok {
+			return protoreflect.ValueOfInt64(v), nil
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if v, ok := v.(uint32); ok {
+			return protoreflect.ValueOfUint32(v), nil
+		}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if v, ok := v.(uint64); ok {
+			return protoreflect.ValueOfUint64(v), nil
+		}
+	case protoreflect.FloatKind:
+		if v, ok := v.(float32); ok {
+			return protoreflect.ValueOfFloat32(v), nil
+		}
+	case protoreflect.DoubleKind:
+		if v, ok := v.(float64); ok {
+			return protoreflect.ValueOfFloat64(v), nil
+		}
+	case protoreflect.StringKind:
+		if v, ok := v.(string); ok {
+			return protoreflect.ValueOfString(v), nil
+		}
+	case protoreflect.BytesKind:
+		if v, ok := v.([]byte); ok {
+			return protoreflect.ValueOfBytes(v), nil
+		}
+	case protoreflect.EnumKind:
+		switch v := v.(type) {
+		case protoreflect.EnumNumber:
+			return protoreflect.ValueOfEnum(v), nil
+		case int32:
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v)), nil
+		case protoreflect.Enum:
+			if v.Descriptor().FullName() != fd.Enum().FullName() {
+				return protoreflect.Value{}, errors.New("invalid enum %v for field %v of type %v", v.Descriptor().FullName(), fd.FullName(), fd.Enum().FullName())
+			}
+			return protoreflect.ValueOfEnum(v.Number()), nil
+		}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		var m protoreflect.Message
+		switch v := v.(type) {
+		case protoreflect.ProtoMessage:
+			m = v.ProtoReflect()
+		case protoreflect.Message:
+			m = v
+		default:
+			return protoreflect.Value{}, typeError(fd, v)
+		}
+		if m.Descriptor().FullName() != fd.Message().FullName() {
+			return protoreflect.Value{}, errors.New("invalid message %v for field %v of type %v", m.Descriptor().FullName(), fd.FullName(), fd.Message().FullName())
+		}
+		if newMessage != nil {
+			nv := newMessage()
+			if nm := nv.Message(); nm.Type() != m.Type() {
+				if m.IsValid() {
+					proto.Merge(nm.Interface(), m.Interface())
+				}
+				return nv, nil
+			}
+		}
+		return protoreflect.ValueOfMessage(m), nil
+	}
+	return protoreflect.Value{}, typeError(fd, v)
+}
+
+// isNilMessage reports whether rv is a nil message value of the field fd.
+func isNilMessage(fd protoreflect.FieldDescriptor, rv reflect.Value) bool {
+	if fd.Message() == nil {
+		return false
+	}
+	if !rv.IsValid() {
+		return true
+	}
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
+
+func typeError(fd protoreflect.FieldDescriptor, v interface{}) error {
+	kind := fd.Kind().String()
+	switch {
+	case fd.IsList():
+		kind = "repeated " + kind
+	case fd.IsMap():
+		kind = "map"
+	}
+	return errors.New("invalid type %T for field %v of kind %v", v, fd.FullName(), kind)
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protovalue_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protovalue"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	test3pb "google.golang.org/protobuf/internal/testprotos/test3"
+)
+
+func TestSetGet(t *testing.T) {
+	tests := []struct {
+		field protoreflect.Name
+		in    interface{}
+		want  interface{} // defaults to in
+	}{
+		{field: "singular_int32", in: int32(-5)},
+		{field: "singular_uint64", in: uint64(7)},
+		{field: "singular_float", in: float32(1.5)},
+		{field: "singular_string", in: "hello"},
+		{field: "singular_bytes", in: []byte("bytes")},
+		{field: "singular_nested_enum", in: protoreflect.EnumNumber(2)},
+		{field: "singular_nested_enum", in: int32(1), want: protoreflect.EnumNumber(1)},
+		{field: "singular_nested_enum", in: test3pb.TestAllTypes_BAR, want: protoreflect.EnumNumber(test3pb.TestAllTypes_BAR)},
+		{field: "singular_nested_message", in: &test3pb.TestAllTypes_NestedMessage{A: 3}},
+		{field: "repeated_int64", in: []int64{1, 2, 3}},
+		{field: "repeated_string", in: []string{"a", "b"}},
+		{field: "repeated_bytes", in: [][]byte{[]byte("a")}},
+		{field: "repeated_nested_enum", in: []test3pb.TestAllTypes_NestedEnum{test3pb.TestAllTypes_FOO, test3pb.TestAllTypes_BAZ}, want: []protoreflect.EnumNumber{0, 2}},
+		{field: "repeated_nested_message", in: []*test3pb.TestAllTypes_NestedMessage{{A: 1}, {A: 2}}, want: []protoreflect.ProtoMessage{
+			&test3pb.TestAllTypes_NestedMessage{A: 1},
+			&test3pb.TestAllTypes_NestedMessage{A: 2},
+		}},
+		{field: "map_int32_int32", in: map[int32]int32{1: 2, 3: 4}},
+		{field: "map_string_string", in: map[string]string{"k": "v"}},
+		{field: "map_bool_bool", in: map[bool]bool{true: false}},
+		{field: "map_string_nested_enum", in: map[string]protoreflect.EnumNumber{"k": 1}},
+		{field: "map_string_nested_message", in: map[string]*test3pb.TestAllTypes_NestedMessage{"k": {A: 5}}, want: map[string]protoreflect.ProtoMessage{
+			"k": &test3pb.TestAllTypes_NestedMessage{A: 5},
+		}},
+	}
+	for _, tt := range tests {
+		m := new(test3pb.TestAllTypes).ProtoReflect()
+		fd := m.Descriptor().Fields().ByName(tt.field)
+		if err := protovalue.Set(m, fd, tt.in); err != nil {
+			t.Errorf("Set(%v, %T): %v", tt.field, tt.in, err)
+			continue
+		}
+		want := tt.want
+		if want == nil {
+			want = tt.in
+		}
+		if got := protovalue.Get(m, fd); !cmp.Equal(got, want, protocmp.Transform()) {
+			t.Errorf("Get(%v) = %v, want %v", tt.field, got, want)
+		}
+	}
+}
+
+func TestSetDynamicMessage(t *testing.T) {
+	m := new(test3pb.TestAllTypes).ProtoReflect()
+	fd := m.Descriptor().Fields().ByName("repeated_nested_message")
+	dm := dynamicpb.NewMessage(fd.Message())
+	dm.Set(fd.Message().Fields().ByName("a"), protoreflect.ValueOfInt32(9))
+	if err := protovalue.Set(m, fd, []protoreflect.Message{dm}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	want := &test3pb.TestAllTypes{
+		RepeatedNestedMessage: []*test3pb.TestAllTypes_NestedMessage{{A: 9}},
+	}
+	if !proto.Equal(m.Interface(), want) {
+		t.Errorf("Set stored %v, want %v", m.Interface(), want)
+	}
+}
+
+func TestSetClear(t *testing.T) {
+	m := (&test3pb.TestAllTypes{
+		SingularNestedMessage: &test3pb.TestAllTypes_NestedMessage{A: 1},
+		RepeatedInt32:         []int32{1},
+	}).ProtoReflect()
+	fds := m.Descriptor().Fields()
+	if err := protovalue.Set(m, fds.ByName("singular_nested_message"), (*test3pb.TestAllTypes_NestedMessage)(nil)); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := protovalue.Set(m, fds.ByName("repeated_int32"), []int32(nil)); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if !proto.Equal(m.Interface(), &test3pb.TestAllTypes{}) {
+		t.Errorf("Set of nil values left %v", m.Interface())
+	}
+}
+
+func TestSetErrors(t *testing.T) {
+	tests := []struct {
+		field protoreflect.Name
+		in    interface{}
+		want  string
+	}{
+		{field: "singular_int32", in: int64(1), want: "invalid type int64"},
+		{field: "singular_int32", in: 1, want: "invalid type int"},
+		{field: "singular_string", in: []byte("x"), want: "of kind string"},
+		{field: "singular_nested_enum", in: test3pb.ForeignEnum_FOREIGN_FOO, want: "invalid enum goproto.proto.test3.ForeignEnum"},
+		{field: "singular_nested_message", in: &test3pb.ForeignMessage{}, want: "invalid message goproto.proto.test3.ForeignMessage"},
+		{field: "repeated_int32", in: int32(1), want: "of kind repeated int32"},
+		{field: "repeated_int32", in: []int64{1}, want: "invalid type int64"},
+		{field: "map_int32_int32", in: []int32{1}, want: "of kind map"},
+		{field: "map_int32_int32", in: map[int64]int32{1: 1}, want: "invalid type int64"},
+		{field: "map_string_string", in: map[string]int32{"k": 1}, want: "invalid type int32"},
+	}
+	for _, tt := range tests {
+		m := new(test3pb.TestAllTypes).ProtoReflect()
+		fd := m.Descriptor().Fields().ByName(tt.field)
+		err := protovalue.Set(m, fd, tt.in)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Set(%v, %T) error = %v, want %q", tt.field, tt.in, err, tt.want)
+		}
+		if m.Has(fd) {
+			t.Errorf("Set(%v, %T) modified the message after an error", tt.field, tt.in)
+		}
+	}
+}
+
+func TestValueOf(t *testing.T) {
+	fds := (&test3pb.TestAllTypes{}).ProtoReflect().Descriptor().Fields()
+	v, err := protovalue.ValueOf(fds.ByName("singular_sint64"), int64(-3))
+	if err != nil || v.Int() != -3 {
+		t.Errorf("ValueOf(int64(-3)) = %v, %v; want -3", v, err)
+	}
+	if got := protovalue.Interface(fds.ByName("singular_sint64"), v); got != int64(-3) {
+		t.Errorf("Interface = %v, want -3", got)
+	}
+	if _, err := protovalue.ValueOf(fds.ByName("repeated_int32"), []int32{1}); err == nil {
+		t.Errorf("ValueOf of a repeated field succeeded, want error")
+	}
+}
@@ -10,6 +10,7 @@
 package protoiface
 
 import (
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/internal/pragma"
 	"google.golang.org/protobuf/reflect/protoreflect"
 )
@@ -39,6 +40,14 @@ type Methods = struct {
 
 	// CheckInitialized returns an error if any required fields in the message are not set.
 	CheckInitialized func(CheckInitializedInput) (CheckInitializedOutput, error)
+
+	// Validate reports whether the wire-format encoding in the input is valid
+	// for the type of the input message. It must not modify the message.
+	// Unmarshal must be provided if a custom Validate is provided.
+	Validate func(UnmarshalInput) ValidateOutput
+
+	// Equal reports whether two messages of the same type are equal.
+	Equal func(EqualInput) EqualOutput
 }
 
 // SupportFlags indicate support for optional features.
@@ -50,6 +59,12 @@ const (
 
 	// SupportUnmarshalDiscardUnknown reports whether UnmarshalOptions.DiscardUnknown is supported.
 	SupportUnmarshalDiscardUnknown
+
+	// SupportUnmarshalRejectUnknown reports whether UnmarshalOptions.RejectUnknown is supported.
+	SupportUnmarshalRejectUnknown
+
+	// SupportUnmarshalUnknownFieldHandler reports whether UnmarshalOptions.UnknownFieldHandler is supported.
+	SupportUnmarshalUnknownFieldHandler
 )
 
 // SizeInput is input to the Size method.
@@ -103,6 +118,7 @@ type UnmarshalInput = struct {
 		FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error)
 		FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error)
 	}
+	UnknownFieldHandler func(protoreflect.MessageDescriptor, protowire.Number, protowire.Type, []byte) bool
 }
 
 // UnmarshalOutput is output from the Unmarshal method.
@@ -118,6 +134,7 @@ type UnmarshalInputFlags = uint8
 
 const (
 	UnmarshalDiscardUnknown UnmarshalInputFlags = 1 << iota
+	UnmarshalRejectUnknown
 )
 
 // UnmarshalOutputFlags are output from the Unmarshal method.
@@ -130,6 +147,32 @@ const (
 	UnmarshalInitialized UnmarshalOutputFlags = 1 << iota
 )
 
+// ValidateOutput is output from the Validate method.
+type ValidateOutput = struct {
+	pragma.NoUnkeyedLiterals
+
+	Flags ValidateOutputFlags
+}
+
+// ValidateOutputFlags are output from the Validate method.
+//
+// If neither ValidateValid nor ValidateInvalid is set, the validator was
+// unable to render a judgement and the caller must fall back to unmarshaling.
+type ValidateOutputFlags = uint8
+
+const (
+	// ValidateValid reports that unmarshaling the input will succeed.
+	ValidateValid ValidateOutputFlags = 1 << iota
+
+	// ValidateInvalid reports that unmarshaling the input will fail.
+	ValidateInvalid
+
+	// ValidateInitialized may be set on return if all required fields are known to be set.
+	// If unset, then it does not necessarily indicate that the message is uninitialized,
+	// only that its status could not be confirmed.
+	ValidateInitialized
+)
+
 // MergeInput is input to the Merge method.
 type MergeInput = struct {
 	pragma.NoUnkeyedLiterals
@@ -154,6 +197,21 @@ const (
 	MergeComplete MergeOutputFlags = 1 << iota
 )
 
+// EqualInput is input to the Equal method.
+type EqualInput = struct {
+	pragma.NoUnkeyedLiterals
+
+	MessageA protoreflect.Message
+	MessageB protoreflect.Message
+}
+
+// EqualOutput is output from the Equal method.
+type EqualOutput = struct {
+	pragma.NoUnkeyedLiterals
+
+	Equal bool
+}
+
 // CheckInitializedInput is input to the CheckInitialized method.
 type CheckInitializedInput = struct {
 	pragma.NoUnkeyedLiterals
@@ -0,0 +1,16 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package protoimpl
+
+import "google.golang.org/protobuf/proto"
+
+// TypedExtension returns a typed view of the extension described by xi.
+// It panics if the Go type of the extension field is not T.
+func TypedExtension[T any](xi *ExtensionInfo) proto.TypedExtensionType[T] {
+	return proto.NewTypedExtensionType[T](xi)
+}
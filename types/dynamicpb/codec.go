@@ -0,0 +1,943 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dynamicpb
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/internal/encoding/messageset"
+	"google.golang.org/protobuf/internal/errors"
+	"google.golang.org/protobuf/internal/flags"
+	"google.golang.org/protobuf/internal/genid"
+	"google.golang.org/protobuf/internal/mapsort"
+	"google.golang.org/protobuf/internal/protoerrors"
+	"google.golang.org/protobuf/internal/strs"
+	"google.golang.org/protobuf/proto"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
+	preg "google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/runtime/protoiface"
+)
+
+// messageMethods are the fast-path methods of every valid dynamic message
+// that is not a message set. They operate directly on the dense field storage
+// of a Message, using coders derived from the message descriptor.
+var messageMethods = protoiface.Methods{
+	Flags: protoiface.SupportMarshalDeterministic |
+		protoiface.SupportUnmarshalDiscardUnknown |
+		protoiface.SupportUnmarshalRejectUnknown |
+		protoiface.SupportUnmarshalUnknownFieldHandler,
+	Size:             size,
+	Marshal:          marshal,
+	Unmarshal:        unmarshal,
+	CheckInitialized: checkInitialized,
+}
+
+// coderSet holds the coders for the message types reachable from a type
+// created by NewMessageType or NewMessage, and for the extensions of those
+// messages. It is referenced only by the types and messages which use it,
+// so the coders are garbage collected along with them.
+type coderSet struct {
+	messages   sync.Map // map[pref.MessageDescriptor]*messageInfo
+	extensions sync.Map // map[pref.FieldDescriptor]*coderField
+
+	initCheckMu sync.Mutex
+	initCheck   map[pref.MessageDescriptor]interface{} // bool, or struct{} while being computed
+}
+
+// messageInfo returns the coder for md, which is initialized on first use.
+func (s *coderSet) messageInfo(md pref.MessageDescriptor) *messageInfo {
+	if v, ok := s.messages.Load(md); ok {
+		return v.(*messageInfo)
+	}
+	v, _ := s.messages.LoadOrStore(md, &messageInfo{
+		desc:         md,
+		coders:       s,
+		isMessageSet: messageset.IsMessageSet(md),
+	})
+	return v.(*messageInfo)
+}
+
+// extensionField returns the coder for the extension field xd.
+func (s *coderSet) extensionField(xd pref.FieldDescriptor) *coderField {
+	if v, ok := s.extensions.Load(xd); ok {
+		return v.(*coderField)
+	}
+	v, _ := s.extensions.LoadOrStore(xd, s.newCoderField(xd))
+	return v.(*coderField)
+}
+
+// newValue returns a new value for the field fd. Messages, lists, and maps
+// created by it use the coders in s.
+func (s *coderSet) newValue(fd pref.FieldDescriptor) pref.Value {
+	switch {
+	case fd.IsMap():
+		return pref.ValueOfMap(&dynamicMap{
+			desc:   fd,
+			mapv:   make(map[interface{}]pref.Value),
+			coders: s,
+		})
+	case fd.IsList():
+		return pref.ValueOfList(&dynamicList{desc: fd, coders: s})
+	case fd.Message() != nil:
+		return pref.ValueOfMessage(s.messageInfo(fd.Message()).new())
+	default:
+		return fd.Default()
+	}
+}
+
+// messageInfo is the wire-format coder for a message descriptor.
+type messageInfo struct {
+	desc         pref.MessageDescriptor
+	coders       *coderSet
+	isMessageSet bool
+
+	initOnce       sync.Once
+	fields         []*coderField // indexed by field index
+	orderedFields  []*coderField // sorted by field number
+	denseFields    []*coderField // indexed by field number
+	sparseFields   map[protowire.Number]*coderField
+	requiredFields []*coderField
+	hasExtensions  bool
+	needsInitCheck bool
+}
+
+func (mi *messageInfo) init() {
+	mi.initOnce.Do(mi.initOnceFunc)
+}
+
+func (mi *messageInfo) initOnceFunc() {
+	fds := mi.desc.Fields()
+	mi.fields = make([]*coderField, fds.Len())
+	maxDense := 2*fds.Len() + 16
+	for i := range mi.fields {
+		f := mi.coders.newCoderField(fds.Get(i))
+		f.index = i
+		mi.fields[i] = f
+		if int(f.num) < maxDense {
+			for len(mi.denseFields) <= int(f.num) {
+				mi.denseFields = append(mi.denseFields, nil)
+			}
+			mi.denseFields[f.num] = f
+		} else {
+			if mi.sparseFields == nil {
+				mi.sparseFields = make(map[protowire.Number]*coderField)
+			}
+			mi.sparseFields[f.num] = f
+		}
+	}
+	mi.orderedFields = append([]*coderField(nil), mi.fields...)
+	sort.Slice(mi.orderedFields, func(i, j int) bool {
+		return mi.orderedFields[i].num < mi.orderedFields[j].num
+	})
+	for i, nums := 0, mi.desc.RequiredNumbers(); i < nums.Len(); i++ {
+		mi.requiredFields = append(mi.requiredFields, mi.fields[fds.ByNumber(nums.Get(i)).Index()])
+	}
+	mi.hasExtensions = mi.desc.ExtensionRanges().Len() > 0
+	mi.needsInitCheck = mi.coders.needsInitCheck(mi.desc)
+}
+
+func (mi *messageInfo) fieldByNumber(num protowire.Number) *coderField {
+	if int(num) < len(mi.denseFields) {
+		return mi.denseFields[num]
+	}
+	return mi.sparseFields[num]
+}
+
+// new returns a new empty message of this type.
+func (mi *messageInfo) new() *Message {
+	n := mi.desc.Fields().Len()
+	return &Message{
+		info:    mi,
+		known:   make([]pref.Value, n),
+		present: newBitmap(n),
+	}
+}
+
+// coderField is the wire-format coder for a field, extension, or map entry field.
+type coderField struct {
+	fd       pref.FieldDescriptor
+	index    int // index of the field in its message; unused for extensions
+	num      protowire.Number
+	kind     pref.Kind
+	wiretyp  protowire.Type // wire type of a single element
+	wiretag  uint64
+	tagsize  int
+	isList   bool
+	isMap    bool
+	isPacked bool
+	isOneof  bool
+	isWeak   bool
+	implicit bool // presence is determined by whether the value is the zero value
+	utf8     bool // strings must be valid UTF-8
+
+	coders         *coderSet
+	mi             *messageInfo // for message and group fields
+	mapKey, mapVal *coderField  // for map fields
+}
+
+func (s *coderSet) newCoderField(fd pref.FieldDescriptor) *coderField {
+	f := &coderField{
+		fd:       fd,
+		num:      fd.Number(),
+		kind:     fd.Kind(),
+		isList:   fd.IsList(),
+		isMap:    fd.IsMap(),
+		isPacked: fd.IsPacked(),
+		isOneof:  fd.ContainingOneof() != nil,
+		isWeak:   flags.ProtoLegacy && fd.IsWeak(),
+		utf8:     fd.Kind() == pref.StringKind && strs.EnforceUTF8(fd),
+		coders:   s,
+	}
+	f.implicit = !f.isList && !f.isMap && !f.isOneof && !fd.IsExtension() && fd.Syntax() == pref.Proto3
+	f.wiretyp = wireTypes[f.kind]
+	f.wiretag = protowire.EncodeTag(f.num, f.wiretyp)
+	f.tagsize = protowire.SizeVarint(f.wiretag)
+	switch {
+	case f.isMap:
+		f.mapKey = s.newCoderField(fd.MapKey())
+		f.mapVal = s.newCoderField(fd.MapValue())
+	case f.kind == pref.MessageKind || f.kind == pref.GroupKind:
+		f.mi = s.messageInfo(fd.Message())
+	}
+	return f
+}
+
+// newValue returns a new mutable value for a composite field.
+func (f *coderField) newValue() pref.Value {
+	if f.mi != nil && !f.isList {
+		return pref.ValueOfMessage(f.mi.new())
+	}
+	return f.coders.newValue(f.fd)
+}
+
+// fastMessage returns m as a dynamic message handled by the coders in this
+// file, or nil if it must be handled by the proto package.
+func fastMessage(m pref.Message) *Message {
+	if dm, ok := m.(*Message); ok && dm.known != nil && !dm.info.isMessageSet {
+		return dm
+	}
+	return nil
+}
+
+type marshalOptions struct {
+	flags protoiface.MarshalInputFlags
+}
+
+func (o marshalOptions) Options() proto.MarshalOptions {
+	return proto.MarshalOptions{
+		AllowPartial:  true,
+		Deterministic: o.Deterministic(),
+		UseCachedSize: o.UseCachedSize(),
+	}
+}
+
+func (o marshalOptions) Deterministic() bool { return o.flags&protoiface.MarshalDeterministic != 0 }
+func (o marshalOptions) UseCachedSize() bool { return o.flags&protoiface.MarshalUseCachedSize != 0 }
+
+// size is protoiface.Methods.Size.
+func size(in protoiface.SizeInput) protoiface.SizeOutput {
+	m := in.Message.(*Message)
+	return protoiface.SizeOutput{
+		Size: m.info.sizeMessage(m, marshalOptions{flags: in.Flags}),
+	}
+}
+
+// marshal is protoiface.Methods.Marshal.
+func marshal(in protoiface.MarshalInput) (protoiface.MarshalOutput, error) {
+	m := in.Message.(*Message)
+	b, err := m.info.marshalMessage(in.Buf, m, marshalOptions{flags: in.Flags})
+	return protoiface.MarshalOutput{Buf: b}, err
+}
+
+func (mi *messageInfo) sizeMessage(m *Message, opts marshalOptions) (size int) {
+	if opts.UseCachedSize() {
+		if size := atomic.LoadInt32(&m.sizecache); size >= 0 {
+			return int(size)
+		}
+	}
+	mi.init()
+	for _, x := range m.ext {
+		if isSet(x.desc, x.val) {
+			size += mi.coders.extensionField(x.desc).sizeField(x.val, opts)
+		}
+	}
+	for i, v := range m.known {
+		if !m.present.has(i) {
+			continue
+		}
+		f := mi.fields[i]
+		if f.implicit && !isSet(f.fd, v) {
+			continue
+		}
+		size += f.sizeField(v, opts)
+	}
+	size += len(m.unknown)
+	if size > math.MaxInt32 {
+		atomic.StoreInt32(&m.sizecache, -1)
+	} else {
+		atomic.StoreInt32(&m.sizecache, int32(size))
+	}
+	return size
+}
+
+func (mi *messageInfo) marshalMessage(b []byte, m *Message, opts marshalOptions) ([]byte, error) {
+	mi.init()
+	var err error
+	// Extensions are encoded first, as they are by generated messages.
+	if len(m.ext) > 0 {
+		if b, err = mi.appendExtensions(b, m.ext, opts); err != nil {
+			return b, err
+		}
+	}
+	for _, f := range mi.orderedFields {
+		i := f.index
+		if !m.present.has(i) {
+			continue
+		}
+		v := m.known[i]
+		if f.implicit && !isSet(f.fd, v) {
+			continue
+		}
+		if b, err = f.appendField(b, v, opts); err != nil {
+			return b, err
+		}
+	}
+	b = append(b, m.unknown...)
+	return b, nil
+}
+
+func (mi *messageInfo) appendExtensions(b []byte, ext map[pref.FieldNumber]extensionField, opts marshalOptions) ([]byte, error) {
+	var err error
+	if len(ext) == 1 || !opts.Deterministic() {
+		for _, x := range ext {
+			if !isSet(x.desc, x.val) {
+				continue
+			}
+			if b, err = mi.coders.extensionField(x.desc).appendField(b, x.val, opts); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	}
+	nums := make([]int, 0, len(ext))
+	for num := range ext {
+		nums = append(nums, int(num))
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		x := ext[pref.FieldNumber(num)]
+		if !isSet(x.desc, x.val) {
+			continue
+		}
+		if b, err = mi.coders.extensionField(x.desc).appendField(b, x.val, opts); err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+// sizeField returns the size of the encoded field, including its tag.
+func (f *coderField) sizeField(v pref.Value, opts marshalOptions) (size int) {
+	switch {
+	case f.isMap:
+		return f.sizeMap(v.Map(), opts)
+	case f.isList:
+		list := v.List()
+		if f.isPacked && list.Len() > 0 {
+			n := 0
+			for i, llen := 0, list.Len(); i < llen; i++ {
+				n += f.sizeValue(list.Get(i), opts)
+			}
+			return f.tagsize + protowire.SizeBytes(n)
+		}
+		for i, llen := 0, list.Len(); i < llen; i++ {
+			size += f.tagsize + f.sizeValue(list.Get(i), opts)
+		}
+		return size
+	default:
+		return f.tagsize + f.sizeValue(v, opts)
+	}
+}
+
+func (f *coderField) sizeMap(mapv pref.Map, opts marshalOptions) (size int) {
+	mapv.Range(func(key pref.MapKey, val pref.Value) bool {
+		size += f.tagsize + protowire.SizeBytes(f.sizeMapEntry(key.Value(), val, opts))
+		return true
+	})
+	return size
+}
+
+func (f *coderField) sizeMapEntry(key, val pref.Value, opts marshalOptions) int {
+	return f.mapKey.tagsize + f.mapKey.sizeValue(key, opts) +
+		f.mapVal.tagsize + f.mapVal.sizeValue(val, opts)
+}
+
+// sizeValue returns the size of a single encoded element, excluding its tag.
+func (f *coderField) sizeValue(v pref.Value, opts marshalOptions) int {
+	switch f.kind {
+	case pref.MessageKind:
+		return protowire.SizeBytes(sizeMessageValue(v.Message(), opts))
+	case pref.GroupKind:
+		return sizeMessageValue(v.Message(), opts) + f.tagsize
+	default:
+		return sizeScalar(f.kind, f.wiretyp, v)
+	}
+}
+
+// appendField appends the encoded field, including its tag.
+func (f *coderField) appendField(b []byte, v pref.Value, opts marshalOptions) ([]byte, error) {
+	var err error
+	switch {
+	case f.isMap:
+		return f.appendMap(b, v.Map(), opts)
+	case f.isList:
+		list := v.List()
+		llen := list.Len()
+		if f.isPacked && llen > 0 {
+			n := 0
+			for i := 0; i < llen; i++ {
+				n += f.sizeValue(list.Get(i), opts)
+			}
+			b = protowire.AppendTag(b, f.num, protowire.BytesType)
+			b = protowire.AppendVarint(b, uint64(n))
+			for i := 0; i < llen; i++ {
+				b = appendScalar(b, f.kind, f.wiretyp, list.Get(i))
+			}
+			return b, nil
+		}
+		for i := 0; i < llen; i++ {
+			b = protowire.AppendVarint(b, f.wiretag)
+			if b, err = f.appendValue(b, list.Get(i), opts); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	default:
+		b = protowire.AppendVarint(b, f.wiretag)
+		return f.appendValue(b, v, opts)
+	}
+}
+
+func (f *coderField) appendMap(b []byte, mapv pref.Map, opts marshalOptions) ([]byte, error) {
+	var err error
+	appendEntry := func(key pref.MapKey, val pref.Value) bool {
+		b = protowire.AppendVarint(b, f.wiretag)
+		b = protowire.AppendVarint(b, uint64(f.sizeMapEntry(key.Value(), val, opts)))
+		b = protowire.AppendVarint(b, f.mapKey.wiretag)
+		if b, err = f.mapKey.appendValue(b, key.Value(), opts); err != nil {
+			return false
+		}
+		b = protowire.AppendVarint(b, f.mapVal.wiretag)
+		b, err = f.mapVal.appendValue(b, val, opts)
+		return err == nil
+	}
+	if opts.Deterministic() {
+		mapsort.Range(mapv, f.mapKey.kind, appendEntry)
+	} else {
+		mapv.Range(appendEntry)
+	}
+	return b, err
+}
+
+// appendValue appends a single encoded element, excluding its tag.
+func (f *coderField) appendValue(b []byte, v pref.Value, opts marshalOptions) ([]byte, error) {
+	switch f.kind {
+	case pref.MessageKind:
+		m := v.Message()
+		b = protowire.AppendVarint(b, uint64(sizeMessageValue(m, opts)))
+		return appendMessageValue(b, m, opts)
+	case pref.GroupKind:
+		b, err := appendMessageValue(b, v.Message(), opts)
+		if err != nil {
+			return b, err
+		}
+		return protowire.AppendVarint(b, protowire.EncodeTag(f.num, protowire.EndGroupType)), nil
+	case pref.StringKind:
+		s := v.String()
+		if f.utf8 && !utf8.ValidString(s) {
+			return b, errors.InvalidUTF8(string(f.fd.FullName()))
+		}
+		return protowire.AppendString(b, s), nil
+	default:
+		return appendScalar(b, f.kind, f.wiretyp, v), nil
+	}
+}
+
+func sizeMessageValue(m pref.Message, opts marshalOptions) int {
+	if dm := fastMessage(m); dm != nil {
+		return dm.info.sizeMessage(dm, opts)
+	}
+	return opts.Options().Size(m.Interface())
+}
+
+func appendMessageValue(b []byte, m pref.Message, opts marshalOptions) ([]byte, error) {
+	if dm := fastMessage(m); dm != nil {
+		return dm.info.marshalMessage(b, dm, opts)
+	}
+	return opts.Options().MarshalAppend(b, m.Interface())
+}
+
+type unmarshalOptions struct {
+	flags    protoiface.UnmarshalInputFlags
+	resolver interface {
+		FindExtensionByName(field pref.FullName) (pref.ExtensionType, error)
+		FindExtensionByNumber(message pref.FullName, field pref.FieldNumber) (pref.ExtensionType, error)
+	}
+	unknownHandler func(pref.MessageDescriptor, protowire.Number, protowire.Type, []byte) bool
+}
+
+func (o unmarshalOptions) Options() proto.UnmarshalOptions {
+	return proto.UnmarshalOptions{
+		Merge:          true,
+		AllowPartial:   true,
+		DiscardUnknown: o.DiscardUnknown(),
+		RejectUnknown:  o.RejectUnknown(),
+		Resolver:       o.resolver,
+
+		UnknownFieldHandler: o.unknownHandler,
+	}
+}
+
+func (o unmarshalOptions) DiscardUnknown() bool {
+	return o.flags&protoiface.UnmarshalDiscardUnknown != 0
+}
+func (o unmarshalOptions) RejectUnknown() bool {
+	return o.flags&protoiface.UnmarshalRejectUnknown != 0
+}
+
+// retainUnknown reports whether to store the unknown field b
+// in the unknown fields of a message with the descriptor md.
+func (o unmarshalOptions) retainUnknown(md pref.MessageDescriptor, num protowire.Number, wtyp protowire.Type, b []byte) bool {
+	if o.unknownHandler != nil {
+		return o.unknownHandler(md, num, wtyp, b)
+	}
+	return !o.DiscardUnknown()
+}
+
+// unmarshal is protoiface.Methods.Unmarshal.
+func unmarshal(in protoiface.UnmarshalInput) (protoiface.UnmarshalOutput, error) {
+	m := in.Message.(*Message)
+	opts := unmarshalOptions{
+		flags:          in.Flags,
+		resolver:       in.Resolver,
+		unknownHandler: in.UnknownFieldHandler,
+	}
+	if opts.resolver == nil {
+		opts.resolver = preg.GlobalTypes
+	}
+	return protoiface.UnmarshalOutput{}, m.info.unmarshalMessage(in.Buf, m, opts)
+}
+
+// errUnknown is returned while unmarshaling a field to indicate that it is
+// to be handled as an unknown field. It is never returned to the user.
+var errUnknown = errors.New("unknown")
+
+func (mi *messageInfo) unmarshalMessage(b []byte, m *Message, opts unmarshalOptions) error {
+	mi.init()
+	start := len(b)
+	for len(b) > 0 {
+		rec, offset := b, start-len(b)
+
+		// Parse the tag (field number and wire type).
+		num, wtyp, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protoerrors.Wrap(protowire.ParseError(n), rec, offset, num, wtyp)
+		}
+		if num > protowire.MaxValidNumber {
+			return protoerrors.Wrap(errors.New("invalid field number"), rec, offset, num, wtyp)
+		}
+		b = b[n:]
+
+		var fd pref.FieldDescriptor
+		err := errUnknown
+		if f := mi.fieldByNumber(num); f != nil {
+			fd = f.fd
+			if !(f.isWeak && f.fd.Message().IsPlaceholder()) {
+				n, err = m.unmarshalField(b, wtyp, f, opts)
+			}
+		} else if mi.hasExtensions && mi.desc.ExtensionRanges().Has(num) {
+			xt, rerr := opts.resolver.FindExtensionByNumber(mi.desc.FullName(), num)
+			switch {
+			case rerr == nil:
+				fd = xt.TypeDescriptor()
+				n, err = m.unmarshalExtension(b, wtyp, xt, opts)
+			case rerr != preg.NotFound:
+				err = errors.New("%v: unable to resolve extension %v: %v", mi.desc.FullName(), num, rerr)
+			}
+		}
+		if err != nil {
+			if err != errUnknown {
+				return protoerrors.Wrap(err, rec, offset, num, wtyp)
+			}
+			if opts.RejectUnknown() {
+				return protoerrors.Wrap(protoerrors.UnknownField(mi.desc, fd, num, wtyp), rec, offset, num, wtyp)
+			}
+			n = protowire.ConsumeFieldValue(num, wtyp, b)
+			if n < 0 {
+				return protoerrors.Wrap(protowire.ParseError(n), rec, offset, num, wtyp)
+			}
+			if raw := rec[:len(rec)-len(b)+n]; opts.retainUnknown(mi.desc, num, wtyp, raw) {
+				m.unknown = append(m.unknown, raw...)
+			}
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// mutableField returns the value of a composite field, populating it if necessary.
+func (m *Message) mutableField(f *coderField) pref.Value {
+	i := f.index
+	if m.present.has(i) {
+		return m.known[i]
+	}
+	if f.isOneof {
+		m.clearOtherOneofFields(f.fd)
+	}
+	v := f.newValue()
+	m.known[i] = v
+	m.present.set(i)
+	return v
+}
+
+// validWireType reports whether a record of the field may have the wire type.
+// The value of a field is only created once its wire type is known to be valid,
+// so that a record which is treated as unknown does not populate the field.
+func (f *coderField) validWireType(wtyp protowire.Type) bool {
+	switch {
+	case f.isMap:
+		return wtyp == protowire.BytesType
+	case f.isList && wtyp == protowire.BytesType:
+		return f.wiretyp != protowire.StartGroupType // packed scalars or elements
+	default:
+		return wtyp == f.wiretyp
+	}
+}
+
+func (m *Message) unmarshalField(b []byte, wtyp protowire.Type, f *coderField, opts unmarshalOptions) (int, error) {
+	if !f.validWireType(wtyp) {
+		return 0, errUnknown
+	}
+	switch {
+	case f.isList:
+		return f.unmarshalList(b, wtyp, m.mutableField(f).List(), opts)
+	case f.isMap:
+		return f.unmarshalMap(b, wtyp, m.mutableField(f).Map(), opts)
+	case f.kind == pref.MessageKind || f.kind == pref.GroupKind:
+		v, n, err := f.consumeMessageBytes(b, wtyp)
+		if err != nil {
+			return 0, err
+		}
+		return n, unmarshalMessageValue(v, m.mutableField(f).Message(), opts)
+	default:
+		v, n, err := f.consumeScalar(b, wtyp)
+		if err != nil {
+			return 0, err
+		}
+		if f.isOneof {
+			m.clearOtherOneofFields(f.fd)
+		}
+		m.known[f.index] = v
+		m.present.set(f.index)
+		return n, nil
+	}
+}
+
+func (m *Message) unmarshalExtension(b []byte, wtyp protowire.Type, xt pref.ExtensionType, opts unmarshalOptions) (int, error) {
+	xd := xt.TypeDescriptor()
+	f := m.info.coders.extensionField(xd)
+	if !f.validWireType(wtyp) {
+		return 0, errUnknown
+	}
+	if !f.isList && f.kind != pref.MessageKind && f.kind != pref.GroupKind {
+		v, n, err := f.consumeScalar(b, wtyp)
+		if err != nil {
+			return 0, err
+		}
+		m.setExtension(f.num, extensionField{xd, v})
+		return n, nil
+	}
+	x, ok := m.ext[f.num]
+	if !ok || x.desc != pref.FieldDescriptor(xd) {
+		x = extensionField{xd, m.newExtension(xt)}
+		m.setExtension(f.num, x)
+	}
+	if f.isList {
+		return f.unmarshalList(b, wtyp, x.val.List(), opts)
+	}
+	v, n, err := f.consumeMessageBytes(b, wtyp)
+	if err != nil {
+		return 0, err
+	}
+	return n, unmarshalMessageValue(v, x.val.Message(), opts)
+}
+
+func (f *coderField) unmarshalList(b []byte, wtyp protowire.Type, list pref.List, opts unmarshalOptions) (int, error) {
+	if f.kind == pref.MessageKind || f.kind == pref.GroupKind {
+		v, n, err := f.consumeMessageBytes(b, wtyp)
+		if err != nil {
+			return 0, err
+		}
+		var m pref.Message
+		if _, ok := list.(*dynamicList); ok {
+			m = f.mi.new()
+		} else {
+			m = list.NewElement().Message()
+		}
+		if err := unmarshalMessageValue(v, m, opts); err != nil {
+			return n, err
+		}
+		appendList(list, pref.ValueOfMessage(m))
+		return n, nil
+	}
+	if wtyp == protowire.BytesType && f.wiretyp != protowire.BytesType {
+		// Packed encoding of a repeated scalar field.
+		buf, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		for len(buf) > 0 {
+			v, n, err := f.consumeScalar(buf, f.wiretyp)
+			if err != nil {
+				return 0, err
+			}
+			buf = buf[n:]
+			appendList(list, v)
+		}
+		return n, nil
+	}
+	v, n, err := f.consumeScalar(b, wtyp)
+	if err != nil {
+		return 0, err
+	}
+	appendList(list, v)
+	return n, nil
+}
+
+func appendList(list pref.List, v pref.Value) {
+	if dl, ok := list.(*dynamicList); ok {
+		dl.list = append(dl.list, v)
+		return
+	}
+	list.Append(v)
+}
+
+func (f *coderField) unmarshalMap(b []byte, wtyp protowire.Type, mapv pref.Map, opts unmarshalOptions) (int, error) {
+	if wtyp != protowire.BytesType {
+		return 0, errUnknown
+	}
+	b, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	var (
+		keyField = f.mapKey
+		valField = f.mapVal
+		key      pref.Value
+		val      pref.Value
+		haveKey  bool
+		haveVal  bool
+	)
+	if valField.mi != nil {
+		val = pref.ValueOfMessage(valField.mi.new())
+	}
+	// Map entries are represented as a two-element message with fields
+	// containing the key and value.
+	entryLen := len(b)
+	for len(b) > 0 {
+		rec, offset := b, entryLen-len(b)
+		num, wtyp, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return 0, protoerrors.Wrap(protowire.ParseError(n), rec, offset, num, wtyp)
+		}
+		if num > protowire.MaxValidNumber {
+			return 0, protoerrors.Wrap(errors.New("invalid field number"), rec, offset, num, wtyp)
+		}
+		b = b[n:]
+		err := errUnknown
+		switch num {
+		case genid.MapEntry_Key_field_number:
+			key, n, err = keyField.consumeScalar(b, wtyp)
+			if err != nil {
+				break
+			}
+			haveKey = true
+		case genid.MapEntry_Value_field_number:
+			if valField.mi == nil {
+				val, n, err = valField.consumeScalar(b, wtyp)
+			} else {
+				var v []byte
+				v, n, err = valField.consumeMessageBytes(b, wtyp)
+				if err == nil {
+					if err := unmarshalMessageValue(v, val.Message(), opts); err != nil {
+						return 0, protoerrors.Wrap(err, rec, offset, num, wtyp)
+					}
+				}
+			}
+			if err != nil {
+				break
+			}
+			haveVal = true
+		}
+		if err == errUnknown {
+			n = protowire.ConsumeFieldValue(num, wtyp, b)
+			if n < 0 {
+				return 0, protoerrors.Wrap(protowire.ParseError(n), rec, offset, num, wtyp)
+			}
+		} else if err != nil {
+			return 0, protoerrors.Wrap(err, rec, offset, num, wtyp)
+		}
+		b = b[n:]
+	}
+	// Every map entry should have entries for key and value, but this is not strictly required.
+	if !haveKey {
+		key = keyField.fd.Default()
+	}
+	if !haveVal && valField.mi == nil {
+		val = valField.fd.Default()
+	}
+	if dm, ok := mapv.(*dynamicMap); ok {
+		dm.mapv[key.Interface()] = val
+	} else {
+		mapv.Set(key.MapKey(), val)
+	}
+	return n, nil
+}
+
+// consumeMessageBytes consumes the encoding of a message or group,
+// returning the encoded fields of the message.
+func (f *coderField) consumeMessageBytes(b []byte, wtyp protowire.Type) ([]byte, int, error) {
+	if wtyp != f.wiretyp {
+		return nil, 0, errUnknown
+	}
+	var v []byte
+	var n int
+	if f.kind == pref.GroupKind {
+		v, n = protowire.ConsumeGroup(f.num, b)
+	} else {
+		v, n = protowire.ConsumeBytes(b)
+	}
+	if n < 0 {
+		return nil, 0, protowire.ParseError(n)
+	}
+	return v, n, nil
+}
+
+func unmarshalMessageValue(b []byte, m pref.Message, opts unmarshalOptions) error {
+	if dm := fastMessage(m); dm != nil {
+		return dm.info.unmarshalMessage(b, dm, opts)
+	}
+	return opts.Options().Unmarshal(b, m.Interface())
+}
+
+// checkInitialized is protoiface.Methods.CheckInitialized.
+func checkInitialized(in protoiface.CheckInitializedInput) (protoiface.CheckInitializedOutput, error) {
+	m := in.Message.(*Message)
+	return protoiface.CheckInitializedOutput{}, m.info.checkInitialized(m)
+}
+
+func (mi *messageInfo) checkInitialized(m *Message) error {
+	mi.init()
+	if !mi.needsInitCheck {
+		return nil
+	}
+	for _, f := range mi.requiredFields {
+		if i := f.index; !m.present.has(i) || !isSet(f.fd, m.known[i]) {
+			return errors.RequiredNotSet(string(f.fd.FullName()))
+		}
+	}
+	for i, v := range m.known {
+		if !m.present.has(i) {
+			continue
+		}
+		if err := mi.fields[i].checkInitialized(v); err != nil {
+			return err
+		}
+	}
+	for _, x := range m.ext {
+		if err := mi.coders.extensionField(x.desc).checkInitialized(x.val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *coderField) checkInitialized(v pref.Value) error {
+	var err error
+	switch {
+	case f.isMap:
+		if f.mapVal.mi == nil {
+			return nil
+		}
+		v.Map().Range(func(_ pref.MapKey, v pref.Value) bool {
+			err = checkInitializedValue(v.Message())
+			return err == nil
+		})
+	case f.mi == nil:
+	case f.isList:
+		for i, list := 0, v.List(); i < list.Len() && err == nil; i++ {
+			err = checkInitializedValue(list.Get(i).Message())
+		}
+	default:
+		err = checkInitializedValue(v.Message())
+	}
+	return err
+}
+
+func checkInitializedValue(m pref.Message) error {
+	if dm := fastMessage(m); dm != nil {
+		return dm.info.checkInitialized(dm)
+	}
+	return proto.CheckInitialized(m.Interface())
+}
+
+// needsInitCheck reports whether a message needs to be checked for partial initialization.
+//
+// It returns true if the message transitively includes any required or extension fields.
+func (s *coderSet) needsInitCheck(md pref.MessageDescriptor) bool {
+	s.initCheckMu.Lock()
+	defer s.initCheckMu.Unlock()
+	if s.initCheck == nil {
+		s.initCheck = make(map[pref.MessageDescriptor]interface{})
+	}
+	return s.needsInitCheckLocked(md)
+}
+
+func (s *coderSet) needsInitCheckLocked(md pref.MessageDescriptor) (has bool) {
+	if v, ok := s.initCheck[md]; ok {
+		// A value that is not a bool indicates a cycle in the message graph.
+		// It is safe to return false here, since any required fields in the
+		// cycle are detected elsewhere in the traversal.
+		has, ok := v.(bool)
+		return ok && has
+	}
+	s.initCheck[md] = struct{}{} // avoid cycles while descending into this message
+	defer func() {
+		s.initCheck[md] = has
+	}()
+	if md.RequiredNumbers().Len() > 0 {
+		return true
+	}
+	if md.ExtensionRanges().Len() > 0 {
+		return true
+	}
+	for i := 0; i < md.Fields().Len(); i++ {
+		fd := md.Fields().Get(i)
+		// Map keys are never messages, so just consider the map value.
+		if fd.IsMap() {
+			fd = fd.MapValue()
+		}
+		fmd := fd.Message()
+		if fmd != nil && s.needsInitCheckLocked(fmd) {
+			return true
+		}
+	}
+	return false
+}
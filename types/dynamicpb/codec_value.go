@@ -0,0 +1,167 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dynamicpb
+
+import (
+	"math"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/internal/errors"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var wireTypes = map[pref.Kind]protowire.Type{
+	pref.BoolKind:     protowire.VarintType,
+	pref.EnumKind:     protowire.VarintType,
+	pref.Int32Kind:    protowire.VarintType,
+	pref.Sint32Kind:   protowire.VarintType,
+	pref.Uint32Kind:   protowire.VarintType,
+	pref.Int64Kind:    protowire.VarintType,
+	pref.Sint64Kind:   protowire.VarintType,
+	pref.Uint64Kind:   protowire.VarintType,
+	pref.Sfixed32Kind: protowire.Fixed32Type,
+	pref.Fixed32Kind:  protowire.Fixed32Type,
+	pref.FloatKind:    protowire.Fixed32Type,
+	pref.Sfixed64Kind: protowire.Fixed64Type,
+	pref.Fixed64Kind:  protowire.Fixed64Type,
+	pref.DoubleKind:   protowire.Fixed64Type,
+	pref.StringKind:   protowire.BytesType,
+	pref.BytesKind:    protowire.BytesType,
+	pref.MessageKind:  protowire.BytesType,
+	pref.GroupKind:    protowire.StartGroupType,
+}
+
+// emptyBuf is used to decode an empty bytes field to a non-nil slice.
+var emptyBuf [0]byte
+
+// encodeScalar returns the wire representation of a scalar value
+// of a kind with a varint, fixed32, or fixed64 wire type.
+func encodeScalar(kind pref.Kind, v pref.Value) uint64 {
+	switch kind {
+	case pref.BoolKind:
+		return protowire.EncodeBool(v.Bool())
+	case pref.EnumKind:
+		return uint64(v.Enum())
+	case pref.Int32Kind:
+		return uint64(int32(v.Int()))
+	case pref.Sint32Kind:
+		return protowire.EncodeZigZag(int64(int32(v.Int())))
+	case pref.Uint32Kind, pref.Fixed32Kind:
+		return uint64(uint32(v.Uint()))
+	case pref.Int64Kind, pref.Sfixed64Kind:
+		return uint64(v.Int())
+	case pref.Sint64Kind:
+		return protowire.EncodeZigZag(v.Int())
+	case pref.Uint64Kind, pref.Fixed64Kind:
+		return v.Uint()
+	case pref.Sfixed32Kind:
+		return uint64(uint32(v.Int()))
+	case pref.FloatKind:
+		return uint64(math.Float32bits(float32(v.Float())))
+	case pref.DoubleKind:
+		return math.Float64bits(v.Float())
+	}
+	panic(errors.New("invalid kind %v", kind))
+}
+
+// decodeScalar is the inverse of encodeScalar.
+func decodeScalar(kind pref.Kind, v uint64) pref.Value {
+	switch kind {
+	case pref.BoolKind:
+		return pref.ValueOfBool(protowire.DecodeBool(v))
+	case pref.EnumKind:
+		return pref.ValueOfEnum(pref.EnumNumber(v))
+	case pref.Int32Kind, pref.Sfixed32Kind:
+		return pref.ValueOfInt32(int32(v))
+	case pref.Sint32Kind:
+		return pref.ValueOfInt32(int32(protowire.DecodeZigZag(v & math.MaxUint32)))
+	case pref.Uint32Kind, pref.Fixed32Kind:
+		return pref.ValueOfUint32(uint32(v))
+	case pref.Int64Kind, pref.Sfixed64Kind:
+		return pref.ValueOfInt64(int64(v))
+	case pref.Sint64Kind:
+		return pref.ValueOfInt64(protowire.DecodeZigZag(v))
+	case pref.Uint64Kind, pref.Fixed64Kind:
+		return pref.ValueOfUint64(v)
+	case pref.FloatKind:
+		return pref.ValueOfFloat32(math.Float32frombits(uint32(v)))
+	case pref.DoubleKind:
+		return pref.ValueOfFloat64(math.Float64frombits(v))
+	}
+	panic(errors.New("invalid kind %v", kind))
+}
+
+// sizeScalar returns the size of an encoded scalar value, excluding its tag.
+func sizeScalar(kind pref.Kind, wtyp protowire.Type, v pref.Value) int {
+	switch wtyp {
+	case protowire.VarintType:
+		return protowire.SizeVarint(encodeScalar(kind, v))
+	case protowire.Fixed32Type:
+		return protowire.SizeFixed32()
+	case protowire.Fixed64Type:
+		return protowire.SizeFixed64()
+	}
+	if kind == pref.StringKind {
+		return protowire.SizeBytes(len(v.String()))
+	}
+	return protowire.SizeBytes(len(v.Bytes()))
+}
+
+// appendScalar appends an encoded scalar value, excluding its tag.
+// String values are not validated.
+func appendScalar(b []byte, kind pref.Kind, wtyp protowire.Type, v pref.Value) []byte {
+	switch wtyp {
+	case protowire.VarintType:
+		return protowire.AppendVarint(b, encodeScalar(kind, v))
+	case protowire.Fixed32Type:
+		return protowire.AppendFixed32(b, uint32(encodeScalar(kind, v)))
+	case protowire.Fixed64Type:
+		return protowire.AppendFixed64(b, encodeScalar(kind, v))
+	}
+	if kind == pref.StringKind {
+		return protowire.AppendString(b, v.String())
+	}
+	return protowire.AppendBytes(b, v.Bytes())
+}
+
+// consumeScalar decodes a scalar value of the field's kind.
+// It returns errUnknown if the wire type does not match the kind.
+func (f *coderField) consumeScalar(b []byte, wtyp protowire.Type) (pref.Value, int, error) {
+	if wtyp != f.wiretyp {
+		return pref.Value{}, 0, errUnknown
+	}
+	var v uint64
+	var n int
+	switch wtyp {
+	case protowire.VarintType:
+		v, n = protowire.ConsumeVarint(b)
+	case protowire.Fixed32Type:
+		var v32 uint32
+		v32, n = protowire.ConsumeFixed32(b)
+		v = uint64(v32)
+	case protowire.Fixed64Type:
+		v, n = protowire.ConsumeFixed64(b)
+	case protowire.BytesType:
+		var buf []byte
+		buf, n = protowire.ConsumeBytes(b)
+		if n < 0 {
+			return pref.Value{}, 0, protowire.ParseError(n)
+		}
+		if f.kind == pref.StringKind {
+			if f.utf8 && !utf8.Valid(buf) {
+				return pref.Value{}, 0, errors.InvalidUTF8(string(f.fd.FullName()))
+			}
+			return pref.ValueOfString(string(buf)), n, nil
+		}
+		return pref.ValueOfBytes(append(emptyBuf[:], buf...)), n, nil
+	default:
+		return pref.Value{}, 0, errUnknown
+	}
+	if n < 0 {
+		return pref.Value{}, 0, protowire.ParseError(n)
+	}
+	return decodeScalar(f.kind, v), n, nil
+}
@@ -30,10 +30,38 @@ import (
 //
 // Operations which modify a Message are not safe for concurrent use.
 type Message struct {
-	typ     messageType
-	known   map[pref.FieldNumber]pref.Value
-	ext     map[pref.FieldNumber]pref.FieldDescriptor
+	info *messageInfo
+
+	// known holds the values of the known fields, indexed by the index of
+	// each field in the message descriptor. The value of a field is only
+	// meaningful if its bit in present is set. A nil known indicates an
+	// invalid, read-only message.
+	known   []pref.Value
+	present bitmap
+
+	// ext holds the populated extension fields. It is nil if none are.
+	ext     map[pref.FieldNumber]extensionField
 	unknown pref.RawFields
+
+	sizecache int32 // size computed by the last call to Size; accessed atomically
+}
+
+type extensionField struct {
+	desc pref.FieldDescriptor
+	val  pref.Value
+}
+
+// bitmap is a set of field indexes.
+type bitmap []uint64
+
+func newBitmap(n int) bitmap    { return make(bitmap, (n+63)/64) }
+func (b bitmap) has(i int) bool { return b[i/64]&(1<<uint(i%64)) != 0 }
+func (b bitmap) set(i int)      { b[i/64] |= 1 << uint(i%64) }
+func (b bitmap) clear(i int)    { b[i/64] &^= 1 << uint(i%64) }
+func (b bitmap) reset() {
+	for i := range b {
+		b[i] = 0
+	}
 }
 
 var (
@@ -43,12 +71,12 @@ var (
 )
 
 // NewMessage creates a new message with the provided descriptor.
+//
+// Each call creates a new message type, as if by NewMessageType. To create
+// many messages with the same descriptor, use the New method of a single
+// MessageType, so that the messages share the state used to encode them.
 func NewMessage(desc pref.MessageDescriptor) *Message {
-	return &Message{
-		typ:   messageType{desc},
-		known: make(map[pref.FieldNumber]pref.Value),
-		ext:   make(map[pref.FieldNumber]pref.FieldDescriptor),
-	}
+	return new(coderSet).messageInfo(desc).new()
 }
 
 // ProtoMessage implements the legacy message interface.
@@ -66,19 +94,26 @@ func (m *Message) String() string {
 
 // Reset clears the message to be empty, but preserves the dynamic message type.
 func (m *Message) Reset() {
-	m.known = make(map[pref.FieldNumber]pref.Value)
-	m.ext = make(map[pref.FieldNumber]pref.FieldDescriptor)
+	if m.known == nil {
+		*m = *m.info.new()
+		return
+	}
+	for i := range m.known {
+		m.known[i] = pref.Value{}
+	}
+	m.present.reset()
+	m.ext = nil
 	m.unknown = nil
 }
 
 // Descriptor returns the message descriptor.
 func (m *Message) Descriptor() pref.MessageDescriptor {
-	return m.typ.desc
+	return m.info.desc
 }
 
 // Type returns the message type.
 func (m *Message) Type() pref.MessageType {
-	return m.typ
+	return messageType{m.info}
 }
 
 // New returns a newly allocated empty message with the same descriptor.
@@ -96,21 +131,35 @@ func (m *Message) Interface() pref.ProtoMessage {
 // ProtoMethods is an internal detail of the protoreflect.Message interface.
 // Users should never call this directly.
 func (m *Message) ProtoMethods() *protoiface.Methods {
-	return nil
+	if m.known == nil || m.info.isMessageSet {
+		return nil
+	}
+	return &messageMethods
 }
 
 // Range visits every populated field in undefined order.
 // See protoreflect.Message for details.
 func (m *Message) Range(f func(pref.FieldDescriptor, pref.Value) bool) {
-	for num, v := range m.known {
-		fd := m.ext[num]
-		if fd == nil {
-			fd = m.Descriptor().Fields().ByNumber(num)
+	if m.known != nil {
+		fields := m.Descriptor().Fields()
+		for i, v := range m.known {
+			if !m.present.has(i) {
+				continue
+			}
+			fd := fields.Get(i)
+			if !isSet(fd, v) {
+				continue
+			}
+			if !f(fd, v) {
+				return
+			}
 		}
-		if !isSet(fd, v) {
+	}
+	for _, x := range m.ext {
+		if !isSet(x.desc, x.val) {
 			continue
 		}
-		if !f(fd, v) {
+		if !f(x.desc, x.val) {
 			return
 		}
 	}
@@ -120,37 +169,47 @@ func (m *Message) Range(f func(pref.FieldDescriptor, pref.Value) bool) {
 // See protoreflect.Message for details.
 func (m *Message) Has(fd pref.FieldDescriptor) bool {
 	m.checkField(fd)
-	if fd.IsExtension() && m.ext[fd.Number()] != fd {
-		return false
+	if fd.IsExtension() {
+		x, ok := m.ext[fd.Number()]
+		return ok && x.desc == fd && isSet(fd, x.val)
 	}
-	v, ok := m.known[fd.Number()]
-	if !ok {
+	i := fd.Index()
+	if m.known == nil || !m.present.has(i) {
 		return false
 	}
-	return isSet(fd, v)
+	return isSet(fd, m.known[i])
 }
 
 // Clear clears a field.
 // See protoreflect.Message for details.
 func (m *Message) Clear(fd pref.FieldDescriptor) {
 	m.checkField(fd)
-	num := fd.Number()
-	delete(m.known, num)
-	delete(m.ext, num)
+	if fd.IsExtension() {
+		delete(m.ext, fd.Number())
+		return
+	}
+	if m.known != nil {
+		m.clearIndex(fd.Index())
+	}
+}
+
+func (m *Message) clearIndex(i int) {
+	m.known[i] = pref.Value{}
+	m.present.clear(i)
 }
 
 // Get returns the value of a field.
 // See protoreflect.Message for details.
 func (m *Message) Get(fd pref.FieldDescriptor) pref.Value {
 	m.checkField(fd)
-	num := fd.Number()
 	if fd.IsExtension() {
-		if fd != m.ext[num] {
-			return fd.(pref.ExtensionTypeDescriptor).Type().Zero()
+		if x, ok := m.ext[fd.Number()]; ok && x.desc == fd {
+			return x.val
 		}
-		return m.known[num]
+		return fd.(pref.ExtensionTypeDescriptor).Type().Zero()
 	}
-	if v, ok := m.known[num]; ok {
+	if i := fd.Index(); m.known != nil && m.present.has(i) {
+		v := m.known[i]
 		switch {
 		case fd.IsMap():
 			if v.Map().Len() > 0 {
@@ -166,11 +225,11 @@ func (m *Message) Get(fd pref.FieldDescriptor) pref.Value {
 	}
 	switch {
 	case fd.IsMap():
-		return pref.ValueOfMap(&dynamicMap{desc: fd})
+		return pref.ValueOfMap(&dynamicMap{desc: fd, coders: m.info.coders})
 	case fd.IsList():
-		return pref.ValueOfList(emptyList{desc: fd})
+		return pref.ValueOfList(emptyList{desc: fd, coders: m.info.coders})
 	case fd.Message() != nil:
-		return pref.ValueOfMessage(&Message{typ: messageType{fd.Message()}})
+		return pref.ValueOfMessage(&Message{info: m.info.coders.messageInfo(fd.Message())})
 	case fd.Kind() == pref.BytesKind:
 		return pref.ValueOfBytes(append([]byte(nil), fd.Default().Bytes()...))
 	default:
@@ -188,23 +247,23 @@ func (m *Message) Mutable(fd pref.FieldDescriptor) pref.Value {
 	if m.known == nil {
 		panic(errors.New("%v: modification of read-only message", fd.FullName()))
 	}
-	num := fd.Number()
 	if fd.IsExtension() {
-		if fd != m.ext[num] {
-			m.ext[num] = fd
-			m.known[num] = fd.(pref.ExtensionTypeDescriptor).Type().New()
+		num := fd.Number()
+		x, ok := m.ext[num]
+		if !ok || x.desc != fd {
+			x = extensionField{fd, m.newExtension(fd.(pref.ExtensionTypeDescriptor).Type())}
+			m.setExtension(num, x)
 		}
-		return m.known[num]
+		return x.val
 	}
-	if v, ok := m.known[num]; ok {
-		return v
+	i := fd.Index()
+	if m.present.has(i) {
+		return m.known[i]
 	}
 	m.clearOtherOneofFields(fd)
-	m.known[num] = m.NewField(fd)
-	if fd.IsExtension() {
-		m.ext[num] = fd
-	}
-	return m.known[num]
+	m.known[i] = m.NewField(fd)
+	m.present.set(i)
+	return m.known[i]
 }
 
 // Set stores a value in a field.
@@ -229,12 +288,21 @@ func (m *Message) Set(fd pref.FieldDescriptor, v pref.Value) {
 		if !isValid {
 			panic(errors.New("%v: assigning invalid type %T", fd.FullName(), v.Interface()))
 		}
-		m.ext[fd.Number()] = fd
-	} else {
-		typecheck(fd, v)
+		m.setExtension(fd.Number(), extensionField{fd, v})
+		return
 	}
+	typecheck(fd, v)
 	m.clearOtherOneofFields(fd)
-	m.known[fd.Number()] = v
+	i := fd.Index()
+	m.known[i] = v
+	m.present.set(i)
+}
+
+func (m *Message) setExtension(num pref.FieldNumber, x extensionField) {
+	if m.ext == nil {
+		m.ext = make(map[pref.FieldNumber]extensionField)
+	}
+	m.ext[num] = x
 }
 
 func (m *Message) clearOtherOneofFields(fd pref.FieldDescriptor) {
@@ -244,8 +312,8 @@ func (m *Message) clearOtherOneofFields(fd pref.FieldDescriptor) {
 	}
 	num := fd.Number()
 	for i := 0; i < od.Fields().Len(); i++ {
-		if n := od.Fields().Get(i).Number(); n != num {
-			delete(m.known, n)
+		if fd := od.Fields().Get(i); fd.Number() != num {
+			m.clearIndex(fd.Index())
 		}
 	}
 }
@@ -254,21 +322,19 @@ func (m *Message) clearOtherOneofFields(fd pref.FieldDescriptor) {
 // See protoreflect.Message for details.
 func (m *Message) NewField(fd pref.FieldDescriptor) pref.Value {
 	m.checkField(fd)
-	switch {
-	case fd.IsExtension():
-		return fd.(pref.ExtensionTypeDescriptor).Type().New()
-	case fd.IsMap():
-		return pref.ValueOfMap(&dynamicMap{
-			desc: fd,
-			mapv: make(map[interface{}]pref.Value),
-		})
-	case fd.IsList():
-		return pref.ValueOfList(&dynamicList{desc: fd})
-	case fd.Message() != nil:
-		return pref.ValueOfMessage(NewMessage(fd.Message()).ProtoReflect())
-	default:
-		return fd.Default()
+	if fd.IsExtension() {
+		return m.newExtension(fd.(pref.ExtensionTypeDescriptor).Type())
+	}
+	return m.info.coders.newValue(fd)
+}
+
+// newExtension returns a new value for an extension of m.
+// Values of dynamic extension types share the coders of m.
+func (m *Message) newExtension(xt pref.ExtensionType) pref.Value {
+	if xt, ok := xt.(extensionType); ok {
+		return m.info.coders.newValue(xt.desc)
 	}
+	return xt.New()
 }
 
 // WhichOneof reports which field in a oneof is populated, returning nil if none are populated.
@@ -293,7 +359,7 @@ func (m *Message) GetUnknown() pref.RawFields {
 // See protoreflect.Message for details.
 func (m *Message) SetUnknown(r pref.RawFields) {
 	if m.known == nil {
-		panic(errors.New("%v: modification of read-only message", m.typ.desc.FullName()))
+		panic(errors.New("%v: modification of read-only message", m.info.desc.FullName()))
 	}
 	m.unknown = r
 }
@@ -322,23 +388,29 @@ func (m *Message) checkField(fd pref.FieldDescriptor) {
 }
 
 type messageType struct {
-	desc pref.MessageDescriptor
+	info *messageInfo
 }
 
 // NewMessageType creates a new MessageType with the provided descriptor.
 //
-// MessageTypes created by this package are equal if their descriptors are equal.
-// That is, if md1 == md2, then NewMessageType(md1) == NewMessageType(md2).
+// The state used to encode messages of the type is kept with the type, and is
+// shared by the types of the messages reachable from its fields. A MessageType
+// should therefore be reused for all messages with the same descriptor.
+//
+// MessageTypes created by this package are equal if they were created by the
+// same call to NewMessageType, or are the types of messages reachable from
+// the fields of messages of such a type.
 func NewMessageType(desc pref.MessageDescriptor) pref.MessageType {
-	return messageType{desc}
+	return messageType{new(coderSet).messageInfo(desc)}
 }
 
-func (mt messageType) New() pref.Message                  { return NewMessage(mt.desc) }
-func (mt messageType) Zero() pref.Message                 { return &Message{typ: messageType{mt.desc}} }
-func (mt messageType) Descriptor() pref.MessageDescriptor { return mt.desc }
+func (mt messageType) New() pref.Message                  { return mt.info.new() }
+func (mt messageType) Zero() pref.Message                 { return &Message{info: mt.info} }
+func (mt messageType) Descriptor() pref.MessageDescriptor { return mt.info.desc }
 
 type emptyList struct {
-	desc pref.FieldDescriptor
+	desc   pref.FieldDescriptor
+	coders *coderSet
 }
 
 func (x emptyList) Len() int                  { return 0 }
@@ -347,12 +419,13 @@ func (x emptyList) Set(n int, v pref.Value)   { panic(errors.New("modification o
 func (x emptyList) Append(v pref.Value)       { panic(errors.New("modification of immutable list")) }
 func (x emptyList) AppendMutable() pref.Value { panic(errors.New("modification of immutable list")) }
 func (x emptyList) Truncate(n int)            { panic(errors.New("modification of immutable list")) }
-func (x emptyList) NewElement() pref.Value    { return newListEntry(x.desc) }
+func (x emptyList) NewElement() pref.Value    { return newListEntry(x.desc, x.coders) }
 func (x emptyList) IsValid() bool             { return false }
 
 type dynamicList struct {
-	desc pref.FieldDescriptor
-	list []pref.Value
+	desc   pref.FieldDescriptor
+	list   []pref.Value
+	coders *coderSet
 }
 
 func (x *dynamicList) Len() int {
@@ -391,7 +464,7 @@ func (x *dynamicList) Truncate(n int) {
 }
 
 func (x *dynamicList) NewElement() pref.Value {
-	return newListEntry(x.desc)
+	return newListEntry(x.desc, x.coders)
 }
 
 func (x *dynamicList) IsValid() bool {
@@ -399,8 +472,9 @@ func (x *dynamicList) IsValid() bool {
 }
 
 type dynamicMap struct {
-	desc pref.FieldDescriptor
-	mapv map[interface{}]pref.Value
+	desc   pref.FieldDescriptor
+	mapv   map[interface{}]pref.Value
+	coders *coderSet
 }
 
 func (x *dynamicMap) Get(k pref.MapKey) pref.Value { return x.mapv[k.Interface()] }
@@ -425,7 +499,7 @@ func (x *dynamicMap) Mutable(k pref.MapKey) pref.Value {
 func (x *dynamicMap) Len() int { return len(x.mapv) }
 func (x *dynamicMap) NewValue() pref.Value {
 	if md := x.desc.MapValue().Message(); md != nil {
-		return pref.ValueOfMessage(NewMessage(md).ProtoReflect())
+		return pref.ValueOfMessage(x.coders.messageInfo(md).new())
 	}
 	return x.desc.MapValue().Default()
 }
@@ -549,7 +623,7 @@ func singularTypeIsValid(fd pref.FieldDescriptor, v pref.Value) error {
 	return nil
 }
 
-func newListEntry(fd pref.FieldDescriptor) pref.Value {
+func newListEntry(fd pref.FieldDescriptor, coders *coderSet) pref.Value {
 	switch fd.Kind() {
 	case pref.BoolKind:
 		return pref.ValueOfBool(false)
@@ -572,7 +646,7 @@ func newListEntry(fd pref.FieldDescriptor) pref.Value {
 	case pref.BytesKind:
 		return pref.ValueOfBytes(nil)
 	case pref.MessageKind, pref.GroupKind:
-		return pref.ValueOfMessage(NewMessage(fd.Message()).ProtoReflect())
+		return pref.ValueOfMessage(coders.messageInfo(fd.Message()).new())
 	}
 	panic(errors.New("%v: unknown kind %v", fd.FullName(), fd.Kind()))
 }
@@ -583,6 +657,10 @@ type extensionType struct {
 }
 
 // NewExtensionType creates a new ExtensionType with the provided descriptor.
+// The descriptor may be any extension descriptor, such as one created from
+// a descriptor set by the protodesc package. The extension type may be used
+// to get and set the extension on both dynamic and generated messages whose
+// full name matches the extended message.
 //
 // Dynamic ExtensionTypes with the same descriptor compare as equal. That is,
 // if xd1 == xd2, then NewExtensionType(xd1) == NewExtensionType(xd2).
@@ -609,29 +687,17 @@ func NewExtensionType(desc pref.ExtensionDescriptor) pref.ExtensionType {
 }
 
 func (xt extensionType) New() pref.Value {
-	switch {
-	case xt.desc.IsMap():
-		return pref.ValueOfMap(&dynamicMap{
-			desc: xt.desc,
-			mapv: make(map[interface{}]pref.Value),
-		})
-	case xt.desc.IsList():
-		return pref.ValueOfList(&dynamicList{desc: xt.desc})
-	case xt.desc.Message() != nil:
-		return pref.ValueOfMessage(NewMessage(xt.desc.Message()))
-	default:
-		return xt.desc.Default()
-	}
+	return new(coderSet).newValue(xt.desc)
 }
 
 func (xt extensionType) Zero() pref.Value {
 	switch {
 	case xt.desc.IsMap():
-		return pref.ValueOfMap(&dynamicMap{desc: xt.desc})
+		return pref.ValueOfMap(&dynamicMap{desc: xt.desc, coders: new(coderSet)})
 	case xt.desc.Cardinality() == pref.Repeated:
-		return pref.ValueOfList(emptyList{desc: xt.desc})
+		return pref.ValueOfList(emptyList{desc: xt.desc, coders: new(coderSet)})
 	case xt.desc.Message() != nil:
-		return pref.ValueOfMessage(&Message{typ: messageType{xt.desc.Message()}})
+		return pref.ValueOfMessage(&Message{info: new(coderSet).messageInfo(xt.desc.Message())})
 	default:
 		return xt.desc.Default()
 	}
@@ -5,14 +5,23 @@
 package dynamicpb_test
 
 import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"runtime"
 	"testing"
+	"time"
 
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
 	pref "google.golang.org/protobuf/reflect/protoreflect"
 	preg "google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/testing/prototest"
 	"google.golang.org/protobuf/types/dynamicpb"
 
+	regpb "google.golang.org/protobuf/internal/testprotos/registry"
 	testpb "google.golang.org/protobuf/internal/testprotos/test"
 	test3pb "google.golang.org/protobuf/internal/testprotos/test3"
 )
@@ -62,3 +71,389 @@ func (extResolver) RangeExtensionsByMessage(message pref.FullName, f func(pref.E
 		return f(dynamicpb.NewExtensionType(xt.TypeDescriptor().Descriptor()))
 	})
 }
+
+func TestExtensionTypeFromDescriptor(t *testing.T) {
+	// Create the extensions from a copy of the file descriptor, such that the
+	// extended message is not the descriptor of the generated message.
+	fd, err := protodesc.NewFile(protodesc.ToFileDescriptorProto(regpb.File_internal_testprotos_registry_test_proto), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name pref.Name
+		val  func(xt pref.ExtensionType) pref.Value
+		gen  pref.ExtensionType
+	}{{
+		name: "string_field",
+		val:  func(pref.ExtensionType) pref.Value { return pref.ValueOfString("hello") },
+		gen:  regpb.E_StringField,
+	}, {
+		name: "enum_field",
+		val:  func(pref.ExtensionType) pref.Value { return pref.ValueOfEnum(1) },
+		gen:  regpb.E_EnumField,
+	}, {
+		name: "message_field",
+		val:  func(xt pref.ExtensionType) pref.Value { return xt.New() },
+		gen:  regpb.E_MessageField,
+	}} {
+		xt := dynamicpb.NewExtensionType(fd.Extensions().ByName(tt.name))
+		v := xt.InterfaceOf(tt.val(xt))
+		var b []byte
+		for _, m := range []proto.Message{
+			&regpb.Message1{},
+			dynamicpb.NewMessage(fd.Messages().ByName("Message1")),
+		} {
+			proto.SetExtension(m, xt, v)
+			if !proto.HasExtension(m, xt) {
+				t.Errorf("HasExtension(%T, %v) = false, want true", m, tt.name)
+			}
+			if got := proto.GetExtension(m, xt); !reflect.DeepEqual(got, v) {
+				t.Errorf("GetExtension(%T, %v) = %v, want %v", m, tt.name, got, v)
+			}
+			mb, err := proto.Marshal(m)
+			if err != nil {
+				t.Fatalf("Marshal(%T) error: %v", m, err)
+			}
+			if b != nil && !bytes.Equal(b, mb) {
+				t.Errorf("Marshal(%T) = %x, want %x", m, mb, b)
+			}
+			b = mb
+		}
+
+		// The extension is interchangeable with the generated one.
+		m := &regpb.Message1{}
+		if err := proto.Unmarshal(b, m); err != nil {
+			t.Fatal(err)
+		}
+		if !proto.HasExtension(m, tt.gen) {
+			t.Errorf("HasExtension(%v) = false after unmarshal, want true", tt.gen.TypeDescriptor().FullName())
+		}
+		proto.ClearExtension(m, xt)
+		if proto.HasExtension(m, tt.gen) {
+			t.Errorf("HasExtension(%v) = true after clearing the dynamic extension, want false", tt.gen.TypeDescriptor().FullName())
+		}
+	}
+}
+
+func TestMessageReset(t *testing.T) {
+	md := (*testpb.TestAllExtensions)(nil).ProtoReflect().Descriptor()
+	m := dynamicpb.NewMessage(md)
+	xt := dynamicpb.NewExtensionType(testpb.E_OptionalInt32.TypeDescriptor())
+	proto.SetExtension(m, xt, int32(1))
+	m.SetUnknown(pref.RawFields{0x08, 0x01})
+	m.Reset()
+	if m.Descriptor() != md {
+		t.Errorf("Reset changed the descriptor to %v", m.Descriptor().FullName())
+	}
+	if proto.HasExtension(m, xt) || len(m.GetUnknown()) > 0 {
+		t.Errorf("Reset did not clear the message: %v", m)
+	}
+
+	// Resetting an invalid message makes it valid.
+	m = dynamicpb.NewMessage((*testpb.TestAllTypes)(nil).ProtoReflect().Descriptor())
+	fd := m.Descriptor().Fields().ByName("optional_nested_message")
+	nested := m.Get(fd).Message().Interface().(*dynamicpb.Message)
+	if nested.IsValid() {
+		t.Fatalf("Get(%v) on an empty message returned a valid message", fd.FullName())
+	}
+	nested.Reset()
+	if !nested.IsValid() {
+		t.Errorf("Reset did not make the message valid")
+	}
+}
+
+func fastPathMessages() []proto.Message {
+	unknown := protowire.AppendVarint(protowire.AppendTag(nil, 10000, protowire.VarintType), 1)
+	m2 := &testpb.TestAllTypes{
+		OptionalInt32:   proto.Int32(-1),
+		OptionalSint64:  proto.Int64(-2),
+		OptionalFixed32: proto.Uint32(3),
+		OptionalDouble:  proto.Float64(4.5),
+		OptionalString:  proto.String("string"),
+		OptionalBytes:   []byte{},
+		Optionalgroup:   &testpb.TestAllTypes_OptionalGroup{A: proto.Int32(5)},
+		OptionalNestedMessage: &testpb.TestAllTypes_NestedMessage{
+			A:           proto.Int32(6),
+			Corecursive: &testpb.TestAllTypes{OptionalInt64: proto.Int64(7)},
+		},
+		OptionalNestedEnum: testpb.TestAllTypes_NEG.Enum(),
+		RepeatedSfixed64:   []int64{-1, 2},
+		RepeatedString:     []string{"a", ""},
+		Repeatedgroup:      []*testpb.TestAllTypes_RepeatedGroup{{A: proto.Int32(8)}, {}},
+		RepeatedNestedMessage: []*testpb.TestAllTypes_NestedMessage{
+			{}, {A: proto.Int32(9)},
+		},
+		MapInt32Int32:   map[int32]int32{1: 2, -3: 4},
+		MapStringString: map[string]string{"a": "b", "": ""},
+		MapStringNestedMessage: map[string]*testpb.TestAllTypes_NestedMessage{
+			"a": {A: proto.Int32(10)},
+			"b": {},
+		},
+		OneofField: &testpb.TestAllTypes_OneofString{OneofString: "oneof"},
+	}
+	m2.ProtoReflect().SetUnknown(unknown)
+	m3 := &test3pb.TestAllTypes{
+		SingularInt32:         1,
+		SingularString:        "string",
+		SingularNestedMessage: &test3pb.TestAllTypes_NestedMessage{A: 2},
+		OptionalInt64:         proto.Int64(0),
+		RepeatedInt32:         []int32{1, -1, 1 << 20},
+		RepeatedDouble:        []float64{1, 2},
+		RepeatedNestedEnum:    []test3pb.TestAllTypes_NestedEnum{test3pb.TestAllTypes_BAR},
+		MapStringBytes:        map[string][]byte{"a": {1}, "b": nil},
+		OneofField:            &test3pb.TestAllTypes_OneofUint32{OneofUint32: 0},
+	}
+	ext := &testpb.TestAllExtensions{}
+	proto.SetExtension(ext, testpb.E_OptionalInt32, int32(1))
+	proto.SetExtension(ext, testpb.E_OptionalString, "string")
+	proto.SetExtension(ext, testpb.E_Optionalgroup, &testpb.OptionalGroup{A: proto.Int32(2)})
+	proto.SetExtension(ext, testpb.E_OptionalNestedMessage, &testpb.TestAllExtensions_NestedMessage{A: proto.Int32(3)})
+	proto.SetExtension(ext, testpb.E_RepeatedInt32, []int32{4, 5})
+	ext.ProtoReflect().SetUnknown(unknown)
+	return []proto.Message{m2, m3, ext}
+}
+
+func TestFastPathMethods(t *testing.T) {
+	for _, want := range fastPathMessages() {
+		md := want.ProtoReflect().Descriptor()
+		if dynamicpb.NewMessage(md).ProtoMethods() == nil {
+			t.Fatalf("NewMessage(%v).ProtoMethods() = nil, want fast-path methods", md.FullName())
+		}
+		opts := proto.MarshalOptions{Deterministic: true}
+		wantb, err := opts.Marshal(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The encoding of a dynamic message matches that of the generated message.
+		m := dynamicpb.NewMessage(md)
+		proto.Merge(m, want)
+		b, err := opts.Marshal(m)
+		if err != nil {
+			t.Fatalf("Marshal(%v) error: %v", md.FullName(), err)
+		}
+		if !bytes.Equal(b, wantb) {
+			t.Errorf("Marshal(%v):\ngot:  %x\nwant: %x", md.FullName(), b, wantb)
+		}
+		if got := proto.Size(m); got != len(wantb) {
+			t.Errorf("Size(%v) = %v, want %v", md.FullName(), got, len(wantb))
+		}
+
+		// Decoding produces the same message, using either kind of extension type.
+		for _, resolver := range []proto.UnmarshalOptions{
+			{},
+			{Resolver: extResolver{}},
+		} {
+			m := dynamicpb.NewMessage(md)
+			if err := resolver.Unmarshal(wantb, m); err != nil {
+				t.Fatalf("Unmarshal(%v) error: %v", md.FullName(), err)
+			}
+			b, err := opts.Marshal(m)
+			if err != nil {
+				t.Fatalf("Marshal(%v) error: %v", md.FullName(), err)
+			}
+			if !bytes.Equal(b, wantb) {
+				t.Errorf("Marshal(Unmarshal(%v)):\ngot:  %x\nwant: %x", md.FullName(), b, wantb)
+			}
+			if resolver.Resolver == nil && !proto.Equal(m, want) {
+				t.Errorf("Unmarshal(%v):\ngot:  %v\nwant: %v", md.FullName(), m, want)
+			}
+		}
+	}
+}
+
+func TestMessageTypeIdentity(t *testing.T) {
+	md := (*testpb.TestAllTypes)(nil).ProtoReflect().Descriptor()
+	mt := dynamicpb.NewMessageType(md)
+	m := mt.New()
+	if m.Type() != mt {
+		t.Errorf("New().Type() != MessageType")
+	}
+	if mt.Zero().Type() != mt {
+		t.Errorf("Zero().Type() != MessageType")
+	}
+	fd := md.Fields().ByName("optional_nested_message")
+	got := m.Get(fd).Message().Type()
+	if want := m.Mutable(fd).Message().Type(); got != want {
+		t.Errorf("types of the empty and populated %v differ", fd.FullName())
+	}
+	lfd := md.Fields().ByName("repeated_nested_message")
+	if elem := m.Mutable(lfd).List().NewElement().Message().Type(); elem != got {
+		t.Errorf("type of a %v element differs from the type of %v", lfd.FullName(), fd.FullName())
+	}
+}
+
+// TestMessageTypeCollected tests that the state kept by a dynamic message
+// type does not keep its descriptor alive once the type is unused.
+func TestMessageTypeCollected(t *testing.T) {
+	want := fastPathMessages()[1]
+	b, err := proto.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The descriptor is wrapped, since a finalizer does not run for an
+	// object that is part of a cycle, as the descriptors of a file are.
+	md := &messageDescriptor{want.ProtoReflect().Descriptor()}
+	collected := make(chan struct{})
+	runtime.SetFinalizer(md, func(*messageDescriptor) { close(collected) })
+	func() {
+		m := dynamicpb.NewMessage(md)
+		if err := proto.Unmarshal(b, m); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := proto.Marshal(m); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	md = nil
+	for i := 0; i < 100; i++ {
+		runtime.GC()
+		select {
+		case <-collected:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Errorf("descriptor of an unused dynamic message type was not garbage collected")
+}
+
+type messageDescriptor struct {
+	pref.MessageDescriptor
+}
+
+// TestFastPathWireTypes tests that records of every wire type, valid or not,
+// are decoded and re-encoded by dynamic messages as by generated messages.
+func TestFastPathWireTypes(t *testing.T) {
+	for _, gen := range []proto.Message{
+		&testpb.TestAllTypes{},
+		&test3pb.TestAllTypes{},
+		&testpb.TestAllExtensions{},
+	} {
+		md := gen.ProtoReflect().Descriptor()
+		var nums []protowire.Number
+		for i := 0; i < md.Fields().Len(); i++ {
+			nums = append(nums, md.Fields().Get(i).Number())
+		}
+		preg.GlobalTypes.RangeExtensionsByMessage(md.FullName(), func(xt pref.ExtensionType) bool {
+			nums = append(nums, xt.TypeDescriptor().Number())
+			return true
+		})
+		for _, num := range nums {
+			for _, wire := range [][]byte{
+				protowire.AppendVarint(protowire.AppendTag(nil, num, protowire.VarintType), 1),
+				protowire.AppendFixed32(protowire.AppendTag(nil, num, protowire.Fixed32Type), 1),
+				protowire.AppendFixed64(protowire.AppendTag(nil, num, protowire.Fixed64Type), 1),
+				protowire.AppendBytes(protowire.AppendTag(nil, num, protowire.BytesType), nil),
+				protowire.AppendTag(protowire.AppendTag(nil, num, protowire.StartGroupType), num, protowire.EndGroupType),
+			} {
+				want := gen.ProtoReflect().New().Interface()
+				werr := proto.Unmarshal(wire, want)
+				m := dynamicpb.NewMessage(md)
+				err := proto.Unmarshal(wire, m)
+				if (err == nil) != (werr == nil) {
+					t.Errorf("Unmarshal(%v, %x) = %v, want %v", md.FullName(), wire, err, werr)
+					continue
+				}
+				if err != nil {
+					continue
+				}
+				opts := proto.MarshalOptions{Deterministic: true}
+				wantb, err := opts.Marshal(want)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := opts.Marshal(m)
+				if err != nil {
+					t.Errorf("Marshal(Unmarshal(%v, %x)) error: %v", md.FullName(), wire, err)
+					continue
+				}
+				if !bytes.Equal(b, wantb) {
+					t.Errorf("Marshal(Unmarshal(%v, %x)):\ngot:  %x\nwant: %x", md.FullName(), wire, b, wantb)
+				}
+			}
+		}
+
+		// Empty composite fields are not encoded.
+		m := dynamicpb.NewMessage(md)
+		for i := 0; i < md.Fields().Len(); i++ {
+			if fd := md.Fields().Get(i); fd.IsList() || fd.IsMap() {
+				m.Mutable(fd)
+			}
+		}
+		if b, err := proto.Marshal(m); err != nil || len(b) > 0 {
+			t.Errorf("Marshal(%v) with empty lists and maps = %x, %v; want empty", md.FullName(), b, err)
+		}
+		if n := proto.Size(m); n != 0 {
+			t.Errorf("Size(%v) with empty lists and maps = %v, want 0", md.FullName(), n)
+		}
+	}
+}
+
+func TestFastPathRequired(t *testing.T) {
+	for _, tt := range []struct {
+		m       proto.Message
+		partial bool
+	}{
+		{m: &testpb.TestRequired{RequiredField: proto.Int32(1)}},
+		{m: &testpb.TestRequired{}, partial: true},
+		{m: &testpb.TestRequiredForeign{OptionalMessage: &testpb.TestRequired{}}, partial: true},
+		{m: &testpb.TestRequiredForeign{RepeatedMessage: []*testpb.TestRequired{
+			{RequiredField: proto.Int32(1)}, {},
+		}}, partial: true},
+		{m: &testpb.TestRequiredForeign{MapMessage: map[int32]*testpb.TestRequired{
+			1: {RequiredField: proto.Int32(1)},
+		}}},
+		{m: &testpb.TestRequiredForeign{MapMessage: map[int32]*testpb.TestRequired{1: {}}}, partial: true},
+		{m: &testpb.TestRequiredGroupFields{
+			Optionalgroup: &testpb.TestRequiredGroupFields_OptionalGroup{},
+		}, partial: true},
+	} {
+		md := tt.m.ProtoReflect().Descriptor()
+		b, err := proto.MarshalOptions{AllowPartial: true}.Marshal(tt.m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := dynamicpb.NewMessage(md)
+		if err := proto.Unmarshal(b, m); (err != nil) != tt.partial {
+			t.Errorf("Unmarshal(%v) error = %v, want error: %v", prototext.Format(tt.m), err, tt.partial)
+		}
+		m.Reset()
+		proto.Merge(m, tt.m)
+		if _, err := proto.Marshal(m); (err != nil) != tt.partial {
+			t.Errorf("Marshal(%v) error = %v, want error: %v", prototext.Format(tt.m), err, tt.partial)
+		}
+		if _, err := (proto.MarshalOptions{AllowPartial: true}).Marshal(m); err != nil {
+			t.Errorf("Marshal(%v) with AllowPartial error: %v", prototext.Format(tt.m), err)
+		}
+	}
+}
+
+func BenchmarkFastPath(b *testing.B) {
+	for _, gen := range fastPathMessages() {
+		md := gen.ProtoReflect().Descriptor()
+		dyn := dynamicpb.NewMessage(md)
+		proto.Merge(dyn, gen)
+		wire, err := proto.Marshal(gen)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, m := range []proto.Message{gen, dyn} {
+			b.Run(fmt.Sprintf("Marshal/%v/%T", md.Name(), m), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := proto.Marshal(m); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.Run(fmt.Sprintf("Unmarshal/%v/%T", md.Name(), m), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if err := proto.Unmarshal(wire, m); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
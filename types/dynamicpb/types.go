@@ -0,0 +1,180 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dynamicpb
+
+import (
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/internal/errors"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
+	preg "google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Types is a resolver of dynamic message and extension types for the
+// descriptors in a registry of files. It implements
+// protoregistry.MessageTypeResolver and protoregistry.ExtensionTypeResolver,
+// and so may be used to resolve google.protobuf.Any messages and extensions
+// when unmarshaling messages whose schema is only known at runtime.
+//
+// Message types are reused by later lookups of the same descriptor, so that
+// messages of the type share the state used to encode them. A message type
+// is held only while its descriptor is the one registered for its name:
+// it is replaced once a lookup finds a different descriptor, such as after
+// the file declaring it is replaced, and dropped once a lookup finds none.
+//
+// Types is safe for concurrent use by multiple goroutines.
+type Types struct {
+	files *preg.Files
+
+	mu       sync.RWMutex
+	messages map[pref.FullName]pref.MessageType
+}
+
+var (
+	_ preg.MessageTypeResolver   = (*Types)(nil)
+	_ preg.ExtensionTypeResolver = (*Types)(nil)
+)
+
+// NewTypes creates a new Types resolver for the descriptors in files.
+// Files registered with files after NewTypes returns are also resolved.
+func NewTypes(files *preg.Files) *Types {
+	return &Types{
+		files:    files,
+		messages: make(map[pref.FullName]pref.MessageType),
+	}
+}
+
+// MessageType returns the dynamic message type for desc, creating it if it
+// has not been created before. It is equivalent to NewMessageType(desc),
+// except that the type is reused by later calls with the same descriptor.
+func (t *Types) MessageType(desc pref.MessageDescriptor) pref.MessageType {
+	name := desc.FullName()
+	t.mu.RLock()
+	mt, ok := t.messages[name]
+	t.mu.RUnlock()
+	if ok && mt.Descriptor() == desc {
+		return mt
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if mt, ok := t.messages[name]; ok && mt.Descriptor() == desc {
+		return mt
+	}
+	mt = NewMessageType(desc)
+	t.messages[name] = mt
+	return mt
+}
+
+// ExtensionType returns the dynamic extension type for desc.
+// It is equivalent to NewExtensionType(desc); extension types are not kept,
+// since dynamic extension types with the same descriptor are equal.
+func (t *Types) ExtensionType(desc pref.ExtensionDescriptor) pref.ExtensionType {
+	return NewExtensionType(desc)
+}
+
+// FindMessageByName looks up a message by its full name.
+//
+// This returns (nil, protoregistry.NotFound) if not found.
+func (t *Types) FindMessageByName(name pref.FullName) (pref.MessageType, error) {
+	d, err := t.files.FindDescriptorByName(name)
+	if err != nil {
+		t.forgetMessage(name)
+		return nil, err
+	}
+	md, ok := d.(pref.MessageDescriptor)
+	if !ok {
+		t.forgetMessage(name)
+		return nil, errors.New("found wrong type: got %v, want message", kindName(d))
+	}
+	return t.MessageType(md), nil
+}
+
+// forgetMessage drops the message type for a name which no longer
+// refers to a registered message.
+func (t *Types) forgetMessage(name pref.FullName) {
+	t.mu.RLock()
+	_, ok := t.messages[name]
+	t.mu.RUnlock()
+	if ok {
+		t.mu.Lock()
+		delete(t.messages, name)
+		t.mu.Unlock()
+	}
+}
+
+// FindMessageByURL looks up a message by a URL identifier.
+// See documentation on google.protobuf.Any.type_url for the URL format.
+//
+// This returns (nil, protoregistry.NotFound) if not found.
+func (t *Types) FindMessageByURL(url string) (pref.MessageType, error) {
+	// This function is similar to FindMessageByName but
+	// truncates anything before and including '/' in the URL.
+	message := pref.FullName(url)
+	if i := strings.LastIndexByte(url, '/'); i >= 0 {
+		message = message[i+len("/"):]
+	}
+	return t.FindMessageByName(message)
+}
+
+// FindExtensionByName looks up an extension field by the field's full name.
+// Note that this is the full name of the field as determined by
+// where the extension is declared and is unrelated to the full name of the
+// message being extended.
+//
+// This returns (nil, protoregistry.NotFound) if not found.
+func (t *Types) FindExtensionByName(name pref.FullName) (pref.ExtensionType, error) {
+	d, err := t.files.FindDescriptorByName(name)
+	if err != nil {
+		return nil, err
+	}
+	xd, ok := d.(pref.ExtensionDescriptor)
+	if !ok || !xd.IsExtension() {
+		return nil, errors.New("found wrong type: got %v, want extension", kindName(d))
+	}
+	return t.ExtensionType(xd), nil
+}
+
+// FindExtensionByNumber looks up an extension field by the field number
+// within some parent message, identified by full name.
+//
+// This returns (nil, protoregistry.NotFound) if not found.
+func (t *Types) FindExtensionByNumber(message pref.FullName, field pref.FieldNumber) (pref.ExtensionType, error) {
+	var found pref.ExtensionDescriptor
+	t.files.RangeExtensionsByMessage(message, func(xd pref.ExtensionDescriptor) bool {
+		if xd.Number() == field {
+			found = xd
+			return false
+		}
+		return true
+	})
+	if found == nil {
+		return nil, preg.NotFound
+	}
+	return t.ExtensionType(found), nil
+}
+
+func kindName(d pref.Descriptor) string {
+	switch d := d.(type) {
+	case pref.EnumDescriptor:
+		return "enum"
+	case pref.EnumValueDescriptor:
+		return "enum value"
+	case pref.MessageDescriptor:
+		return "message"
+	case pref.FieldDescriptor:
+		if d.IsExtension() {
+			return "extension"
+		}
+		return "field"
+	case pref.OneofDescriptor:
+		return "oneof"
+	case pref.ServiceDescriptor:
+		return "service"
+	case pref.MethodDescriptor:
+		return "method"
+	}
+	return "descriptor"
+}
@@ -0,0 +1,193 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dynamicpb_test
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	pref "google.golang.org/protobuf/reflect/protoreflect"
+	preg "google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	regpb "google.golang.org/protobuf/internal/testprotos/registry"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func newTestTypes(tb testing.TB) (*dynamicpb.Types, pref.FileDescriptor, *preg.Files) {
+	fd, err := protodesc.NewFile(protodesc.ToFileDescriptorProto(regpb.File_internal_testprotos_registry_test_proto), nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	files := new(preg.Files)
+	if err := files.RegisterFile(fd); err != nil {
+		tb.Fatal(err)
+	}
+	return dynamicpb.NewTypes(files), fd, files
+}
+
+func TestTypes(t *testing.T) {
+	types, fd, _ := newTestTypes(t)
+
+	mt, err := types.FindMessageByName("testprotos.Message1")
+	if err != nil {
+		t.Fatalf("FindMessageByName(testprotos.Message1) error: %v", err)
+	}
+	if mt.Descriptor() != fd.Messages().ByName("Message1") {
+		t.Errorf("FindMessageByName(testprotos.Message1) = %v, want the registered descriptor", mt.Descriptor().FullName())
+	}
+	if got, _ := types.FindMessageByURL("type.googleapis.com/testprotos.Message1"); got != mt {
+		t.Errorf("FindMessageByURL(testprotos.Message1) did not return the cached type")
+	}
+	if got := types.MessageType(fd.Messages().ByName("Message1")); got != mt {
+		t.Errorf("MessageType(testprotos.Message1) did not return the cached type")
+	}
+
+	xt, err := types.FindExtensionByName("testprotos.string_field")
+	if err != nil {
+		t.Fatalf("FindExtensionByName(testprotos.string_field) error: %v", err)
+	}
+	if got, _ := types.FindExtensionByNumber("testprotos.Message1", 11); got != xt {
+		t.Errorf("FindExtensionByNumber(testprotos.Message1, 11) did not return the cached type")
+	}
+	if got := types.ExtensionType(xt.TypeDescriptor()); got != xt {
+		t.Errorf("ExtensionType(testprotos.string_field) did not return the cached type")
+	}
+
+	if _, err := types.FindMessageByName("testprotos.Missing"); err != preg.NotFound {
+		t.Errorf("FindMessageByName(testprotos.Missing) = %v, want NotFound", err)
+	}
+	if _, err := types.FindMessageByName("testprotos.Enum1"); err == nil || !strings.Contains(err.Error(), "want message") {
+		t.Errorf("FindMessageByName(testprotos.Enum1) = %v, want wrong type error", err)
+	}
+	if _, err := types.FindExtensionByName("testprotos.Message1"); err == nil || !strings.Contains(err.Error(), "want extension") {
+		t.Errorf("FindExtensionByName(testprotos.Message1) = %v, want wrong type error", err)
+	}
+	if _, err := types.FindExtensionByNumber("testprotos.Message1", 99); err != preg.NotFound {
+		t.Errorf("FindExtensionByNumber(testprotos.Message1, 99) = %v, want NotFound", err)
+	}
+}
+
+func TestTypesResolveAny(t *testing.T) {
+	types, _, _ := newTestTypes(t)
+	mt, err := types.FindMessageByName("testprotos.Message1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	xt, err := types.FindExtensionByName("testprotos.string_field")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := mt.New().Interface()
+	proto.SetExtension(m, xt, "hello")
+	b, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &anypb.Any{TypeUrl: "type.googleapis.com/testprotos.Message1", Value: b}
+
+	js, err := protojson.MarshalOptions{Resolver: types}.Marshal(want)
+	if err != nil {
+		t.Fatalf("protojson.Marshal error: %v", err)
+	}
+	if !strings.Contains(string(js), `"[testprotos.string_field]":"hello"`) {
+		t.Errorf("protojson.Marshal = %s, want the extension field", js)
+	}
+	got := new(anypb.Any)
+	if err := (protojson.UnmarshalOptions{Resolver: types}).Unmarshal(js, got); err != nil {
+		t.Fatalf("protojson.Unmarshal error: %v", err)
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("protojson round trip = %v, want %v", got, want)
+	}
+}
+
+func TestTypesReplaceFile(t *testing.T) {
+	types, fd, files := newTestTypes(t)
+	mt, err := types.FindMessageByName("testprotos.Message1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fd2, err := protodesc.NewFile(protodesc.ToFileDescriptorProto(fd), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := files.ReplaceFile(fd2); err != nil {
+		t.Fatal(err)
+	}
+	mt2, err := types.FindMessageByName("testprotos.Message1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mt2 == mt || mt2.Descriptor() != fd2.Messages().ByName("Message1") {
+		t.Errorf("FindMessageByName(testprotos.Message1) after ReplaceFile did not return a type for the new descriptor")
+	}
+
+	if err := files.DeleteFile(fd2.Path()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := types.FindMessageByName("testprotos.Message1"); err != preg.NotFound {
+		t.Errorf("FindMessageByName(testprotos.Message1) after DeleteFile = %v, want NotFound", err)
+	}
+	if got := types.MessageType(fd2.Messages().ByName("Message1")); got == mt2 {
+		t.Errorf("MessageType(testprotos.Message1) returned the type of a deleted file")
+	}
+}
+
+// uncachedTypes resolves messages without reusing their types.
+type uncachedTypes struct {
+	*dynamicpb.Types
+	files *preg.Files
+}
+
+func (t uncachedTypes) FindMessageByURL(url string) (pref.MessageType, error) {
+	d, err := t.files.FindDescriptorByName(pref.FullName(url[strings.LastIndexByte(url, '/')+1:]))
+	if err != nil {
+		return nil, err
+	}
+	return dynamicpb.NewMessageType(d.(pref.MessageDescriptor)), nil
+}
+
+func BenchmarkTypesResolveAny(b *testing.B) {
+	types, fd, files := newTestTypes(b)
+	m := dynamicpb.NewMessage(fd.Messages().ByName("Message1"))
+	xt, err := types.FindExtensionByName("testprotos.string_field")
+	if err != nil {
+		b.Fatal(err)
+	}
+	proto.SetExtension(m, xt, "hello")
+	any := &anypb.Any{TypeUrl: "type.googleapis.com/testprotos.Message1"}
+	if any.Value, err = proto.Marshal(m); err != nil {
+		b.Fatal(err)
+	}
+	js, err := protojson.MarshalOptions{Resolver: types}.Marshal(any)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bb := range []struct {
+		name     string
+		resolver interface {
+			preg.MessageTypeResolver
+			preg.ExtensionTypeResolver
+		}
+	}{
+		{"Types", types},
+		{"NewMessageType", uncachedTypes{types, files}},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			opts := protojson.UnmarshalOptions{Resolver: bb.resolver}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := opts.Unmarshal(js, new(anypb.Any)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}